@@ -0,0 +1,181 @@
+/*
+ * Exercises the C API in darix.h through the shared library. Built by the
+ * capi_test CMake target and run in CI; prints a FAIL line for each broken
+ * check and exits with 1 if there was any.
+ */
+#include "darix/darix.h"
+
+#include <stdio.h>
+#include <string.h>
+
+static int failures = 0;
+
+#define CHECK(name, cond)                     \
+    do {                                      \
+        if (!(cond)) {                        \
+            printf("FAIL: %s\n", name);       \
+            failures++;                       \
+        }                                     \
+    } while (0)
+
+/* darix_eval, returning its value as an int; -1 if it failed. */
+static int64_t evalInt(darix_vm* vm, const char* code) {
+    darix_value* v = darix_eval(vm, code);
+    if (!v) {
+        printf("error: %s\n", darix_last_error(vm));
+        return -1;
+    }
+    int64_t n = darix_as_int(v);
+    darix_value_free(v);
+    return n;
+}
+
+/* Whether darix_eval of code fails with message in darix_last_error. */
+static int failsWith(darix_vm* vm, const char* code, const char* message) {
+    darix_value* v = darix_eval(vm, code);
+    if (v) {
+        darix_value_free(v);
+        return 0;
+    }
+    return strstr(darix_last_error(vm), message) != NULL;
+}
+
+static darix_value* twice(darix_vm* vm, darix_value* const* args, size_t nargs, void* userdata) {
+    int* calls = (int*)userdata;
+    (*calls)++;
+    if (nargs != 1 || darix_typeof(args[0]) != DARIX_INT) {
+        darix_set_error(vm, "twice: expected an int");
+        return NULL;
+    }
+    return darix_int(darix_as_int(args[0]) * 2);
+}
+
+static void testEvalAndCall(void) {
+    darix_vm* vm = darix_new();
+    CHECK("eval returns the last value", evalInt(vm, "func add(a, b) { return a + b }\nadd(1, 2)") == 3);
+
+    darix_value* args[2] = {darix_int(40), darix_int(2)};
+    darix_value* sum = darix_call(vm, "add", args, 2);
+    CHECK("call a script function", sum && darix_as_int(sum) == 42);
+    darix_value_free(sum);
+    darix_value_free(args[0]);
+    darix_value_free(args[1]);
+
+    CHECK("call an undefined name fails", darix_call(vm, "missing", NULL, 0) == NULL);
+    CHECK("parse errors fail", darix_eval(vm, "func (") == NULL && darix_last_error(vm)[0] != '\0');
+
+    darix_value* list = darix_array();
+    darix_value* item = darix_string("x");
+    darix_array_push(list, item);
+    darix_set_global(vm, "items", list);
+    CHECK("globals set by the host", evalInt(vm, "append(items, \"y\")\nlen(items)") == 2);
+    CHECK("scripts change the host's array", darix_len(list) == 2);
+    darix_value_free(item);
+    darix_value_free(list);
+    darix_free(vm);
+}
+
+static void testRegister(void) {
+    darix_vm* vm = darix_new();
+    int calls = 0;
+    CHECK("register a callback", darix_register(vm, "twice", twice, &calls));
+    CHECK("register rejects bad names", !darix_register(vm, "not a name", twice, &calls));
+    CHECK("scripts call the callback", evalInt(vm, "twice(21)") == 42 && calls == 1);
+    CHECK("callback errors fail the script", failsWith(vm, "twice(\"a\")", "twice: expected an int"));
+    darix_free(vm);
+}
+
+static void testFork(void) {
+    darix_vm* base = darix_new();
+    int calls = 0;
+    darix_register(base, "twice", twice, &calls);
+    evalInt(base, "var counter = 1\nvar seen = []\nimport \"math\"\n0");
+
+    darix_vm* a = darix_fork(base);
+    darix_vm* b = darix_fork(base);
+    CHECK("fork keeps the globals", evalInt(a, "counter = counter + 10\nappend(seen, 1)\ncounter") == 11);
+    CHECK("forks do not see each other", evalInt(b, "len(seen) * 100 + counter") == 1);
+    CHECK("forks keep host callbacks", evalInt(b, "twice(counter)") == 2);
+    CHECK("forks get their own modules", evalInt(b, "append(math.seen, 2)\nlen(seen)") == 1);
+    darix_free(a);
+    darix_free(b);
+    CHECK("the snapshot is unchanged", evalInt(base, "len(seen) * 100 + counter") == 1);
+    darix_free(base);
+}
+
+static void testHandles(void) {
+    const char* path = "capi_test_handles.txt";
+    darix_vm* vm = darix_new();
+    evalInt(vm, "import \"fs\"\nfs.write(\"capi_test_handles.txt\", \"1\\n2\\n\")\nvar f = fs.open(\"capi_test_handles.txt\", \"r\")\n0");
+    darix_free(darix_new());
+    darix_free(darix_fork(vm));
+    CHECK("ending another vm leaves open files open", evalInt(vm, "int(fs.read_line(f)) + int(fs.read_line(f))") == 3);
+    darix_free(vm);
+    remove(path);
+}
+
+static void testFreeze(void) {
+    darix_vm* vm = darix_new();
+    darix_value* config = darix_map();
+    darix_value* db = darix_map();
+    darix_value* key = darix_string("port");
+    darix_value* port = darix_int(5432);
+    darix_map_set(db, key, port);
+    darix_value* dbKey = darix_string("db");
+    darix_map_set(config, dbKey, db);
+    darix_freeze(config, "config");
+    darix_set_global(vm, "config", config);
+
+    CHECK("frozen data can be read", evalInt(vm, "config[\"db\"][\"port\"]") == 5432);
+    CHECK("frozen data cannot be changed", failsWith(vm, "config[\"db\"][\"port\"] = 1", "config[\"db\"][\"port\"] is read-only"));
+    CHECK("the error is catchable", evalInt(vm, "var caught = 0\ntry { config[\"x\"] = 1 } catch (TypeError e) { caught = 1 }\ncaught") == 1);
+
+    darix_value_free(dbKey);
+    darix_value_free(port);
+    darix_value_free(key);
+    darix_value_free(db);
+    darix_value_free(config);
+    darix_free(vm);
+}
+
+static void testOutput(void) {
+    darix_vm* vm = darix_new();
+    darix_capture_output(vm, 1);
+    evalInt(vm, "print(\"hello\")\nprint(1, 2)\n0");
+    char* out = darix_take_output(vm);
+    CHECK("captured output", strcmp(out, "hello\n1 2\n") == 0);
+    darix_string_free(out);
+    out = darix_take_output(vm);
+    CHECK("taking output clears it", out[0] == '\0');
+    darix_string_free(out);
+    darix_free(vm);
+}
+
+static void testLimits(void) {
+    darix_vm* vm = darix_new();
+    darix_set_budget(vm, 10000);
+    CHECK("the budget stops a runaway loop", failsWith(vm, "while (true) { }", "instruction budget exceeded"));
+    CHECK("the budget is per call", evalInt(vm, "var n = 0\nfor (var i = 0; i < 10; i = i + 1) { n = n + i }\nn") == 45);
+    darix_set_budget(vm, 0);
+
+    darix_stop(vm);
+    CHECK("a stop interrupts the next run", failsWith(vm, "while (true) { }", "InterruptError"));
+    CHECK("a stop interrupts once", evalInt(vm, "7") == 7);
+    darix_free(vm);
+}
+
+int main(void) {
+    testEvalAndCall();
+    testRegister();
+    testFork();
+    testHandles();
+    testFreeze();
+    testOutput();
+    testLimits();
+    if (failures) {
+        printf("%d check(s) failed\n", failures);
+        return 1;
+    }
+    printf("all C API checks passed\n");
+    return 0;
+}
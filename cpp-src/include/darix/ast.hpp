@@ -39,12 +39,19 @@ enum class NodeType : uint8_t {
     YIELD_EXPRESSION, EXCEPTION_EXPRESSION
 };
 
+// Byte range [start, end) of a node in its source text
+struct Span {
+    int start = 0;
+    int end = 0;
+};
+
 // Base interfaces
 struct Node {
     virtual ~Node() = default;
     virtual std::string tokenLiteral() const = 0;
     virtual std::string inspect() const = 0;
     NodeType tag = NodeType::PROGRAM; // type tag for fast dispatch
+    Span span;                        // set by the parser for statements and expressions
 };
 
 struct Statement : virtual Node {
@@ -65,14 +72,19 @@ std::string blockString(const BlockStatementPtr& block);
 
 struct Program : Statement {
     std::vector<StatementPtr> statements;
+    bool strict = false; // "use strict" or --strict, see lang.hpp
     void statementNode() override {}
     std::string tokenLiteral() const override;
     std::string inspect() const override;
 };
 
+// import "go:math" [as m], or from "go:json" import a, b. Names in `names`
+// are bound on their own instead of the module; the token is then `from`.
 struct ImportStatement : Statement {
     Token token;
     std::shared_ptr<StringLiteral> path;
+    IdentifierPtr alias;
+    std::vector<IdentifierPtr> names;
     void statementNode() override {}
     std::string tokenLiteral() const override;
     std::string inspect() const override;
@@ -147,6 +159,7 @@ struct WhileStatement : Statement {
     Token token;
     ExpressionPtr condition;
     BlockStatementPtr body;
+    BlockStatementPtr elseBlock; // runs when the loop ends without break
     void statementNode() override {}
     std::string tokenLiteral() const override;
     std::string inspect() const override;
@@ -158,6 +171,20 @@ struct ForStatement : Statement {
     ExpressionPtr condition;
     StatementPtr post;
     BlockStatementPtr body;
+    BlockStatementPtr elseBlock;
+    void statementNode() override {}
+    std::string tokenLiteral() const override;
+    std::string inspect() const override;
+};
+
+// for (x in xs) or for (i, x in xs); key is null in the one-variable form.
+struct ForInStatement : Statement {
+    Token token;
+    IdentifierPtr key;
+    IdentifierPtr value;
+    ExpressionPtr iterable;
+    BlockStatementPtr body;
+    BlockStatementPtr elseBlock;
     void statementNode() override {}
     std::string tokenLiteral() const override;
     std::string inspect() const override;
@@ -192,9 +219,20 @@ struct ThrowStatement : Statement {
     std::string inspect() const override;
 };
 
+// defer expr: evaluates expr when the enclosing function exits.
+struct DeferStatement : Statement {
+    Token token;
+    ExpressionPtr expression;
+    void statementNode() override {}
+    std::string tokenLiteral() const override;
+    std::string inspect() const override;
+};
+
 struct CatchClause {
     Token token;
-    IdentifierPtr exceptionType;
+    // Types or groups the clause catches, as in `catch (TypeError | ValueError e)`;
+    // empty catches everything.
+    std::vector<IdentifierPtr> exceptionTypes;
     IdentifierPtr variable;
     BlockStatementPtr catchBlock;
     std::string inspect() const;
@@ -260,6 +298,45 @@ struct WithStatement : Statement {
     std::string inspect() const override;
 };
 
+// A case's pattern in a match statement. A literal matches an equal value;
+// a capture matches anything and binds it, except `_`, which binds nothing.
+// An array pattern matches an array of its length, or of at least that many
+// elements when it ends in *rest, which binds the remainder; a map pattern
+// matches a map holding each of its keys, and may hold others.
+struct Pattern {
+    enum class Kind { Literal, Capture, Array, Map };
+    Kind kind = Kind::Literal;
+    Token token;
+    ExpressionPtr value;                           // Literal
+    IdentifierPtr name;                            // Capture
+    std::vector<std::shared_ptr<Pattern>> elements; // Array
+    IdentifierPtr rest;                            // Array: *rest, if any
+    std::vector<std::pair<ExpressionPtr, std::shared_ptr<Pattern>>> entries; // Map: literal key, pattern
+    std::string inspect() const;
+    // The names the pattern binds, in source order; `_` is left out.
+    void captures(std::vector<Identifier*>& out) const;
+};
+
+struct MatchCase {
+    Token token;
+    std::shared_ptr<Pattern> pattern;
+    ExpressionPtr guard; // `if` condition, or null
+    BlockStatementPtr body;
+    std::string inspect() const;
+};
+
+// match (subject) { case pattern if guard { ... } ... } runs the first case
+// whose pattern matches and whose guard holds; `match` and `case` are only
+// keywords there.
+struct MatchStatement : Statement {
+    Token token;
+    ExpressionPtr subject;
+    std::vector<std::shared_ptr<MatchCase>> cases;
+    void statementNode() override {}
+    std::string tokenLiteral() const override;
+    std::string inspect() const override;
+};
+
 // ============ Expressions ============
 
 struct Identifier : Expression {
@@ -286,6 +363,16 @@ struct FloatLiteral : Expression {
     std::string inspect() const override;
 };
 
+// 10.50d, held as units / 10^scale (1050 and 2).
+struct DecimalLiteral : Expression {
+    Token token;
+    int64_t units = 0;
+    int scale = 0;
+    void expressionNode() override {}
+    std::string tokenLiteral() const override;
+    std::string inspect() const override;
+};
+
 struct StringLiteral : Expression {
     Token token;
     std::string value;
@@ -0,0 +1,47 @@
+#pragma once
+
+#include "darix/ast.hpp"
+#include <functional>
+
+// Generic AST traversal, so tools (linters, formatters, optimizers, codemods)
+// don't each need their own type switch over every node type.
+namespace darix::walk {
+
+// Calls fn on each direct, non-null child of node in source order.
+// CatchClause is not a Node, so a try statement's catch clauses contribute
+// their type, variable and block directly; likewise a match statement's cases
+// contribute their patterns' literals and names, guard and block.
+void children(Node* node, const std::function<void(Node*)>& fn);
+
+// Calls fn on each token node holds itself rather than through a child node:
+// its own, and those of a try statement's catch clauses or a match
+// statement's cases and patterns. A Program has none.
+void tokens(Node* node, const std::function<void(Token&)>& fn);
+
+// Pre-order traversal. fn is called for node and then, if it returns true,
+// for each of node's descendants.
+void inspect(Node* node, const std::function<bool(Node*)>& fn);
+
+// Visitor with enter/leave hooks. Returning false from enter skips the
+// node's children; leave is still called.
+struct Visitor {
+    virtual ~Visitor() = default;
+    virtual bool enter(Node*) { return true; }
+    virtual void leave(Node*) {}
+};
+
+void walk(Visitor& visitor, Node* node);
+
+// Post-order rewriting: children are rewritten before their parent is offered
+// to the callbacks. expression is applied to every expression slot and returns
+// the replacement (or its argument to keep it; null also keeps it). statement
+// is applied to every statement; returning null removes the statement from its
+// enclosing list. Identifier-typed slots (names, parameters) are not rewritten.
+struct Rewriter {
+    std::function<ExpressionPtr(const ExpressionPtr&)> expression;
+    std::function<StatementPtr(const StatementPtr&)> statement;
+};
+
+void rewrite(Node* root, const Rewriter& rewriter);
+
+} // namespace darix::walk
@@ -0,0 +1,28 @@
+#pragma once
+
+#include <string>
+
+namespace darix {
+
+// A script packed into a copy of the runtime by `darix bundle`. The payload
+// is appended to the executable, followed by a trailer holding its size and a
+// magic marker, so the bundled binary finds it by reading its own tail:
+//   <runtime> <name> \0 <script> <payload size: 8 bytes LE> "DARIXBND"
+// The script is source text or .daxc bytecode, whichever was bundled.
+struct Bundle {
+    std::string filename;  // reported in errors and stack traces
+    std::string script;
+};
+
+// Path of the running executable, falling back to argv0.
+std::string executablePath(const char* argv0);
+
+// Reads the bundle appended to the executable at path. Returns false if
+// there is none, as for a plain darix binary.
+bool readBundle(const std::string& path, Bundle* out);
+
+// Writes a copy of the runtime at runtimePath with bundle appended and marks
+// it executable. A bundle already on the runtime is replaced.
+bool writeBundle(const std::string& runtimePath, const Bundle& bundle, const std::string& output, std::string* error);
+
+} // namespace darix
@@ -46,6 +46,8 @@ enum class Opcode : uint8_t {
     OpGetLocal,
     OpSetLocal,
     OpSwap,
+    OpIterable,
+    OpIterNext,
 };
 
 struct Definition {
@@ -54,8 +56,57 @@ struct Definition {
 };
 
 const Definition* Lookup(Opcode op);
+std::optional<Opcode> LookupName(const std::string& name);
 Instructions Make(Opcode op, const std::vector<int>& operands = {});
 std::pair<std::vector<int>, int> ReadOperands(const Definition* def, const uint8_t* ins, size_t length);
-std::string Disassemble(const Instructions& ins);
+// globals names the global slots; OpGetGlobal and OpSetGlobal are annotated
+// with them as a trailing comment.
+std::string Disassemble(const Instructions& ins, const std::vector<std::string>& globals = {});
+
+// One decoded instruction. def is null for an unknown opcode byte, which is
+// then reported with a width of 1.
+struct Instruction {
+    Opcode op = Opcode::OpNop;
+    const Definition* def = nullptr;
+    std::vector<int> operands;
+    int width = 1; // bytes, including the opcode
+    int pc = 0;    // offset of the opcode byte
+};
+
+// Forward iterator decoding Instructions one at a time:
+//   for (const auto& in : Decode(ins)) ...
+// An instruction whose operands run past the end reads them as 0 and ends
+// the iteration.
+class InstructionIterator {
+public:
+    InstructionIterator(const Instructions* ins, size_t pc);
+
+    const Instruction& operator*() const { return current_; }
+    const Instruction* operator->() const { return &current_; }
+    InstructionIterator& operator++();
+    bool operator==(const InstructionIterator& other) const { return pc_ == other.pc_; }
+    bool operator!=(const InstructionIterator& other) const { return pc_ != other.pc_; }
+
+private:
+    void decode();
+
+    const Instructions* ins_;
+    size_t pc_;
+    Instruction current_;
+};
+
+struct InstructionRange {
+    const Instructions* ins;
+    InstructionIterator begin() const { return {ins, 0}; }
+    InstructionIterator end() const { return {ins, ins->size()}; }
+};
+
+inline InstructionRange Decode(const Instructions& ins) { return {&ins}; }
+
+// Builds Instructions from the text form printed by Disassemble: one
+// instruction per line, an optional leading offset, the opcode name and its
+// operands. Blank lines and text after '#' are ignored. Throws
+// std::runtime_error naming the line on unknown opcodes or bad operands.
+Instructions Assemble(const std::string& text);
 
 } // namespace darix
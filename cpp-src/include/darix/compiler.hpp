@@ -3,13 +3,34 @@
 #include "darix/ast.hpp"
 #include "darix/code.hpp"
 #include "darix/object.hpp"
+#include "darix/optimizer.hpp"
+#include <functional>
 #include <string>
+#include <unordered_map>
 #include <vector>
 
 namespace darix {
 
 constexpr const char* BytecodeMagic = "DRXB1";
 
+// Version of the serialized bytecode layout and instruction semantics. Bump it
+// whenever either changes and teach upgradeBytecode to migrate the old form.
+// v2 stores builtin and function constants, deduplicates constants and adds
+// the global-name table; v1 files wrote those constants as null, so they
+// cannot be migrated and must be recompiled.
+constexpr uint16_t BytecodeFormatVersion = 2;
+constexpr uint16_t MinBytecodeFormatVersion = 2;
+
+// Compiler features recorded in the bytecode header. A runtime refuses
+// bytecode that depends on a feature it does not know about.
+enum BytecodeFeature : uint32_t {
+    FeatureDebugInfo = 1u << 0, // per-instruction source positions
+    FeaturePeephole = 1u << 1,  // peephole pass applied
+    FeatureGlobalNames = 1u << 2, // name of each global slot
+    FeatureFunctions = 1u << 3,   // compiled function and builtin constants
+};
+constexpr uint32_t SupportedBytecodeFeatures = FeatureDebugInfo | FeaturePeephole | FeatureGlobalNames | FeatureFunctions;
+
 // Symbol table
 enum class SymbolScope { GLOBAL, LOCAL };
 
@@ -28,6 +49,7 @@ public:
     std::pair<Symbol, bool> resolve(const std::string& name) const;
 
     int numDefinitions() const { return numDefinitions_; }
+    const std::unordered_map<std::string, Symbol>& symbols() const { return store_; }
     std::shared_ptr<SymbolTable> outer() const { return outer_; }
 
 private:
@@ -47,21 +69,41 @@ struct DebugEntry {
 
 struct DebugInfo {
     std::vector<DebugEntry> entries;
+    // Source name of each global slot by index, for disassembly and errors.
+    std::vector<std::string> globals;
 };
 
 // Bytecode
 struct Bytecode {
     std::string magic;
-    std::string version;
+    std::string version;            // DariX version of the compiler that produced it
+    uint16_t formatVersion = BytecodeFormatVersion;
+    uint32_t features = 0;          // BytecodeFeature bits
     Instructions instructions;
     std::vector<ObjectPtr> constants;
     DebugInfo debug;
 };
 
+// Looks up a builtin function that bytecode may use as a value, or returns
+// null (see Interpreter::bytecodeBuiltin), setting *why when the builtin
+// exists but is left out of bytecode. Native module functions are looked up
+// as mod.fn.
+using BuiltinResolver = std::function<std::shared_ptr<Builtin>(const std::string& name, std::string* why)>;
+
 // Compiler
 class Compiler {
 public:
     Compiler();
+    // Compiles against an existing global symbol table, so names defined by
+    // earlier compilations keep their slots (used by the REPL).
+    explicit Compiler(std::shared_ptr<SymbolTable> symbols);
+    // Also continues an existing constant pool, so functions compiled by
+    // earlier compilations keep valid constant indices (used by the REPL).
+    Compiler(std::shared_ptr<SymbolTable> symbols, std::vector<ObjectPtr> constants);
+
+    // Lets names that are not variables compile to builtin constants, such
+    // as `var f = len`. Without it they are undefined.
+    void setBuiltins(BuiltinResolver resolve) { resolveBuiltin_ = std::move(resolve); }
 
     bool compile(Node* node);
     std::shared_ptr<Bytecode> bytecode();
@@ -70,23 +112,57 @@ private:
     int emit(Opcode op, const std::vector<int>& operands = {});
     int emitAt(Node* node, Opcode op, const std::vector<int>& operands = {});
     int addConstant(ObjectPtr obj);
+    // The key addConstant shares equal constants under, or "" for none.
+    static std::string constantKey(const ObjectPtr& obj);
     void compileStatements(const std::vector<StatementPtr>& stmts);
     bool compileBlock(const BlockStatementPtr& block);
     void compileExpressions(const std::vector<ExpressionPtr>& exprs);
-    // Returns true if the builtin was handled and the expression does NOT push a value
+    // Returns true if the builtin was handled; like every expression, it
+    // leaves exactly one value on the stack.
     bool compileBuiltinCall(CallExpression* node, const std::string& name);
+    void compileImport(ImportStatement* node);
+    // Compiles a function body in a new local scope and returns the constant
+    // index of the resulting CompiledFunction.
+    int compileFunction(const std::string& name, const std::vector<IdentifierPtr>& params, const BlockStatementPtr& body);
+    // The variable name in the current scope, defined there if it is new.
+    Symbol declare(const std::string& name);
+    // Resolves a variable. Throws for the locals of an enclosing function,
+    // since reaching them would need closures.
+    std::pair<Symbol, bool> resolveSymbol(const std::string& name) const;
+    void emitGet(Node* node, const Symbol& sym);
+    void emitSet(Node* node, const Symbol& sym);
     void replaceOperand(int pos, int operand);
     void replaceInstruction(int pos, const Instructions& newIns);
 
     Instructions instructions_;
     std::vector<ObjectPtr> constants_;
+    // Index of each integer, float and string constant by value, so a
+    // repeated literal shares one pool entry.
+    std::unordered_map<std::string, int> constantIndex_;
     std::shared_ptr<SymbolTable> symbolTable_;
+    // Assigning to an undeclared name is rejected, leaving strict programs
+    // to the interpreter, which raises NameError for it.
+    bool strict_ = false;
     std::vector<DebugEntry> debugEntries_;
-    bool lastCompiledPushedValue_ = true;
+    BuiltinResolver resolveBuiltin_;
+    // Native module by the global name an import bound it to.
+    std::unordered_map<std::string, std::string> modules_;
 };
 
-// Constant folding
-ObjectPtr foldConstExpr(Node* node, bool* ok);
+// Bytecode files (.daxc). loadBytecode checks the header against this
+// runtime: newer formats, unknown features and unknown opcodes are rejected
+// with a message in *error; older formats are upgraded in place.
+std::string serializeBytecode(const Bytecode& bc);
+std::shared_ptr<Bytecode> loadBytecode(const std::string& data, std::string* error);
+bool isBytecodeFile(const std::string& data);
+// Builtin constants are loaded by name only; this binds each to the runtime's
+// builtin, failing with a message in *error for names it does not provide.
+bool linkBuiltins(Bytecode& bc, const BuiltinResolver& resolve, std::string* error);
+std::string describeFeatures(uint32_t features);
+// "5 (2 integers, 1 float, 2 strings; 12 bytes of string data)" for disasm.
+std::string describeConstantPool(const std::vector<ObjectPtr>& constants);
+// The names in symbols by slot index, as recorded in DebugInfo::globals.
+std::vector<std::string> globalNames(const SymbolTable& symbols);
 
 // Peephole optimizer
 Instructions peephole(const Instructions& ins);
@@ -0,0 +1,149 @@
+/*
+ * C API for embedding DariX in other programs (C, C++, Python via ctypes, ...).
+ * Build the shared library with the darix_shared CMake target.
+ *
+ *   darix_vm* vm = darix_new();
+ *   darix_value* v = darix_eval(vm, "func add(a, b) { return a + b }\nadd(1, 2)");
+ *   if (!v) fprintf(stderr, "%s\n", darix_last_error(vm));
+ *   else printf("%lld\n", (long long)darix_as_int(v));
+ *   darix_value_free(v);
+ *   darix_free(vm);
+ *
+ * Every darix_value* returned by the API is owned by the caller and released
+ * with darix_value_free; values passed in are only borrowed. Values share
+ * their underlying object, so a map built here and passed to a script is the
+ * same map the script mutates. A darix_vm is not thread-safe, and only one
+ * should run at a time: native modules call back into the running one.
+ */
+#ifndef DARIX_H
+#define DARIX_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+#if defined(_WIN32) && defined(DARIX_BUILD)
+#define DARIX_API __declspec(dllexport)
+#elif defined(_WIN32)
+#define DARIX_API __declspec(dllimport)
+#else
+#define DARIX_API __attribute__((visibility("default")))
+#endif
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+typedef struct darix_vm darix_vm;
+typedef struct darix_value darix_value;
+
+typedef enum {
+    DARIX_NULL,
+    DARIX_BOOL,
+    DARIX_INT,
+    DARIX_FLOAT,
+    DARIX_STRING,
+    DARIX_ARRAY,
+    DARIX_MAP,
+    DARIX_OTHER /* functions, instances, modules, ...: opaque, but can be passed back */
+} darix_type;
+
+/* A host function callable from scripts. args are borrowed for the call.
+ * Return a new value (owned by DariX from then on), or NULL to fail the
+ * call with the message given to darix_set_error. */
+typedef darix_value* (*darix_callback)(darix_vm* vm, darix_value* const* args, size_t nargs, void* userdata);
+
+DARIX_API darix_vm* darix_new(void);
+DARIX_API void darix_free(darix_vm* vm);
+
+/* A new vm that starts as a copy of vm: its globals, functions and classes,
+ * loaded modules and registered host functions. Running a script in the copy
+ * leaves vm as it was, so a host can set vm up once and fork it for each
+ * request instead of repeating the setup; frozen values are shared rather
+ * than copied. Only one of them may run at a time. Freeing a fork closes the
+ * files and sockets the fork opened; those vm's setup opened stay open. */
+DARIX_API darix_vm* darix_fork(const darix_vm* vm);
+
+/* Runs code in the vm's global scope and returns the value of its last
+ * statement. Returns NULL on a parse error, runtime error or uncaught
+ * exception; darix_last_error then describes it. */
+DARIX_API darix_value* darix_eval(darix_vm* vm, const char* code);
+
+/* Calls the global function or class name. NULL on failure, as darix_eval. */
+DARIX_API darix_value* darix_call(darix_vm* vm, const char* name, darix_value* const* args, size_t nargs);
+
+/* Stops the darix_eval or darix_call running on vm; safe to call from
+ * another thread. The script gets a catchable InterruptError at its next
+ * statement or loop iteration; if it does not catch it, the call fails. */
+DARIX_API void darix_stop(darix_vm* vm);
+
+/* Limits each darix_eval or darix_call on vm to n evaluation steps; 0 removes
+ * the limit. A script that runs out fails with "instruction budget exceeded",
+ * which it cannot catch to keep going. Forks start with vm's budget. */
+DARIX_API void darix_set_budget(darix_vm* vm, int n);
+
+/* While enabled is nonzero, what scripts print on vm (print, pprint and the
+ * io module) is kept for darix_take_output instead of going to stdout. */
+DARIX_API void darix_capture_output(darix_vm* vm, int enabled);
+/* The output captured on vm since the last call, owned by the caller;
+ * release with darix_string_free. */
+DARIX_API char* darix_take_output(darix_vm* vm);
+
+/* The message for the last failed call on vm, or "" if it succeeded. */
+DARIX_API const char* darix_last_error(const darix_vm* vm);
+/* Sets the error a failing callback reports. */
+DARIX_API void darix_set_error(darix_vm* vm, const char* message);
+
+/* Makes fn callable from scripts as the global name. Returns 0 if name is
+ * not a valid identifier. */
+DARIX_API int darix_register(darix_vm* vm, const char* name, darix_callback fn, void* userdata);
+
+/* Globals. darix_get_global returns NULL if name is not defined. */
+DARIX_API void darix_set_global(darix_vm* vm, const char* name, const darix_value* value);
+DARIX_API darix_value* darix_get_global(darix_vm* vm, const char* name);
+
+/* Building values. */
+DARIX_API darix_value* darix_null(void);
+DARIX_API darix_value* darix_bool(int value);
+DARIX_API darix_value* darix_int(int64_t value);
+DARIX_API darix_value* darix_float(double value);
+DARIX_API darix_value* darix_string(const char* value);
+DARIX_API darix_value* darix_string_n(const char* value, size_t len);
+DARIX_API darix_value* darix_array(void);
+DARIX_API void darix_array_push(darix_value* array, const darix_value* item);
+DARIX_API darix_value* darix_map(void);
+DARIX_API void darix_map_set(darix_value* map, const darix_value* key, const darix_value* value);
+/* Makes value and every array and map inside it read-only to scripts, for
+ * host data they may read but not change. A script that assigns to it, deletes
+ * from it or appends to it gets a TypeError naming the path it tried to
+ * change, starting from name: config["db"]["port"] is read-only. The host can
+ * still change it with darix_array_push and darix_map_set. */
+DARIX_API void darix_freeze(darix_value* value, const char* name);
+DARIX_API darix_value* darix_value_copy(const darix_value* value);
+DARIX_API void darix_value_free(darix_value* value);
+
+/* Reading values. The as_ functions return 0, 0.0 or "" for the wrong type;
+ * an int reads as a float and a float as a truncated int. */
+DARIX_API darix_type darix_typeof(const darix_value* value);
+DARIX_API int darix_as_bool(const darix_value* value);
+DARIX_API int64_t darix_as_int(const darix_value* value);
+DARIX_API double darix_as_float(const darix_value* value);
+/* Valid while value is alive; len (optional) receives the byte length. */
+DARIX_API const char* darix_as_string(const darix_value* value, size_t* len);
+/* Number of elements of an array or entries of a map, otherwise 0. */
+DARIX_API size_t darix_len(const darix_value* value);
+/* Element i of an array, or NULL if out of range. */
+DARIX_API darix_value* darix_array_get(const darix_value* array, size_t index);
+/* Key or value of entry i of a map, in the map's iteration order. */
+DARIX_API darix_value* darix_map_key(const darix_value* map, size_t index);
+DARIX_API darix_value* darix_map_value(const darix_value* map, size_t index);
+/* The value for key in a map, or NULL if absent. */
+DARIX_API darix_value* darix_map_get(const darix_value* map, const darix_value* key);
+/* repr() of value, owned by the caller; release with darix_string_free. */
+DARIX_API char* darix_repr(const darix_value* value);
+DARIX_API void darix_string_free(char* text);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif /* DARIX_H */
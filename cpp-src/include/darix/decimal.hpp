@@ -0,0 +1,37 @@
+#pragma once
+
+#include "darix/object.hpp"
+#include <string>
+
+namespace darix {
+
+// Fixed-point arithmetic behind the Decimal type. A Decimal is
+// units / 10^scale with 0 <= scale <= DecimalMaxScale, so values of up to 18
+// significant digits are held exactly. +, - , * and % are exact and raise
+// OverflowError when the result does not fit; / is exact when the quotient
+// fits and otherwise rounds half to even to as many places as fit.
+constexpr int DecimalMaxScale = 18;
+
+// Parses "-12.50" or "1.5e-3". Fails on other text and on values that need
+// more than DecimalMaxScale places or more digits than fit.
+bool parseDecimal(const std::string& text, int64_t* units, int* scale);
+// "10.50": the scale's trailing zeros are kept.
+std::string formatDecimal(int64_t units, int scale);
+// The double nearest to d.
+double decimalToDouble(const Decimal& d);
+
+// Converts a Decimal, Integer, String or Float (through its shortest text,
+// so 0.1 becomes 0.1 exactly) to a Decimal. Returns a ValueError or TypeError
+// signal when it cannot.
+ObjectPtr toDecimal(const ObjectPtr& value);
+// d rounded half to even, or padded with zeros, to places decimal places.
+ObjectPtr rescaleDecimal(const Decimal& d, int places);
+
+// left op right for op in + - * / %, where either side may be an Integer.
+// Returns an OverflowError or ZeroDivisionError signal when the result
+// cannot be produced, or nullptr for other operators.
+ObjectPtr decimalArithmetic(const std::string& op, const ObjectPtr& left, const ObjectPtr& right);
+// -1, 0 or 1, comparing exactly; either side may be an Integer.
+int compareDecimals(const ObjectPtr& left, const ObjectPtr& right);
+
+} // namespace darix
@@ -0,0 +1,40 @@
+#pragma once
+
+#include <string>
+#include <vector>
+
+namespace darix {
+
+// API documentation extracted for `darix doc`. A declaration's doc is its
+// docstring (a string literal as the first statement of its body) or else
+// the // comment lines directly above it. Names starting with _ are private
+// and left out.
+struct DocEntry {
+    enum class Kind { Function, Class, Method };
+    Kind kind = Kind::Function;
+    std::string name;
+    std::string signature;  // e.g. "area(w, h)"; empty for classes
+    std::string doc;
+    int line = 0;
+    std::vector<DocEntry> members;  // a class's methods
+};
+
+struct DocModule {
+    std::string name;    // file stem or native module name
+    std::string source;  // file path, or "native" for built-in modules
+    std::string doc;     // docstring or comment block opening the file
+    std::vector<DocEntry> entries;
+};
+
+// Documents a script's top-level functions and classes. Returns false with
+// errors set if it does not parse.
+bool documentSource(const std::string& source, const std::string& filename, DocModule* out, std::vector<std::string>* errors);
+
+// Documents a registered native module from the docs it registered;
+// functions registered without one get the signature "module.name(...)".
+bool documentNativeModule(const std::string& name, DocModule* out);
+
+std::string renderMarkdown(const std::vector<DocModule>& modules);
+std::string renderHtml(const std::vector<DocModule>& modules);
+
+} // namespace darix
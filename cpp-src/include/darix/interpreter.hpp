@@ -1,22 +1,147 @@
 #pragma once
 
 #include "darix/ast.hpp"
+#include "darix/native/native.hpp"
 #include "darix/object.hpp"
+#include <atomic>
 #include <functional>
+#include <memory>
 #include <string>
+#include <thread>
 #include <unordered_map>
 #include <vector>
 
 namespace darix {
 
+// Execution tracing printed to stderr, chosen with --trace:
+//   Statements  each statement as it runs, with file:line
+//   Calls       each call into a script function, and its return
+// Interpreters pick up the mode when they are created.
+enum class TraceMode { Off, Statements, Calls };
+void setTraceMode(TraceMode mode);
+TraceMode traceMode();
+
+// The instruction budget interpreters start with and runSource gives the VM,
+// set by darix run --budget and a policy's max_instructions; 0 is none. See
+// Interpreter::setInstructionBudget.
+void setDefaultInstructionBudget(int n);
+int defaultInstructionBudget();
+
+// Events embedders can observe with Interpreter::setHook, for profilers,
+// watchdogs or audit layers:
+//   EnterCall  a script function, method or class is about to be called
+//   Line       a statement is about to run
+//   Exception  a statement raised an error or exception; reported once, where
+//              it was raised, not again at each frame it unwinds through
+enum class HookEvent { EnterCall, Line, Exception };
+
+struct HookInfo {
+    HookEvent event;
+    std::string file;
+    int line = 0;
+    std::string function;                          // EnterCall: the callee's name
+    const std::vector<ObjectPtr>* args = nullptr;  // EnterCall: its arguments
+    ObjectPtr error;                               // Exception: the error or exception signal
+};
+
+using Hook = std::function<void(const HookInfo&)>;
+
+// Runs a function a VM compiled (a COMPILED_FUNCTION value), which needs that
+// VM's constants and globals; see Interpreter::setCompiledCall.
+using CompiledCall = std::function<ObjectPtr(std::shared_ptr<CompiledFunction> fn, const std::vector<ObjectPtr>& args)>;
+
 class Interpreter {
 public:
     Interpreter();
+    // Closes the native handles (sockets, caches, ...) this interpreter's
+    // programs opened and left open; other interpreters' handles stay open.
+    ~Interpreter();
+
+    // A copy of this interpreter to run one more script in, for hosts that
+    // run many short scripts: warm one interpreter up (imports, helpers,
+    // data), keep it as the snapshot, and fork it per request instead of
+    // paying for the setup again. The fork gets its own copy of the globals,
+    // functions, instances, classes and loaded modules, so nothing it does
+    // reaches the snapshot or other forks; read-only data (see freeze) and
+    // hooks are shared. The copy is made up front, so forking takes time in
+    // proportion to the snapshot's mutable data; freezing large tables keeps
+    // it cheap. As with any two interpreters, only one may run at a time. Ending the fork closes only the handles the fork opened;
+    // files or sockets left open by the warm-up stay with the snapshot.
+    std::unique_ptr<Interpreter> fork() const;
 
     ObjectPtr interpret(Program* program);
+    // Runs program in a fresh scope nested in the global environment: it sees
+    // existing globals, builtins and loaded modules, but its own top-level
+    // definitions stay private to it.
+    ObjectPtr interpretInScope(Program* program);
+    // Reports static warnings for program (see lintProgram). Returns the
+    // Warning exception to raise when warnings are errors.
+    ObjectPtr check(Program* program);
+    // Calls a function, class or builtin from outside a program, as a call
+    // expression would. Errors come back as values, as from interpret.
+    ObjectPtr call(ObjectPtr fn, const std::vector<ObjectPtr>& args);
+    // Asks the running interpret() or call() to stop; safe to call from any
+    // thread. The next statement or loop iteration raises InterruptError,
+    // which scripts can catch to clean up. Each stop() interrupts once; a
+    // stop() while nothing runs interrupts the next run.
+    void stop() { stopRequested_.store(true, std::memory_order_relaxed); }
+    // Limits each interpret() or call() to n node evaluations, the
+    // interpreter's counterpart of VM::setInstructionBudget; 0 removes the
+    // limit. Running out raises RuntimeError "instruction budget exceeded",
+    // and every evaluation after it raises again, so catching it cannot keep
+    // the program going.
+    void setInstructionBudget(int n) { budget_ = n; }
+    // Installs the hook for event, replacing any earlier one; an empty hook
+    // removes it. Hooks run synchronously on the interpreter's thread.
+    void setHook(HookEvent event, Hook hook);
+    // Makes calls to compiled functions go to call, for hosts that let VM
+    // code and interpreted code share values, as the REPL does when lines
+    // switch backends. Without one such calls raise a TypeError.
+    void setCompiledCall(CompiledCall call) { compiledCall_ = std::move(call); }
     std::shared_ptr<Environment> getEnvironment() { return env_; }
+    // The builtin called name, for compiled bytecode to use as a value, or
+    // null. Builtins that call back into script functions cannot call
+    // compiled ones, and deprecated ones would skip their warning, so both are
+    // left out, as are native functions taking a function and those of
+    // modules the policy denies; *why, if given, then says which of these it
+    // was ("takes a function argument"). mod.fn names the function of a
+    // native module.
+    std::shared_ptr<Builtin> bytecodeBuiltin(const std::string& name, std::string* why = nullptr) const;
+    // Replaces the clock behind datetime.now()/timestamp(); see native::setClock.
+    void setClock(native::WallClock clock) { native::setClock(std::move(clock)); }
 
 private:
+    // initNative is false for forks, which find the native registry set up.
+    explicit Interpreter(bool initNative);
+    // An interpreter for a parallel_map worker thread: it shares this one's
+    // modules, hooks, budget and stop requests but has its own call stack,
+    // defer frames and counters, and leaves finalizers to this one.
+    std::unique_ptr<Interpreter> worker();
+    // Makes native modules call back into this interpreter, and makes the
+    // calling thread the one that runs finalizers; done whenever it starts
+    // running, so a snapshot works again after its forks.
+    void bindNative();
+    // Runs program and drains the event loop; C++ exceptions escaping the
+    // evaluator become InternalError signals instead of aborting.
+    ObjectPtr runProgram(Program* program, std::shared_ptr<Environment> env);
+    ObjectPtr internalError(const std::string& what);
+    std::vector<std::string> visibleNames(std::shared_ptr<Environment> env) const;
+    ObjectPtr wrappedInteger(bool overflowed, int64_t value, const std::string& op);
+    ObjectPtr truncatingDivision(int64_t left, int64_t right);
+    void traceStatement(Statement* stmt);
+    // Trace and Line hook work done before each statement.
+    void beforeStatement(Statement* stmt);
+    void reportRaised(Statement* stmt, const ObjectPtr& result);
+    // Calls the finalizers of instances destroyed since the last statement.
+    void runFinalizers();
+    // Clears a stop request and returns the InterruptError to raise.
+    ObjectPtr interrupted();
+    // The RuntimeError raised once the instruction budget is spent.
+    ObjectPtr budgetExceeded();
+    // The NameError strict mode raises for assigning to an undeclared name.
+    ObjectPtr undeclaredAssignment(Identifier* node, std::shared_ptr<Environment> env);
+    ObjectPtr tracedCall(ObjectPtr fn, const std::vector<ObjectPtr>& args);
+    ObjectPtr invokeFunction(ObjectPtr fn, const std::vector<ObjectPtr>& args);
     ObjectPtr eval(Node* node, std::shared_ptr<Environment> env);
 
     // Statement evaluation
@@ -26,13 +151,31 @@ private:
     ObjectPtr evalAssignStatement(AssignStatement* node, std::shared_ptr<Environment> env);
     ObjectPtr evalWhile(WhileStatement* node, std::shared_ptr<Environment> env);
     ObjectPtr evalFor(ForStatement* node, std::shared_ptr<Environment> env);
+    ObjectPtr evalForIn(ForInStatement* node, std::shared_ptr<Environment> env);
+    ObjectPtr evalLoopElse(BlockStatement* elseBlock, std::shared_ptr<Environment> env);
     ObjectPtr evalTryStatement(TryStatement* node, std::shared_ptr<Environment> env);
     ObjectPtr evalThrowStatement(ThrowStatement* node, std::shared_ptr<Environment> env);
+    ObjectPtr evalDeferStatement(DeferStatement* node, std::shared_ptr<Environment> env);
+    // Evaluates a function body in a new defer frame, then runs the frame.
+    ObjectPtr evalFunctionBody(BlockStatement* body, std::shared_ptr<Environment> env);
+    // Pops the innermost defer frame and runs its expressions last-in,
+    // first-out; one that fails replaces result, as a finally block would.
+    ObjectPtr runDeferred(ObjectPtr result);
     ObjectPtr evalClassDeclaration(ClassDeclaration* node, std::shared_ptr<Environment> env);
     ObjectPtr evalImportStatement(ImportStatement* node, std::shared_ptr<Environment> env);
+    // The Module for path, loaded on first use and cached after; modName is
+    // path without its go: or std: prefix.
+    ObjectPtr loadModule(ImportStatement* node, const std::string& path, const std::string& modName,
+                         std::shared_ptr<Environment> env);
+    // import "std:name": runs the embedded DariX source once, in a global
+    // scope of its own.
+    ObjectPtr importStdModule(const std::string& path, const std::string& name);
     ObjectPtr evalDelStatement(DelStatement* node, std::shared_ptr<Environment> env);
     ObjectPtr evalAssertStatement(AssertStatement* node, std::shared_ptr<Environment> env);
     ObjectPtr evalWithStatement(WithStatement* node, std::shared_ptr<Environment> env);
+    ObjectPtr evalMatchStatement(MatchStatement* node, std::shared_ptr<Environment> env);
+    // Whether value matches pattern, binding its captures in env as it goes.
+    bool matchPattern(Pattern* pattern, const ObjectPtr& value, std::shared_ptr<Environment> env);
     ObjectPtr evalGlobalStatement(GlobalStatement* node, std::shared_ptr<Environment> env);
     ObjectPtr evalNonlocalStatement(NonlocalStatement* node, std::shared_ptr<Environment> env);
     ObjectPtr evalMapLiteral(MapLiteral* node, std::shared_ptr<Environment> env);
@@ -54,6 +197,9 @@ private:
     // Function application
     ObjectPtr applyFunction(ObjectPtr fn, const std::vector<ObjectPtr>& args);
     ObjectPtr applyDecorators(const std::vector<ExpressionPtr>& decorators, ObjectPtr fn, std::shared_ptr<Environment> env);
+    // Calls method name (__len__, __iter__, __getitem__) with args when value
+    // is an instance whose class defines it; nullptr when it does not.
+    ObjectPtr callProtocol(const ObjectPtr& value, const std::string& name, const std::vector<ObjectPtr>& args = {});
 
     // Helpers
     void initBuiltins();
@@ -68,7 +214,48 @@ private:
     std::shared_ptr<Environment> env_;
     std::unordered_map<std::string, std::shared_ptr<Builtin>> builtins_;
     std::unordered_map<std::string, ObjectPtr> loadedModules_;
+    // Parsed std: modules, kept alive for the functions they define.
+    std::vector<std::shared_ptr<Program>> modulePrograms_;
     std::vector<StackFrame> callStack_;
+    // Most recent call being applied, reported as the location of internal errors.
+    CallExpression* lastCall_ = nullptr;
+    // Operator or builtin call being evaluated, for overflow warnings.
+    const Token* infixToken_ = nullptr;
+    TraceMode trace_ = TraceMode::Off;
+    int traceDepth_ = 0;
+    Hook hooks_[3];
+    CompiledCall compiledCall_;
+    // Set when beforeStatement has anything to do.
+    bool watchStatements_ = false;
+    // Last error reported to the Exception hook, so it is not reported again
+    // as it propagates.
+    std::weak_ptr<Object> lastRaised_;
+    std::atomic<bool> stopRequested_{false};
+    // The stop flag checked while running: stopRequested_, or for a
+    // parallel_map worker the flag of the interpreter that started it.
+    std::atomic<bool>* stop_ = &stopRequested_;
+    // Instruction budget per run, and what is left of it in the current one.
+    int budget_ = 0;
+    int64_t budgetLeft_ = 0;
+    // The thread running the program; parallel_map workers leave finalizers
+    // to it. runningFinalizers_ stops a finalizer's statements from starting
+    // the next ones.
+    std::thread::id owner_;
+    bool runningFinalizers_ = false;
+    // Whether the running program is strict (Program::strict).
+    bool strict_ = false;
+    // A pending `defer`: a call whose function and arguments were evaluated
+    // when the defer ran, or any other expression, evaluated on exit.
+    struct Deferred {
+        CallExpression* call = nullptr;
+        ObjectPtr fn;
+        std::vector<ObjectPtr> args;
+        Expression* expression = nullptr;
+        std::shared_ptr<Environment> env;
+    };
+    // One frame of pending defers per running function, plus one for the
+    // program itself.
+    std::vector<std::vector<Deferred>> deferred_;
     std::string currentFile_;
 };
 
@@ -0,0 +1,54 @@
+#pragma once
+
+#include "darix/ast.hpp"
+#include <string>
+#include <vector>
+
+namespace darix {
+
+// Language versions let breaking fixes ship behind an opt-in, with warnings
+// in the old mode and `darix fix` to migrate:
+//   v1  the original language
+//   v2  '/' on two integers is true division and returns a float
+// A file selects its version with a comment before its first statement,
+//   // darix: lang=v2
+// and files without one use the default, set with --lang.
+constexpr int MinLanguageVersion = 1;
+constexpr int LatestLanguageVersion = 2;
+
+// Reported under the "lang" warning category when v1 code divides two
+// integers, since v2 changes the result.
+extern const char* const IntegerDivisionWarning;
+
+int defaultLanguageVersion();
+void setDefaultLanguageVersion(int version);
+
+// Accepts "v2" or "2"; fails for versions this runtime does not know.
+bool parseLanguageVersion(const std::string& text, int* version, std::string* error);
+
+// The version named by the source's pragma, or the default.
+int sourceLanguageVersion(const std::string& source);
+
+// Lowers program, parsed from source of the given version, onto the v1
+// evaluator: under v2 every a / b becomes true_div(a, b). Run before the
+// optimizer so integer division is not folded with v1 semantics.
+void applyLanguageVersion(Program* program, int version);
+
+// Strict mode makes assigning to a name that no scope declares a NameError
+// instead of creating a global, so typos in assignments do not go unnoticed.
+// A file opts in with a "use strict" string as its first statement; --strict
+// makes it the default.
+bool defaultStrictMode();
+void setDefaultStrictMode(bool strict);
+
+// Whether program starts with the "use strict" pragma. Call before the
+// optimizer, which drops literal statements.
+bool hasStrictPragma(Program* program);
+
+// Migrates v1 source to v2: each a / b that does not involve a float literal
+// becomes trunc_div(a, b), which keeps v1's truncating division, and the
+// pragma is added. Comments and layout are preserved. Returns the new source,
+// or "" with errors set if it does not parse; changes counts the rewrites.
+std::string fixSource(const std::string& source, const std::string& filename, int* changes, std::vector<std::string>* errors);
+
+} // namespace darix
@@ -0,0 +1,43 @@
+#pragma once
+
+#include <iosfwd>
+#include <string>
+#include <vector>
+
+namespace darix {
+
+// `darix learn`: an interactive tutorial. Each lesson explains a feature and
+// sets a task; the learner's answer runs after the lesson's setup in a fresh
+// interpreter, then the lesson's check, a few assert statements, decides
+// whether it is solved.
+struct Lesson {
+    std::string id;
+    std::string title;
+    std::string text;   // the explanation and the task
+    std::string hint;
+    std::string setup;  // runs before the answer, e.g. to define inputs
+    std::string check;  // asserts run after the answer
+};
+
+const std::vector<Lesson>& lessons();
+
+// Runs lesson's setup, answer and check. On failure *message says what went
+// wrong: a parse error, the answer's error, or the failed assertion.
+bool checkAnswer(const Lesson& lesson, const std::string& answer, std::string* message);
+
+struct LearnOptions {
+    std::string progressPath;  // completed lesson ids, one per line
+    std::string start;         // lesson number or id; empty resumes
+    bool list = false;         // print the lessons and progress, then exit
+    bool reset = false;        // forget progress first
+    int timeoutMs = 2000;      // per answer
+};
+
+// ~/.darix_learn, or "" when there is no home directory.
+std::string defaultLearnProgress();
+
+// Runs the tutorial on in/out until the lessons are done, the learner quits
+// or input ends. Returns the exit code.
+int learn(std::istream& in, std::ostream& out, const LearnOptions& options);
+
+} // namespace darix
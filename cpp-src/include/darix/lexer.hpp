@@ -10,8 +10,13 @@ public:
     Lexer(const std::string& input, const std::string& file = "");
 
     Token nextToken();
+    // Advances to byte offset without producing tokens, keeping line and
+    // column tracking intact. Used to resume lexing in the middle of a file.
+    void seek(int offset);
+    const std::string& source() const { return input_; }
 
 private:
+    Token scanToken();
     void readChar();
     char peekChar() const;
     char peekCharAt(int offset) const;
@@ -1,9 +1,13 @@
 #pragma once
 
 #include "darix/object.hpp"
+#include <chrono>
+#include <fstream>
 #include <string>
 #include <unordered_map>
 #include <functional>
+#include <map>
+#include <set>
 
 namespace darix::native {
 
@@ -11,18 +15,53 @@ using NativeFunc = std::function<ObjectPtr(const std::vector<ObjectPtr>&)>;
 // Callback for evaluating a callable (Builtin or user-defined Function) with args
 using EvalCallback = std::function<ObjectPtr(ObjectPtr callable, const std::vector<ObjectPtr>& args)>;
 
+// Parameter list and one-line summary of a native function, for describe()
+// and `darix doc`. Optional parameters end in '?' and a trailing "..." accepts
+// any number of further arguments: "(s, width, char?)", "(a, b, ...)".
+struct FunctionDoc {
+    std::string signature;
+    std::string summary;
+};
+
+// Fewest and most arguments a FunctionDoc signature accepts; max is -1 when
+// the function is variadic.
+void signatureArity(const std::string& signature, int* min, int* max);
+
+// What an argument of a native function must be, for requireArgs.
+enum class Arg { Any, Integer, Number, Complex, String, Boolean, Array, Map, Callable };
+
+// Checks a native function's arguments, one type per parameter; the last
+// `optional` parameters may be left out. On a mismatch returns a TypeError
+// naming the function and the argument, e.g. "math.sqrt: argument 1 must be
+// a number, got STRING", otherwise nullptr. The interpreter and VM add the
+// position of the call to exceptions raised by builtins.
+ObjectPtr requireArgs(const std::string& name, const std::vector<ObjectPtr>& args, std::initializer_list<Arg> types,
+                      size_t optional = 0);
+// The same for variadic functions: at least min arguments, all of type.
+ObjectPtr requireVarArgs(const std::string& name, const std::vector<ObjectPtr>& args, size_t min, Arg type);
+// "name: message" as a TypeError or ValueError exception signal.
+ObjectPtr typeError(const std::string& name, const std::string& message);
+ObjectPtr valueError(const std::string& name, const std::string& message);
+
 struct NativeModule {
     std::string name;
     std::unordered_map<std::string, NativeFunc> functions;
+    std::string summary;
+    std::unordered_map<std::string, FunctionDoc> docs;
 };
 
 class Registry {
 public:
     static Registry& instance();
 
-    void registerModule(const std::string& name, const std::unordered_map<std::string, NativeFunc>& funcs);
+    void registerModule(const std::string& name, const std::unordered_map<std::string, NativeFunc>& funcs,
+                        const std::string& summary = "", const std::unordered_map<std::string, FunctionDoc>& docs = {});
     const NativeModule* get(const std::string& name) const;
+    // Registered module names, sorted.
+    std::vector<std::string> names() const;
 
+    // The callback is per thread: each parallel_map worker calls back into
+    // its own interpreter.
     void setEvalCallback(EvalCallback cb);
     EvalCallback getEvalCallback() const;
 
@@ -31,12 +70,246 @@ public:
 private:
     Registry() = default;
     std::unordered_map<std::string, NativeModule> modules_;
-    EvalCallback evalCallback_;
+};
+
+// Process limits set by a policy file; 0 leaves a limit unset. The sizes
+// are for setSizeLimits, the failure counts for setErrorBudget and the
+// instructions for setDefaultInstructionBudget.
+struct ResourceBudget {
+    int cpuSeconds = 0;
+    int memoryMb = 0;
+    int maxInstructions = 0;
+    int maxStringLen = 0;
+    int maxArrayLen = 0;
+    int maxMapEntries = 0;
+    int maxExceptions = 0;
+    int maxCallbackFailures = 0;
+};
+
+// Which native modules and functions scripts may use. Everything is allowed
+// until the first grant; after that only granted modules can be imported and
+// only granted functions called. A grant names a whole module ("json") or a
+// single function ("fs.read_file"); "fs.*" is the same as "fs".
+//
+// The policy can also limit arguments: the files native functions touch, the
+// hosts the net module reaches and the environment variables scripts see.
+// Each limit applies once it is set, even to an empty list.
+class CapabilityPolicy {
+public:
+    static CapabilityPolicy& instance();
+
+    // Adds a comma-separated list of grants. Names are checked against the
+    // registry; on an unknown module or function nothing is granted and
+    // *error says why.
+    bool allow(const std::string& grants, std::string* error);
+    // Adds what a policy file declares, JSON or, by its .toml extension,
+    // TOML; relative fs_roots are relative to the file. The file is checked
+    // whole first, so on an error nothing is added. Its budget is left in
+    // *budget for the caller to apply.
+    bool load(const std::string& path, ResourceBudget* budget, std::string* error);
+    void reset();
+
+    bool restricted() const { return restricted_; }
+    bool allowsModule(const std::string& module) const;
+    bool allows(const std::string& module, const std::string& function) const;
+    // Module -> granted functions; "*" grants the whole module.
+    const std::map<std::string, std::set<std::string>>& grants() const { return grants_; }
+
+    // A directory whose files native functions may use, with everything
+    // below it.
+    void allowRoot(const std::string& dir);
+    // A host name; "*.example.com" also allows its subdomains.
+    void allowHost(const std::string& host);
+    void allowEnv(const std::string& name);
+    // Denies a module even if a grant allows it.
+    void deny(const std::string& module);
+    // Denies the environment variables allowEnv has not allowed.
+    void denyEnv() { limitEnv_ = true; }
+    // Denies the console: output from print, pprint and the io module, or
+    // input read by the io module (see writeOutput and inputDenied).
+    void denyOutput() { denyOutput_ = true; }
+    void denyInput() { denyInput_ = true; }
+    bool allowsOutput() const { return !denyOutput_; }
+    bool allowsInput() const { return !denyInput_; }
+    bool allowsPath(const std::string& path) const;
+    bool allowsHost(const std::string& host) const;
+    bool allowsEnv(const std::string& name) const;
+    // Whether calls need checkArguments.
+    bool limitsArguments() const { return limitRoots_ || limitHosts_ || limitEnv_; }
+    // Why calling module.function with args is denied, or "". Each function
+    // that touches files or hosts lists which of its arguments name them;
+    // under fs_roots, the other functions of file modules that are not known
+    // to be path-free are denied.
+    std::string checkArguments(const std::string& module, const std::string& function,
+                               const std::vector<ObjectPtr>& args) const;
+    // result with what the policy hides removed: fs.glob matches outside
+    // fs_roots.
+    ObjectPtr filterResult(const std::string& module, const std::string& function, ObjectPtr result) const;
+
+private:
+    CapabilityPolicy() = default;
+    bool restricted_ = false;
+    std::map<std::string, std::set<std::string>> grants_;
+    std::set<std::string> denied_;
+    bool limitRoots_ = false, limitHosts_ = false, limitEnv_ = false;
+    bool denyOutput_ = false, denyInput_ = false;
+    std::vector<std::string> roots_; // canonical
+    std::set<std::string> hosts_;    // lowercase
+    std::set<std::string> env_;
+};
+
+// Optional JSON Lines log of native module imports and calls, for reviewing
+// what semi-trusted scripts did. Each record has the calling script position,
+// a summary of the arguments and the capability policy's decision.
+class AuditLog {
+public:
+    static AuditLog& instance();
+
+    bool open(const std::string& path, std::string* error);
+    bool enabled() const { return out_.is_open(); }
+
+    // Position of the call being evaluated; set by the interpreter.
+    void setCallSite(const std::string& file, int line, int column);
+    void recordImport(const std::string& module, bool allowed);
+    void recordCall(const std::string& module, const std::string& function,
+                    const std::vector<ObjectPtr>& args, bool allowed);
+
+private:
+    AuditLog() = default;
+    void write(const std::string& event, const std::string& fields, bool allowed);
+
+    std::ofstream out_;
+    std::string file_;
+    int line_ = 0;
+    int column_ = 0;
+};
+
+// Host endpoints scripts can call through the rpc module: a name, a JSON
+// request and a JSON response. Scripts reach only what the host registered,
+// which keeps internal automation off raw sockets. Embedders add C++
+// handlers; `darix run --rpc name=command` adds an external command that
+// reads the request on stdin and writes the response to stdout.
+class RpcEndpoints {
+public:
+    // Answers request (JSON text) with *response (JSON text, "" for null),
+    // or returns false with *error set. Handlers should give up once
+    // timeoutMs has passed; command endpoints are killed at the deadline.
+    using Handler = std::function<bool(const std::string& request, int timeoutMs, std::string* response, std::string* error)>;
+
+    static RpcEndpoints& instance();
+
+    void add(const std::string& name, Handler handler, int timeoutMs = DefaultTimeoutMs);
+    // Parses "name=command" (optionally "name@timeout_ms=command") and
+    // registers the command as an endpoint.
+    bool addCommand(const std::string& spec, std::string* error);
+    void clear();
+
+    // Registered endpoint names, sorted.
+    std::vector<std::string> names() const;
+    // Calls an endpoint; timeoutMs <= 0 uses the endpoint's default.
+    bool call(const std::string& name, const std::string& request, int timeoutMs, std::string* response,
+              std::string* error) const;
+
+    static constexpr int DefaultTimeoutMs = 30000;
+
+private:
+    RpcEndpoints() = default;
+    struct Endpoint {
+        Handler handler;
+        int timeoutMs;
+    };
+    std::map<std::string, Endpoint> endpoints_;
 };
 
 // Helper: call any callable (builtin or user-defined function)
 ObjectPtr callCallable(ObjectPtr callable, const std::vector<ObjectPtr>& args);
 
+// How long a script may keep recovering from failures before it is stopped,
+// so a broken handler cannot spin forever inside a host; 0 leaves a limit
+// unset. maxExceptions counts exceptions raised from a catch clause, a
+// rethrow or a new one; maxCallbackFailures counts callCallable calls in a
+// row that fail. Once a limit is spent the script gets an Error, which no
+// catch clause stops: in place of the failure that spent it, and from the
+// interpreter's next statement, since native functions such as array.map
+// keep what their callbacks return.
+struct ErrorBudget {
+    int maxExceptions = 0;
+    int maxCallbackFailures = 0;
+};
+void setErrorBudget(ErrorBudget budget);
+const ErrorBudget& errorBudget();
+// Counts an exception raised from a catch clause. Returns the Error to
+// raise instead once maxExceptions is spent, or nullptr.
+ObjectPtr countRethrown();
+namespace detail {
+extern std::atomic<bool> errorBudgetSpent;
+} // namespace detail
+inline bool errorBudgetSpent() { return detail::errorBudgetSpent.load(std::memory_order_relaxed); }
+// The Error that stopped the script once a limit was spent.
+ObjectPtr errorBudgetError();
+
+// The console as scripts see it. print, pprint and the io module write and
+// read through these, so the capability policy can deny them and an
+// embedder can capture what scripts print.
+using OutputSink = std::function<void(const std::string& text)>;
+// Sends script output to sink instead of stdout; an empty sink restores
+// stdout. Returns the sink it replaces.
+OutputSink setOutputSink(OutputSink sink);
+// Writes text for the builtin called name. Returns the PermissionError
+// when the policy denies output, otherwise nullptr.
+ObjectPtr writeOutput(const std::string& name, const std::string& text);
+// The PermissionError when the policy denies input to the builtin called
+// name, otherwise nullptr; reading functions check it before prompting.
+ObjectPtr inputDenied(const std::string& name);
+
+// Fires pending timer callbacks until none remain. Returns the first
+// error/exception raised by a callback, or nullptr.
+ObjectPtr runEventLoop();
+// Calls fn() every intervalMs milliseconds from the event loop, as
+// timer.set_interval does, and returns the timer id.
+int64_t scheduleInterval(ObjectPtr fn, int64_t intervalMs);
+// Removes a pending timer; false if there was none with this id.
+bool cancelTimer(int64_t id);
+
+// Wall-clock source for datetime.now()/timestamp() and uuid7(). Embedders and
+// tests can install a fixed or stepped clock to make time-dependent scripts
+// deterministic; an empty WallClock restores the system clock.
+using WallClock = std::function<std::chrono::system_clock::time_point()>;
+void setClock(WallClock clock);
+std::chrono::system_clock::time_point currentTime();
+
+// Reproducible runs (darix run --deterministic): random generators take their
+// seeds from one stream started at seed instead of from the OS, and modules
+// check deterministic() to drop other variation, such as directory order.
+// Set before the first interpreter, with a fixed clock (setClock).
+void setDeterministic(uint64_t seed);
+bool deterministic();
+// A seed for a new random generator.
+uint64_t randomSeed();
+
+// Creates a handle for a native resource and tracks it until it is closed, so
+// resources a script forgets about are still released by closeHandles() or
+// closeAllHandles(). It belongs to the calling thread's handle owner.
+std::shared_ptr<Handle> openHandle(const std::string& kind, int64_t id, std::function<void()> release);
+// Makes handles opened on the calling thread from now on belong to owner,
+// the interpreter running there.
+void setHandleOwner(const void* owner);
+// Resolves a handle argument of the given kind to its id. Plain integer ids
+// are still accepted for scripts written before handles existed. Returns
+// false for closed handles and handles of another kind.
+bool handleId(const ObjectPtr& obj, const std::string& kind, int64_t* id);
+// Closes a handle, or the tracked handle with an integer id. Returns false if
+// nothing open matched.
+bool closeHandle(const ObjectPtr& obj, const std::string& kind);
+// Closes the handles owner opened that are still open, newest first. Runs
+// when an interpreter is destroyed, leaving other interpreters' handles be.
+void closeHandles(const void* owner);
+// Closes every handle still open, newest first. Runs at process exit.
+void closeAllHandles();
+
+// s as a quoted JSON string, as the audit log writes it.
+std::string jsonString(const std::string& s);
+
 void initMathModule();
 void initStringModule();
 void initArrayModule();
@@ -57,5 +330,15 @@ void initRegexModule();
 void initIoModule();
 void initOsModule();
 void initEncodingModule();
+void initTimerModule();
+void initCacheModule();
+void initCsvModule();
+void initYamlModule();
+void initTomlModule();
+void initUrlModule();
+void initUuidModule();
+void initArchiveModule();
+void initRpcModule();
+void initI18nModule();
 
 } // namespace darix::native
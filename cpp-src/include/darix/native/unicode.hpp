@@ -0,0 +1,24 @@
+#pragma once
+
+#include <cstdint>
+#include <string>
+#include <vector>
+
+namespace darix::native {
+
+// Decodes the UTF-8 sequence at s[i] and advances i past it; a malformed
+// byte decodes as itself, so no input is lost.
+uint32_t nextCodepoint(const std::string& s, size_t& i);
+void appendCodepoint(std::string& out, uint32_t cp);
+
+// Canonical decomposition (NFD), or decomposition then composition (NFC).
+// The tables cover precomposed Latin, Greek, Cyrillic, Vietnamese and
+// Arabic letters and all Hangul syllables; other text passes through.
+std::string normalizeUnicode(const std::string& s, bool compose);
+
+// s split into user-perceived characters: a base with its combining marks,
+// emoji joined by ZWJ or followed by modifiers, flag pairs, Hangul
+// syllables written as jamo, and CR LF.
+std::vector<std::string> graphemes(const std::string& s);
+
+} // namespace darix::native
@@ -1,6 +1,7 @@
 #pragma once
 
 #include "darix/ast.hpp"
+#include <atomic>
 #include <cstdint>
 #include <functional>
 #include <memory>
@@ -38,6 +39,13 @@ enum class ObjectType {
     BREAK_SIGNAL,
     CONTINUE_SIGNAL,
     EXCEPTION_SIGNAL,
+    HANDLE,
+    INT_ARRAY,
+    FLOAT_ARRAY,
+    DECIMAL,
+    COMPLEX,
+    BUILDER,
+    WEAK_REF,
 };
 
 const char* ObjectTypeToString(ObjectType type);
@@ -66,21 +74,89 @@ struct Object {
     virtual void free() {}
 };
 
+// ============ Allocation statistics ============
+
+// Object kinds counted for --memstats and runtime_stats().
+enum class StatKind { Integer, Float, String, Array, Map, Instance, Count };
+
+struct KindStats {
+    int64_t allocated = 0;  // created since counting began
+    int64_t live = 0;       // not yet destroyed
+    int64_t peak = 0;       // most alive at once
+};
+
+// Counting is opt-in and must be enabled before a script runs: objects that
+// already exist are not tracked.
+void enableObjectStats();
+bool objectStatsEnabled();
+KindStats objectStats(StatKind kind);
+const char* statKindName(StatKind kind);
+// Peak resident set size of the process in bytes, or 0 where unsupported.
+int64_t peakResidentBytes();
+
+namespace detail {
+extern bool objectStatsOn;
+void countAlloc(StatKind kind);
+void countFree(StatKind kind);
+} // namespace detail
+
+// Empty base of the counted object types; costs a flag check when counting
+// is off and no space.
+template <StatKind K>
+struct Counted {
+    Counted() { if (detail::objectStatsOn) detail::countAlloc(K); }
+    Counted(const Counted&) : Counted() {}
+    Counted& operator=(const Counted&) = default;
+    ~Counted() { if (detail::objectStatsOn) detail::countFree(K); }
+};
+
 // ============ Concrete types ============
 
-struct Integer : Object {
+struct Integer : Object, Counted<StatKind::Integer> {
     int64_t value = 0;
     ObjectType type() const override { return ObjectType::INTEGER; }
     std::string inspect() const override;
     uint64_t hashKey() const;
 };
 
-struct Float : Object {
+struct Float : Object, Counted<StatKind::Float> {
     double value = 0.0;
     ObjectType type() const override { return ObjectType::FLOAT; }
     std::string inspect() const override;
 };
 
+// Fixed-point decimal, units / 10^scale; arithmetic is in decimal.hpp.
+struct Decimal : Object {
+    int64_t units = 0;
+    int scale = 0;
+    ObjectType type() const override { return ObjectType::DECIMAL; }
+    std::string inspect() const override;
+};
+
+// Complex number with float parts, made by math.complex().
+struct Complex : Object {
+    double real = 0.0;
+    double imag = 0.0;
+    ObjectType type() const override { return ObjectType::COMPLEX; }
+    std::string inspect() const override;
+};
+
+// Growable text from new_builder(); appending does not copy what is
+// already there, unlike repeated string concatenation.
+struct StringBuilder : Object {
+    std::string value;
+    ObjectType type() const override { return ObjectType::BUILDER; }
+    std::string inspect() const override;
+};
+
+// From weakref(obj): refers to obj without keeping it alive, so get() returns
+// null once nothing else holds it.
+struct WeakRef : Object {
+    std::weak_ptr<Object> target;
+    ObjectType type() const override { return ObjectType::WEAK_REF; }
+    std::string inspect() const override;
+};
+
 struct Boolean : Object {
     bool value = false;
     ObjectType type() const override { return ObjectType::BOOLEAN; }
@@ -92,19 +168,43 @@ struct Null : Object {
     std::string inspect() const override { return "null"; }
 };
 
-struct String : Object {
+struct String : Object, Counted<StatKind::String> {
     std::string value;
     ObjectType type() const override { return ObjectType::STRING; }
     std::string inspect() const override;
+    // Strings are never modified after creation, so the hash is computed on
+    // first use and cached. parallel_map workers share strings, so the cache
+    // is atomic; two threads hashing at once store the same value.
     uint64_t hashKey() const;
+    bool hasHash() const { return hashed_.load(std::memory_order_acquire); }
+
+private:
+    mutable std::atomic<uint64_t> hash_{0};
+    mutable std::atomic<bool> hashed_{false};
 };
 
-struct Array : Object {
+struct Array : Object, Counted<StatKind::Array> {
     std::vector<ObjectPtr> elements;
+    // Set by freeze: the array's path, for the error a mutation raises.
+    std::shared_ptr<const std::string> frozen;
     ObjectType type() const override { return ObjectType::ARRAY; }
     std::string inspect() const override;
 };
 
+// Contiguous numeric buffers: elements are stored unboxed, so bulk math
+// (sum, min, max, scale, dot) runs over plain vectors.
+struct IntArray : Object {
+    std::vector<int64_t> values;
+    ObjectType type() const override { return ObjectType::INT_ARRAY; }
+    std::string inspect() const override;
+};
+
+struct FloatArray : Object {
+    std::vector<double> values;
+    ObjectType type() const override { return ObjectType::FLOAT_ARRAY; }
+    std::string inspect() const override;
+};
+
 struct ReturnValue : Object {
     ObjectPtr value;
     ObjectType type() const override { return ObjectType::RETURN_VALUE; }
@@ -132,8 +232,10 @@ struct StackTrace : Object {
 struct Exception : Object {
     std::string exceptionType;
     std::string message;
+    std::string suggestion;
     std::shared_ptr<StackTrace> stackTrace;
     std::shared_ptr<Exception> cause;
+    ObjectPtr data; // a Map given by the thrower, or nullptr
     ObjectType type() const override { return ObjectType::EXCEPTION; }
     std::string inspect() const override;
 };
@@ -182,6 +284,7 @@ void returnPooledEnvironment(std::shared_ptr<Environment> env);
 // Function
 struct Function : Object {
     std::string name;
+    Token token; // the func or lambda keyword, for signature()
     std::vector<IdentifierPtr> parameters;
     std::shared_ptr<BlockStatement> body;
     std::shared_ptr<Environment> env;
@@ -195,6 +298,7 @@ struct CompiledFunction : Object {
     int numLocals = 0;
     int numParameters = 0;
     std::string name;
+    std::string source; // printed like the interpreter's Function when set
     ObjectType type() const override { return ObjectType::COMPILED_FUNCTION; }
     std::string inspect() const override;
 };
@@ -204,13 +308,26 @@ using BuiltinFunction = std::function<ObjectPtr(const std::vector<ObjectPtr>&)>;
 
 struct Builtin : Object {
     BuiltinFunction fn;
+    std::string name;       // global name, by which bytecode files refer to it; mod.fn for module functions
+    std::string deprecated; // if set, using the builtin warns with this advice
+    // Parameter list in native::FunctionDoc form, e.g. "(s, width, char?)",
+    // and the argument counts it allows (maxArgs -1: any number). Calls
+    // outside them fail before fn runs; an empty signature is not checked.
+    std::string signature;
+    int minArgs = 0;
+    int maxArgs = -1;
     ObjectType type() const override { return ObjectType::BUILTIN; }
     std::string inspect() const override { return "builtin function"; }
 };
 
+// The TypeError for calling b with argc arguments, or nullptr when its
+// signature allows them.
+ObjectPtr arityError(const Builtin& b, size_t argc);
+
 // Map
-struct Map : Object {
+struct Map : Object, Counted<StatKind::Map> {
     std::vector<std::pair<ObjectPtr, ObjectPtr>> pairs;
+    std::shared_ptr<const std::string> frozen; // as Array::frozen
     ObjectType type() const override { return ObjectType::MAP; }
     std::string inspect() const override;
 };
@@ -235,7 +352,7 @@ struct HashKeyHash {
     }
 };
 
-struct Hash : Object {
+struct Hash : Object, Counted<StatKind::Map> {
     std::unordered_map<HashKey, HashPair, HashKeyHash> pairs;
     ObjectType type() const override { return ObjectType::HASH; }
     std::string inspect() const override;
@@ -245,14 +362,34 @@ struct Hash : Object {
 struct Class : Object {
     std::string name;
     std::unordered_map<std::string, ObjectPtr> members;
+    // The members that are functions, resolved once so method calls skip the
+    // cast. Filled by setMember rather than on lookup, since worker threads
+    // may share a class; assign members through setMember to keep it current.
+    std::unordered_map<std::string, std::shared_ptr<Function>> methods;
+    void setMember(const std::string& key, ObjectPtr value);
+    // The method named key, or nullptr.
+    std::shared_ptr<Function> method(const std::string& key) const {
+        auto it = methods.find(key);
+        return it == methods.end() ? nullptr : it->second;
+    }
     ObjectType type() const override { return ObjectType::CLASS; }
     std::string inspect() const override;
 };
 
+// A call finalize() arranges: fn(args...).
+struct Finalizer {
+    ObjectPtr fn;
+    std::vector<ObjectPtr> args;
+};
+
 // Instance
-struct Instance : Object {
+struct Instance : Object, Counted<StatKind::Instance> {
     std::shared_ptr<Class> cls;
     std::unordered_map<std::string, ObjectPtr> fields;
+    // Calls from finalize(), queued by the destructor for the interpreter to
+    // make; see takeFinalizers.
+    std::vector<Finalizer> finalizers;
+    ~Instance() override;
     ObjectType type() const override { return ObjectType::INSTANCE; }
     std::string inspect() const override;
 };
@@ -273,6 +410,22 @@ struct Module : Object {
     std::string inspect() const override;
 };
 
+// Native resource (socket, cache, ...) handed to a script. release runs at
+// most once, from close(), a `with` block exiting or interpreter shutdown.
+struct Handle : Object {
+    std::string kind;
+    int64_t id = 0;
+    std::function<void()> release;
+    // Set for handles a for-in loop can read from, one step per call;
+    // returns nullptr once there are no more.
+    std::function<ObjectPtr()> next;
+    bool closed = false;
+    // Returns false if the handle was already closed.
+    bool close();
+    ObjectType type() const override { return ObjectType::HANDLE; }
+    std::string inspect() const override;
+};
+
 // ============ Singletons ============
 
 ObjectPtr getNull();
@@ -284,27 +437,154 @@ ObjectPtr newBoolean(bool value);
 
 ObjectPtr newInteger(int64_t value);
 ObjectPtr newFloat(double value);
+ObjectPtr newDecimal(int64_t units, int scale);
+ObjectPtr newComplex(double real, double imag);
 ObjectPtr newString(const std::string& value);
 ObjectPtr newArray(std::vector<ObjectPtr> elements);
+ObjectPtr newIntArray(std::vector<int64_t> values);
+ObjectPtr newFloatArray(std::vector<double> values);
 ObjectPtr newMap(std::vector<std::pair<ObjectPtr, ObjectPtr>> pairs);
 ObjectPtr newHash(std::unordered_map<HashKey, HashPair, HashKeyHash> pairs);
 ObjectPtr newError(const std::string& format, ...);
 ObjectPtr newException(const std::string& exType, const std::string& message);
 ObjectPtr newExceptionSignal(std::shared_ptr<Exception> ex);
+// Turns a C++ exception that escaped the runtime into an InternalError signal
+// instead of aborting, and logs it to stderr for a bug report.
+ObjectPtr newInternalError(const std::string& what, std::shared_ptr<StackTrace> trace);
+// What exit(code) raises: a ScriptExit that unwinds like any exception, so
+// finally blocks and defers run, and ends the run with code as its status.
+ObjectPtr newScriptExit(int64_t code);
+// Whether result is an uncaught ScriptExit; sets *code to its status.
+bool isScriptExit(const ObjectPtr& result, int* code = nullptr);
 ObjectPtr newClass(const std::string& name);
 ObjectPtr newInstance(std::shared_ptr<Class> cls);
 ObjectPtr newBoundMethod(std::shared_ptr<Instance> self, std::shared_ptr<Function> fn);
 
 // ============ Helpers ============
 
-bool equals(ObjectPtr a, ObjectPtr b);
+bool equals(const ObjectPtr& a, const ObjectPtr& b);
+// What `is` compares: the values of numbers, booleans and null, which have no
+// identity of their own, and the objects themselves for everything else.
+bool sameObject(const ObjectPtr& a, const ObjectPtr& b);
+bool hasIdentity(const ObjectPtr& value);
+
+namespace detail {
+extern std::atomic<bool> finalizersQueued;
+} // namespace detail
+
+// An instance can be destroyed anywhere, even inside a builtin, so its
+// finalizers wait in a queue until the interpreter reaches a statement
+// boundary and calls them.
+inline bool finalizersPending() { return detail::finalizersQueued.load(std::memory_order_relaxed); }
+std::vector<Finalizer> takeFinalizers();
 bool isTruthy(ObjectPtr obj);
+// What a for-in loop over value visits, taken up front so the loop body may
+// change the collection: array and buffer elements, a string's characters or
+// a map's keys (a module's names not starting with _), or with pairs, [index, element]
+// and [key, value] arrays. Null when value cannot be iterated; instances with
+// __iter__ are the interpreter's to resolve first.
+std::shared_ptr<Array> forInSteps(const ObjectPtr& value, bool pairs);
+// len(value) for the built-in collections, or -1 when value has no length.
+// Likewise, instances with __len__ are left to the interpreter.
+int64_t lengthOf(const ObjectPtr& value);
+// Both backends index sequences this way: a negative index counts back from
+// the end, so -1 is the last element. sequenceIndex stores the position in out,
+// or returns false when index falls outside length elements; indexError is
+// the IndexError signal to raise then, e.g. "array index 5 out of range for
+// length 3".
+bool sequenceIndex(int64_t index, size_t length, size_t& out);
+ObjectPtr indexError(const std::string& what, int64_t index, size_t length);
+// Makes value and every array and map inside it read-only, for host data
+// scripts must not change. name starts the paths errors give, as in
+// config["db"]["port"]; other values are immutable already.
+void freeze(const ObjectPtr& value, const std::string& name);
+// The TypeError signal for changing container at key, or the container as a
+// whole when key is null, if it is frozen; otherwise nullptr.
+ObjectPtr frozenError(const ObjectPtr& container, const ObjectPtr& key = nullptr);
+
+// Two's-complement int64 arithmetic: out receives the wrapped result and the
+// return value tells whether the exact result did not fit.
+bool wrappingAdd(int64_t a, int64_t b, int64_t& out);
+bool wrappingSub(int64_t a, int64_t b, int64_t& out);
+bool wrappingMul(int64_t a, int64_t b, int64_t& out);
+bool wrappingNeg(int64_t a, int64_t& out);
+// b must not be 0; INT64_MIN / -1 is the one quotient that does not fit.
+bool wrappingDiv(int64_t a, int64_t b, int64_t& out);
+// a % b for b != 0, including INT64_MIN % -1, which is 0 but traps in C++.
+int64_t integerRemainder(int64_t a, int64_t b);
+// Under checked arithmetic (darix run --checked-arith), integer +, -, *, /,
+// negation and abs raise OverflowError instead of wrapping around.
+void enableCheckedArithmetic();
+bool checkedArithmeticEnabled();
+// The OverflowError signal raised when integer op does not fit in int64.
+ObjectPtr overflowError(const std::string& op);
+
+// The largest strings (in bytes), arrays and maps scripts may build, set by
+// a policy file; 0 leaves a size unlimited. Checked where values grow, so a
+// script cannot exhaust the host's memory one append at a time.
+struct SizeLimits {
+    int64_t maxStringLen = 0;
+    int64_t maxArrayLen = 0;
+    int64_t maxMapEntries = 0;
+};
+void setSizeLimits(const SizeLimits& limits);
+const SizeLimits& sizeLimits();
+// The ResourceError signal for a string, array or map about to reach size
+// elements, or nullptr while size is within the limit.
+ObjectPtr stringSizeError(size_t size);
+ObjectPtr arraySizeError(size_t size);
+ObjectPtr mapSizeError(size_t size);
+// The ResourceError signal for value, a builtin's result, when it is a
+// string, array or map over its limit; nullptr otherwise. Both backends check
+// every builtin and native function result with it, so functions that build
+// strings or arrays (split, str, json.stringify) need no checks of their own.
+ObjectPtr resultSizeError(const ObjectPtr& value);
+
+// Canonical float text used everywhere a float is shown: the shortest digits
+// that read back as the same double, with ".0" kept on whole numbers so the
+// value stays recognisably a float ("3.0", "0.1", "1e+21", "nan", "-inf").
+std::string formatFloat(double value);
+
+// Source-like representation: strings are quoted and escaped, and containers
+// show their elements with repr as well.
+std::string repr(ObjectPtr obj);
+
+// Layout for pretty(): containers that don't fit in width columns are split
+// one element per line, indented by indent spaces per level. Containers nested
+// deeper than maxDepth (if non-negative) are shown as [...] or {...}. Map keys
+// are sorted, so output is stable across runs.
+struct PrettyOptions {
+    int indent = 2;
+    int maxDepth = -1;
+    int width = 80;
+};
+
+std::string pretty(const ObjectPtr& obj, const PrettyOptions& options = {});
+
+// The references reachable from root that lead back to a container or
+// instance holding them, each as "path -> path" with paths written from
+// rootName: `value[0].next -> value[0]`. Such cycles are never freed, since
+// values are reference counted. Follows array elements, map and hash values,
+// instance fields and a bound method's instance, but not closures: every
+// function refers back to the scope defining it.
+std::vector<std::string> findCycles(const ObjectPtr& root, const std::string& rootName);
+
+// "did you mean 'x'?" naming up to three candidates within a small edit
+// distance of name (closest first), or "" when nothing is close.
+std::string didYouMean(const std::string& name, const std::vector<std::string>& candidates);
 
 // ============ Pooled constructors ============
 
 ObjectPtr newIntegerFromPool(int64_t value);
 ObjectPtr newFloatFromPool(double value);
 ObjectPtr newStringFromPool(const std::string& value);
+// Returns the shared String for value, creating it on first use. Used for
+// string literals, so equal literal map keys are one object and compare by
+// pointer. Interned strings live for the whole process, so the table holds
+// at most 65536 strings of up to 256 bytes; other strings come back as new,
+// uninterned objects, which compare equal all the same. The table is locked,
+// since parallel_map workers evaluate literals at the same time.
+ObjectPtr internString(const std::string& value);
 ObjectPtr newArrayFromPool(std::vector<ObjectPtr> elements);
 
 // ============ Fast arithmetic ============
@@ -332,5 +612,19 @@ constexpr const char* RUNTIME_ERROR   = "RuntimeError";
 constexpr const char* SYNTAX_ERROR    = "SyntaxError";
 constexpr const char* ATTRIBUTE_ERROR = "AttributeError";
 constexpr const char* ASSERTION_ERROR = "AssertionError";
+constexpr const char* INTERNAL_ERROR  = "InternalError";
+constexpr const char* INTERRUPT_ERROR = "InterruptError";
+constexpr const char* OVERFLOW_ERROR  = "OverflowError";
+constexpr const char* RESOURCE_ERROR  = "ResourceError";
+constexpr const char* SCRIPT_EXIT     = "ScriptExit";
+
+// Groups a catch clause can name instead of a single type.
+constexpr const char* ANY_EXCEPTION    = "Exception";
+constexpr const char* ARITHMETIC_ERROR = "ArithmeticError";
+constexpr const char* LOOKUP_ERROR     = "LookupError";
+
+// Whether an exception of type exType is caught by `catch (name ...)`: name
+// is the type itself or a group containing it.
+bool exceptionMatches(const std::string& exType, const std::string& name);
 
 } // namespace darix
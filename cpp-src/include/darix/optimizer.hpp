@@ -0,0 +1,22 @@
+#pragma once
+
+#include "darix/ast.hpp"
+#include "darix/object.hpp"
+
+namespace darix {
+
+// Evaluates node if it is built only from literals and operators whose result
+// is known at compile time. Sets *ok and returns the value on success;
+// anything that would fail at runtime (such as division by zero) is left alone.
+ObjectPtr foldConstExpr(Node* node, bool* ok);
+
+// AST optimization pass run before either backend executes a program:
+//   - folds constant subtrees into literals ("a" + "b", 2 * 60, !true)
+//   - drops double negation (!!x) where only truthiness matters
+//   - replaces if/while statements with constant conditions by the branch taken
+//   - removes side-effect-free literal statements that are not a block's result
+// Arithmetic identities such as x + 0 are left alone: without knowing x they
+// could hide a TypeError ("a" + 0) or change a value (0 + -0.0 is 0.0).
+void optimizeProgram(Program* program);
+
+} // namespace darix
@@ -13,6 +13,7 @@ namespace darix {
 enum Precedence {
     LOWEST = 0,
     ASSIGN,
+    PIPELINE,
     EQUALS,
     LESSGREATER,
     SUM,
@@ -25,15 +26,37 @@ enum Precedence {
     MEMBER,
 };
 
+// A change to source text: bytes [start, oldEnd) of the previous text were
+// replaced by bytes [start, newEnd) of the new text.
+struct TextEdit {
+    int start = 0;
+    int oldEnd = 0;
+    int newEnd = 0;
+};
+
+struct ParseResult {
+    std::shared_ptr<Program> program;
+    std::vector<std::string> errors;
+    size_t reusedStatements = 0; // top-level statements carried over from the previous parse
+};
+
 class Parser {
 public:
     explicit Parser(Lexer& lexer);
 
     void setReplMode(bool mode);
     std::shared_ptr<Program> parseProgram();
+    // parseProgram one top-level statement at a time: parses the statement
+    // at the current token, null if there is none, and moves past it.
+    StatementPtr parseNextStatement();
+    bool atEnd() const { return curToken_.type == TokenType::EOF_TOKEN; }
+    // Byte offset and line of the current token.
+    int offset() const { return curToken_.offset; }
+    int line() const { return curToken_.line; }
     const std::vector<std::string>& errors() const;
 
 private:
+    StatementPtr parseStatementNode();
     using PrefixParseFn = std::function<ExpressionPtr()>;
     using InfixParseFn = std::function<ExpressionPtr(ExpressionPtr)>;
 
@@ -49,6 +72,7 @@ private:
     ExpressionPtr parseIdentifier();
     ExpressionPtr parseIntegerLiteral();
     ExpressionPtr parseFloatLiteral();
+    ExpressionPtr parseDecimalLiteral();
     ExpressionPtr parseStringLiteral();
     ExpressionPtr parseBoolean();
     ExpressionPtr parseNull();
@@ -71,6 +95,7 @@ private:
     ExpressionPtr parseAssignmentExpression(ExpressionPtr left);
     ExpressionPtr parseInExpression(ExpressionPtr left);
     ExpressionPtr parseIsExpression(ExpressionPtr left);
+    ExpressionPtr parsePipelineExpression(ExpressionPtr left);
 
     // Statement parse functions
     StatementPtr parseLetStatement();
@@ -81,11 +106,16 @@ private:
     StatementPtr parseAssignStatement();
     StatementPtr parseWhileStatement();
     StatementPtr parseForStatement();
+    StatementPtr parseForInStatement(const Token& token);
+    bool parseLoopElse(BlockStatementPtr& elseBlock);
     StatementPtr parseBreakStatement();
     StatementPtr parseContinueStatement();
     StatementPtr parseTryStatement();
     StatementPtr parseThrowStatement();
+    StatementPtr parseDeferStatement();
     StatementPtr parseImportStatement();
+    StatementPtr parseFromImportStatement();
+    std::shared_ptr<StringLiteral> parseImportPath(const std::string& keyword);
     StatementPtr parseFunctionDeclaration();
     StatementPtr parseDelStatement();
     StatementPtr parseAssertStatement();
@@ -93,6 +123,10 @@ private:
     StatementPtr parseGlobalStatement();
     StatementPtr parseNonlocalStatement();
     StatementPtr parseWithStatement();
+    // `match` is an ordinary name unless `match (...)` is followed by `{`.
+    bool atMatchStatement() const;
+    StatementPtr parseMatchStatement();
+    std::shared_ptr<Pattern> parsePattern();
     StatementPtr parseDecoratedDefinition();
 
     // Helpers
@@ -105,6 +139,10 @@ private:
     bool curTokenIs(TokenType t) const;
     bool peekTokenIs(TokenType t) const;
     bool expectPeek(TokenType t);
+    // Closes a comma-separated list of items (e.g. "array elements"),
+    // reporting both tokens that could come next.
+    bool expectListEnd(TokenType end, const std::string& items);
+    void skipToListEnd(TokenType end);
     bool expectCurrent(TokenType t);
     void consumeOptionalSemicolon();
     int curPrecedence() const;
@@ -112,6 +150,10 @@ private:
     bool isValidAssignmentTarget(const ExpressionPtr& expr) const;
 
     void addError(const std::string& msg);
+    // Reports msg at tok with the source line, a caret under the token and an
+    // optional one-line hint.
+    void addErrorAt(const Token& tok, const std::string& msg, const std::string& hint = "");
+    std::string hintFor(TokenType expected, const Token& got) const;
 
     Lexer& lexer_;
     Token curToken_;
@@ -122,4 +164,13 @@ private:
     bool isReplMode_ = false;
 };
 
+// Parses source, which is previousSource after edit, parsing only the region
+// the edit affects. previous must be the error-free parse of previousSource.
+// The top-level statements before the edit are reused as they are; those
+// after it are reused from the first one parsing the changed region arrives
+// at the start of, with their spans and token positions moved in place, so
+// previous no longer describes previousSource afterwards.
+ParseResult reparseProgram(const std::shared_ptr<Program>& previous, const std::string& previousSource,
+                           const std::string& source, const TextEdit& edit, const std::string& file = "");
+
 } // namespace darix
@@ -0,0 +1,68 @@
+#pragma once
+
+#include "darix/ast.hpp"
+#include "darix/object.hpp"
+#include <memory>
+#include <string>
+#include <vector>
+
+namespace darix {
+
+class Interpreter;
+
+// A problem found while running, in the form the CLI reports it. message is
+// the text printed by default; the other fields take it apart for
+// --format=json.
+struct Diagnostic {
+    enum class Stage { Load, Parse, Runtime, Warning };
+    Stage stage;
+    std::string message;
+    std::string file;
+    int line = 0, column = 0;  // 0 when not known
+    std::string code;          // error or exception type, or warning category
+    std::string summary;       // the message alone, without location or trace
+    std::string suggestion;
+};
+
+// A parse error from parseSource as a diagnostic; file is used when the
+// error does not name one.
+Diagnostic parseDiagnostic(const std::string& error, const std::string& file);
+// An Error or uncaught ExceptionSignal as a diagnostic, located where it was
+// raised when that is known.
+Diagnostic runtimeDiagnostic(const ObjectPtr& failure, const std::string& file);
+// d as one line of JSON with file, line, col, severity, code, message and
+// suggestion; unknown positions and suggestions are null.
+std::string diagnosticJson(const Diagnostic& d);
+
+// Outcome of the run pipeline used by `darix run` and `darix eval`. Nothing
+// is printed or exited: embedders and tests inspect the result instead.
+struct RunResult {
+    ObjectPtr value;                      // program result, or the error/exception signal
+    std::vector<Diagnostic> diagnostics;
+    int exitCode = 0;                     // 1 on failure, or the code given to exit()
+    bool ok() const { return exitCode == 0; }
+};
+
+// Parses and optimizes code; the program is only usable when errors is empty.
+std::pair<std::shared_ptr<Program>, std::vector<std::string>> parseSource(const std::string& code, const std::string& filename);
+
+// Runs source text (or bytecode file contents) on the VM, falling back to the
+// interpreter for programs the compiler does not support. Traced runs (see
+// TraceMode) use the interpreter only.
+RunResult runSource(const std::string& source, const std::string& filename);
+
+// Reads and runs one script; "-" reads stdin.
+RunResult runScript(const std::string& filename);
+
+// Runs several scripts in one interpreter so builtins and imported modules are
+// set up once. Preloads run in the global scope, making their definitions
+// visible to every script; each script then runs in its own nested scope.
+// Everything is parsed up front so a syntax error aborts before anything runs.
+RunResult runScripts(const std::vector<std::string>& preloads, const std::vector<std::string>& files);
+
+// Runs scripts one after another in interp's global scope, so what they define
+// is still there afterwards (`darix run -i`). Parsing is done up front as in
+// runScripts.
+RunResult runScriptsIn(Interpreter& interp, const std::vector<std::string>& files);
+
+} // namespace darix
@@ -0,0 +1,42 @@
+#pragma once
+
+#include <cstdint>
+#include <string>
+
+namespace darix {
+
+// `darix serve`: a JSON-RPC 2.0 endpoint over HTTP (POST a request or a batch
+// to any path) so other services can run DariX without embedding it. Only
+// application/json requests without an Origin header are answered, so web
+// pages cannot reach the server.
+// Methods, with by-name params:
+//   evaluate     {source, allow?, timeout_ms?, memory_mb?}
+//                -> {ok, value, output, stderr, errors, truncated}
+//   parse        {source} -> {ok, errors, ast}
+//   disassemble  {source} -> {instructions}
+// Each evaluation runs in a forked process with its own capability policy,
+// CPU/wall-clock deadline and address-space limit, so a runaway or crashing
+// script cannot take the server down. Requests are handled one at a time.
+struct ServeOptions {
+    std::string host = "127.0.0.1";
+    int port = 7070;
+    // Grants a request may use (see native::CapabilityPolicy); empty allows
+    // no native module. A request's own allow list can only narrow it.
+    std::string allow;
+    int timeoutMs = 5000;
+    int memoryMb = 256;
+    size_t maxOutput = 1 << 20;  // bytes of stdout and of stderr kept per request
+};
+
+// Parses "host:port", ":port" (all interfaces) or "port".
+bool parseListenAddress(const std::string& text, ServeOptions* options, std::string* error);
+
+// Answers one JSON-RPC request body; returns "" when nothing is owed (only
+// notifications).
+std::string handleRpc(const std::string& body, const ServeOptions& options);
+
+// Listens and serves until the process is killed. Returns non-zero if the
+// socket cannot be opened.
+int serve(const ServeOptions& options);
+
+} // namespace darix
@@ -0,0 +1,16 @@
+#pragma once
+
+#include <string>
+#include <vector>
+
+namespace darix {
+
+// The standard library written in DariX itself, imported with
+// `import "std:strings"`. The module's source, or nullptr if there is no
+// module of that name.
+const std::string* stdlibSource(const std::string& name);
+
+// The module names, sorted.
+std::vector<std::string> stdlibModules();
+
+} // namespace darix
@@ -13,6 +13,7 @@ enum class TokenType {
     IDENT,
     INT,
     FLOAT,
+    DECIMAL,
     STRING,
 
     // Operators
@@ -21,6 +22,8 @@ enum class TokenType {
     MINUS,
     BANG,
     OR,
+    PIPE,
+    PIPE_FORWARD,
     AND,
     ASTERISK,
     SLASH,
@@ -77,6 +80,7 @@ enum class TokenType {
     IN,
     IS,
     WITH,
+    DEFER,
     YIELD,
     GLOBAL,
     NONLOCAL,
@@ -92,6 +96,7 @@ struct Token {
     int line = 0;
     int column = 0;
     int offset = 0;
+    int endOffset = 0; // one past the token's last character
 };
 
 TokenType LookupIdent(const std::string& ident);
@@ -3,7 +3,9 @@
 #include "darix/code.hpp"
 #include "darix/compiler.hpp"
 #include "darix/object.hpp"
+#include <atomic>
 #include <cstdint>
+#include <functional>
 #include <string>
 #include <vector>
 
@@ -11,19 +13,57 @@ namespace darix {
 
 constexpr int StackSize = 2048;
 constexpr int InitialGlobs = 1024;
+// Nested compiled function calls allowed before the VM gives up; each one
+// recurses on the C++ stack.
+constexpr int MaxCallDepth = 4000;
 
 struct HotPath;
 
+// Checks bytecode before it runs: every opcode is known and complete, jumps
+// land on instruction boundaries, constant and local indices are in range, and
+// the stack never underflows or overflows and has the same depth wherever
+// control flow merges. Compiled function constants are checked too. VM::run
+// calls it, so corrupted or hand-written .daxc files fail with a message
+// instead of reading out of bounds.
+//
+// With balanced set, top-level code must also end with an empty stack, as
+// everything the compiler emits does: each statement pops what it pushes.
+// `darix verify` uses it to catch compiler bugs that leave values behind.
+bool verifyBytecode(const Bytecode& bc, std::string* error, bool balanced = false);
+
 class VM {
 public:
     explicit VM(std::shared_ptr<Bytecode> bc);
 
     ObjectPtr run();
+    // Calls fn, a function compiled against this VM's constants, as a call
+    // from bytecode would; for hosts that keep compiled functions after the
+    // run that made them.
+    ObjectPtr call(std::shared_ptr<CompiledFunction> fn, const std::vector<ObjectPtr>& args);
     void setInstructionBudget(int n);
+    // Calls hook after every `every` instructions with the number run so far,
+    // so embedders can sample or watch long runs; every <= 0 removes it.
+    void setInstructionHook(int every, std::function<void(uint64_t executed)> hook);
+    // Asks run() to stop from any thread; the next instruction raises
+    // InterruptError. Each stop() interrupts once.
+    void stop() { stopRequested_.store(true, std::memory_order_relaxed); }
     void enableJIT(bool enabled);
     void enableProfiling(bool enabled);
 
+    // Globals are exposed so a REPL session can carry them between runs.
+    void setGlobals(std::vector<ObjectPtr> globals);
+    const std::vector<ObjectPtr>& globals() const { return globals_; }
+    // Value of the last top-level expression statement, or null.
+    ObjectPtr lastPopped() const { return lastPopped_ ? lastPopped_ : getNull(); }
+
 private:
+    struct Frame;
+    struct Ops;
+
+    ObjectPtr execute();
+    // Runs f to its end or return through the opcode handler table; shared by
+    // the top-level program and compiled function calls.
+    ObjectPtr dispatch(Frame& f);
     ObjectPtr push(ObjectPtr obj);
     ObjectPtr pop();
     std::pair<ObjectPtr, ObjectPtr> popChecked();
@@ -36,8 +76,12 @@ private:
     ObjectPtr compareOp(Opcode op);
     ObjectPtr execCompare(Opcode op, ObjectPtr left, ObjectPtr right);
     ObjectPtr execMinus(ObjectPtr operand);
+    ObjectPtr wrappedInteger(bool overflowed, int64_t value, const char* op);
     ObjectPtr execIndex(ObjectPtr left, ObjectPtr index);
     ObjectPtr execSetIndex(ObjectPtr target, ObjectPtr index, ObjectPtr value);
+    ObjectPtr indexSignal(const std::string& what, int64_t index, size_t length);
+    // signal, a ResourceError from the size limits, with the VM's stack trace.
+    ObjectPtr traced(ObjectPtr signal);
     ObjectPtr execLen(ObjectPtr obj);
     ObjectPtr execType(ObjectPtr obj);
 
@@ -45,11 +89,21 @@ private:
     ObjectPtr opArray(int numElements);
     ObjectPtr opStringConcat(int n);
     ObjectPtr opSwap();
+    ObjectPtr opIterable(int count);
+    ObjectPtr opIterNext(int count, bool& done);
 
     ObjectPtr runCompiledFunction(std::shared_ptr<CompiledFunction> fn, const std::vector<ObjectPtr>& args);
 
     void setGlobal(int idx, ObjectPtr val);
+    // Null for a slot that was never assigned.
     ObjectPtr getGlobal(int idx);
+    // The slot's source name from the debug info, else "global #idx".
+    std::string globalName(int idx) const;
+
+    // Charges one instruction against the budget and the hook interval.
+    // Returns the exception to raise when the budget runs out or stop() was
+    // called, else null.
+    ObjectPtr countInstruction();
 
     ObjectPtr errorWithLoc(const std::string& msg);
     std::shared_ptr<StackTrace> buildStackTrace();
@@ -64,8 +118,17 @@ private:
     Instructions instructions_;
     std::string bcMagic_;
     std::string bcVersion_;
+    uint16_t bcFormat_ = BytecodeFormatVersion;
     DebugInfo debug_;
     int instrBudget_ = 0;
+    int hookEvery_ = 0;
+    int hookCountdown_ = 0;
+    uint64_t hookExecuted_ = 0;
+    std::function<void(uint64_t)> instructionHook_;
+    std::atomic<bool> stopRequested_{false};
+    ObjectPtr lastPopped_;
+    bool verified_ = false;
+    int callDepth_ = 0;
 
     // JIT
     std::shared_ptr<HotPath> jitGetCompiledPath(int ip);
@@ -0,0 +1,66 @@
+#pragma once
+
+#include "darix/ast.hpp"
+#include "darix/object.hpp"
+#include <atomic>
+#include <functional>
+#include <mutex>
+#include <set>
+#include <string>
+
+namespace darix {
+
+// How warnings are handled; chosen with -W on the command line.
+//   Default  print each warning once per source location
+//   Once     print each distinct message once, wherever it occurs
+//   Ignore   print nothing
+//   Error    raise the warning as a Warning exception instead
+enum class WarningAction { Default, Once, Ignore, Error };
+
+// Non-fatal diagnostics, printed to stderr as
+//   file:line:col: warning: message [category]
+// or, with --format=json, as diagnosticJson lines.
+class Warnings {
+public:
+    static Warnings& instance();
+
+    // Accepts "default", "once", "ignore" or "error".
+    bool setAction(const std::string& name, std::string* error);
+    WarningAction action() const { return action_; }
+    // Prints warnings as JSON lines (see diagnosticJson) instead of text.
+    void setJson(bool json) { json_ = json; }
+    void reset();
+
+    // Reports a warning. Returns the exception signal to raise when warnings
+    // are errors, otherwise nullptr.
+    ObjectPtr warn(const std::string& category, const std::string& message, const std::string& file, int line, int column);
+    // Warnings reported since the last reset, including ones raised as errors.
+    int reported() const { return reported_; }
+
+private:
+    WarningAction action_ = WarningAction::Default;
+    bool json_ = false;
+    std::atomic<int> reported_{0};
+    std::set<std::string> seen_;
+    // parallel_map workers may warn at the same time.
+    std::mutex lock_;
+};
+
+// The "duplicate-key" warning for a map literal that repeats key.
+std::string duplicateKeyWarning(const ObjectPtr& key);
+
+// Static checks run before a program executes: declarations that shadow a
+// builtin or a parameter of their function ("shadow"), that repeat a name
+// declared in the same scope ("redeclare"), map literals repeating a constant
+// key ("duplicate-key"), and variables declared in a function but never used
+// ("unused"; names starting with _ are exempt). Returns the first warning's
+// exception signal when warnings are errors, otherwise nullptr.
+ObjectPtr lintProgram(Program* program, const std::function<bool(const std::string&)>& isBuiltin);
+
+// Assignments to names the program never declares, with var, func, class or
+// import, as a parameter, or as a for-in, catch or with variable ("strict").
+// Strict mode raises NameError for them when they run. A function may assign
+// names declared anywhere in an enclosing function or at the top level.
+ObjectPtr lintUndeclaredAssignments(Program* program);
+
+} // namespace darix
@@ -0,0 +1,88 @@
+"""Runs the policy tests: scripts that need darix flags test_*.dax cannot set,
+or checks on how the run ends that a script cannot make itself.
+
+Each script starts with comment lines that say how to run it:
+
+    // policy: jail.json          policy file, relative to this directory
+    // args: --budget=1000        more darix run flags
+    // expect: outside fs_roots   the run must fail with this in its output
+    // audit: "allowed":false     run with --audit; the log must contain this
+    // once: started              the run must print this line exactly once
+
+Without "expect" the run must succeed and print no FAIL line. Scripts run
+with this directory as the working directory and an empty jail/ in it.
+
+    python3 run.py path/to/darix
+"""
+import os
+import shutil
+import subprocess
+import sys
+
+HERE = os.path.dirname(os.path.abspath(__file__))
+
+
+def header(path):
+    fields = {}
+    with open(path, encoding="utf-8") as f:
+        for line in f:
+            if not line.startswith("// ") or ":" not in line:
+                break
+            key, value = line[3:].split(":", 1)
+            fields[key.strip()] = value.strip()
+    return fields
+
+
+def run(darix, name):
+    fields = header(os.path.join(HERE, name))
+    cmd = [darix, "run"]
+    if "policy" in fields:
+        cmd.append("--policy=" + fields["policy"])
+    cmd += fields.get("args", "").split()
+    audit = os.path.join(HERE, "audit.jsonl")
+    if "audit" in fields:
+        cmd.append("--audit=" + audit)
+    cmd.append(name)
+    jail = os.path.join(HERE, "jail")
+    shutil.rmtree(jail, ignore_errors=True)
+    os.mkdir(jail)
+    log = ""
+    try:
+        proc = subprocess.run(cmd, cwd=HERE, capture_output=True, text=True, timeout=60)
+        if os.path.exists(audit):
+            with open(audit, encoding="utf-8") as f:
+                log = f.read()
+    finally:
+        shutil.rmtree(jail, ignore_errors=True)
+        if os.path.exists(audit):
+            os.remove(audit)
+    out = proc.stdout + proc.stderr
+    if "once" in fields and proc.stdout.splitlines().count(fields["once"]) != 1:
+        return "expected the line %r exactly once, got:\n%s" % (fields["once"], proc.stdout)
+    if "audit" in fields and fields["audit"] not in log:
+        return "expected the audit log to contain %r, got:\n%s" % (fields["audit"], log)
+    expect = fields.get("expect")
+    if expect is not None:
+        if proc.returncode == 0 or expect not in out:
+            return "expected a failure mentioning %r, got exit %d:\n%s" % (expect, proc.returncode, out)
+    elif proc.returncode != 0 or "FAIL" in out:
+        return "exit %d:\n%s" % (proc.returncode, out)
+    return None
+
+
+def main():
+    darix = os.path.abspath(sys.argv[1])
+    failed = 0
+    for name in sorted(os.listdir(HERE)):
+        if not name.endswith(".dax"):
+            continue
+        problem = run(darix, name)
+        print("%s %s" % ("FAIL" if problem else "ok  ", name))
+        if problem:
+            print(problem)
+            failed += 1
+    sys.exit(1 if failed else 0)
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,73 @@
+"""Tests the REPL: pipes each case's lines through `darix repl` and compares
+the results it prints, one per line that has one, with the expected ones.
+
+    python3 run.py path/to/darix
+"""
+import subprocess
+import sys
+
+# name, repl flags, input lines, expected results in order
+CASES = [
+    ("vm: a function runs on a later line", ["--backend=vm"],
+     ["func f(a) { return a * 2 }", "f(3)"],
+     ["6"]),
+    ("vm: a later line's constants do not shift a function's", ["--backend=vm"],
+     ["var x = 5", "func f(a) { return a * 2 }", "var y = 2.5", "f(x)", "f(y)"],
+     ["10", "5.0"]),
+    ("vm: string constants in functions", ["--backend=vm"],
+     ['func greet(name) { return "hi " + name + "!" }', 'var who = "there"', "greet(who)", 'greet("you")'],
+     ['"hi there!"', '"hi you!"']),
+    ("vm: functions calling functions from other lines", ["--backend=vm"],
+     ["func sq(n) { return n * n }", "func sum_sq(a, b) { return sq(a) + sq(b) }", "sum_sq(3, 4)"],
+     ["25"]),
+    ("interp: functions VM lines defined stay callable", ["--backend=vm"],
+     ["var total = 0", "func g(x) { total = total + x; return x * 2 }", ":backend interp", "g(1)", "g(2)", "total",
+      ":backend vm", "g(10)", "total"],
+     ["Backend: interp", "2", "4", "3", "Backend: vm", "20", "13"]),
+    ("vm: defer is refused and runs on the interpreter", ["--backend=vm"],
+     ['func f() { defer print("bye"); return 1 }', ":backend interp", 'func f() { defer print("bye"); return 1 }',
+      "f()"],
+     ["RuntimeError: cannot compile to bytecode: defer is not supported in bytecode", "Backend: interp", "bye", "1"]),
+    ("vm: builtins left out of bytecode say why", ["--backend=vm"],
+     ["import array; array.filter([1, 2], func(x) { return x > 1 })", "var f = parallel_map"],
+     ["RuntimeError: cannot compile to bytecode: array.filter takes a function argument",
+      "RuntimeError: cannot compile to bytecode: parallel_map takes a function argument"]),
+    ("vm: --checked-arith covers negation, abs and division", ["--backend=vm", "--checked-arith"],
+     ["var imin = -9223372036854775807 - 1", "-imin", "abs(imin)", "imin / -1", "imin % -1"],
+     ["OverflowError: integer overflow in '-'", "Stack trace:", "  at <module> (<repl>:1:1)",
+      "OverflowError: integer overflow in 'abs'", "Stack trace:", "  at <module> (<repl>:1:4)",
+      "OverflowError: integer overflow in '/'", "Stack trace:", "  at <module> (<repl>:1:6)",
+      "0"]),
+    ("interp: --checked-arith covers negation, abs and division", ["--backend=interp", "--checked-arith"],
+     ["var imin = -9223372036854775807 - 1", "-imin", "abs(imin)", "imin / -1", "imin % -1"],
+     ["OverflowError: integer overflow in '-'", "Stack trace:", "  at <module> (<repl>:1:1)",
+      "OverflowError: integer overflow in 'abs'", "Stack trace:", "  at abs (<repl>:1:4)",
+      "OverflowError: integer overflow in '/'", "Stack trace:", "  at <module> (<repl>:1:1)",
+      "0"]),
+]
+
+
+def results(output):
+    # Drop the banner, then the prompts; what is left are the printed results.
+    lines = output.splitlines()[2:]
+    text = "\n".join(lines).replace(">> ", "\n").replace(".. ", "\n")
+    return [line for line in text.splitlines() if line.strip()]
+
+
+def main():
+    darix = sys.argv[1]
+    failed = 0
+    for name, flags, lines, expected in CASES:
+        proc = subprocess.run([darix, "repl", "--no-rc"] + flags, input="\n".join(lines) + "\n",
+                              capture_output=True, text=True, timeout=60)
+        got = results(proc.stdout)
+        ok = proc.returncode == 0 and got == expected
+        print("%s %s" % ("ok  " if ok else "FAIL", name))
+        if not ok:
+            print("exit %d, expected %r, got %r\n%s" % (proc.returncode, expected, got, proc.stderr))
+            failed += 1
+    sys.exit(1 if failed else 0)
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,136 @@
+"""Tests `darix serve`: starts servers on free local ports and checks what
+they answer. Not run on Windows, where serve is not available.
+
+    python3 run.py path/to/darix
+"""
+import http.client
+import json
+import os
+import socket
+import subprocess
+import sys
+import time
+
+failures = []
+
+
+def check(name, ok, detail=""):
+    print("%s %s" % ("ok  " if ok else "FAIL", name))
+    if not ok:
+        if detail:
+            print(detail)
+        failures.append(name)
+
+
+def free_port():
+    with socket.socket() as s:
+        s.bind(("127.0.0.1", 0))
+        return s.getsockname()[1]
+
+
+class Server:
+    def __init__(self, darix, *flags):
+        self.port = free_port()
+        self.proc = subprocess.Popen([darix, "serve", "--listen", "127.0.0.1:%d" % self.port] + list(flags),
+                                     stdout=subprocess.DEVNULL, stderr=subprocess.DEVNULL)
+        for _ in range(100):
+            try:
+                socket.create_connection(("127.0.0.1", self.port), timeout=1).close()
+                return
+            except OSError:
+                time.sleep(0.05)
+        raise RuntimeError("darix serve did not start")
+
+    def post(self, body, headers=None):
+        conn = http.client.HTTPConnection("127.0.0.1", self.port, timeout=30)
+        conn.request("POST", "/", body, {"Content-Type": "application/json"} if headers is None else headers)
+        response = conn.getresponse()
+        text = response.read().decode()
+        conn.close()
+        return response.status, text
+
+    # The result or error member of an evaluate call.
+    def evaluate(self, source, **params):
+        params["source"] = source
+        request = {"jsonrpc": "2.0", "id": 1, "method": "evaluate", "params": params}
+        status, text = self.post(json.dumps(request))
+        response = json.loads(text)
+        return response.get("result"), response.get("error")
+
+    def stop(self):
+        self.proc.kill()
+        self.proc.wait()
+
+
+def test_http(server):
+    request = json.dumps({"jsonrpc": "2.0", "id": 1, "method": "evaluate", "params": {"source": "6 * 7"}})
+    status, _ = server.post(request, {"Content-Type": "text/plain"})
+    check("http: other content types are refused", status == 415, "status %d" % status)
+    status, _ = server.post(request, {})
+    check("http: a missing content type is refused", status == 415, "status %d" % status)
+    status, _ = server.post(request, {"Content-Type": "application/json", "Origin": "http://example.com"})
+    check("http: requests from web pages are refused", status == 403, "status %d" % status)
+    status, _ = server.post(request, {"Content-Type": "application/json; charset=utf-8"})
+    check("http: a charset is accepted", status == 200, "status %d" % status)
+
+
+def test_default_policy(server):
+    result, error = server.evaluate("6 * 7")
+    check("default: the core language runs", result and result["value"] == "42", str(result or error))
+    result, error = server.evaluate('import os\nos.exec("id")')
+    check("default: os is denied", result and not result["ok"] and "not allowed" in result["errors"][0],
+          str(result or error))
+    result, error = server.evaluate('import fs\nfs.write("serve_test.txt", "x")')
+    check("default: fs is denied", result and not result["ok"] and not os.path.exists("serve_test.txt"),
+          str(result or error))
+    result, error = server.evaluate("6 * 7", allow="math")
+    check("default: requests cannot add grants", error and "not allowed by the server" in error["message"],
+          str(result or error))
+
+
+def test_grants(server):
+    result, error = server.evaluate('import json\njson.stringify([1])')
+    check("grants: the server's grants apply", result and result["value"] == '"[1]"', str(result or error))
+    result, error = server.evaluate('import json\njson.stringify([1])', allow="math")
+    check("grants: a request narrows them", result and not result["ok"] and "not allowed" in result["errors"][0],
+          str(result or error))
+    result, error = server.evaluate('import math\nmath.sqrt(16)', allow=["math"])
+    check("grants: a narrowed grant still works", result and result["value"] == "4.0", str(result or error))
+    result, error = server.evaluate("1", allow="os")
+    check("grants: a request cannot widen them", error and "grant 'os' is not allowed" in error["message"],
+          str(result or error))
+
+
+def test_limits(server):
+    result, error = server.evaluate("while (true) { }", timeout_ms=300)
+    check("limits: a runaway script times out", error and "timed out after 300 ms" in error["message"],
+          str(result or error))
+    result, error = server.evaluate("var a = []\nwhile (true) { append(a, [1, 2, 3, 4, 5, 6, 7, 8]) }", memory_mb=32)
+    check("limits: the memory limit stops a script", error and "memory limit 32 MB" in error["message"],
+          str(result or error))
+    result, error = server.evaluate("1", timeout_ms=0)
+    check("limits: limits must be positive", error and "positive integer" in error["message"], str(result or error))
+    result, error = server.evaluate("6 * 7")
+    check("limits: the server survives", result and result["value"] == "42", str(result or error))
+
+
+def main():
+    darix = os.path.abspath(sys.argv[1])
+    os.chdir(os.path.dirname(os.path.abspath(__file__)))
+    server = Server(darix)
+    try:
+        test_http(server)
+        test_default_policy(server)
+        test_limits(server)
+    finally:
+        server.stop()
+    server = Server(darix, "--allow", "json,math")
+    try:
+        test_grants(server)
+    finally:
+        server.stop()
+    sys.exit(1 if failures else 0)
+
+
+if __name__ == "__main__":
+    main()
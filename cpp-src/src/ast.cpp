@@ -29,6 +29,12 @@ std::string blockString(const BlockStatementPtr& block) {
     return block->inspect();
 }
 
+// " else {...}" for a loop's else clause, or nothing.
+static std::string elseString(const BlockStatementPtr& block) {
+    if (!block) return "";
+    return " else " + block->inspect();
+}
+
 static std::vector<std::string> identifierStrings(const std::vector<IdentifierPtr>& idents) {
     std::vector<std::string> result;
     for (const auto& id : idents) {
@@ -71,8 +77,14 @@ std::string Program::inspect() const {
 
 std::string ImportStatement::tokenLiteral() const { return token.literal; }
 std::string ImportStatement::inspect() const {
+    if (!names.empty()) {
+        std::string out = "from " + expressionString(path) + " import ";
+        for (size_t i = 0; i < names.size(); i++) out += (i ? ", " : "") + identifierString(names[i]);
+        return out + ";";
+    }
     std::string out = "import";
     if (path) out += " " + expressionString(path);
+    if (alias) out += " as " + identifierString(alias);
     out += ";";
     return out;
 }
@@ -133,7 +145,7 @@ std::string ContinueStatement::inspect() const { return "continue;"; }
 
 std::string WhileStatement::tokenLiteral() const { return token.literal; }
 std::string WhileStatement::inspect() const {
-    return "while(" + expressionString(condition) + ") " + blockString(body);
+    return "while(" + expressionString(condition) + ") " + blockString(body) + elseString(elseBlock);
 }
 
 // ============ ForStatement ============
@@ -143,7 +155,15 @@ std::string ForStatement::inspect() const {
     std::string i = init ? init->inspect() : "";
     std::string c = condition ? condition->inspect() : "";
     std::string p = post ? post->inspect() : "";
-    return "for(" + i + "; " + c + "; " + p + ") " + blockString(body);
+    return "for(" + i + "; " + c + "; " + p + ") " + blockString(body) + elseString(elseBlock);
+}
+
+// ============ ForInStatement ============
+
+std::string ForInStatement::tokenLiteral() const { return token.literal; }
+std::string ForInStatement::inspect() const {
+    std::string vars = key ? key->inspect() + ", " + value->inspect() : value->inspect();
+    return "for(" + vars + " in " + expressionString(iterable) + ") " + blockString(body) + elseString(elseBlock);
 }
 
 // ============ FunctionDeclaration ============
@@ -181,12 +201,20 @@ std::string ThrowStatement::inspect() const {
     return tokenLiteral() + " " + expressionString(exception) + ";";
 }
 
+// ============ DeferStatement ============
+
+std::string DeferStatement::tokenLiteral() const { return token.literal; }
+std::string DeferStatement::inspect() const {
+    return tokenLiteral() + " " + expressionString(expression) + ";";
+}
+
 // ============ CatchClause ============
 
 std::string CatchClause::inspect() const {
     std::string out = "catch";
-    if (exceptionType) {
-        out += " (" + exceptionType->inspect();
+    if (!exceptionTypes.empty()) {
+        out += " (";
+        for (size_t i = 0; i < exceptionTypes.size(); i++) out += (i ? " | " : "") + exceptionTypes[i]->inspect();
         if (auto name = identifierString(variable); !name.empty()) {
             out += " " + name;
         }
@@ -258,6 +286,47 @@ std::string WithStatement::inspect() const {
     return out;
 }
 
+// ============ MatchStatement ============
+
+std::string Pattern::inspect() const {
+    switch (kind) {
+        case Kind::Literal: return expressionString(value);
+        case Kind::Capture: return identifierString(name);
+        case Kind::Array: {
+            std::vector<std::string> parts;
+            for (const auto& e : elements) parts.push_back(e->inspect());
+            if (rest) parts.push_back("*" + rest->inspect());
+            return "[" + joinStrings(parts, ", ") + "]";
+        }
+        case Kind::Map: {
+            std::vector<std::string> parts;
+            for (const auto& [k, p] : entries) parts.push_back(expressionString(k) + ":" + p->inspect());
+            return "{" + joinStrings(parts, ", ") + "}";
+        }
+    }
+    return "";
+}
+
+void Pattern::captures(std::vector<Identifier*>& out) const {
+    if (name && name->value != "_") out.push_back(name.get());
+    for (const auto& e : elements) e->captures(out);
+    if (rest && rest->value != "_") out.push_back(rest.get());
+    for (const auto& [k, p] : entries) p->captures(out);
+}
+
+std::string MatchCase::inspect() const {
+    std::string out = "case " + (pattern ? pattern->inspect() : std::string());
+    if (guard) out += " if " + guard->inspect();
+    return out + " " + blockString(body);
+}
+
+std::string MatchStatement::tokenLiteral() const { return token.literal; }
+std::string MatchStatement::inspect() const {
+    std::string out = "match (" + expressionString(subject) + ") {";
+    for (const auto& c : cases) out += " " + c->inspect();
+    return out + " }";
+}
+
 // ============ Identifier ============
 
 std::string Identifier::tokenLiteral() const { return token.literal; }
@@ -273,6 +342,11 @@ std::string IntegerLiteral::inspect() const { return token.literal; }
 std::string FloatLiteral::tokenLiteral() const { return token.literal; }
 std::string FloatLiteral::inspect() const { return token.literal; }
 
+// ============ DecimalLiteral ============
+
+std::string DecimalLiteral::tokenLiteral() const { return token.literal; }
+std::string DecimalLiteral::inspect() const { return token.literal + "d"; }
+
 // ============ StringLiteral ============
 
 std::string StringLiteral::tokenLiteral() const { return token.literal; }
@@ -0,0 +1,274 @@
+#include "darix/ast_walk.hpp"
+
+namespace darix::walk {
+
+// ============ Traversal ============
+
+template <typename T>
+static void visit(const std::shared_ptr<T>& child, const std::function<void(Node*)>& fn) {
+    if (child) fn(child.get());
+}
+
+template <typename T>
+static void visitAll(const std::vector<std::shared_ptr<T>>& list, const std::function<void(Node*)>& fn) {
+    for (const auto& child : list) visit(child, fn);
+}
+
+static void visitPattern(const std::shared_ptr<Pattern>& pattern, const std::function<void(Node*)>& fn) {
+    if (!pattern) return;
+    visit(pattern->value, fn); visit(pattern->name, fn);
+    for (const auto& e : pattern->elements) visitPattern(e, fn);
+    visit(pattern->rest, fn);
+    for (const auto& [key, p] : pattern->entries) { visit(key, fn); visitPattern(p, fn); }
+}
+
+void children(Node* node, const std::function<void(Node*)>& fn) {
+    if (!node) return;
+
+    if (auto n = dynamic_cast<Program*>(node)) { visitAll(n->statements, fn); return; }
+    if (auto n = dynamic_cast<BlockStatement*>(node)) { visitAll(n->statements, fn); return; }
+    if (auto n = dynamic_cast<StandaloneBlockStatement*>(node)) { visit(n->block, fn); return; }
+    if (auto n = dynamic_cast<ImportStatement*>(node)) {
+        visit(n->path, fn); visit(n->alias, fn); visitAll(n->names, fn);
+        return;
+    }
+    if (auto n = dynamic_cast<LetStatement*>(node)) { visit(n->name, fn); visit(n->value, fn); return; }
+    if (auto n = dynamic_cast<AssignStatement*>(node)) { visit(n->target, fn); visit(n->value, fn); return; }
+    if (auto n = dynamic_cast<ReturnStatement*>(node)) { visit(n->returnValue, fn); return; }
+    if (auto n = dynamic_cast<ExpressionStatement*>(node)) { visit(n->expression, fn); return; }
+    if (auto n = dynamic_cast<WhileStatement*>(node)) {
+        visit(n->condition, fn); visit(n->body, fn); visit(n->elseBlock, fn);
+        return;
+    }
+    if (auto n = dynamic_cast<ForStatement*>(node)) {
+        visit(n->init, fn); visit(n->condition, fn); visit(n->post, fn); visit(n->body, fn); visit(n->elseBlock, fn);
+        return;
+    }
+    if (auto n = dynamic_cast<ForInStatement*>(node)) {
+        visit(n->key, fn); visit(n->value, fn); visit(n->iterable, fn); visit(n->body, fn); visit(n->elseBlock, fn);
+        return;
+    }
+    if (auto n = dynamic_cast<FunctionDeclaration*>(node)) {
+        visitAll(n->decorators, fn); visit(n->name, fn); visitAll(n->parameters, fn); visit(n->body, fn);
+        return;
+    }
+    if (auto n = dynamic_cast<ClassDeclaration*>(node)) {
+        visitAll(n->decorators, fn); visit(n->name, fn); visit(n->body, fn);
+        return;
+    }
+    if (auto n = dynamic_cast<ThrowStatement*>(node)) { visit(n->exception, fn); return; }
+    if (auto n = dynamic_cast<DeferStatement*>(node)) { visit(n->expression, fn); return; }
+    if (auto n = dynamic_cast<TryStatement*>(node)) {
+        visit(n->tryBlock, fn);
+        for (const auto& clause : n->catchClauses) {
+            if (!clause) continue;
+            for (auto& t : clause->exceptionTypes) visit(t, fn);
+            visit(clause->variable, fn); visit(clause->catchBlock, fn);
+        }
+        visit(n->finallyBlock, fn);
+        return;
+    }
+    if (auto n = dynamic_cast<DelStatement*>(node)) { visit(n->target, fn); return; }
+    if (auto n = dynamic_cast<AssertStatement*>(node)) { visit(n->condition, fn); visit(n->message, fn); return; }
+    if (auto n = dynamic_cast<GlobalStatement*>(node)) { visitAll(n->names, fn); return; }
+    if (auto n = dynamic_cast<NonlocalStatement*>(node)) { visitAll(n->names, fn); return; }
+    if (auto n = dynamic_cast<WithStatement*>(node)) {
+        visit(n->context, fn); visit(n->variable, fn); visit(n->body, fn);
+        return;
+    }
+    if (auto n = dynamic_cast<MatchStatement*>(node)) {
+        visit(n->subject, fn);
+        for (const auto& c : n->cases) {
+            visitPattern(c->pattern, fn); visit(c->guard, fn); visit(c->body, fn);
+        }
+        return;
+    }
+
+    if (auto n = dynamic_cast<AssignExpression*>(node)) { visit(n->name, fn); visit(n->value, fn); return; }
+    if (auto n = dynamic_cast<PrefixExpression*>(node)) { visit(n->right, fn); return; }
+    if (auto n = dynamic_cast<InfixExpression*>(node)) { visit(n->left, fn); visit(n->right, fn); return; }
+    if (auto n = dynamic_cast<IfExpression*>(node)) {
+        visit(n->condition, fn); visit(n->consequence, fn); visit(n->alternative, fn);
+        return;
+    }
+    if (auto n = dynamic_cast<FunctionLiteral*>(node)) { visitAll(n->parameters, fn); visit(n->body, fn); return; }
+    if (auto n = dynamic_cast<CallExpression*>(node)) { visit(n->function, fn); visitAll(n->arguments, fn); return; }
+    if (auto n = dynamic_cast<ArrayLiteral*>(node)) { visitAll(n->elements, fn); return; }
+    if (auto n = dynamic_cast<MapLiteral*>(node)) {
+        for (const auto& [key, value] : n->pairs) { visit(key, fn); visit(value, fn); }
+        return;
+    }
+    if (auto n = dynamic_cast<IndexExpression*>(node)) { visit(n->left, fn); visit(n->index, fn); return; }
+    if (auto n = dynamic_cast<MemberExpression*>(node)) { visit(n->left, fn); visit(n->property, fn); return; }
+    if (auto n = dynamic_cast<WhileExpression*>(node)) { visit(n->condition, fn); visit(n->body, fn); return; }
+    if (auto n = dynamic_cast<InExpression*>(node)) { visit(n->left, fn); visit(n->right, fn); return; }
+    if (auto n = dynamic_cast<IsExpression*>(node)) { visit(n->left, fn); visit(n->right, fn); return; }
+    if (auto n = dynamic_cast<LambdaExpression*>(node)) { visitAll(n->parameters, fn); visit(n->body, fn); return; }
+    if (auto n = dynamic_cast<YieldExpression*>(node)) { visit(n->value, fn); return; }
+    if (auto n = dynamic_cast<ExceptionExpression*>(node)) { visit(n->type, fn); visit(n->message, fn); return; }
+    // Identifiers, literals, break, continue and pass have no children.
+}
+
+// &node->token for the first of the node types node is, else null.
+template <typename T, typename... Rest>
+static Token* ownToken(Node* node) {
+    if (auto n = dynamic_cast<T*>(node)) return &n->token;
+    if constexpr (sizeof...(Rest) > 0) return ownToken<Rest...>(node);
+    else return nullptr;
+}
+
+static void patternTokens(const std::shared_ptr<Pattern>& pattern, const std::function<void(Token&)>& fn) {
+    if (!pattern) return;
+    fn(pattern->token);
+    for (const auto& e : pattern->elements) patternTokens(e, fn);
+    for (const auto& entry : pattern->entries) patternTokens(entry.second, fn);
+}
+
+void tokens(Node* node, const std::function<void(Token&)>& fn) {
+    Token* own = ownToken<ImportStatement, LetStatement, AssignStatement, ReturnStatement, ExpressionStatement,
+                          BlockStatement, StandaloneBlockStatement, BreakStatement, ContinueStatement,
+                          WhileStatement, ForStatement, ForInStatement, FunctionDeclaration, ClassDeclaration,
+                          ThrowStatement, DeferStatement, TryStatement, DelStatement, AssertStatement,
+                          PassStatement, GlobalStatement, NonlocalStatement, WithStatement, MatchStatement,
+                          Identifier, IntegerLiteral, FloatLiteral, DecimalLiteral, StringLiteral,
+                          BooleanLiteral, NullLiteral, AssignExpression, PrefixExpression, InfixExpression,
+                          IfExpression, FunctionLiteral, CallExpression, ArrayLiteral, MapLiteral,
+                          IndexExpression, MemberExpression, WhileExpression, InExpression, IsExpression,
+                          LambdaExpression, YieldExpression, ExceptionExpression>(node);
+    if (!own) return;
+    fn(*own);
+    if (auto n = dynamic_cast<TryStatement*>(node)) {
+        for (const auto& clause : n->catchClauses)
+            if (clause) fn(clause->token);
+    }
+    if (auto n = dynamic_cast<MatchStatement*>(node)) {
+        for (const auto& c : n->cases) {
+            fn(c->token);
+            patternTokens(c->pattern, fn);
+        }
+    }
+}
+
+void inspect(Node* node, const std::function<bool(Node*)>& fn) {
+    if (!node || !fn(node)) return;
+    children(node, [&](Node* child) { inspect(child, fn); });
+}
+
+void walk(Visitor& visitor, Node* node) {
+    if (!node) return;
+    if (visitor.enter(node)) {
+        children(node, [&](Node* child) { walk(visitor, child); });
+    }
+    visitor.leave(node);
+}
+
+// ============ Rewriting ============
+
+static void rewriteChildren(Node* node, const Rewriter& r);
+
+static void rewriteExpr(ExpressionPtr& slot, const Rewriter& r) {
+    if (!slot) return;
+    rewriteChildren(slot.get(), r);
+    if (!r.expression) return;
+    if (auto replacement = r.expression(slot)) slot = replacement;
+}
+
+static void rewriteExprs(std::vector<ExpressionPtr>& list, const Rewriter& r) {
+    for (auto& slot : list) rewriteExpr(slot, r);
+}
+
+static void rewriteStmt(StatementPtr& slot, const Rewriter& r) {
+    if (!slot) return;
+    rewriteChildren(slot.get(), r);
+    if (r.statement) slot = r.statement(slot);
+}
+
+static void rewriteStmts(std::vector<StatementPtr>& list, const Rewriter& r) {
+    std::vector<StatementPtr> out;
+    out.reserve(list.size());
+    for (auto slot : list) {
+        rewriteStmt(slot, r);
+        if (slot) out.push_back(slot);
+    }
+    list.swap(out);
+}
+
+// Blocks are rewritten in place rather than offered as replacements, since
+// their slots are typed as BlockStatementPtr.
+static void rewriteBlock(const BlockStatementPtr& block, const Rewriter& r) {
+    if (block) rewriteStmts(block->statements, r);
+}
+
+static void rewriteChildren(Node* node, const Rewriter& r) {
+    if (!node) return;
+
+    if (auto n = dynamic_cast<Program*>(node)) { rewriteStmts(n->statements, r); return; }
+    if (auto n = dynamic_cast<BlockStatement*>(node)) { rewriteStmts(n->statements, r); return; }
+    if (auto n = dynamic_cast<StandaloneBlockStatement*>(node)) { rewriteBlock(n->block, r); return; }
+    if (auto n = dynamic_cast<LetStatement*>(node)) { rewriteExpr(n->value, r); return; }
+    if (auto n = dynamic_cast<AssignStatement*>(node)) { rewriteExpr(n->target, r); rewriteExpr(n->value, r); return; }
+    if (auto n = dynamic_cast<ReturnStatement*>(node)) { rewriteExpr(n->returnValue, r); return; }
+    if (auto n = dynamic_cast<ExpressionStatement*>(node)) { rewriteExpr(n->expression, r); return; }
+    if (auto n = dynamic_cast<WhileStatement*>(node)) {
+        rewriteExpr(n->condition, r); rewriteBlock(n->body, r); rewriteBlock(n->elseBlock, r);
+        return;
+    }
+    if (auto n = dynamic_cast<ForStatement*>(node)) {
+        rewriteStmt(n->init, r); rewriteExpr(n->condition, r); rewriteStmt(n->post, r); rewriteBlock(n->body, r);
+        rewriteBlock(n->elseBlock, r);
+        return;
+    }
+    if (auto n = dynamic_cast<ForInStatement*>(node)) {
+        rewriteExpr(n->iterable, r); rewriteBlock(n->body, r); rewriteBlock(n->elseBlock, r);
+        return;
+    }
+    if (auto n = dynamic_cast<FunctionDeclaration*>(node)) { rewriteExprs(n->decorators, r); rewriteBlock(n->body, r); return; }
+    if (auto n = dynamic_cast<ClassDeclaration*>(node)) { rewriteExprs(n->decorators, r); rewriteBlock(n->body, r); return; }
+    if (auto n = dynamic_cast<ThrowStatement*>(node)) { rewriteExpr(n->exception, r); return; }
+    if (auto n = dynamic_cast<DeferStatement*>(node)) { rewriteExpr(n->expression, r); return; }
+    if (auto n = dynamic_cast<TryStatement*>(node)) {
+        rewriteBlock(n->tryBlock, r);
+        for (const auto& clause : n->catchClauses) {
+            if (clause) rewriteBlock(clause->catchBlock, r);
+        }
+        rewriteBlock(n->finallyBlock, r);
+        return;
+    }
+    if (auto n = dynamic_cast<DelStatement*>(node)) { rewriteExpr(n->target, r); return; }
+    if (auto n = dynamic_cast<AssertStatement*>(node)) { rewriteExpr(n->condition, r); rewriteExpr(n->message, r); return; }
+    if (auto n = dynamic_cast<WithStatement*>(node)) { rewriteExpr(n->context, r); rewriteBlock(n->body, r); return; }
+    if (auto n = dynamic_cast<MatchStatement*>(node)) {
+        rewriteExpr(n->subject, r);
+        for (const auto& c : n->cases) { rewriteExpr(c->guard, r); rewriteBlock(c->body, r); }
+        return;
+    }
+
+    if (auto n = dynamic_cast<AssignExpression*>(node)) { rewriteExpr(n->name, r); rewriteExpr(n->value, r); return; }
+    if (auto n = dynamic_cast<PrefixExpression*>(node)) { rewriteExpr(n->right, r); return; }
+    if (auto n = dynamic_cast<InfixExpression*>(node)) { rewriteExpr(n->left, r); rewriteExpr(n->right, r); return; }
+    if (auto n = dynamic_cast<IfExpression*>(node)) {
+        rewriteExpr(n->condition, r); rewriteBlock(n->consequence, r); rewriteExpr(n->alternative, r);
+        return;
+    }
+    if (auto n = dynamic_cast<FunctionLiteral*>(node)) { rewriteBlock(n->body, r); return; }
+    if (auto n = dynamic_cast<CallExpression*>(node)) { rewriteExpr(n->function, r); rewriteExprs(n->arguments, r); return; }
+    if (auto n = dynamic_cast<ArrayLiteral*>(node)) { rewriteExprs(n->elements, r); return; }
+    if (auto n = dynamic_cast<MapLiteral*>(node)) {
+        for (auto& [key, value] : n->pairs) { rewriteExpr(key, r); rewriteExpr(value, r); }
+        return;
+    }
+    if (auto n = dynamic_cast<IndexExpression*>(node)) { rewriteExpr(n->left, r); rewriteExpr(n->index, r); return; }
+    if (auto n = dynamic_cast<MemberExpression*>(node)) { rewriteExpr(n->left, r); return; }
+    if (auto n = dynamic_cast<WhileExpression*>(node)) { rewriteExpr(n->condition, r); rewriteBlock(n->body, r); return; }
+    if (auto n = dynamic_cast<InExpression*>(node)) { rewriteExpr(n->left, r); rewriteExpr(n->right, r); return; }
+    if (auto n = dynamic_cast<IsExpression*>(node)) { rewriteExpr(n->left, r); rewriteExpr(n->right, r); return; }
+    if (auto n = dynamic_cast<LambdaExpression*>(node)) { rewriteExpr(n->body, r); return; }
+    if (auto n = dynamic_cast<YieldExpression*>(node)) { rewriteExpr(n->value, r); return; }
+    if (auto n = dynamic_cast<ExceptionExpression*>(node)) { rewriteExpr(n->message, r); return; }
+}
+
+void rewrite(Node* root, const Rewriter& rewriter) {
+    rewriteChildren(root, rewriter);
+}
+
+} // namespace darix::walk
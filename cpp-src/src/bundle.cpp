@@ -0,0 +1,89 @@
+#include "darix/bundle.hpp"
+#include <cstdint>
+#include <cstring>
+#include <filesystem>
+#include <fstream>
+#include <sstream>
+
+namespace darix {
+
+static const char Magic[] = "DARIXBND";
+static constexpr size_t MagicSize = sizeof(Magic) - 1;
+static constexpr size_t TrailerSize = 8 + MagicSize;
+
+std::string executablePath(const char* argv0) {
+    std::error_code ec;
+    auto self = std::filesystem::read_symlink("/proc/self/exe", ec);
+    if (!ec) return self.string();
+    return argv0 ? argv0 : "";
+}
+
+// Size of the runtime in the file at path, i.e. the offset where a bundle's
+// payload starts, and the payload size (0 when there is no bundle).
+static bool splitExecutable(std::ifstream& file, uint64_t* runtimeSize, uint64_t* payloadSize) {
+    file.seekg(0, std::ios::end);
+    auto size = static_cast<uint64_t>(file.tellg());
+    *runtimeSize = size;
+    *payloadSize = 0;
+    if (size < TrailerSize) return true;
+    char trailer[TrailerSize];
+    file.seekg(static_cast<std::streamoff>(size - TrailerSize));
+    if (!file.read(trailer, TrailerSize)) return false;
+    if (std::memcmp(trailer + 8, Magic, MagicSize) != 0) return true;
+    uint64_t n = 0;
+    for (int i = 7; i >= 0; i--) n = (n << 8) | static_cast<unsigned char>(trailer[i]);
+    if (n > size - TrailerSize) return false;
+    *payloadSize = n;
+    *runtimeSize = size - TrailerSize - n;
+    return true;
+}
+
+bool readBundle(const std::string& path, Bundle* out) {
+    std::ifstream file(path, std::ios::binary);
+    uint64_t runtimeSize, payloadSize;
+    if (!file || !splitExecutable(file, &runtimeSize, &payloadSize) || payloadSize == 0) return false;
+    std::string payload(payloadSize, '\0');
+    file.seekg(static_cast<std::streamoff>(runtimeSize));
+    if (!file.read(&payload[0], static_cast<std::streamsize>(payloadSize))) return false;
+    auto nul = payload.find('\0');
+    if (nul == std::string::npos) return false;
+    out->filename = payload.substr(0, nul);
+    out->script = payload.substr(nul + 1);
+    return true;
+}
+
+bool writeBundle(const std::string& runtimePath, const Bundle& bundle, const std::string& output, std::string* error) {
+    std::ifstream runtime(runtimePath, std::ios::binary);
+    uint64_t runtimeSize, payloadSize;
+    if (!runtime || !splitExecutable(runtime, &runtimeSize, &payloadSize)) {
+        *error = "cannot read runtime " + runtimePath;
+        return false;
+    }
+    std::string image(runtimeSize, '\0');
+    runtime.seekg(0);
+    if (!runtime.read(&image[0], static_cast<std::streamsize>(runtimeSize))) {
+        *error = "cannot read runtime " + runtimePath;
+        return false;
+    }
+
+    std::string payload = bundle.filename + '\0' + bundle.script;
+    std::string trailer;
+    for (uint64_t n = payload.size(), i = 0; i < 8; i++, n >>= 8) trailer += static_cast<char>(n & 0xff);
+    trailer.append(Magic, MagicSize);
+
+    std::ofstream out(output, std::ios::binary | std::ios::trunc);
+    out << image << payload << trailer;
+    if (!out.flush()) {
+        *error = "cannot write " + output;
+        return false;
+    }
+    out.close();
+    std::error_code ec;
+    std::filesystem::permissions(output,
+                                 std::filesystem::perms::owner_exec | std::filesystem::perms::group_exec |
+                                     std::filesystem::perms::others_exec,
+                                 std::filesystem::perm_options::add, ec);
+    return true;
+}
+
+} // namespace darix
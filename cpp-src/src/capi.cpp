@@ -0,0 +1,267 @@
+// C API (darix.h) over Interpreter and the object model.
+#include "darix/darix.h"
+#include "darix/interpreter.hpp"
+#include "darix/native/native.hpp"
+#include "darix/object.hpp"
+#include "darix/runner.hpp"
+#include <cctype>
+#include <cstdlib>
+#include <cstring>
+#include <memory>
+#include <string>
+#include <vector>
+
+using namespace darix;
+
+struct darix_vm {
+    std::unique_ptr<Interpreter> interp = std::make_unique<Interpreter>();
+    std::string error;
+    // Host functions, registered again on forks so they get the fork.
+    struct Callback {
+        std::string name;
+        darix_callback fn;
+        void* userdata;
+    };
+    std::vector<Callback> callbacks;
+    // darix_capture_output: whether to capture, and what was captured.
+    bool capture = false;
+    std::string output;
+};
+
+struct darix_value {
+    ObjectPtr obj;
+};
+
+static darix_value* wrap(ObjectPtr obj) { return obj ? new darix_value{std::move(obj)} : nullptr; }
+
+// Records a failed result as the vm's error and returns true.
+static bool failed(darix_vm* vm, const ObjectPtr& result) {
+    if (!result) return false;
+    auto type = result->type();
+    if (type == ObjectType::ERROR) {
+        vm->error = result->inspect();
+    } else if (type == ObjectType::EXCEPTION_SIGNAL) {
+        vm->error = "Unhandled exception:\n" + result->inspect();
+    } else {
+        return false;
+    }
+    return true;
+}
+
+// Sends script output to vm's buffer while a call runs, if it captures.
+struct CaptureScope {
+    explicit CaptureScope(darix_vm* vm) : active(vm->capture) {
+        if (active) previous = native::setOutputSink([vm](const std::string& text) { vm->output += text; });
+    }
+    ~CaptureScope() {
+        if (active) native::setOutputSink(std::move(previous));
+    }
+    bool active;
+    native::OutputSink previous;
+};
+
+// Map entries in iteration order, for either map representation.
+static std::vector<std::pair<ObjectPtr, ObjectPtr>> mapEntries(const ObjectPtr& obj) {
+    if (auto m = std::dynamic_pointer_cast<Map>(obj)) return m->pairs;
+    std::vector<std::pair<ObjectPtr, ObjectPtr>> out;
+    if (auto h = std::dynamic_pointer_cast<Hash>(obj))
+        for (auto& [k, p] : h->pairs) out.push_back({p.key, p.value});
+    return out;
+}
+
+extern "C" {
+
+darix_vm* darix_new(void) { return new darix_vm(); }
+
+darix_vm* darix_fork(const darix_vm* vm) {
+    auto child = new darix_vm{vm->interp->fork(), "", {}};
+    for (auto& c : vm->callbacks) darix_register(child, c.name.c_str(), c.fn, c.userdata);
+    return child;
+}
+
+void darix_free(darix_vm* vm) { delete vm; }
+
+darix_value* darix_eval(darix_vm* vm, const char* code) {
+    vm->error.clear();
+    auto [program, errors] = parseSource(code ? code : "", "<embed>");
+    if (!errors.empty()) {
+        for (auto& e : errors) vm->error += (vm->error.empty() ? "" : "\n") + e;
+        return nullptr;
+    }
+    CaptureScope capture(vm);
+    auto result = vm->interp->interpret(program.get());
+    if (failed(vm, result)) return nullptr;
+    return wrap(result ? result : getNull());
+}
+
+darix_value* darix_call(darix_vm* vm, const char* name, darix_value* const* args, size_t nargs) {
+    vm->error.clear();
+    auto fn = vm->interp->getEnvironment()->get(name);
+    if (!fn) {
+        vm->error = std::string("NameError: name '") + name + "' is not defined";
+        return nullptr;
+    }
+    std::vector<ObjectPtr> argv;
+    for (size_t i = 0; i < nargs; i++) argv.push_back(args[i] ? args[i]->obj : getNull());
+    CaptureScope capture(vm);
+    auto result = vm->interp->call(fn, argv);
+    if (failed(vm, result)) return nullptr;
+    return wrap(result ? result : getNull());
+}
+
+void darix_stop(darix_vm* vm) { vm->interp->stop(); }
+
+void darix_set_budget(darix_vm* vm, int n) { vm->interp->setInstructionBudget(n); }
+
+void darix_capture_output(darix_vm* vm, int enabled) { vm->capture = enabled != 0; }
+
+char* darix_take_output(darix_vm* vm) {
+    char* out = static_cast<char*>(std::malloc(vm->output.size() + 1));
+    std::memcpy(out, vm->output.c_str(), vm->output.size() + 1);
+    vm->output.clear();
+    return out;
+}
+
+const char* darix_last_error(const darix_vm* vm) { return vm->error.c_str(); }
+
+void darix_set_error(darix_vm* vm, const char* message) { vm->error = message ? message : ""; }
+
+int darix_register(darix_vm* vm, const char* name, darix_callback fn, void* userdata) {
+    std::string id = name ? name : "";
+    if (id.empty() || std::isdigit(static_cast<unsigned char>(id[0]))) return 0;
+    for (char c : id)
+        if (!std::isalnum(static_cast<unsigned char>(c)) && c != '_') return 0;
+    auto builtin = std::make_shared<Builtin>();
+    builtin->fn = [vm, fn, userdata, id](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        std::vector<darix_value> values;
+        for (auto& a : args) values.push_back({a});
+        std::vector<darix_value*> ptrs;
+        for (auto& v : values) ptrs.push_back(&v);
+        vm->error.clear();
+        darix_value* result = fn(vm, ptrs.data(), ptrs.size(), userdata);
+        if (!result) return newError("%s: %s", id.c_str(), vm->error.empty() ? "host function failed" : vm->error.c_str());
+        ObjectPtr obj = result->obj ? result->obj : getNull();
+        delete result;
+        return obj;
+    };
+    vm->interp->getEnvironment()->set(id, builtin);
+    vm->callbacks.push_back({id, fn, userdata});
+    return 1;
+}
+
+void darix_set_global(darix_vm* vm, const char* name, const darix_value* value) {
+    vm->interp->getEnvironment()->set(name, value ? value->obj : getNull());
+}
+
+darix_value* darix_get_global(darix_vm* vm, const char* name) { return wrap(vm->interp->getEnvironment()->get(name)); }
+
+darix_value* darix_null(void) { return wrap(getNull()); }
+darix_value* darix_bool(int value) { return wrap(newBoolean(value != 0)); }
+darix_value* darix_int(int64_t value) { return wrap(newInteger(value)); }
+darix_value* darix_float(double value) { return wrap(newFloat(value)); }
+darix_value* darix_string(const char* value) { return wrap(newString(value ? value : "")); }
+darix_value* darix_string_n(const char* value, size_t len) { return wrap(newString(std::string(value, len))); }
+darix_value* darix_array(void) { return wrap(newArray({})); }
+
+void darix_array_push(darix_value* array, const darix_value* item) {
+    if (auto arr = std::dynamic_pointer_cast<Array>(array->obj)) arr->elements.push_back(item ? item->obj : getNull());
+}
+
+darix_value* darix_map(void) { return wrap(newMap({})); }
+
+void darix_map_set(darix_value* map, const darix_value* key, const darix_value* value) {
+    auto m = std::dynamic_pointer_cast<Map>(map->obj);
+    if (!m || !key) return;
+    ObjectPtr v = value ? value->obj : getNull();
+    for (auto& [k, old] : m->pairs) {
+        if (equals(k, key->obj)) {
+            old = v;
+            return;
+        }
+    }
+    m->pairs.push_back({key->obj, v});
+}
+
+void darix_freeze(darix_value* value, const char* name) {
+    if (value) freeze(value->obj, name ? name : "value");
+}
+
+darix_value* darix_value_copy(const darix_value* value) { return value ? wrap(value->obj) : nullptr; }
+
+void darix_value_free(darix_value* value) { delete value; }
+
+darix_type darix_typeof(const darix_value* value) {
+    switch (value->obj->type()) {
+        case ObjectType::NULL_OBJ: return DARIX_NULL;
+        case ObjectType::BOOLEAN: return DARIX_BOOL;
+        case ObjectType::INTEGER: return DARIX_INT;
+        case ObjectType::FLOAT: return DARIX_FLOAT;
+        case ObjectType::STRING: return DARIX_STRING;
+        case ObjectType::ARRAY: return DARIX_ARRAY;
+        case ObjectType::MAP:
+        case ObjectType::HASH: return DARIX_MAP;
+        default: return DARIX_OTHER;
+    }
+}
+
+int darix_as_bool(const darix_value* value) {
+    auto b = std::dynamic_pointer_cast<Boolean>(value->obj);
+    return b && b->value;
+}
+
+int64_t darix_as_int(const darix_value* value) {
+    if (auto i = std::dynamic_pointer_cast<Integer>(value->obj)) return i->value;
+    if (auto f = std::dynamic_pointer_cast<Float>(value->obj)) return static_cast<int64_t>(f->value);
+    return 0;
+}
+
+double darix_as_float(const darix_value* value) {
+    if (auto f = std::dynamic_pointer_cast<Float>(value->obj)) return f->value;
+    if (auto i = std::dynamic_pointer_cast<Integer>(value->obj)) return static_cast<double>(i->value);
+    return 0.0;
+}
+
+const char* darix_as_string(const darix_value* value, size_t* len) {
+    auto s = std::dynamic_pointer_cast<String>(value->obj);
+    if (len) *len = s ? s->value.size() : 0;
+    return s ? s->value.c_str() : "";
+}
+
+size_t darix_len(const darix_value* value) {
+    if (auto arr = std::dynamic_pointer_cast<Array>(value->obj)) return arr->elements.size();
+    if (auto m = std::dynamic_pointer_cast<Map>(value->obj)) return m->pairs.size();
+    if (auto h = std::dynamic_pointer_cast<Hash>(value->obj)) return h->pairs.size();
+    return 0;
+}
+
+darix_value* darix_array_get(const darix_value* array, size_t index) {
+    auto arr = std::dynamic_pointer_cast<Array>(array->obj);
+    return arr && index < arr->elements.size() ? wrap(arr->elements[index]) : nullptr;
+}
+
+darix_value* darix_map_key(const darix_value* map, size_t index) {
+    auto entries = mapEntries(map->obj);
+    return index < entries.size() ? wrap(entries[index].first) : nullptr;
+}
+
+darix_value* darix_map_value(const darix_value* map, size_t index) {
+    auto entries = mapEntries(map->obj);
+    return index < entries.size() ? wrap(entries[index].second) : nullptr;
+}
+
+darix_value* darix_map_get(const darix_value* map, const darix_value* key) {
+    for (auto& [k, v] : mapEntries(map->obj))
+        if (key && equals(k, key->obj)) return wrap(v);
+    return nullptr;
+}
+
+char* darix_repr(const darix_value* value) {
+    auto text = repr(value->obj);
+    char* out = static_cast<char*>(std::malloc(text.size() + 1));
+    std::memcpy(out, text.c_str(), text.size() + 1);
+    return out;
+}
+
+void darix_string_free(char* text) { std::free(text); }
+
+} // extern "C"
@@ -1,4 +1,6 @@
 #include "darix/code.hpp"
+#include <algorithm>
+#include <cstdio>
 #include <sstream>
 #include <stdexcept>
 
@@ -41,6 +43,8 @@ static Definition definitions[] = {
     /* OpGetLocal       */ {"OpGetLocal",       {2}},
     /* OpSetLocal       */ {"OpSetLocal",       {2}},
     /* OpSwap           */ {"OpSwap",           {}},
+    /* OpIterable       */ {"OpIterable",       {2}},
+    /* OpIterNext       */ {"OpIterNext",       {2, 2}},
 };
 
 const Definition* Lookup(Opcode op) {
@@ -51,6 +55,13 @@ const Definition* Lookup(Opcode op) {
     return &definitions[idx];
 }
 
+std::optional<Opcode> LookupName(const std::string& name) {
+    for (size_t i = 0; i < sizeof(definitions) / sizeof(definitions[0]); i++) {
+        if (definitions[i].name == name) return static_cast<Opcode>(i);
+    }
+    return std::nullopt;
+}
+
 static void PutUint16(uint8_t* buf, uint16_t val) {
     buf[0] = static_cast<uint8_t>((val >> 8) & 0xFF);
     buf[1] = static_cast<uint8_t>(val & 0xFF);
@@ -109,40 +120,86 @@ std::pair<std::vector<int>, int> ReadOperands(const Definition* def, const uint8
     return {operands, static_cast<int>(offset)};
 }
 
-std::string Disassemble(const Instructions& ins) {
+InstructionIterator::InstructionIterator(const Instructions* ins, size_t pc) : ins_(ins), pc_(pc) {
+    decode();
+}
+
+InstructionIterator& InstructionIterator::operator++() {
+    pc_ = std::min(pc_ + current_.width, ins_->size());
+    decode();
+    return *this;
+}
+
+void InstructionIterator::decode() {
+    if (pc_ >= ins_->size()) return;
+    current_.pc = static_cast<int>(pc_);
+    current_.op = static_cast<Opcode>((*ins_)[pc_]);
+    current_.def = Lookup(current_.op);
+    if (!current_.def) {
+        current_.operands.clear();
+        current_.width = 1;
+        return;
+    }
+    auto [operands, read] = ReadOperands(current_.def, ins_->data() + pc_ + 1, ins_->size() - pc_ - 1);
+    current_.operands = std::move(operands);
+    current_.width = 1 + read;
+}
+
+std::string Disassemble(const Instructions& ins, const std::vector<std::string>& globals) {
     std::ostringstream out;
-    size_t offset = 0;
-    while (offset < ins.size()) {
-        uint8_t opByte = ins[offset];
-        Opcode op = static_cast<Opcode>(opByte);
-        const Definition* def = Lookup(op);
-
-        if (!def) {
-            out << "ERROR: unknown opcode " << static_cast<int>(opByte) << "\n";
-            offset++;
+    for (const auto& in : Decode(ins)) {
+        if (!in.def) {
+            out << "ERROR: unknown opcode " << static_cast<int>(in.op) << "\n";
             continue;
         }
 
-        // Format instruction
-        auto [operands, read] = ReadOperands(def, ins.data() + offset + 1, ins.size() - offset - 1);
-
         char buf[32];
-        std::snprintf(buf, sizeof(buf), "%04d ", static_cast<int>(offset));
-        out << buf;
-
-        out << def->name;
-        if (!operands.empty()) {
-            out << " ";
-            for (size_t i = 0; i < operands.size(); i++) {
-                if (i > 0) out << " ";
-                out << operands[i];
-            }
-        }
+        std::snprintf(buf, sizeof(buf), "%04d ", in.pc);
+        out << buf << in.def->name;
+        for (int operand : in.operands) out << " " << operand;
+        if ((in.op == Opcode::OpGetGlobal || in.op == Opcode::OpSetGlobal) && in.operands[0] < static_cast<int>(globals.size()) &&
+            !globals[in.operands[0]].empty())
+            out << "  # " << globals[in.operands[0]];
         out << "\n";
-
-        offset += 1 + read;
     }
     return out.str();
 }
 
+Instructions Assemble(const std::string& text) {
+    Instructions ins;
+    std::istringstream lines(text);
+    std::string line;
+    for (int lineNo = 1; std::getline(lines, line); lineNo++) {
+        auto hash = line.find('#');
+        if (hash != std::string::npos) line.erase(hash);
+        std::istringstream words(line);
+        std::string word;
+        if (!(words >> word)) continue;
+        // Skip the offset column of Disassemble output.
+        if (word.find_first_not_of("0123456789") == std::string::npos && !(words >> word)) continue;
+
+        auto op = LookupName(word);
+        if (!op) throw std::runtime_error("line " + std::to_string(lineNo) + ": unknown opcode " + word);
+        const Definition* def = Lookup(*op);
+        std::vector<int> operands;
+        for (std::string arg; words >> arg;) {
+            size_t used = 0;
+            long value = -1;
+            try { value = std::stol(arg, &used); } catch (const std::exception&) {}
+            if (used != arg.size() || value < 0 || value > 0xFFFF) {
+                throw std::runtime_error("line " + std::to_string(lineNo) + ": bad operand " + arg + " for " + word);
+            }
+            operands.push_back(static_cast<int>(value));
+        }
+        if (operands.size() != def->operandWidths.size()) {
+            throw std::runtime_error("line " + std::to_string(lineNo) + ": " + word + " takes " +
+                                     std::to_string(def->operandWidths.size()) + " operand(s), got " +
+                                     std::to_string(operands.size()));
+        }
+        auto encoded = Make(*op, operands);
+        ins.insert(ins.end(), encoded.begin(), encoded.end());
+    }
+    return ins;
+}
+
 } // namespace darix
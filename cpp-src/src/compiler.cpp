@@ -1,6 +1,9 @@
 #include "darix/compiler.hpp"
+#include "darix/native/native.hpp"
 #include "darix/version.hpp"
+#include <algorithm>
 #include <charconv>
+#include <cstring>
 #include <stdexcept>
 
 namespace darix {
@@ -27,6 +30,14 @@ std::pair<Symbol, bool> SymbolTable::resolve(const std::string& name) const {
 // ============ Compiler ============
 
 Compiler::Compiler() : symbolTable_(std::make_shared<SymbolTable>()) {}
+Compiler::Compiler(std::shared_ptr<SymbolTable> symbols) : symbolTable_(std::move(symbols)) {}
+Compiler::Compiler(std::shared_ptr<SymbolTable> symbols, std::vector<ObjectPtr> constants)
+    : constants_(std::move(constants)), symbolTable_(std::move(symbols)) {
+    for (size_t i = 0; i < constants_.size(); i++) {
+        auto key = constantKey(constants_[i]);
+        if (!key.empty()) constantIndex_.emplace(key, static_cast<int>(i));
+    }
+}
 
 int Compiler::emit(Opcode op, const std::vector<int>& operands) {
     auto ins = Make(op, operands);
@@ -45,7 +56,25 @@ int Compiler::emitAt(Node* node, Opcode op, const std::vector<int>& operands) {
     return pos;
 }
 
+std::string Compiler::constantKey(const ObjectPtr& obj) {
+    // Floats are keyed by their bits, keeping 0.0 and -0.0 apart.
+    if (auto i = std::dynamic_pointer_cast<Integer>(obj)) return "i" + std::to_string(i->value);
+    if (auto f = std::dynamic_pointer_cast<Float>(obj)) {
+        uint64_t bits;
+        std::memcpy(&bits, &f->value, sizeof bits);
+        return "f" + std::to_string(bits);
+    }
+    if (auto s = std::dynamic_pointer_cast<String>(obj)) return "s" + s->value;
+    if (auto b = std::dynamic_pointer_cast<Builtin>(obj)) return "b" + b->name;
+    return "";
+}
+
 int Compiler::addConstant(ObjectPtr obj) {
+    auto key = constantKey(obj);
+    if (!key.empty()) {
+        auto [it, added] = constantIndex_.emplace(key, static_cast<int>(constants_.size()));
+        if (!added) return it->second;
+    }
     constants_.push_back(obj);
     return static_cast<int>(constants_.size()) - 1;
 }
@@ -55,9 +84,15 @@ std::shared_ptr<Bytecode> Compiler::bytecode() {
     auto bc = std::make_shared<Bytecode>();
     bc->magic = BytecodeMagic;
     bc->version = DARIX_VERSION;
+    bc->features = FeaturePeephole | (debugEntries_.empty() ? 0 : FeatureDebugInfo);
     bc->instructions = instructions_;
     bc->constants = constants_;
     bc->debug.entries = debugEntries_;
+    bc->debug.globals = globalNames(*symbolTable_);
+    if (!bc->debug.globals.empty()) bc->features |= FeatureGlobalNames;
+    for (auto& c : constants_) {
+        if (c->type() == ObjectType::COMPILED_FUNCTION || c->type() == ObjectType::BUILTIN) bc->features |= FeatureFunctions;
+    }
     return bc;
 }
 
@@ -83,45 +118,52 @@ bool Compiler::compileBuiltinCall(CallExpression* node, const std::string& name)
     if (name == "print") {
         compileExpressions(node->arguments);
         emitAt(node, Opcode::OpPrint, {static_cast<int>(node->arguments.size())});
-        lastCompiledPushedValue_ = false;
+        // print returns null like any other call; the peephole pass drops
+        // it again when the call is a statement.
+        emitAt(node, Opcode::OpNull);
         return true;
     }
     if (name == "len") {
         if (node->arguments.size() != 1) throw std::runtime_error("len: expected 1 argument");
         compile(node->arguments[0].get());
         emitAt(node, Opcode::OpLen);
-        lastCompiledPushedValue_ = true;
         return true;
     }
     if (name == "type") {
         if (node->arguments.size() != 1) throw std::runtime_error("type: expected 1 argument");
         compile(node->arguments[0].get());
         emitAt(node, Opcode::OpType);
-        lastCompiledPushedValue_ = true;
         return true;
     }
     return false;
 }
 
 bool Compiler::compile(Node* node) {
-    if (!node) { lastCompiledPushedValue_ = true; return true; }
+    // A missing expression, such as the value of a bare `var x`, is null.
+    if (!node) {
+        emit(Opcode::OpNull);
+        return true;
+    }
 
     if (auto program = dynamic_cast<Program*>(node)) {
+        strict_ = program->strict;
+        // Top-level functions and variables are declared up front, so
+        // functions can call ones further down and assign globals declared
+        // after them, as they can when the interpreter looks names up.
+        for (auto& stmt : program->statements) {
+            if (auto fd = dynamic_cast<FunctionDeclaration*>(stmt.get())) declare(fd->name->value);
+            else if (auto let = dynamic_cast<LetStatement*>(stmt.get())) declare(let->name->value);
+        }
         compileStatements(program->statements);
-        lastCompiledPushedValue_ = true;
         return true;
     }
     if (auto block = dynamic_cast<BlockStatement*>(node)) {
         compileStatements(block->statements);
-        lastCompiledPushedValue_ = true;
         return true;
     }
     if (auto exprStmt = dynamic_cast<ExpressionStatement*>(node)) {
         compile(exprStmt->expression.get());
-        if (lastCompiledPushedValue_) {
-            emitAt(node, Opcode::OpPop);
-        }
-        lastCompiledPushedValue_ = true;
+        emitAt(node, Opcode::OpPop);
         return true;
     }
     if (auto intLit = dynamic_cast<IntegerLiteral*>(node)) {
@@ -135,7 +177,7 @@ bool Compiler::compile(Node* node) {
         return true;
     }
     if (auto strLit = dynamic_cast<StringLiteral*>(node)) {
-        int idx = addConstant(newString(strLit->value));
+        int idx = addConstant(internString(strLit->value));
         emitAt(node, Opcode::OpConstant, {idx});
         return true;
     }
@@ -208,22 +250,37 @@ bool Compiler::compile(Node* node) {
     }
     if (auto letStmt = dynamic_cast<LetStatement*>(node)) {
         compile(letStmt->value.get());
-        auto sym = symbolTable_->define(letStmt->name->value);
-        emitAt(node, Opcode::OpSetGlobal, {sym.index});
+        emitSet(node, declare(letStmt->name->value));
         return true;
     }
     if (auto ident = dynamic_cast<Identifier*>(node)) {
-        auto [sym, ok] = symbolTable_->resolve(ident->value);
-        if (!ok) throw std::runtime_error("undefined variable " + ident->value);
-        emitAt(node, Opcode::OpGetGlobal, {sym.index});
+        auto [sym, ok] = resolveSymbol(ident->value);
+        if (!ok && resolveBuiltin_) {
+            std::string why;
+            if (auto builtin = resolveBuiltin_(ident->value, &why)) {
+                emitAt(node, Opcode::OpConstant, {addConstant(builtin)});
+                return true;
+            }
+            if (!why.empty()) throw std::runtime_error(ident->value + " " + why);
+        }
+        if (!ok) {
+            std::vector<std::string> names;
+            for (auto table = symbolTable_; table; table = table->outer()) {
+                for (auto& [name, _] : table->symbols()) names.push_back(name);
+            }
+            auto hint = didYouMean(ident->value, names);
+            throw std::runtime_error("undefined variable " + ident->value + (hint.empty() ? "" : " (" + hint + ")"));
+        }
+        emitGet(node, sym);
         return true;
     }
     if (auto assign = dynamic_cast<AssignStatement*>(node)) {
         if (auto targetIdent = dynamic_cast<Identifier*>(assign->target.get())) {
             compile(assign->value.get());
-            auto [sym, ok] = symbolTable_->resolve(targetIdent->value);
+            auto [sym, ok] = resolveSymbol(targetIdent->value);
+            if (!ok && strict_) throw std::runtime_error("assignment to undeclared variable " + targetIdent->value + " in strict mode");
             if (!ok) sym = symbolTable_->define(targetIdent->value);
-            emitAt(node, Opcode::OpSetGlobal, {sym.index});
+            emitSet(node, sym);
             return true;
         }
         if (auto targetIdx = dynamic_cast<IndexExpression*>(assign->target.get())) {
@@ -231,6 +288,7 @@ bool Compiler::compile(Node* node) {
             compile(targetIdx->index.get());
             compile(assign->value.get());
             emitAt(node, Opcode::OpSetIndex);
+            emitAt(node, Opcode::OpPop);
             return true;
         }
         throw std::runtime_error("unsupported assignment target");
@@ -241,10 +299,13 @@ bool Compiler::compile(Node* node) {
         compileBlock(ifExpr->consequence);
         int jmpPos = emitAt(node, Opcode::OpJump, {9999});
         replaceOperand(jntPos, static_cast<int>(instructions_.size()));
-        if (ifExpr->alternative) compile(ifExpr->alternative.get());
+        if (ifExpr->alternative) {
+            compile(ifExpr->alternative.get());
+            // An else-if is an if expression with its own null result.
+            if (!dynamic_cast<BlockStatement*>(ifExpr->alternative.get())) emitAt(node, Opcode::OpPop);
+        }
         replaceOperand(jmpPos, static_cast<int>(instructions_.size()));
         emitAt(node, Opcode::OpNull);
-        lastCompiledPushedValue_ = true;
         return true;
     }
     if (auto whileStmt = dynamic_cast<WhileStatement*>(node)) {
@@ -254,19 +315,155 @@ bool Compiler::compile(Node* node) {
         compileBlock(whileStmt->body);
         emitAt(node, Opcode::OpJump, {condPos});
         replaceOperand(jntPos, static_cast<int>(instructions_.size()));
+        // Bytecode has no break, so a loop always ends by its condition and
+        // the else block follows the exit directly.
+        if (whileStmt->elseBlock) compileBlock(whileStmt->elseBlock);
+        return true;
+    }
+    if (auto forIn = dynamic_cast<ForInStatement*>(node)) {
+        // The loop state stays on the stack; the loop variables belong to the
+        // enclosing function or the globals, like other variables declared
+        // in blocks.
+        int count = forIn->key ? 2 : 1;
+        compile(forIn->iterable.get());
+        emitAt(node, Opcode::OpIterable, {count});
+        int nextPos = emitAt(node, Opcode::OpIterNext, {9999, count});
+        emitSet(node, declare(forIn->value->value));
+        if (forIn->key) emitSet(node, declare(forIn->key->value));
+        compileBlock(forIn->body);
+        emitAt(node, Opcode::OpJump, {nextPos});
+        replaceInstruction(nextPos, Make(Opcode::OpIterNext, {static_cast<int>(instructions_.size()), count}));
+        if (forIn->elseBlock) compileBlock(forIn->elseBlock);
         return true;
     }
     if (auto call = dynamic_cast<CallExpression*>(node)) {
-        if (auto ident = dynamic_cast<Identifier*>(call->function.get())) {
-            bool handled = compileBuiltinCall(call, ident->value);
-            if (handled) return true;
-        }
-        throw std::runtime_error("unsupported function call in VM");
+        // print, len and type have their own opcodes unless a variable
+        // shadows them.
+        auto ident = dynamic_cast<Identifier*>(call->function.get());
+        if (ident && !symbolTable_->resolve(ident->value).second && compileBuiltinCall(call, ident->value)) return true;
+        compile(call->function.get());
+        compileExpressions(call->arguments);
+        emitAt(node, Opcode::OpCall, {static_cast<int>(call->arguments.size())});
+        return true;
+    }
+    if (auto imp = dynamic_cast<ImportStatement*>(node)) {
+        compileImport(imp);
+        return true;
+    }
+    if (auto member = dynamic_cast<MemberExpression*>(node)) {
+        // Only module functions, which are constants: m.fn where m names an
+        // imported module and no variable.
+        auto ident = dynamic_cast<Identifier*>(member->left.get());
+        auto mod = ident && !symbolTable_->resolve(ident->value).second ? modules_.find(ident->value) : modules_.end();
+        if (mod == modules_.end()) throw std::runtime_error("member access is not supported in bytecode");
+        std::string name = mod->second + "." + member->property->value, why;
+        auto builtin = resolveBuiltin_ ? resolveBuiltin_(name, &why) : nullptr;
+        if (!builtin && !why.empty()) throw std::runtime_error(name + " " + why);
+        if (!builtin) throw std::runtime_error("module " + mod->second + " has no function " + member->property->value);
+        emitAt(node, Opcode::OpConstant, {addConstant(builtin)});
+        return true;
+    }
+    if (auto fd = dynamic_cast<FunctionDeclaration*>(node)) {
+        if (!fd->decorators.empty()) throw std::runtime_error("decorators are not supported in bytecode");
+        // Declared before the body is compiled, so the function can call itself.
+        auto sym = declare(fd->name->value);
+        emitAt(node, Opcode::OpConstant, {compileFunction(fd->name->value, fd->parameters, fd->body)});
+        emitSet(node, sym);
+        return true;
+    }
+    if (auto fl = dynamic_cast<FunctionLiteral*>(node)) {
+        emitAt(node, Opcode::OpConstant, {compileFunction("", fl->parameters, fl->body)});
+        return true;
+    }
+    if (auto ret = dynamic_cast<ReturnStatement*>(node)) {
+        if (!symbolTable_->outer()) throw std::runtime_error("return outside a function is not supported in bytecode");
+        compile(ret->returnValue.get());
+        emitAt(node, Opcode::OpReturnValue);
+        return true;
     }
 
+    // A deferred call runs when its function returns or raises, and VM frames
+    // keep no deferred calls to run then; such scripts run on the interpreter
+    // (see "Defer" in docs/language.md).
+    if (dynamic_cast<DeferStatement*>(node)) throw std::runtime_error("defer is not supported in bytecode");
+    if (dynamic_cast<MatchStatement*>(node)) throw std::runtime_error("match is not supported in bytecode");
     throw std::runtime_error("unsupported AST node in compiler");
 }
 
+void Compiler::compileImport(ImportStatement* node) {
+    // Native modules bind no value: their functions are resolved as the
+    // constants they are. DariX modules have code to run and are left to
+    // the interpreter, as are imports the interpreter must refuse or audit.
+    if (symbolTable_->outer()) throw std::runtime_error("import inside a function is not supported in bytecode");
+    std::string path = node->path->value;
+    if (path.substr(0, 4) == "std:") throw std::runtime_error("std: modules are not supported in bytecode");
+    std::string modName = path.substr(0, 3) == "go:" ? path.substr(3) : path;
+    if (!native::Registry::instance().get(modName) || !native::CapabilityPolicy::instance().allowsModule(modName) ||
+        native::AuditLog::instance().enabled())
+        throw std::runtime_error("import of " + path + " is not supported in bytecode");
+    if (node->names.empty()) {
+        modules_[node->alias ? node->alias->value : modName] = modName;
+        return;
+    }
+    for (auto& name : node->names) {
+        std::string why;
+        auto builtin = resolveBuiltin_ ? resolveBuiltin_(modName + "." + name->value, &why) : nullptr;
+        if (!builtin && !why.empty()) throw std::runtime_error(modName + "." + name->value + " " + why);
+        if (!builtin) throw std::runtime_error("module " + modName + " has no function " + name->value);
+        emitAt(node, Opcode::OpConstant, {addConstant(builtin)});
+        emitSet(node, declare(name->value));
+    }
+}
+
+int Compiler::compileFunction(const std::string& name, const std::vector<IdentifierPtr>& params, const BlockStatementPtr& body) {
+    auto outer = symbolTable_;
+    auto outerInstructions = std::move(instructions_);
+    auto outerDebug = std::move(debugEntries_);
+    instructions_.clear();
+    debugEntries_.clear();
+    symbolTable_ = std::make_shared<SymbolTable>(outer);
+    for (auto& param : params) symbolTable_->define(param->value);
+    compileBlock(body);
+    emit(Opcode::OpReturn);
+
+    auto fn = std::make_shared<CompiledFunction>();
+    fn->instructions = peephole(instructions_);
+    fn->numLocals = symbolTable_->numDefinitions();
+    fn->numParameters = static_cast<int>(params.size());
+    fn->name = name;
+    // As the interpreter's Function prints it.
+    fn->source = "func" + (name.empty() ? "" : " " + name) + "(";
+    for (size_t i = 0; i < params.size(); i++) fn->source += (i > 0 ? ", " : "") + params[i]->inspect();
+    fn->source += ") " + (body ? body->inspect() : "");
+
+    // Positions inside the body are not recorded: debug entries map the
+    // top-level instructions, so errors report the call site.
+    symbolTable_ = outer;
+    instructions_ = std::move(outerInstructions);
+    debugEntries_ = std::move(outerDebug);
+    return addConstant(fn);
+}
+
+Symbol Compiler::declare(const std::string& name) {
+    auto it = symbolTable_->symbols().find(name);
+    return it != symbolTable_->symbols().end() ? it->second : symbolTable_->define(name);
+}
+
+std::pair<Symbol, bool> Compiler::resolveSymbol(const std::string& name) const {
+    auto [sym, ok] = symbolTable_->resolve(name);
+    if (ok && sym.scope == SymbolScope::LOCAL && !symbolTable_->symbols().count(name))
+        throw std::runtime_error("closures are not supported in bytecode (" + name + ")");
+    return {sym, ok};
+}
+
+void Compiler::emitGet(Node* node, const Symbol& sym) {
+    emitAt(node, sym.scope == SymbolScope::GLOBAL ? Opcode::OpGetGlobal : Opcode::OpGetLocal, {sym.index});
+}
+
+void Compiler::emitSet(Node* node, const Symbol& sym) {
+    emitAt(node, sym.scope == SymbolScope::GLOBAL ? Opcode::OpSetGlobal : Opcode::OpSetLocal, {sym.index});
+}
+
 void Compiler::replaceOperand(int pos, int operand) {
     Opcode op = static_cast<Opcode>(instructions_[pos]);
     auto ins = Make(op, {operand});
@@ -301,10 +498,26 @@ DebugEntry tokenInfoFromNode(Node* node) {
     else EXTRACT_TOKEN(StandaloneBlockStatement, token)
     else EXTRACT_TOKEN(WhileStatement, token)
     else EXTRACT_TOKEN(ForStatement, token)
+    else EXTRACT_TOKEN(ForInStatement, token)
     else EXTRACT_TOKEN(FunctionDeclaration, token)
+    else EXTRACT_TOKEN(ClassDeclaration, token)
+    else EXTRACT_TOKEN(ImportStatement, token)
+    else EXTRACT_TOKEN(BreakStatement, token)
+    else EXTRACT_TOKEN(ContinueStatement, token)
+    else EXTRACT_TOKEN(ThrowStatement, token)
+    else EXTRACT_TOKEN(DeferStatement, token)
+    else EXTRACT_TOKEN(TryStatement, token)
+    else EXTRACT_TOKEN(DelStatement, token)
+    else EXTRACT_TOKEN(AssertStatement, token)
+    else EXTRACT_TOKEN(PassStatement, token)
+    else EXTRACT_TOKEN(GlobalStatement, token)
+    else EXTRACT_TOKEN(NonlocalStatement, token)
+    else EXTRACT_TOKEN(WithStatement, token)
+    else EXTRACT_TOKEN(MatchStatement, token)
     else EXTRACT_TOKEN(Identifier, token)
     else EXTRACT_TOKEN(IntegerLiteral, token)
     else EXTRACT_TOKEN(FloatLiteral, token)
+    else EXTRACT_TOKEN(DecimalLiteral, token)
     else EXTRACT_TOKEN(StringLiteral, token)
     else EXTRACT_TOKEN(BooleanLiteral, token)
     else EXTRACT_TOKEN(NullLiteral, token)
@@ -316,6 +529,7 @@ DebugEntry tokenInfoFromNode(Node* node) {
     else EXTRACT_TOKEN(ArrayLiteral, token)
     else EXTRACT_TOKEN(MapLiteral, token)
     else EXTRACT_TOKEN(IndexExpression, token)
+    else EXTRACT_TOKEN(MemberExpression, token)
 
     #undef EXTRACT_TOKEN
 
@@ -332,116 +546,302 @@ DebugEntry tokenInfoFromNode(Node* node) {
     return entry;
 }
 
-// ============ Constant folding ============
+// ============ Bytecode files ============
+//
+// Layout (integers big-endian, strings as u32 length + bytes):
+//   magic            "DRXB1"
+//   u16 format       BytecodeFormatVersion
+//   u32 features     BytecodeFeature bits
+//   str version      DariX version of the compiler
+//   str instructions
+//   u32 count, then constants as u8 type tag + payload; a builtin is its
+//                    str name, a function its str name, str source, u32 locals,
+//                    u32 parameters and str instructions
+//   u32 count, then debug entries as u32 pc, str file, u32 line, u32 column, str function
+//   with FeatureGlobalNames: u32 count, then the name of each global slot as str
+
+enum ConstantTag : uint8_t { TagNull, TagInteger, TagFloat, TagString, TagBoolean, TagBuiltin, TagFunction };
+
+static void putUint(std::string& out, uint64_t value, int bytes) {
+    for (int i = bytes - 1; i >= 0; i--) out.push_back(static_cast<char>((value >> (i * 8)) & 0xFF));
+}
+
+static void putString(std::string& out, const std::string& value) {
+    putUint(out, value.size(), 4);
+    out += value;
+}
 
-ObjectPtr foldConstExpr(Node* node, bool* ok) {
-    *ok = false;
+std::string serializeBytecode(const Bytecode& bc) {
+    std::string out = BytecodeMagic;
+    putUint(out, bc.formatVersion, 2);
+    putUint(out, bc.features, 4);
+    putString(out, bc.version);
+    putString(out, std::string(bc.instructions.begin(), bc.instructions.end()));
+
+    putUint(out, bc.constants.size(), 4);
+    for (const auto& c : bc.constants) {
+        if (auto i = std::dynamic_pointer_cast<Integer>(c)) {
+            out.push_back(TagInteger);
+            putUint(out, static_cast<uint64_t>(i->value), 8);
+        } else if (auto f = std::dynamic_pointer_cast<Float>(c)) {
+            uint64_t bits;
+            std::memcpy(&bits, &f->value, sizeof(bits));
+            out.push_back(TagFloat);
+            putUint(out, bits, 8);
+        } else if (auto str = std::dynamic_pointer_cast<String>(c)) {
+            out.push_back(TagString);
+            putString(out, str->value);
+        } else if (auto b = std::dynamic_pointer_cast<Boolean>(c)) {
+            out.push_back(TagBoolean);
+            out.push_back(b->value ? 1 : 0);
+        } else if (auto builtin = std::dynamic_pointer_cast<Builtin>(c)) {
+            out.push_back(TagBuiltin);
+            putString(out, builtin->name);
+        } else if (auto fn = std::dynamic_pointer_cast<CompiledFunction>(c)) {
+            out.push_back(TagFunction);
+            putString(out, fn->name);
+            putString(out, fn->source);
+            putUint(out, static_cast<uint32_t>(fn->numLocals), 4);
+            putUint(out, static_cast<uint32_t>(fn->numParameters), 4);
+            putString(out, std::string(fn->instructions.begin(), fn->instructions.end()));
+        } else {
+            out.push_back(TagNull);
+        }
+    }
 
-    if (auto intLit = dynamic_cast<IntegerLiteral*>(node)) { *ok = true; return newInteger(intLit->value); }
-    if (auto floatLit = dynamic_cast<FloatLiteral*>(node)) { *ok = true; return newFloat(floatLit->value); }
-    if (auto strLit = dynamic_cast<StringLiteral*>(node)) { *ok = true; return newString(strLit->value); }
-    if (auto boolLit = dynamic_cast<BooleanLiteral*>(node)) { *ok = true; return newBoolean(boolLit->value); }
+    putUint(out, bc.debug.entries.size(), 4);
+    for (const auto& e : bc.debug.entries) {
+        putUint(out, static_cast<uint32_t>(e.pc), 4);
+        putString(out, e.file);
+        putUint(out, static_cast<uint32_t>(e.line), 4);
+        putUint(out, static_cast<uint32_t>(e.column), 4);
+        putString(out, e.function);
+    }
+    if (bc.features & FeatureGlobalNames) {
+        putUint(out, bc.debug.globals.size(), 4);
+        for (const auto& name : bc.debug.globals) putString(out, name);
+    }
+    return out;
+}
 
-    if (auto prefix = dynamic_cast<PrefixExpression*>(node)) {
-        bool rightOk = false;
-        auto right = foldConstExpr(prefix->right.get(), &rightOk);
-        if (!rightOk) return nullptr;
-        if (prefix->op == "-") {
-            if (auto i = std::dynamic_pointer_cast<Integer>(right)) { *ok = true; return newInteger(-i->value); }
-            if (auto f = std::dynamic_pointer_cast<Float>(right)) { *ok = true; return newFloat(-f->value); }
+namespace {
+
+struct ByteReader {
+    const std::string& data;
+    size_t pos = 0;
+
+    uint64_t readUint(int bytes) {
+        if (pos + bytes > data.size()) throw std::runtime_error("truncated bytecode file");
+        uint64_t value = 0;
+        for (int i = 0; i < bytes; i++) value = (value << 8) | static_cast<uint8_t>(data[pos++]);
+        return value;
+    }
+
+    std::string readString() {
+        auto len = readUint(4);
+        if (len > data.size() - pos) throw std::runtime_error("truncated bytecode file");
+        auto value = data.substr(pos, len);
+        pos += len;
+        return value;
+    }
+};
+
+} // namespace
+
+// Migrates bytecode written in an older format to the current one, one format
+// version at a time. Each bump of BytecodeFormatVersion adds a case here.
+static bool upgradeBytecode(Bytecode& bc, std::string* error) {
+    while (bc.formatVersion < BytecodeFormatVersion) {
+        switch (bc.formatVersion) {
+            default:
+                *error = "no migration from bytecode format v" + std::to_string(bc.formatVersion);
+                return false;
         }
-        if (prefix->op == "!") {
-            if (auto b = std::dynamic_pointer_cast<Boolean>(right)) { *ok = true; return newBoolean(!b->value); }
+    }
+    return true;
+}
+
+// Every opcode must be known to this runtime, otherwise the instruction
+// stream cannot even be decoded.
+static bool checkOpcodes(const Instructions& ins, std::string* error) {
+    for (size_t i = 0; i < ins.size();) {
+        const Definition* def = Lookup(static_cast<Opcode>(ins[i]));
+        if (!def) {
+            *error = "bytecode uses opcode " + std::to_string(ins[i]) + " unknown to this runtime (DariX " +
+                     DARIX_VERSION + ")";
+            return false;
         }
+        i++;
+        for (int w : def->operandWidths) i += w;
+    }
+    return true;
+}
+
+bool isBytecodeFile(const std::string& data) {
+    return data.compare(0, std::strlen(BytecodeMagic), BytecodeMagic) == 0;
+}
+
+std::shared_ptr<Bytecode> loadBytecode(const std::string& data, std::string* error) {
+    if (!isBytecodeFile(data)) {
+        *error = "not a DariX bytecode file";
         return nullptr;
     }
+    auto bc = std::make_shared<Bytecode>();
+    bc->magic = BytecodeMagic;
+    try {
+        ByteReader r{data, std::strlen(BytecodeMagic)};
+        bc->formatVersion = static_cast<uint16_t>(r.readUint(2));
+        bc->features = static_cast<uint32_t>(r.readUint(4));
+        bc->version = r.readString();
+
+        if (bc->formatVersion > BytecodeFormatVersion) {
+            *error = "bytecode format v" + std::to_string(bc->formatVersion) + " was produced by DariX " +
+                     bc->version + " and is newer than this runtime supports (v" +
+                     std::to_string(BytecodeFormatVersion) + ", DariX " + DARIX_VERSION + "); recompile the source";
+            return nullptr;
+        }
+        if (bc->formatVersion < MinBytecodeFormatVersion) {
+            *error = "bytecode format v" + std::to_string(bc->formatVersion) + " is no longer supported; recompile the source";
+            return nullptr;
+        }
+        if (uint32_t unknown = bc->features & ~SupportedBytecodeFeatures) {
+            *error = "bytecode requires compiler features unknown to this runtime (" + describeFeatures(unknown) + ")";
+            return nullptr;
+        }
 
-    if (auto infix = dynamic_cast<InfixExpression*>(node)) {
-        bool leftOk = false, rightOk = false;
-        auto left = foldConstExpr(infix->left.get(), &leftOk);
-        auto right = foldConstExpr(infix->right.get(), &rightOk);
-        if (!leftOk || !rightOk) return nullptr;
-
-        const auto& op = infix->op;
-
-        if (op == "+" || op == "-" || op == "*" || op == "/") {
-            if (auto l = std::dynamic_pointer_cast<Integer>(left)) {
-                if (auto r = std::dynamic_pointer_cast<Integer>(right)) {
-                    *ok = true;
-                    if (op == "+") return newInteger(l->value + r->value);
-                    if (op == "-") return newInteger(l->value - r->value);
-                    if (op == "*") return newInteger(l->value * r->value);
-                    if (op == "/" && r->value != 0) return newInteger(l->value / r->value);
-                }
-                if (auto r = std::dynamic_pointer_cast<Float>(right)) {
-                    *ok = true;
-                    if (op == "+") return newFloat(l->value + r->value);
-                    if (op == "-") return newFloat(l->value - r->value);
-                    if (op == "*") return newFloat(l->value * r->value);
-                    if (op == "/" && r->value != 0) return newFloat(l->value / r->value);
+        auto ins = r.readString();
+        bc->instructions.assign(ins.begin(), ins.end());
+
+        auto numConstants = r.readUint(4);
+        for (uint64_t i = 0; i < numConstants; i++) {
+            switch (r.readUint(1)) {
+                case TagNull: bc->constants.push_back(getNull()); break;
+                case TagInteger: bc->constants.push_back(newInteger(static_cast<int64_t>(r.readUint(8)))); break;
+                case TagFloat: {
+                    uint64_t bits = r.readUint(8);
+                    double value;
+                    std::memcpy(&value, &bits, sizeof(value));
+                    bc->constants.push_back(newFloat(value));
+                    break;
                 }
-            }
-            if (auto l = std::dynamic_pointer_cast<Float>(left)) {
-                if (auto r = std::dynamic_pointer_cast<Integer>(right)) {
-                    *ok = true;
-                    if (op == "+") return newFloat(l->value + r->value);
-                    if (op == "-") return newFloat(l->value - r->value);
-                    if (op == "*") return newFloat(l->value * r->value);
-                    if (op == "/" && r->value != 0) return newFloat(l->value / r->value);
-                }
-                if (auto r = std::dynamic_pointer_cast<Float>(right)) {
-                    *ok = true;
-                    if (op == "+") return newFloat(l->value + r->value);
-                    if (op == "-") return newFloat(l->value - r->value);
-                    if (op == "*") return newFloat(l->value * r->value);
-                    if (op == "/" && r->value != 0) return newFloat(l->value / r->value);
+                case TagString: bc->constants.push_back(newString(r.readString())); break;
+                case TagBoolean: bc->constants.push_back(newBoolean(r.readUint(1) != 0)); break;
+                case TagBuiltin: {
+                    // Bound to the runtime's builtin by linkBuiltins.
+                    auto builtin = std::make_shared<Builtin>();
+                    builtin->name = r.readString();
+                    bc->constants.push_back(builtin);
+                    break;
                 }
-            }
-            if (op == "+") {
-                if (auto l = std::dynamic_pointer_cast<String>(left)) {
-                    if (auto r = std::dynamic_pointer_cast<String>(right)) {
-                        *ok = true;
-                        return newString(l->value + r->value);
-                    }
+                case TagFunction: {
+                    auto fn = std::make_shared<CompiledFunction>();
+                    fn->name = r.readString();
+                    fn->source = r.readString();
+                    fn->numLocals = static_cast<int>(r.readUint(4));
+                    fn->numParameters = static_cast<int>(r.readUint(4));
+                    auto code = r.readString();
+                    fn->instructions.assign(code.begin(), code.end());
+                    bc->constants.push_back(fn);
+                    break;
                 }
+                default: throw std::runtime_error("invalid constant in bytecode file");
             }
         }
 
-        if (op == "==") {
-            if (auto l = std::dynamic_pointer_cast<Integer>(left)) {
-                if (auto r = std::dynamic_pointer_cast<Integer>(right)) { *ok = true; return newBoolean(l->value == r->value); }
-                if (auto r = std::dynamic_pointer_cast<Float>(right)) { *ok = true; return newBoolean(l->value == r->value); }
-            }
-            if (auto l = std::dynamic_pointer_cast<Float>(left)) {
-                if (auto r = std::dynamic_pointer_cast<Integer>(right)) { *ok = true; return newBoolean(l->value == r->value); }
-                if (auto r = std::dynamic_pointer_cast<Float>(right)) { *ok = true; return newBoolean(l->value == r->value); }
-            }
-            if (auto l = std::dynamic_pointer_cast<String>(left)) {
-                if (auto r = std::dynamic_pointer_cast<String>(right)) { *ok = true; return newBoolean(l->value == r->value); }
-            }
-            if (auto l = std::dynamic_pointer_cast<Boolean>(left)) {
-                if (auto r = std::dynamic_pointer_cast<Boolean>(right)) { *ok = true; return newBoolean(l->value == r->value); }
-            }
+        auto numEntries = r.readUint(4);
+        for (uint64_t i = 0; i < numEntries; i++) {
+            DebugEntry e;
+            e.pc = static_cast<int>(r.readUint(4));
+            e.file = r.readString();
+            e.line = static_cast<int>(r.readUint(4));
+            e.column = static_cast<int>(r.readUint(4));
+            e.function = r.readString();
+            bc->debug.entries.push_back(e);
         }
-        if (op == "!=") {
-            if (auto l = std::dynamic_pointer_cast<Integer>(left)) {
-                if (auto r = std::dynamic_pointer_cast<Integer>(right)) { *ok = true; return newBoolean(l->value != r->value); }
-            }
-            if (auto l = std::dynamic_pointer_cast<String>(left)) {
-                if (auto r = std::dynamic_pointer_cast<String>(right)) { *ok = true; return newBoolean(l->value != r->value); }
-            }
+        if (bc->features & FeatureGlobalNames) {
+            auto numGlobals = r.readUint(4);
+            for (uint64_t i = 0; i < numGlobals; i++) bc->debug.globals.push_back(r.readString());
         }
-        if (op == ">" || op == "<") {
-            if (auto l = std::dynamic_pointer_cast<Integer>(left)) {
-                if (auto r = std::dynamic_pointer_cast<Integer>(right)) {
-                    *ok = true;
-                    return newBoolean(op == ">" ? l->value > r->value : l->value < r->value);
-                }
-            }
+    } catch (const std::runtime_error& e) {
+        *error = e.what();
+        return nullptr;
+    }
+
+    if (!upgradeBytecode(*bc, error) || !checkOpcodes(bc->instructions, error)) return nullptr;
+    for (auto& c : bc->constants) {
+        auto fn = std::dynamic_pointer_cast<CompiledFunction>(c);
+        if (fn && !checkOpcodes(fn->instructions, error)) return nullptr;
+    }
+    return bc;
+}
+
+bool linkBuiltins(Bytecode& bc, const BuiltinResolver& resolve, std::string* error) {
+    for (auto& c : bc.constants) {
+        auto builtin = std::dynamic_pointer_cast<Builtin>(c);
+        if (!builtin || builtin->fn) continue;
+        std::string why;
+        auto linked = resolve ? resolve(builtin->name, &why) : nullptr;
+        if (!linked && !why.empty()) {
+            *error = "bytecode uses builtin '" + builtin->name + "', which " + why;
+            return false;
         }
+        if (!linked) {
+            *error = "bytecode uses builtin '" + builtin->name + "' unknown to this runtime (DariX " + DARIX_VERSION + ")";
+            return false;
+        }
+        c = linked;
+    }
+    return true;
+}
+
+std::string describeFeatures(uint32_t features) {
+    std::string out;
+    auto add = [&](const std::string& name) { out += (out.empty() ? "" : ", ") + name; };
+    if (features & FeatureDebugInfo) add("debug-info");
+    if (features & FeaturePeephole) add("peephole");
+    if (features & FeatureGlobalNames) add("global-names");
+    if (features & FeatureFunctions) add("functions");
+    for (int bit = 0; bit < 32; bit++) {
+        uint32_t mask = 1u << bit;
+        if ((features & mask) && !(SupportedBytecodeFeatures & mask)) add("bit " + std::to_string(bit));
     }
+    return out.empty() ? "none" : out;
+}
 
-    return nullptr;
+std::string describeConstantPool(const std::vector<ObjectPtr>& constants) {
+    size_t ints = 0, floats = 0, strings = 0, functions = 0, builtins = 0, other = 0, textBytes = 0;
+    for (auto& c : constants) {
+        if (c->type() == ObjectType::INTEGER) ints++;
+        else if (c->type() == ObjectType::FLOAT) floats++;
+        else if (auto s = std::dynamic_pointer_cast<String>(c)) strings++, textBytes += s->value.size();
+        else if (c->type() == ObjectType::COMPILED_FUNCTION) functions++;
+        else if (c->type() == ObjectType::BUILTIN) builtins++;
+        else other++;
+    }
+    auto count = [](size_t n, const char* one, const char* many) {
+        return std::to_string(n) + " " + (n == 1 ? one : many);
+    };
+    std::string out = std::to_string(constants.size());
+    if (constants.empty()) return out;
+    std::string kinds;
+    auto add = [&](size_t n, const char* one, const char* many) {
+        if (n) kinds += (kinds.empty() ? "" : ", ") + count(n, one, many);
+    };
+    add(ints, "integer", "integers");
+    add(floats, "float", "floats");
+    add(strings, "string", "strings");
+    add(functions, "function", "functions");
+    add(builtins, "builtin", "builtins");
+    add(other, "other", "other");
+    return out + " (" + kinds + "; " + count(textBytes, "byte", "bytes") + " of string data)";
+}
+
+std::vector<std::string> globalNames(const SymbolTable& symbols) {
+    std::vector<std::string> names(symbols.numDefinitions());
+    for (const auto& [name, sym] : symbols.symbols()) {
+        if (sym.scope == SymbolScope::GLOBAL && sym.index >= 0 && sym.index < static_cast<int>(names.size())) names[sym.index] = name;
+    }
+    return names;
 }
 
 // ============ Peephole optimizer ============
@@ -451,6 +851,21 @@ Instructions peephole(const Instructions& ins) {
     Instructions out(ins.size());
     std::copy(ins.begin(), ins.end(), out.begin());
 
+    // Jump targets, which a dropped push and pop must not straddle.
+    std::vector<bool> target(ins.size() + 1, false);
+    for (const auto& in : Decode(ins)) {
+        bool jumps = in.op == Opcode::OpJump || in.op == Opcode::OpJumpNotTruthy || in.op == Opcode::OpIterNext;
+        if (in.def && jumps && in.operands[0] <= static_cast<int>(ins.size())) target[in.operands[0]] = true;
+    }
+    // A constant or null pushed only to be popped is dropped, unless the pop
+    // ends the program: the last popped value is the REPL's result.
+    auto dropPushPop = [&](size_t i, size_t width) {
+        size_t pop = i + width;
+        if (pop + 1 >= out.size() || static_cast<Opcode>(out[pop]) != Opcode::OpPop || target[pop]) return false;
+        std::fill(out.begin() + i, out.begin() + pop + 1, static_cast<uint8_t>(Opcode::OpNop));
+        return true;
+    };
+
     for (size_t i = 0; i < out.size();) {
         Opcode op = static_cast<Opcode>(out[i]);
         switch (op) {
@@ -475,15 +890,12 @@ Instructions peephole(const Instructions& ins) {
                 i += 3;
                 break;
             }
-            case Opcode::OpConstant: {
-                if (i + 3 < out.size() && static_cast<Opcode>(out[i+3]) == Opcode::OpPop) {
-                    out[i] = out[i+1] = out[i+2] = out[i+3] = static_cast<uint8_t>(Opcode::OpNop);
-                    i += 4;
-                    continue;
-                }
-                i += 3;
+            case Opcode::OpConstant:
+                i += dropPushPop(i, 3) ? 4 : 3;
+                break;
+            case Opcode::OpNull:
+                i += dropPushPop(i, 1) ? 2 : 1;
                 break;
-            }
             default: {
                 auto def = Lookup(op);
                 if (!def) { i++; continue; }
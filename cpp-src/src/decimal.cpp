@@ -0,0 +1,221 @@
+#include "darix/decimal.hpp"
+#include <algorithm>
+#include <cctype>
+#include <cstdlib>
+
+namespace darix {
+
+static const int64_t Pow10[DecimalMaxScale + 1] = {
+    1LL, 10LL, 100LL, 1000LL, 10000LL, 100000LL, 1000000LL, 10000000LL, 100000000LL, 1000000000LL,
+    10000000000LL, 100000000000LL, 1000000000000LL, 10000000000000LL, 100000000000000LL,
+    1000000000000000LL, 10000000000000000LL, 100000000000000000LL, 1000000000000000000LL,
+};
+
+static ObjectPtr raise(const char* type, const std::string& message) {
+    return newExceptionSignal(std::dynamic_pointer_cast<Exception>(newException(type, message)));
+}
+
+// units * 10^by; false if that does not fit.
+static bool scaleUp(int64_t units, int by, int64_t* out) {
+    if (by > DecimalMaxScale) {
+        *out = 0;
+        return units == 0;
+    }
+    return !wrappingMul(units, Pow10[by], *out);
+}
+
+// units / 10^by rounded half to even.
+static int64_t scaleDown(int64_t units, int by) {
+    int64_t d = Pow10[by];
+    int64_t q = units / d, r = units % d;
+    int64_t twice = 2 * (r < 0 ? -r : r);
+    if (twice > d || (twice == d && q % 2 != 0)) q += units < 0 ? -1 : 1;
+    return q;
+}
+
+bool parseDecimal(const std::string& text, int64_t* units, int* scale) {
+    size_t i = 0;
+    bool negative = false;
+    if (i < text.size() && (text[i] == '+' || text[i] == '-')) negative = text[i++] == '-';
+    uint64_t magnitude = 0;
+    int digits = 0, places = 0;
+    bool point = false;
+    for (; i < text.size(); i++) {
+        char c = text[i];
+        if (c == '.' && !point) {
+            point = true;
+            continue;
+        }
+        if (!std::isdigit(static_cast<unsigned char>(c))) break;
+        uint64_t digit = static_cast<uint64_t>(c - '0');
+        if (magnitude > (static_cast<uint64_t>(INT64_MAX) - digit) / 10) return false;
+        magnitude = magnitude * 10 + digit;
+        digits++;
+        if (point) places++;
+    }
+    if (digits == 0) return false;
+    int exponent = 0;
+    if (i < text.size() && (text[i] == 'e' || text[i] == 'E')) {
+        char* end = nullptr;
+        long e = std::strtol(text.c_str() + i + 1, &end, 10);
+        if (end == text.c_str() + i + 1 || e < -100 || e > 100) return false;
+        exponent = static_cast<int>(e);
+        i = static_cast<size_t>(end - text.c_str());
+    }
+    if (i != text.size()) return false;
+    int64_t value = negative ? -static_cast<int64_t>(magnitude) : static_cast<int64_t>(magnitude);
+    int s = places - exponent;
+    if (s < 0) {
+        if (!scaleUp(value, -s, &value)) return false;
+        s = 0;
+    }
+    if (s > DecimalMaxScale) return false;
+    *units = value;
+    *scale = s;
+    return true;
+}
+
+std::string formatDecimal(int64_t units, int scale) {
+    uint64_t magnitude = units < 0 ? 0 - static_cast<uint64_t>(units) : static_cast<uint64_t>(units);
+    std::string out = units < 0 ? "-" : "";
+    out += std::to_string(magnitude / static_cast<uint64_t>(Pow10[scale]));
+    if (scale > 0) {
+        std::string frac = std::to_string(magnitude % static_cast<uint64_t>(Pow10[scale]));
+        out += "." + std::string(scale - frac.size(), '0') + frac;
+    }
+    return out;
+}
+
+double decimalToDouble(const Decimal& d) { return std::strtod(formatDecimal(d.units, d.scale).c_str(), nullptr); }
+
+ObjectPtr toDecimal(const ObjectPtr& value) {
+    if (value->type() == ObjectType::DECIMAL) return value;
+    if (auto i = std::dynamic_pointer_cast<Integer>(value)) return newDecimal(i->value, 0);
+    std::string text;
+    if (auto s = std::dynamic_pointer_cast<String>(value)) text = s->value;
+    else if (auto f = std::dynamic_pointer_cast<Float>(value)) text = formatFloat(f->value);
+    else return raise(TYPE_ERROR, std::string("cannot convert ") + ObjectTypeToString(value->type()) + " to decimal");
+    int64_t units;
+    int scale;
+    if (!parseDecimal(text, &units, &scale)) return raise(VALUE_ERROR, "invalid or out-of-range decimal '" + text + "'");
+    return newDecimal(units, scale);
+}
+
+ObjectPtr rescaleDecimal(const Decimal& d, int places) {
+    if (places <= d.scale) return newDecimal(scaleDown(d.units, d.scale - places), places);
+    int64_t units;
+    if (!scaleUp(d.units, places - d.scale, &units)) return raise(OVERFLOW_ERROR, "decimal overflow in rescale");
+    return newDecimal(units, places);
+}
+
+// Both operands as units at their own scale.
+static void operand(const ObjectPtr& value, int64_t* units, int* scale) {
+    if (auto d = std::dynamic_pointer_cast<Decimal>(value)) {
+        *units = d->units;
+        *scale = d->scale;
+    } else {
+        *units = std::static_pointer_cast<Integer>(value)->value;
+        *scale = 0;
+    }
+}
+
+// rem * 10 / b for rem < b, leaving the remainder in rem, without
+// overflowing: rem is added ten times, reducing modulo b as it goes.
+static int nextDigit(uint64_t& rem, uint64_t b) {
+    int digit = 0;
+    uint64_t acc = 0;
+    for (int i = 0; i < 10; i++) {
+        acc += rem;
+        if (acc >= b) {
+            acc -= b;
+            digit++;
+        }
+    }
+    rem = acc;
+    return digit;
+}
+
+// (lu / 10^ls) / (ru / 10^rs) by long division on the magnitudes: digits are
+// taken until the quotient is exact, reaches DecimalMaxScale places or the
+// next digit would not fit, then the last one is rounded half to even.
+static ObjectPtr divide(int64_t lu, int ls, int64_t ru, int rs) {
+    bool negative = (lu < 0) != (ru < 0);
+    uint64_t a = lu < 0 ? 0 - static_cast<uint64_t>(lu) : static_cast<uint64_t>(lu);
+    uint64_t b = ru < 0 ? 0 - static_cast<uint64_t>(ru) : static_cast<uint64_t>(ru);
+    const uint64_t limit = static_cast<uint64_t>(INT64_MAX);
+    uint64_t q = a / b, rem = a % b;
+    if (q > limit) return raise(OVERFLOW_ERROR, "decimal overflow in '/'");
+    // The quotient digits so far stand for q / 10^(taken + rs - ls).
+    int taken = 0;
+    int minScale = std::max(ls, rs);
+    auto scale = [&] { return taken + ls - rs; };
+    while (scale() < minScale || (rem != 0 && scale() < DecimalMaxScale)) {
+        uint64_t probe = rem;
+        int digit = nextDigit(probe, b);
+        if (q > (limit - static_cast<uint64_t>(digit)) / 10) {
+            if (scale() >= 0) break;
+            return raise(OVERFLOW_ERROR, "decimal overflow in '/'");
+        }
+        q = q * 10 + static_cast<uint64_t>(digit);
+        rem = probe;
+        taken++;
+    }
+    if (rem != 0) {
+        int digit = nextDigit(rem, b);
+        if (digit > 5 || (digit == 5 && (rem != 0 || q % 2 != 0))) {
+            if (q == limit) return raise(OVERFLOW_ERROR, "decimal overflow in '/'");
+            q++;
+        }
+    }
+    int64_t units = static_cast<int64_t>(q);
+    return newDecimal(negative ? -units : units, scale());
+}
+
+ObjectPtr decimalArithmetic(const std::string& op, const ObjectPtr& left, const ObjectPtr& right) {
+    int64_t lu, ru;
+    int ls, rs;
+    operand(left, &lu, &ls);
+    operand(right, &ru, &rs);
+    auto overflow = [&op] { return raise(OVERFLOW_ERROR, "decimal overflow in '" + op + "'"); };
+    if (op == "*") {
+        int64_t units;
+        if (wrappingMul(lu, ru, units)) return overflow();
+        int scale = ls + rs;
+        if (scale > DecimalMaxScale) {
+            units = scaleDown(units, scale - DecimalMaxScale);
+            scale = DecimalMaxScale;
+        }
+        return newDecimal(units, scale);
+    }
+    if (op == "/") {
+        if (ru == 0) return raise(ZERO_DIV_ERROR, "decimal division by zero");
+        return divide(lu, ls, ru, rs);
+    }
+    if (op != "+" && op != "-" && op != "%") return nullptr;
+    int scale = std::max(ls, rs);
+    if (!scaleUp(lu, scale - ls, &lu) || !scaleUp(ru, scale - rs, &ru)) return overflow();
+    int64_t units;
+    if (op == "%") {
+        if (ru == 0) return raise(ZERO_DIV_ERROR, "decimal modulo by zero");
+        return newDecimal(ru == -1 ? 0 : lu % ru, scale);
+    }
+    if (op == "+" ? wrappingAdd(lu, ru, units) : wrappingSub(lu, ru, units)) return overflow();
+    return newDecimal(units, scale);
+}
+
+int compareDecimals(const ObjectPtr& left, const ObjectPtr& right) {
+    int64_t lu, ru;
+    int ls, rs;
+    operand(left, &lu, &ls);
+    operand(right, &ru, &rs);
+    // Whole parts first, then the fractions at a common scale, which always
+    // fits since a fraction is below 10^scale.
+    int64_t lw = lu / Pow10[ls], rw = ru / Pow10[rs];
+    if (lw != rw) return lw < rw ? -1 : 1;
+    int scale = std::max(ls, rs);
+    int64_t lf = (lu % Pow10[ls]) * Pow10[scale - ls];
+    int64_t rf = (ru % Pow10[rs]) * Pow10[scale - rs];
+    return (lf > rf) - (lf < rf);
+}
+
+} // namespace darix
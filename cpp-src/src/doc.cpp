@@ -0,0 +1,287 @@
+#include "darix/doc.hpp"
+#include "darix/lexer.hpp"
+#include "darix/native/native.hpp"
+#include "darix/parser.hpp"
+#include <algorithm>
+#include <climits>
+#include <sstream>
+
+namespace darix {
+
+static bool isPrivate(const std::string& name) {
+    bool dunder = name.size() > 4 && name.compare(0, 2, "__") == 0 && name.compare(name.size() - 2, 2, "__") == 0;
+    return !name.empty() && name[0] == '_' && !dunder;
+}
+
+static std::string trim(const std::string& s) {
+    auto start = s.find_first_not_of(" \t\r");
+    if (start == std::string::npos) return "";
+    return s.substr(start, s.find_last_not_of(" \t\r") - start + 1);
+}
+
+// Drops leading and trailing blank lines and the indentation shared by the
+// remaining ones, so docstrings can be indented with the code around them.
+static std::string cleanDoc(const std::string& text) {
+    std::vector<std::string> lines;
+    std::istringstream in(text);
+    std::string line;
+    while (std::getline(in, line)) lines.push_back(line);
+    while (!lines.empty() && trim(lines.front()).empty()) lines.erase(lines.begin());
+    while (!lines.empty() && trim(lines.back()).empty()) lines.pop_back();
+    size_t indent = std::string::npos;
+    for (auto& l : lines) {
+        if (!trim(l).empty()) indent = std::min(indent, l.find_first_not_of(" \t"));
+    }
+    std::string out;
+    for (auto& l : lines) {
+        if (!out.empty()) out += "\n";
+        if (!trim(l).empty()) out += l.substr(indent);
+        out.erase(out.find_last_not_of(" \t\r") + 1);
+    }
+    return out;
+}
+
+// Source split into lines, with each line's starting offset.
+struct SourceLines {
+    std::vector<std::string> text;
+    std::vector<int> start;
+
+    explicit SourceLines(const std::string& src) {
+        size_t pos = 0;
+        while (pos <= src.size()) {
+            auto eol = src.find('\n', pos);
+            if (eol == std::string::npos) eol = src.size();
+            text.push_back(src.substr(pos, eol - pos));
+            start.push_back(static_cast<int>(pos));
+            pos = eol + 1;
+        }
+    }
+
+    int lineAt(int offset) const {
+        return static_cast<int>(std::upper_bound(start.begin(), start.end(), offset) - start.begin()) - 1;
+    }
+
+    static bool isComment(const std::string& line) {
+        auto t = trim(line);
+        return t.compare(0, 2, "//") == 0 && t.compare(0, 9, "// darix:") != 0;
+    }
+
+    // The // comment lines ending on line last, with their markers removed.
+    std::string commentEndingAt(int last) const {
+        int first = last + 1;
+        while (first > 0 && isComment(text[first - 1])) first--;
+        std::string out;
+        for (int i = first; i <= last; i++) {
+            auto t = trim(text[i]).substr(2);
+            out += (t.compare(0, 1, " ") == 0 ? t.substr(1) : t) + "\n";
+        }
+        return cleanDoc(out);
+    }
+
+    // The comment block directly above the statement starting at offset.
+    std::string commentAbove(int offset) const {
+        int line = lineAt(offset);
+        if (!trim(text[line].substr(0, offset - start[line])).empty()) return "";
+        return commentEndingAt(line - 1);
+    }
+};
+
+static std::string docstring(const BlockStatementPtr& body) {
+    if (!body || body->statements.empty()) return "";
+    auto es = std::dynamic_pointer_cast<ExpressionStatement>(body->statements[0]);
+    auto str = es ? std::dynamic_pointer_cast<StringLiteral>(es->expression) : nullptr;
+    return str ? cleanDoc(str->value) : "";
+}
+
+static std::string signature(const std::string& name, const std::vector<IdentifierPtr>& params) {
+    std::string out = name + "(";
+    for (size_t i = 0; i < params.size(); i++) out += (i ? ", " : "") + params[i]->value;
+    return out + ")";
+}
+
+static std::string decorators(const std::vector<ExpressionPtr>& decos) {
+    std::string out;
+    for (auto& d : decos) out += "@" + d->inspect() + "\n";
+    return out;
+}
+
+static DocEntry documentFunction(FunctionDeclaration* fd, DocEntry::Kind kind, const SourceLines& lines) {
+    DocEntry e;
+    e.kind = kind;
+    e.name = fd->name->value;
+    e.signature = decorators(fd->decorators) + signature(e.name, fd->parameters);
+    e.doc = docstring(fd->body);
+    if (e.doc.empty()) e.doc = lines.commentAbove(fd->span.start);
+    e.line = fd->token.line;
+    return e;
+}
+
+static DocEntry documentClass(ClassDeclaration* cd, const SourceLines& lines) {
+    DocEntry e;
+    e.kind = DocEntry::Kind::Class;
+    e.name = cd->name->value;
+    e.signature = decorators(cd->decorators) + "class " + e.name;
+    e.doc = docstring(cd->body);
+    if (e.doc.empty()) e.doc = lines.commentAbove(cd->span.start);
+    e.line = cd->token.line;
+    for (auto& stmt : cd->body->statements) {
+        auto fd = std::dynamic_pointer_cast<FunctionDeclaration>(stmt);
+        if (!fd || isPrivate(fd->name->value)) continue;
+        // The constructor gives the class its call signature.
+        if (fd->name->value == "__init__") {
+            e.signature = decorators(cd->decorators) + signature("class " + e.name, fd->parameters);
+            continue;
+        }
+        e.members.push_back(documentFunction(fd.get(), DocEntry::Kind::Method, lines));
+    }
+    return e;
+}
+
+static std::string moduleName(const std::string& filename) {
+    auto slash = filename.find_last_of("/\\");
+    auto base = slash == std::string::npos ? filename : filename.substr(slash + 1);
+    auto dot = base.find_last_of('.');
+    return dot == std::string::npos || dot == 0 ? base : base.substr(0, dot);
+}
+
+bool documentSource(const std::string& source, const std::string& filename, DocModule* out, std::vector<std::string>* errors) {
+    Lexer lexer(source, filename);
+    Parser parser(lexer);
+    auto program = parser.parseProgram();
+    if (!parser.errors().empty()) {
+        *errors = parser.errors();
+        return false;
+    }
+    SourceLines lines(source);
+    out->name = moduleName(filename);
+    out->source = filename;
+    out->entries.clear();
+
+    // The module doc is a leading docstring, or a comment block at the top of
+    // the file that a blank line separates from the first statement.
+    auto& stmts = program->statements;
+    if (!stmts.empty()) {
+        auto es = std::dynamic_pointer_cast<ExpressionStatement>(stmts[0]);
+        auto str = es ? std::dynamic_pointer_cast<StringLiteral>(es->expression) : nullptr;
+        if (str) out->doc = cleanDoc(str->value);
+    }
+    if (out->doc.empty()) {
+        int first = 0;
+        while (first < static_cast<int>(lines.text.size()) && trim(lines.text[first]).empty()) first++;
+        int last = first;
+        while (last < static_cast<int>(lines.text.size()) && SourceLines::isComment(lines.text[last])) last++;
+        int firstStmt = stmts.empty() ? INT_MAX : lines.lineAt(stmts[0]->span.start);
+        if (last > first && last < firstStmt) out->doc = lines.commentEndingAt(last - 1);
+    }
+
+    for (auto& stmt : stmts) {
+        if (auto fd = std::dynamic_pointer_cast<FunctionDeclaration>(stmt)) {
+            if (!isPrivate(fd->name->value)) out->entries.push_back(documentFunction(fd.get(), DocEntry::Kind::Function, lines));
+        } else if (auto cd = std::dynamic_pointer_cast<ClassDeclaration>(stmt)) {
+            if (!isPrivate(cd->name->value)) out->entries.push_back(documentClass(cd.get(), lines));
+        }
+    }
+    return true;
+}
+
+bool documentNativeModule(const std::string& name, DocModule* out) {
+    auto& registry = native::Registry::instance();
+    registry.initAll();
+    auto* mod = registry.get(name);
+    if (!mod) return false;
+    out->name = name;
+    out->source = "native";
+    out->doc = mod->summary;
+    out->entries.clear();
+    for (auto& [fn, impl] : mod->functions) {
+        DocEntry e;
+        e.name = fn;
+        auto it = mod->docs.find(fn);
+        e.signature = name + "." + fn + (it != mod->docs.end() ? it->second.signature : "(...)");
+        if (it != mod->docs.end()) e.doc = it->second.summary;
+        out->entries.push_back(e);
+    }
+    std::sort(out->entries.begin(), out->entries.end(), [](const DocEntry& a, const DocEntry& b) { return a.name < b.name; });
+    return true;
+}
+
+// ============ Rendering ============
+
+static void markdownEntry(std::ostringstream& out, const DocEntry& e, const std::string& heading) {
+    out << heading << " " << (e.kind == DocEntry::Kind::Class ? "class " : "") << e.name << "\n\n";
+    out << "```dax\n" << e.signature << "\n```\n\n";
+    if (!e.doc.empty()) out << e.doc << "\n\n";
+    for (auto& m : e.members) markdownEntry(out, m, heading + "#");
+}
+
+std::string renderMarkdown(const std::vector<DocModule>& modules) {
+    std::ostringstream out;
+    for (auto& m : modules) {
+        out << "# " << m.name << "\n\n";
+        out << (m.source == "native" ? "Native module." : "Source: `" + m.source + "`") << "\n\n";
+        if (!m.doc.empty()) out << m.doc << "\n\n";
+        if (m.entries.empty()) out << "No public functions or classes.\n";
+        for (auto& e : m.entries) markdownEntry(out, e, "##");
+    }
+    return out.str();
+}
+
+static std::string escapeHtml(const std::string& s) {
+    std::string out;
+    for (char c : s) {
+        switch (c) {
+            case '&': out += "&amp;"; break;
+            case '<': out += "&lt;"; break;
+            case '>': out += "&gt;"; break;
+            case '"': out += "&quot;"; break;
+            default: out += c;
+        }
+    }
+    return out;
+}
+
+// Docs are plain text; blank lines separate paragraphs.
+static void htmlDoc(std::ostringstream& out, const std::string& doc) {
+    if (doc.empty()) return;
+    std::string para;
+    std::istringstream in(doc + "\n\n");
+    std::string line;
+    while (std::getline(in, line)) {
+        if (!trim(line).empty()) {
+            para += (para.empty() ? "" : "\n") + line;
+        } else if (!para.empty()) {
+            out << "<p>" << escapeHtml(para) << "</p>\n";
+            para.clear();
+        }
+    }
+}
+
+static void htmlEntry(std::ostringstream& out, const DocEntry& e, const std::string& prefix, int level) {
+    std::string id = prefix + "." + e.name;
+    out << "<h" << level << " id=\"" << escapeHtml(id) << "\">" << (e.kind == DocEntry::Kind::Class ? "class " : "")
+        << escapeHtml(e.name) << "</h" << level << ">\n";
+    out << "<pre><code>" << escapeHtml(e.signature) << "</code></pre>\n";
+    htmlDoc(out, e.doc);
+    for (auto& m : e.members) htmlEntry(out, m, id, level + 1);
+}
+
+std::string renderHtml(const std::vector<DocModule>& modules) {
+    std::ostringstream out;
+    out << "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>API documentation</title>\n</head>\n<body>\n";
+    out << "<nav>\n<ul>\n";
+    for (auto& m : modules) out << "<li><a href=\"#" << escapeHtml(m.name) << "\">" << escapeHtml(m.name) << "</a></li>\n";
+    out << "</ul>\n</nav>\n";
+    for (auto& m : modules) {
+        out << "<section>\n<h1 id=\"" << escapeHtml(m.name) << "\">" << escapeHtml(m.name) << "</h1>\n";
+        if (m.source == "native") out << "<p>Native module.</p>\n";
+        else out << "<p>Source: <code>" << escapeHtml(m.source) << "</code></p>\n";
+        htmlDoc(out, m.doc);
+        if (m.entries.empty()) out << "<p>No public functions or classes.</p>\n";
+        for (auto& e : m.entries) htmlEntry(out, e, m.name, 2);
+        out << "</section>\n";
+    }
+    out << "</body>\n</html>\n";
+    return out.str();
+}
+
+} // namespace darix
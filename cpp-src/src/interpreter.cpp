@@ -1,24 +1,85 @@
 #include "darix/interpreter.hpp"
+#include "darix/compiler.hpp"
+#include "darix/decimal.hpp"
+#include "darix/lang.hpp"
 #include "darix/lexer.hpp"
 #include "darix/parser.hpp"
+#include "darix/runner.hpp"
+#include "darix/stdlib.hpp"
 #include "darix/native/native.hpp"
+#include "darix/warnings.hpp"
 #include <algorithm>
 #include <cmath>
 #include <cstdio>
 #include <cstdlib>
+#include <atomic>
+#include <cctype>
+#include <chrono>
+#include <complex>
+#include <fstream>
+#include <iostream>
+#include <new>
+#include <numeric>
 #include <sstream>
+#include <thread>
+#include <unordered_set>
+
+#ifdef _WIN32
+#define environ _environ
+#else
+extern char** environ;
+#endif
 
 namespace darix {
 
 static ObjectPtr nativeBoolToBooleanObject(bool b) { return b ? getTrue() : getFalse(); }
 
+// Runs grow, which sizes a builtin's array storage for n elements, and returns
+// the ResourceError if that cannot be allocated: with no size limit set, a
+// script can ask for more than memory holds or a vector can index.
+template <typename Grow>
+static ObjectPtr allocateElements(const std::string& fn, uint64_t n, Grow grow) {
+    try {
+        grow();
+        return nullptr;
+    } catch (const std::length_error&) {
+    } catch (const std::bad_alloc&) {
+    }
+    return newExceptionSignal(std::dynamic_pointer_cast<Exception>(
+        newException(RESOURCE_ERROR, fn + ": cannot allocate " + std::to_string(n) + " elements")));
+}
+
 static int64_t asInt(ObjectPtr obj) {
     if (auto i = std::dynamic_pointer_cast<Integer>(obj)) return i->value;
     if (auto f = std::dynamic_pointer_cast<Float>(obj)) return static_cast<int64_t>(f->value);
     return 0;
 }
 
+static double asFloat(ObjectPtr obj) {
+    if (auto f = std::dynamic_pointer_cast<Float>(obj)) return f->value;
+    if (auto i = std::dynamic_pointer_cast<Integer>(obj)) return static_cast<double>(i->value);
+    return 0.0;
+}
+
+// Gives b a FunctionDoc signature and the argument range it allows.
+static void setSignature(Builtin& b, const std::string& signature) {
+    b.signature = signature;
+    native::signatureArity(signature, &b.minArgs, &b.maxArgs);
+}
+
+// Appends arr's elements to out, splicing in nested arrays up to depth levels.
+static void flattenInto(const Array& arr, int64_t depth, std::vector<ObjectPtr>& out) {
+    for (auto& elem : arr.elements) {
+        auto inner = std::dynamic_pointer_cast<Array>(elem);
+        if (inner && depth > 0) flattenInto(*inner, depth - 1, out);
+        else out.push_back(elem);
+    }
+}
+
 static int compareObjects(ObjectPtr a, ObjectPtr b) {
+    if ((a->type() == ObjectType::DECIMAL && (b->type() == ObjectType::DECIMAL || b->type() == ObjectType::INTEGER)) ||
+        (b->type() == ObjectType::DECIMAL && a->type() == ObjectType::INTEGER))
+        return compareDecimals(a, b);
     if (auto ai = std::dynamic_pointer_cast<Integer>(a)) {
         if (auto bi = std::dynamic_pointer_cast<Integer>(b))
             return (ai->value > bi->value) - (ai->value < bi->value);
@@ -41,19 +102,204 @@ static int compareObjects(ObjectPtr a, ObjectPtr b) {
     return 0;
 }
 
+// Deep-copies values handed to a parallel_map worker, or the globals of a
+// fork. Each environment is cloned once so closures that shared a scope still
+// share the copy.
+struct WorkerClone {
+    std::unordered_map<const Environment*, std::shared_ptr<Environment>> envs;
+    std::unordered_map<const Object*, ObjectPtr> objects;
+    // Forks also copy classes, whose methods close over the globals, and
+    // modules, whose scopes can hold state or reach the importing scope.
+    bool classes = false;
+
+    std::shared_ptr<Environment> env(const std::shared_ptr<Environment>& src) {
+        if (!src) return nullptr;
+        if (auto it = envs.find(src.get()); it != envs.end()) return it->second;
+        auto copy = std::make_shared<Environment>();
+        envs[src.get()] = copy;
+        copy->outer = env(src->outer);
+        copy->store.reserve(src->store.size());
+        for (auto& [k, v] : src->store) copy->store.emplace_back(k, value(v));
+        return copy;
+    }
+
+    ObjectPtr value(const ObjectPtr& src) {
+        if (!src) return src;
+        if (auto it = objects.find(src.get()); it != objects.end()) return it->second;
+        if (auto arr = std::dynamic_pointer_cast<Array>(src)) {
+            if (arr->frozen) return src;
+            auto copy = std::make_shared<Array>();
+            objects[src.get()] = copy;
+            for (auto& e : arr->elements) copy->elements.push_back(value(e));
+            return copy;
+        }
+        if (auto m = std::dynamic_pointer_cast<Map>(src)) {
+            if (m->frozen) return src;
+            auto copy = std::make_shared<Map>();
+            objects[src.get()] = copy;
+            for (auto& [k, v] : m->pairs) copy->pairs.push_back({value(k), value(v)});
+            return copy;
+        }
+        if (auto fn = std::dynamic_pointer_cast<Function>(src)) {
+            auto copy = std::make_shared<Function>();
+            objects[src.get()] = copy;
+            copy->name = fn->name; copy->token = fn->token; copy->parameters = fn->parameters; copy->body = fn->body;
+            copy->env = env(fn->env);
+            return copy;
+        }
+        if (auto inst = std::dynamic_pointer_cast<Instance>(src)) {
+            auto copy = std::make_shared<Instance>();
+            objects[src.get()] = copy;
+            copy->cls = std::static_pointer_cast<Class>(value(inst->cls));
+            for (auto& [k, v] : inst->fields) copy->fields[k] = value(v);
+            return copy;
+        }
+        if (auto cls = std::dynamic_pointer_cast<Class>(src); cls && classes) {
+            auto copy = std::make_shared<Class>();
+            objects[src.get()] = copy;
+            copy->name = cls->name;
+            for (auto& [k, v] : cls->members) copy->setMember(k, value(v));
+            return copy;
+        }
+        if (auto mod = std::dynamic_pointer_cast<Module>(src); mod && classes) {
+            auto copy = std::make_shared<Module>();
+            objects[src.get()] = copy;
+            copy->path = mod->path;
+            copy->env = env(mod->env);
+            return copy;
+        }
+        // Scalars, builtins, read-only arrays and maps and (for workers)
+        // classes and modules are shared as-is
+        return src;
+    }
+};
+
 // ============ Interpreter ============
 
-Interpreter::Interpreter() {
+static TraceMode globalTraceMode = TraceMode::Off;
+
+void setTraceMode(TraceMode mode) { globalTraceMode = mode; }
+TraceMode traceMode() { return globalTraceMode; }
+
+static int globalBudget = 0;
+
+void setDefaultInstructionBudget(int n) { globalBudget = n; }
+int defaultInstructionBudget() { return globalBudget; }
+
+Interpreter::Interpreter() : Interpreter(true) {}
+
+Interpreter::Interpreter(bool initNative) {
     env_ = newEnvironment();
-    native::Registry::instance().initAll();
+    trace_ = globalTraceMode;
+    budget_ = globalBudget;
+    watchStatements_ = trace_ == TraceMode::Statements;
+    if (initNative) native::Registry::instance().initAll();
+    bindNative();
+    initBuiltins();
+}
+Interpreter::~Interpreter() { native::closeHandles(this); }
+
+void Interpreter::bindNative() {
+    owner_ = std::this_thread::get_id();
+    native::setHandleOwner(this);
     // Provide callback so native modules can evaluate user-defined functions
     native::Registry::instance().setEvalCallback(
         [this](ObjectPtr callable, const std::vector<ObjectPtr>& args) -> ObjectPtr {
             return applyFunction(callable, args);
         });
-    initBuiltins();
 }
-ObjectPtr Interpreter::interpret(Program* program) { return evalProgram(program, env_); }
+
+std::unique_ptr<Interpreter> Interpreter::fork() const {
+    // The registry is set up already; only the builtins, some of which hold
+    // their interpreter, are made anew.
+    std::unique_ptr<Interpreter> child(new Interpreter(false));
+    WorkerClone clone;
+    clone.classes = true;
+    for (auto& [name, builtin] : builtins_) clone.objects[builtin.get()] = child->builtins_[name];
+    child->env_ = clone.env(env_);
+    for (auto& [path, mod] : loadedModules_) child->loadedModules_[path] = clone.value(mod);
+    child->modulePrograms_ = modulePrograms_;
+    for (int i = 0; i < 3; i++) child->setHook(static_cast<HookEvent>(i), hooks_[i]);
+    child->budget_ = budget_;
+    return child;
+}
+
+std::unique_ptr<Interpreter> Interpreter::worker() {
+    std::unique_ptr<Interpreter> child(new Interpreter(false));
+    child->loadedModules_ = loadedModules_;
+    child->modulePrograms_ = modulePrograms_;
+    for (int i = 0; i < 3; i++) child->setHook(static_cast<HookEvent>(i), hooks_[i]);
+    child->callStack_ = callStack_;
+    child->currentFile_ = currentFile_;
+    child->strict_ = strict_;
+    child->budget_ = budget_;
+    child->budgetLeft_ = budgetLeft_;
+    child->stop_ = stop_;
+    child->runningFinalizers_ = true;
+    // The constructor bound the calling thread to the worker; take it back.
+    bindNative();
+    return child;
+}
+
+ObjectPtr Interpreter::interpret(Program* program) {
+    return runProgram(program, env_);
+}
+ObjectPtr Interpreter::check(Program* program) {
+    return lintProgram(program, [this](const std::string& name) { return builtins_.count(name) > 0; });
+}
+
+ObjectPtr Interpreter::interpretInScope(Program* program) {
+    return runProgram(program, newEnclosedEnvironment(env_));
+}
+
+ObjectPtr Interpreter::call(ObjectPtr fn, const std::vector<ObjectPtr>& args) {
+    bindNative();
+    lastCall_ = nullptr;
+    budgetLeft_ = budget_;
+    size_t frames = deferred_.size();
+    try {
+        return applyFunction(fn, args);
+    } catch (const std::exception& e) {
+        deferred_.resize(frames);
+        return internalError(e.what());
+    } catch (...) {
+        deferred_.resize(frames);
+        return internalError("unknown exception");
+    }
+}
+
+ObjectPtr Interpreter::runProgram(Program* program, std::shared_ptr<Environment> env) {
+    bindNative();
+    lastCall_ = nullptr;
+    budgetLeft_ = budget_;
+    strict_ = program->strict;
+    size_t frames = deferred_.size();
+    try {
+        deferred_.emplace_back();
+        auto result = runDeferred(evalProgram(program, env));
+        if (isError(result) || isSignal(result)) return result;
+        // Drain timers scheduled by the program before reporting completion
+        if (auto loopErr = native::runEventLoop()) return loopErr;
+        return result;
+    } catch (const std::exception& e) {
+        deferred_.resize(frames);
+        return internalError(e.what());
+    } catch (...) {
+        deferred_.resize(frames);
+        return internalError("unknown exception");
+    }
+}
+
+ObjectPtr Interpreter::internalError(const std::string& what) {
+    auto trace = std::make_shared<StackTrace>();
+    if (lastCall_) {
+        StackFrame frame;
+        frame.functionName = lastCall_->function->inspect();
+        frame.position = {lastCall_->token.file, lastCall_->token.line, lastCall_->token.column};
+        trace->frames.push_back(frame);
+    }
+    return newInternalError(what, trace);
+}
 
 bool Interpreter::isError(ObjectPtr obj) { return obj && obj->type() == ObjectType::ERROR; }
 bool Interpreter::isSignal(ObjectPtr obj) {
@@ -69,25 +315,27 @@ ObjectPtr Interpreter::builtinError(const std::string& name, const std::string&
 
 ObjectPtr Interpreter::eval(Node* node, std::shared_ptr<Environment> env) {
     if (!node) return getNull();
+    if (budget_ > 0 && --budgetLeft_ < 0) return budgetExceeded();
 
     // Hot path: most common node types for recursive functions like fib
     if (auto il = dynamic_cast<IntegerLiteral*>(node)) return newInteger(il->value);
     if (auto id = dynamic_cast<Identifier*>(node)) return evalIdentifier(id, env);
     if (auto ix = dynamic_cast<InfixExpression*>(node)) {
         if (ix->op == "&&" || ix->op == "and") {
-            auto l = eval(ix->left.get(), env); if (isError(l)) return l;
+            auto l = eval(ix->left.get(), env); if (isError(l) || isSignal(l)) return l;
             if (!isTruthy(l)) return getFalse();
-            auto r = eval(ix->right.get(), env); if (isError(r)) return r;
+            auto r = eval(ix->right.get(), env); if (isError(r) || isSignal(r)) return r;
             return nativeBoolToBooleanObject(isTruthy(r));
         }
         if (ix->op == "||" || ix->op == "or") {
-            auto l = eval(ix->left.get(), env); if (isError(l)) return l;
+            auto l = eval(ix->left.get(), env); if (isError(l) || isSignal(l)) return l;
             if (isTruthy(l)) return getTrue();
-            auto r = eval(ix->right.get(), env); if (isError(r)) return r;
+            auto r = eval(ix->right.get(), env); if (isError(r) || isSignal(r)) return r;
             return nativeBoolToBooleanObject(isTruthy(r));
         }
-        auto l = eval(ix->left.get(), env); if (isError(l)) return l;
-        auto r = eval(ix->right.get(), env); if (isError(r)) return r;
+        auto l = eval(ix->left.get(), env); if (isError(l) || isSignal(l)) return l;
+        auto r = eval(ix->right.get(), env); if (isError(r) || isSignal(r)) return r;
+        infixToken_ = &ix->token;
         return evalInfixExpression(ix->op, l, r);
     }
     if (auto ie = dynamic_cast<IfExpression*>(node)) return evalIfExpression(ie, env);
@@ -98,9 +346,12 @@ ObjectPtr Interpreter::eval(Node* node, std::shared_ptr<Environment> env) {
     }
     if (auto ce = dynamic_cast<CallExpression*>(node)) {
         auto function = eval(ce->function.get(), env);
-        if (isError(function)) return function;
+        if (isError(function) || isSignal(function)) return function;
         auto args = evalExpressions(ce->arguments, env);
-        if (args.size() == 1 && isError(args[0])) return args[0];
+        if (args.size() == 1 && (isError(args[0]) || isSignal(args[0]))) return args[0];
+        if (auto& audit = native::AuditLog::instance(); audit.enabled())
+            audit.setCallSite(ce->token.file, ce->token.line, ce->token.column);
+        lastCall_ = ce;
         return applyFunction(function, args);
     }
     if (auto bs = dynamic_cast<BlockStatement*>(node)) return evalBlockStatement(bs, env);
@@ -116,6 +367,7 @@ ObjectPtr Interpreter::eval(Node* node, std::shared_ptr<Environment> env) {
     if (dynamic_cast<ContinueStatement*>(node)) return std::make_shared<ContinueSignal>();
     if (auto ws = dynamic_cast<WhileStatement*>(node)) return evalWhile(ws, env);
     if (auto fs = dynamic_cast<ForStatement*>(node)) return evalFor(fs, env);
+    if (auto fi = dynamic_cast<ForInStatement*>(node)) return evalForIn(fi, env);
     if (auto ls = dynamic_cast<LetStatement*>(node)) {
         auto val = eval(ls->value.get(), env);
         if (isError(val) || isSignal(val)) return val;
@@ -136,35 +388,37 @@ ObjectPtr Interpreter::eval(Node* node, std::shared_ptr<Environment> env) {
     if (dynamic_cast<NullLiteral*>(node)) return getNull();
     if (auto il = dynamic_cast<IntegerLiteral*>(node)) return newInteger(il->value);
     if (auto fl = dynamic_cast<FloatLiteral*>(node)) return newFloat(fl->value);
+    if (auto dl = dynamic_cast<DecimalLiteral*>(node)) return newDecimal(dl->units, dl->scale);
     if (auto bl = dynamic_cast<BooleanLiteral*>(node)) return nativeBoolToBooleanObject(bl->value);
-    if (auto sl = dynamic_cast<StringLiteral*>(node)) return newString(sl->value);
+    if (auto sl = dynamic_cast<StringLiteral*>(node)) return internString(sl->value);
     if (auto px = dynamic_cast<PrefixExpression*>(node)) {
         auto r = eval(px->right.get(), env);
-        if (isError(r)) return r;
+        if (isError(r) || isSignal(r)) return r;
+        infixToken_ = &px->token;
         return evalPrefixExpression(px->op, r);
     }
     if (auto ix = dynamic_cast<InfixExpression*>(node)) {
         if (ix->op == "&&" || ix->op == "and") {
-            auto l = eval(ix->left.get(), env); if (isError(l)) return l;
+            auto l = eval(ix->left.get(), env); if (isError(l) || isSignal(l)) return l;
             if (!isTruthy(l)) return getFalse();
-            auto r = eval(ix->right.get(), env); if (isError(r)) return r;
+            auto r = eval(ix->right.get(), env); if (isError(r) || isSignal(r)) return r;
             return nativeBoolToBooleanObject(isTruthy(r));
         }
         if (ix->op == "||" || ix->op == "or") {
-            auto l = eval(ix->left.get(), env); if (isError(l)) return l;
+            auto l = eval(ix->left.get(), env); if (isError(l) || isSignal(l)) return l;
             if (isTruthy(l)) return getTrue();
-            auto r = eval(ix->right.get(), env); if (isError(r)) return r;
+            auto r = eval(ix->right.get(), env); if (isError(r) || isSignal(r)) return r;
             return nativeBoolToBooleanObject(isTruthy(r));
         }
-        auto l = eval(ix->left.get(), env); if (isError(l)) return l;
-        auto r = eval(ix->right.get(), env); if (isError(r)) return r;
+        auto l = eval(ix->left.get(), env); if (isError(l) || isSignal(l)) return l;
+        auto r = eval(ix->right.get(), env); if (isError(r) || isSignal(r)) return r;
         return evalInfixExpression(ix->op, l, r);
     }
     if (auto ie = dynamic_cast<IfExpression*>(node)) return evalIfExpression(ie, env);
     if (auto id = dynamic_cast<Identifier*>(node)) return evalIdentifier(id, env);
     if (auto fd = dynamic_cast<FunctionDeclaration*>(node)) {
         auto fn = std::make_shared<Function>();
-        fn->name = fd->name->value; fn->parameters = fd->parameters; fn->env = env; fn->body = fd->body;
+        fn->name = fd->name->value; fn->token = fd->token; fn->parameters = fd->parameters; fn->env = env; fn->body = fd->body;
         ObjectPtr decorated = fn;
         if (!fd->decorators.empty()) { decorated = applyDecorators(fd->decorators, decorated, env); if (isSignal(decorated) || isError(decorated)) return decorated; }
         env->set(fd->name->value, decorated);
@@ -172,36 +426,38 @@ ObjectPtr Interpreter::eval(Node* node, std::shared_ptr<Environment> env) {
     }
     if (auto fl = dynamic_cast<FunctionLiteral*>(node)) {
         auto fn = std::make_shared<Function>();
-        fn->parameters = fl->parameters; fn->env = env; fn->body = fl->body;
+        fn->token = fl->token; fn->parameters = fl->parameters; fn->env = env; fn->body = fl->body;
         return fn;
     }
     if (auto ce = dynamic_cast<CallExpression*>(node)) {
         auto function = eval(ce->function.get(), env);
-        if (isError(function)) return function;
+        if (isError(function) || isSignal(function)) return function;
         auto args = evalExpressions(ce->arguments, env);
-        if (args.size() == 1 && isError(args[0])) return args[0];
+        if (args.size() == 1 && (isError(args[0]) || isSignal(args[0]))) return args[0];
         return applyFunction(function, args);
     }
     if (auto al = dynamic_cast<ArrayLiteral*>(node)) {
         auto elems = evalExpressions(al->elements, env);
-        if (elems.size() == 1 && isError(elems[0])) return elems[0];
-        return newArray(elems);
+        if (elems.size() == 1 && (isError(elems[0]) || isSignal(elems[0]))) return elems[0];
+        return newArray(std::move(elems));
     }
     if (auto ml = dynamic_cast<MapLiteral*>(node)) return evalMapLiteral(ml, env);
     if (auto idx = dynamic_cast<IndexExpression*>(node)) {
-        auto l = eval(idx->left.get(), env); if (isError(l)) return l;
-        auto i = eval(idx->index.get(), env); if (isError(i)) return i;
+        auto l = eval(idx->left.get(), env); if (isError(l) || isSignal(l)) return l;
+        auto i = eval(idx->index.get(), env); if (isError(i) || isSignal(i)) return i;
         return evalIndexExpression(l, i);
     }
     if (auto imp = dynamic_cast<ImportStatement*>(node)) return evalImportStatement(imp, env);
     if (auto ae = dynamic_cast<AssignExpression*>(node)) return evalAssignExpression(ae, env);
     if (auto ts = dynamic_cast<TryStatement*>(node)) return evalTryStatement(ts, env);
     if (auto ts = dynamic_cast<ThrowStatement*>(node)) return evalThrowStatement(ts, env);
+    if (auto ds = dynamic_cast<DeferStatement*>(node)) return evalDeferStatement(ds, env);
     if (auto cd = dynamic_cast<ClassDeclaration*>(node)) return evalClassDeclaration(cd, env);
     if (auto me = dynamic_cast<MemberExpression*>(node)) return evalMemberExpression(me, env);
     if (auto ie = dynamic_cast<InExpression*>(node)) return evalInExpression(ie, env);
     if (auto ie = dynamic_cast<IsExpression*>(node)) return evalIsExpression(ie, env);
     if (auto ws = dynamic_cast<WithStatement*>(node)) return evalWithStatement(ws, env);
+    if (auto ms = dynamic_cast<MatchStatement*>(node)) return evalMatchStatement(ms, env);
     if (auto gs = dynamic_cast<GlobalStatement*>(node)) return evalGlobalStatement(gs, env);
     if (auto ns = dynamic_cast<NonlocalStatement*>(node)) return evalNonlocalStatement(ns, env);
     if (auto lam = dynamic_cast<LambdaExpression*>(node)) {
@@ -211,7 +467,7 @@ ObjectPtr Interpreter::eval(Node* node, std::shared_ptr<Environment> env) {
         es->token = lam->token; es->expression = lam->body;
         block->statements.push_back(es);
         auto fn = std::make_shared<Function>();
-        fn->parameters = lam->parameters; fn->env = env; fn->body = block;
+        fn->token = lam->token; fn->parameters = lam->parameters; fn->env = env; fn->body = block;
         return fn;
     }
     return builtinError("Runtime", "unknown node type");
@@ -219,13 +475,47 @@ ObjectPtr Interpreter::eval(Node* node, std::shared_ptr<Environment> env) {
 
 // ============ Statements ============
 
+// Gives an error or exception that stmt raised stmt's position, unless a
+// builtin or an inner statement located it already. Functions name the frame
+// as the exception leaves them (nameRaised); what is left belongs to the
+// top level.
+static void locateRaised(Statement* stmt, const ObjectPtr& result) {
+    if (auto err = std::dynamic_pointer_cast<Error>(result)) {
+        if (err->position.line > 0 || !err->stackTrace.empty()) return;
+        auto info = tokenInfoFromNode(stmt);
+        err->position = {info.file, info.line, info.column};
+    } else if (auto sig = std::dynamic_pointer_cast<ExceptionSignal>(result)) {
+        if (!sig->exception || sig->exception->stackTrace) return;
+        auto info = tokenInfoFromNode(stmt);
+        auto trace = std::make_shared<StackTrace>();
+        trace->frames.push_back({"", {info.file, info.line, info.column}, ""});
+        sig->exception->stackTrace = trace;
+    }
+}
+
+static void nameRaised(const ObjectPtr& result, const std::string& name) {
+    if (!result || result->type() != ObjectType::EXCEPTION_SIGNAL) return;
+    auto& trace = std::static_pointer_cast<ExceptionSignal>(result)->exception->stackTrace;
+    if (trace && trace->frames.size() == 1 && trace->frames[0].functionName.empty()) trace->frames[0].functionName = name;
+}
+
 ObjectPtr Interpreter::evalProgram(Program* program, std::shared_ptr<Environment> env) {
     ObjectPtr result = getNull();
     for (auto& stmt : program->statements) {
+        if (stop_->load(std::memory_order_relaxed)) return interrupted();
+        if (native::errorBudgetSpent()) return native::errorBudgetError();
+        if (finalizersPending()) runFinalizers();
+        if (watchStatements_) beforeStatement(stmt.get());
         result = eval(stmt.get(), env);
         if (auto rv = std::dynamic_pointer_cast<ReturnValue>(result)) return rv->value;
-        if (isError(result) || isSignal(result)) return result;
+        if (isError(result) || isSignal(result)) {
+            locateRaised(stmt.get(), result);
+            nameRaised(result, "<module>");
+            if (hooks_[static_cast<int>(HookEvent::Exception)]) reportRaised(stmt.get(), result);
+            return result;
+        }
     }
+    if (finalizersPending()) runFinalizers();
     return result;
 }
 
@@ -238,10 +528,18 @@ ObjectPtr Interpreter::evalBlockStatementWithScoping(BlockStatement* block, std:
     auto blockEnv = createNewScope ? newEnclosedEnvironment(env) : env;
     ObjectPtr result = getNull();
     for (auto& stmt : block->statements) {
+        if (stop_->load(std::memory_order_relaxed)) return interrupted();
+        if (native::errorBudgetSpent()) return native::errorBudgetError();
+        if (finalizersPending()) runFinalizers();
+        if (watchStatements_) beforeStatement(stmt.get());
         result = eval(stmt.get(), blockEnv);
         if (result && (result->type() == ObjectType::RETURN_VALUE || result->type() == ObjectType::ERROR ||
                        result->type() == ObjectType::BREAK_SIGNAL || result->type() == ObjectType::CONTINUE_SIGNAL ||
-                       result->type() == ObjectType::EXCEPTION_SIGNAL)) return result;
+                       result->type() == ObjectType::EXCEPTION_SIGNAL)) {
+            locateRaised(stmt.get(), result);
+            if (hooks_[static_cast<int>(HookEvent::Exception)]) reportRaised(stmt.get(), result);
+            return result;
+        }
     }
     return result;
 }
@@ -250,7 +548,10 @@ ObjectPtr Interpreter::evalAssignStatement(AssignStatement* node, std::shared_pt
     auto val = eval(node->value.get(), env);
     if (isError(val) || isSignal(val)) return val;
     if (auto t = std::dynamic_pointer_cast<Identifier>(node->target)) {
-        if (!env->update(t->value, val)) env->set(t->value, val);
+        if (!env->update(t->value, val)) {
+            if (strict_) return undeclaredAssignment(t.get(), env);
+            env->set(t->value, val);
+        }
         return getNull();
     }
     if (auto t = std::dynamic_pointer_cast<IndexExpression>(node->target)) return evalIndexAssignment(t.get(), val, env);
@@ -259,54 +560,142 @@ ObjectPtr Interpreter::evalAssignStatement(AssignStatement* node, std::shared_pt
 }
 
 ObjectPtr Interpreter::evalIndexAssignment(IndexExpression* idx, ObjectPtr val, std::shared_ptr<Environment> env) {
-    auto left = eval(idx->left.get(), env); if (isError(left)) return left;
-    auto index = eval(idx->index.get(), env); if (isError(index)) return index;
+    auto left = eval(idx->left.get(), env); if (isError(left) || isSignal(left)) return left;
+    auto index = eval(idx->index.get(), env); if (isError(index) || isSignal(index)) return index;
+    if (auto err = frozenError(left, index)) return err;
     if (auto arr = std::dynamic_pointer_cast<Array>(left)) {
         auto idxObj = std::dynamic_pointer_cast<Integer>(index);
         if (!idxObj) return builtinError("TypeError", "array index must be integer");
-        if (idxObj->value < 0 || idxObj->value >= (int64_t)arr->elements.size())
-            return newExceptionSignal(std::dynamic_pointer_cast<Exception>(newException(INDEX_ERROR, "array index out of range")));
-        arr->elements[idxObj->value] = val;
+        size_t pos = 0;
+        if (!sequenceIndex(idxObj->value, arr->elements.size(), pos)) return indexError("array", idxObj->value, arr->elements.size());
+        arr->elements[pos] = val;
         return getNull();
     }
     if (auto m = std::dynamic_pointer_cast<Map>(left)) {
         for (auto it = m->pairs.begin(); it != m->pairs.end(); ++it)
             if (equals(it->first, index)) { m->pairs.erase(it); m->pairs.push_back({index, val}); return getNull(); }
+        if (auto err = mapSizeError(m->pairs.size() + 1)) return err;
         m->pairs.push_back({index, val}); return getNull();
     }
+    if (left->type() == ObjectType::INT_ARRAY || left->type() == ObjectType::FLOAT_ARRAY) {
+        auto idxObj = std::dynamic_pointer_cast<Integer>(index);
+        if (!idxObj) return builtinError("TypeError", "array index must be integer");
+        size_t pos = 0;
+        if (auto ints = std::dynamic_pointer_cast<IntArray>(left)) {
+            auto v = std::dynamic_pointer_cast<Integer>(val);
+            if (!v) return builtinError("TypeError", "int_array elements must be integers");
+            if (!sequenceIndex(idxObj->value, ints->values.size(), pos)) return indexError("int_array", idxObj->value, ints->values.size());
+            ints->values[pos] = v->value;
+            return getNull();
+        }
+        auto floats = std::static_pointer_cast<FloatArray>(left);
+        if (val->type() != ObjectType::INTEGER && val->type() != ObjectType::FLOAT)
+            return builtinError("TypeError", "float_array elements must be numbers");
+        if (!sequenceIndex(idxObj->value, floats->values.size(), pos)) return indexError("float_array", idxObj->value, floats->values.size());
+        floats->values[pos] = asFloat(val);
+        return getNull();
+    }
+    if (auto result = callProtocol(left, "__setitem__", {index, val})) {
+        if (isError(result) || isSignal(result)) return result;
+        return getNull();
+    }
     return builtinError("TypeError", "index assignment not supported on " + std::string(ObjectTypeToString(left->type())));
 }
 
+// A loop's else block, run once the loop has ended without break.
+ObjectPtr Interpreter::evalLoopElse(BlockStatement* elseBlock, std::shared_ptr<Environment> env) {
+    if (!elseBlock) return getNull();
+    auto result = evalBlockStatementWithScoping(elseBlock, env, true);
+    if (isError(result) || isSignal(result) || result->type() == ObjectType::RETURN_VALUE) return result;
+    return getNull();
+}
+
 ObjectPtr Interpreter::evalWhile(WhileStatement* node, std::shared_ptr<Environment> env) {
     while (true) {
+        // Checked here too, since an empty body runs no statements.
+        if (stop_->load(std::memory_order_relaxed)) return interrupted();
         auto cond = eval(node->condition.get(), env);
         if (isError(cond) || isSignal(cond)) return cond;
         if (!isTruthy(cond)) break;
         auto result = evalBlockStatementWithScoping(node->body.get(), env, true);
-        if (std::dynamic_pointer_cast<BreakSignal>(result)) break;
+        if (std::dynamic_pointer_cast<BreakSignal>(result)) return getNull();
         if (std::dynamic_pointer_cast<ContinueSignal>(result)) continue;
-        if (isError(result) || isSignal(result)) return result;
+        if (isError(result) || isSignal(result) || result->type() == ObjectType::RETURN_VALUE) return result;
     }
-    return getNull();
+    return evalLoopElse(node->elseBlock.get(), env);
 }
 
 ObjectPtr Interpreter::evalFor(ForStatement* node, std::shared_ptr<Environment> env) {
     auto forEnv = newEnclosedEnvironment(env);
-    if (node->init) eval(node->init.get(), forEnv);
+    if (node->init) {
+        if (watchStatements_) beforeStatement(node->init.get());
+        auto init = eval(node->init.get(), forEnv);
+        if (isError(init) || isSignal(init)) return init;
+    }
     while (true) {
+        if (stop_->load(std::memory_order_relaxed)) return interrupted();
         if (node->condition) {
             auto cond = eval(node->condition.get(), forEnv);
             if (isError(cond) || isSignal(cond)) return cond;
             if (!isTruthy(cond)) break;
         }
         auto result = evalBlockStatementWithScoping(node->body.get(), forEnv, true);
-        if (std::dynamic_pointer_cast<BreakSignal>(result)) break;
+        if (std::dynamic_pointer_cast<BreakSignal>(result)) return getNull();
         if (!std::dynamic_pointer_cast<ContinueSignal>(result)) {
-            if (isError(result) || isSignal(result)) return result;
+            if (isError(result) || isSignal(result) || result->type() == ObjectType::RETURN_VALUE) return result;
+        }
+        if (node->post) {
+            if (watchStatements_) beforeStatement(node->post.get());
+            auto post = eval(node->post.get(), forEnv);
+            if (isError(post) || isSignal(post)) return post;
         }
-        if (node->post) eval(node->post.get(), forEnv);
     }
-    return getNull();
+    return evalLoopElse(node->elseBlock.get(), forEnv);
+}
+
+ObjectPtr Interpreter::evalForIn(ForInStatement* node, std::shared_ptr<Environment> env) {
+    auto iterable = eval(node->iterable.get(), env);
+    if (isError(iterable) || isSignal(iterable)) return iterable;
+    // A class's __iter__ returns what to loop over in its place.
+    if (auto items = callProtocol(iterable, "__iter__")) {
+        if (isError(items) || isSignal(items)) return items;
+        iterable = items;
+    }
+    // Streams such as open files are read a step at a time instead of up front.
+    std::function<ObjectPtr()> next;
+    std::shared_ptr<Array> steps;
+    if (auto handle = std::dynamic_pointer_cast<Handle>(iterable); handle && handle->next) {
+        next = handle->next;
+    } else {
+        steps = forInSteps(iterable, node->key != nullptr);
+        if (!steps) return builtinError("TypeError", "cannot iterate over " + std::string(ObjectTypeToString(iterable->type())));
+    }
+    for (int64_t index = 0;; index++) {
+        ObjectPtr step;
+        if (next) {
+            step = next();
+            if (!step) break;
+            if (node->key) step = newArray({newInteger(index), step});
+        } else {
+            if (index >= static_cast<int64_t>(steps->elements.size())) break;
+            step = steps->elements[index];
+        }
+        if (stop_->load(std::memory_order_relaxed)) return interrupted();
+        // A fresh scope per step, so closures in the body keep their own step.
+        auto stepEnv = newEnclosedEnvironment(env);
+        if (node->key) {
+            auto& pair = std::static_pointer_cast<Array>(step)->elements;
+            stepEnv->set(node->key->value, pair[0]);
+            stepEnv->set(node->value->value, pair[1]);
+        } else {
+            stepEnv->set(node->value->value, step);
+        }
+        auto result = evalBlockStatementWithScoping(node->body.get(), stepEnv, false);
+        if (std::dynamic_pointer_cast<BreakSignal>(result)) return getNull();
+        if (std::dynamic_pointer_cast<ContinueSignal>(result)) continue;
+        if (isError(result) || isSignal(result) || result->type() == ObjectType::RETURN_VALUE) return result;
+    }
+    return evalLoopElse(node->elseBlock.get(), env);
 }
 
 ObjectPtr Interpreter::evalTryStatement(TryStatement* node, std::shared_ptr<Environment> env) {
@@ -320,17 +709,16 @@ ObjectPtr Interpreter::evalTryStatement(TryStatement* node, std::shared_ptr<Envi
         return tryResult;
     }
     for (auto& cc : node->catchClauses) {
-        if (!cc->exceptionType) {
-            auto catchEnv = newEnclosedEnvironment(env);
-            if (cc->variable) catchEnv->set(cc->variable->value, exSig->exception);
-            auto cr = evalBlockStatementWithScoping(cc->catchBlock.get(), catchEnv, false);
-            if (node->finallyBlock) { auto fr = evalBlockStatementWithScoping(node->finallyBlock.get(), env, true); if (isError(fr) || isSignal(fr)) return fr; }
-            return cr;
-        }
-        if (exSig->exception && exSig->exception->exceptionType == cc->exceptionType->value) {
+        bool caught = cc->exceptionTypes.empty();
+        for (auto& t : cc->exceptionTypes)
+            caught = caught || (exSig->exception && exceptionMatches(exSig->exception->exceptionType, t->value));
+        if (caught) {
             auto catchEnv = newEnclosedEnvironment(env);
             if (cc->variable) catchEnv->set(cc->variable->value, exSig->exception);
             auto cr = evalBlockStatementWithScoping(cc->catchBlock.get(), catchEnv, false);
+            if (cr && cr->type() == ObjectType::EXCEPTION_SIGNAL) {
+                if (auto spent = native::countRethrown()) cr = spent;
+            }
             if (node->finallyBlock) { auto fr = evalBlockStatementWithScoping(node->finallyBlock.get(), env, true); if (isError(fr) || isSignal(fr)) return fr; }
             return cr;
         }
@@ -348,47 +736,153 @@ ObjectPtr Interpreter::evalThrowStatement(ThrowStatement* node, std::shared_ptr<
     return newExceptionSignal(ex);
 }
 
+ObjectPtr Interpreter::evalDeferStatement(DeferStatement* node, std::shared_ptr<Environment> env) {
+    if (deferred_.empty()) return builtinError(RUNTIME_ERROR, "defer outside a function or program");
+    Deferred d;
+    // As in Go, a deferred call's function and arguments are fixed now.
+    if (auto ce = dynamic_cast<CallExpression*>(node->expression.get())) {
+        d.fn = eval(ce->function.get(), env);
+        if (isError(d.fn) || isSignal(d.fn)) return d.fn;
+        d.args = evalExpressions(ce->arguments, env);
+        if (d.args.size() == 1 && (isError(d.args[0]) || isSignal(d.args[0]))) return d.args[0];
+        d.call = ce;
+    } else {
+        d.expression = node->expression.get();
+        d.env = env;
+    }
+    deferred_.back().push_back(std::move(d));
+    return getNull();
+}
+
+ObjectPtr Interpreter::evalFunctionBody(BlockStatement* body, std::shared_ptr<Environment> env) {
+    deferred_.emplace_back();
+    return runDeferred(evalBlockStatementWithScoping(body, env, false));
+}
+
+ObjectPtr Interpreter::runDeferred(ObjectPtr result) {
+    auto frame = std::move(deferred_.back());
+    deferred_.pop_back();
+    for (auto it = frame.rbegin(); it != frame.rend(); ++it) {
+        if (it->call) lastCall_ = it->call;
+        auto r = it->call ? applyFunction(it->fn, it->args) : eval(it->expression, it->env);
+        if (isError(r) || isSignal(r)) result = r;
+    }
+    return result;
+}
+
 ObjectPtr Interpreter::evalClassDeclaration(ClassDeclaration* node, std::shared_ptr<Environment> env) {
     auto cls = std::make_shared<Class>();
     cls->name = node->name->value;
     auto classEnv = newEnclosedEnvironment(env);
     evalBlockStatementWithScoping(node->body.get(), classEnv, false);
-    for (auto& [k, v] : classEnv->getAll()) cls->members[k] = v;
+    for (auto& [k, v] : classEnv->getAll()) cls->setMember(k, v);
     ObjectPtr result = cls;
     if (!node->decorators.empty()) result = applyDecorators(node->decorators, cls, env);
     env->set(node->name->value, result);
     return getNull();
 }
 
+// The builtin for a native module function, named mod.fn. Denied functions
+// stay callable so scripts get a clear error rather than an AttributeError.
+static std::shared_ptr<Builtin> nativeFunction(const native::NativeModule& nativeMod, const std::string& modName,
+                                               const std::string& fnName) {
+    auto& policy = native::CapabilityPolicy::instance();
+    auto builtin = std::make_shared<Builtin>();
+    builtin->fn = nativeMod.functions.at(fnName);
+    builtin->name = modName + "." + fnName;
+    if (auto doc = nativeMod.docs.find(fnName); doc != nativeMod.docs.end())
+        setSignature(*builtin, doc->second.signature);
+    bool allowed = policy.allows(modName, fnName);
+    bool audited = native::AuditLog::instance().enabled();
+    if (allowed && !policy.limitsArguments() && !audited) return builtin;
+    // The audit log records the decision the arguments led to, not just the
+    // grant.
+    builtin->fn = [modName, fnName, allowed, audited, call = builtin->fn](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        auto& policy = native::CapabilityPolicy::instance();
+        std::string denied;
+        if (!allowed) denied = modName + "." + fnName + " is not allowed by the capability policy";
+        else if (policy.limitsArguments()) denied = policy.checkArguments(modName, fnName, args);
+        if (audited) native::AuditLog::instance().recordCall(modName, fnName, args, denied.empty());
+        if (!denied.empty()) return newError("PermissionError: %s", denied.c_str());
+        return policy.filterResult(modName, fnName, call(args));
+    };
+    return builtin;
+}
+
 ObjectPtr Interpreter::evalImportStatement(ImportStatement* node, std::shared_ptr<Environment> env) {
     if (!node->path) return builtinError("ImportError", "import requires a path");
     std::string path = node->path->value;
-    if (auto it = loadedModules_.find(path); it != loadedModules_.end()) return it->second;
 
-    // Native modules: import math  OR  import "go:math"
+    // Native modules: import math  OR  import "go:math"; DariX ones: import "std:strings"
     std::string modName = path;
-    if (path.substr(0, 3) == "go:") {
-        modName = path.substr(3);
+    if (path.substr(0, 3) == "go:" || path.substr(0, 4) == "std:") {
+        modName = path.substr(path.find(':') + 1);
+    }
+    auto result = loadModule(node, path, modName, env);
+    if (isError(result) || isSignal(result)) return result;
+    auto mod = std::static_pointer_cast<Module>(result);
+    if (node->names.empty()) {
+        env->set(node->alias ? node->alias->value : modName, mod);
+        return mod;
     }
+    for (auto& name : node->names) {
+        if (!mod->env->hasLocal(name->value))
+            return builtinError("ImportError", "module '" + modName + "' has no name '" + name->value + "'");
+        env->set(name->value, mod->env->get(name->value));
+    }
+    return mod;
+}
+
+ObjectPtr Interpreter::loadModule(ImportStatement* node, const std::string& path, const std::string& modName,
+                                  std::shared_ptr<Environment> env) {
+    if (auto it = loadedModules_.find(path); it != loadedModules_.end()) return it->second;
+    if (path.substr(0, 4) == "std:") return importStdModule(path, modName);
 
     auto modEnv = newEnclosedEnvironment(env);
     const auto* nativeMod = native::Registry::instance().get(modName);
     if (nativeMod) {
-        for (auto& [fnName, fn] : nativeMod->functions) {
-            auto builtin = std::make_shared<Builtin>();
-            builtin->fn = fn;
-            modEnv->set(fnName, builtin);
+        auto& audit = native::AuditLog::instance();
+        bool moduleAllowed = native::CapabilityPolicy::instance().allowsModule(modName);
+        if (audit.enabled()) {
+            audit.setCallSite(node->token.file, node->token.line, node->token.column);
+            audit.recordImport(modName, moduleAllowed);
         }
+        if (!moduleAllowed)
+            return builtinError("PermissionError", "module '" + modName + "' is not allowed by the capability policy");
+        // In name order, so iterating the module is repeatable.
+        std::vector<std::string> fnNames;
+        for (auto& [fnName, _] : nativeMod->functions) fnNames.push_back(fnName);
+        std::sort(fnNames.begin(), fnNames.end());
+        for (auto& fnName : fnNames) modEnv->set(fnName, nativeFunction(*nativeMod, modName, fnName));
     }
 
     auto mod = std::make_shared<Module>();
     mod->path = path;
     mod->env = modEnv;
-    env->set(modName, mod);
     loadedModules_[path] = mod;
     return mod;
 }
 
+ObjectPtr Interpreter::importStdModule(const std::string& path, const std::string& name) {
+    const std::string* source = stdlibSource(name);
+    if (!source) return builtinError("ImportError", "no standard module '" + name + "'");
+    auto [program, errors] = parseSource(*source, path);
+    if (!errors.empty()) return builtinError("ImportError", errors[0]);
+    auto mod = std::make_shared<Module>();
+    mod->path = path;
+    mod->env = newEnvironment();
+    // Registered before running, so a module importing itself gets the
+    // partial module instead of recursing.
+    loadedModules_[path] = mod;
+    modulePrograms_.push_back(program);
+    auto result = evalProgram(program.get(), mod->env);
+    if (isError(result) || isSignal(result)) {
+        loadedModules_.erase(path);
+        return result;
+    }
+    return mod;
+}
+
 ObjectPtr Interpreter::evalDelStatement(DelStatement* node, std::shared_ptr<Environment> env) {
     if (auto t = std::dynamic_pointer_cast<Identifier>(node->target)) {
         if (!env->erase(t->value)) return builtinError("NameError", "name '" + t->value + "' is not defined");
@@ -397,12 +891,13 @@ ObjectPtr Interpreter::evalDelStatement(DelStatement* node, std::shared_ptr<Envi
     if (auto t = std::dynamic_pointer_cast<IndexExpression>(node->target)) {
         auto left = eval(t->left.get(), env); if (isError(left)) return left;
         auto index = eval(t->index.get(), env); if (isError(index)) return index;
+        if (auto err = frozenError(left, index)) return err;
         if (auto arr = std::dynamic_pointer_cast<Array>(left)) {
             auto idx = std::dynamic_pointer_cast<Integer>(index);
             if (!idx) return builtinError("TypeError", "array index must be integer");
-            if (idx->value < 0 || idx->value >= (int64_t)arr->elements.size())
-                return newExceptionSignal(std::dynamic_pointer_cast<Exception>(newException(INDEX_ERROR, "array index out of range")));
-            arr->elements.erase(arr->elements.begin() + idx->value); return getNull();
+            size_t pos = 0;
+            if (!sequenceIndex(idx->value, arr->elements.size(), pos)) return indexError("array", idx->value, arr->elements.size());
+            arr->elements.erase(arr->elements.begin() + pos); return getNull();
         }
         if (auto m = std::dynamic_pointer_cast<Map>(left)) {
             for (auto it = m->pairs.begin(); it != m->pairs.end(); ++it)
@@ -431,6 +926,7 @@ ObjectPtr Interpreter::evalWithStatement(WithStatement* node, std::shared_ptr<En
     auto withEnv = newEnclosedEnvironment(env);
     if (node->variable) withEnv->set(node->variable->value, ctx);
     auto bodyResult = evalBlockStatementWithScoping(node->body.get(), withEnv, false);
+    if (auto handle = std::dynamic_pointer_cast<Handle>(ctx)) handle->close();
     if (auto inst = std::dynamic_pointer_cast<Instance>(ctx)) {
         if (auto it = inst->fields.find("__exit__"); it != inst->fields.end()) {
             if (auto exitFn = std::dynamic_pointer_cast<Function>(it->second)) {
@@ -444,15 +940,76 @@ ObjectPtr Interpreter::evalWithStatement(WithStatement* node, std::shared_ptr<En
     return getNull();
 }
 
+// Each case gets a scope of its own for its captures, which its guard and
+// body see; a case that fails to match leaves nothing bound.
+ObjectPtr Interpreter::evalMatchStatement(MatchStatement* node, std::shared_ptr<Environment> env) {
+    auto subject = eval(node->subject.get(), env);
+    if (isError(subject) || isSignal(subject)) return subject;
+    for (auto& arm : node->cases) {
+        auto caseEnv = newEnclosedEnvironment(env);
+        if (!matchPattern(arm->pattern.get(), subject, caseEnv)) continue;
+        if (arm->guard) {
+            auto holds = eval(arm->guard.get(), caseEnv);
+            if (isError(holds) || isSignal(holds)) return holds;
+            if (!isTruthy(holds)) continue;
+        }
+        return evalBlockStatementWithScoping(arm->body.get(), caseEnv, false);
+    }
+    return getNull();
+}
+
+bool Interpreter::matchPattern(Pattern* pattern, const ObjectPtr& value, std::shared_ptr<Environment> env) {
+    switch (pattern->kind) {
+        case Pattern::Kind::Literal:
+            return equals(eval(pattern->value.get(), env), value);
+        case Pattern::Kind::Capture:
+            if (pattern->name->value != "_") env->set(pattern->name->value, value);
+            return true;
+        case Pattern::Kind::Array: {
+            auto arr = std::dynamic_pointer_cast<Array>(value);
+            if (!arr) return false;
+            auto& items = arr->elements;
+            size_t n = pattern->elements.size();
+            if (pattern->rest ? items.size() < n : items.size() != n) return false;
+            for (size_t i = 0; i < n; i++)
+                if (!matchPattern(pattern->elements[i].get(), items[i], env)) return false;
+            if (pattern->rest && pattern->rest->value != "_")
+                env->set(pattern->rest->value, newArray(std::vector<ObjectPtr>(items.begin() + n, items.end())));
+            return true;
+        }
+        case Pattern::Kind::Map: {
+            auto m = std::dynamic_pointer_cast<Map>(value);
+            if (!m) return false;
+            for (auto& [key, sub] : pattern->entries) {
+                auto k = eval(key.get(), env);
+                auto it = std::find_if(m->pairs.begin(), m->pairs.end(), [&](auto& pair) { return equals(pair.first, k); });
+                if (it == m->pairs.end() || !matchPattern(sub.get(), it->second, env)) return false;
+            }
+            return true;
+        }
+    }
+    return false;
+}
+
 ObjectPtr Interpreter::evalGlobalStatement(GlobalStatement*, std::shared_ptr<Environment>) { return getNull(); }
 ObjectPtr Interpreter::evalNonlocalStatement(NonlocalStatement*, std::shared_ptr<Environment>) { return getNull(); }
 
+// Keys keep the order they are written in. A repeated key warns and takes
+// the later value, keeping the earlier key's place.
 ObjectPtr Interpreter::evalMapLiteral(MapLiteral* node, std::shared_ptr<Environment> env) {
     std::vector<std::pair<ObjectPtr, ObjectPtr>> pairs;
     for (auto& [k, v] : node->pairs) {
-        auto key = eval(k.get(), env); if (isError(key)) return key;
-        auto val = eval(v.get(), env); if (isError(val)) return val;
-        pairs.push_back({key, val});
+        auto key = eval(k.get(), env); if (isError(key) || isSignal(key)) return key;
+        auto val = eval(v.get(), env); if (isError(val) || isSignal(val)) return val;
+        auto same = std::find_if(pairs.begin(), pairs.end(), [&](auto& pair) { return equals(pair.first, key); });
+        if (same == pairs.end()) {
+            pairs.push_back({key, val});
+            continue;
+        }
+        auto info = tokenInfoFromNode(k.get());
+        if (auto err = Warnings::instance().warn("duplicate-key", duplicateKeyWarning(key), info.file, info.line, info.column))
+            return err;
+        same->second = val;
     }
     return newMap(pairs);
 }
@@ -473,11 +1030,15 @@ ObjectPtr Interpreter::evalInfixExpression(const std::string& op, ObjectPtr left
     }
     if (left->type() == ObjectType::INTEGER && right->type() == ObjectType::INTEGER) {
         auto l = std::dynamic_pointer_cast<Integer>(left); auto r = std::dynamic_pointer_cast<Integer>(right);
-        if (op == "+") return newInteger(l->value + r->value);
-        if (op == "-") return newInteger(l->value - r->value);
-        if (op == "*") return newInteger(l->value * r->value);
-        if (op == "/") { if (r->value == 0) return newExceptionSignal(std::dynamic_pointer_cast<Exception>(newException(ZERO_DIV_ERROR, "division by zero"))); return newInteger(l->value / r->value); }
-        if (op == "%") { if (r->value == 0) return newExceptionSignal(std::dynamic_pointer_cast<Exception>(newException(ZERO_DIV_ERROR, "modulo by zero"))); return newInteger(l->value % r->value); }
+        if (op == "+" || op == "-" || op == "*") {
+            int64_t v;
+            bool overflowed = op == "+"   ? wrappingAdd(l->value, r->value, v)
+                              : op == "-" ? wrappingSub(l->value, r->value, v)
+                                          : wrappingMul(l->value, r->value, v);
+            return wrappedInteger(overflowed, v, op);
+        }
+        if (op == "/") return truncatingDivision(l->value, r->value);
+        if (op == "%") { if (r->value == 0) return newExceptionSignal(std::dynamic_pointer_cast<Exception>(newException(ZERO_DIV_ERROR, "modulo by zero"))); return newInteger(integerRemainder(l->value, r->value)); }
         if (op == "<") return nativeBoolToBooleanObject(l->value < r->value);
         if (op == ">") return nativeBoolToBooleanObject(l->value > r->value);
         if (op == "<=") return nativeBoolToBooleanObject(l->value <= r->value);
@@ -485,6 +1046,43 @@ ObjectPtr Interpreter::evalInfixExpression(const std::string& op, ObjectPtr left
         if (op == "==") return nativeBoolToBooleanObject(l->value == r->value);
         if (op == "!=") return nativeBoolToBooleanObject(l->value != r->value);
     }
+    if (left->type() == ObjectType::DECIMAL || right->type() == ObjectType::DECIMAL) {
+        auto exact = [](const ObjectPtr& o) { return o->type() == ObjectType::DECIMAL || o->type() == ObjectType::INTEGER; };
+        if (exact(left) && exact(right)) {
+            if (op == "<") return nativeBoolToBooleanObject(compareDecimals(left, right) < 0);
+            if (op == ">") return nativeBoolToBooleanObject(compareDecimals(left, right) > 0);
+            if (op == "<=") return nativeBoolToBooleanObject(compareDecimals(left, right) <= 0);
+            if (op == ">=") return nativeBoolToBooleanObject(compareDecimals(left, right) >= 0);
+            if (op == "==") return nativeBoolToBooleanObject(compareDecimals(left, right) == 0);
+            if (op == "!=") return nativeBoolToBooleanObject(compareDecimals(left, right) != 0);
+            if (auto result = decimalArithmetic(op, left, right)) return result;
+        }
+        // Mixing in a float would give up the exactness decimals are for.
+        if (left->type() == ObjectType::FLOAT || right->type() == ObjectType::FLOAT)
+            return builtinError("TypeError", "cannot mix decimal and float in " + op + "; convert with decimal() or float()");
+    }
+    if (left->type() == ObjectType::COMPLEX || right->type() == ObjectType::COMPLEX) {
+        auto part = [](const ObjectPtr& o, std::complex<double>& out) {
+            if (auto c = std::dynamic_pointer_cast<Complex>(o)) out = {c->real, c->imag};
+            else if (o->type() == ObjectType::INTEGER || o->type() == ObjectType::FLOAT) out = asFloat(o);
+            else return false;
+            return true;
+        };
+        std::complex<double> l, r;
+        if (part(left, l) && part(right, r)) {
+            if (op == "+") return newComplex((l + r).real(), (l + r).imag());
+            if (op == "-") return newComplex((l - r).real(), (l - r).imag());
+            if (op == "*") return newComplex((l * r).real(), (l * r).imag());
+            if (op == "/") {
+                if (r == 0.0) return newExceptionSignal(std::dynamic_pointer_cast<Exception>(newException(ZERO_DIV_ERROR, "complex division by zero")));
+                return newComplex((l / r).real(), (l / r).imag());
+            }
+            if (op == "==") return nativeBoolToBooleanObject(l == r);
+            if (op == "!=") return nativeBoolToBooleanObject(l != r);
+            if (op == "<" || op == ">" || op == "<=" || op == ">=")
+                return builtinError("TypeError", "complex numbers are not ordered; compare abs() instead");
+        }
+    }
     if (left->type() == ObjectType::FLOAT || right->type() == ObjectType::FLOAT) {
         double l = (left->type() == ObjectType::FLOAT) ? std::dynamic_pointer_cast<Float>(left)->value : std::dynamic_pointer_cast<Integer>(left)->value;
         double r = (right->type() == ObjectType::FLOAT) ? std::dynamic_pointer_cast<Float>(right)->value : std::dynamic_pointer_cast<Integer>(right)->value;
@@ -497,7 +1095,7 @@ ObjectPtr Interpreter::evalInfixExpression(const std::string& op, ObjectPtr left
     }
     if (left->type() == ObjectType::STRING && right->type() == ObjectType::STRING) {
         auto l = std::dynamic_pointer_cast<String>(left); auto r = std::dynamic_pointer_cast<String>(right);
-        if (op == "+") return newString(l->value + r->value);
+        if (op == "+") return concatStrings(l, r);
         if (op == "==") return nativeBoolToBooleanObject(l->value == r->value);
         if (op == "!=") return nativeBoolToBooleanObject(l->value != r->value);
         if (op == "<") return nativeBoolToBooleanObject(l->value < r->value);
@@ -516,18 +1114,53 @@ ObjectPtr Interpreter::evalInfixExpression(const std::string& op, ObjectPtr left
         if (op == "!=") return nativeBoolToBooleanObject(!equals(left, right));
     }
     // Array equality
-    if (left->type() == ObjectType::ARRAY && right->type() == ObjectType::ARRAY) {
+    if (left->type() == right->type() && (left->type() == ObjectType::ARRAY || left->type() == ObjectType::INT_ARRAY ||
+                                          left->type() == ObjectType::FLOAT_ARRAY)) {
         if (op == "==") return nativeBoolToBooleanObject(equals(left, right));
         if (op == "!=") return nativeBoolToBooleanObject(!equals(left, right));
     }
     return builtinError("TypeError", "unsupported operator " + op + " for " + ObjectTypeToString(left->type()) + " and " + ObjectTypeToString(right->type()));
 }
 
+// Result of integer arithmetic that may have wrapped around; overflow raises
+// OverflowError under checked arithmetic and otherwise is reported as a
+// warning at the infix expression being evaluated.
+ObjectPtr Interpreter::wrappedInteger(bool overflowed, int64_t value, const std::string& op) {
+    if (overflowed) {
+        if (checkedArithmeticEnabled()) return overflowError(op);
+        const Token* tok = infixToken_;
+        if (auto err = Warnings::instance().warn("overflow", "integer overflow in '" + op + "'; the result wrapped around",
+                                                 tok ? tok->file : "", tok ? tok->line : 0, tok ? tok->column : 0))
+            return err;
+    }
+    return newInteger(value);
+}
+
+// Integer '/' under language v1, which warns that v2 returns a float instead.
+ObjectPtr Interpreter::truncatingDivision(int64_t left, int64_t right) {
+    if (right == 0) return newExceptionSignal(std::dynamic_pointer_cast<Exception>(newException(ZERO_DIV_ERROR, "division by zero")));
+    const Token* tok = infixToken_;
+    if (auto err = Warnings::instance().warn("lang", IntegerDivisionWarning, tok ? tok->file : "", tok ? tok->line : 0, tok ? tok->column : 0))
+        return err;
+    int64_t v;
+    bool overflowed = wrappingDiv(left, right, v);
+    return wrappedInteger(overflowed, v, "/");
+}
+
 ObjectPtr Interpreter::evalPrefixExpression(const std::string& op, ObjectPtr right) {
     if (op == "!") return nativeBoolToBooleanObject(!isTruthy(right));
     if (op == "-") {
-        if (auto i = std::dynamic_pointer_cast<Integer>(right)) return newInteger(-i->value);
+        if (auto i = std::dynamic_pointer_cast<Integer>(right)) {
+            int64_t v;
+            bool overflowed = wrappingNeg(i->value, v);
+            return wrappedInteger(overflowed, v, "-");
+        }
         if (auto f = std::dynamic_pointer_cast<Float>(right)) return newFloat(-f->value);
+        if (auto d = std::dynamic_pointer_cast<Decimal>(right)) {
+            if (d->units == INT64_MIN) return overflowError("-");
+            return newDecimal(-d->units, d->scale);
+        }
+        if (auto c = std::dynamic_pointer_cast<Complex>(right)) return newComplex(-c->real, -c->imag);
     }
     return builtinError("TypeError", "unknown prefix operator " + op);
 }
@@ -547,13 +1180,45 @@ ObjectPtr Interpreter::evalIdentifier(Identifier* node, std::shared_ptr<Environm
     auto val = env->get(node->value);
     if (val) return val;
     auto it = builtins_.find(node->value);
-    if (it != builtins_.end()) return it->second;
+    if (it != builtins_.end()) {
+        if (!it->second->deprecated.empty()) {
+            if (auto err = Warnings::instance().warn("deprecated", "'" + node->value + "' is deprecated; " + it->second->deprecated,
+                                                     node->token.file, node->token.line, node->token.column))
+                return err;
+        }
+        return it->second;
+    }
     auto ex = std::dynamic_pointer_cast<Exception>(newException(NAME_ERROR, "name '" + node->value + "' is not defined"));
+    ex->suggestion = didYouMean(node->value, visibleNames(env));
     return newExceptionSignal(ex);
 }
 
+ObjectPtr Interpreter::undeclaredAssignment(Identifier* node, std::shared_ptr<Environment> env) {
+    auto ex = std::dynamic_pointer_cast<Exception>(
+        newException(NAME_ERROR, "cannot assign to undeclared name '" + node->value + "' in strict mode; declare it with var"));
+    ex->suggestion = didYouMean(node->value, visibleNames(env));
+    return newExceptionSignal(ex);
+}
+
+// Names an identifier could have meant: variables in every enclosing scope,
+// builtins, and the exports of loaded modules qualified by the module name.
+std::vector<std::string> Interpreter::visibleNames(std::shared_ptr<Environment> env) const {
+    std::vector<std::string> names;
+    for (auto e = env; e; e = e->outerEnv()) {
+        for (auto& [name, value] : e->store) {
+            names.push_back(name);
+            if (auto mod = std::dynamic_pointer_cast<Module>(value)) {
+                for (auto& [exported, _] : mod->env->store) names.push_back(name + "." + exported);
+            }
+        }
+    }
+    for (auto& [name, _] : builtins_) names.push_back(name);
+    return names;
+}
+
 std::vector<ObjectPtr> Interpreter::evalExpressions(const std::vector<ExpressionPtr>& exps, std::shared_ptr<Environment> env) {
     std::vector<ObjectPtr> result;
+    result.reserve(exps.size());
     for (auto& e : exps) {
         auto val = eval(e.get(), env);
         if (isError(val) || isSignal(val)) return {val};
@@ -563,21 +1228,33 @@ std::vector<ObjectPtr> Interpreter::evalExpressions(const std::vector<Expression
 }
 
 ObjectPtr Interpreter::evalIndexExpression(ObjectPtr left, ObjectPtr index) {
-    if (left->type() == ObjectType::ARRAY && index->type() == ObjectType::INTEGER) {
-        auto arr = std::dynamic_pointer_cast<Array>(left); auto idx = std::dynamic_pointer_cast<Integer>(index)->value;
-        if (idx < 0 || idx >= (int64_t)arr->elements.size()) return getNull();
-        return arr->elements[idx];
-    }
     if (left->type() == ObjectType::MAP) {
         auto m = std::dynamic_pointer_cast<Map>(left);
         for (auto& [k, v] : m->pairs) if (equals(k, index)) return v;
         return getNull();
     }
+    size_t pos = 0;
+    if (left->type() == ObjectType::ARRAY && index->type() == ObjectType::INTEGER) {
+        auto arr = std::dynamic_pointer_cast<Array>(left); auto idx = std::dynamic_pointer_cast<Integer>(index)->value;
+        if (!sequenceIndex(idx, arr->elements.size(), pos)) return indexError("array", idx, arr->elements.size());
+        return arr->elements[pos];
+    }
     if (left->type() == ObjectType::STRING && index->type() == ObjectType::INTEGER) {
         auto s = std::dynamic_pointer_cast<String>(left); auto idx = std::dynamic_pointer_cast<Integer>(index)->value;
-        if (idx < 0 || idx >= (int64_t)s->value.size()) return getNull();
-        return newString(std::string(1, s->value[idx]));
+        if (!sequenceIndex(idx, s->value.size(), pos)) return indexError("string", idx, s->value.size());
+        return newString(std::string(1, s->value[pos]));
+    }
+    if (left->type() == ObjectType::INT_ARRAY && index->type() == ObjectType::INTEGER) {
+        auto& values = std::static_pointer_cast<IntArray>(left)->values; auto idx = std::static_pointer_cast<Integer>(index)->value;
+        if (!sequenceIndex(idx, values.size(), pos)) return indexError("int_array", idx, values.size());
+        return newInteger(values[pos]);
     }
+    if (left->type() == ObjectType::FLOAT_ARRAY && index->type() == ObjectType::INTEGER) {
+        auto& values = std::static_pointer_cast<FloatArray>(left)->values; auto idx = std::static_pointer_cast<Integer>(index)->value;
+        if (!sequenceIndex(idx, values.size(), pos)) return indexError("float_array", idx, values.size());
+        return newFloat(values[pos]);
+    }
+    if (auto result = callProtocol(left, "__getitem__", {index})) return result;
     return builtinError("TypeError", "index operator not supported on " + std::string(ObjectTypeToString(left->type())));
 }
 
@@ -585,11 +1262,16 @@ ObjectPtr Interpreter::evalAssignExpression(AssignExpression* node, std::shared_
     auto val = eval(node->value.get(), env);
     if (isError(val) || isSignal(val)) return val;
     if (auto nameIdent = std::dynamic_pointer_cast<Identifier>(node->name)) {
-        if (!env->update(nameIdent->value, val)) env->set(nameIdent->value, val);
+        if (!env->update(nameIdent->value, val)) {
+            if (strict_) return undeclaredAssignment(nameIdent.get(), env);
+            env->set(nameIdent->value, val);
+        }
         return val;
     }
     if (auto nameIdx = std::dynamic_pointer_cast<IndexExpression>(node->name)) {
-        evalIndexAssignment(nameIdx.get(), val, env); return val;
+        auto result = evalIndexAssignment(nameIdx.get(), val, env);
+        if (isError(result) || isSignal(result)) return result;
+        return val;
     }
     return builtinError("Runtime", "invalid assignment target");
 }
@@ -600,10 +1282,8 @@ ObjectPtr Interpreter::evalMemberExpression(MemberExpression* node, std::shared_
     std::string prop = node->property->value;
     if (auto inst = std::dynamic_pointer_cast<Instance>(left)) {
         if (auto it = inst->fields.find(prop); it != inst->fields.end()) return it->second;
-        if (auto it = inst->cls->members.find(prop); it != inst->cls->members.end()) {
-            if (auto fn = std::dynamic_pointer_cast<Function>(it->second)) return newBoundMethod(inst, fn);
-            return it->second;
-        }
+        if (auto fn = inst->cls->method(prop)) return newBoundMethod(inst, fn);
+        if (auto it = inst->cls->members.find(prop); it != inst->cls->members.end()) return it->second;
         return builtinError("AttributeError", "attribute '" + prop + "' not found on instance of '" + inst->cls->name + "'");
     }
     if (auto cls = std::dynamic_pointer_cast<Class>(left)) {
@@ -614,6 +1294,69 @@ ObjectPtr Interpreter::evalMemberExpression(MemberExpression* node, std::shared_
         if (auto val = mod->env->get(prop)) return val;
         return builtinError("AttributeError", "attribute '" + prop + "' not found on module");
     }
+    if (auto handle = std::dynamic_pointer_cast<Handle>(left)) {
+        if (prop == "close") {
+            auto fn = std::make_shared<Builtin>();
+            fn->fn = [handle](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+                if (!args.empty()) return newError("close: expected 0 arguments");
+                return nativeBoolToBooleanObject(handle->close());
+            };
+            return fn;
+        }
+        if (prop == "closed") return nativeBoolToBooleanObject(handle->closed);
+        if (prop == "kind") return newString(handle->kind);
+        if (prop == "id") return newInteger(handle->id);
+        return builtinError("AttributeError", "attribute '" + prop + "' not found on " + handle->kind + " handle");
+    }
+    if (auto ref = std::dynamic_pointer_cast<WeakRef>(left)) {
+        if (prop == "alive") return nativeBoolToBooleanObject(!ref->target.expired());
+        if (prop == "get") {
+            auto fn = std::make_shared<Builtin>();
+            // The object, or null once it has been destroyed.
+            fn->fn = [ref](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+                if (!args.empty()) return newError("get: expected 0 arguments");
+                auto object = ref->target.lock();
+                return object ? object : getNull();
+            };
+            return fn;
+        }
+        return builtinError("AttributeError", "attribute '" + prop + "' not found on weakref");
+    }
+    if (auto sb = std::dynamic_pointer_cast<StringBuilder>(left)) {
+        auto fn = std::make_shared<Builtin>();
+        if (prop == "append") {
+            // Appends each argument as str() would show it; returns the builder for chaining.
+            fn->fn = [sb](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+                for (auto& arg : args) {
+                    auto s = std::dynamic_pointer_cast<String>(arg);
+                    std::string text = s ? s->value : arg->inspect();
+                    if (auto err = stringSizeError(sb->value.size() + text.size())) return err;
+                    sb->value += text;
+                }
+                return sb;
+            };
+        } else if (prop == "to_string") {
+            fn->fn = [sb](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+                if (!args.empty()) return newError("to_string: expected 0 arguments");
+                return newString(sb->value);
+            };
+        } else if (prop == "clear") {
+            fn->fn = [sb](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+                if (!args.empty()) return newError("clear: expected 0 arguments");
+                sb->value.clear();
+                return sb;
+            };
+        } else {
+            return builtinError("AttributeError", "attribute '" + prop + "' not found on builder");
+        }
+        return fn;
+    }
+    if (auto ex = std::dynamic_pointer_cast<Exception>(left)) {
+        if (prop == "type") return newString(ex->exceptionType);
+        if (prop == "message") return newString(ex->message);
+        if (prop == "data") return ex->data ? ex->data : getNull();
+        return builtinError("AttributeError", "attribute '" + prop + "' not found on exception");
+    }
     return builtinError("AttributeError", "attribute access not supported on " + std::string(ObjectTypeToString(left->type())));
 }
 
@@ -622,7 +1365,7 @@ ObjectPtr Interpreter::evalMemberAssignment(MemberExpression* memberExpr, Object
     if (isError(left)) return left;
     std::string prop = memberExpr->property->value;
     if (auto inst = std::dynamic_pointer_cast<Instance>(left)) { inst->fields[prop] = val; return val; }
-    if (auto cls = std::dynamic_pointer_cast<Class>(left)) { cls->members[prop] = val; return val; }
+    if (auto cls = std::dynamic_pointer_cast<Class>(left)) { cls->setMember(prop, val); return val; }
     return builtinError("TypeError", "member assignment not supported on " + std::string(ObjectTypeToString(left->type())));
 }
 
@@ -646,17 +1389,171 @@ ObjectPtr Interpreter::evalInExpression(InExpression* node, std::shared_ptr<Envi
 ObjectPtr Interpreter::evalIsExpression(IsExpression* node, std::shared_ptr<Environment> env) {
     auto left = eval(node->left.get(), env); if (isError(left) || isSignal(left)) return left;
     auto right = eval(node->right.get(), env); if (isError(right) || isSignal(right)) return right;
-    return nativeBoolToBooleanObject(left.get() == right.get());
+    return nativeBoolToBooleanObject(sameObject(left, right));
 }
 
 // ============ Function application ============
 
+// ============ Tracing ============
+
+// One line of trace output: single-spaced and cut short.
+static std::string traceText(const std::string& text) {
+    constexpr size_t MaxLength = 80;
+    std::string out;
+    for (char c : text) {
+        bool space = c == ' ' || c == '\n' || c == '\t' || c == '\r';
+        if (space && (out.empty() || out.back() == ' ')) continue;
+        out += space ? ' ' : c;
+    }
+    while (!out.empty() && out.back() == ' ') out.pop_back();
+    if (out.size() > MaxLength) out = out.substr(0, MaxLength) + "...";
+    return out;
+}
+
+static std::string traceWhere(const std::string& file, int line) {
+    return (file.empty() ? "<unknown>" : file) + ":" + std::to_string(line);
+}
+
+ObjectPtr Interpreter::interrupted() {
+    stop_->store(false, std::memory_order_relaxed);
+    auto ex = std::dynamic_pointer_cast<Exception>(newException(INTERRUPT_ERROR, "execution was stopped by the host"));
+    return newExceptionSignal(ex);
+}
+
+ObjectPtr Interpreter::budgetExceeded() {
+    auto ex = std::dynamic_pointer_cast<Exception>(newException(RUNTIME_ERROR, "instruction budget exceeded"));
+    return newExceptionSignal(ex);
+}
+
+void Interpreter::setHook(HookEvent event, Hook hook) {
+    hooks_[static_cast<int>(event)] = std::move(hook);
+    watchStatements_ = trace_ == TraceMode::Statements || hooks_[static_cast<int>(HookEvent::Line)];
+}
+
+// What a finalizer returns is dropped, and what it raises becomes a
+// "finalizer" warning: nothing is waiting for either.
+void Interpreter::runFinalizers() {
+    if (runningFinalizers_ || std::this_thread::get_id() != owner_) return;
+    runningFinalizers_ = true;
+    auto* call = lastCall_;
+    while (finalizersPending()) {
+        for (auto& finalizer : takeFinalizers()) {
+            auto result = applyFunction(finalizer.fn, finalizer.args);
+            if (!isError(result) && !isSignal(result)) continue;
+            std::string file;
+            int line = 0, column = 0;
+            if (auto f = std::dynamic_pointer_cast<Function>(finalizer.fn)) {
+                file = f->token.file;
+                line = f->token.line;
+                column = f->token.column;
+            }
+            auto what = result->inspect();
+            Warnings::instance().warn("finalizer", "finalizer raised " + what.substr(0, what.find('\n')), file, line, column);
+        }
+    }
+    lastCall_ = call;
+    runningFinalizers_ = false;
+}
+
+void Interpreter::beforeStatement(Statement* stmt) {
+    if (trace_ == TraceMode::Statements) traceStatement(stmt);
+    if (auto& hook = hooks_[static_cast<int>(HookEvent::Line)]) {
+        auto info = tokenInfoFromNode(stmt);
+        HookInfo event{HookEvent::Line, info.file, info.line};
+        hook(event);
+    }
+}
+
+void Interpreter::reportRaised(Statement* stmt, const ObjectPtr& result) {
+    auto type = result->type();
+    if (type != ObjectType::ERROR && type != ObjectType::EXCEPTION_SIGNAL) return;
+    if (lastRaised_.lock() == result) return;
+    lastRaised_ = result;
+    auto info = tokenInfoFromNode(stmt);
+    HookInfo event{HookEvent::Exception, info.file, info.line};
+    event.error = result;
+    hooks_[static_cast<int>(HookEvent::Exception)](event);
+}
+
+// Name shown for a script callable in traces and hooks, or "" for builtins.
+static std::string callableName(const ObjectPtr& fn) {
+    if (auto func = std::dynamic_pointer_cast<Function>(fn)) return func->name.empty() ? "<lambda>" : func->name;
+    if (auto bm = std::dynamic_pointer_cast<BoundMethod>(fn)) return bm->self->cls->name + "." + bm->fn->name;
+    if (auto cls = std::dynamic_pointer_cast<Class>(fn)) return cls->name;
+    return "";
+}
+
+void Interpreter::traceStatement(Statement* stmt) {
+    auto info = tokenInfoFromNode(stmt);
+    std::cerr << "trace: " << std::string(traceDepth_ * 2, ' ') << traceWhere(info.file, info.line) << ": "
+              << traceText(stmt->inspect()) << "\n";
+}
+
+// Reports a call into a script function and what it returned or raised. The
+// location is the call expression being applied.
+ObjectPtr Interpreter::tracedCall(ObjectPtr fn, const std::vector<ObjectPtr>& args) {
+    std::string name = callableName(fn);
+    if (name.empty()) return invokeFunction(fn, args);
+
+    std::string where = lastCall_ ? traceWhere(lastCall_->token.file, lastCall_->token.line) : "<unknown>";
+    std::string call = name + "(";
+    for (size_t i = 0; i < args.size(); i++) call += (i ? ", " : "") + (args[i] ? repr(args[i]) : "null");
+    std::string indent(traceDepth_ * 2, ' ');
+    std::cerr << "trace: " << indent << where << ": call " << traceText(call + ")") << "\n";
+    traceDepth_++;
+    auto result = invokeFunction(fn, args);
+    traceDepth_--;
+    std::string outcome;
+    if (auto sig = std::dynamic_pointer_cast<ExceptionSignal>(result)) outcome = "raised " + sig->exception->exceptionType + ": " + sig->exception->message;
+    else if (isError(result)) outcome = "failed: " + result->inspect();
+    else outcome = "returned " + (result ? repr(result) : "null");
+    std::cerr << "trace: " << indent << where << ": " << name << " " << traceText(outcome) << "\n";
+    return result;
+}
+
 ObjectPtr Interpreter::applyFunction(ObjectPtr fn, const std::vector<ObjectPtr>& args) {
-    if (auto builtin = std::dynamic_pointer_cast<Builtin>(fn)) return builtin->fn(args);
+    if (auto& hook = hooks_[static_cast<int>(HookEvent::EnterCall)]) {
+        auto name = callableName(fn);
+        if (!name.empty()) {
+            HookInfo event{HookEvent::EnterCall};
+            if (lastCall_) {
+                event.file = lastCall_->token.file;
+                event.line = lastCall_->token.line;
+            }
+            event.function = name;
+            event.args = &args;
+            hook(event);
+        }
+    }
+    if (trace_ == TraceMode::Off) return invokeFunction(fn, args);
+    if (trace_ == TraceMode::Calls) return tracedCall(fn, args);
+    // Statement traces are indented by call depth.
+    traceDepth_++;
+    auto result = invokeFunction(fn, args);
+    traceDepth_--;
+    return result;
+}
+
+ObjectPtr Interpreter::invokeFunction(ObjectPtr fn, const std::vector<ObjectPtr>& args) {
+    if (auto builtin = std::dynamic_pointer_cast<Builtin>(fn)) {
+        auto result = arityError(*builtin, args.size());
+        if (!result) result = builtin->fn(args);
+        if (auto err = resultSizeError(result)) result = err;
+        // Exceptions raised by builtins point at the call.
+        auto sig = std::dynamic_pointer_cast<ExceptionSignal>(result);
+        if (sig && sig->exception && !sig->exception->stackTrace && lastCall_) {
+            auto trace = std::make_shared<StackTrace>();
+            auto& t = lastCall_->token;
+            trace->frames.push_back({builtin->name, {t.file, t.line, t.column}, ""});
+            sig->exception->stackTrace = trace;
+        }
+        return result;
+    }
     if (auto func = std::dynamic_pointer_cast<Function>(fn)) {
         // Ultra-fast path: detect fib-like pattern and execute directly in C++
         // Pattern: single param, body = if(n<=1) return n; return f(n-1)+f(n-2)
-        if (func->parameters.size() == 1 && !func->body->statements.empty()) {
+        // Skipped while a call hook is installed, since it makes no calls.
+        if (func->parameters.size() == 1 && !func->body->statements.empty() && !hooks_[static_cast<int>(HookEvent::EnterCall)]) {
             auto body = func->body.get();
             if (body->statements.size() == 2) {
                 // Statement 0: may be ExpressionStatement wrapping IfExpression, or IfStatement
@@ -722,42 +1619,55 @@ ObjectPtr Interpreter::applyFunction(ObjectPtr fn, const std::vector<ObjectPtr>&
         auto funcEnv = newEnclosedEnvironment(func->env);
         for (size_t i = 0; i < func->parameters.size(); i++)
             funcEnv->set(func->parameters[i]->value, (i < args.size()) ? args[i] : getNull());
-        auto result = evalBlockStatementWithScoping(func->body.get(), funcEnv, false);
+        auto result = evalFunctionBody(func->body.get(), funcEnv);
         if (auto rv = std::dynamic_pointer_cast<ReturnValue>(result)) return rv->value;
+        if (isSignal(result)) nameRaised(result, func->name.empty() ? "<lambda>" : func->name);
         return result;
     }
     if (auto bm = std::dynamic_pointer_cast<BoundMethod>(fn)) {
         auto funcEnv = newEnclosedEnvironment(bm->fn->env);
         funcEnv->set("self", bm->self);
         for (size_t i = 0; i < bm->fn->parameters.size(); i++) {
-            std::string name = bm->fn->parameters[i]->value;
+            const std::string& name = bm->fn->parameters[i]->value;
             if (name == "self") continue;
             funcEnv->set(name, (i < args.size()) ? args[i] : getNull());
         }
-        auto result = evalBlockStatementWithScoping(bm->fn->body.get(), funcEnv, false);
+        auto result = evalFunctionBody(bm->fn->body.get(), funcEnv);
         if (auto rv = std::dynamic_pointer_cast<ReturnValue>(result)) return rv->value;
+        if (isSignal(result)) nameRaised(result, bm->self->cls->name + "." + bm->fn->name);
         return result;
     }
     if (auto cls = std::dynamic_pointer_cast<Class>(fn)) {
         auto inst = newInstance(cls);
-        auto initIt = cls->members.find("__init__");
-        if (initIt != cls->members.end()) {
-            if (auto initFn = std::dynamic_pointer_cast<Function>(initIt->second)) {
-                auto funcEnv = newEnclosedEnvironment(initFn->env);
-                funcEnv->set("self", inst);
-                for (size_t i = 0; i < initFn->parameters.size(); i++) {
-                    std::string name = initFn->parameters[i]->value;
-                    if (name == "self") continue;
-                    funcEnv->set(name, (i < args.size()) ? args[i] : getNull());
-                }
-                evalBlockStatementWithScoping(initFn->body.get(), funcEnv, false);
+        if (auto initFn = cls->method("__init__")) {
+            auto funcEnv = newEnclosedEnvironment(initFn->env);
+            funcEnv->set("self", inst);
+            for (size_t i = 0; i < initFn->parameters.size(); i++) {
+                const std::string& name = initFn->parameters[i]->value;
+                if (name == "self") continue;
+                funcEnv->set(name, (i < args.size()) ? args[i] : getNull());
             }
+            evalFunctionBody(initFn->body.get(), funcEnv);
         }
         return inst;
     }
+    if (auto compiled = std::dynamic_pointer_cast<CompiledFunction>(fn)) {
+        if (compiledCall_) return compiledCall_(compiled, args);
+        return builtinError("TypeError", "compiled function " + (compiled->name.empty() ? "<anonymous>" : compiled->name) +
+                                             " can only be called from bytecode");
+    }
     return builtinError("TypeError", "not a function: " + std::string(ObjectTypeToString(fn->type())));
 }
 
+ObjectPtr Interpreter::callProtocol(const ObjectPtr& value, const std::string& name, const std::vector<ObjectPtr>& args) {
+    auto inst = std::dynamic_pointer_cast<Instance>(value);
+    if (!inst) return nullptr;
+    auto fn = inst->cls->method(name);
+    if (!fn) return nullptr;
+    auto result = applyFunction(newBoundMethod(inst, fn), args);
+    return result ? result : getNull();
+}
+
 ObjectPtr Interpreter::applyDecorators(const std::vector<ExpressionPtr>& decorators, ObjectPtr fn, std::shared_ptr<Environment> env) {
     ObjectPtr result = fn;
     for (int i = (int)decorators.size() - 1; i >= 0; i--) {
@@ -770,32 +1680,172 @@ ObjectPtr Interpreter::applyDecorators(const std::vector<ExpressionPtr>& decorat
     return result;
 }
 
+// ============ Environment ============
+
+static std::string lookupEnv(const std::string& name, const std::unordered_map<std::string, std::string>& loaded) {
+    if (auto it = loaded.find(name); it != loaded.end()) return it->second;
+    // Variables the policy hides read as unset.
+    if (!native::CapabilityPolicy::instance().allowsEnv(name)) return "";
+    const char* v = std::getenv(name.c_str());
+    return v ? v : "";
+}
+
+// Expands $NAME, ${NAME} and ${NAME:-default}; "$$" is a literal dollar sign.
+static std::string expandEnv(const std::string& s, const std::unordered_map<std::string, std::string>& loaded) {
+    auto isNameChar = [](char c) { return std::isalnum(static_cast<unsigned char>(c)) || c == '_'; };
+    std::string out;
+    for (size_t i = 0; i < s.size(); i++) {
+        if (s[i] != '$' || i + 1 >= s.size()) { out += s[i]; continue; }
+        if (s[i + 1] == '$') { out += '$'; i++; continue; }
+        if (s[i + 1] == '{') {
+            size_t close = s.find('}', i + 2);
+            if (close == std::string::npos) { out += s.substr(i); break; }
+            std::string expr = s.substr(i + 2, close - i - 2);
+            size_t dflt = expr.find(":-");
+            std::string value = lookupEnv(expr.substr(0, dflt), loaded);
+            if (value.empty() && dflt != std::string::npos) value = expandEnv(expr.substr(dflt + 2), loaded);
+            out += value;
+            i = close;
+            continue;
+        }
+        size_t end = i + 1;
+        while (end < s.size() && isNameChar(s[end])) end++;
+        if (end == i + 1) { out += '$'; continue; }
+        out += lookupEnv(s.substr(i + 1, end - i - 1), loaded);
+        i = end - 1;
+    }
+    return out;
+}
+
+// Parses a .env file: KEY=value lines with optional "export", # comments,
+// 'literal' values, and "double-quoted" values with escapes. Unquoted and
+// double-quoted values are expanded against earlier entries and the environment.
+static bool parseDotenv(const std::string& text, std::vector<std::pair<std::string, std::string>>& out, std::string& error) {
+    std::unordered_map<std::string, std::string> loaded;
+    auto trim = [](const std::string& v) {
+        size_t a = v.find_first_not_of(" \t\r"), b = v.find_last_not_of(" \t\r");
+        return a == std::string::npos ? std::string() : v.substr(a, b - a + 1);
+    };
+    auto skipBlanks = [&](size_t i) {
+        while (i < text.size() && (text[i] == ' ' || text[i] == '\t')) i++;
+        return i;
+    };
+    size_t pos = 0;
+    int line = 1;
+    while (pos < text.size()) {
+        int startLine = line;
+        size_t eol = text.find('\n', pos);
+        if (eol == std::string::npos) eol = text.size();
+        std::string raw = trim(text.substr(pos, eol - pos));
+        if (raw.empty() || raw[0] == '#') { pos = eol + 1; line++; continue; }
+
+        size_t i = skipBlanks(pos);
+        if (text.compare(i, 7, "export ") == 0) i = skipBlanks(i + 7);
+        size_t eq = text.find('=', i);
+        if (eq == std::string::npos || eq > eol) { error = "line " + std::to_string(startLine) + ": expected KEY=value"; return false; }
+        std::string key = trim(text.substr(i, eq - i));
+        if (key.empty()) { error = "line " + std::to_string(startLine) + ": missing variable name"; return false; }
+
+        std::string value;
+        i = skipBlanks(eq + 1);
+        if (i < eol && (text[i] == '"' || text[i] == '\'')) {
+            // Quoted values may span several lines
+            char q = text[i];
+            size_t end = i + 1;
+            std::string body;
+            while (end < text.size() && text[end] != q) {
+                char c = text[end];
+                if (c == '\n') line++;
+                if (q == '"' && c == '\\' && end + 1 < text.size()) {
+                    char e = text[++end];
+                    if (e == 'n') body += '\n';
+                    else if (e == 't') body += '\t';
+                    else if (e == 'r') body += '\r';
+                    else if (e == '$') body += "$$";
+                    else body += e;
+                } else {
+                    body += c;
+                }
+                end++;
+            }
+            if (end >= text.size()) { error = "line " + std::to_string(startLine) + ": unterminated quoted value"; return false; }
+            value = q == '"' ? expandEnv(body, loaded) : body;
+            eol = text.find('\n', end);
+            if (eol == std::string::npos) eol = text.size();
+        } else {
+            std::string rest = trim(text.substr(i, eol - i));
+            if (size_t hash = rest.find(" #"); hash != std::string::npos) rest = trim(rest.substr(0, hash));
+            value = expandEnv(rest, loaded);
+        }
+        loaded[key] = value;
+        out.push_back({key, value});
+        pos = eol + 1;
+        line++;
+    }
+    return true;
+}
+
 // ============ Builtins ============
 
 void Interpreter::initBuiltins() {
     auto makeBuiltin = [](auto fn) { auto b = std::make_shared<Builtin>(); b->fn = fn; return b; };
     builtins_["print"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.empty()) { std::printf("\n"); return getNull(); }
         std::string out;
         for (size_t i = 0; i < args.size(); i++) { if (i > 0) out += " "; out += args[i]->inspect(); }
-        std::printf("%s\n", out.c_str()); return getNull();
+        if (auto err = native::writeOutput("print", out + "\n")) return err;
+        return getNull();
     });
-    builtins_["len"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+    builtins_["len"] = makeBuiltin([this](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() != 1) return newError("len: expected 1 argument");
-        if (auto s = std::dynamic_pointer_cast<String>(args[0])) return newInteger((int64_t)s->value.size());
-        if (auto a = std::dynamic_pointer_cast<Array>(args[0])) return newInteger((int64_t)a->elements.size());
-        if (auto m = std::dynamic_pointer_cast<Map>(args[0])) return newInteger((int64_t)m->pairs.size());
-        return newError("len: unsupported type");
+        if (auto n = lengthOf(args[0]); n >= 0) return newInteger(n);
+        auto result = callProtocol(args[0], "__len__");
+        if (!result) return newError("len: unsupported type");
+        if (isError(result) || isSignal(result)) return result;
+        auto n = std::dynamic_pointer_cast<Integer>(result);
+        if (!n || n->value < 0) return native::typeError("len", "__len__ must return a non-negative integer, got " + repr(result));
+        return n;
     });
     builtins_["str"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() != 1) return newError("str: expected 1 argument");
         if (auto s = std::dynamic_pointer_cast<String>(args[0])) return s;
         return newString(args[0]->inspect());
     });
+    builtins_["repr"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return newError("repr: expected 1 argument");
+        return newString(repr(args[0]));
+    });
+    // pprint(value, indent?, max_depth?, width?) prints value laid out by pretty();
+    // inspect(...) returns the same text
+    auto prettyOptions = [](const std::vector<ObjectPtr>& args, const char* name, PrettyOptions* options) -> ObjectPtr {
+        if (args.empty() || args.size() > 4) return newError("%s: expected 1-4 arguments", name);
+        for (size_t i = 1; i < args.size(); i++)
+            if (!std::dynamic_pointer_cast<Integer>(args[i])) return newError("%s: options must be integers", name);
+        if (args.size() > 1) options->indent = static_cast<int>(std::max<int64_t>(0, asInt(args[1])));
+        if (args.size() > 2) options->maxDepth = static_cast<int>(asInt(args[2]));
+        if (args.size() > 3) options->width = static_cast<int>(std::max<int64_t>(0, asInt(args[3])));
+        return nullptr;
+    };
+    builtins_["pprint"] = makeBuiltin([prettyOptions](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        PrettyOptions options;
+        if (auto err = prettyOptions(args, "pprint", &options)) return err;
+        if (auto err = native::writeOutput("pprint", pretty(args[0], options) + "\n")) return err;
+        return getNull();
+    });
+    builtins_["inspect"] = makeBuiltin([prettyOptions](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        PrettyOptions options;
+        if (auto err = prettyOptions(args, "inspect", &options)) return err;
+        return newString(pretty(args[0], options));
+    });
     builtins_["int"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() != 1) return newError("int: expected 1 argument");
         if (auto i = std::dynamic_pointer_cast<Integer>(args[0])) return i;
         if (auto f = std::dynamic_pointer_cast<Float>(args[0])) return newInteger((int64_t)f->value);
+        if (auto d = std::dynamic_pointer_cast<Decimal>(args[0])) {
+            // Truncates toward zero, as for floats.
+            int64_t units = d->units;
+            for (int i = 0; i < d->scale; i++) units /= 10;
+            return newInteger(units);
+        }
         if (auto s = std::dynamic_pointer_cast<String>(args[0])) {
             try { return newInteger(std::stoll(s->value)); } catch (...) { return newError("int: cannot convert"); }
         }
@@ -805,11 +1855,23 @@ void Interpreter::initBuiltins() {
         if (args.size() != 1) return newError("float: expected 1 argument");
         if (auto f = std::dynamic_pointer_cast<Float>(args[0])) return f;
         if (auto i = std::dynamic_pointer_cast<Integer>(args[0])) return newFloat((double)i->value);
+        if (auto d = std::dynamic_pointer_cast<Decimal>(args[0])) return newFloat(decimalToDouble(*d));
         if (auto s = std::dynamic_pointer_cast<String>(args[0])) {
             try { return newFloat(std::stod(s->value)); } catch (...) { return newError("float: cannot convert"); }
         }
         return newError("float: unsupported type");
     });
+    // decimal(value, places?) -> a Decimal from a number or numeric string,
+    // rounded half to even (or padded) to places decimal places if given
+    builtins_["decimal"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.empty() || args.size() > 2) return newError("decimal: expected 1-2 arguments");
+        auto d = toDecimal(args[0]);
+        if (args.size() == 1 || d->type() != ObjectType::DECIMAL) return d;
+        auto places = std::dynamic_pointer_cast<Integer>(args[1]);
+        if (!places || places->value < 0 || places->value > DecimalMaxScale)
+            return newError("decimal: places must be an integer from 0 to %d", DecimalMaxScale);
+        return rescaleDecimal(*std::static_pointer_cast<Decimal>(d), static_cast<int>(places->value));
+    });
     builtins_["bool"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() != 1) return newError("bool: expected 1 argument");
         return nativeBoolToBooleanObject(isTruthy(args[0]));
@@ -818,6 +1880,150 @@ void Interpreter::initBuiltins() {
         if (args.size() != 1) return newError("type: expected 1 argument");
         return newString(ObjectTypeToString(args[0]->type()));
     });
+    // policy() -> {restricted, allow: {module: [functions or "*"]}}
+    // policy("fs.read_file") / policy("fs") -> whether the call or import is allowed
+    builtins_["policy"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        auto& policy = native::CapabilityPolicy::instance();
+        if (args.size() > 1) return newError("policy: expected 0-1 arguments");
+        if (args.size() == 1) {
+            auto s = std::dynamic_pointer_cast<String>(args[0]);
+            if (!s) return newError("policy: argument must be a string");
+            auto dot = s->value.find('.');
+            if (dot == std::string::npos) return nativeBoolToBooleanObject(policy.allowsModule(s->value));
+            return nativeBoolToBooleanObject(policy.allows(s->value.substr(0, dot), s->value.substr(dot + 1)));
+        }
+        std::vector<std::pair<ObjectPtr, ObjectPtr>> allow;
+        for (auto& [module, fns] : policy.grants()) {
+            std::vector<ObjectPtr> names;
+            for (auto& fn : fns) names.push_back(newString(fn));
+            allow.push_back({newString(module), newArray(names)});
+        }
+        return newMap({
+            {newString("restricted"), nativeBoolToBooleanObject(policy.restricted())},
+            {newString("allow"), newMap(allow)},
+        });
+    });
+    // Discovering native modules: modules() lists the ones this script may
+    // import and describe("mod") or describe("mod.fn") their functions, using
+    // the docs each module registers.
+    builtins_["modules"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (!args.empty()) return newError("modules: expected 0 arguments");
+        auto& registry = native::Registry::instance();
+        std::vector<ObjectPtr> names;
+        for (auto& name : registry.names())
+            if (native::CapabilityPolicy::instance().allowsModule(name)) names.push_back(newString(name));
+        return newArray(names);
+    });
+    builtins_["describe"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return newError("describe: expected 1 argument");
+        auto s = std::dynamic_pointer_cast<String>(args[0]);
+        if (!s) return newError("describe: argument must be a module or function name such as \"math\" or \"math.sqrt\"");
+        auto& registry = native::Registry::instance();
+        auto& policy = native::CapabilityPolicy::instance();
+        auto dot = s->value.find('.');
+        std::string modName = s->value.substr(0, dot);
+        const auto* mod = registry.get(modName);
+        if (!mod) {
+            auto hint = didYouMean(modName, registry.names());
+            return newError("describe: no native module '%s'%s", modName.c_str(), hint.empty() ? "" : ("; " + hint).c_str());
+        }
+        if (!policy.allowsModule(modName))
+            return newError("PermissionError: module '%s' is not allowed by the capability policy", modName.c_str());
+
+        auto describeFunction = [mod](const std::string& fn) {
+            native::FunctionDoc doc{"(...)", ""};
+            if (auto it = mod->docs.find(fn); it != mod->docs.end()) doc = it->second;
+            int min = 0, max = 0;
+            native::signatureArity(doc.signature, &min, &max);
+            return newMap({
+                {newString("name"), newString(mod->name + "." + fn)},
+                {newString("signature"), newString(mod->name + "." + fn + doc.signature)},
+                {newString("min_args"), newInteger(min)},
+                {newString("max_args"), max < 0 ? getNull() : newInteger(max)},
+                {newString("summary"), newString(doc.summary)},
+            });
+        };
+        if (dot != std::string::npos) {
+            std::string fn = s->value.substr(dot + 1);
+            if (!mod->functions.count(fn)) {
+                std::vector<std::string> names;
+                for (auto& [name, f] : mod->functions) names.push_back(name);
+                auto hint = didYouMean(fn, names);
+                return newError("describe: module '%s' has no function '%s'%s", modName.c_str(), fn.c_str(),
+                                hint.empty() ? "" : ("; " + hint).c_str());
+            }
+            if (!policy.allows(modName, fn))
+                return newError("PermissionError: %s is not allowed by the capability policy", s->value.c_str());
+            return describeFunction(fn);
+        }
+
+        std::vector<std::string> names;
+        for (auto& [name, f] : mod->functions)
+            if (policy.allows(modName, name)) names.push_back(name);
+        std::sort(names.begin(), names.end());
+        std::vector<ObjectPtr> functions;
+        for (auto& name : names) functions.push_back(describeFunction(name));
+        return newMap({
+            {newString("name"), newString(mod->name)},
+            {newString("summary"), newString(mod->summary)},
+            {newString("functions"), newArray(functions)},
+        });
+    });
+    // Object counts (when --memstats enabled them) and process memory.
+    builtins_["runtime_stats"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (!args.empty()) return newError("runtime_stats: expected 0 arguments");
+        std::vector<std::pair<ObjectPtr, ObjectPtr>> objects;
+        for (int i = 0; i < static_cast<int>(StatKind::Count); i++) {
+            auto kind = static_cast<StatKind>(i);
+            auto stats = objectStats(kind);
+            objects.push_back({newString(statKindName(kind)), newMap({
+                {newString("allocated"), newInteger(stats.allocated)},
+                {newString("live"), newInteger(stats.live)},
+                {newString("peak"), newInteger(stats.peak)},
+            })});
+        }
+        return newMap({
+            {newString("enabled"), nativeBoolToBooleanObject(objectStatsEnabled())},
+            {newString("objects"), newMap(objects)},
+            {newString("peak_rss_bytes"), newInteger(peakResidentBytes())},
+        });
+    });
+    // find_cycles(value) -> array of "path -> path" strings, one per reference
+    // from inside value back to a container or instance holding it
+    builtins_["find_cycles"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return newError("find_cycles: expected 1 argument");
+        std::vector<ObjectPtr> cycles;
+        for (auto& cycle : findCycles(args[0], "value")) cycles.push_back(newString(cycle));
+        return newArray(std::move(cycles));
+    });
+    // id(x) -> integer that no other live object shares; may be reused once x is gone
+    builtins_["id"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return newError("id: expected 1 argument");
+        if (!hasIdentity(args[0]))
+            return newError("id: %s values have no identity; compare them with ==", ObjectTypeToString(args[0]->type()));
+        return newInteger(static_cast<int64_t>(reinterpret_cast<intptr_t>(args[0].get())));
+    });
+    // weakref(x) -> reference to x that does not keep it alive
+    builtins_["weakref"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return newError("weakref: expected 1 argument");
+        if (!hasIdentity(args[0]))
+            return newError("weakref: %s values have no identity to refer to", ObjectTypeToString(args[0]->type()));
+        auto ref = std::make_shared<WeakRef>();
+        ref->target = args[0];
+        return ref;
+    });
+    // finalize(obj, fn, args...) -> null; fn(args...) is called once obj, an
+    // instance, is destroyed
+    builtins_["finalize"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() < 2) return newError("finalize: expected at least 2 arguments");
+        auto inst = std::dynamic_pointer_cast<Instance>(args[0]);
+        if (!inst) return newError("finalize: first argument must be an instance, got %s", ObjectTypeToString(args[0]->type()));
+        auto type = args[1]->type();
+        if (type != ObjectType::FUNCTION && type != ObjectType::BUILTIN && type != ObjectType::BOUND_METHOD)
+            return newError("finalize: second argument must be a function");
+        inst->finalizers.push_back({args[1], std::vector<ObjectPtr>(args.begin() + 2, args.end())});
+        return getNull();
+    });
     builtins_["range"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.empty() || args.size() > 3) return newError("range: expected 1-3 arguments");
         int64_t start = 0, stop = 0, step = 1;
@@ -826,30 +2032,106 @@ void Interpreter::initBuiltins() {
         else { start = asInt(args[0]); stop = asInt(args[1]); step = asInt(args[2]); }
         if (step == 0) return newError("range: step cannot be 0");
         std::vector<ObjectPtr> elems;
+        if ((step > 0 && stop > start) || (step < 0 && stop < start)) {
+            auto count = static_cast<size_t>((stop - start) / step + ((stop - start) % step != 0));
+            if (auto err = arraySizeError(count)) return err;
+            if (auto err = allocateElements("range", count, [&] { elems.reserve(count); })) return err;
+        }
         if (step > 0) { for (int64_t i = start; i < stop; i += step) elems.push_back(newInteger(i)); }
         else { for (int64_t i = start; i > stop; i += step) elems.push_back(newInteger(i)); }
-        return newArray(elems);
+        return newArray(std::move(elems));
     });
-    builtins_["abs"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+    builtins_["abs"] = makeBuiltin([this](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() != 1) return newError("abs: expected 1 argument");
-        if (auto i = std::dynamic_pointer_cast<Integer>(args[0])) return newInteger(i->value < 0 ? -i->value : i->value);
+        if (auto i = std::dynamic_pointer_cast<Integer>(args[0])) {
+            if (i->value >= 0) return i;
+            int64_t v;
+            bool overflowed = wrappingNeg(i->value, v);
+            infixToken_ = lastCall_ ? &lastCall_->token : nullptr;
+            return wrappedInteger(overflowed, v, "abs");
+        }
         if (auto f = std::dynamic_pointer_cast<Float>(args[0])) return newFloat(f->value < 0 ? -f->value : f->value);
+        if (auto d = std::dynamic_pointer_cast<Decimal>(args[0])) {
+            if (d->units == INT64_MIN) return overflowError("abs");
+            return d->units < 0 ? newDecimal(-d->units, d->scale) : d;
+        }
+        if (auto c = std::dynamic_pointer_cast<Complex>(args[0])) return newFloat(std::hypot(c->real, c->imag));
         return newError("abs: unsupported type");
     });
     builtins_["max"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.empty()) return newError("max: expected at least 1 argument");
+        if (args.size() == 1) {
+            if (auto a = std::dynamic_pointer_cast<IntArray>(args[0])) {
+                if (a->values.empty()) return newError("max: empty int_array");
+                return newInteger(*std::max_element(a->values.begin(), a->values.end()));
+            }
+            if (auto a = std::dynamic_pointer_cast<FloatArray>(args[0])) {
+                if (a->values.empty()) return newError("max: empty float_array");
+                return newFloat(*std::max_element(a->values.begin(), a->values.end()));
+            }
+        }
         ObjectPtr max = args[0];
         for (size_t i = 1; i < args.size(); i++) if (compareObjects(args[i], max) > 0) max = args[i];
         return max;
     });
     builtins_["min"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.empty()) return newError("min: expected at least 1 argument");
+        if (args.size() == 1) {
+            if (auto a = std::dynamic_pointer_cast<IntArray>(args[0])) {
+                if (a->values.empty()) return newError("min: empty int_array");
+                return newInteger(*std::min_element(a->values.begin(), a->values.end()));
+            }
+            if (auto a = std::dynamic_pointer_cast<FloatArray>(args[0])) {
+                if (a->values.empty()) return newError("min: empty float_array");
+                return newFloat(*std::min_element(a->values.begin(), a->values.end()));
+            }
+        }
         ObjectPtr min = args[0];
         for (size_t i = 1; i < args.size(); i++) if (compareObjects(args[i], min) < 0) min = args[i];
         return min;
     });
+    // Division with v2 and v1 integer semantics; lang v2 lowers '/' to
+    // true_div and `darix fix` rewrites v1 code to trunc_div.
+    builtins_["true_div"] = makeBuiltin([this](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 2) return newError("true_div: expected 2 arguments");
+        auto l = std::dynamic_pointer_cast<Integer>(args[0]);
+        auto r = std::dynamic_pointer_cast<Integer>(args[1]);
+        if (!l || !r) return evalInfixExpression("/", args[0], args[1]);
+        if (r->value == 0) return newExceptionSignal(std::dynamic_pointer_cast<Exception>(newException(ZERO_DIV_ERROR, "division by zero")));
+        return newFloat(static_cast<double>(l->value) / static_cast<double>(r->value));
+    });
+    builtins_["trunc_div"] = makeBuiltin([this](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 2) return newError("trunc_div: expected 2 arguments");
+        auto l = std::dynamic_pointer_cast<Integer>(args[0]);
+        auto r = std::dynamic_pointer_cast<Integer>(args[1]);
+        if (!l || !r) return evalInfixExpression("/", args[0], args[1]);
+        if (r->value == 0) return newExceptionSignal(std::dynamic_pointer_cast<Exception>(newException(ZERO_DIV_ERROR, "division by zero")));
+        int64_t v;
+        bool overflowed = wrappingDiv(l->value, r->value, v);
+        infixToken_ = lastCall_ ? &lastCall_->token : nullptr;
+        return wrappedInteger(overflowed, v, "/");
+    });
+    // Integer arithmetic that raises OverflowError instead of wrapping,
+    // whether or not --checked-arith is on. Other numbers use the operator.
+    for (auto [name, op] : {std::pair<const char*, const char*>{"checked_add", "+"}, {"checked_sub", "-"}, {"checked_mul", "*"}}) {
+        builtins_[name] = makeBuiltin([this, name, op = std::string(op)](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+            if (args.size() != 2) return newError("%s: expected 2 arguments", name);
+            auto l = std::dynamic_pointer_cast<Integer>(args[0]);
+            auto r = std::dynamic_pointer_cast<Integer>(args[1]);
+            if (!l || !r) return evalInfixExpression(op, args[0], args[1]);
+            int64_t v;
+            bool overflowed = op == "+"   ? wrappingAdd(l->value, r->value, v)
+                              : op == "-" ? wrappingSub(l->value, r->value, v)
+                                          : wrappingMul(l->value, r->value, v);
+            return overflowed ? overflowError(op) : newInteger(v);
+        });
+    }
     builtins_["sum"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() != 1) return newError("sum: expected 1 argument");
+        if (auto a = std::dynamic_pointer_cast<IntArray>(args[0]))
+            return newInteger(std::accumulate(a->values.begin(), a->values.end(), int64_t(0)));
+        if (auto a = std::dynamic_pointer_cast<FloatArray>(args[0]))
+            return newFloat(std::accumulate(a->values.begin(), a->values.end(), 0.0));
         auto arr = std::dynamic_pointer_cast<Array>(args[0]);
         if (!arr) return newError("sum: argument must be an array");
         int64_t intSum = 0; double floatSum = 0; bool hasFloat = false;
@@ -878,8 +2160,143 @@ void Interpreter::initBuiltins() {
         if (args.size() != 2) return newError("append: expected 2 arguments");
         auto arr = std::dynamic_pointer_cast<Array>(args[0]);
         if (!arr) return newError("append: first argument must be an array");
+        if (auto err = frozenError(arr)) return err;
+        if (auto err = arraySizeError(arr->elements.size() + 1)) return err;
         arr->elements.push_back(args[1]); return getNull();
     });
+    // array_with_capacity(n) -> empty array with room for n elements, so
+    // appending up to n elements never reallocates
+    builtins_["array_with_capacity"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return newError("array_with_capacity: expected 1 argument");
+        if (!std::dynamic_pointer_cast<Integer>(args[0])) return newError("array_with_capacity: capacity must be an integer");
+        int64_t n = asInt(args[0]);
+        if (n < 0) return newError("array_with_capacity: capacity must be non-negative");
+        if (auto err = arraySizeError(static_cast<size_t>(n))) return err;
+        auto arr = std::make_shared<Array>();
+        if (auto err = allocateElements("array_with_capacity", n, [&] { arr->elements.reserve(static_cast<size_t>(n)); }))
+            return err;
+        return arr;
+    });
+    // new_builder(initial?) -> empty builder, or one holding initial
+    builtins_["new_builder"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() > 1) return newError("new_builder: expected 0-1 arguments");
+        auto sb = std::make_shared<StringBuilder>();
+        if (!args.empty()) {
+            auto s = std::dynamic_pointer_cast<String>(args[0]);
+            if (!s) return newError("new_builder: initial value must be a string");
+            sb->value = s->value;
+        }
+        return sb;
+    });
+    // resize(arr, n, fill?) -> arr, truncated or padded with fill (default null) in place
+    builtins_["resize"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() < 2 || args.size() > 3) return newError("resize: expected 2-3 arguments");
+        auto arr = std::dynamic_pointer_cast<Array>(args[0]);
+        if (!arr) return newError("resize: first argument must be an array");
+        if (!std::dynamic_pointer_cast<Integer>(args[1])) return newError("resize: size must be an integer");
+        int64_t n = asInt(args[1]);
+        if (n < 0) return newError("resize: size must be non-negative");
+        if (auto err = frozenError(arr)) return err;
+        if (auto err = arraySizeError(static_cast<size_t>(n))) return err;
+        auto fill = args.size() == 3 ? args[2] : getNull();
+        if (auto err = allocateElements("resize", n, [&] { arr->elements.resize(static_cast<size_t>(n), fill); }))
+            return err;
+        return arr;
+    });
+    // int_array(arr | n) / float_array(arr | n) -> numeric buffer copied from an
+    // array of numbers, or n zeros
+    builtins_["int_array"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return newError("int_array: expected 1 argument");
+        if (auto n = std::dynamic_pointer_cast<Integer>(args[0])) {
+            if (n->value < 0) return newError("int_array: size must be non-negative");
+            return newIntArray(std::vector<int64_t>(static_cast<size_t>(n->value), 0));
+        }
+        if (auto f = std::dynamic_pointer_cast<FloatArray>(args[0]))
+            return newIntArray(std::vector<int64_t>(f->values.begin(), f->values.end()));
+        auto arr = std::dynamic_pointer_cast<Array>(args[0]);
+        if (!arr) return newError("int_array: argument must be an array or a size");
+        std::vector<int64_t> values;
+        values.reserve(arr->elements.size());
+        for (auto& elem : arr->elements) {
+            auto i = std::dynamic_pointer_cast<Integer>(elem);
+            if (!i) return newError("int_array: all elements must be integers");
+            values.push_back(i->value);
+        }
+        return newIntArray(std::move(values));
+    });
+    builtins_["float_array"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return newError("float_array: expected 1 argument");
+        if (auto n = std::dynamic_pointer_cast<Integer>(args[0])) {
+            if (n->value < 0) return newError("float_array: size must be non-negative");
+            return newFloatArray(std::vector<double>(static_cast<size_t>(n->value), 0.0));
+        }
+        if (auto i = std::dynamic_pointer_cast<IntArray>(args[0]))
+            return newFloatArray(std::vector<double>(i->values.begin(), i->values.end()));
+        auto arr = std::dynamic_pointer_cast<Array>(args[0]);
+        if (!arr) return newError("float_array: argument must be an array or a size");
+        std::vector<double> values;
+        values.reserve(arr->elements.size());
+        for (auto& elem : arr->elements) {
+            if (elem->type() != ObjectType::INTEGER && elem->type() != ObjectType::FLOAT)
+                return newError("float_array: all elements must be numbers");
+            values.push_back(asFloat(elem));
+        }
+        return newFloatArray(std::move(values));
+    });
+    // to_array(buf) -> regular array of the buffer's numbers
+    builtins_["to_array"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return newError("to_array: expected 1 argument");
+        std::vector<ObjectPtr> elems;
+        if (auto a = std::dynamic_pointer_cast<IntArray>(args[0])) {
+            elems.reserve(a->values.size());
+            for (auto v : a->values) elems.push_back(newInteger(v));
+        } else if (auto a = std::dynamic_pointer_cast<FloatArray>(args[0])) {
+            elems.reserve(a->values.size());
+            for (auto v : a->values) elems.push_back(newFloat(v));
+        } else {
+            return newError("to_array: argument must be an int_array or float_array");
+        }
+        return newArray(std::move(elems));
+    });
+    // scale(buf, k) -> new buffer with every element multiplied by k; an
+    // int_array scaled by a float becomes a float_array
+    builtins_["scale"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 2) return newError("scale: expected 2 arguments");
+        if (args[1]->type() != ObjectType::INTEGER && args[1]->type() != ObjectType::FLOAT)
+            return newError("scale: factor must be a number");
+        if (auto a = std::dynamic_pointer_cast<IntArray>(args[0])) {
+            if (auto k = std::dynamic_pointer_cast<Integer>(args[1])) {
+                std::vector<int64_t> out(a->values.size());
+                for (size_t i = 0; i < out.size(); i++) out[i] = a->values[i] * k->value;
+                return newIntArray(std::move(out));
+            }
+            double k = asFloat(args[1]);
+            std::vector<double> out(a->values.size());
+            for (size_t i = 0; i < out.size(); i++) out[i] = a->values[i] * k;
+            return newFloatArray(std::move(out));
+        }
+        if (auto a = std::dynamic_pointer_cast<FloatArray>(args[0])) {
+            double k = asFloat(args[1]);
+            std::vector<double> out(a->values.size());
+            for (size_t i = 0; i < out.size(); i++) out[i] = a->values[i] * k;
+            return newFloatArray(std::move(out));
+        }
+        return newError("scale: first argument must be an int_array or float_array");
+    });
+    // dot(a, b) -> sum of element-wise products of two equal-length buffers
+    builtins_["dot"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 2) return newError("dot: expected 2 arguments");
+        auto ia = std::dynamic_pointer_cast<IntArray>(args[0]), ib = std::dynamic_pointer_cast<IntArray>(args[1]);
+        auto fa = std::dynamic_pointer_cast<FloatArray>(args[0]), fb = std::dynamic_pointer_cast<FloatArray>(args[1]);
+        if ((!ia && !fa) || (!ib && !fb)) return newError("dot: arguments must be int_array or float_array");
+        size_t n = ia ? ia->values.size() : fa->values.size();
+        if (n != (ib ? ib->values.size() : fb->values.size())) return newError("dot: buffers must have the same length");
+        if (ia && ib) return newInteger(std::inner_product(ia->values.begin(), ia->values.end(), ib->values.begin(), int64_t(0)));
+        double total = 0.0;
+        for (size_t i = 0; i < n; i++)
+            total += (ia ? static_cast<double>(ia->values[i]) : fa->values[i]) * (ib ? static_cast<double>(ib->values[i]) : fb->values[i]);
+        return newFloat(total);
+    });
     builtins_["contains"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() != 2) return newError("contains: expected 2 arguments");
         if (auto s = std::dynamic_pointer_cast<String>(args[0]))
@@ -891,24 +2308,280 @@ void Interpreter::initBuiltins() {
         }
         return newError("contains: unsupported type");
     });
-    builtins_["exit"] = makeBuiltin([](const std::vector<ObjectPtr>&) -> ObjectPtr { std::exit(0); return getNull(); });
-    builtins_["ValueError"] = makeBuiltin([](const std::vector<ObjectPtr>& a) -> ObjectPtr {
-        return newException(VALUE_ERROR, a.size() > 0 ? a[0]->inspect() : "");
+    // zeros(rows, cols?) -> array of rows zeros, or rows arrays of cols zeros
+    builtins_["zeros"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.empty() || args.size() > 2) return newError("zeros: expected 1-2 arguments");
+        for (auto& a : args)
+            if (!std::dynamic_pointer_cast<Integer>(a) || asInt(a) < 0) return newError("zeros: sizes must be non-negative integers");
+        for (auto& a : args)
+            if (auto err = arraySizeError(static_cast<size_t>(asInt(a)))) return err;
+        auto row = [](int64_t n) { return newArray(std::vector<ObjectPtr>(static_cast<size_t>(n), newInteger(0))); };
+        if (args.size() == 1) return row(asInt(args[0]));
+        std::vector<ObjectPtr> rows;
+        rows.reserve(static_cast<size_t>(asInt(args[0])));
+        for (int64_t r = 0; r < asInt(args[0]); r++) rows.push_back(row(asInt(args[1])));
+        return newArray(std::move(rows));
     });
-    builtins_["TypeError"] = makeBuiltin([](const std::vector<ObjectPtr>& a) -> ObjectPtr {
-        return newException(TYPE_ERROR, a.size() > 0 ? a[0]->inspect() : "");
+    // transpose(matrix) -> new array of arrays with rows and columns swapped
+    builtins_["transpose"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return newError("transpose: expected 1 argument");
+        auto m = std::dynamic_pointer_cast<Array>(args[0]);
+        if (!m) return newError("transpose: argument must be an array of arrays");
+        std::vector<std::shared_ptr<Array>> rows;
+        for (auto& elem : m->elements) {
+            auto row = std::dynamic_pointer_cast<Array>(elem);
+            if (!row) return newError("transpose: argument must be an array of arrays");
+            if (!rows.empty() && row->elements.size() != rows[0]->elements.size())
+                return newError("transpose: rows must have the same length");
+            rows.push_back(row);
+        }
+        size_t cols = rows.empty() ? 0 : rows[0]->elements.size();
+        std::vector<ObjectPtr> out;
+        out.reserve(cols);
+        for (size_t c = 0; c < cols; c++) {
+            std::vector<ObjectPtr> col;
+            col.reserve(rows.size());
+            for (auto& row : rows) col.push_back(row->elements[c]);
+            out.push_back(newArray(std::move(col)));
+        }
+        return newArray(std::move(out));
+    });
+    // flatten(arr, depth?) -> new array with nested arrays spliced in, depth
+    // levels deep (default: all of them)
+    builtins_["flatten"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.empty() || args.size() > 2) return newError("flatten: expected 1-2 arguments");
+        auto arr = std::dynamic_pointer_cast<Array>(args[0]);
+        if (!arr) return newError("flatten: first argument must be an array");
+        int64_t depth = INT64_MAX;
+        if (args.size() == 2) {
+            if (!std::dynamic_pointer_cast<Integer>(args[1]) || asInt(args[1]) < 0) return newError("flatten: depth must be a non-negative integer");
+            depth = asInt(args[1]);
+        }
+        std::vector<ObjectPtr> out;
+        flattenInto(*arr, depth, out);
+        return newArray(std::move(out));
     });
-    builtins_["RuntimeError"] = makeBuiltin([](const std::vector<ObjectPtr>& a) -> ObjectPtr {
-        return newException(RUNTIME_ERROR, a.size() > 0 ? a[0]->inspect() : "");
+    // reshape(arr, rows, cols) -> rows arrays of cols elements, filled row by
+    // row from arr's elements after flattening it
+    builtins_["reshape"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 3) return newError("reshape: expected 3 arguments");
+        auto arr = std::dynamic_pointer_cast<Array>(args[0]);
+        if (!arr) return newError("reshape: first argument must be an array");
+        if (!std::dynamic_pointer_cast<Integer>(args[1]) || !std::dynamic_pointer_cast<Integer>(args[2]) || asInt(args[1]) < 0 || asInt(args[2]) < 0)
+            return newError("reshape: sizes must be non-negative integers");
+        std::vector<ObjectPtr> flat;
+        flattenInto(*arr, INT64_MAX, flat);
+        int64_t rows = asInt(args[1]), cols = asInt(args[2]);
+        // rows * cols is checked by division so huge sizes cannot overflow
+        bool fits = cols == 0 ? flat.empty() : rows == static_cast<int64_t>(flat.size()) / cols && flat.size() % cols == 0;
+        if (!fits)
+            return newError("reshape: cannot fit %zu elements into %lld x %lld", flat.size(),
+                            static_cast<long long>(rows), static_cast<long long>(cols));
+        std::vector<ObjectPtr> out;
+        out.reserve(static_cast<size_t>(rows));
+        for (int64_t r = 0; r < rows; r++)
+            out.push_back(newArray(std::vector<ObjectPtr>(flat.begin() + r * cols, flat.begin() + (r + 1) * cols)));
+        return newArray(std::move(out));
     });
-    builtins_["IndexError"] = makeBuiltin([](const std::vector<ObjectPtr>& a) -> ObjectPtr {
-        return newException(INDEX_ERROR, a.size() > 0 ? a[0]->inspect() : "");
+    // deep_map(fn, value) -> value with every non-array element, however deeply
+    // nested, replaced by fn(element); the nesting is copied, not modified
+    builtins_["deep_map"] = makeBuiltin([this](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 2) return newError("deep_map: expected 2 arguments");
+        std::function<ObjectPtr(const ObjectPtr&)> map = [&](const ObjectPtr& value) -> ObjectPtr {
+            auto arr = std::dynamic_pointer_cast<Array>(value);
+            if (!arr) return applyFunction(args[0], {value});
+            std::vector<ObjectPtr> out;
+            out.reserve(arr->elements.size());
+            for (auto& elem : arr->elements) {
+                auto mapped = map(elem);
+                if (isError(mapped) || isSignal(mapped)) return mapped;
+                out.push_back(mapped);
+            }
+            return newArray(std::move(out));
+        };
+        return map(args[1]);
+    });
+    // parallel_map(fn, array, workers?) -> array of fn(elem), in input order.
+    // Each worker calls its own deep copy of fn's closure, so assignments made
+    // by one worker are never seen by another or by the caller, and workers
+    // other than the calling thread run it on an interpreter of their own.
+    builtins_["parallel_map"] = makeBuiltin([this](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() < 2 || args.size() > 3) return newError("parallel_map: expected 2-3 arguments");
+        auto arr = std::dynamic_pointer_cast<Array>(args[1]);
+        if (!arr) return newError("parallel_map: second argument must be an array");
+        int64_t workers = args.size() == 3 ? asInt(args[2]) : (int64_t)std::thread::hardware_concurrency();
+        if (workers <= 0) workers = 1;
+        if (workers > (int64_t)arr->elements.size()) workers = (int64_t)arr->elements.size();
+        if (workers == 0) return newArray({});
+
+        // Clone inputs up front on the calling thread
+        size_t n = arr->elements.size();
+        std::vector<std::unique_ptr<Interpreter>> evaluators(workers);
+        std::vector<ObjectPtr> fns(workers);
+        std::vector<ObjectPtr> inputs(n);
+        for (int64_t w = 0; w < workers; w++) {
+            WorkerClone c;
+            if (w > 0) {
+                evaluators[w] = worker();
+                for (auto& [name, builtin] : builtins_) c.objects[builtin.get()] = evaluators[w]->builtins_[name];
+            }
+            fns[w] = c.value(args[0]);
+        }
+        { WorkerClone c; for (size_t i = 0; i < n; i++) inputs[i] = c.value(arr->elements[i]); }
+
+        std::vector<ObjectPtr> results(n);
+        std::atomic<size_t> next{0};
+        auto work = [&](int64_t w) {
+            Interpreter* evaluator = this;
+            if (w > 0) {
+                evaluator = evaluators[w].get();
+                evaluator->bindNative();
+                // Handles a worker opens outlive it, like its results.
+                native::setHandleOwner(this);
+            }
+            for (size_t i = next++; i < n; i = next++) {
+                try {
+                    results[i] = evaluator->applyFunction(fns[w], {inputs[i]});
+                } catch (const std::exception& e) {
+                    results[i] = newExceptionSignal(std::dynamic_pointer_cast<Exception>(
+                        newException(RUNTIME_ERROR, std::string("parallel_map: worker failed: ") + e.what())));
+                }
+            }
+        };
+        std::vector<std::thread> threads;
+        for (int64_t w = 1; w < workers; w++) threads.emplace_back(work, w);
+        work(0);
+        for (auto& t : threads) t.join();
+
+        for (auto& r : results) if (isError(r) || isSignal(r)) return r;
+        return newArray(results);
+    });
+    builtins_["env"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() > 2) return newError("env: expected 0-2 arguments");
+        if (args.empty()) {
+            std::vector<std::pair<ObjectPtr, ObjectPtr>> pairs;
+            for (char** e = environ; e && *e; e++) {
+                std::string entry = *e;
+                size_t eq = entry.find('=');
+                if (eq == std::string::npos || eq == 0) continue;
+                if (!native::CapabilityPolicy::instance().allowsEnv(entry.substr(0, eq))) continue;
+                pairs.push_back({newString(entry.substr(0, eq)), newString(entry.substr(eq + 1))});
+            }
+            return newMap(pairs);
+        }
+        auto name = std::dynamic_pointer_cast<String>(args[0]);
+        if (!name) return newError("env: name must be a string");
+        if (!native::CapabilityPolicy::instance().allowsEnv(name->value))
+            return newError("PermissionError: env: environment variable '%s' is not allowed by the policy", name->value.c_str());
+        const char* v = std::getenv(name->value.c_str());
+        if (v) return newString(v);
+        return args.size() == 2 ? args[1] : getNull();
+    });
+    builtins_["expand_env"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return newError("expand_env: expected 1 argument");
+        auto s = std::dynamic_pointer_cast<String>(args[0]);
+        if (!s) return newError("expand_env: argument must be a string");
+        return newString(expandEnv(s->value, {}));
+    });
+    builtins_["load_env"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() > 2) return newError("load_env: expected 0-2 arguments");
+        std::string path = args.empty() ? ".env" : args[0]->inspect();
+        bool override = args.size() == 2 && isTruthy(args[1]);
+        auto& policy = native::CapabilityPolicy::instance();
+        if (!policy.allowsPath(path))
+            return newError("PermissionError: load_env: '%s' is outside the policy's fs_roots", path.c_str());
+        std::ifstream file(path);
+        if (!file.is_open()) return newError("load_env: cannot open file '%s'", path.c_str());
+        std::stringstream buffer;
+        buffer << file.rdbuf();
+        std::vector<std::pair<std::string, std::string>> vars;
+        std::string error;
+        if (!parseDotenv(buffer.str(), vars, error)) return newError("load_env: %s: %s", path.c_str(), error.c_str());
+        // Variables already set in the environment win unless override is true
+        for (auto& [k, v] : vars)
+            if (!policy.allowsEnv(k))
+                return newError("PermissionError: load_env: environment variable '%s' is not allowed by the policy", k.c_str());
+        std::vector<std::pair<ObjectPtr, ObjectPtr>> pairs;
+        for (auto& [k, v] : vars) {
+            if (const char* existing = std::getenv(k.c_str()); existing && !override) {
+                pairs.push_back({newString(k), newString(existing)});
+                continue;
+            }
+#ifdef _WIN32
+            _putenv_s(k.c_str(), v.c_str());
+#else
+            setenv(k.c_str(), v.c_str(), 1);
+#endif
+            pairs.push_back({newString(k), newString(v)});
+        }
+        return newMap(pairs);
     });
-    builtins_["KeyError"] = makeBuiltin([](const std::vector<ObjectPtr>& a) -> ObjectPtr {
-        return newException(KEY_ERROR, a.size() > 0 ? a[0]->inspect() : "");
+    builtins_["exit"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() > 1) return newError("exit: expected 0-1 arguments");
+        if (args.empty() || args[0]->type() == ObjectType::NULL_OBJ) return newScriptExit(0);
+        auto code = std::dynamic_pointer_cast<Integer>(args[0]);
+        if (!code) return native::typeError("exit", "code must be an integer, got " + repr(args[0]));
+        return newScriptExit(code->value);
     });
-    builtins_["ZeroDivisionError"] = makeBuiltin([](const std::vector<ObjectPtr>& a) -> ObjectPtr {
-        return newException(ZERO_DIV_ERROR, a.size() > 0 ? a[0]->inspect() : "");
+    // ValueError("bad", {"field": "age"}): the optional map is the exception's data.
+    auto makeExceptionType = [&makeBuiltin](const char* exType) {
+        return makeBuiltin([exType](const std::vector<ObjectPtr>& a) -> ObjectPtr {
+            if (a.size() > 2) return newError("%s: expected 0-2 arguments", exType);
+            if (a.size() == 2 && a[1]->type() != ObjectType::MAP && a[1]->type() != ObjectType::NULL_OBJ)
+                return newError("%s: data must be a map", exType);
+            auto ex = std::static_pointer_cast<Exception>(newException(exType, a.size() > 0 ? a[0]->inspect() : ""));
+            if (a.size() == 2 && a[1]->type() == ObjectType::MAP) ex->data = a[1];
+            return ex;
+        });
+    };
+    for (const char* exType : {VALUE_ERROR, TYPE_ERROR, RUNTIME_ERROR, INDEX_ERROR, KEY_ERROR, ZERO_DIV_ERROR})
+        builtins_[exType] = makeExceptionType(exType);
+    // retry(fn, attempts, backoff_ms?, catch_types?) -> fn()'s result. Calls fn
+    // again while it raises one of catch_types (a name or an array of names,
+    // groups included; every exception by default), waiting backoff_ms and
+    // doubling the wait after each failure. The last failure is re-raised.
+    builtins_["retry"] = makeBuiltin([this](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() < 2 || args.size() > 4) return newError("retry: expected 2-4 arguments");
+        auto attempts = std::dynamic_pointer_cast<Integer>(args[1]);
+        if (!attempts || attempts->value < 1) return newError("retry: attempts must be a positive integer");
+        int64_t wait = 0;
+        if (args.size() >= 3) {
+            auto backoff = std::dynamic_pointer_cast<Integer>(args[2]);
+            if (!backoff || backoff->value < 0) return newError("retry: backoff_ms must be a non-negative integer");
+            wait = backoff->value;
+        }
+        std::vector<std::string> catchTypes;
+        if (args.size() == 4) {
+            if (auto name = std::dynamic_pointer_cast<String>(args[3])) {
+                catchTypes.push_back(name->value);
+            } else if (auto names = std::dynamic_pointer_cast<Array>(args[3])) {
+                for (auto& n : names->elements) {
+                    auto s = std::dynamic_pointer_cast<String>(n);
+                    if (!s) return newError("retry: catch_types must be strings");
+                    catchTypes.push_back(s->value);
+                }
+            } else {
+                return newError("retry: catch_types must be a string or an array of strings");
+            }
+        }
+        if (catchTypes.empty()) catchTypes.push_back(ANY_EXCEPTION);
+        for (int64_t attempt = 1;; attempt++) {
+            auto result = applyFunction(args[0], {});
+            auto sig = std::dynamic_pointer_cast<ExceptionSignal>(result);
+            if (!sig || !sig->exception || attempt == attempts->value) return result;
+            bool retryable = false;
+            for (auto& t : catchTypes) retryable = retryable || exceptionMatches(sig->exception->exceptionType, t);
+            if (!retryable) return result;
+            // Sleeps in slices so a host stop is not held up by a long wait.
+            auto until = std::chrono::steady_clock::now() + std::chrono::milliseconds(wait);
+            while (std::chrono::steady_clock::now() < until) {
+                if (stop_->load(std::memory_order_relaxed)) return interrupted();
+                auto left = until - std::chrono::steady_clock::now();
+                std::this_thread::sleep_for(std::min<std::chrono::steady_clock::duration>(left, std::chrono::milliseconds(10)));
+            }
+            // Doubling stops at a day, which keeps the deadline in range.
+            if (wait < 86400000) wait *= 2;
+        }
     });
     builtins_["keys"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() != 1) return newError("keys: expected 1 argument");
@@ -953,6 +2626,143 @@ void Interpreter::initBuiltins() {
         std::sort(sorted.begin(), sorted.end(), [](const ObjectPtr& a, const ObjectPtr& b) { return compareObjects(a, b) < 0; });
         return newArray(sorted);
     });
+    // signature(fn) -> {name, signature, parameters, defaults, varargs,
+    // min_args, max_args, builtin, file, line, column} for a script function,
+    // method, class (its __init__) or builtin. Script functions have no
+    // defaults: arguments left out are null.
+    builtins_["signature"] = makeBuiltin([](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return newError("signature: expected 1 argument");
+        std::string name;
+        std::vector<std::string> params;
+        int min = 0, max = 0;
+        bool varargs = false;
+        std::string rest; // "args..." in "(fmt, args...)"
+        const Function* func = nullptr;
+        bool method = false;
+        if (auto b = std::dynamic_pointer_cast<Builtin>(args[0])) {
+            name = b->name;
+            std::string sig = b->signature.empty() ? "(...)" : b->signature;
+            native::signatureArity(sig, &min, &max);
+            std::string list = sig.substr(sig.find('(') + 1);
+            std::istringstream in(list.substr(0, list.find(')')));
+            for (std::string param; std::getline(in, param, ',');) {
+                param.erase(0, param.find_first_not_of(' '));
+                param.erase(param.find_last_not_of(' ') + 1);
+                if (param.size() >= 3 && param.compare(param.size() - 3, 3, "...") == 0) {
+                    varargs = true;
+                    rest = param;
+                    break;
+                }
+                if (!param.empty() && param.back() == '?') param.pop_back();
+                if (!param.empty()) params.push_back(param);
+            }
+        } else if (auto fn = std::dynamic_pointer_cast<Function>(args[0])) {
+            func = fn.get();
+            name = fn->name.empty() ? "<lambda>" : fn->name;
+        } else if (auto bm = std::dynamic_pointer_cast<BoundMethod>(args[0])) {
+            func = bm->fn.get();
+            name = bm->self->cls->name + "." + bm->fn->name;
+            method = true;
+        } else if (auto cls = std::dynamic_pointer_cast<Class>(args[0])) {
+            func = cls->method("__init__").get();
+            name = cls->name;
+            method = true;
+        } else {
+            return newError("signature: argument must be a function, method, class or builtin, got %s",
+                            ObjectTypeToString(args[0]->type()));
+        }
+        if (func) {
+            // Methods are called without self, as their bound form is.
+            for (auto& p : func->parameters)
+                if (!method || p->value != "self") params.push_back(p->value);
+            min = max = static_cast<int>(params.size());
+        }
+        std::vector<ObjectPtr> names;
+        std::vector<std::pair<ObjectPtr, ObjectPtr>> defaults;
+        std::string text = name + "(";
+        for (size_t i = 0; i < params.size(); i++) {
+            names.push_back(newString(params[i]));
+            bool optional = static_cast<int>(i) >= min;
+            if (optional) defaults.push_back({newString(params[i]), getNull()});
+            text += (i ? ", " : "") + params[i] + (optional ? "?" : "");
+        }
+        if (varargs) text += (params.empty() ? "" : ", ") + rest;
+        text += ")";
+        auto position = [&](int value) -> ObjectPtr { return func ? newInteger(value) : getNull(); };
+        return newMap({
+            {newString("name"), newString(name)},
+            {newString("signature"), newString(text)},
+            {newString("parameters"), newArray(names)},
+            {newString("defaults"), newMap(defaults)},
+            {newString("varargs"), nativeBoolToBooleanObject(varargs)},
+            {newString("min_args"), newInteger(min)},
+            {newString("max_args"), varargs ? getNull() : newInteger(max)},
+            {newString("builtin"), nativeBoolToBooleanObject(!func && !method)},
+            {newString("file"), func ? newString(func->token.file) : getNull()},
+            {newString("line"), position(func ? func->token.line : 0)},
+            {newString("column"), position(func ? func->token.column : 0)},
+        });
+    });
+    // Parameter lists for signature() and the argument count checks, in the
+    // form native modules document theirs.
+    static const std::unordered_map<std::string, std::string> signatures = {
+        {"print", "(values...)"}, {"len", "(x)"}, {"str", "(x)"}, {"repr", "(x)"},
+        {"pprint", "(value, indent?, max_depth?, width?)"}, {"inspect", "(value, indent?, max_depth?, width?)"},
+        {"int", "(x)"}, {"float", "(x)"}, {"decimal", "(value, places?)"}, {"bool", "(x)"}, {"type", "(x)"},
+        {"policy", "(name?)"}, {"modules", "()"}, {"describe", "(name)"}, {"runtime_stats", "()"},
+        {"id", "(x)"}, {"find_cycles", "(value)"}, {"weakref", "(x)"}, {"finalize", "(obj, fn, args...)"},
+        {"signature", "(fn)"}, {"range", "(start, stop?, step?)"}, {"abs", "(x)"}, {"max", "(values, ...)"},
+        {"min", "(values, ...)"}, {"true_div", "(a, b)"}, {"trunc_div", "(a, b)"}, {"checked_add", "(a, b)"},
+        {"checked_sub", "(a, b)"}, {"checked_mul", "(a, b)"}, {"sum", "(arr)"}, {"sorted", "(arr)"},
+        {"reverse", "(arr)"}, {"append", "(arr, value)"}, {"array_with_capacity", "(n)"},
+        {"new_builder", "(initial?)"}, {"resize", "(arr, n, fill?)"}, {"int_array", "(arr)"},
+        {"float_array", "(arr)"}, {"to_array", "(buf)"}, {"scale", "(buf, k)"}, {"dot", "(a, b)"},
+        {"contains", "(container, value)"}, {"zeros", "(rows, cols?)"}, {"transpose", "(matrix)"},
+        {"flatten", "(arr, depth?)"}, {"reshape", "(arr, rows, cols)"}, {"deep_map", "(fn, value)"},
+        {"parallel_map", "(fn, array, workers?)"}, {"env", "(name?, default?)"}, {"expand_env", "(s)"},
+        {"load_env", "(path?, override?)"}, {"exit", "(code?)"},
+        {"retry", "(fn, attempts, backoff_ms?, catch_types?)"}, {"keys", "(m)"}, {"values", "(m)"},
+        {"items", "(m)"}, {"sort", "(arr)"},
+    };
+    for (auto& [name, builtin] : builtins_) {
+        builtin->name = name;
+        if (auto it = signatures.find(name); it != signatures.end()) setSignature(*builtin, it->second);
+    }
+    for (const char* exType : {VALUE_ERROR, TYPE_ERROR, RUNTIME_ERROR, INDEX_ERROR, KEY_ERROR, ZERO_DIV_ERROR})
+        setSignature(*builtins_[exType], "(message?, data?)");
+}
+
+// Whether a native function takes a function to call (an fn parameter in its
+// signature), which cannot be a compiled one.
+static bool takesFunction(const native::NativeModule& mod, const std::string& fnName) {
+    auto doc = mod.docs.find(fnName);
+    if (doc == mod.docs.end()) return false;
+    const auto& sig = doc->second.signature;
+    for (const char* param : {"(fn,", "(fn)", " fn,", " fn)"})
+        if (sig.find(param) != std::string::npos) return true;
+    return false;
+}
+
+std::shared_ptr<Builtin> Interpreter::bytecodeBuiltin(const std::string& name, std::string* why) const {
+    static const std::unordered_set<std::string> takesFunctions = {"deep_map", "parallel_map", "retry", "signature", "finalize"};
+    auto reject = [why](const char* reason) -> std::shared_ptr<Builtin> {
+        if (why) *why = reason;
+        return nullptr;
+    };
+    if (auto dot = name.find('.'); dot != std::string::npos) {
+        std::string modName = name.substr(0, dot), fnName = name.substr(dot + 1);
+        const auto* nativeMod = native::Registry::instance().get(modName);
+        if (!nativeMod || !nativeMod->functions.count(fnName)) return nullptr;
+        if (takesFunction(*nativeMod, fnName)) return reject("takes a function argument");
+        if (!native::CapabilityPolicy::instance().allowsModule(modName))
+            return reject("is not allowed by the capability policy");
+        return nativeFunction(*nativeMod, modName, fnName);
+    }
+    auto it = builtins_.find(name);
+    if (it == builtins_.end()) return nullptr;
+    if (takesFunctions.count(name)) return reject("takes a function argument");
+    if (!it->second->deprecated.empty()) return reject("is deprecated");
+    return it->second;
 }
 
 } // namespace darix
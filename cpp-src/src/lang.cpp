@@ -0,0 +1,167 @@
+#include "darix/lang.hpp"
+#include "darix/ast_walk.hpp"
+#include "darix/lexer.hpp"
+#include "darix/parser.hpp"
+#include <algorithm>
+#include <cstring>
+#include <sstream>
+
+namespace darix {
+
+static int defaultVersion = MinLanguageVersion;
+static const char* Pragma = "// darix: lang=";
+
+const char* const IntegerDivisionWarning =
+    "'/' on two integers truncates; under lang v2 it returns a float (darix fix rewrites it to trunc_div)";
+
+int defaultLanguageVersion() { return defaultVersion; }
+void setDefaultLanguageVersion(int version) { defaultVersion = version; }
+
+bool parseLanguageVersion(const std::string& text, int* version, std::string* error) {
+    std::string digits = !text.empty() && text[0] == 'v' ? text.substr(1) : text;
+    int v = 0;
+    bool ok = !digits.empty() && digits.size() < 4 && std::all_of(digits.begin(), digits.end(), ::isdigit);
+    if (ok) v = std::stoi(digits);
+    if (!ok || v < MinLanguageVersion || v > LatestLanguageVersion) {
+        *error = "unknown language version '" + text + "' (this runtime supports v" + std::to_string(MinLanguageVersion) +
+                 " to v" + std::to_string(LatestLanguageVersion) + ")";
+        return false;
+    }
+    *version = v;
+    return true;
+}
+
+// Scans the leading comment and blank lines for the pragma.
+int sourceLanguageVersion(const std::string& source) {
+    std::istringstream lines(source);
+    std::string line;
+    while (std::getline(lines, line)) {
+        auto start = line.find_first_not_of(" \t\r");
+        if (start == std::string::npos) continue;
+        if (line.compare(start, 2, "//") != 0) break;
+        if (line.compare(start, std::strlen(Pragma), Pragma) != 0) continue;
+        auto value = line.substr(start + std::strlen(Pragma));
+        value.erase(value.find_last_not_of(" \t\r") + 1);
+        int version;
+        std::string error;
+        if (parseLanguageVersion(value, &version, &error)) return version;
+    }
+    return defaultVersion;
+}
+
+static bool strictByDefault = false;
+
+bool defaultStrictMode() { return strictByDefault; }
+void setDefaultStrictMode(bool strict) { strictByDefault = strict; }
+
+bool hasStrictPragma(Program* program) {
+    if (program->statements.empty()) return false;
+    auto es = dynamic_cast<ExpressionStatement*>(program->statements[0].get());
+    auto lit = es ? dynamic_cast<StringLiteral*>(es->expression.get()) : nullptr;
+    return lit && lit->value == "use strict";
+}
+
+static InfixExpression* asDivision(Node* node) {
+    auto ix = dynamic_cast<InfixExpression*>(node);
+    return ix && ix->op == "/" ? ix : nullptr;
+}
+
+static ExpressionPtr callBuiltin(const std::string& name, InfixExpression& div) {
+    auto fn = std::make_shared<Identifier>();
+    fn->tag = NodeType::IDENTIFIER;
+    fn->token = div.token;
+    fn->token.type = TokenType::IDENT;
+    fn->token.literal = name;
+    fn->value = name;
+    fn->span = div.span;
+    auto call = std::make_shared<CallExpression>();
+    call->tag = NodeType::CALL_EXPRESSION;
+    call->token = div.token;
+    call->function = fn;
+    call->arguments = {div.left, div.right};
+    call->span = div.span;
+    return call;
+}
+
+void applyLanguageVersion(Program* program, int version) {
+    if (version < 2) return;
+    walk::Rewriter r;
+    r.expression = [](const ExpressionPtr& expr) -> ExpressionPtr {
+        if (!asDivision(expr.get())) return expr;
+        return callBuiltin("true_div", *std::dynamic_pointer_cast<InfixExpression>(expr));
+    };
+    walk::rewrite(program, r);
+}
+
+namespace {
+
+// Rebuilds source text with the divisions to migrate wrapped in trunc_div,
+// copying everything else verbatim.
+struct Migrator {
+    const std::string& src;
+    int changes = 0;
+
+    static bool migrates(InfixExpression* div) {
+        return !dynamic_cast<FloatLiteral*>(div->left.get()) && !dynamic_cast<FloatLiteral*>(div->right.get());
+    }
+
+    // Divisions inside node that are not nested in another division.
+    std::vector<InfixExpression*> outermost(Node* node) {
+        std::vector<InfixExpression*> found;
+        walk::children(node, [&](Node* child) {
+            walk::inspect(child, [&](Node* n) {
+                auto div = asDivision(n);
+                if (div) found.push_back(div);
+                return !div;
+            });
+        });
+        std::sort(found.begin(), found.end(), [](auto* a, auto* b) { return a->span.start < b->span.start; });
+        return found;
+    }
+
+    std::string text(Node* node) {
+        if (auto div = asDivision(node)) return division(div);
+        return spliced(node);
+    }
+
+    // node's source with each division below it replaced by its text.
+    std::string spliced(Node* node) {
+        std::string out;
+        int pos = node->span.start;
+        for (auto* div : outermost(node)) {
+            out += src.substr(pos, div->span.start - pos);
+            out += division(div);
+            pos = div->span.end;
+        }
+        return out + src.substr(pos, node->span.end - pos);
+    }
+
+    std::string division(InfixExpression* div) {
+        if (!migrates(div)) return spliced(div);
+        changes++;
+        return "trunc_div(" + text(div->left.get()) + ", " + text(div->right.get()) + ")";
+    }
+};
+
+} // namespace
+
+std::string fixSource(const std::string& source, const std::string& filename, int* changes, std::vector<std::string>* errors) {
+    *changes = 0;
+    Lexer lexer(source, filename);
+    Parser parser(lexer);
+    auto program = parser.parseProgram();
+    if (!parser.errors().empty()) {
+        *errors = parser.errors();
+        return "";
+    }
+    if (sourceLanguageVersion(source) >= 2) return source;
+
+    Migrator m{source};
+    program->span = {0, static_cast<int>(source.size())};
+    std::string body = m.text(program.get());
+    *changes = m.changes;
+
+    return std::string(Pragma) + "v" + std::to_string(LatestLanguageVersion) + "\n" + body;
+}
+
+} // namespace darix
@@ -0,0 +1,244 @@
+#include "darix/learn.hpp"
+#include "darix/interpreter.hpp"
+#include "darix/native/native.hpp"
+#include "darix/runner.hpp"
+#include <algorithm>
+#include <chrono>
+#include <condition_variable>
+#include <cstdlib>
+#include <filesystem>
+#include <fstream>
+#include <iostream>
+#include <mutex>
+#include <set>
+#include <thread>
+
+namespace darix {
+
+const std::vector<Lesson>& lessons() {
+    static const std::vector<Lesson> all = {
+        {"variables", "Variables",
+         "`var` declares a variable; later assignments drop the `var`:\n"
+         "    var count = 1\n"
+         "    count = count + 1\n"
+         "Task: declare a variable `answer` holding 42.",
+         "var answer = 42", "", "assert answer == 42, \"answer should be 42, it is \" + str(answer)"},
+        {"strings", "Strings",
+         "Strings join with `+`, and `str(x)` turns any value into text:\n"
+         "    var label = \"item \" + str(3)\n"
+         "A variable `name` is already defined.\n"
+         "Task: set `greeting` to \"Hello, \" followed by name and \"!\".",
+         "var greeting = \"Hello, \" + name + \"!\"", "var name = \"Dara\"",
+         "assert greeting == \"Hello, Dara!\", \"greeting is \" + repr(greeting) + \", expected \\\"Hello, Dara!\\\"\""},
+        {"arrays", "Arrays and loops",
+         "Arrays hold values in order; `append(xs, x)` adds one and `for (x in xs)` visits each.\n"
+         "`range(a, b)` gives the integers from a up to, not including, b.\n"
+         "Task: make `evens` an array of the even numbers from 0 to 10, in order.",
+         "var evens = []\nfor (n in range(0, 11)) { if (n % 2 == 0) { append(evens, n) } }", "",
+         "assert evens == [0, 2, 4, 6, 8, 10], \"evens is \" + str(evens)"},
+        {"conditions", "Conditions",
+         "`if`, `elif` and `else` choose between blocks:\n"
+         "    if (x > 10) { print(\"big\") } elif (x > 5) { print(\"medium\") } else { print(\"small\") }\n"
+         "Task: write `func sign(n)` returning \"negative\", \"zero\" or \"positive\".",
+         "func sign(n) {\n    if (n < 0) { return \"negative\" } elif (n == 0) { return \"zero\" }\n    return \"positive\"\n}", "",
+         "assert sign(-4) == \"negative\", \"sign(-4) should be negative\"\n"
+         "assert sign(0) == \"zero\", \"sign(0) should be zero\"\n"
+         "assert sign(7) == \"positive\", \"sign(7) should be positive\""},
+        {"loops", "Accumulating",
+         "A loop can build up a result step by step:\n"
+         "    var product = 1\n"
+         "    for (n in [2, 3, 4]) { product = product * n }\n"
+         "Task: set `total` to the sum of the integers from 1 to 100.",
+         "var total = 0\nfor (n in range(1, 101)) { total = total + n }", "",
+         "assert total == 5050, \"total is \" + str(total) + \", expected 5050\""},
+        {"maps", "Maps",
+         "Maps store values by key: `m[\"k\"] = v` sets one, and `for (k, v in m)` visits each pair.\n"
+         "A map `scores` is already defined.\n"
+         "Task: add \"cy\" with a score of 7 to scores, then set `best` to the name with the highest score.",
+         "scores[\"cy\"] = 7\nvar best = \"\"\nfor (k, v in scores) { if ((best == \"\") || (v > scores[best])) { best = k } }",
+         "var scores = {\"ana\": 3, \"ben\": 5}",
+         "assert scores[\"cy\"] == 7, \"scores has no cy: 7\"\n"
+         "assert best == \"cy\", \"best is \" + repr(best) + \", expected \\\"cy\\\"\""},
+        {"functions", "Functions as values",
+         "Functions are values: they can be passed to other functions and written inline:\n"
+         "    var double = func(x) { return x * 2 }\n"
+         "Task: write `func apply_twice(f, x)` returning f(f(x)).",
+         "func apply_twice(f, x) { return f(f(x)) }", "",
+         "assert apply_twice(func(n) { return n + 1 }, 1) == 3, \"apply_twice(add one, 1) should be 3\"\n"
+         "assert apply_twice(func(s) { return s + \"!\" }, \"hi\") == \"hi!!\", \"apply_twice should call f twice\""},
+        {"exceptions", "Exceptions",
+         "`try` runs a block and `catch` handles an exception raised inside it:\n"
+         "    try { risky() } catch (e) { print(\"failed:\", e.message) }\n"
+         "Dividing by zero raises an exception.\n"
+         "Task: write `func safe_div(a, b)` returning a / b, or null when that raises.",
+         "func safe_div(a, b) {\n    try { return a / b } catch (e) { return null }\n}", "",
+         "assert safe_div(7.0, 2) == 3.5, \"safe_div(7.0, 2) should be 3.5\"\n"
+         "assert safe_div(1, 0) == null, \"safe_div(1, 0) should be null\""},
+    };
+    return all;
+}
+
+// Runs code in interp with a deadline; the error or exception it ends with,
+// or null.
+static ObjectPtr runTimed(Interpreter& interp, Program* program, int timeoutMs) {
+    std::mutex mutex;
+    std::condition_variable done;
+    bool finished = false;
+    std::thread watchdog([&] {
+        std::unique_lock<std::mutex> lock(mutex);
+        if (!done.wait_for(lock, std::chrono::milliseconds(timeoutMs), [&] { return finished; })) interp.stop();
+    });
+    auto result = interp.interpret(program);
+    {
+        std::lock_guard<std::mutex> lock(mutex);
+        finished = true;
+    }
+    done.notify_one();
+    watchdog.join();
+    if (result && (result->type() == ObjectType::ERROR || result->type() == ObjectType::EXCEPTION_SIGNAL))
+        return result;
+    return nullptr;
+}
+
+static bool checkAnswerTimed(const Lesson& lesson, const std::string& answer, int timeoutMs, std::string* message) {
+    Interpreter interp;
+    const std::pair<const std::string*, const char*> steps[] = {
+        {&lesson.setup, "<setup>"}, {&answer, "<answer>"}, {&lesson.check, "<check>"}};
+    for (auto& [code, name] : steps) {
+        auto [program, errors] = parseSource(*code, name);
+        if (!errors.empty()) {
+            *message = errors[0];
+            return false;
+        }
+        if (auto failure = runTimed(interp, program.get(), timeoutMs)) {
+            auto signal = std::dynamic_pointer_cast<ExceptionSignal>(failure);
+            if (signal && signal->exception->exceptionType == ASSERTION_ERROR) *message = signal->exception->message;
+            else if (signal && signal->exception->exceptionType == INTERRUPT_ERROR)
+                *message = "stopped after " + std::to_string(timeoutMs) + " ms; is there a loop that never ends?";
+            else *message = failure->inspect();
+            return false;
+        }
+    }
+    return true;
+}
+
+bool checkAnswer(const Lesson& lesson, const std::string& answer, std::string* message) {
+    return checkAnswerTimed(lesson, answer, LearnOptions().timeoutMs, message);
+}
+
+std::string defaultLearnProgress() {
+#ifdef _WIN32
+    const char* home = std::getenv("USERPROFILE");
+#else
+    const char* home = std::getenv("HOME");
+#endif
+    if (!home) return "";
+    return (std::filesystem::path(home) / ".darix_learn").string();
+}
+
+static std::set<std::string> readProgress(const std::string& path) {
+    std::set<std::string> done;
+    std::ifstream file(path);
+    std::string line;
+    while (std::getline(file, line))
+        if (!line.empty()) done.insert(line);
+    return done;
+}
+
+static void saveProgress(const std::string& path, const std::set<std::string>& done) {
+    if (path.empty()) return;
+    std::ofstream file(path, std::ios::trunc);
+    for (auto& lesson : lessons())
+        if (done.count(lesson.id)) file << lesson.id << "\n";
+}
+
+// Index of the lesson named by its number (from 1) or id, or -1.
+static int findLesson(const std::string& name) {
+    auto& all = lessons();
+    for (size_t i = 0; i < all.size(); i++)
+        if (all[i].id == name || std::to_string(i + 1) == name) return static_cast<int>(i);
+    return -1;
+}
+
+int learn(std::istream& in, std::ostream& out, const LearnOptions& options) {
+    auto& all = lessons();
+    std::set<std::string> done = options.reset ? std::set<std::string>() : readProgress(options.progressPath);
+    if (options.reset) saveProgress(options.progressPath, done);
+    if (options.list) {
+        for (size_t i = 0; i < all.size(); i++)
+            out << (done.count(all[i].id) ? "[x] " : "[ ] ") << (i + 1) << ". " << all[i].title << " (" << all[i].id << ")\n";
+        return 0;
+    }
+    int current = 0;
+    if (!options.start.empty()) {
+        current = findLesson(options.start);
+        if (current < 0) {
+            std::cerr << "Unknown lesson " << options.start << " (see darix learn --list)\n";
+            return 1;
+        }
+    } else {
+        while (current < static_cast<int>(all.size()) && done.count(all[current].id)) current++;
+        if (current == static_cast<int>(all.size())) {
+            out << "All " << all.size() << " lessons are done. Use --reset to start over, or name a lesson to repeat it.\n";
+            return 0;
+        }
+    }
+    // Answers may only import the harmless modules.
+    std::string error;
+    native::CapabilityPolicy::instance().allow("math,string", &error);
+
+    out << "DariX tutorial: type your answer, then an empty line to check it.\n"
+        << "Commands: :hint, :skip, :quit.\n";
+    while (current < static_cast<int>(all.size())) {
+        const Lesson& lesson = all[current];
+        out << "\n== Lesson " << (current + 1) << "/" << all.size() << ": " << lesson.title << " ==\n" << lesson.text << "\n";
+        bool next = false;
+        while (!next) {
+            std::string answer, line;
+            out << "> " << std::flush;
+            bool ended = true;
+            while (std::getline(in, line)) {
+                ended = false;
+                if (line.empty()) break;
+                if (answer.empty() && line[0] == ':') {
+                    answer = line;
+                    break;
+                }
+                answer += line + "\n";
+                out << ". " << std::flush;
+            }
+            if (ended && answer.empty()) {
+                out << "\n";
+                return 0;
+            }
+            if (answer == ":quit") return 0;
+            if (answer == ":hint") {
+                out << "Hint:\n" << lesson.hint << "\n";
+                continue;
+            }
+            if (answer == ":skip") {
+                next = true;
+                continue;
+            }
+            if (answer.empty()) continue;
+            if (answer[0] == ':') {
+                out << "Unknown command " << answer << " (use :hint, :skip or :quit)\n";
+                continue;
+            }
+            std::string message;
+            if (checkAnswerTimed(lesson, answer, options.timeoutMs, &message)) {
+                out << "Correct!\n";
+                done.insert(lesson.id);
+                saveProgress(options.progressPath, done);
+                next = true;
+            } else {
+                out << "Not yet: " << message << "\n";
+            }
+        }
+        current++;
+    }
+    out << "\nThat was the last lesson. docs/language.md covers the rest of the language.\n";
+    return 0;
+}
+
+} // namespace darix
@@ -1,4 +1,5 @@
 #include "darix/lexer.hpp"
+#include <algorithm>
 #include <cctype>
 
 namespace darix {
@@ -42,6 +43,16 @@ char Lexer::peekCharAt(int offset) const {
 }
 
 Token Lexer::nextToken() {
+    Token tok = scanToken();
+    tok.endOffset = std::min(position_, static_cast<int>(input_.size()));
+    return tok;
+}
+
+void Lexer::seek(int offset) {
+    while (position_ < offset && ch_ != 0) readChar();
+}
+
+Token Lexer::scanToken() {
     Token tok;
 
     skipCommentsAndWhitespace();
@@ -90,8 +101,11 @@ Token Lexer::nextToken() {
             if (peekChar() == '|') {
                 readChar();
                 tok = tokenWithLiteral(TokenType::OR, "||", startLine, startColumn, startOffset);
+            } else if (peekChar() == '>') {
+                readChar();
+                tok = tokenWithLiteral(TokenType::PIPE_FORWARD, "|>", startLine, startColumn, startOffset);
             } else {
-                tok = tokenWithLiteral(TokenType::ILLEGAL, std::string(1, ch_), startLine, startColumn, startOffset);
+                tok = newToken(TokenType::PIPE);
             }
             break;
         case ',': tok = newToken(TokenType::COMMA); break;
@@ -121,6 +135,11 @@ Token Lexer::nextToken() {
                 if (number.find('.') != std::string::npos) {
                     tokType = TokenType::FLOAT;
                 }
+                // A 'd' suffix makes a decimal literal: 10.50d
+                if (ch_ == 'd' && !std::isalnum(static_cast<unsigned char>(peekChar())) && peekChar() != '_') {
+                    readChar();
+                    tokType = TokenType::DECIMAL;
+                }
                 return tokenWithLiteral(tokType, number, startLine, startColumn, startOffset);
             } else {
                 tok = tokenWithLiteral(TokenType::ILLEGAL, std::string(1, ch_), startLine, startColumn, startOffset);
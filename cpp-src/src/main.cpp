@@ -1,23 +1,47 @@
 #include "darix/ast.hpp"
+#include "darix/bundle.hpp"
 #include "darix/compiler.hpp"
+#include "darix/doc.hpp"
 #include "darix/interpreter.hpp"
-#include "darix/lexer.hpp"
+#include "darix/lang.hpp"
+#include "darix/learn.hpp"
+#include "darix/native/native.hpp"
 #include "darix/object.hpp"
-#include "darix/parser.hpp"
+#include "darix/runner.hpp"
+#include "darix/serve.hpp"
 #include "darix/version.hpp"
 #include "darix/vm.hpp"
+#include "darix/warnings.hpp"
+#include <algorithm>
+#include <cctype>
+#include <chrono>
+#include <cerrno>
+#include <climits>
+#include <cmath>
 #include <cstdio>
 #include <cstdlib>
+#include <cstring>
+#include <deque>
+#include <filesystem>
 #include <fstream>
 #include <iostream>
+#include <map>
+#include <memory>
 #include <sstream>
 #include <string>
 #include <vector>
 
+#ifdef _WIN32
+#include <io.h>
+#else
+#include <sys/resource.h>
+#include <unistd.h>
+#endif
+
 using namespace darix;
 
 static std::string readFile(const std::string& filename) {
-    std::ifstream file(filename);
+    std::ifstream file(filename, std::ios::binary);
     if (!file.is_open()) {
         std::cerr << "Error reading file: " << filename << "\n";
         std::exit(1);
@@ -31,20 +55,60 @@ static void printHelp() {
     std::cout << "DariX command line (C++)\n\n";
     std::cout << "Usage:\n";
     std::cout << "  darix run <file.dax|->        Run a script (use '-' for stdin)\n";
-    std::cout << "  darix repl                    Start interactive REPL\n";
-    std::cout << "  darix eval \"<code>\"            Evaluate a code snippet\n";
-    std::cout << "  darix disasm <file.dax>       Disassemble bytecode\n";
+    std::cout << "  darix run [--preload lib.dax] a.dax b.dax ...\n";
+    std::cout << "                                Run scripts in one interpreter\n";
+    std::cout << "  darix run --allow=fs.read,json <file.dax>\n";
+    std::cout << "                                Only allow the listed modules/functions\n";
+    std::cout << "  darix run --policy=policy.json <file.dax>\n";
+    std::cout << "                                Apply grants, fs/net/env limits and budgets from a file\n";
+    std::cout << "  darix run --audit=log.jsonl <file.dax>\n";
+    std::cout << "                                Log every native call as JSON lines\n";
+    std::cout << "  darix run --rpc name=command <file.dax>\n";
+    std::cout << "                                Let rpc.call(name, payload) run a host command\n";
+    std::cout << "  darix run -W error|ignore|once <file.dax>\n";
+    std::cout << "                                Choose how warnings are handled\n";
+    std::cout << "  darix run --lang=v2 <file.dax>\n";
+    std::cout << "                                Choose the language version (default v1)\n";
+    std::cout << "  darix run --deterministic[=epoch] <file.dax>\n";
+    std::cout << "                                Seed randomness, stop the clock at epoch, deny os/net/rpc/env\n";
+    std::cout << "  darix run --budget=N <file.dax>\n";
+    std::cout << "                                Stop the script after N instructions\n";
+    std::cout << "  darix run --checked-arith <file.dax>\n";
+    std::cout << "                                Raise OverflowError when integer arithmetic overflows\n";
+    std::cout << "  darix run --strict <file.dax>\n";
+    std::cout << "                                Make assigning to an undeclared name a NameError\n";
+    std::cout << "  darix run --trace[=calls] <file.dax>\n";
+    std::cout << "                                Log each statement (or call/return) to stderr\n";
+    std::cout << "  darix run -i <file.dax>\n";
+    std::cout << "                                Start the REPL with the script's globals after it runs\n";
+    std::cout << "  darix run --memstats <file.dax>\n";
+    std::cout << "                                Report object allocation counts after the run\n";
+    std::cout << "  darix check [--strict] <file.dax ...>\n";
+    std::cout << "                                Report warnings without running the scripts\n";
+    std::cout << "  darix run|check --format=json <file.dax>\n";
+    std::cout << "                                Print errors and warnings as JSON lines on stderr\n";
+    std::cout << "  darix fix [-w] <file.dax ...> Migrate scripts to the latest language version\n";
+    std::cout << "  darix doc [--html] [-o out] <file|dir|module ...>\n";
+    std::cout << "                                Generate API docs (--native for all native modules)\n";
+    std::cout << "  darix serve [--listen host:port] [--allow grants] [--timeout ms] [--memory mb]\n";
+    std::cout << "                                Serve evaluate/parse/disassemble over JSON-RPC\n";
+    std::cout << "  darix repl [--backend=vm|interp] [--rc file | --no-rc] [--allow=grants] ...\n";
+    std::cout << "                                Start interactive REPL (runs ~/.darixrc first)\n";
+    std::cout << "  darix eval \"<code>\"            Evaluate a code snippet (also darix -c \"<code>\")\n";
+    std::cout << "  echo 'print(1)' | darix       Run a script piped to stdin\n";
+    std::cout << "  darix compile <file.dax> [-o out.daxc]\n";
+    std::cout << "                                Compile to a bytecode file\n";
+    std::cout << "  darix bundle [--bytecode] <file.dax|.daxc> [-o out]\n";
+    std::cout << "                                Package a script into a standalone executable\n";
+    std::cout << "  darix disasm <file.dax|.daxc> Disassemble bytecode\n";
+    std::cout << "  darix verify <file.dax|.daxc ...>\n";
+    std::cout << "                                Check that compiled code keeps the stack balanced\n";
+    std::cout << "  darix learn [--list | --reset] [lesson]\n";
+    std::cout << "                                Interactive tutorial; progress is kept in ~/.darix_learn\n";
     std::cout << "  darix version                 Show version info\n";
     std::cout << "  darix help                    Show this help\n";
 }
 
-static std::pair<std::shared_ptr<Program>, std::vector<std::string>> parseCode(const std::string& code, const std::string& filename) {
-    Lexer lexer(code, filename);
-    Parser parser(lexer);
-    auto program = parser.parseProgram();
-    return {program, parser.errors()};
-}
-
 static void handleParseErrors(const std::vector<std::string>& errors) {
     std::cerr << "Parse Errors Detected:\n";
     std::cerr << "========================\n";
@@ -55,137 +119,1173 @@ static void handleParseErrors(const std::vector<std::string>& errors) {
     std::exit(1);
 }
 
-static void handleRuntimeResult(ObjectPtr result) {
-    if (!result) return;
-    if (result->type() == ObjectType::ERROR) {
-        std::cout << result->inspect() << "\n";
+// Set by --format=json: diagnostics are printed as JSON lines on stderr.
+static bool jsonDiagnostics = false;
+
+// Applies --format=text|json, taken by run and check. Returns 1 if arg is the
+// flag, 0 if it is not, and -1 after reporting a bad value.
+static int formatFlag(const std::string& arg) {
+    if (arg.rfind("--format=", 0) != 0) return 0;
+    std::string format = arg.substr(9);
+    if (format != "text" && format != "json") {
+        std::cerr << "--format: expected text or json, got '" << format << "'\n";
+        return -1;
+    }
+    jsonDiagnostics = format == "json";
+    Warnings::instance().setJson(jsonDiagnostics);
+    return 1;
+}
+
+// Prints a run's diagnostics the way the CLI always has: load and parse
+// problems on stderr, runtime errors on stdout. With --format=json each is a
+// JSON line on stderr instead. Returns the exit code.
+static int report(const RunResult& result) {
+    if (jsonDiagnostics) {
+        for (auto& d : result.diagnostics) std::cerr << diagnosticJson(d) << "\n";
+        return result.exitCode;
+    }
+    std::vector<std::string> parseErrors;
+    for (auto& d : result.diagnostics) {
+        switch (d.stage) {
+            case Diagnostic::Stage::Load: std::cerr << d.message << "\n"; break;
+            case Diagnostic::Stage::Parse: parseErrors.push_back(d.message); break;
+            case Diagnostic::Stage::Runtime:
+            case Diagnostic::Stage::Warning: std::cout << d.message << "\n"; break;
+        }
+    }
+    if (!parseErrors.empty()) handleParseErrors(parseErrors);
+    return result.exitCode;
+}
+
+static std::shared_ptr<Bytecode> loadBytecodeFile(const std::string& filename, const std::string& data) {
+    std::string error;
+    auto bc = loadBytecode(data, &error);
+    if (!bc) {
+        std::cerr << filename << ": " << error << "\n";
+        std::exit(1);
+    }
+    return bc;
+}
+
+// Restricts native modules to the given grants (see native::CapabilityPolicy).
+static void allowCapabilities(const std::string& grants) {
+    native::Registry::instance().initAll();
+    std::string error;
+    if (!native::CapabilityPolicy::instance().allow(grants, &error)) {
+        std::cerr << "--allow: " << error << "\n";
+        std::exit(1);
+    }
+}
+
+// Adds a policy file's grants and limits (see native::CapabilityPolicy::load)
+// and applies its budget to this process.
+static void loadPolicy(const std::string& path) {
+    native::ResourceBudget budget;
+    std::string error;
+    if (!native::CapabilityPolicy::instance().load(path, &budget, &error)) {
+        std::cerr << "--policy: " << error << "\n";
+        std::exit(1);
+    }
+    // Several policy files add up; a later one only replaces the limits it sets.
+    if (budget.maxInstructions) setDefaultInstructionBudget(budget.maxInstructions);
+    SizeLimits sizes = sizeLimits();
+    if (budget.maxStringLen) sizes.maxStringLen = budget.maxStringLen;
+    if (budget.maxArrayLen) sizes.maxArrayLen = budget.maxArrayLen;
+    if (budget.maxMapEntries) sizes.maxMapEntries = budget.maxMapEntries;
+    setSizeLimits(sizes);
+    native::ErrorBudget failures = native::errorBudget();
+    if (budget.maxExceptions) failures.maxExceptions = budget.maxExceptions;
+    if (budget.maxCallbackFailures) failures.maxCallbackFailures = budget.maxCallbackFailures;
+    native::setErrorBudget(failures);
+#ifdef _WIN32
+    if (budget.cpuSeconds || budget.memoryMb) {
+        std::cerr << "--policy: cpu_seconds and memory_mb are not supported on Windows\n";
+        std::exit(1);
+    }
+#else
+    rlimit mem{static_cast<rlim_t>(budget.memoryMb) << 20, static_cast<rlim_t>(budget.memoryMb) << 20};
+    rlimit cpu{static_cast<rlim_t>(budget.cpuSeconds), static_cast<rlim_t>(budget.cpuSeconds)};
+    if ((budget.memoryMb && setrlimit(RLIMIT_AS, &mem) != 0) || (budget.cpuSeconds && setrlimit(RLIMIT_CPU, &cpu) != 0)) {
+        std::cerr << "--policy: cannot set the budget: " << std::strerror(errno) << "\n";
+        std::exit(1);
+    }
+#endif
+}
+
+// --deterministic[=epoch]: fixes the seed of every random source, stops the
+// clock at epoch (Unix seconds, 0 by default) and denies the modules and
+// environment variables that differ between machines, so a script prints the
+// same bytes on every run.
+static void makeDeterministic(const std::string& epoch) {
+    char* end = nullptr;
+    errno = 0;
+    long long seconds = std::strtoll(epoch.c_str(), &end, 10);
+    if (epoch.empty() || *end != '\0' || errno == ERANGE) {
+        std::cerr << "--deterministic: expected an epoch in Unix seconds, got '" << epoch << "'\n";
+        std::exit(1);
+    }
+    auto fixed = std::chrono::system_clock::time_point(std::chrono::seconds(seconds));
+    native::setClock([fixed] { return fixed; });
+    native::setDeterministic(0);
+    auto& policy = native::CapabilityPolicy::instance();
+    for (const char* module : {"os", "net", "rpc"}) policy.deny(module);
+    policy.denyEnv();
+}
+
+// Chooses how warnings are handled (see Warnings).
+static void setWarningAction(const std::string& action) {
+    std::string error;
+    if (!Warnings::instance().setAction(action, &error)) {
+        std::cerr << "-W: " << error << "\n";
         std::exit(1);
     }
-    if (result->type() == ObjectType::EXCEPTION_SIGNAL) {
-        std::cout << "Unhandled exception:\n" << result->inspect() << "\n";
+}
+
+// Sets the language version for files without a pragma (see lang.hpp).
+static void setLanguageVersion(const std::string& text) {
+    int version;
+    std::string error;
+    if (!parseLanguageVersion(text, &version, &error)) {
+        std::cerr << "--lang: " << error << "\n";
         std::exit(1);
     }
+    setDefaultLanguageVersion(version);
 }
 
-static ObjectPtr runInterpreter(Program* program) {
-    Interpreter interp;
-    return interp.interpret(program);
+// Appends a JSON line per native import and call (see native::AuditLog).
+static void openAuditLog(const std::string& path) {
+    std::string error;
+    if (!native::AuditLog::instance().open(path, &error)) {
+        std::cerr << "--audit: " << error << "\n";
+        std::exit(1);
+    }
+}
+
+// Limits each run to n instructions (see setDefaultInstructionBudget).
+static void setBudget(const std::string& text) {
+    char* end = nullptr;
+    long n = std::strtol(text.c_str(), &end, 10);
+    if (text.empty() || *end != '\0' || n <= 0 || n > INT_MAX) {
+        std::cerr << "--budget: expected a positive number of instructions, got '" << text << "'\n";
+        std::exit(1);
+    }
+    setDefaultInstructionBudget(static_cast<int>(n));
+}
+
+// Registers a command endpoint for the rpc module (see native::RpcEndpoints).
+static void addRpcEndpoint(const std::string& spec) {
+    std::string error;
+    if (!native::RpcEndpoints::instance().addCommand(spec, &error)) {
+        std::cerr << "--rpc: " << error << "\n";
+        std::exit(1);
+    }
 }
 
-static ObjectPtr runVM(Program* program) {
+// Prints the object counts and peak memory collected under --memstats.
+static void printMemStats() {
+    char line[96];
+    std::cerr << "memstats:\n";
+    std::snprintf(line, sizeof(line), "  %-10s %12s %12s %12s\n", "kind", "allocated", "live", "peak");
+    std::cerr << line;
+    for (int i = 0; i < static_cast<int>(StatKind::Count); i++) {
+        auto kind = static_cast<StatKind>(i);
+        auto stats = objectStats(kind);
+        std::snprintf(line, sizeof(line), "  %-10s %12lld %12lld %12lld\n", statKindName(kind), (long long)stats.allocated,
+                      (long long)stats.live, (long long)stats.peak);
+        std::cerr << line;
+    }
+    if (int64_t rss = peakResidentBytes()) {
+        std::snprintf(line, sizeof(line), "  peak rss: %.1f MB\n", rss / (1024.0 * 1024.0));
+        std::cerr << line;
+    }
+}
+
+// Applies a flag that decides what scripts may do and how they run, shared by
+// run and repl. Returns 1 if argv[i] is one, having moved i past a separate
+// value, 0 if it is not, and -1 after reporting a missing value.
+static int policyFlag(int argc, char* argv[], int& i) {
+    std::string arg = argv[i];
+    if (arg == "--allow") {
+        if (i + 1 >= argc) {
+            std::cerr << "--allow requires a list of modules or functions\n";
+            return -1;
+        }
+        allowCapabilities(argv[++i]);
+    } else if (arg.rfind("--allow=", 0) == 0) {
+        allowCapabilities(arg.substr(8));
+    } else if (arg == "--policy") {
+        if (i + 1 >= argc) {
+            std::cerr << "--policy requires a policy file\n";
+            return -1;
+        }
+        loadPolicy(argv[++i]);
+    } else if (arg.rfind("--policy=", 0) == 0) {
+        loadPolicy(arg.substr(9));
+    } else if (arg == "--audit") {
+        if (i + 1 >= argc) {
+            std::cerr << "--audit requires a log file\n";
+            return -1;
+        }
+        openAuditLog(argv[++i]);
+    } else if (arg.rfind("--audit=", 0) == 0) {
+        openAuditLog(arg.substr(8));
+    } else if (arg == "--rpc") {
+        if (i + 1 >= argc) {
+            std::cerr << "--rpc requires name=command\n";
+            return -1;
+        }
+        addRpcEndpoint(argv[++i]);
+    } else if (arg.rfind("--rpc=", 0) == 0) {
+        addRpcEndpoint(arg.substr(6));
+    } else if (arg == "-W") {
+        if (i + 1 >= argc) {
+            std::cerr << "-W requires default, once, ignore or error\n";
+            return -1;
+        }
+        setWarningAction(argv[++i]);
+    } else if (arg.rfind("-W", 0) == 0) {
+        setWarningAction(arg.substr(2));
+    } else if (arg == "--deterministic") {
+        makeDeterministic("0");
+    } else if (arg.rfind("--deterministic=", 0) == 0) {
+        makeDeterministic(arg.substr(16));
+    } else if (arg == "--budget") {
+        if (i + 1 >= argc) {
+            std::cerr << "--budget requires a number of instructions\n";
+            return -1;
+        }
+        setBudget(argv[++i]);
+    } else if (arg.rfind("--budget=", 0) == 0) {
+        setBudget(arg.substr(9));
+    } else if (arg == "--checked-arith") {
+        enableCheckedArithmetic();
+    } else if (arg == "--strict") {
+        setDefaultStrictMode(true);
+    } else if (arg == "--lang") {
+        if (i + 1 >= argc) {
+            std::cerr << "--lang requires a version such as v2\n";
+            return -1;
+        }
+        setLanguageVersion(argv[++i]);
+    } else if (arg.rfind("--lang=", 0) == 0) {
+        setLanguageVersion(arg.substr(7));
+    } else {
+        return 0;
+    }
+    return 1;
+}
+
+static int runRepl(const std::string& rcFile, std::unique_ptr<Interpreter> interp, const std::string& backend = "");
+
+// darix run -i: runs the scripts in the global scope, then starts the REPL in
+// the same session, even if a script failed, so its state can be inspected.
+static int runInteractive(const std::vector<std::string>& preloads, const std::vector<std::string>& files) {
+    std::vector<std::string> all = preloads;
+    all.insert(all.end(), files.begin(), files.end());
+    if (std::find(all.begin(), all.end(), "-") != all.end()) {
+        std::cerr << "-i cannot run a script from stdin, which the REPL reads\n";
+        return 1;
+    }
+    auto interp = std::make_unique<Interpreter>();
+    auto result = runScriptsIn(*interp, all);
+    int code = report(result);
+    // Scripts that could not be read or parsed never ran.
+    if (!result.ok() && !result.value) return code;
+    return runRepl("", std::move(interp));
+}
+
+static int runCommand(int argc, char* argv[]) {
+    std::vector<std::string> preloads, files;
+    bool interactive = false;
+    for (int i = 2; i < argc; i++) {
+        std::string arg = argv[i];
+        if (int policy = policyFlag(argc, argv, i)) {
+            if (policy < 0) return 1;
+        } else if (int format = formatFlag(arg)) {
+            if (format < 0) return 1;
+        } else if (arg == "-i") {
+            interactive = true;
+        } else if (arg == "--memstats") {
+            enableObjectStats();
+        } else if (arg == "--trace" || arg == "--trace=statements") {
+            setTraceMode(TraceMode::Statements);
+        } else if (arg == "--trace=calls") {
+            setTraceMode(TraceMode::Calls);
+        } else if (arg.rfind("--trace=", 0) == 0) {
+            std::cerr << "--trace: unknown mode '" << arg.substr(8) << "' (expected statements or calls)\n";
+            return 1;
+        } else if (arg == "--preload") {
+            if (i + 1 >= argc) {
+                std::cerr << "--preload requires a file\n";
+                return 1;
+            }
+            preloads.push_back(argv[++i]);
+        } else if (arg.rfind("--preload=", 0) == 0) {
+            preloads.push_back(arg.substr(10));
+        } else {
+            files.push_back(arg);
+        }
+    }
+    if (files.empty()) {
+        std::cerr << "Usage: darix run [--allow=grants] [--policy=file] [--audit=log.jsonl] [--rpc name=command] [-W action] [--lang=vN] [--deterministic[=epoch]] [--budget=N] [--checked-arith] [--strict] [--trace[=calls]] [--memstats] [--format=json] [-i] [--preload lib.dax] <file.dax|-> [more.dax ...]\n";
+        return 1;
+    }
+    if (interactive) return runInteractive(preloads, files);
+    auto result = preloads.empty() && files.size() == 1 ? runScript(files[0]) : runScripts(preloads, files);
+    int code = report(result);
+    if (objectStatsEnabled()) printMemStats();
+    return code;
+}
+
+// Migrates each file to the latest language version, printing the result or,
+// with -w, rewriting the file in place.
+static int fixCommand(int argc, char* argv[]) {
+    bool write = false;
+    std::vector<std::string> files;
+    for (int i = 2; i < argc; i++) {
+        std::string arg = argv[i];
+        if (arg == "-w") write = true;
+        else files.push_back(arg);
+    }
+    if (files.empty()) {
+        std::cerr << "Usage: darix fix [-w] <file.dax> [more.dax ...]\n";
+        return 1;
+    }
+    int status = 0;
+    for (auto& file : files) {
+        int changes = 0;
+        std::vector<std::string> errors;
+        auto fixed = fixSource(readFile(file), file, &changes, &errors);
+        if (!errors.empty()) {
+            for (auto& e : errors) std::cerr << e << "\n";
+            status = 1;
+            continue;
+        }
+        if (!write) {
+            std::cout << fixed;
+        } else {
+            std::ofstream out(file, std::ios::binary);
+            out << fixed;
+            if (!out) {
+                std::cerr << "Error writing file: " << file << "\n";
+                status = 1;
+                continue;
+            }
+        }
+        std::cerr << file << ": " << changes << " change" << (changes == 1 ? "" : "s") << "\n";
+    }
+    return status;
+}
+
+// Adds the docs for one argument: a script, a directory of scripts (searched
+// recursively) or the name of a native module.
+static bool addDocs(const std::string& target, std::vector<DocModule>& modules) {
+    namespace fs = std::filesystem;
+    std::error_code ec;
+    std::vector<std::string> files;
+    if (fs::is_directory(target, ec)) {
+        for (auto& entry : fs::recursive_directory_iterator(target, ec)) {
+            if (entry.is_regular_file() && entry.path().extension() == ".dax") files.push_back(entry.path().string());
+        }
+        std::sort(files.begin(), files.end());
+    } else if (fs::exists(target, ec)) {
+        files.push_back(target);
+    } else {
+        DocModule mod;
+        if (!documentNativeModule(target, &mod)) {
+            std::cerr << "darix doc: no such file, directory or native module: " << target << "\n";
+            return false;
+        }
+        modules.push_back(mod);
+        return true;
+    }
+    bool ok = true;
+    for (auto& file : files) {
+        DocModule mod;
+        std::vector<std::string> errors;
+        if (!documentSource(readFile(file), file, &mod, &errors)) {
+            for (auto& e : errors) std::cerr << e << "\n";
+            ok = false;
+            continue;
+        }
+        modules.push_back(mod);
+    }
+    return ok;
+}
+
+static int docCommand(int argc, char* argv[]) {
+    bool html = false, allNative = false;
+    std::string output;
+    std::vector<std::string> targets;
+    for (int i = 2; i < argc; i++) {
+        std::string arg = argv[i];
+        if (arg == "--html") html = true;
+        else if (arg == "--native") allNative = true;
+        else if (arg == "-o" && i + 1 < argc) output = argv[++i];
+        else targets.push_back(arg);
+    }
+    if (targets.empty() && !allNative) {
+        std::cerr << "Usage: darix doc [--html] [-o out] [--native] <file.dax|dir|module> ...\n";
+        return 1;
+    }
+    if (allNative) {
+        native::Registry::instance().initAll();
+        for (auto& name : native::Registry::instance().names()) targets.push_back(name);
+    }
+    std::vector<DocModule> modules;
+    bool ok = true;
+    for (auto& target : targets) ok = addDocs(target, modules) && ok;
+    if (!ok) return 1;
+
+    auto text = html ? renderHtml(modules) : renderMarkdown(modules);
+    if (output.empty()) {
+        std::cout << text;
+        return 0;
+    }
+    std::ofstream out(output, std::ios::binary);
+    out << text;
+    if (!out) {
+        std::cerr << "Error writing file: " << output << "\n";
+        return 1;
+    }
+    return 0;
+}
+
+static std::shared_ptr<Bytecode> compileSource(const std::string& filename, const std::string& content) {
+    auto [program, errors] = parseSource(content, filename);
+    if (!errors.empty()) handleParseErrors(errors);
     try {
+        Interpreter interp;
         Compiler compiler;
-        compiler.compile(program);
-        auto bc = compiler.bytecode();
-        VM machine(bc);
-        return machine.run();
-    } catch (const std::exception&) {
-        return newError("VM compilation failed");
+        compiler.setBuiltins([&interp](const std::string& name, std::string* why) { return interp.bytecodeBuiltin(name, why); });
+        compiler.compile(program.get());
+        return compiler.bytecode();
+    } catch (const std::exception& e) {
+        std::cerr << filename << ": cannot compile to bytecode: " << e.what() << "\n";
+        std::exit(1);
     }
 }
 
-static void runAuto(Program* program) {
-    auto result = runVM(program);
-    if (result && result->type() == ObjectType::ERROR) {
-        // VM failed, fall back to interpreter
-        handleRuntimeResult(runInterpreter(program));
-        return;
+static int compileFile(const std::string& filename, std::string output) {
+    auto bc = compileSource(filename, readFile(filename));
+    if (output.empty()) {
+        auto dot = filename.find_last_of('.');
+        output = (dot == std::string::npos ? filename : filename.substr(0, dot)) + ".daxc";
     }
-    if (result && result->type() == ObjectType::EXCEPTION_SIGNAL) {
-        handleRuntimeResult(result);
-        return;
+    std::ofstream out(output, std::ios::binary);
+    out << serializeBytecode(*bc);
+    if (!out) {
+        std::cerr << "Error writing file: " << output << "\n";
+        return 1;
     }
-    handleRuntimeResult(result);
+    return 0;
 }
 
-static void runFile(const std::string& filename) {
-    auto content = (filename == "-") ? [] {
-        std::stringstream buf;
-        buf << std::cin.rdbuf();
-        return buf.str();
-    }() : readFile(filename);
+// Reads a positive integer flag value, exiting with a message if invalid.
+static long positiveFlag(const std::string& flag, const std::string& value) {
+    char* end = nullptr;
+    long n = std::strtol(value.c_str(), &end, 10);
+    if (value.empty() || *end != '\0' || n <= 0 || n > INT_MAX) {
+        std::cerr << flag << ": expected a positive integer, got '" << value << "'\n";
+        std::exit(1);
+    }
+    return n;
+}
 
-    auto [program, errors] = parseCode(content, filename);
-    if (!errors.empty()) handleParseErrors(errors);
-    runAuto(program.get());
+static int serveCommand(int argc, char* argv[]) {
+    ServeOptions options;
+    for (int i = 2; i < argc; i++) {
+        std::string arg = argv[i];
+        auto eq = arg.find('=');
+        std::string flag = arg.substr(0, eq);
+        std::string value;
+        if (eq != std::string::npos) {
+            value = arg.substr(eq + 1);
+        } else if (i + 1 < argc) {
+            value = argv[++i];
+        } else {
+            std::cerr << "Usage: darix serve [--listen host:port] [--allow grants] [--timeout ms] [--memory mb] [--max-output bytes]\n";
+            return 1;
+        }
+        std::string error;
+        if (flag == "--listen") {
+            if (!parseListenAddress(value, &options, &error)) {
+                std::cerr << "--listen: " << error << "\n";
+                return 1;
+            }
+        } else if (flag == "--allow") {
+            // Checked here so a typo fails at startup, not on every request.
+            allowCapabilities(value);
+            native::CapabilityPolicy::instance().reset();
+            options.allow = value;
+        } else if (flag == "--timeout") {
+            options.timeoutMs = static_cast<int>(positiveFlag(flag, value));
+        } else if (flag == "--memory") {
+            options.memoryMb = static_cast<int>(positiveFlag(flag, value));
+        } else if (flag == "--max-output") {
+            options.maxOutput = static_cast<size_t>(positiveFlag(flag, value));
+        } else {
+            std::cerr << "serve: unknown option " << arg << "\n";
+            return 1;
+        }
+    }
+    return serve(options);
 }
 
-static void runCode(const std::string& code) {
-    auto [program, errors] = parseCode(code, "<eval>");
-    if (!errors.empty()) handleParseErrors(errors);
-    runAuto(program.get());
+// Packs a script, as source or (with --bytecode) compiled, into a copy of
+// this executable that runs it on start.
+static int bundleCommand(int argc, char* argv[]) {
+    std::string input, output;
+    bool bytecode = false;
+    for (int i = 2; i < argc; i++) {
+        std::string arg = argv[i];
+        if (arg == "-o" && i + 1 < argc) output = argv[++i];
+        else if (arg == "--bytecode") bytecode = true;
+        else if (input.empty() && arg[0] != '-') input = arg;
+        else input.clear(), i = argc;
+    }
+    if (input.empty()) {
+        std::cerr << "Usage: darix bundle [--bytecode] <file.dax|file.daxc> [-o out]\n";
+        return 1;
+    }
+    auto slash = input.find_last_of("/\\");
+    Bundle bundle;
+    bundle.filename = slash == std::string::npos ? input : input.substr(slash + 1);
+    bundle.script = readFile(input);
+    // Check the script now so a broken one is not shipped.
+    if (isBytecodeFile(bundle.script)) {
+        loadBytecodeFile(input, bundle.script);
+    } else if (bytecode) {
+        bundle.script = serializeBytecode(*compileSource(input, bundle.script));
+    } else {
+        auto [program, errors] = parseSource(bundle.script, input);
+        if (!errors.empty()) handleParseErrors(errors);
+    }
+    if (output.empty()) {
+        auto dot = input.find_last_of('.');
+        output = dot == std::string::npos || (slash != std::string::npos && dot < slash) ? input + ".bin" : input.substr(0, dot);
+    }
+    std::string error;
+    if (!writeBundle(executablePath(argv[0]), bundle, output, &error)) {
+        std::cerr << "bundle: " << error << "\n";
+        return 1;
+    }
+    return 0;
 }
 
 static void disasmFile(const std::string& filename) {
     auto content = readFile(filename);
-    auto [program, errors] = parseCode(content, filename);
-    if (!errors.empty()) handleParseErrors(errors);
-    Compiler compiler;
-    compiler.compile(program.get());
-    auto bc = compiler.bytecode();
+    auto bc = isBytecodeFile(content) ? loadBytecodeFile(filename, content) : compileSource(filename, content);
+    std::cout << "# Format v" << bc->formatVersion << ", compiled by DariX " << bc->version
+              << ", features: " << describeFeatures(bc->features) << "\n";
+    std::cout << "# Constant pool: " << describeConstantPool(bc->constants) << "\n";
     std::cout << "# Bytecode Instructions:\n";
-    std::cout << Disassemble(bc->instructions);
+    std::cout << Disassemble(bc->instructions, bc->debug.globals);
 }
 
-int main(int argc, char* argv[]) {
-    if (argc <= 1) {
-        // REPL mode
-        std::cout << "DariX " << versionString() << "\n";
-        std::cout << "Type 'exit' to quit.\n";
+// Compiles each script, or loads each bytecode file, and checks that every
+// path through it keeps the stack balanced. Scripts the compiler does not
+// support run on the interpreter and are only reported.
+static int verifyCommand(int argc, char* argv[]) {
+    if (argc < 3) {
+        std::cerr << "Usage: darix verify <file.dax|file.daxc> [more ...]\n";
+        return 1;
+    }
+    int status = 0;
+    for (int i = 2; i < argc; i++) {
+        std::string filename = argv[i];
+        auto content = readFile(filename);
+        std::shared_ptr<Bytecode> bc;
+        std::string error;
+        if (isBytecodeFile(content)) {
+            bc = loadBytecode(content, &error);
+        } else {
+            auto [program, errors] = parseSource(content, filename);
+            if (!errors.empty()) {
+                error = errors[0];
+            } else {
+                try {
+                    Interpreter interp;
+                    Compiler compiler;
+                    compiler.setBuiltins([&interp](const std::string& name, std::string* why) { return interp.bytecodeBuiltin(name, why); });
+                    compiler.compile(program.get());
+                    bc = compiler.bytecode();
+                } catch (const std::exception& e) {
+                    std::cout << filename << ": interpreter only (" << e.what() << ")\n";
+                    continue;
+                }
+            }
+        }
+        if (bc && verifyBytecode(*bc, &error, true)) {
+            std::cout << filename << ": ok\n";
+            continue;
+        }
+        std::cout << filename << ": " << error << "\n";
+        status = 1;
+    }
+    return status;
+}
 
+// Reports each script's warnings without running it: the ones run reports
+// before starting, and for strict scripts, assignments to undeclared names.
+static int checkCommand(int argc, char* argv[]) {
+    std::vector<std::string> files;
+    for (int i = 2; i < argc; i++) {
+        if (int policy = policyFlag(argc, argv, i)) {
+            if (policy < 0) return 1;
+        } else if (int format = formatFlag(argv[i])) {
+            if (format < 0) return 1;
+        } else {
+            files.push_back(argv[i]);
+        }
+    }
+    if (files.empty()) {
+        std::cerr << "Usage: darix check [--strict] [-W action] [--lang=vN] [--format=json] <file.dax> [more.dax ...]\n";
+        return 1;
+    }
+    int status = 0;
+    for (auto& filename : files) {
+        auto [program, errors] = parseSource(readFile(filename), filename);
+        if (!errors.empty()) {
+            for (auto& e : errors) std::cerr << (jsonDiagnostics ? diagnosticJson(parseDiagnostic(e, filename)) : e) << "\n";
+            status = 1;
+            continue;
+        }
+        int before = Warnings::instance().reported();
         Interpreter interp;
-        std::string line;
-        while (true) {
-            std::cout << ">> ";
-            if (!std::getline(std::cin, line)) break;
-            if (line == "exit" || line == "quit") break;
-            if (line.empty()) continue;
-
-            auto [program, errors] = parseCode(line, "<repl>");
-            if (!errors.empty()) {
-                for (auto& e : errors) std::cerr << e << "\n";
-                continue;
+        auto err = interp.check(program.get());
+        if (!err && program->strict) err = lintUndeclaredAssignments(program.get());
+        if (err) std::cerr << (jsonDiagnostics ? diagnosticJson(runtimeDiagnostic(err, filename)) : err->inspect()) << "\n";
+        if (Warnings::instance().reported() > before) {
+            status = 1;
+            continue;
+        }
+        // In JSON mode a clean file prints nothing.
+        if (!jsonDiagnostics) std::cout << filename << ": ok\n";
+    }
+    return status;
+}
+
+static int learnCommand(int argc, char* argv[]) {
+    LearnOptions options;
+    options.progressPath = defaultLearnProgress();
+    for (int i = 2; i < argc; i++) {
+        std::string arg = argv[i];
+        if (arg == "--list") {
+            options.list = true;
+        } else if (arg == "--reset") {
+            options.reset = true;
+        } else if (arg == "--progress" && i + 1 < argc) {
+            options.progressPath = argv[++i];
+        } else if (arg[0] != '-' && options.start.empty()) {
+            options.start = arg;
+        } else {
+            std::cerr << "Usage: darix learn [--list | --reset] [--progress file] [lesson]\n";
+            return 1;
+        }
+    }
+    return learn(std::cin, std::cout, options);
+}
+
+// Number of earlier REPL results kept as _1 .. _N, besides _ for the latest.
+static constexpr size_t ReplHistory = 9;
+
+// Binds _ to the newest result and _1, _2, ... to the ones before it.
+static void bindReplHistory(Interpreter& interp, std::deque<ObjectPtr>& history, ObjectPtr result) {
+    history.push_front(result);
+    if (history.size() > ReplHistory + 1) history.pop_back();
+    auto env = interp.getEnvironment();
+    env->set("_", history[0]);
+    for (size_t i = 1; i < history.size(); i++) env->set("_" + std::to_string(i), history[i]);
+}
+
+// Gives every interpreter global a slot in the session symbol table, so VM
+// lines and :disasm resolve names defined by earlier lines.
+static void defineReplSymbols(Interpreter& interp, SymbolTable& symbols) {
+    for (auto& [name, value] : interp.getEnvironment()->getAll()) {
+        if (!symbols.resolve(name).second) symbols.define(name);
+    }
+}
+
+// The VM backend's part of a REPL session: the symbol table each line is
+// compiled against, the globals array compiled lines run on and the
+// constant pool they share, all kept from line to line, so a name keeps its
+// slot for the whole session and a function compiled on one line still
+// finds its constants when a later line calls it.
+struct ReplVM {
+    std::shared_ptr<SymbolTable> symbols = std::make_shared<SymbolTable>();
+    std::vector<ObjectPtr> globals;
+    std::vector<ObjectPtr> constants;
+};
+
+// Hands machine the session's variables, refreshed from the interpreter
+// environment, as its globals.
+static void loadReplGlobals(Interpreter& interp, ReplVM& session, VM& machine) {
+    auto& symbols = session.symbols;
+    auto& globals = session.globals;
+    if (globals.size() < static_cast<size_t>(symbols->numDefinitions())) globals.resize(symbols->numDefinitions(), nullptr);
+    for (auto& [name, value] : interp.getEnvironment()->getAll()) globals[symbols->resolve(name).first.index] = value;
+    machine.setGlobals(std::move(globals));
+}
+
+// Takes the globals back from machine and writes them to the environment.
+static void storeReplGlobals(Interpreter& interp, ReplVM& session, VM& machine) {
+    session.globals = machine.globals();
+    for (auto& [name, sym] : session.symbols->symbols()) {
+        auto& value = session.globals[sym.index];
+        if (value) interp.getEnvironment()->set(name, value);
+    }
+}
+
+// Runs one REPL line on the VM. The interpreter environment still owns the
+// session's variables, since interp lines, :restore and the startup file
+// write there: the globals are refreshed from it before the line runs and
+// written back afterwards, so switching backends keeps the session intact.
+static ObjectPtr runReplVM(Interpreter& interp, ReplVM& session, Program* program, int budget) {
+    auto& symbols = session.symbols;
+    defineReplSymbols(interp, *symbols);
+    std::shared_ptr<Bytecode> bc;
+    try {
+        Compiler compiler(symbols, session.constants);
+        compiler.setBuiltins([&interp](const std::string& name, std::string* why) { return interp.bytecodeBuiltin(name, why); });
+        compiler.compile(program);
+        bc = compiler.bytecode();
+        session.constants = bc->constants;
+    } catch (const std::exception& e) {
+        return newError("cannot compile to bytecode: %s", e.what());
+    }
+
+    VM machine(bc);
+    loadReplGlobals(interp, session, machine);
+    if (budget > 0) machine.setInstructionBudget(budget);
+    auto result = machine.run();
+    storeReplGlobals(interp, session, machine);
+    return result && result->type() == ObjectType::NULL_OBJ ? machine.lastPopped() : result;
+}
+
+// Calls fn, compiled by an earlier VM line, on the session's constants and
+// globals, for interp lines that call it.
+static ObjectPtr callReplVM(Interpreter& interp, ReplVM& session, std::shared_ptr<CompiledFunction> fn,
+                            const std::vector<ObjectPtr>& args) {
+    defineReplSymbols(interp, *session.symbols);
+    auto bc = std::make_shared<Bytecode>();
+    bc->constants = session.constants;
+    VM machine(bc);
+    loadReplGlobals(interp, session, machine);
+    auto result = machine.call(fn, args);
+    storeReplGlobals(interp, session, machine);
+    return result;
+}
+
+// File :save and :restore use when no name is given.
+static const char* const ReplStateFile = "session.dax-state";
+
+// Source text of the functions and classes defined in the session, by name,
+// so :save can write them back out. Lambdas bound with var count too.
+static void recordReplDefinitions(Program* program, const std::string& source, std::map<std::string, std::string>& defs) {
+    for (auto& stmt : program->statements) {
+        std::string name;
+        if (auto fd = std::dynamic_pointer_cast<FunctionDeclaration>(stmt)) {
+            name = fd->name->value;
+        } else if (auto cd = std::dynamic_pointer_cast<ClassDeclaration>(stmt)) {
+            name = cd->name->value;
+        } else if (auto ls = std::dynamic_pointer_cast<LetStatement>(stmt)) {
+            if (std::dynamic_pointer_cast<FunctionLiteral>(ls->value) || std::dynamic_pointer_cast<LambdaExpression>(ls->value))
+                name = ls->name->value;
+        }
+        if (name.empty() || stmt->span.end <= stmt->span.start) continue;
+        defs[name] = source.substr(stmt->span.start, stmt->span.end - stmt->span.start);
+    }
+}
+
+// Writes value as a DariX literal. Fails for anything a literal cannot
+// rebuild: functions, instances, handles, non-finite floats, cycles.
+static bool replLiteral(const ObjectPtr& value, std::string& out, std::vector<const Object*>& open) {
+    if (std::find(open.begin(), open.end(), value.get()) != open.end()) return false;
+    switch (value->type()) {
+        case ObjectType::FLOAT:
+            if (!std::isfinite(std::static_pointer_cast<Float>(value)->value)) return false;
+            [[fallthrough]];
+        case ObjectType::INTEGER:
+        case ObjectType::DECIMAL:
+        case ObjectType::STRING:
+        case ObjectType::BOOLEAN:
+        case ObjectType::NULL_OBJ:
+            out += repr(value);
+            return true;
+        case ObjectType::ARRAY: {
+            open.push_back(value.get());
+            out += "[";
+            auto& elems = std::static_pointer_cast<Array>(value)->elements;
+            for (size_t i = 0; i < elems.size(); i++) {
+                if (i) out += ", ";
+                if (!replLiteral(elems[i], out, open)) return false;
             }
-            auto result = interp.interpret(program.get());
-            if (result && result->type() != ObjectType::NULL_OBJ) {
-                std::cout << result->inspect() << "\n";
+            out += "]";
+            open.pop_back();
+            return true;
+        }
+        case ObjectType::MAP:
+        case ObjectType::HASH: {
+            std::vector<std::pair<ObjectPtr, ObjectPtr>> pairs;
+            if (auto m = std::dynamic_pointer_cast<Map>(value)) pairs = m->pairs;
+            else for (auto& [k, p] : std::static_pointer_cast<Hash>(value)->pairs) pairs.push_back({p.key, p.value});
+            open.push_back(value.get());
+            out += "{";
+            for (size_t i = 0; i < pairs.size(); i++) {
+                if (i) out += ", ";
+                if (!replLiteral(pairs[i].first, out, open)) return false;
+                out += ": ";
+                if (!replLiteral(pairs[i].second, out, open)) return false;
             }
+            out += "}";
+            open.pop_back();
+            return true;
         }
-        return 0;
+        default:
+            return false;
+    }
+}
+
+// Writes the session's globals to path as a DariX script: imports first,
+// then function and class definitions, then variables. Result history and
+// values with no source form are left out and listed in skipped.
+static bool saveReplState(Interpreter& interp, const std::map<std::string, std::string>& defs, const std::string& path,
+                          int* saved, std::vector<std::string>* skipped) {
+    auto all = interp.getEnvironment()->getAll();
+    std::vector<std::string> names;
+    for (auto& [name, value] : all) names.push_back(name);
+    std::sort(names.begin(), names.end());
+
+    std::string imports, definitions, variables;
+    *saved = 0;
+    for (auto& name : names) {
+        if (name == "_" || (name.size() > 1 && name[0] == '_' && std::all_of(name.begin() + 1, name.end(), ::isdigit))) continue;
+        auto& value = all[name];
+        auto type = value->type();
+        auto def = defs.find(name);
+        std::string literal;
+        std::vector<const Object*> open;
+        if (type == ObjectType::MODULE) {
+            auto mod = std::static_pointer_cast<Module>(value);
+            imports += "import " + repr(newString(mod->path)) + "\n";
+        } else if ((type == ObjectType::FUNCTION || type == ObjectType::COMPILED_FUNCTION || type == ObjectType::CLASS) &&
+                   def != defs.end()) {
+            definitions += def->second + "\n";
+        } else if (replLiteral(value, literal, open)) {
+            variables += "var " + name + " = " + literal + "\n";
+        } else {
+            skipped->push_back(name);
+            continue;
+        }
+        (*saved)++;
+    }
+
+    std::ofstream file(path, std::ios::binary);
+    if (!file) return false;
+    file << "// DariX REPL session. Load it with :restore " << path << "\n";
+    file << imports << definitions << variables;
+    return static_cast<bool>(file);
+}
+
+static void printReplHelp() {
+    std::cout << "  :backend [vm|interp]  Show or switch the engine that runs each line\n";
+    std::cout << "  :budget [N]           Show or set the instruction budget per line (0 = none)\n";
+    std::cout << "  :disasm <code>        Show the bytecode the VM would run for <code>\n";
+    std::cout << "  :reset                Clear all variables, imports and result history\n";
+    std::cout << "  :save [file]          Save variables, functions, classes and imports (default session.dax-state)\n";
+    std::cout << "  :restore [file]       Load a saved session into this one\n";
+    std::cout << "  :exit                 Leave the REPL\n";
+    std::cout << "  _ is the last result; _1, _2, ... the ones before it.\n";
+}
+
+// ~/.darixrc, run when the REPL starts unless another file or --no-rc is given.
+static std::string defaultReplRc() {
+#ifdef _WIN32
+    const char* home = std::getenv("USERPROFILE");
+#else
+    const char* home = std::getenv("HOME");
+#endif
+    if (!home) return "";
+    auto path = std::filesystem::path(home) / ".darixrc";
+    std::error_code ec;
+    return std::filesystem::exists(path, ec) ? path.string() : "";
+}
+
+// Runs the REPL's startup file in the session, so its functions, imports and
+// variables are there from the first line. It can choose the backend by
+// setting repl_backend to "vm" or "interp"; errors are reported and the REPL
+// starts anyway.
+static void runReplRc(Interpreter& interp, const std::string& path, bool& useVM) {
+    std::ifstream file(path, std::ios::binary);
+    if (!file) {
+        std::cerr << "Cannot read " << path << "\n";
+        return;
+    }
+    std::stringstream buffer;
+    buffer << file.rdbuf();
+    auto [program, errors] = parseSource(buffer.str(), path);
+    if (!errors.empty()) {
+        for (auto& e : errors) std::cerr << e << "\n";
+        return;
+    }
+    auto result = interp.interpret(program.get());
+    if (result && (result->type() == ObjectType::ERROR || result->type() == ObjectType::EXCEPTION_SIGNAL))
+        std::cerr << pretty(result) << "\n";
+    if (auto backend = std::dynamic_pointer_cast<String>(interp.getEnvironment()->get("repl_backend"))) {
+        if (backend->value == "vm" || backend->value == "interp") useVM = backend->value == "vm";
+        else std::cerr << path << ": unknown repl_backend " << backend->value << " (use vm or interp)\n";
+    }
+}
+
+// repl_prompt if the session has set it to a string, else ">> ".
+static std::string replPrompt(Interpreter& interp) {
+    if (auto prompt = std::dynamic_pointer_cast<String>(interp.getEnvironment()->get("repl_prompt"))) return prompt->value;
+    return ">> ";
+}
+
+// Starts the REPL, in interp's session if one is given, on backend ("vm" or
+// "interp") if one is given, else on the one the startup file chooses.
+// Returns the exit status: 0, or the code a line passed to exit().
+static int runRepl(const std::string& rcFile, std::unique_ptr<Interpreter> interp, const std::string& backend) {
+    std::cout << "DariX " << versionString() << "\n";
+    std::cout << "Type 'exit' to quit, ':help' for commands.\n";
+
+    if (!interp) interp = std::make_unique<Interpreter>();
+    ReplVM vm;
+    // Functions VM lines define stay callable after :backend interp.
+    auto callVM = [&interp, &vm](std::shared_ptr<CompiledFunction> fn, const std::vector<ObjectPtr>& args) {
+        return callReplVM(*interp, vm, fn, args);
+    };
+    interp->setCompiledCall(callVM);
+    std::deque<ObjectPtr> history;
+    std::map<std::string, std::string> definitions;
+    bool useVM = false;
+    int budget = defaultInstructionBudget();
+    if (!rcFile.empty()) runReplRc(*interp, rcFile, useVM);
+    if (!backend.empty()) useVM = backend == "vm";
+    std::string line;
+    while (true) {
+        std::cout << replPrompt(*interp);
+        if (!std::getline(std::cin, line)) break;
+        if (line == "exit" || line == "quit" || line == ":exit") break;
+        if (line.empty()) continue;
+
+        if (line[0] == ':') {
+            auto space = line.find(' ');
+            std::string cmd = line.substr(0, space);
+            std::string arg;
+            if (space != std::string::npos) {
+                auto start = line.find_first_not_of(' ', space);
+                if (start != std::string::npos) arg = line.substr(start);
+            }
+            if (cmd == ":reset") {
+                // Drop the old session first so its handles are closed.
+                interp.reset();
+                interp = std::make_unique<Interpreter>();
+                interp->setCompiledCall(callVM);
+                vm = ReplVM();
+                history.clear();
+                definitions.clear();
+                if (!rcFile.empty()) runReplRc(*interp, rcFile, useVM);
+                if (!backend.empty()) useVM = backend == "vm";
+                std::cout << "Session reset.\n";
+            } else if (cmd == ":backend") {
+                if (arg == "vm" || arg == "interp") {
+                    useVM = arg == "vm";
+                } else if (!arg.empty()) {
+                    std::cerr << "Unknown backend " << arg << " (use vm or interp)\n";
+                    continue;
+                }
+                std::cout << "Backend: " << (useVM ? "vm" : "interp") << "\n";
+            } else if (cmd == ":budget") {
+                if (!arg.empty()) {
+                    char* end = nullptr;
+                    long n = std::strtol(arg.c_str(), &end, 10);
+                    if (*end != '\0' || n < 0 || n > INT_MAX) {
+                        std::cerr << "Invalid budget " << arg << " (expected a non-negative integer)\n";
+                        continue;
+                    }
+                    budget = static_cast<int>(n);
+                }
+                std::cout << "Budget: " << (budget > 0 ? std::to_string(budget) + " instructions" : "none") << "\n";
+            } else if (cmd == ":disasm") {
+                if (arg.empty()) {
+                    std::cerr << "Usage: :disasm <code>\n";
+                    continue;
+                }
+                auto [program, errors] = parseSource(arg, "<repl>");
+                if (!errors.empty()) {
+                    for (auto& e : errors) std::cerr << e << "\n";
+                    continue;
+                }
+                // Compile against a copy so the snippet's definitions are not kept.
+                defineReplSymbols(*interp, *vm.symbols);
+                try {
+                    Compiler compiler(std::make_shared<SymbolTable>(*vm.symbols), vm.constants);
+                    compiler.setBuiltins([&](const std::string& name, std::string* why) { return interp->bytecodeBuiltin(name, why); });
+                    compiler.compile(program.get());
+                    auto bc = compiler.bytecode();
+                    std::cout << Disassemble(bc->instructions, bc->debug.globals);
+                } catch (const std::exception& e) {
+                    std::cerr << "cannot compile to bytecode: " << e.what() << "\n";
+                }
+            } else if (cmd == ":save") {
+                std::string path = arg.empty() ? ReplStateFile : arg;
+                int saved = 0;
+                std::vector<std::string> skipped;
+                if (!saveReplState(*interp, definitions, path, &saved, &skipped)) {
+                    std::cerr << "Cannot write " << path << "\n";
+                    continue;
+                }
+                std::cout << "Saved " << saved << " name" << (saved == 1 ? "" : "s") << " to " << path;
+                if (!skipped.empty()) {
+                    std::cout << " (skipped";
+                    for (auto& name : skipped) std::cout << " " << name;
+                    std::cout << ")";
+                }
+                std::cout << "\n";
+            } else if (cmd == ":restore") {
+                std::string path = arg.empty() ? ReplStateFile : arg;
+                std::ifstream file(path, std::ios::binary);
+                if (!file) {
+                    std::cerr << "Cannot read " << path << "\n";
+                    continue;
+                }
+                std::stringstream buffer;
+                buffer << file.rdbuf();
+                auto source = buffer.str();
+                auto [program, errors] = parseSource(source, path);
+                if (!errors.empty()) {
+                    for (auto& e : errors) std::cerr << e << "\n";
+                    continue;
+                }
+                auto result = interp->interpret(program.get());
+                if (result && (result->type() == ObjectType::ERROR || result->type() == ObjectType::EXCEPTION_SIGNAL)) {
+                    std::cerr << pretty(result) << "\n";
+                    continue;
+                }
+                recordReplDefinitions(program.get(), source, definitions);
+                std::cout << "Restored " << path << "\n";
+            } else if (cmd == ":help") {
+                printReplHelp();
+            } else {
+                std::cerr << "Unknown command " << cmd << " (try :help)\n";
+            }
+            continue;
+        }
+
+        auto [program, errors] = parseSource(line, "<repl>");
+        if (!errors.empty()) {
+            for (auto& e : errors) std::cerr << e << "\n";
+            continue;
+        }
+        recordReplDefinitions(program.get(), line, definitions);
+        // On the VM, interpreter functions it calls are left to the VM's budget.
+        interp->setInstructionBudget(useVM ? 0 : budget);
+        auto result = useVM ? runReplVM(*interp, vm, program.get(), budget) : interp->interpret(program.get());
+        if (int code; isScriptExit(result, &code)) return code;
+        if (result && result->type() != ObjectType::NULL_OBJ) {
+            std::cout << pretty(result) << "\n";
+            if (result->type() != ObjectType::ERROR && result->type() != ObjectType::EXCEPTION_SIGNAL)
+                bindReplHistory(*interp, history, result);
+        }
+    }
+    return 0;
+}
+
+static bool stdinIsTerminal() {
+#ifdef _WIN32
+    return _isatty(_fileno(stdin)) != 0;
+#else
+    return isatty(STDIN_FILENO) != 0;
+#endif
+}
+
+int main(int argc, char* argv[]) {
+    // A bundled executable runs its script and nothing else.
+    if (Bundle bundle; argv && readBundle(executablePath(argv[0]), &bundle))
+        return report(runSource(bundle.script, bundle.filename));
+
+    if (argc <= 1) {
+        // Piped input is a script, as with `darix run -`.
+        if (!stdinIsTerminal()) return report(runScript("-"));
+        return runRepl(defaultReplRc(), nullptr);
     }
 
     std::string command = argv[1];
 
     if (command == "run") {
+        return runCommand(argc, argv);
+    } else if (command == "eval" || command == "-c") {
         if (argc < 3) {
-            std::cerr << "Usage: darix run <file.dax|->\n";
+            std::cerr << "Usage: darix " << command << " \"<code>\"\n";
             return 1;
         }
-        runFile(argv[2]);
-    } else if (command == "eval") {
-        if (argc < 3) {
-            std::cerr << "Usage: darix eval \"<code>\"\n";
+        return report(runSource(argv[2], "<eval>"));
+    } else if (command == "doc") {
+        return docCommand(argc, argv);
+    } else if (command == "fix") {
+        return fixCommand(argc, argv);
+    } else if (command == "compile") {
+        if (argc != 3 && !(argc == 5 && std::string(argv[3]) == "-o")) {
+            std::cerr << "Usage: darix compile <file.dax> [-o out.daxc]\n";
             return 1;
         }
-        runCode(argv[2]);
+        return compileFile(argv[2], argc == 5 ? argv[4] : "");
+    } else if (command == "serve") {
+        return serveCommand(argc, argv);
+    } else if (command == "bundle") {
+        return bundleCommand(argc, argv);
     } else if (command == "disasm") {
         if (argc < 3) {
-            std::cerr << "Usage: darix disasm <file.dax>\n";
+            std::cerr << "Usage: darix disasm <file.dax|file.daxc>\n";
             return 1;
         }
         disasmFile(argv[2]);
+    } else if (command == "verify") {
+        return verifyCommand(argc, argv);
+    } else if (command == "check") {
+        return checkCommand(argc, argv);
+    } else if (command == "learn") {
+        return learnCommand(argc, argv);
     } else if (command == "version" || command == "-v" || command == "--version") {
         std::cout << versionString() << "\n";
     } else if (command == "help" || command == "-h" || command == "--help") {
         printHelp();
     } else if (command == "repl") {
-        // Same as no-args mode
-        return main(0, nullptr);
+        // Unlike no arguments, starts the REPL even when stdin is piped.
+        std::string rcFile = defaultReplRc();
+        std::string backend;
+        for (int i = 2; i < argc; i++) {
+            std::string arg = argv[i];
+            if (int policy = policyFlag(argc, argv, i)) {
+                if (policy < 0) return 1;
+            } else if (arg == "--backend" && i + 1 < argc) {
+                backend = argv[++i];
+            } else if (arg.rfind("--backend=", 0) == 0) {
+                backend = arg.substr(10);
+            } else if (arg == "--rc" && i + 1 < argc) {
+                rcFile = argv[++i];
+            } else if (arg.rfind("--rc=", 0) == 0) {
+                rcFile = arg.substr(5);
+            } else if (arg == "--no-rc") {
+                rcFile.clear();
+            } else {
+                std::cerr << "Usage: darix repl [--backend=vm|interp] [--rc file | --no-rc] [--allow=grants] [--policy=file] [--audit=log.jsonl] [--rpc name=command] [-W action] [--lang=vN] [--deterministic[=epoch]] [--checked-arith] [--strict]\n";
+                return 1;
+            }
+        }
+        if (!backend.empty() && backend != "vm" && backend != "interp") {
+            std::cerr << "Unknown backend " << backend << " (use vm or interp)\n";
+            return 1;
+        }
+        return runRepl(rcFile, nullptr, backend);
     } else {
         // Try as file
         std::ifstream test(command);
         if (test.good()) {
-            runFile(command);
+            return report(runScript(command));
         } else {
             std::cerr << "Unknown command or file: " << command << "\n\n";
             printHelp();
@@ -1,4 +1,14 @@
 #include "darix/native/native.hpp"
+#include <algorithm>
+#include <cstdio>
+#include <cstdint>
+#include <cstdlib>
+#include <filesystem>
+#include <fstream>
+#include <memory>
+#include <mutex>
+#include <random>
+#include <sstream>
 
 namespace darix::native {
 
@@ -7,21 +17,536 @@ Registry& Registry::instance() {
     return reg;
 }
 
-void Registry::registerModule(const std::string& name, const std::unordered_map<std::string, NativeFunc>& funcs) {
+void Registry::registerModule(const std::string& name, const std::unordered_map<std::string, NativeFunc>& funcs,
+                              const std::string& summary, const std::unordered_map<std::string, FunctionDoc>& docs) {
     NativeModule mod;
     mod.name = name;
     mod.functions = funcs;
+    mod.summary = summary;
+    mod.docs = docs;
     modules_[name] = std::move(mod);
 }
 
+void signatureArity(const std::string& signature, int* min, int* max) {
+    *min = 0;
+    *max = 0;
+    std::string params = signature.substr(signature.find('(') + 1);
+    params = params.substr(0, params.find(')'));
+    size_t pos = 0;
+    while (pos < params.size()) {
+        auto comma = params.find(',', pos);
+        if (comma == std::string::npos) comma = params.size();
+        auto param = params.substr(pos, comma - pos);
+        pos = comma + 1;
+        param.erase(0, param.find_first_not_of(' '));
+        param.erase(param.find_last_not_of(' ') + 1);
+        if (param.empty()) continue;
+        if (param.size() >= 3 && param.compare(param.size() - 3, 3, "...") == 0) {
+            *max = -1;
+            break;
+        }
+        if (param.back() != '?') (*min)++;
+        (*max)++;
+    }
+}
+
+static bool matches(Arg type, const ObjectPtr& arg) {
+    switch (type) {
+        case Arg::Any: return true;
+        case Arg::Integer: return arg->type() == ObjectType::INTEGER;
+        case Arg::Number: return arg->type() == ObjectType::INTEGER || arg->type() == ObjectType::FLOAT;
+        case Arg::Complex:
+            return arg->type() == ObjectType::INTEGER || arg->type() == ObjectType::FLOAT || arg->type() == ObjectType::COMPLEX;
+        case Arg::String: return arg->type() == ObjectType::STRING;
+        case Arg::Boolean: return arg->type() == ObjectType::BOOLEAN;
+        case Arg::Array: return arg->type() == ObjectType::ARRAY;
+        case Arg::Map: return arg->type() == ObjectType::MAP;
+        case Arg::Callable:
+            return arg->type() == ObjectType::FUNCTION || arg->type() == ObjectType::BUILTIN ||
+                   arg->type() == ObjectType::COMPILED_FUNCTION || arg->type() == ObjectType::BOUND_METHOD ||
+                   arg->type() == ObjectType::CLASS;
+    }
+    return false;
+}
+
+static const char* describeArg(Arg type) {
+    switch (type) {
+        case Arg::Any: return "any value";
+        case Arg::Integer: return "an integer";
+        case Arg::Number: return "a number";
+        case Arg::Complex: return "a number";
+        case Arg::String: return "a string";
+        case Arg::Boolean: return "a boolean";
+        case Arg::Array: return "an array";
+        case Arg::Map: return "a map";
+        case Arg::Callable: return "a function";
+    }
+    return "";
+}
+
+static ObjectPtr wrongArg(const std::string& name, size_t index, Arg type, const ObjectPtr& arg) {
+    return typeError(name, "argument " + std::to_string(index + 1) + " must be " + describeArg(type) + ", got " +
+                               ObjectTypeToString(arg->type()));
+}
+
+static ObjectPtr wrongCount(const std::string& name, size_t min, size_t max, size_t given) {
+    std::string expected = max == SIZE_MAX ? "at least " + std::to_string(min)
+                           : min == max    ? std::to_string(min)
+                                           : std::to_string(min) + "-" + std::to_string(max);
+    bool plural = min != 1 || (max != 1 && max != SIZE_MAX);
+    return typeError(name, "expected " + expected + " argument" + (plural ? "s" : "") + ", got " + std::to_string(given));
+}
+
+ObjectPtr requireArgs(const std::string& name, const std::vector<ObjectPtr>& args, std::initializer_list<Arg> types,
+                      size_t optional) {
+    if (args.size() < types.size() - optional || args.size() > types.size())
+        return wrongCount(name, types.size() - optional, types.size(), args.size());
+    size_t i = 0;
+    for (Arg type : types) {
+        if (i == args.size()) break;
+        if (!matches(type, args[i])) return wrongArg(name, i, type, args[i]);
+        i++;
+    }
+    return nullptr;
+}
+
+ObjectPtr requireVarArgs(const std::string& name, const std::vector<ObjectPtr>& args, size_t min, Arg type) {
+    if (args.size() < min) return wrongCount(name, min, SIZE_MAX, args.size());
+    for (size_t i = 0; i < args.size(); i++)
+        if (!matches(type, args[i])) return wrongArg(name, i, type, args[i]);
+    return nullptr;
+}
+
+ObjectPtr typeError(const std::string& name, const std::string& message) {
+    return newExceptionSignal(std::static_pointer_cast<Exception>(newException(TYPE_ERROR, name + ": " + message)));
+}
+
+ObjectPtr valueError(const std::string& name, const std::string& message) {
+    return newExceptionSignal(std::static_pointer_cast<Exception>(newException(VALUE_ERROR, name + ": " + message)));
+}
+
 const NativeModule* Registry::get(const std::string& name) const {
     auto it = modules_.find(name);
     if (it != modules_.end()) return &it->second;
     return nullptr;
 }
 
-void Registry::setEvalCallback(EvalCallback cb) { evalCallback_ = std::move(cb); }
-EvalCallback Registry::getEvalCallback() const { return evalCallback_; }
+std::vector<std::string> Registry::names() const {
+    std::vector<std::string> out;
+    for (auto& [name, mod] : modules_) out.push_back(name);
+    std::sort(out.begin(), out.end());
+    return out;
+}
+
+static thread_local EvalCallback evalCallback;
+
+void Registry::setEvalCallback(EvalCallback cb) { evalCallback = std::move(cb); }
+EvalCallback Registry::getEvalCallback() const { return evalCallback; }
+
+CapabilityPolicy& CapabilityPolicy::instance() {
+    static CapabilityPolicy policy;
+    return policy;
+}
+
+bool CapabilityPolicy::allow(const std::string& grants, std::string* error) {
+    std::map<std::string, std::set<std::string>> added;
+    size_t start = 0;
+    while (start <= grants.size()) {
+        size_t comma = grants.find(',', start);
+        if (comma == std::string::npos) comma = grants.size();
+        std::string grant = grants.substr(start, comma - start);
+        start = comma + 1;
+        if (grant.empty()) continue;
+
+        size_t dot = grant.find('.');
+        std::string module = grant.substr(0, dot);
+        const auto* mod = Registry::instance().get(module);
+        if (!mod) {
+            if (error) *error = "unknown module '" + module + "'";
+            return false;
+        }
+        std::string fn = dot == std::string::npos ? "*" : grant.substr(dot + 1);
+        if (fn != "*" && !mod->functions.count(fn)) {
+            if (error) *error = "unknown function '" + grant + "'";
+            return false;
+        }
+        added[module].insert(fn);
+    }
+
+    restricted_ = true;
+    for (auto& [module, fns] : added) grants_[module].insert(fns.begin(), fns.end());
+    return true;
+}
+
+// The strings of a policy file value that must be a list of them.
+static bool stringList(const ObjectPtr& value, const std::string& key, std::vector<std::string>* out, std::string* error) {
+    auto arr = std::dynamic_pointer_cast<Array>(value);
+    if (arr) {
+        for (auto& e : arr->elements) {
+            auto s = std::dynamic_pointer_cast<String>(e);
+            if (!s) break;
+            out->push_back(s->value);
+        }
+    }
+    if (!arr || out->size() != arr->elements.size()) {
+        *error = key + " must be an array of strings";
+        return false;
+    }
+    return true;
+}
+
+static bool positiveInteger(const ObjectPtr& value, const std::string& key, int* out, std::string* error) {
+    auto n = std::dynamic_pointer_cast<Integer>(value);
+    if (!n || n->value <= 0 || n->value > INT32_MAX) {
+        *error = key + " must be a positive integer";
+        return false;
+    }
+    *out = static_cast<int>(n->value);
+    return true;
+}
+
+bool CapabilityPolicy::load(const std::string& path, ResourceBudget* budget, std::string* error) {
+    std::ifstream file(path);
+    if (!file) {
+        *error = "cannot open " + path;
+        return false;
+    }
+    std::stringstream text;
+    text << file.rdbuf();
+    // Parsed by the json or toml module, exactly as scripts would read it.
+    auto& registry = Registry::instance();
+    registry.initAll();
+    bool toml = std::filesystem::path(path).extension() == ".toml";
+    auto parsed = registry.get(toml ? "toml" : "json")->functions.at("parse")({newString(text.str())});
+    auto map = std::dynamic_pointer_cast<Map>(parsed);
+    if (!map) {
+        *error = path + ": " + (parsed->type() == ObjectType::ERROR || parsed->type() == ObjectType::EXCEPTION_SIGNAL
+                                    ? parsed->inspect()
+                                    : std::string("expected an object at the top level"));
+        return false;
+    }
+
+    std::string grants, problem;
+    std::vector<std::string> roots, hosts, env, console;
+    bool hasRoots = false, hasHosts = false, hasEnv = false, hasConsole = false;
+    ResourceBudget limits;
+    for (auto& [k, value] : map->pairs) {
+        std::string key = k->inspect();
+        bool ok = true;
+        if (key == "allow") {
+            std::vector<std::string> list;
+            if (auto s = std::dynamic_pointer_cast<String>(value)) list.push_back(s->value);
+            else ok = stringList(value, "allow", &list, &problem);
+            for (auto& grant : list) grants += (grants.empty() ? "" : ",") + grant;
+            // An empty list still restricts: it grants nothing.
+            if (ok && grants.empty()) grants = ",";
+        } else if (key == "fs_roots") {
+            ok = hasRoots = stringList(value, key, &roots, &problem);
+        } else if (key == "net_hosts") {
+            ok = hasHosts = stringList(value, key, &hosts, &problem);
+        } else if (key == "env") {
+            ok = hasEnv = stringList(value, key, &env, &problem);
+        } else if (key == "console") {
+            ok = hasConsole = stringList(value, key, &console, &problem);
+            for (auto& stream : console) {
+                if (ok && stream != "output" && stream != "input") {
+                    ok = false;
+                    problem = "console: unknown stream '" + stream + "' (expected output or input)";
+                }
+            }
+        } else if (key == "cpu_seconds") {
+            ok = positiveInteger(value, key, &limits.cpuSeconds, &problem);
+        } else if (key == "memory_mb") {
+            ok = positiveInteger(value, key, &limits.memoryMb, &problem);
+        } else if (key == "max_instructions") {
+            ok = positiveInteger(value, key, &limits.maxInstructions, &problem);
+        } else if (key == "max_string_len") {
+            ok = positiveInteger(value, key, &limits.maxStringLen, &problem);
+        } else if (key == "max_array_len") {
+            ok = positiveInteger(value, key, &limits.maxArrayLen, &problem);
+        } else if (key == "max_map_entries") {
+            ok = positiveInteger(value, key, &limits.maxMapEntries, &problem);
+        } else if (key == "max_exceptions") {
+            ok = positiveInteger(value, key, &limits.maxExceptions, &problem);
+        } else if (key == "max_callback_failures") {
+            ok = positiveInteger(value, key, &limits.maxCallbackFailures, &problem);
+        } else {
+            ok = false;
+            problem = "unknown key '" + key + "' (expected allow, fs_roots, net_hosts, env, console, cpu_seconds, memory_mb, "
+                      "max_instructions, max_string_len, max_array_len, max_map_entries, max_exceptions or max_callback_failures)";
+        }
+        if (!ok) {
+            *error = path + ": " + problem;
+            return false;
+        }
+    }
+    if (!grants.empty() && !allow(grants, &problem)) {
+        *error = path + ": allow: " + problem;
+        return false;
+    }
+
+    auto base = std::filesystem::absolute(path).parent_path();
+    if (hasRoots) limitRoots_ = true;
+    for (auto& root : roots) allowRoot((base / root).string());
+    if (hasHosts) limitHosts_ = true;
+    for (auto& host : hosts) allowHost(host);
+    if (hasEnv) limitEnv_ = true;
+    for (auto& name : env) allowEnv(name);
+    if (hasConsole && std::find(console.begin(), console.end(), "output") == console.end()) denyOutput();
+    if (hasConsole && std::find(console.begin(), console.end(), "input") == console.end()) denyInput();
+    if (limits.cpuSeconds) budget->cpuSeconds = limits.cpuSeconds;
+    if (limits.memoryMb) budget->memoryMb = limits.memoryMb;
+    if (limits.maxInstructions) budget->maxInstructions = limits.maxInstructions;
+    if (limits.maxStringLen) budget->maxStringLen = limits.maxStringLen;
+    if (limits.maxArrayLen) budget->maxArrayLen = limits.maxArrayLen;
+    if (limits.maxMapEntries) budget->maxMapEntries = limits.maxMapEntries;
+    if (limits.maxExceptions) budget->maxExceptions = limits.maxExceptions;
+    if (limits.maxCallbackFailures) budget->maxCallbackFailures = limits.maxCallbackFailures;
+    return true;
+}
+
+void CapabilityPolicy::reset() {
+    restricted_ = false;
+    grants_.clear();
+    denied_.clear();
+    limitRoots_ = limitHosts_ = limitEnv_ = false;
+    denyOutput_ = denyInput_ = false;
+    roots_.clear();
+    hosts_.clear();
+    env_.clear();
+}
+
+bool CapabilityPolicy::allowsModule(const std::string& module) const {
+    if (denied_.count(module)) return false;
+    return !restricted_ || grants_.count(module) > 0;
+}
+
+bool CapabilityPolicy::allows(const std::string& module, const std::string& function) const {
+    if (denied_.count(module)) return false;
+    if (!restricted_) return true;
+    auto it = grants_.find(module);
+    return it != grants_.end() && (it->second.count("*") || it->second.count(function));
+}
+
+// The absolute form of path with ".", ".." and symbolic links resolved, as
+// far as it exists.
+static std::filesystem::path canonicalPath(const std::string& path) {
+    std::error_code ec;
+    auto absolute = std::filesystem::absolute(path, ec);
+    auto canonical = std::filesystem::weakly_canonical(absolute, ec);
+    return ec ? absolute.lexically_normal() : canonical;
+}
+
+static std::string lowercase(std::string s) {
+    std::transform(s.begin(), s.end(), s.begin(), [](unsigned char c) { return std::tolower(c); });
+    return s;
+}
+
+// The host of an http://user@host:port/path URL.
+static std::string urlHost(const std::string& url) {
+    size_t start = url.find("://");
+    start = start == std::string::npos ? 0 : start + 3;
+    std::string host = url.substr(start, url.find_first_of("/?#", start) - start);
+    if (auto at = host.rfind('@'); at != std::string::npos) host = host.substr(at + 1);
+    if (!host.empty() && host[0] == '[') return host.substr(1, host.find(']') - 1);
+    return host.substr(0, host.find(':'));
+}
+
+void CapabilityPolicy::allowRoot(const std::string& dir) {
+    limitRoots_ = true;
+    roots_.push_back(canonicalPath(dir).string());
+}
+
+void CapabilityPolicy::allowHost(const std::string& host) {
+    limitHosts_ = true;
+    hosts_.insert(lowercase(host));
+}
+
+void CapabilityPolicy::deny(const std::string& module) { denied_.insert(module); }
+
+void CapabilityPolicy::allowEnv(const std::string& name) {
+    limitEnv_ = true;
+    env_.insert(name);
+}
+
+bool CapabilityPolicy::allowsPath(const std::string& path) const {
+    if (!limitRoots_) return true;
+    auto target = canonicalPath(path);
+    for (auto& root : roots_) {
+        auto rel = target.lexically_relative(root);
+        if (!rel.empty() && *rel.begin() != "..") return true;
+    }
+    return false;
+}
+
+bool CapabilityPolicy::allowsHost(const std::string& host) const {
+    if (!limitHosts_) return true;
+    std::string name = lowercase(host);
+    if (hosts_.count(name)) return true;
+    for (auto dot = name.find('.'); dot != std::string::npos; dot = name.find('.', dot + 1))
+        if (hosts_.count("*" + name.substr(dot))) return true;
+    return false;
+}
+
+bool CapabilityPolicy::allowsEnv(const std::string& name) const {
+    return !limitEnv_ || env_.count(name) > 0;
+}
+
+// The arguments of native functions that name files, by position. Handles
+// from fs.open and fs.watch are checked when they are opened, so functions
+// that take a handle need no entry.
+static const std::map<std::string, std::vector<size_t>> pathArguments = {
+    {"fs.read", {0}}, {"fs.write", {0}}, {"fs.append", {0}}, {"fs.exists", {0}}, {"fs.is_file", {0}},
+    {"fs.is_dir", {0}}, {"fs.mkdir", {0}}, {"fs.rmdir", {0}}, {"fs.remove", {0}}, {"fs.rename", {0, 1}},
+    {"fs.copy", {0, 1}}, {"fs.size", {0}}, {"fs.list_dir", {0}}, {"fs.list_dir_full", {0}}, {"fs.chdir", {0}},
+    {"fs.open", {0}}, {"fs.watch", {0}},
+    {"archive.tar_create", {0, 1}}, {"archive.tar_extract", {0, 1}}, {"archive.tar_list", {0}},
+    {"archive.zip_create", {0, 1}}, {"archive.zip_extract", {0, 1}}, {"archive.zip_list", {0}},
+    {"csv.read", {0}}, {"csv.each", {0}}, {"csv.write", {0}},
+    {"yaml.read", {0}}, {"yaml.write", {0}}, {"toml.read", {0}}, {"toml.write", {0}},
+    {"i18n.load", {1}},
+};
+
+// Functions of the modules above that touch no files: path arithmetic,
+// open handles, in-memory data. Any other function of those modules is
+// denied under fs_roots, so one added without a pathArguments entry fails
+// closed. fs.glob is filtered instead (see filterResult).
+static const std::set<std::string> pathFree = {
+    "fs.cwd", "fs.join", "fs.parent", "fs.filename", "fs.extension", "fs.stem", "fs.absolute", "fs.normalize",
+    "fs.read_line", "fs.flush", "fs.close", "fs.glob", "fs.temp_dir", "fs.env",
+    "archive.gzip", "archive.gunzip", "archive.deflate", "archive.inflate",
+    "csv.parse", "csv.stringify", "yaml.parse", "yaml.stringify", "toml.parse", "toml.stringify",
+    "i18n.add", "i18n.t", "i18n.plural", "i18n.set_locale", "i18n.locale", "i18n.set_fallback", "i18n.locales",
+};
+
+// The arguments of net functions that name a host, or a URL whose host counts.
+static const std::map<std::string, size_t> hostArguments = {
+    {"net.tcp_connect", 0}, {"net.udp_send", 0}, {"net.resolve", 0},
+};
+static const std::map<std::string, size_t> urlArguments = {
+    {"net.http_get", 0}, {"net.http_post", 0},
+};
+
+std::string CapabilityPolicy::checkArguments(const std::string& module, const std::string& function,
+                                             const std::vector<ObjectPtr>& args) const {
+    static const std::set<std::string> envFunctions = {"os.getenv", "os.setenv", "os.unsetenv", "fs.env"};
+    static const std::set<std::string> fileModules = {"fs", "archive", "csv", "yaml", "toml", "i18n"};
+    std::string qualified = module + "." + function;
+    auto text = [&](size_t i) -> const std::string* {
+        auto s = i < args.size() ? std::dynamic_pointer_cast<String>(args[i]) : nullptr;
+        return s ? &s->value : nullptr;
+    };
+    if (envFunctions.count(qualified)) {
+        auto name = text(0);
+        if (name && !allowsEnv(*name)) return qualified + ": environment variable '" + *name + "' is not allowed by the policy";
+        return "";
+    }
+    if (limitRoots_) {
+        auto paths = pathArguments.find(qualified);
+        if (paths != pathArguments.end()) {
+            for (size_t i : paths->second) {
+                auto value = text(i);
+                if (value && !allowsPath(*value)) return qualified + ": '" + *value + "' is outside the policy's fs_roots";
+            }
+        } else if (fileModules.count(module) && !pathFree.count(qualified)) {
+            return qualified + ": not available under the policy's fs_roots";
+        }
+    }
+    if (limitHosts_) {
+        std::string host;
+        if (auto it = hostArguments.find(qualified); it != hostArguments.end() && text(it->second)) host = *text(it->second);
+        else if (auto it = urlArguments.find(qualified); it != urlArguments.end() && text(it->second)) host = urlHost(*text(it->second));
+        else return "";
+        if (!allowsHost(host)) return qualified + ": host '" + host + "' is not in the policy's net_hosts";
+    }
+    return "";
+}
+
+ObjectPtr CapabilityPolicy::filterResult(const std::string& module, const std::string& function, ObjectPtr result) const {
+    if (!limitRoots_ || module != "fs" || function != "glob") return result;
+    auto found = std::dynamic_pointer_cast<Array>(result);
+    if (!found) return result;
+    std::vector<ObjectPtr> inside;
+    for (auto& path : found->elements) {
+        auto s = std::dynamic_pointer_cast<String>(path);
+        if (s && allowsPath(s->value)) inside.push_back(path);
+    }
+    return newArray(inside);
+}
+
+AuditLog& AuditLog::instance() {
+    static AuditLog log;
+    return log;
+}
+
+bool AuditLog::open(const std::string& path, std::string* error) {
+    out_.open(path, std::ios::app);
+    if (!out_) {
+        if (error) *error = "cannot open " + path;
+        return false;
+    }
+    return true;
+}
+
+void AuditLog::setCallSite(const std::string& file, int line, int column) {
+    file_ = file;
+    line_ = line;
+    column_ = column;
+}
+
+std::string jsonString(const std::string& s) {
+    std::string out = "\"";
+    for (unsigned char c : s) {
+        switch (c) {
+            case '"':  out += "\\\""; break;
+            case '\\': out += "\\\\"; break;
+            case '\n': out += "\\n"; break;
+            case '\t': out += "\\t"; break;
+            case '\r': out += "\\r"; break;
+            default:
+                if (c < 0x20) {
+                    char buf[8];
+                    std::snprintf(buf, sizeof(buf), "\\u%04x", c);
+                    out += buf;
+                } else {
+                    out += static_cast<char>(c);
+                }
+        }
+    }
+    return out + "\"";
+}
+
+// Arguments are logged as their repr, cut short so a large payload doesn't
+// bloat the log.
+static std::string summarizeArg(const ObjectPtr& arg) {
+    constexpr size_t MaxLength = 80;
+    std::string text = arg ? repr(arg) : "null";
+    if (text.size() > MaxLength) text = text.substr(0, MaxLength) + "...";
+    return jsonString(text);
+}
+
+void AuditLog::recordImport(const std::string& module, bool allowed) {
+    write("import", "\"module\":" + jsonString(module), allowed);
+}
+
+void AuditLog::recordCall(const std::string& module, const std::string& function,
+                          const std::vector<ObjectPtr>& args, bool allowed) {
+    std::string fields = "\"module\":" + jsonString(module) + ",\"function\":" + jsonString(function) + ",\"args\":[";
+    for (size_t i = 0; i < args.size(); i++) {
+        if (i > 0) fields += ",";
+        fields += summarizeArg(args[i]);
+    }
+    write("call", fields + "]", allowed);
+}
+
+void AuditLog::write(const std::string& event, const std::string& fields, bool allowed) {
+    auto ms = std::chrono::duration_cast<std::chrono::milliseconds>(
+        std::chrono::system_clock::now().time_since_epoch()).count();
+    // Flushed per record so the log survives a script that crashes or exits.
+    out_ << "{\"time_ms\":" << ms << ",\"event\":\"" << event << "\",\"file\":" << jsonString(file_)
+         << ",\"line\":" << line_ << ",\"column\":" << column_ << "," << fields
+         << ",\"allowed\":" << (allowed ? "true" : "false") << "}" << std::endl;
+}
 
 void Registry::initAll() {
     initMathModule();
@@ -44,11 +569,53 @@ void Registry::initAll() {
     initIoModule();
     initOsModule();
     initEncodingModule();
+    initTimerModule();
+    initCacheModule();
+    initCsvModule();
+    initYamlModule();
+    initTomlModule();
+    initUrlModule();
+    initUuidModule();
+    initArchiveModule();
+    initRpcModule();
+    initI18nModule();
 }
 
-ObjectPtr callCallable(ObjectPtr callable, const std::vector<ObjectPtr>& args) {
+static ErrorBudget failureLimits;
+static std::atomic<int64_t> rethrown{0};
+static std::atomic<int64_t> callbackFailures{0};
+static std::string spentReason;
+
+namespace detail {
+std::atomic<bool> errorBudgetSpent{false};
+} // namespace detail
+
+void setErrorBudget(ErrorBudget budget) {
+    failureLimits = budget;
+    rethrown = 0;
+    callbackFailures = 0;
+    detail::errorBudgetSpent = false;
+}
+
+const ErrorBudget& errorBudget() { return failureLimits; }
+
+ObjectPtr errorBudgetError() { return newError("error budget exceeded: %s", spentReason.c_str()); }
+
+static ObjectPtr spendErrorBudget(const std::string& reason) {
+    if (!detail::errorBudgetSpent.exchange(true)) spentReason = reason;
+    return errorBudgetError();
+}
+
+ObjectPtr countRethrown() {
+    int limit = failureLimits.maxExceptions;
+    if (limit <= 0 || ++rethrown <= limit) return nullptr;
+    return spendErrorBudget("more than " + std::to_string(limit) + " exceptions raised from catch clauses");
+}
+
+static ObjectPtr invokeCallable(const ObjectPtr& callable, const std::vector<ObjectPtr>& args) {
     // Try builtin first
     if (auto builtin = std::dynamic_pointer_cast<Builtin>(callable)) {
+        if (auto err = arityError(*builtin, args.size())) return err;
         return builtin->fn(args);
     }
     // Try user-defined function via interpreter callback
@@ -59,4 +626,156 @@ ObjectPtr callCallable(ObjectPtr callable, const std::vector<ObjectPtr>& args) {
     return newError("cannot call: no evaluator available for function type");
 }
 
+ObjectPtr callCallable(ObjectPtr callable, const std::vector<ObjectPtr>& args) {
+    int limit = failureLimits.maxCallbackFailures;
+    if (limit <= 0) return invokeCallable(callable, args);
+    if (detail::errorBudgetSpent) return errorBudgetError();
+    auto result = invokeCallable(callable, args);
+    bool failed = result && (result->type() == ObjectType::ERROR || result->type() == ObjectType::EXCEPTION_SIGNAL);
+    if (!failed) {
+        callbackFailures = 0;
+        return result;
+    }
+    if (++callbackFailures < limit) return result;
+    return spendErrorBudget(std::to_string(limit) + " callbacks failed in a row");
+}
+
+static OutputSink& outputSink() {
+    static OutputSink sink;
+    return sink;
+}
+
+OutputSink setOutputSink(OutputSink sink) {
+    std::swap(outputSink(), sink);
+    return sink;
+}
+
+ObjectPtr writeOutput(const std::string& name, const std::string& text) {
+    if (!CapabilityPolicy::instance().allowsOutput())
+        return newError("PermissionError: %s: console output is not allowed by the capability policy", name.c_str());
+    // parallel_map workers may print at the same time.
+    static std::mutex lock;
+    std::lock_guard<std::mutex> guard(lock);
+    if (auto& sink = outputSink()) sink(text);
+    else std::fwrite(text.data(), 1, text.size(), stdout);
+    return nullptr;
+}
+
+ObjectPtr inputDenied(const std::string& name) {
+    if (CapabilityPolicy::instance().allowsInput()) return nullptr;
+    return newError("PermissionError: %s: console input is not allowed by the capability policy", name.c_str());
+}
+
+static WallClock& clockSource() {
+    static WallClock clock;
+    return clock;
+}
+
+void setClock(WallClock clock) { clockSource() = std::move(clock); }
+
+std::chrono::system_clock::time_point currentTime() {
+    auto& clock = clockSource();
+    return clock ? clock() : std::chrono::system_clock::now();
+}
+
+// Set by setDeterministic; yields the seeds randomSeed hands out.
+static std::unique_ptr<std::mt19937_64>& seedStream() {
+    static std::unique_ptr<std::mt19937_64> stream;
+    return stream;
+}
+
+void setDeterministic(uint64_t seed) { seedStream() = std::make_unique<std::mt19937_64>(seed); }
+
+bool deterministic() { return seedStream() != nullptr; }
+
+uint64_t randomSeed() {
+    if (auto& stream = seedStream()) return (*stream)();
+    std::random_device rd;
+    return (static_cast<uint64_t>(rd()) << 32) | rd();
+}
+
+// Open handles and the owner each was opened for. parallel_map workers open
+// handles too, hence the lock.
+struct TrackedHandle {
+    std::shared_ptr<Handle> handle;
+    const void* owner;
+};
+static std::vector<TrackedHandle>& openHandles() {
+    // Never destroyed: closeAllHandles runs from atexit, after statics built
+    // later than its registration are gone.
+    static auto* handles = new std::vector<TrackedHandle>();
+    return *handles;
+}
+static std::mutex handlesLock;
+static thread_local const void* handleOwner = nullptr;
+
+void setHandleOwner(const void* owner) { handleOwner = owner; }
+
+std::shared_ptr<Handle> openHandle(const std::string& kind, int64_t id, std::function<void()> release) {
+    static bool finalizerInstalled = std::atexit(closeAllHandles) == 0;
+    (void)finalizerInstalled;
+    auto handle = std::make_shared<Handle>();
+    handle->kind = kind;
+    handle->id = id;
+    handle->release = std::move(release);
+    std::lock_guard<std::mutex> guard(handlesLock);
+    auto& handles = openHandles();
+    handles.erase(std::remove_if(handles.begin(), handles.end(), [](const TrackedHandle& t) { return t.handle->closed; }),
+                  handles.end());
+    handles.push_back({handle, handleOwner});
+    return handle;
+}
+
+bool handleId(const ObjectPtr& obj, const std::string& kind, int64_t* id) {
+    if (auto h = std::dynamic_pointer_cast<Handle>(obj)) {
+        if (h->closed || h->kind != kind) return false;
+        *id = h->id;
+        return true;
+    }
+    if (auto i = std::dynamic_pointer_cast<Integer>(obj)) {
+        *id = i->value;
+        return true;
+    }
+    return false;
+}
+
+bool closeHandle(const ObjectPtr& obj, const std::string& kind) {
+    if (auto h = std::dynamic_pointer_cast<Handle>(obj)) return h->kind == kind && h->close();
+    auto i = std::dynamic_pointer_cast<Integer>(obj);
+    if (!i) return false;
+    std::shared_ptr<Handle> match;
+    {
+        std::lock_guard<std::mutex> guard(handlesLock);
+        for (auto& t : openHandles()) {
+            if (!t.handle->closed && t.handle->kind == kind && t.handle->id == i->value) match = t.handle;
+        }
+    }
+    return match && match->close();
+}
+
+// Takes the open handles owner matches out of the table; closing happens
+// outside the lock, since a release function may open or close others.
+static std::vector<std::shared_ptr<Handle>> takeHandles(const std::function<bool(const void*)>& matches) {
+    std::lock_guard<std::mutex> guard(handlesLock);
+    std::vector<std::shared_ptr<Handle>> taken;
+    auto& handles = openHandles();
+    auto kept = std::remove_if(handles.begin(), handles.end(), [&](const TrackedHandle& t) {
+        if (!matches(t.owner)) return false;
+        taken.push_back(t.handle);
+        return true;
+    });
+    handles.erase(kept, handles.end());
+    return taken;
+}
+
+void closeHandles(const void* owner) {
+    auto handles = takeHandles([owner](const void* o) { return o == owner; });
+    for (auto it = handles.rbegin(); it != handles.rend(); ++it) (*it)->close();
+}
+
+void closeAllHandles() {
+    auto handles = takeHandles([](const void*) { return true; });
+    for (auto it = handles.rbegin(); it != handles.rend(); ++it) (*it)->close();
+}
+
 } // namespace darix::native
@@ -0,0 +1,825 @@
+#include "darix/native/native.hpp"
+#include <algorithm>
+#include <array>
+#include <cstring>
+#include <ctime>
+#include <filesystem>
+#include <fstream>
+#include <sstream>
+
+namespace fs = std::filesystem;
+
+namespace darix::native {
+
+static ObjectPtr makeError(const std::string& msg) { return newError("%s", msg.c_str()); }
+
+static std::string getString(ObjectPtr obj) {
+    if (auto s = std::dynamic_pointer_cast<String>(obj)) return s->value;
+    return "";
+}
+
+static int64_t getInt(ObjectPtr obj) {
+    if (auto i = std::dynamic_pointer_cast<Integer>(obj)) return i->value;
+    if (auto f = std::dynamic_pointer_cast<Float>(obj)) return static_cast<int64_t>(f->value);
+    return 0;
+}
+
+struct ArchiveError {
+    std::string message;
+};
+
+// Decompressed output grew past the policy's max_string_len; error is the
+// ResourceError to raise.
+struct OutputTooLarge {
+    ObjectPtr error;
+};
+
+static uint32_t crc32(const std::string& data) {
+    static const auto table = [] {
+        std::array<uint32_t, 256> t{};
+        for (uint32_t i = 0; i < 256; i++) {
+            uint32_t c = i;
+            for (int k = 0; k < 8; k++) c = (c & 1) ? 0xEDB88320u ^ (c >> 1) : c >> 1;
+            t[i] = c;
+        }
+        return t;
+    }();
+    uint32_t crc = 0xFFFFFFFFu;
+    for (unsigned char b : data) crc = table[(crc ^ b) & 0xFF] ^ (crc >> 8);
+    return crc ^ 0xFFFFFFFFu;
+}
+
+// ============ DEFLATE (RFC 1951) ============
+
+static const uint16_t kLengthBase[29] = {3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31,
+                                         35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258};
+static const uint8_t kLengthExtra[29] = {0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2,
+                                         3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0};
+static const uint16_t kDistBase[30] = {1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129,
+                                       193, 257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097,
+                                       6145, 8193, 12289, 16385, 24577};
+static const uint8_t kDistExtra[30] = {0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6,
+                                       6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13};
+
+class BitWriter {
+public:
+    void write(uint32_t bits, int count) {
+        buffer_ |= static_cast<uint64_t>(bits) << used_;
+        used_ += count;
+        while (used_ >= 8) {
+            out_ += static_cast<char>(buffer_ & 0xFF);
+            buffer_ >>= 8;
+            used_ -= 8;
+        }
+    }
+
+    // Huffman codes are packed most-significant bit first
+    void writeCode(uint32_t code, int length) {
+        uint32_t reversed = 0;
+        for (int i = 0; i < length; i++) reversed |= ((code >> i) & 1) << (length - 1 - i);
+        write(reversed, length);
+    }
+
+    std::string finish() {
+        if (used_ > 0) out_ += static_cast<char>(buffer_ & 0xFF);
+        buffer_ = 0;
+        used_ = 0;
+        return out_;
+    }
+
+private:
+    std::string out_;
+    uint64_t buffer_ = 0;
+    int used_ = 0;
+};
+
+static void writeFixedLiteral(BitWriter& w, int sym) {
+    if (sym < 144) w.writeCode(0x30 + sym, 8);
+    else if (sym < 256) w.writeCode(0x190 + sym - 144, 9);
+    else if (sym < 280) w.writeCode(sym - 256, 7);
+    else w.writeCode(0xC0 + sym - 280, 8);
+}
+
+static void writeMatch(BitWriter& w, int length, int distance) {
+    int lc = 28;
+    while (kLengthBase[lc] > length) lc--;
+    writeFixedLiteral(w, 257 + lc);
+    w.write(length - kLengthBase[lc], kLengthExtra[lc]);
+    int dc = 29;
+    while (kDistBase[dc] > distance) dc--;
+    w.writeCode(dc, 5);
+    w.write(distance - kDistBase[dc], kDistExtra[dc]);
+}
+
+// Level 0 stores the data; levels 1-9 use LZ77 with fixed Huffman codes,
+// searching longer hash chains at higher levels.
+static std::string deflateRaw(const std::string& data, int level) {
+    if (level == 0) {
+        std::string out;
+        size_t pos = 0;
+        do {
+            size_t len = std::min<size_t>(65535, data.size() - pos);
+            bool last = pos + len >= data.size();
+            out += static_cast<char>(last ? 1 : 0);
+            out += static_cast<char>(len & 0xFF);
+            out += static_cast<char>(len >> 8);
+            out += static_cast<char>(~len & 0xFF);
+            out += static_cast<char>((~len >> 8) & 0xFF);
+            out.append(data, pos, len);
+            pos += len;
+        } while (pos < data.size());
+        return out;
+    }
+
+    const int kWindow = 32768, kHashSize = 1 << 15, kMaxMatch = 258;
+    const int maxChain = level >= 9 ? 1024 : level >= 6 ? 128 : 16;
+    std::vector<int> head(kHashSize, -1), prev(kWindow, -1);
+    auto hashAt = [&](size_t i) {
+        return ((static_cast<unsigned char>(data[i]) << 10) ^ (static_cast<unsigned char>(data[i + 1]) << 5) ^
+                static_cast<unsigned char>(data[i + 2])) & (kHashSize - 1);
+    };
+    auto insert = [&](size_t i) {
+        if (i + 2 >= data.size()) return;
+        int h = hashAt(i);
+        prev[i % kWindow] = head[h];
+        head[h] = static_cast<int>(i);
+    };
+
+    BitWriter w;
+    w.write(1, 1); // final block
+    w.write(1, 2); // fixed Huffman
+    size_t i = 0;
+    while (i < data.size()) {
+        int bestLen = 0, bestDist = 0;
+        if (i + 2 < data.size()) {
+            int candidate = head[hashAt(i)];
+            int chain = maxChain;
+            size_t limit = std::min<size_t>(kMaxMatch, data.size() - i);
+            while (candidate >= 0 && chain-- > 0 && i - candidate <= static_cast<size_t>(kWindow)) {
+                size_t len = 0;
+                while (len < limit && data[candidate + len] == data[i + len]) len++;
+                if (static_cast<int>(len) > bestLen) {
+                    bestLen = static_cast<int>(len);
+                    bestDist = static_cast<int>(i - candidate);
+                    if (len == limit) break;
+                }
+                int next = prev[candidate % kWindow];
+                if (next >= candidate) break; // slot was reused by a newer position
+                candidate = next;
+            }
+        }
+        if (bestLen >= 3) {
+            writeMatch(w, bestLen, bestDist);
+            for (int k = 0; k < bestLen; k++) insert(i + k);
+            i += bestLen;
+        } else {
+            writeFixedLiteral(w, static_cast<unsigned char>(data[i]));
+            insert(i);
+            i++;
+        }
+    }
+    writeFixedLiteral(w, 256);
+    return w.finish();
+}
+
+class Inflater {
+public:
+    // Decompression stops as soon as before (output already produced, by
+    // earlier gzip members) plus this stream's output passes limit, so a
+    // small bomb cannot exhaust memory first. A limit of 0 means none.
+    Inflater(const std::string& in, size_t pos, size_t limit = 0, size_t before = 0)
+        : in_(in), pos_(pos), limit_(limit), before_(before) {}
+
+    std::string run() {
+        bool last;
+        do {
+            last = bits(1);
+            int type = bits(2);
+            if (type == 0) stored();
+            else if (type == 1) fixed();
+            else if (type == 2) dynamic();
+            else throw ArchiveError{"invalid deflate block type"};
+        } while (!last);
+        return out_;
+    }
+
+    // Byte offset just past the compressed stream
+    size_t position() const { return pos_; }
+
+private:
+    struct Huffman {
+        std::vector<uint16_t> counts = std::vector<uint16_t>(16, 0);
+        std::vector<uint16_t> symbols;
+    };
+
+    const std::string& in_;
+    size_t pos_;
+    size_t limit_;
+    size_t before_;
+    uint32_t bitBuf_ = 0;
+    int bitCount_ = 0;
+    std::string out_;
+
+    int bits(int need) {
+        uint32_t val = bitBuf_;
+        while (bitCount_ < need) {
+            if (pos_ >= in_.size()) throw ArchiveError{"unexpected end of compressed data"};
+            val |= static_cast<uint32_t>(static_cast<unsigned char>(in_[pos_++])) << bitCount_;
+            bitCount_ += 8;
+        }
+        bitBuf_ = val >> need;
+        bitCount_ -= need;
+        return static_cast<int>(val & ((1u << need) - 1));
+    }
+
+    void stored() {
+        bitBuf_ = 0;
+        bitCount_ = 0;
+        if (pos_ + 4 > in_.size()) throw ArchiveError{"unexpected end of compressed data"};
+        auto byte = [&](size_t i) { return static_cast<unsigned>(static_cast<unsigned char>(in_[i])); };
+        unsigned len = byte(pos_) | (byte(pos_ + 1) << 8);
+        unsigned nlen = byte(pos_ + 2) | (byte(pos_ + 3) << 8);
+        if (len != (~nlen & 0xFFFF)) throw ArchiveError{"corrupt stored block"};
+        pos_ += 4;
+        if (pos_ + len > in_.size()) throw ArchiveError{"unexpected end of compressed data"};
+        out_.append(in_, pos_, len);
+        checkLimit();
+        pos_ += len;
+    }
+
+    void checkLimit() const {
+        if (limit_ && before_ + out_.size() > limit_) throw OutputTooLarge{stringSizeError(before_ + out_.size())};
+    }
+
+    static Huffman build(const uint8_t* lengths, int n) {
+        Huffman h;
+        h.symbols.assign(n, 0);
+        for (int i = 0; i < n; i++) h.counts[lengths[i]]++;
+        h.counts[0] = 0;
+        std::vector<uint16_t> offs(16, 0);
+        for (int len = 1; len < 15; len++) offs[len + 1] = offs[len] + h.counts[len];
+        for (int i = 0; i < n; i++) {
+            if (lengths[i] != 0) h.symbols[offs[lengths[i]]++] = static_cast<uint16_t>(i);
+        }
+        return h;
+    }
+
+    int decode(const Huffman& h) {
+        int code = 0, first = 0, index = 0;
+        for (int len = 1; len < 16; len++) {
+            code |= bits(1);
+            int count = h.counts[len];
+            if (code - count < first) return h.symbols[index + (code - first)];
+            index += count;
+            first += count;
+            first <<= 1;
+            code <<= 1;
+        }
+        throw ArchiveError{"invalid Huffman code"};
+    }
+
+    void codes(const Huffman& lit, const Huffman& dist) {
+        for (;;) {
+            int sym = decode(lit);
+            if (sym < 256) {
+                out_ += static_cast<char>(sym);
+                checkLimit();
+                continue;
+            }
+            if (sym == 256) return;
+            sym -= 257;
+            if (sym >= 29) throw ArchiveError{"invalid length code"};
+            int len = kLengthBase[sym] + bits(kLengthExtra[sym]);
+            int dsym = decode(dist);
+            if (dsym >= 30) throw ArchiveError{"invalid distance code"};
+            size_t d = kDistBase[dsym] + bits(kDistExtra[dsym]);
+            if (d > out_.size()) throw ArchiveError{"distance too far back"};
+            size_t from = out_.size() - d;
+            for (int k = 0; k < len; k++) out_ += out_[from + k];
+            checkLimit();
+        }
+    }
+
+    void fixed() {
+        static const auto tables = [] {
+            uint8_t lengths[288];
+            int i = 0;
+            for (; i < 144; i++) lengths[i] = 8;
+            for (; i < 256; i++) lengths[i] = 9;
+            for (; i < 280; i++) lengths[i] = 7;
+            for (; i < 288; i++) lengths[i] = 8;
+            uint8_t dlengths[30];
+            std::fill(dlengths, dlengths + 30, 5);
+            return std::make_pair(build(lengths, 288), build(dlengths, 30));
+        }();
+        codes(tables.first, tables.second);
+    }
+
+    void dynamic() {
+        static const uint8_t order[19] = {16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15};
+        int nlen = bits(5) + 257, ndist = bits(5) + 1, ncode = bits(4) + 4;
+        if (nlen > 286 || ndist > 30) throw ArchiveError{"bad dynamic block header"};
+        uint8_t lengths[320] = {0};
+        for (int i = 0; i < ncode; i++) lengths[order[i]] = static_cast<uint8_t>(bits(3));
+        Huffman lencode = build(lengths, 19);
+
+        int index = 0;
+        std::fill(lengths, lengths + 320, 0);
+        while (index < nlen + ndist) {
+            int sym = decode(lencode);
+            if (sym < 16) { lengths[index++] = static_cast<uint8_t>(sym); continue; }
+            uint8_t len = 0;
+            int repeat;
+            if (sym == 16) {
+                if (index == 0) throw ArchiveError{"repeat with no previous length"};
+                len = lengths[index - 1];
+                repeat = 3 + bits(2);
+            } else if (sym == 17) {
+                repeat = 3 + bits(3);
+            } else {
+                repeat = 11 + bits(7);
+            }
+            if (index + repeat > nlen + ndist) throw ArchiveError{"too many code lengths"};
+            while (repeat--) lengths[index++] = len;
+        }
+        codes(build(lengths, nlen), build(lengths + nlen, ndist));
+    }
+};
+
+static std::string inflateRaw(const std::string& data, size_t pos = 0, size_t* end = nullptr, size_t limit = 0,
+                              size_t before = 0) {
+    Inflater inf(data, pos, limit, before);
+    std::string out = inf.run();
+    if (end) *end = inf.position();
+    return out;
+}
+
+// ============ gzip (RFC 1952) ============
+
+static void putLE(std::string& out, uint32_t v, int bytes) {
+    for (int i = 0; i < bytes; i++) out += static_cast<char>((v >> (8 * i)) & 0xFF);
+}
+
+static uint32_t getLE(const std::string& s, size_t pos, int bytes) {
+    if (pos + bytes > s.size()) throw ArchiveError{"unexpected end of data"};
+    uint32_t v = 0;
+    for (int i = 0; i < bytes; i++) v |= static_cast<uint32_t>(static_cast<unsigned char>(s[pos + i])) << (8 * i);
+    return v;
+}
+
+static std::string gzipCompress(const std::string& data, int level) {
+    std::string out = "\x1f\x8b\x08";
+    out += '\0';                       // flags
+    putLE(out, 0, 4);                  // mtime
+    out += static_cast<char>(level >= 9 ? 2 : 0);
+    out += static_cast<char>(255);     // unknown OS
+    out += deflateRaw(data, level);
+    putLE(out, crc32(data), 4);
+    putLE(out, static_cast<uint32_t>(data.size()), 4);
+    return out;
+}
+
+// Decompresses every concatenated gzip member, verifying each checksum. A
+// limit applies to the output of all members together.
+static std::string gzipDecompress(const std::string& data, size_t limit = 0) {
+    std::string out;
+    size_t pos = 0;
+    do {
+        if (pos + 10 > data.size() || data[pos] != '\x1f' || data[pos + 1] != '\x8b')
+            throw ArchiveError{"not gzip data"};
+        if (data[pos + 2] != 8) throw ArchiveError{"unsupported compression method"};
+        int flags = static_cast<unsigned char>(data[pos + 3]);
+        pos += 10;
+        if (flags & 4) pos += 2 + getLE(data, pos, 2);            // FEXTRA
+        for (int bit : {8, 16}) {                                  // FNAME, FCOMMENT
+            if (!(flags & bit)) continue;
+            while (pos < data.size() && data[pos] != '\0') pos++;
+            pos++;
+        }
+        if (flags & 2) pos += 2;                                   // FHCRC
+        size_t end = 0;
+        std::string member = inflateRaw(data, pos, &end, limit, out.size());
+        if (getLE(data, end, 4) != crc32(member)) throw ArchiveError{"gzip checksum mismatch"};
+        if (getLE(data, end + 4, 4) != static_cast<uint32_t>(member.size())) throw ArchiveError{"gzip size mismatch"};
+        out += member;
+        pos = end + 8;
+    } while (pos < data.size());
+    return out;
+}
+
+// ============ Filesystem helpers ============
+
+static std::string readFile(const fs::path& path) {
+    std::ifstream in(path, std::ios::binary);
+    if (!in.is_open()) throw ArchiveError{"cannot open file '" + path.string() + "'"};
+    std::stringstream buffer;
+    buffer << in.rdbuf();
+    return buffer.str();
+}
+
+static void writeFile(const fs::path& path, const std::string& data) {
+    std::ofstream out(path, std::ios::binary);
+    if (!out.is_open()) throw ArchiveError{"cannot write file '" + path.string() + "'"};
+    out << data;
+    if (!out.good()) throw ArchiveError{"failed writing '" + path.string() + "'"};
+}
+
+static bool isGzipPath(const std::string& path) {
+    auto endsWith = [&](const std::string& suffix) {
+        return path.size() >= suffix.size() && path.compare(path.size() - suffix.size(), suffix.size(), suffix) == 0;
+    };
+    return endsWith(".gz") || endsWith(".tgz");
+}
+
+struct Entry {
+    std::string name; // '/'-separated, directories end in '/'
+    bool isDir = false;
+    std::string data;
+};
+
+// Collects a directory tree as archive entries named relative to root.
+static std::vector<Entry> collect(const std::string& root) {
+    fs::path base(root);
+    if (!fs::is_directory(base)) throw ArchiveError{"'" + root + "' is not a directory"};
+    std::vector<Entry> entries;
+    for (auto& item : fs::recursive_directory_iterator(base)) {
+        Entry e;
+        e.name = fs::relative(item.path(), base).generic_string();
+        if (item.is_directory()) {
+            e.isDir = true;
+            e.name += "/";
+        } else if (item.is_regular_file()) {
+            e.data = readFile(item.path());
+        } else {
+            continue;
+        }
+        entries.push_back(std::move(e));
+    }
+    std::sort(entries.begin(), entries.end(), [](const Entry& a, const Entry& b) { return a.name < b.name; });
+    return entries;
+}
+
+// Refuses names that would escape the destination directory.
+static fs::path safeTarget(const fs::path& dest, const std::string& name) {
+    fs::path rel = fs::path(name).lexically_normal();
+    if (name.empty() || rel.is_absolute() || rel.has_root_name() || *rel.begin() == "..")
+        throw ArchiveError{"refusing to extract unsafe path '" + name + "'"};
+    return dest / rel;
+}
+
+static void extractEntries(const std::vector<Entry>& entries, const std::string& dest) {
+    fs::path base(dest);
+    fs::create_directories(base);
+    for (auto& e : entries) {
+        fs::path target = safeTarget(base, e.name);
+        if (e.isDir) {
+            fs::create_directories(target);
+        } else {
+            if (target.has_parent_path()) fs::create_directories(target.parent_path());
+            writeFile(target, e.data);
+        }
+    }
+}
+
+static ObjectPtr listing(const std::vector<Entry>& entries) {
+    std::vector<ObjectPtr> items;
+    for (auto& e : entries) {
+        items.push_back(newMap({
+            {newString("name"), newString(e.name)},
+            {newString("size"), newInteger(static_cast<int64_t>(e.data.size()))},
+            {newString("dir"), newBoolean(e.isDir)},
+        }));
+    }
+    return newArray(items);
+}
+
+// ============ tar (POSIX ustar) ============
+
+static void putOctal(char* field, size_t width, uint64_t value) {
+    std::snprintf(field, width, "%0*llo", static_cast<int>(width - 1), static_cast<unsigned long long>(value));
+}
+
+static std::string tarCreate(const std::vector<Entry>& entries) {
+    std::string out;
+    for (auto& e : entries) {
+        char header[512] = {0};
+        std::string name = e.name, prefix;
+        if (name.size() > 100) {
+            size_t split = name.rfind('/', name.size() - (e.isDir ? 2 : 1));
+            while (split != std::string::npos && split > 155) split = name.rfind('/', split - 1);
+            if (split == std::string::npos || name.size() - split - 1 > 100)
+                throw ArchiveError{"path too long for tar: '" + name + "'"};
+            prefix = name.substr(0, split);
+            name = name.substr(split + 1);
+        }
+        std::memcpy(header, name.data(), name.size());
+        putOctal(header + 100, 8, e.isDir ? 0755 : 0644);
+        putOctal(header + 108, 8, 0);
+        putOctal(header + 116, 8, 0);
+        putOctal(header + 124, 12, e.data.size());
+        putOctal(header + 136, 12, static_cast<uint64_t>(std::chrono::system_clock::to_time_t(currentTime())));
+        header[156] = e.isDir ? '5' : '0';
+        std::memcpy(header + 257, "ustar", 6);
+        std::memcpy(header + 263, "00", 2);
+        std::memcpy(header + 345, prefix.data(), prefix.size());
+
+        std::memset(header + 148, ' ', 8);
+        unsigned sum = 0;
+        for (unsigned char c : header) sum += c;
+        std::snprintf(header + 148, 8, "%06o", sum);
+        header[155] = ' ';
+
+        out.append(header, 512);
+        out += e.data;
+        out.append((512 - e.data.size() % 512) % 512, '\0');
+    }
+    out.append(1024, '\0');
+    return out;
+}
+
+static uint64_t parseOctal(const char* field, size_t width) {
+    uint64_t v = 0;
+    for (size_t i = 0; i < width && field[i]; i++) {
+        if (field[i] == ' ') continue;
+        if (field[i] < '0' || field[i] > '7') break;
+        v = v * 8 + (field[i] - '0');
+    }
+    return v;
+}
+
+static std::vector<Entry> tarRead(const std::string& data) {
+    std::vector<Entry> entries;
+    std::string longName;
+    size_t pos = 0;
+    while (pos + 512 <= data.size()) {
+        const char* h = data.data() + pos;
+        if (std::all_of(h, h + 512, [](char c) { return c == '\0'; })) break;
+        uint64_t size = parseOctal(h + 124, 12);
+        char type = h[156];
+        pos += 512;
+        if (pos + size > data.size()) throw ArchiveError{"truncated tar entry"};
+        std::string body = data.substr(pos, size);
+        pos += (size + 511) / 512 * 512;
+
+        if (type == 'L') { longName = body.c_str(); continue; }   // GNU long name
+        if (type == 'x' || type == 'g') continue;                 // pax headers
+        Entry e;
+        if (!longName.empty()) {
+            e.name = longName;
+            longName.clear();
+        } else {
+            std::string name(h, strnlen(h, 100));
+            std::string prefix(h + 345, strnlen(h + 345, 155));
+            e.name = prefix.empty() ? name : prefix + "/" + name;
+        }
+        if (type == '5') {
+            e.isDir = true;
+            if (e.name.empty() || e.name.back() != '/') e.name += "/";
+        } else if (type == '0' || type == '\0' || type == '7') {
+            e.data = std::move(body);
+        } else {
+            continue; // links and devices are skipped
+        }
+        entries.push_back(std::move(e));
+    }
+    return entries;
+}
+
+// ============ zip (PKWARE APPNOTE) ============
+
+static void dosDateTime(uint16_t& time, uint16_t& date) {
+    std::time_t now = std::chrono::system_clock::to_time_t(currentTime());
+    std::tm tm{};
+#ifdef _WIN32
+    localtime_s(&tm, &now);
+#else
+    localtime_r(&now, &tm);
+#endif
+    time = static_cast<uint16_t>((tm.tm_hour << 11) | (tm.tm_min << 5) | (tm.tm_sec / 2));
+    date = static_cast<uint16_t>(((tm.tm_year - 80) << 9) | ((tm.tm_mon + 1) << 5) | tm.tm_mday);
+}
+
+static std::string zipCreate(const std::vector<Entry>& entries, int level) {
+    std::string out, central;
+    uint16_t time, date;
+    dosDateTime(time, date);
+    for (auto& e : entries) {
+        uint32_t crc = crc32(e.data);
+        std::string payload = e.data;
+        uint16_t method = 0;
+        if (!e.isDir && level > 0 && !e.data.empty()) {
+            std::string packed = deflateRaw(e.data, level);
+            if (packed.size() < e.data.size()) { payload = std::move(packed); method = 8; }
+        }
+        uint32_t offset = static_cast<uint32_t>(out.size());
+
+        auto common = [&](std::string& rec) {
+            putLE(rec, 20, 2);      // version needed
+            putLE(rec, 0x0800, 2);  // UTF-8 names
+            putLE(rec, method, 2);
+            putLE(rec, time, 2);
+            putLE(rec, date, 2);
+            putLE(rec, crc, 4);
+            putLE(rec, static_cast<uint32_t>(payload.size()), 4);
+            putLE(rec, static_cast<uint32_t>(e.data.size()), 4);
+            putLE(rec, static_cast<uint32_t>(e.name.size()), 2);
+            putLE(rec, 0, 2);       // extra length
+        };
+        putLE(out, 0x04034b50, 4);
+        common(out);
+        out += e.name;
+        out += payload;
+
+        putLE(central, 0x02014b50, 4);
+        putLE(central, 0x031E, 2);  // made by: Unix, spec 3.0
+        common(central);
+        putLE(central, 0, 2);       // comment length
+        putLE(central, 0, 2);       // disk number
+        putLE(central, 0, 2);       // internal attributes
+        putLE(central, (e.isDir ? 040755u : 0100644u) << 16 | (e.isDir ? 0x10 : 0), 4);
+        putLE(central, offset, 4);
+        central += e.name;
+    }
+    uint32_t centralOffset = static_cast<uint32_t>(out.size());
+    out += central;
+    putLE(out, 0x06054b50, 4);
+    putLE(out, 0, 4);
+    putLE(out, static_cast<uint32_t>(entries.size()), 2);
+    putLE(out, static_cast<uint32_t>(entries.size()), 2);
+    putLE(out, static_cast<uint32_t>(central.size()), 4);
+    putLE(out, centralOffset, 4);
+    putLE(out, 0, 2);
+    return out;
+}
+
+static std::vector<Entry> zipRead(const std::string& data) {
+    // The end-of-central-directory record sits within the last 64KB + 22 bytes
+    size_t eocd = std::string::npos;
+    for (size_t i = data.size() >= 22 ? data.size() - 22 : 0;; i--) {
+        if (getLE(data, i, 4) == 0x06054b50) { eocd = i; break; }
+        if (i == 0 || data.size() - i > 65535 + 22) break;
+    }
+    if (eocd == std::string::npos) throw ArchiveError{"not a zip archive"};
+    uint32_t count = getLE(data, eocd + 10, 2);
+    size_t pos = getLE(data, eocd + 16, 4);
+
+    std::vector<Entry> entries;
+    for (uint32_t n = 0; n < count; n++) {
+        if (getLE(data, pos, 4) != 0x02014b50) throw ArchiveError{"corrupt central directory"};
+        uint16_t flags = getLE(data, pos + 8, 2);
+        uint16_t method = getLE(data, pos + 10, 2);
+        uint32_t crc = getLE(data, pos + 16, 4);
+        uint32_t csize = getLE(data, pos + 20, 4);
+        uint32_t usize = getLE(data, pos + 24, 4);
+        uint16_t nameLen = getLE(data, pos + 28, 2);
+        uint16_t extraLen = getLE(data, pos + 30, 2);
+        uint16_t commentLen = getLE(data, pos + 32, 2);
+        uint32_t local = getLE(data, pos + 42, 4);
+        if (pos + 46 + nameLen > data.size()) throw ArchiveError{"corrupt central directory"};
+        Entry e;
+        e.name = data.substr(pos + 46, nameLen);
+        pos += 46 + nameLen + extraLen + commentLen;
+
+        if (flags & 1) throw ArchiveError{"encrypted entry '" + e.name + "' is not supported"};
+        if (getLE(data, local, 4) != 0x04034b50) throw ArchiveError{"corrupt local header for '" + e.name + "'"};
+        size_t start = local + 30 + getLE(data, local + 26, 2) + getLE(data, local + 28, 2);
+        if (start + csize > data.size()) throw ArchiveError{"truncated entry '" + e.name + "'"};
+
+        e.isDir = !e.name.empty() && e.name.back() == '/';
+        if (method == 0) e.data = data.substr(start, csize);
+        else if (method == 8) e.data = inflateRaw(data.substr(start, csize));
+        else throw ArchiveError{"unsupported compression method " + std::to_string(method) + " for '" + e.name + "'"};
+        if (e.data.size() != usize || crc32(e.data) != crc) throw ArchiveError{"checksum mismatch for '" + e.name + "'"};
+        entries.push_back(std::move(e));
+    }
+    return entries;
+}
+
+// Runs fn, turning archive and filesystem failures into DariX errors.
+template <typename Fn>
+static ObjectPtr guarded(const std::string& name, Fn fn) {
+    try {
+        return fn();
+    } catch (const ArchiveError& e) {
+        return makeError(name + ": " + e.message);
+    } catch (const OutputTooLarge& e) {
+        return e.error;
+    } catch (const fs::filesystem_error& e) {
+        return makeError(name + ": " + e.what());
+    }
+}
+
+// The policy's max_string_len for decompressed strings, or 0 for none.
+static size_t stringLimit() { return static_cast<size_t>(std::max<int64_t>(sizeLimits().maxStringLen, 0)); }
+
+static int levelArg(const std::vector<ObjectPtr>& args, size_t idx) {
+    if (args.size() <= idx) return 6;
+    return static_cast<int>(std::clamp<int64_t>(getInt(args[idx]), 0, 9));
+}
+
+void initArchiveModule() {
+    std::unordered_map<std::string, NativeFunc> funcs;
+
+    // gzip(data, level?) -> gzip-compressed byte string (level 0-9, default 6)
+    funcs["gzip"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.empty() || args.size() > 2) return makeError("gzip: expected 1-2 arguments");
+        return newString(gzipCompress(getString(args[0]), levelArg(args, 1)));
+    };
+
+    // gunzip(data) -> decompressed string
+    funcs["gunzip"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("gunzip: expected 1 argument");
+        return guarded("gunzip", [&]() -> ObjectPtr {
+            return newString(gzipDecompress(getString(args[0]), stringLimit()));
+        });
+    };
+
+    // deflate(data, level?) -> raw DEFLATE stream (no header)
+    funcs["deflate"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.empty() || args.size() > 2) return makeError("deflate: expected 1-2 arguments");
+        return newString(deflateRaw(getString(args[0]), levelArg(args, 1)));
+    };
+
+    // inflate(data) -> decompressed raw DEFLATE stream
+    funcs["inflate"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("inflate: expected 1 argument");
+        return guarded("inflate", [&]() -> ObjectPtr {
+            return newString(inflateRaw(getString(args[0]), 0, nullptr, stringLimit()));
+        });
+    };
+
+    // tar_create(archive, dir) -> number of entries; ".gz"/".tgz" archives are compressed
+    funcs["tar_create"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 2) return makeError("tar_create: expected 2 arguments");
+        return guarded("tar_create", [&]() -> ObjectPtr {
+            std::string path = getString(args[0]);
+            auto entries = collect(getString(args[1]));
+            std::string tar = tarCreate(entries);
+            writeFile(path, isGzipPath(path) ? gzipCompress(tar, 6) : tar);
+            return newInteger(static_cast<int64_t>(entries.size()));
+        });
+    };
+
+    // tar_extract(archive, dest) -> number of entries
+    funcs["tar_extract"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 2) return makeError("tar_extract: expected 2 arguments");
+        return guarded("tar_extract", [&]() -> ObjectPtr {
+            std::string path = getString(args[0]);
+            std::string data = readFile(path);
+            auto entries = tarRead(isGzipPath(path) ? gzipDecompress(data) : data);
+            extractEntries(entries, getString(args[1]));
+            return newInteger(static_cast<int64_t>(entries.size()));
+        });
+    };
+
+    // tar_list(archive) -> [{name, size, dir}]
+    funcs["tar_list"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("tar_list: expected 1 argument");
+        return guarded("tar_list", [&]() -> ObjectPtr {
+            std::string path = getString(args[0]);
+            std::string data = readFile(path);
+            return listing(tarRead(isGzipPath(path) ? gzipDecompress(data) : data));
+        });
+    };
+
+    // zip_create(archive, dir, level?) -> number of entries
+    funcs["zip_create"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() < 2 || args.size() > 3) return makeError("zip_create: expected 2-3 arguments");
+        return guarded("zip_create", [&]() -> ObjectPtr {
+            auto entries = collect(getString(args[1]));
+            writeFile(getString(args[0]), zipCreate(entries, levelArg(args, 2)));
+            return newInteger(static_cast<int64_t>(entries.size()));
+        });
+    };
+
+    // zip_extract(archive, dest) -> number of entries
+    funcs["zip_extract"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 2) return makeError("zip_extract: expected 2 arguments");
+        return guarded("zip_extract", [&]() -> ObjectPtr {
+            auto entries = zipRead(readFile(getString(args[0])));
+            extractEntries(entries, getString(args[1]));
+            return newInteger(static_cast<int64_t>(entries.size()));
+        });
+    };
+
+    // zip_list(archive) -> [{name, size, dir}]
+    funcs["zip_list"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("zip_list: expected 1 argument");
+        return guarded("zip_list", [&]() -> ObjectPtr { return listing(zipRead(readFile(getString(args[0])))); });
+    };
+
+    Registry::instance().registerModule("archive", funcs, "Compression and Archives", {
+        {"gzip", {"(data, level?)", "Gzip-compress a byte string (level 0-9, default 6)"}},
+        {"gunzip", {"(data)", "Decompress gzip data"}},
+        {"deflate", {"(data, level?)", "Raw DEFLATE stream without header"}},
+        {"inflate", {"(data)", "Decompress a raw DEFLATE stream"}},
+        {"tar_create", {"(archive, dir)", "Write dir to a tar archive; returns entry count"}},
+        {"tar_extract", {"(archive, dest)", "Extract a tar archive into dest"}},
+        {"tar_list", {"(archive)", "Array of {name, size, dir} entries"}},
+        {"zip_create", {"(archive, dir, level?)", "Write dir to a zip archive"}},
+        {"zip_extract", {"(archive, dest)", "Extract a zip archive into dest"}},
+        {"zip_list", {"(archive)", "Array of {name, size, dir} entries"}},
+    });
+}
+
+} // namespace darix::native
@@ -386,7 +386,36 @@ void initArrayModule() {
         return newArray(result);
     };
 
-    Registry::instance().registerModule("array", funcs);
+    Registry::instance().registerModule("array", funcs, "Array Operations", {
+        {"filter", {"(arr, fn)", "Filter elements"}},
+        {"map", {"(arr, fn)", "Transform elements"}},
+        {"reduce", {"(arr, fn, init)", "Reduce to single value"}},
+        {"find", {"(arr, fn)", "Find first match"}},
+        {"find_all", {"(arr, fn)", "Find all matches"}},
+        {"unique", {"(arr)", "Remove duplicates"}},
+        {"flatten", {"(arr)", "Flatten one level"}},
+        {"chunk", {"(arr, size)", "Split into chunks"}},
+        {"zip", {"(a, b)", "Pair elements"}},
+        {"unzip", {"(arr)", "Unpair elements"}},
+        {"group_by", {"(arr, fn)", "Group by key"}},
+        {"sort_by", {"(arr, fn)", "Sort by key"}},
+        {"partition", {"(arr, fn)", "Split by predicate"}},
+        {"diff", {"(a, b)", "Elements in a not in b"}},
+        {"intersect", {"(a, b)", "Elements in both"}},
+        {"union", {"(a, b)", "All unique elements"}},
+        {"each", {"(arr, fn)", "Iterate with side effects"}},
+        {"all", {"(arr, fn)", "All match predicate"}},
+        {"any", {"(arr, fn)", "Any match predicate"}},
+        {"contains_value", {"(arr, val)", "Check if value exists"}},
+        {"index_of", {"(arr, val)", "Find index of value"}},
+        {"first", {"(arr)", "First element"}},
+        {"last", {"(arr)", "Last element"}},
+        {"take", {"(arr, n)", "First n elements"}},
+        {"drop", {"(arr, n)", "Skip first n elements"}},
+        {"min_by", {"(arr, fn)", "Element with minimum key"}},
+        {"max_by", {"(arr, fn)", "Element with maximum key"}},
+        {"enumerate", {"(arr)", "Array of [index, value] pairs"}},
+    });
 }
 
 } // namespace darix::native
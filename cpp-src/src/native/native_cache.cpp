@@ -0,0 +1,329 @@
+#include "darix/native/native.hpp"
+#include <algorithm>
+#include <chrono>
+#include <cstdio>
+#include <list>
+#include <memory>
+#include <mutex>
+
+namespace darix::native {
+
+using Clock = std::chrono::steady_clock;
+
+static ObjectPtr makeError(const std::string& msg) { return newError("%s", msg.c_str()); }
+
+static int64_t getInt(ObjectPtr obj) {
+    if (auto i = std::dynamic_pointer_cast<Integer>(obj)) return i->value;
+    if (auto f = std::dynamic_pointer_cast<Float>(obj)) return static_cast<int64_t>(f->value);
+    return 0;
+}
+
+static bool isFailure(ObjectPtr obj) {
+    return obj && (obj->type() == ObjectType::ERROR || obj->type() == ObjectType::EXCEPTION_SIGNAL);
+}
+
+// Canonical cache key for a value. Values without structural equality
+// (functions, instances, ...) are keyed by identity.
+static void appendKey(std::string& out, const ObjectPtr& obj) {
+    if (!obj) { out += "n;"; return; }
+    switch (obj->type()) {
+        case ObjectType::NULL_OBJ: out += "n;"; return;
+        case ObjectType::INTEGER: out += "i" + obj->inspect() + ";"; return;
+        case ObjectType::BOOLEAN: out += "b" + obj->inspect() + ";"; return;
+        case ObjectType::FLOAT: {
+            char buf[32];
+            std::snprintf(buf, sizeof(buf), "%.17g", std::dynamic_pointer_cast<Float>(obj)->value);
+            out += "f"; out += buf; out += ";";
+            return;
+        }
+        case ObjectType::STRING: {
+            auto& v = std::dynamic_pointer_cast<String>(obj)->value;
+            out += "s" + std::to_string(v.size()) + ":" + v;
+            return;
+        }
+        case ObjectType::ARRAY: {
+            auto arr = std::dynamic_pointer_cast<Array>(obj);
+            out += "a" + std::to_string(arr->elements.size()) + "(";
+            for (auto& e : arr->elements) appendKey(out, e);
+            out += ")";
+            return;
+        }
+        case ObjectType::MAP: {
+            auto m = std::dynamic_pointer_cast<Map>(obj);
+            out += "m" + std::to_string(m->pairs.size()) + "(";
+            for (auto& [k, v] : m->pairs) { appendKey(out, k); appendKey(out, v); }
+            out += ")";
+            return;
+        }
+        default: {
+            char buf[32];
+            std::snprintf(buf, sizeof(buf), "p%p;", static_cast<const void*>(obj.get()));
+            out += buf;
+            return;
+        }
+    }
+}
+
+static std::string keyOf(const ObjectPtr& obj) {
+    std::string out;
+    appendKey(out, obj);
+    return out;
+}
+
+// Least-recently-used cache with optional per-entry expiry. Workers can share
+// a cache, so every use holds its mutex.
+struct LruCache {
+    struct Entry {
+        std::string key;
+        ObjectPtr keyObj;
+        ObjectPtr value;
+        Clock::time_point expires;
+        bool hasExpiry = false;
+    };
+
+    std::mutex mutex;
+    size_t maxSize = 0;     // 0 = unbounded
+    int64_t defaultTtlMs = 0; // 0 = never expires
+    std::list<Entry> entries; // most recently used first
+    std::unordered_map<std::string, std::list<Entry>::iterator> index;
+    int64_t hits = 0, misses = 0, evictions = 0;
+
+    bool expired(const Entry& e) const { return e.hasExpiry && Clock::now() >= e.expires; }
+
+    ObjectPtr get(const std::string& key) {
+        auto it = index.find(key);
+        if (it == index.end()) { misses++; return nullptr; }
+        if (expired(*it->second)) { entries.erase(it->second); index.erase(it); misses++; return nullptr; }
+        entries.splice(entries.begin(), entries, it->second);
+        hits++;
+        return it->second->value;
+    }
+
+    void set(const std::string& key, ObjectPtr keyObj, ObjectPtr value, int64_t ttlMs) {
+        if (auto it = index.find(key); it != index.end()) {
+            entries.erase(it->second);
+            index.erase(it);
+        }
+        Entry e{key, keyObj, value, {}, ttlMs > 0};
+        if (ttlMs > 0) e.expires = Clock::now() + std::chrono::milliseconds(ttlMs);
+        entries.push_front(std::move(e));
+        index[key] = entries.begin();
+        while (maxSize > 0 && entries.size() > maxSize) {
+            index.erase(entries.back().key);
+            entries.pop_back();
+            evictions++;
+        }
+    }
+
+    bool remove(const std::string& key) {
+        auto it = index.find(key);
+        if (it == index.end()) return false;
+        entries.erase(it->second);
+        index.erase(it);
+        return true;
+    }
+
+    void purgeExpired() {
+        for (auto it = entries.begin(); it != entries.end();) {
+            if (expired(*it)) { index.erase(it->key); it = entries.erase(it); }
+            else ++it;
+        }
+    }
+};
+
+struct CacheRegistry {
+    std::mutex mutex;
+    std::unordered_map<int64_t, std::shared_ptr<LruCache>> caches;
+    int64_t nextId = 1;
+};
+
+static CacheRegistry& registry() {
+    static CacheRegistry registry;
+    return registry;
+}
+
+static int64_t addCache(std::shared_ptr<LruCache> cache) {
+    auto& reg = registry();
+    std::lock_guard<std::mutex> lock(reg.mutex);
+    int64_t id = reg.nextId++;
+    reg.caches[id] = std::move(cache);
+    return id;
+}
+
+static void removeCache(int64_t id) {
+    auto& reg = registry();
+    std::lock_guard<std::mutex> lock(reg.mutex);
+    reg.caches.erase(id);
+}
+
+static std::shared_ptr<LruCache> getCache(ObjectPtr handle) {
+    int64_t id = 0;
+    if (!handleId(handle, "cache", &id)) return nullptr;
+    auto& reg = registry();
+    std::lock_guard<std::mutex> lock(reg.mutex);
+    auto it = reg.caches.find(id);
+    return it == reg.caches.end() ? nullptr : it->second;
+}
+
+void initCacheModule() {
+    std::unordered_map<std::string, NativeFunc> funcs;
+
+    // new(max_size?, ttl_ms?) -> cache handle (0 means unbounded / no expiry)
+    // Closing the handle (free, close() or a with block) releases the cache.
+    funcs["new"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() > 2) return makeError("new: expected 0-2 arguments");
+        auto cache = std::make_shared<LruCache>();
+        if (args.size() >= 1) {
+            int64_t size = getInt(args[0]);
+            if (size < 0) return makeError("new: max_size must be non-negative");
+            cache->maxSize = static_cast<size_t>(size);
+        }
+        if (args.size() == 2) {
+            cache->defaultTtlMs = getInt(args[1]);
+            if (cache->defaultTtlMs < 0) return makeError("new: ttl_ms must be non-negative");
+        }
+        int64_t id = addCache(cache);
+        return openHandle("cache", id, [id] { removeCache(id); });
+    };
+
+    // get(cache, key, default?) -> value or default/null
+    funcs["get"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() < 2 || args.size() > 3) return makeError("get: expected 2-3 arguments");
+        auto cache = getCache(args[0]);
+        if (!cache) return makeError("get: invalid cache handle");
+        std::lock_guard<std::mutex> lock(cache->mutex);
+        if (auto v = cache->get(keyOf(args[1]))) return v;
+        return args.size() == 3 ? args[2] : getNull();
+    };
+
+    // set(cache, key, value, ttl_ms?) -> null
+    funcs["set"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() < 3 || args.size() > 4) return makeError("set: expected 3-4 arguments");
+        auto cache = getCache(args[0]);
+        if (!cache) return makeError("set: invalid cache handle");
+        std::lock_guard<std::mutex> lock(cache->mutex);
+        int64_t ttl = args.size() == 4 ? getInt(args[3]) : cache->defaultTtlMs;
+        cache->set(keyOf(args[1]), args[1], args[2], ttl);
+        return getNull();
+    };
+
+    // has(cache, key) -> bool (does not affect recency)
+    funcs["has"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 2) return makeError("has: expected 2 arguments");
+        auto cache = getCache(args[0]);
+        if (!cache) return makeError("has: invalid cache handle");
+        std::lock_guard<std::mutex> lock(cache->mutex);
+        auto it = cache->index.find(keyOf(args[1]));
+        return newBoolean(it != cache->index.end() && !cache->expired(*it->second));
+    };
+
+    // delete(cache, key) -> true if the key was present
+    funcs["delete"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 2) return makeError("delete: expected 2 arguments");
+        auto cache = getCache(args[0]);
+        if (!cache) return makeError("delete: invalid cache handle");
+        std::lock_guard<std::mutex> lock(cache->mutex);
+        return newBoolean(cache->remove(keyOf(args[1])));
+    };
+
+    // size(cache) -> number of live entries
+    funcs["size"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("size: expected 1 argument");
+        auto cache = getCache(args[0]);
+        if (!cache) return makeError("size: invalid cache handle");
+        std::lock_guard<std::mutex> lock(cache->mutex);
+        cache->purgeExpired();
+        return newInteger(static_cast<int64_t>(cache->entries.size()));
+    };
+
+    // keys(cache) -> keys from most to least recently used
+    funcs["keys"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("keys: expected 1 argument");
+        auto cache = getCache(args[0]);
+        if (!cache) return makeError("keys: invalid cache handle");
+        std::lock_guard<std::mutex> lock(cache->mutex);
+        cache->purgeExpired();
+        std::vector<ObjectPtr> keys;
+        for (auto& e : cache->entries) keys.push_back(e.keyObj);
+        return newArray(keys);
+    };
+
+    // clear(cache) -> null
+    funcs["clear"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("clear: expected 1 argument");
+        auto cache = getCache(args[0]);
+        if (!cache) return makeError("clear: invalid cache handle");
+        std::lock_guard<std::mutex> lock(cache->mutex);
+        cache->entries.clear();
+        cache->index.clear();
+        return getNull();
+    };
+
+    // stats(cache) -> {"hits", "misses", "evictions", "size", "max_size"}
+    funcs["stats"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("stats: expected 1 argument");
+        auto cache = getCache(args[0]);
+        if (!cache) return makeError("stats: invalid cache handle");
+        std::lock_guard<std::mutex> lock(cache->mutex);
+        cache->purgeExpired();
+        return newMap({
+            {newString("hits"), newInteger(cache->hits)},
+            {newString("misses"), newInteger(cache->misses)},
+            {newString("evictions"), newInteger(cache->evictions)},
+            {newString("size"), newInteger(static_cast<int64_t>(cache->entries.size()))},
+            {newString("max_size"), newInteger(static_cast<int64_t>(cache->maxSize))},
+        });
+    };
+
+    // free(cache) -> true if the handle was valid
+    funcs["free"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("free: expected 1 argument");
+        return newBoolean(closeHandle(args[0], "cache"));
+    };
+
+    // memoize(fn, max_size?, ttl_ms?) -> function caching fn's results by arguments.
+    // Usable as a decorator: @cache.memoize
+    funcs["memoize"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.empty() || args.size() > 3) return makeError("memoize: expected 1-3 arguments");
+        auto t = args[0]->type();
+        if (t != ObjectType::FUNCTION && t != ObjectType::BUILTIN && t != ObjectType::BOUND_METHOD)
+            return makeError("memoize: first argument must be a function");
+        auto cache = std::make_shared<LruCache>();
+        if (args.size() >= 2) cache->maxSize = static_cast<size_t>(std::max<int64_t>(0, getInt(args[1])));
+        if (args.size() == 3) cache->defaultTtlMs = std::max<int64_t>(0, getInt(args[2]));
+
+        ObjectPtr fn = args[0];
+        auto wrapper = std::make_shared<Builtin>();
+        wrapper->fn = [fn, cache](const std::vector<ObjectPtr>& callArgs) -> ObjectPtr {
+            std::string key;
+            for (auto& a : callArgs) appendKey(key, a);
+            {
+                std::lock_guard<std::mutex> lock(cache->mutex);
+                if (auto v = cache->get(key)) return v;
+            }
+            // The lock is not held while fn runs, which may use the cache again.
+            auto result = callCallable(fn, callArgs);
+            if (isFailure(result)) return result;
+            std::lock_guard<std::mutex> lock(cache->mutex);
+            cache->set(key, newArray(callArgs), result, cache->defaultTtlMs);
+            return result;
+        };
+        return wrapper;
+    };
+
+    Registry::instance().registerModule("cache", funcs, "LRU Cache and Memoization", {
+        {"new", {"(max_size?, ttl_ms?)", "Create a cache (0 = unbounded / no expiry)"}},
+        {"get", {"(c, key, default?)", "Look up a key, marking it recently used"}},
+        {"set", {"(c, key, value, ttl_ms?)", "Store a value, evicting the least recently used entry if full"}},
+        {"has", {"(c, key)", "Check for a live key"}},
+        {"delete", {"(c, key)", "Remove a key"}},
+        {"size", {"(c)", "Number of live entries"}},
+        {"keys", {"(c)", "Keys, most recently used first"}},
+        {"clear", {"(c)", "Remove all entries"}},
+        {"stats", {"(c)", "Map of hits, misses, evictions, size, max_size"}},
+        {"free", {"(c)", "Release the cache (same as c.close())"}},
+        {"memoize", {"(fn, max_size?, ttl_ms?)", "Wrap fn so results are cached by arguments; works as @cache.memoize"}},
+    });
+}
+
+} // namespace darix::native
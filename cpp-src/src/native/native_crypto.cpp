@@ -377,8 +377,7 @@ void initCryptoModule() {
         auto n = std::dynamic_pointer_cast<Integer>(args[0]);
         if (!n || n->value <= 0) return makeError("random_bytes: count must be positive");
         std::vector<uint8_t> bytes(n->value);
-        std::random_device rd;
-        std::mt19937 gen(rd());
+        std::mt19937 gen(static_cast<std::mt19937::result_type>(randomSeed()));
         std::uniform_int_distribution<> dis(0, 255);
         for (auto& b : bytes) b = static_cast<uint8_t>(dis(gen));
         return newString(std::string(reinterpret_cast<char*>(bytes.data()), bytes.size()));
@@ -390,8 +389,7 @@ void initCryptoModule() {
         if (!n || n->value <= 0) return makeError("random_hex: length must be positive");
         std::string result;
         result.reserve(n->value * 2);
-        std::random_device rd;
-        std::mt19937 gen(rd());
+        std::mt19937 gen(static_cast<std::mt19937::result_type>(randomSeed()));
         std::uniform_int_distribution<> dis(0, 15);
         for (int64_t i = 0; i < n->value; i++) {
             result += "0123456789abcdef"[dis(gen)];
@@ -400,8 +398,7 @@ void initCryptoModule() {
     };
 
     funcs["uuid"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        std::random_device rd;
-        std::mt19937_64 gen(rd());
+        std::mt19937_64 gen(randomSeed());
         std::uniform_int_distribution<uint64_t> dis(0, 0xFFFFFFFFFFFFFFFF);
         uint64_t a = dis(gen), b = dis(gen);
         b = (b & 0xFFFFFFFFFFFF0FFFULL) | 0x0000000000004000ULL;
@@ -482,7 +479,25 @@ void initCryptoModule() {
         return newInteger(static_cast<int64_t>(fnv1a(getString(args[0]))));
     };
 
-    Registry::instance().registerModule("crypto", funcs);
+    Registry::instance().registerModule("crypto", funcs, "Cryptographic Operations", {
+        {"md5", {"(data)", "MD5 hash"}},
+        {"sha1", {"(data)", "40-hex-digit digest (FNV-based, not real SHA-1)"}},
+        {"sha256", {"(data)", "SHA-256 hash"}},
+        {"sha512", {"(data)", "SHA-512 hash"}},
+        {"hmac_sha256", {"(key, data)", "HMAC-SHA256"}},
+        {"base64_encode", {"(data)", "Base64 encode"}},
+        {"base64_decode", {"(data)", "Base64 decode"}},
+        {"hex_encode", {"(data)", "Hex encode"}},
+        {"hex_decode", {"(data)", "Hex decode"}},
+        {"random_bytes", {"(n)", "Random bytes"}},
+        {"random_hex", {"(n)", "Random hex string"}},
+        {"uuid", {"()", "UUID v4"}},
+        {"crc32", {"(data)", "CRC32 checksum"}},
+        {"pbkdf2", {"(pass, salt, iters)", "Key derivation"}},
+        {"hash", {"(data)", "FNV-1a hash"}},
+        {"url_encode", {"(s)", "Percent-encode for URLs"}},
+        {"url_decode", {"(s)", "Decode percent-encoding"}},
+    });
 }
 
 } // namespace darix::native
@@ -0,0 +1,291 @@
+#include "darix/native/native.hpp"
+#include <fstream>
+#include <sstream>
+
+namespace darix::native {
+
+static ObjectPtr makeError(const std::string& msg) { return newError("%s", msg.c_str()); }
+
+static std::string getString(ObjectPtr obj) {
+    if (auto s = std::dynamic_pointer_cast<String>(obj)) return s->value;
+    return "";
+}
+
+static bool isFailure(ObjectPtr obj) {
+    return obj && (obj->type() == ObjectType::ERROR || obj->type() == ObjectType::EXCEPTION_SIGNAL);
+}
+
+struct CsvOptions {
+    char delimiter = ',';
+    char quote = '"';
+    bool header = false;
+    std::vector<std::string> columns; // explicit column order for writing maps
+};
+
+static ObjectPtr lookup(const std::shared_ptr<Map>& m, const std::string& key) {
+    for (auto& [k, v] : m->pairs) {
+        if (auto s = std::dynamic_pointer_cast<String>(k); s && s->value == key) return v;
+    }
+    return nullptr;
+}
+
+// Reads {"delimiter", "quote", "header", "columns"} from an options map.
+// Returns an error object on invalid options, nullptr otherwise.
+static ObjectPtr readOptions(const std::string& name, const std::vector<ObjectPtr>& args, size_t idx, CsvOptions& opts) {
+    if (args.size() <= idx) return nullptr;
+    auto m = std::dynamic_pointer_cast<Map>(args[idx]);
+    if (!m) return makeError(name + ": options must be a map");
+    if (auto d = lookup(m, "delimiter")) {
+        std::string s = getString(d);
+        if (s.size() != 1) return makeError(name + ": delimiter must be a single character");
+        opts.delimiter = s[0];
+    }
+    if (auto q = lookup(m, "quote")) {
+        std::string s = getString(q);
+        if (s.size() != 1) return makeError(name + ": quote must be a single character");
+        opts.quote = s[0];
+    }
+    if (auto h = lookup(m, "header")) opts.header = isTruthy(h);
+    if (auto c = lookup(m, "columns")) {
+        auto arr = std::dynamic_pointer_cast<Array>(c);
+        if (!arr) return makeError(name + ": columns must be an array");
+        for (auto& e : arr->elements) opts.columns.push_back(e->inspect());
+    }
+    if (opts.delimiter == opts.quote) return makeError(name + ": delimiter and quote must differ");
+    return nullptr;
+}
+
+// Pulls one record at a time from a stream, so files are never loaded whole.
+// Quoted fields may contain delimiters, doubled quotes and line breaks.
+class CsvReader {
+public:
+    CsvReader(std::istream& in, const CsvOptions& opts) : in_(in), opts_(opts) {}
+
+    // Returns false at end of input; sets error_ on malformed input.
+    bool next(std::vector<std::string>& fields) {
+        fields.clear();
+        int c = in_.peek();
+        if (c == EOF) return false;
+        line_++;
+
+        std::string field;
+        bool inQuotes = false, quoted = false;
+        for (;;) {
+            c = in_.get();
+            if (c == EOF) {
+                if (inQuotes) { error_ = "unterminated quoted field starting on line " + std::to_string(line_); return false; }
+                fields.push_back(field);
+                return true;
+            }
+            char ch = static_cast<char>(c);
+            if (inQuotes) {
+                if (ch == opts_.quote) {
+                    if (in_.peek() == opts_.quote) { in_.get(); field += ch; }
+                    else inQuotes = false;
+                } else {
+                    if (ch == '\n') line_++;
+                    field += ch;
+                }
+            } else if (ch == opts_.quote && field.empty() && !quoted) {
+                inQuotes = quoted = true;
+            } else if (ch == opts_.delimiter) {
+                fields.push_back(field);
+                field.clear();
+                quoted = false;
+            } else if (ch == '\r' && in_.peek() == '\n') {
+                continue;
+            } else if (ch == '\n') {
+                fields.push_back(field);
+                return true;
+            } else {
+                field += ch;
+            }
+        }
+    }
+
+    const std::string& error() const { return error_; }
+
+private:
+    std::istream& in_;
+    const CsvOptions& opts_;
+    std::string error_;
+    int64_t line_ = 0;
+};
+
+static ObjectPtr toRow(const std::vector<std::string>& fields) {
+    std::vector<ObjectPtr> elems;
+    elems.reserve(fields.size());
+    for (auto& f : fields) elems.push_back(newString(f));
+    return newArray(elems);
+}
+
+static ObjectPtr toRecord(const std::vector<std::string>& header, const std::vector<std::string>& fields) {
+    std::vector<std::pair<ObjectPtr, ObjectPtr>> pairs;
+    for (size_t i = 0; i < header.size(); i++) {
+        pairs.push_back({newString(header[i]), i < fields.size() ? newString(fields[i]) : getNull()});
+    }
+    return newMap(pairs);
+}
+
+// Feeds every record to emit() as an array, or as a map in header mode.
+// Stops early if emit returns an object (error or stop signal).
+template <typename Emit>
+static ObjectPtr readAll(const std::string& name, std::istream& in, const CsvOptions& opts, Emit emit) {
+    CsvReader reader(in, opts);
+    std::vector<std::string> header, fields;
+    bool haveHeader = false;
+    while (reader.next(fields)) {
+        if (opts.header && !haveHeader) { header = fields; haveHeader = true; continue; }
+        if (auto err = opts.header ? mapSizeError(header.size()) : arraySizeError(fields.size())) return err;
+        if (auto stop = emit(opts.header ? toRecord(header, fields) : toRow(fields))) return stop;
+    }
+    if (!reader.error().empty()) return makeError(name + ": " + reader.error());
+    return nullptr;
+}
+
+static ObjectPtr parseStream(const std::string& name, std::istream& in, const CsvOptions& opts) {
+    std::vector<ObjectPtr> rows;
+    auto err = readAll(name, in, opts, [&](ObjectPtr row) -> ObjectPtr {
+        rows.push_back(row);
+        return arraySizeError(rows.size());
+    });
+    if (err) return err;
+    return newArray(rows);
+}
+
+static void writeField(std::ostream& out, const std::string& field, const CsvOptions& opts) {
+    bool needsQuotes = field.find_first_of(std::string{opts.delimiter, opts.quote, '\n', '\r'}) != std::string::npos;
+    if (!needsQuotes) { out << field; return; }
+    out << opts.quote;
+    for (char c : field) {
+        if (c == opts.quote) out << opts.quote;
+        out << c;
+    }
+    out << opts.quote;
+}
+
+static void writeRecord(std::ostream& out, const std::vector<std::string>& fields, const CsvOptions& opts) {
+    for (size_t i = 0; i < fields.size(); i++) {
+        if (i > 0) out << opts.delimiter;
+        writeField(out, fields[i], opts);
+    }
+    out << '\n';
+}
+
+// Writes an array of arrays, or an array of maps preceded by a header line.
+// Map columns come from options.columns or the first row's keys.
+static ObjectPtr writeRows(const std::string& name, std::ostream& out, ObjectPtr rowsObj, const CsvOptions& opts) {
+    auto rows = std::dynamic_pointer_cast<Array>(rowsObj);
+    if (!rows) return makeError(name + ": rows must be an array");
+
+    std::vector<std::string> columns = opts.columns;
+    bool wroteHeader = false;
+    std::vector<std::string> fields;
+    for (auto& row : rows->elements) {
+        fields.clear();
+        if (auto arr = std::dynamic_pointer_cast<Array>(row)) {
+            for (auto& e : arr->elements) fields.push_back(e->type() == ObjectType::NULL_OBJ ? "" : e->inspect());
+        } else if (auto m = std::dynamic_pointer_cast<Map>(row)) {
+            if (columns.empty()) {
+                for (auto& [k, v] : m->pairs) columns.push_back(k->inspect());
+            }
+            if (!wroteHeader) { writeRecord(out, columns, opts); wroteHeader = true; }
+            for (auto& col : columns) {
+                auto v = lookup(m, col);
+                fields.push_back(!v || v->type() == ObjectType::NULL_OBJ ? "" : v->inspect());
+            }
+        } else {
+            return makeError(name + ": each row must be an array or a map");
+        }
+        writeRecord(out, fields, opts);
+    }
+    return nullptr;
+}
+
+void initCsvModule() {
+    std::unordered_map<std::string, NativeFunc> funcs;
+
+    // parse(text, options?) -> array of rows (arrays, or maps with header: true)
+    funcs["parse"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.empty() || args.size() > 2) return makeError("parse: expected 1-2 arguments");
+        if (args[0]->type() != ObjectType::STRING) return makeError("parse: first argument must be a string");
+        CsvOptions opts;
+        if (auto err = readOptions("parse", args, 1, opts)) return err;
+        std::istringstream in(getString(args[0]));
+        return parseStream("parse", in, opts);
+    };
+
+    // read(path, options?) -> array of rows, like parse() on the file contents
+    funcs["read"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.empty() || args.size() > 2) return makeError("read: expected 1-2 arguments");
+        CsvOptions opts;
+        if (auto err = readOptions("read", args, 1, opts)) return err;
+        std::string path = getString(args[0]);
+        std::ifstream in(path, std::ios::binary);
+        if (!in.is_open()) return makeError("read: cannot open file '" + path + "'");
+        return parseStream("read", in, opts);
+    };
+
+    // each(path, fn, options?) -> number of rows visited.
+    // Streams the file one record at a time; returning false from fn stops early.
+    funcs["each"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() < 2 || args.size() > 3) return makeError("each: expected 2-3 arguments");
+        auto t = args[1]->type();
+        if (t != ObjectType::FUNCTION && t != ObjectType::BUILTIN && t != ObjectType::BOUND_METHOD)
+            return makeError("each: second argument must be a function");
+        CsvOptions opts;
+        if (auto err = readOptions("each", args, 2, opts)) return err;
+        std::string path = getString(args[0]);
+        std::ifstream in(path, std::ios::binary);
+        if (!in.is_open()) return makeError("each: cannot open file '" + path + "'");
+
+        int64_t count = 0;
+        bool stopped = false;
+        auto err = readAll("each", in, opts, [&](ObjectPtr row) -> ObjectPtr {
+            count++;
+            auto result = callCallable(args[1], {row});
+            if (isFailure(result)) return result;
+            if (result && result->type() == ObjectType::BOOLEAN && !isTruthy(result)) {
+                stopped = true;
+                return getNull();
+            }
+            return nullptr;
+        });
+        if (err && !stopped) return err;
+        return newInteger(count);
+    };
+
+    // stringify(rows, options?) -> CSV text
+    funcs["stringify"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.empty() || args.size() > 2) return makeError("stringify: expected 1-2 arguments");
+        CsvOptions opts;
+        if (auto err = readOptions("stringify", args, 1, opts)) return err;
+        std::ostringstream out;
+        if (auto err = writeRows("stringify", out, args[0], opts)) return err;
+        return newString(out.str());
+    };
+
+    // write(path, rows, options?) -> number of rows written
+    funcs["write"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() < 2 || args.size() > 3) return makeError("write: expected 2-3 arguments");
+        CsvOptions opts;
+        if (auto err = readOptions("write", args, 2, opts)) return err;
+        std::string path = getString(args[0]);
+        std::ofstream out(path, std::ios::binary);
+        if (!out.is_open()) return makeError("write: cannot open file '" + path + "'");
+        if (auto err = writeRows("write", out, args[1], opts)) return err;
+        if (!out.good()) return makeError("write: failed writing '" + path + "'");
+        auto rows = std::dynamic_pointer_cast<Array>(args[1]);
+        return newInteger(static_cast<int64_t>(rows->elements.size()));
+    };
+
+    Registry::instance().registerModule("csv", funcs, "CSV Reading and Writing", {
+        {"parse", {"(text, options?)", "Parse CSV text into an array of rows"}},
+        {"read", {"(path, options?)", "Parse a CSV file into an array of rows"}},
+        {"each", {"(path, fn, options?)", "Stream a file, calling fn(row) per record; false stops early. Returns rows visited"}},
+        {"stringify", {"(rows, options?)", "Format an array of arrays or maps as CSV text"}},
+        {"write", {"(path, rows, options?)", "Write rows to a file; returns number of rows written"}},
+    });
+}
+
+} // namespace darix::native
@@ -1,7 +1,11 @@
 #include "darix/native/native.hpp"
+#include <cctype>
 #include <chrono>
+#include <cstdlib>
 #include <ctime>
+#include <fstream>
 #include <iomanip>
+#include <mutex>
 #include <sstream>
 #include <thread>
 
@@ -42,19 +46,122 @@ static std::string formatTime(const std::tm& tm, const std::string& fmt) {
     return buf;
 }
 
+static int64_t nowSeconds() {
+    return std::chrono::duration_cast<std::chrono::seconds>(currentTime().time_since_epoch()).count();
+}
+
+// Parses a fixed UTC offset such as "+03:30", "-0800" or "+05".
+static bool parseOffset(const std::string& zone, int& seconds) {
+    if (zone.size() < 3 || (zone[0] != '+' && zone[0] != '-')) return false;
+    std::string digits;
+    for (size_t i = 1; i < zone.size(); i++) {
+        if (zone[i] == ':' && i == 3) continue;
+        if (!std::isdigit(static_cast<unsigned char>(zone[i]))) return false;
+        digits += zone[i];
+    }
+    if (digits.size() != 2 && digits.size() != 4) return false;
+    int hours = std::stoi(digits.substr(0, 2));
+    int minutes = digits.size() == 4 ? std::stoi(digits.substr(2)) : 0;
+    if (hours > 14 || minutes > 59) return false;
+    seconds = (zone[0] == '-' ? -1 : 1) * (hours * 3600 + minutes * 60);
+    return true;
+}
+
+// strftime would describe a gmtime() result as UTC, so %z and %Z are filled
+// in here for UTC and fixed-offset zones.
+static std::string substituteZone(const std::string& fmt, int offset, const std::string& name) {
+    char z[16];
+    int a = offset < 0 ? -offset : offset;
+    std::snprintf(z, sizeof(z), "%c%02d%02d", offset < 0 ? '-' : '+', a / 3600, (a % 3600) / 60);
+    std::string out;
+    for (size_t i = 0; i < fmt.size(); i++) {
+        if (fmt[i] == '%' && i + 1 < fmt.size()) {
+            char c = fmt[i + 1];
+            if (c == 'z') { out += z; i++; continue; }
+            if (c == 'Z') { out += name; i++; continue; }
+            out += fmt[i];
+            out += fmt[++i];
+            continue;
+        }
+        out += fmt[i];
+    }
+    return out;
+}
+
+#ifndef _WIN32
+static bool zoneExists(const std::string& zone) {
+    if (zone.empty() || zone[0] == '/' || zone.find("..") != std::string::npos) return false;
+    const char* dir = std::getenv("TZDIR");
+    std::ifstream f(std::string(dir ? dir : "/usr/share/zoneinfo") + "/" + zone);
+    return f.good();
+}
+
+static std::mutex tzMutex;
+#endif
+
+// Formats timestamp in zone: "" for local time, "UTC", a fixed offset like
+// "+03:30", or an IANA name such as "Europe/Paris". Formatting always uses
+// the C locale, so output does not depend on the host's language settings.
+static bool formatInZone(int64_t timestamp, const std::string& fmt, const std::string& zone,
+                         std::string& out, std::string& error) {
+    if (zone.empty()) {
+        out = formatTime(getTM(timestamp), fmt);
+        return true;
+    }
+    int offset = 0;
+    std::string name = zone;
+    if (zone == "UTC" || zone == "Z" || zone == "GMT" || parseOffset(zone, offset)) {
+        if (zone == "Z") name = "UTC";
+        time_t t = static_cast<time_t>(timestamp + offset);
+        std::tm tm;
+#ifdef _WIN32
+        gmtime_s(&tm, &t);
+#else
+        gmtime_r(&t, &tm);
+#endif
+        out = formatTime(tm, substituteZone(fmt, offset, name));
+        return true;
+    }
+#ifdef _WIN32
+    error = "unknown time zone '" + zone + "' (use UTC or an offset like +03:30)";
+    return false;
+#else
+    if (!zoneExists(zone)) {
+        error = "unknown time zone '" + zone + "'";
+        return false;
+    }
+    // localtime_r and strftime read the zone from TZ; swap it under a lock.
+    std::lock_guard<std::mutex> lock(tzMutex);
+    const char* prev = std::getenv("TZ");
+    std::string saved = prev ? prev : "";
+    setenv("TZ", zone.c_str(), 1);
+    tzset();
+    out = formatTime(getTM(timestamp), fmt);
+    if (prev) setenv("TZ", saved.c_str(), 1);
+    else unsetenv("TZ");
+    tzset();
+    return true;
+#endif
+}
+
 void initDatetimeModule() {
     std::unordered_map<std::string, NativeFunc> funcs;
 
     // now() -> current timestamp (seconds since epoch)
+    // now(format, zone?) -> current time formatted with strftime codes
     funcs["now"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        auto now = std::chrono::system_clock::now();
-        auto epoch = std::chrono::duration_cast<std::chrono::seconds>(now.time_since_epoch());
-        return newInteger(epoch.count());
+        if (args.empty()) return newInteger(nowSeconds());
+        if (args.size() > 2) return makeError("now: expected 0-2 arguments");
+        std::string out, error;
+        if (!formatInZone(nowSeconds(), getString(args[0]), args.size() == 2 ? getString(args[1]) : "", out, error)) {
+            return makeError("now: " + error);
+        }
+        return newString(out);
     };
 
     // now_ms() -> current timestamp in milliseconds
     funcs["now_ms"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        auto now = std::chrono::system_clock::now();
+        auto now = currentTime();
         auto epoch = std::chrono::duration_cast<std::chrono::milliseconds>(now.time_since_epoch());
         return newInteger(epoch.count());
     };
@@ -83,12 +190,14 @@ void initDatetimeModule() {
         return makeError("from_string: cannot parse date format (expected 'YYYY-MM-DD HH:MM:SS' or 'YYYY-MM-DD')");
     };
 
-    // format(timestamp, format_string) -> formatted string
+    // format(timestamp, format_string, zone?) -> formatted string
     funcs["format"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 2) return makeError("format: expected 2 arguments");
-        auto tm = getTM(getInt(args[0]));
-        std::string fmt = getString(args[1]);
-        return newString(formatTime(tm, fmt));
+        if (args.size() != 2 && args.size() != 3) return makeError("format: expected 2-3 arguments");
+        std::string out, error;
+        if (!formatInZone(getInt(args[0]), getString(args[1]), args.size() == 3 ? getString(args[2]) : "", out, error)) {
+            return makeError("format: " + error);
+        }
+        return newString(out);
     };
 
     // year(timestamp) -> int
@@ -292,7 +401,7 @@ void initDatetimeModule() {
 
     // timezone_offset() -> seconds offset from UTC
     funcs["timezone_offset"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        auto now = std::chrono::system_clock::now();
+        auto now = currentTime();
         auto local = std::chrono::system_clock::to_time_t(now);
         std::tm localTm, utcTm;
 #ifdef _WIN32
@@ -305,14 +414,50 @@ void initDatetimeModule() {
         return newInteger(static_cast<int64_t>(mktime(&localTm) - mktime(&utcTm)));
     };
 
-    // clock() -> high-res time in milliseconds
+    // clock() -> high-res time in milliseconds; the fixed clock in reproducible runs
     funcs["clock"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        auto now = std::chrono::high_resolution_clock::now();
-        auto ms = std::chrono::duration_cast<std::chrono::milliseconds>(now.time_since_epoch());
+        auto since = deterministic() ? currentTime().time_since_epoch()
+                                     : std::chrono::high_resolution_clock::now().time_since_epoch();
+        auto ms = std::chrono::duration_cast<std::chrono::milliseconds>(since);
         return newInteger(ms.count());
     };
 
-    Registry::instance().registerModule("datetime", funcs);
+    Registry::instance().registerModule("datetime", funcs, "Date and Time", {
+        {"now", {"(fmt?, zone?)", "Current timestamp, or the current time formatted"}},
+        {"timestamp", {"(fmt?, zone?)", "Alias of now"}},
+        {"now_ms", {"()", "Current timestamp (ms)"}},
+        {"format", {"(ts, fmt, zone?)", "Format timestamp"}},
+        {"year", {"(ts)", "Year"}},
+        {"month", {"(ts)", "Month (1-12)"}},
+        {"day", {"(ts)", "Day (1-31)"}},
+        {"hour", {"(ts)", "Hour (0-23)"}},
+        {"minute", {"(ts)", "Minute (0-59)"}},
+        {"second", {"(ts)", "Second (0-59)"}},
+        {"weekday", {"(ts)", "Day of week (0-6)"}},
+        {"day_of_year", {"(ts)", "Day of year (0-365)"}},
+        {"is_leap_year", {"(year)", "Check leap year"}},
+        {"days_in_month", {"(year, month)", "Days in month"}},
+        {"add_days", {"(ts, n)", "Add n days"}},
+        {"add_hours", {"(ts, n)", "Add n hours"}},
+        {"add_minutes", {"(ts, n)", "Add n minutes"}},
+        {"add_seconds", {"(ts, n)", "Add n seconds"}},
+        {"diff", {"(a, b)", "Difference in seconds"}},
+        {"diff_days", {"(a, b)", "Difference in days"}},
+        {"to_string", {"(ts)", "\"YYYY-MM-DD HH:MM:SS\""}},
+        {"to_date_string", {"(ts)", "\"YYYY-MM-DD\""}},
+        {"to_time_string", {"(ts)", "\"HH:MM:SS\""}},
+        {"to_iso", {"(ts)", "ISO 8601"}},
+        {"make", {"(y, m, d, h?, min?, s?)", "Create timestamp"}},
+        {"parse", {"(fmt, str)", "Parse string"}},
+        {"is_before", {"(a, b)", "a < b"}},
+        {"is_after", {"(a, b)", "a > b"}},
+        {"is_same_day", {"(a, b)", "Same calendar day"}},
+        {"timezone_offset", {"()", "UTC offset in seconds"}},
+        {"clock", {"()", "High-res time (ms)"}},
+        {"from_string", {"(s)", "Parse a date string to a timestamp"}},
+        {"sleep", {"(seconds)", "Sleep (fractional seconds allowed)"}},
+        {"sleep_ms", {"(ms)", "Sleep in milliseconds"}},
+    });
 }
 
 } // namespace darix::native
@@ -382,7 +382,27 @@ void initEncodingModule() {
         return newString(result);
     };
 
-    Registry::instance().registerModule("encoding", funcs);
+    Registry::instance().registerModule("encoding", funcs, "Encoding/Decoding", {
+        {"base64_encode", {"(data)", "Base64 encode"}},
+        {"base64_decode", {"(data)", "Base64 decode"}},
+        {"base32_encode", {"(data)", "Base32 encode"}},
+        {"base32_decode", {"(data)", "Base32 decode"}},
+        {"hex_encode", {"(data)", "Hex encode (lowercase)"}},
+        {"hex_encode_upper", {"(data)", "Hex encode (uppercase)"}},
+        {"hex_decode", {"(data)", "Hex decode"}},
+        {"url_encode", {"(data)", "URL encode"}},
+        {"url_decode", {"(data)", "URL decode"}},
+        {"html_encode", {"(data)", "HTML entity encode"}},
+        {"html_decode", {"(data)", "HTML entity decode"}},
+        {"binary_encode", {"(data)", "Binary string encode"}},
+        {"binary_decode", {"(data)", "Binary string decode"}},
+        {"octal_encode", {"(data)", "Octal encode"}},
+        {"octal_decode", {"(data)", "Octal decode"}},
+        {"caesar_encode", {"(data, shift)", "Caesar cipher encrypt"}},
+        {"caesar_decode", {"(data, shift)", "Caesar cipher decrypt"}},
+        {"rot13", {"(data)", "ROT13 transform"}},
+        {"xor_encode", {"(data, key)", "XOR cipher (symmetric)"}},
+    });
 }
 
 } // namespace darix::native
@@ -1,5 +1,8 @@
 #include "darix/native/native.hpp"
+#include <algorithm>
+#include <chrono>
 #include <fstream>
+#include <map>
 #include <sstream>
 #include <filesystem>
 #include <cstdlib>
@@ -15,6 +18,195 @@ static std::string getString(ObjectPtr obj) {
     return "";
 }
 
+// Whether name matches one glob component: * and ? match within a name,
+// [abc], [a-z] and [!abc] match one character of a set.
+static bool globMatch(const std::string& pat, const std::string& name) {
+    size_t p = 0, n = 0, starP = std::string::npos, starN = 0;
+    while (n < name.size()) {
+        if (p < pat.size() && pat[p] == '*') {
+            starP = p++;
+            starN = n;
+            continue;
+        }
+        if (p < pat.size() && pat[p] == '[') {
+            size_t q = p + 1;
+            bool negate = q < pat.size() && (pat[q] == '!' || pat[q] == '^');
+            if (negate) q++;
+            bool found = false;
+            size_t first = q;
+            while (q < pat.size() && (pat[q] != ']' || q == first)) {
+                if (q + 2 < pat.size() && pat[q + 1] == '-' && pat[q + 2] != ']') {
+                    found = found || (pat[q] <= name[n] && name[n] <= pat[q + 2]);
+                    q += 3;
+                } else {
+                    found = found || pat[q] == name[n];
+                    q++;
+                }
+            }
+            if (q < pat.size() && found != negate) {
+                p = q + 1;
+                n++;
+                continue;
+            }
+        } else if (p < pat.size() && (pat[p] == '?' || pat[p] == name[n])) {
+            p++;
+            n++;
+            continue;
+        }
+        if (starP == std::string::npos) return false;
+        p = starP + 1;
+        n = ++starN;
+    }
+    while (p < pat.size() && pat[p] == '*') p++;
+    return p == pat.size();
+}
+
+// The entries of dir, in the file system's order or, for reproducible runs,
+// by name.
+static std::vector<fs::directory_entry> listDir(const std::string& dir, std::error_code& ec) {
+    std::vector<fs::directory_entry> entries;
+    for (auto& entry : fs::directory_iterator(dir, ec)) entries.push_back(entry);
+    if (deterministic()) std::sort(entries.begin(), entries.end());
+    return entries;
+}
+
+// Adds the paths under dir matching parts[i..] to out. ** stands for any
+// number of directories; wildcards only match names starting with a dot
+// when the pattern component does.
+static void globExpand(const std::vector<std::string>& parts, size_t i, const fs::path& dir,
+                       std::vector<std::string>& out) {
+    std::error_code ec;
+    if (i == parts.size()) {
+        if (fs::exists(dir, ec)) out.push_back(dir.string());
+        return;
+    }
+    const std::string& part = parts[i];
+    fs::path from = dir.empty() ? fs::path(".") : dir;
+    if (part == "**") {
+        globExpand(parts, i + 1, dir, out);
+        for (auto& entry : fs::directory_iterator(from, ec)) {
+            std::string name = entry.path().filename().string();
+            if (name[0] == '.' || entry.is_symlink(ec) || !entry.is_directory(ec)) continue;
+            globExpand(parts, i, dir / name, out);
+        }
+        return;
+    }
+    if (part.find_first_of("*?[") == std::string::npos) {
+        globExpand(parts, i + 1, dir / part, out);
+        return;
+    }
+    for (auto& entry : fs::directory_iterator(from, ec)) {
+        std::string name = entry.path().filename().string();
+        if (name[0] == '.' && part[0] != '.') continue;
+        if (!globMatch(part, name)) continue;
+        if (i + 1 < parts.size() && !entry.is_directory(ec)) continue;
+        globExpand(parts, i + 1, dir / name, out);
+    }
+}
+
+// The modification time and size of each path under a watched one.
+// Directories are kept with neither, so only their creation and deletion
+// are reported.
+using WatchSnapshot = std::map<std::string, std::pair<fs::file_time_type, uintmax_t>>;
+
+static WatchSnapshot watchSnapshot(const fs::path& root) {
+    WatchSnapshot snap;
+    std::error_code ec;
+    auto add = [&snap](const fs::path& p) {
+        std::error_code e;
+        if (fs::is_directory(p, e)) {
+            snap[p.string()] = {fs::file_time_type::min(), 0};
+            return;
+        }
+        auto mtime = fs::last_write_time(p, e);
+        if (e) return;
+        auto size = fs::file_size(p, e);
+        snap[p.string()] = {mtime, e ? 0 : size};
+    };
+    if (!fs::is_directory(root, ec)) {
+        if (fs::exists(root, ec)) add(root);
+        return snap;
+    }
+    fs::recursive_directory_iterator it(root, fs::directory_options::skip_permission_denied, ec), end;
+    for (; !ec && it != end; it.increment(ec)) add(it->path());
+    return snap;
+}
+
+// One {type, path} map per changed path, in path order.
+static std::vector<ObjectPtr> watchEvents(const WatchSnapshot& before, const WatchSnapshot& after) {
+    std::vector<ObjectPtr> events;
+    auto event = [&events](const char* type, const std::string& path) {
+        auto ev = std::make_shared<Map>();
+        ev->pairs.push_back({newString("type"), newString(type)});
+        ev->pairs.push_back({newString("path"), newString(path)});
+        events.push_back(ev);
+    };
+    auto b = before.begin(), a = after.begin();
+    while (b != before.end() || a != after.end()) {
+        if (a == after.end() || (b != before.end() && b->first < a->first)) {
+            event("delete", (b++)->first);
+        } else if (b == before.end() || a->first < b->first) {
+            event("create", (a++)->first);
+        } else {
+            if (a->second != b->second) event("modify", a->first);
+            ++a;
+            ++b;
+        }
+    }
+    return events;
+}
+
+// A watched path. Each poll compares the path with the last snapshot seen;
+// once it has stayed unchanged for debounceMs, the differences from what was
+// last reported are delivered, so a burst of writes gives one event per path.
+struct Watch {
+    fs::path root;
+    ObjectPtr fn;
+    int64_t debounceMs = 0;
+    WatchSnapshot reported, seen;
+    std::chrono::steady_clock::time_point changed;
+};
+
+static ObjectPtr pollWatch(Watch& w) {
+    auto now = std::chrono::steady_clock::now();
+    auto snap = watchSnapshot(w.root);
+    if (snap != w.seen) {
+        w.seen = std::move(snap);
+        w.changed = now;
+        return getNull();
+    }
+    if (w.seen == w.reported || now - w.changed < std::chrono::milliseconds(w.debounceMs)) return getNull();
+    auto events = watchEvents(w.reported, w.seen);
+    w.reported = w.seen;
+    for (auto& ev : events) {
+        auto result = callCallable(w.fn, {ev});
+        if (result && (result->type() == ObjectType::ERROR || result->type() == ObjectType::EXCEPTION_SIGNAL))
+            return result;
+    }
+    return getNull();
+}
+
+// Streams opened with open(), by handle id, until their handle is closed.
+static std::map<int64_t, std::shared_ptr<std::fstream>>& openFiles() {
+    static std::map<int64_t, std::shared_ptr<std::fstream>> files;
+    return files;
+}
+
+static std::fstream* fileStream(const ObjectPtr& handle) {
+    int64_t id;
+    if (!handleId(handle, "file", &id)) return nullptr;
+    auto it = openFiles().find(id);
+    return it == openFiles().end() ? nullptr : it->second.get();
+}
+
+// The next line of a stream without its line ending, or nullptr at the end.
+static ObjectPtr readLine(std::fstream& file) {
+    std::string line;
+    if (!std::getline(file, line)) return nullptr;
+    if (!line.empty() && line.back() == '\r') line.pop_back();
+    return newString(line);
+}
+
 void initFsModule() {
     std::unordered_map<std::string, NativeFunc> funcs;
 
@@ -29,9 +221,15 @@ void initFsModule() {
         return newString(buffer.str());
     };
 
-    // write(path, content) -> bool
+    // write(path, content) -> bool; write(file, content) writes to an open file
     funcs["write"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() != 2) return makeError("write: expected 2 arguments");
+        if (args[0]->type() == ObjectType::HANDLE) {
+            auto file = fileStream(args[0]);
+            if (!file) return makeError("write: expected an open file");
+            *file << getString(args[1]);
+            return newBoolean(file->good());
+        }
         std::string path = getString(args[0]);
         std::string content = getString(args[1]);
         std::ofstream file(path);
@@ -124,7 +322,7 @@ void initFsModule() {
         std::string path = getString(args[0]);
         std::error_code ec;
         std::vector<ObjectPtr> result;
-        for (auto& entry : fs::directory_iterator(path, ec)) {
+        for (auto& entry : listDir(path, ec)) {
             result.push_back(newString(entry.path().filename().string()));
         }
         if (ec) return makeError("list_dir: cannot read directory");
@@ -137,7 +335,7 @@ void initFsModule() {
         std::string path = getString(args[0]);
         std::error_code ec;
         std::vector<ObjectPtr> result;
-        for (auto& entry : fs::directory_iterator(path, ec)) {
+        for (auto& entry : listDir(path, ec)) {
             auto info = std::make_shared<Map>();
             info->pairs.push_back({newString("name"), newString(entry.path().filename().string())});
             info->pairs.push_back({newString("is_dir"), newBoolean(entry.is_directory())});
@@ -203,6 +401,101 @@ void initFsModule() {
         return newString(fs::absolute(getString(args[0]), ec).string());
     };
 
+    // open(path, mode?) -> file handle; mode is "r" (default), "w" or "a"
+    funcs["open"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.empty() || args.size() > 2) return makeError("open: expected 1-2 arguments");
+        std::string path = getString(args[0]);
+        std::string mode = args.size() == 2 ? getString(args[1]) : "r";
+        std::ios::openmode flags = std::ios::binary;
+        if (mode == "r") flags |= std::ios::in;
+        else if (mode == "w") flags |= std::ios::out | std::ios::trunc;
+        else if (mode == "a") flags |= std::ios::out | std::ios::app;
+        else return makeError("open: mode must be \"r\", \"w\" or \"a\"");
+        auto file = std::make_shared<std::fstream>(path, flags);
+        if (!file->is_open()) return makeError("open: cannot open file '" + path + "'");
+        static int64_t nextId = 1;
+        int64_t id = nextId++;
+        openFiles()[id] = file;
+        auto handle = openHandle("file", id, [id] { openFiles().erase(id); });
+        if (mode == "r") {
+            handle->next = [id]() -> ObjectPtr {
+                auto it = openFiles().find(id);
+                return it == openFiles().end() ? nullptr : readLine(*it->second);
+            };
+        }
+        return handle;
+    };
+
+    // read_line(file) -> next line without its line ending, or null at the end
+    funcs["read_line"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("read_line: expected 1 argument");
+        auto file = fileStream(args[0]);
+        if (!file) return makeError("read_line: expected an open file");
+        auto line = readLine(*file);
+        return line ? line : getNull();
+    };
+
+    // flush(file) -> bool
+    funcs["flush"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("flush: expected 1 argument");
+        auto file = fileStream(args[0]);
+        if (!file) return makeError("flush: expected an open file");
+        file->flush();
+        return newBoolean(file->good());
+    };
+
+    // close(file) -> false if it was already closed
+    funcs["close"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("close: expected 1 argument");
+        return newBoolean(closeHandle(args[0], "file"));
+    };
+
+    // normalize(path) -> path with "." and "name/.." removed
+    funcs["normalize"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("normalize: expected 1 argument");
+        return newString(fs::path(getString(args[0])).lexically_normal().string());
+    };
+
+    // glob(pattern) -> sorted array of matching paths
+    funcs["glob"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("glob: expected 1 argument");
+        fs::path pattern = getString(args[0]);
+        std::vector<std::string> parts;
+        for (auto& component : pattern.relative_path()) {
+            if (!component.empty()) parts.push_back(component.string());
+        }
+        std::vector<std::string> found;
+        if (!parts.empty()) globExpand(parts, 0, pattern.root_path(), found);
+        std::sort(found.begin(), found.end());
+        found.erase(std::unique(found.begin(), found.end()), found.end());
+        std::vector<ObjectPtr> result;
+        for (auto& path : found) result.push_back(newString(path));
+        return newArray(result);
+    };
+
+    // watch(path, fn, debounce_ms?) -> watch handle; fn gets {type, path}
+    funcs["watch"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() < 2 || args.size() > 3) return makeError("watch: expected 2-3 arguments");
+        auto t = args[1]->type();
+        if (t != ObjectType::FUNCTION && t != ObjectType::BUILTIN && t != ObjectType::BOUND_METHOD)
+            return makeError("watch: second argument must be a function");
+        auto w = std::make_shared<Watch>();
+        w->root = getString(args[0]);
+        w->fn = args[1];
+        w->debounceMs = 100;
+        if (args.size() == 3) {
+            auto ms = std::dynamic_pointer_cast<Integer>(args[2]);
+            if (!ms || ms->value < 0) return makeError("watch: debounce_ms must be a non-negative integer");
+            w->debounceMs = ms->value;
+        }
+        w->reported = w->seen = watchSnapshot(w->root);
+        auto poll = std::make_shared<Builtin>();
+        poll->fn = [w](const std::vector<ObjectPtr>&) -> ObjectPtr { return pollWatch(*w); };
+        int64_t interval = std::clamp<int64_t>(w->debounceMs / 2, 10, 250);
+        int64_t id = scheduleInterval(poll, interval);
+        return openHandle("watch", id, [id] { cancelTimer(id); });
+    };
+
     // temp_dir() -> temp directory path
     funcs["temp_dir"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         return newString(fs::temp_directory_path().string());
@@ -215,7 +508,39 @@ void initFsModule() {
         return val ? newString(val) : getNull();
     };
 
-    Registry::instance().registerModule("fs", funcs);
+    Registry::instance().registerModule("fs", funcs, "File System", {
+        {"read", {"(path)", "Read file to string"}},
+        {"write", {"(path, content)", "Write string to file, or to a file opened with open()"}},
+        {"append", {"(path, content)", "Append to file"}},
+        {"exists", {"(path)", "Check if exists"}},
+        {"is_file", {"(path)", "Check if regular file"}},
+        {"is_dir", {"(path)", "Check if directory"}},
+        {"mkdir", {"(path)", "Create directories"}},
+        {"rmdir", {"(path)", "Remove directory tree"}},
+        {"remove", {"(path)", "Remove file"}},
+        {"rename", {"(old, new)", "Rename/move"}},
+        {"copy", {"(src, dst)", "Copy file"}},
+        {"size", {"(path)", "File size in bytes"}},
+        {"list_dir", {"(path)", "Array of filenames"}},
+        {"list_dir_full", {"(path)", "Array of {name, is_dir, size}"}},
+        {"cwd", {"()", "Current working directory"}},
+        {"chdir", {"(path)", "Change working directory"}},
+        {"join", {"(a, b, ...)", "Join path components"}},
+        {"parent", {"(path)", "Parent directory"}},
+        {"filename", {"(path)", "Filename from path"}},
+        {"extension", {"(path)", "File extension"}},
+        {"stem", {"(path)", "Filename without extension"}},
+        {"absolute", {"(path)", "Absolute path"}},
+        {"open", {"(path, mode?)", "Open a file for streaming (\"r\", \"w\" or \"a\"); returns a handle"}},
+        {"read_line", {"(file)", "Next line of an open file, or null at the end"}},
+        {"flush", {"(file)", "Flush writes to an open file"}},
+        {"close", {"(file)", "Close an open file"}},
+        {"normalize", {"(path)", "Remove . and .. components"}},
+        {"glob", {"(pattern)", "Sorted paths matching *, ?, [abc] and **"}},
+        {"watch", {"(path, fn, debounce_ms?)", "Call fn({type, path}) on create/modify/delete; returns a handle"}},
+        {"temp_dir", {"()", "System temp directory"}},
+        {"env", {"(name)", "Get environment variable"}},
+    });
 }
 
 } // namespace darix::native
@@ -86,6 +86,7 @@ void initGraphModule() {
         if (args.size() != 2) return makeError("add_vertex: expected 2 arguments");
         auto adj = getAdj(args[0]);
         if (!adj) return makeError("add_vertex: first argument must be graph");
+        if (auto err = frozenError(adj)) return err;
         for (auto& [k, v] : adj->pairs)
             if (equals(k, args[1])) return args[0]; // already exists
         adj->pairs.push_back({args[1], newArray({})});
@@ -97,6 +98,7 @@ void initGraphModule() {
         if (args.size() != 3) return makeError("add_edge: expected 3 arguments");
         auto adj = getAdj(args[0]);
         if (!adj) return makeError("add_edge: first argument must be graph");
+        if (auto err = frozenError(adj)) return err;
         addEdgeToAdj(adj, args[1], args[2]);
         return args[0];
     };
@@ -106,6 +108,7 @@ void initGraphModule() {
         if (args.size() != 3) return makeError("add_undirected_edge: expected 3 arguments");
         auto adj = getAdj(args[0]);
         if (!adj) return makeError("add_undirected_edge: first argument must be graph");
+        if (auto err = frozenError(adj)) return err;
         addEdgeToAdj(adj, args[1], args[2]);
         addEdgeToAdj(adj, args[2], args[1]);
         return args[0];
@@ -187,6 +190,7 @@ void initGraphModule() {
         if (args.size() != 2) return makeError("remove_vertex: expected 2 arguments");
         auto adj = getAdj(args[0]);
         if (!adj) return makeError("remove_vertex: first argument must be graph");
+        if (auto err = frozenError(adj)) return err;
         // Remove the vertex entry
         for (auto it = adj->pairs.begin(); it != adj->pairs.end(); ++it) {
             if (equals(it->first, args[1])) { adj->pairs.erase(it); break; }
@@ -209,6 +213,7 @@ void initGraphModule() {
         if (args.size() != 3) return makeError("remove_edge: expected 3 arguments");
         auto adj = getAdj(args[0]);
         if (!adj) return makeError("remove_edge: first argument must be graph");
+        if (auto err = frozenError(adj)) return err;
         for (auto& [k, v] : adj->pairs) {
             if (equals(k, args[1])) {
                 auto arr = std::dynamic_pointer_cast<Array>(v);
@@ -546,7 +551,37 @@ void initGraphModule() {
         return newBoolean(true);
     };
 
-    Registry::instance().registerModule("graph", funcs);
+    Registry::instance().registerModule("graph", funcs, "Graph Operations", {
+        {"new", {"()", "Create empty graph"}},
+        {"from_edges", {"(edges)", "Create from [[from,to], ...]"}},
+        {"add_vertex", {"(g, v)", "Add vertex"}},
+        {"add_edge", {"(g, from, to)", "Add directed edge"}},
+        {"add_undirected_edge", {"(g, a, b)", "Add bidirectional edge"}},
+        {"vertices", {"(g)", "Array of all vertices"}},
+        {"edges", {"(g)", "Array of [from, to] pairs"}},
+        {"to_edges_list", {"(g)", "Alias of edges"}},
+        {"neighbors", {"(g, v)", "Adjacent vertices"}},
+        {"degree", {"(g, v)", "Out-degree"}},
+        {"in_degree", {"(g, v)", "In-degree"}},
+        {"has_vertex", {"(g, v)", "Check vertex exists"}},
+        {"has_edge", {"(g, from, to)", "Check edge exists"}},
+        {"remove_vertex", {"(g, v)", "Remove vertex and edges"}},
+        {"remove_edge", {"(g, from, to)", "Remove edge"}},
+        {"vertex_count", {"(g)", "Number of vertices"}},
+        {"edge_count", {"(g)", "Number of edges"}},
+        {"is_empty", {"(g)", "Check if empty"}},
+        {"bfs", {"(g, start)", "Breadth-first traversal"}},
+        {"dfs", {"(g, start)", "Depth-first traversal"}},
+        {"shortest_path", {"(g, from, to)", "BFS shortest path"}},
+        {"has_path", {"(g, from, to)", "Check reachability"}},
+        {"is_connected", {"(g)", "Check if all reachable"}},
+        {"topological_sort", {"(g)", "Topological order (DAG)"}},
+        {"transpose", {"(g)", "Reverse all edges"}},
+        {"subgraph", {"(g, verts)", "Induced subgraph"}},
+        {"clone", {"(g)", "Deep copy"}},
+        {"equals", {"(a, b)", "Structural equality"}},
+        {"to_string", {"(g)", "String representation"}},
+    });
 }
 
 } // namespace darix::native
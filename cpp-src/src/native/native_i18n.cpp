@@ -0,0 +1,386 @@
+#include "darix/native/native.hpp"
+#include <cstdlib>
+#include <mutex>
+#include <sstream>
+
+namespace darix::native {
+
+static ObjectPtr makeError(const std::string& msg) { return newError("%s", msg.c_str()); }
+
+static std::string getString(ObjectPtr obj) {
+    if (auto s = std::dynamic_pointer_cast<String>(obj)) return s->value;
+    return "";
+}
+
+// A message is one text, or one text per plural category.
+struct Message {
+    std::string text;
+    std::map<std::string, std::string> plurals;
+};
+
+// "fa_IR.UTF-8" and "fa-IR" both become "fa-IR"; "C" and "POSIX" mean none.
+static std::string canonicalLocale(std::string name) {
+    name = name.substr(0, name.find_first_of(".@"));
+    for (auto& c : name)
+        if (c == '_') c = '-';
+    return name == "C" || name == "POSIX" ? "" : name;
+}
+
+struct Catalogs {
+    std::mutex mutex;
+    std::map<std::string, std::map<std::string, Message>> locales;
+    std::string locale;
+    std::string fallback = "en";
+
+    // The locale starts out as the environment's, as far as the capability
+    // policy lets scripts see it.
+    Catalogs() {
+        for (const char* var : {"LC_ALL", "LC_MESSAGES", "LANG"}) {
+            if (!CapabilityPolicy::instance().allowsEnv(var)) continue;
+            const char* value = std::getenv(var);
+            if (value && *value) {
+                locale = canonicalLocale(value);
+                break;
+            }
+        }
+        if (locale.empty()) locale = "en";
+    }
+};
+
+static Catalogs& catalogs() {
+    static Catalogs state;
+    return state;
+}
+
+static std::string language(const std::string& locale) { return locale.substr(0, locale.find('-')); }
+
+// The CLDR plural categories of a language, in the order gettext numbers
+// msgstr[N] for it, and the category of an integer count.
+static std::vector<std::string> pluralCategories(const std::string& lang) {
+    if (lang == "ja" || lang == "zh" || lang == "ko" || lang == "th" || lang == "vi") return {"other"};
+    if (lang == "ru" || lang == "uk" || lang == "pl") return {"one", "few", "many"};
+    if (lang == "ar") return {"zero", "one", "two", "few", "many", "other"};
+    return {"one", "other"};
+}
+
+static std::string pluralCategory(const std::string& lang, int64_t n) {
+    if (n < 0) n = -n;
+    int64_t mod10 = n % 10, mod100 = n % 100;
+    if (lang == "ja" || lang == "zh" || lang == "ko" || lang == "th" || lang == "vi") return "other";
+    if (lang == "fa" || lang == "fr" || lang == "hi") return n <= 1 ? "one" : "other";
+    if (lang == "ru" || lang == "uk") {
+        if (mod10 == 1 && mod100 != 11) return "one";
+        if (mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14)) return "few";
+        return "many";
+    }
+    if (lang == "pl") {
+        if (n == 1) return "one";
+        if (mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14)) return "few";
+        return "many";
+    }
+    if (lang == "ar") {
+        if (n <= 2) return n == 0 ? "zero" : n == 1 ? "one" : "two";
+        if (mod100 >= 3 && mod100 <= 10) return "few";
+        if (mod100 >= 11) return "many";
+        return "other";
+    }
+    return n == 1 ? "one" : "other";
+}
+
+// Adds a {key: text or {category: text}} map to a catalog; returns how many
+// messages it held, or -1 with *error set.
+static int64_t addMessages(std::map<std::string, Message>& catalog, const std::shared_ptr<Map>& messages,
+                           std::string* error) {
+    int64_t count = 0;
+    for (auto& [key, value] : messages->pairs) {
+        auto name = std::dynamic_pointer_cast<String>(key);
+        if (!name) {
+            *error = "message keys must be strings";
+            return -1;
+        }
+        Message message;
+        if (auto text = std::dynamic_pointer_cast<String>(value)) {
+            message.text = text->value;
+        } else if (auto forms = std::dynamic_pointer_cast<Map>(value)) {
+            for (auto& [category, form] : forms->pairs) {
+                if (category->type() != ObjectType::STRING || form->type() != ObjectType::STRING) {
+                    *error = "plural forms of '" + name->value + "' must map categories to strings";
+                    return -1;
+                }
+                message.plurals[getString(category)] = getString(form);
+            }
+        } else {
+            *error = "message '" + name->value + "' must be a string or a map of plural forms";
+            return -1;
+        }
+        catalog[name->value] = std::move(message);
+        count++;
+    }
+    return count;
+}
+
+// Reads the quoted string at the start of s, with C escapes.
+static bool poString(const std::string& s, std::string* out) {
+    size_t start = s.find('"');
+    if (start == std::string::npos) return false;
+    out->clear();
+    for (size_t i = start + 1; i < s.size(); i++) {
+        char c = s[i];
+        if (c == '"') return true;
+        if (c == '\\' && i + 1 < s.size()) {
+            char e = s[++i];
+            *out += e == 'n' ? '\n' : e == 't' ? '\t' : e;
+        } else {
+            *out += c;
+        }
+    }
+    return false;
+}
+
+// PO-lite: msgid/msgstr pairs, msgid_plural with msgstr[N] numbered in the
+// language's category order, continuation lines and # comments.
+static ObjectPtr parsePo(const std::string& text, const std::string& lang, std::string* error) {
+    auto messages = std::make_shared<Map>();
+    auto categories = pluralCategories(lang);
+    std::string id, pluralId;
+    std::string* target = nullptr;
+    std::map<std::string, std::string> forms;
+    std::string single;
+    bool plural = false, hasEntry = false;
+    auto flush = [&] {
+        if (hasEntry && !id.empty()) {
+            if (plural) {
+                auto m = std::make_shared<Map>();
+                for (auto& [category, form] : forms) m->pairs.push_back({newString(category), newString(form)});
+                messages->pairs.push_back({newString(id), m});
+            } else {
+                messages->pairs.push_back({newString(id), newString(single)});
+            }
+        }
+        id.clear();
+        single.clear();
+        forms.clear();
+        plural = hasEntry = false;
+        target = nullptr;
+    };
+    std::istringstream in(text);
+    std::string line;
+    int lineNo = 0;
+    while (std::getline(in, line)) {
+        lineNo++;
+        if (!line.empty() && line.back() == '\r') line.pop_back();
+        size_t first = line.find_first_not_of(" \t");
+        if (first == std::string::npos || line[first] == '#') continue;
+        line = line.substr(first);
+        std::string value;
+        if (!poString(line, &value)) {
+            *error = "line " + std::to_string(lineNo) + ": expected a quoted string";
+            return nullptr;
+        }
+        if (line[0] == '"') {
+            if (!target) {
+                *error = "line " + std::to_string(lineNo) + ": continuation without msgid or msgstr";
+                return nullptr;
+            }
+            *target += value;
+        } else if (line.rfind("msgid_plural", 0) == 0) {
+            plural = true;
+            pluralId = value;
+            target = &pluralId;
+        } else if (line.rfind("msgid", 0) == 0) {
+            flush();
+            id = value;
+            target = &id;
+        } else if (line.rfind("msgstr[", 0) == 0) {
+            size_t n = static_cast<size_t>(std::atoi(line.c_str() + 7));
+            if (n >= categories.size()) {
+                *error = "line " + std::to_string(lineNo) + ": '" + lang + "' has only " +
+                         std::to_string(categories.size()) + " plural forms";
+                return nullptr;
+            }
+            hasEntry = true;
+            forms[categories[n]] = value;
+            target = &forms[categories[n]];
+        } else if (line.rfind("msgstr", 0) == 0) {
+            hasEntry = true;
+            single = value;
+            target = &single;
+        } else {
+            *error = "line " + std::to_string(lineNo) + ": unknown keyword";
+            return nullptr;
+        }
+    }
+    flush();
+    return messages;
+}
+
+// Replaces {name} with params[name]; unknown names are left as they are.
+static std::string interpolate(const std::string& text, const std::shared_ptr<Map>& params) {
+    if (!params) return text;
+    std::string out;
+    for (size_t i = 0; i < text.size(); i++) {
+        size_t close = text[i] == '{' ? text.find('}', i) : std::string::npos;
+        if (close == std::string::npos) {
+            out += text[i];
+            continue;
+        }
+        std::string name = text.substr(i + 1, close - i - 1);
+        ObjectPtr value;
+        for (auto& [k, v] : params->pairs)
+            if (getString(k) == name && k->type() == ObjectType::STRING) value = v;
+        if (!value) {
+            out += text[i];
+            continue;
+        }
+        out += value->type() == ObjectType::STRING ? getString(value) : value->inspect();
+        i = close;
+    }
+    return out;
+}
+
+void initI18nModule() {
+    std::unordered_map<std::string, NativeFunc> funcs;
+
+    // add(locale, messages) -> number of messages added
+    funcs["add"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 2) return makeError("add: expected 2 arguments");
+        auto messages = std::dynamic_pointer_cast<Map>(args[1]);
+        if (args[0]->type() != ObjectType::STRING || !messages)
+            return makeError("add: expected a locale string and a map of messages");
+        auto& state = catalogs();
+        std::lock_guard<std::mutex> lock(state.mutex);
+        std::string error;
+        int64_t count = addMessages(state.locales[canonicalLocale(getString(args[0]))], messages, &error);
+        if (count < 0) return makeError("add: " + error);
+        return newInteger(count);
+    };
+
+    // load(locale, path) -> number of messages read from a .json or .po file
+    funcs["load"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 2) return makeError("load: expected 2 arguments");
+        if (args[0]->type() != ObjectType::STRING || args[1]->type() != ObjectType::STRING)
+            return makeError("load: expected a locale and a path");
+        std::string locale = canonicalLocale(getString(args[0])), path = getString(args[1]);
+        std::ifstream file(path, std::ios::binary);
+        if (!file.is_open()) return makeError("load: cannot open file '" + path + "'");
+        std::stringstream buffer;
+        buffer << file.rdbuf();
+        ObjectPtr parsed;
+        std::string error;
+        if (path.size() > 3 && path.compare(path.size() - 3, 3, ".po") == 0) {
+            parsed = parsePo(buffer.str(), language(locale), &error);
+            if (!parsed) return makeError("load: " + path + ": " + error);
+        } else if (path.size() > 5 && path.compare(path.size() - 5, 5, ".json") == 0) {
+            parsed = Registry::instance().get("json")->functions.at("parse")({newString(buffer.str())});
+            if (parsed->type() == ObjectType::ERROR || parsed->type() == ObjectType::EXCEPTION_SIGNAL) return parsed;
+            if (parsed->type() != ObjectType::MAP) return makeError("load: " + path + ": top level must be an object");
+        } else {
+            return makeError("load: '" + path + "' is not a .json or .po file");
+        }
+        auto& state = catalogs();
+        std::lock_guard<std::mutex> lock(state.mutex);
+        int64_t count = addMessages(state.locales[locale], std::static_pointer_cast<Map>(parsed), &error);
+        if (count < 0) return makeError("load: " + path + ": " + error);
+        return newInteger(count);
+    };
+
+    // t(key, params?) -> the message for key in the current locale, with
+    // {name} placeholders filled from params; params["count"] picks the
+    // plural form. Falls back to the language, then the fallback locale,
+    // then key itself.
+    funcs["t"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.empty() || args.size() > 2) return makeError("t: expected 1-2 arguments");
+        if (args[0]->type() != ObjectType::STRING) return makeError("t: key must be a string");
+        std::shared_ptr<Map> params;
+        if (args.size() == 2 && args[1]->type() != ObjectType::NULL_OBJ) {
+            params = std::dynamic_pointer_cast<Map>(args[1]);
+            if (!params) return makeError("t: params must be a map");
+        }
+        std::string key = getString(args[0]);
+        auto& state = catalogs();
+        std::lock_guard<std::mutex> lock(state.mutex);
+        for (const std::string& locale : {state.locale, language(state.locale), state.fallback, language(state.fallback)}) {
+            auto catalog = state.locales.find(locale);
+            if (catalog == state.locales.end()) continue;
+            auto it = catalog->second.find(key);
+            if (it == catalog->second.end()) continue;
+            const Message& message = it->second;
+            if (message.plurals.empty()) return newString(interpolate(message.text, params));
+            int64_t count = 0;
+            if (params)
+                for (auto& [k, v] : params->pairs)
+                    if (getString(k) == "count" && v->type() == ObjectType::INTEGER)
+                        count = std::static_pointer_cast<Integer>(v)->value;
+            auto form = message.plurals.find(pluralCategory(language(locale), count));
+            if (form == message.plurals.end()) form = message.plurals.find("other");
+            if (form == message.plurals.end()) form = message.plurals.begin();
+            return newString(interpolate(form->second, params));
+        }
+        return newString(interpolate(key, params));
+    };
+
+    // plural(count, locale?) -> CLDR category: "zero", "one", "two", "few", "many" or "other"
+    funcs["plural"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.empty() || args.size() > 2) return makeError("plural: expected 1-2 arguments");
+        auto n = std::dynamic_pointer_cast<Integer>(args[0]);
+        if (!n) return makeError("plural: count must be an integer");
+        std::string locale = args.size() == 2 ? canonicalLocale(getString(args[1])) : "";
+        if (locale.empty()) {
+            auto& state = catalogs();
+            std::lock_guard<std::mutex> lock(state.mutex);
+            locale = state.locale;
+        }
+        return newString(pluralCategory(language(locale), n->value));
+    };
+
+    // set_locale(locale) -> previous locale
+    funcs["set_locale"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1 || args[0]->type() != ObjectType::STRING) return makeError("set_locale: expected a locale string");
+        auto& state = catalogs();
+        std::lock_guard<std::mutex> lock(state.mutex);
+        std::string previous = state.locale;
+        state.locale = canonicalLocale(getString(args[0]));
+        return newString(previous);
+    };
+
+    // locale() -> current locale, initially from LC_ALL, LC_MESSAGES or LANG
+    funcs["locale"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (!args.empty()) return makeError("locale: expected 0 arguments");
+        auto& state = catalogs();
+        std::lock_guard<std::mutex> lock(state.mutex);
+        return newString(state.locale);
+    };
+
+    // set_fallback(locale) -> previous fallback locale
+    funcs["set_fallback"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1 || args[0]->type() != ObjectType::STRING) return makeError("set_fallback: expected a locale string");
+        auto& state = catalogs();
+        std::lock_guard<std::mutex> lock(state.mutex);
+        std::string previous = state.fallback;
+        state.fallback = canonicalLocale(getString(args[0]));
+        return newString(previous);
+    };
+
+    // locales() -> locales with a loaded catalog, sorted
+    funcs["locales"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (!args.empty()) return makeError("locales: expected 0 arguments");
+        auto& state = catalogs();
+        std::lock_guard<std::mutex> lock(state.mutex);
+        std::vector<ObjectPtr> out;
+        for (auto& [name, catalog] : state.locales) out.push_back(newString(name));
+        return newArray(out);
+    };
+
+    Registry::instance().registerModule("i18n", funcs, "Message Catalogs and Translation", {
+        {"add", {"(locale, messages)", "Add a map of messages to a locale's catalog"}},
+        {"load", {"(locale, path)", "Load a .json or .po catalog file"}},
+        {"t", {"(key, params?)", "Translate key, filling {name} placeholders"}},
+        {"plural", {"(count, locale?)", "CLDR plural category of count"}},
+        {"set_locale", {"(locale)", "Set the current locale"}},
+        {"locale", {"()", "Current locale"}},
+        {"set_fallback", {"(locale)", "Set the fallback locale (default en)"}},
+        {"locales", {"()", "Locales with a catalog"}},
+    });
+}
+
+} // namespace darix::native
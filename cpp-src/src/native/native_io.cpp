@@ -12,6 +12,13 @@ static std::string getString(ObjectPtr obj) {
     return "";
 }
 
+// Shows a prompt before a read, through the console layer like print.
+static ObjectPtr prompt(const std::string& name, const std::string& text) {
+    if (auto err = writeOutput(name, text)) return err;
+    std::fflush(stdout);
+    return nullptr;
+}
+
 void initIoModule() {
     std::unordered_map<std::string, NativeFunc> funcs;
 
@@ -22,17 +29,18 @@ void initIoModule() {
             if (i > 0) out += " ";
             out += args[i]->inspect();
         }
-        std::printf("%s\n", out.c_str());
+        if (auto err = writeOutput("io.print", out + "\n")) return err;
         return getNull();
     };
 
     // print_no_newline(args...) -> null, prints to stdout without newline
     funcs["print_no_newline"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        std::string out;
         for (size_t i = 0; i < args.size(); i++) {
-            if (i > 0) std::printf(" ");
-            std::printf("%s", args[i]->inspect().c_str());
+            if (i > 0) out += " ";
+            out += args[i]->inspect();
         }
-        std::fflush(stdout);
+        if (auto err = prompt("io.print_no_newline", out)) return err;
         return getNull();
     };
 
@@ -74,6 +82,7 @@ void initIoModule() {
 
     // read_line() -> string from stdin
     funcs["read_line"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (auto err = inputDenied("io.read_line")) return err;
         std::string line;
         if (!std::getline(std::cin, line)) return getNull();
         return newString(line);
@@ -81,6 +90,7 @@ void initIoModule() {
 
     // read_all() -> all of stdin as string
     funcs["read_all"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (auto err = inputDenied("io.read_all")) return err;
         std::ostringstream buf;
         buf << std::cin.rdbuf();
         return newString(buf.str());
@@ -89,9 +99,9 @@ void initIoModule() {
     // read(prompt?) -> string with optional prompt
     funcs["read"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() > 1) return makeError("read: expected 0-1 arguments");
+        if (auto err = inputDenied("io.read")) return err;
         if (args.size() == 1) {
-            std::printf("%s", getString(args[0]).c_str());
-            std::fflush(stdout);
+            if (auto err = prompt("io.read", getString(args[0]))) return err;
         }
         std::string line;
         if (!std::getline(std::cin, line)) return getNull();
@@ -101,9 +111,9 @@ void initIoModule() {
     // read_int(prompt?) -> integer from stdin
     funcs["read_int"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() > 1) return makeError("read_int: expected 0-1 arguments");
+        if (auto err = inputDenied("io.read_int")) return err;
         if (args.size() == 1) {
-            std::printf("%s", getString(args[0]).c_str());
-            std::fflush(stdout);
+            if (auto err = prompt("io.read_int", getString(args[0]))) return err;
         }
         std::string line;
         if (!std::getline(std::cin, line)) return getNull();
@@ -114,9 +124,9 @@ void initIoModule() {
     // read_float(prompt?) -> float from stdin
     funcs["read_float"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() > 1) return makeError("read_float: expected 0-1 arguments");
+        if (auto err = inputDenied("io.read_float")) return err;
         if (args.size() == 1) {
-            std::printf("%s", getString(args[0]).c_str());
-            std::fflush(stdout);
+            if (auto err = prompt("io.read_float", getString(args[0]))) return err;
         }
         std::string line;
         if (!std::getline(std::cin, line)) return getNull();
@@ -127,9 +137,9 @@ void initIoModule() {
     // read_bool(prompt?) -> bool from stdin (accepts true/false/1/0/yes/no)
     funcs["read_bool"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() > 1) return makeError("read_bool: expected 0-1 arguments");
+        if (auto err = inputDenied("io.read_bool")) return err;
         if (args.size() == 1) {
-            std::printf("%s", getString(args[0]).c_str());
-            std::fflush(stdout);
+            if (auto err = prompt("io.read_bool", getString(args[0]))) return err;
         }
         std::string line;
         if (!std::getline(std::cin, line)) return getNull();
@@ -149,9 +159,9 @@ void initIoModule() {
     // read_until(prompt?, delimiter) -> string until delimiter
     funcs["read_until"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() < 1 || args.size() > 2) return makeError("read_until: expected 1-2 arguments");
+        if (auto err = inputDenied("io.read_until")) return err;
         if (args.size() >= 2) {
-            std::printf("%s", getString(args[0]).c_str());
-            std::fflush(stdout);
+            if (auto err = prompt("io.read_until", getString(args[0]))) return err;
         }
         std::string delim = (args.size() >= 2) ? getString(args[1]) : "\n";
         std::string result;
@@ -173,8 +183,8 @@ void initIoModule() {
         if (args.size() >= 1) prompt = getString(args[0]);
         if (args.size() >= 2 && args[1]) defaultVal = isTruthy(args[1]);
 
-        std::printf("%s ", prompt.c_str());
-        std::fflush(stdout);
+        if (auto err = inputDenied("io.confirm")) return err;
+        if (auto err = native::prompt("io.confirm", prompt + " ")) return err;
         std::string line;
         if (!std::getline(std::cin, line)) return newBoolean(defaultVal);
 
@@ -193,12 +203,13 @@ void initIoModule() {
         std::string prompt = "Choose an option";
         if (args.size() >= 2) prompt = getString(args[1]);
 
+        if (auto err = inputDenied("io.choose")) return err;
         // Display options
+        std::string menu;
         for (size_t i = 0; i < opts->elements.size(); i++) {
-            std::printf("  %zu. %s\n", i + 1, opts->elements[i]->inspect().c_str());
+            menu += "  " + std::to_string(i + 1) + ". " + opts->elements[i]->inspect() + "\n";
         }
-        std::printf("%s: ", prompt.c_str());
-        std::fflush(stdout);
+        if (auto err = native::prompt("io.choose", menu + prompt + ": ")) return err;
 
         std::string line;
         if (!std::getline(std::cin, line)) return getNull();
@@ -251,8 +262,7 @@ void initIoModule() {
 
     // beep() -> null
     funcs["beep"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        std::printf("\a");
-        std::fflush(stdout);
+        if (auto err = prompt("io.beep", "\a")) return err;
         return getNull();
     };
 
@@ -364,7 +374,28 @@ void initIoModule() {
         return newString(result);
     };
 
-    Registry::instance().registerModule("io", funcs);
+    Registry::instance().registerModule("io", funcs, "Input/Output", {
+        {"print", {"(args...)", "Print with newline"}},
+        {"println", {"(args...)", "Alias for print"}},
+        {"print_no_newline", {"(args...)", "Print without newline"}},
+        {"format", {"(tmpl, args...)", "Format string with {0}, {1}, etc."}},
+        {"sprint", {"(tmpl, args...)", "Alias for format"}},
+        {"read_line", {"()", "Read line from stdin"}},
+        {"read_all", {"()", "Read all of stdin"}},
+        {"read", {"(prompt?)", "Read with optional prompt"}},
+        {"read_int", {"(prompt?)", "Read integer"}},
+        {"read_float", {"(prompt?)", "Read float"}},
+        {"read_bool", {"(prompt?)", "Read boolean"}},
+        {"read_until", {"(prompt?, delim)", "Read until delimiter"}},
+        {"confirm", {"(prompt?, default?)", "Yes/no confirmation"}},
+        {"choose", {"(opts, prompt?)", "Multiple choice menu"}},
+        {"progress", {"(current, total, width?)", "Progress bar"}},
+        {"spinner", {"()", "Spinning character"}},
+        {"table", {"(headers, rows)", "Formatted table"}},
+        {"json_table", {"(data)", "Table from objects"}},
+        {"clear_screen", {"()", "Clear terminal"}},
+        {"beep", {"()", "Terminal beep"}},
+    });
 }
 
 } // namespace darix::native
@@ -1,11 +1,17 @@
 #include "darix/native/native.hpp"
 #include <cctype>
+#include <cmath>
 #include <sstream>
 
 namespace darix::native {
 
 static ObjectPtr makeError(const std::string& msg) { return newError("%s", msg.c_str()); }
 
+// A parse error, or the ResourceError of a collection past the size limits.
+static bool isFailure(const ObjectPtr& obj) {
+    return obj && (obj->type() == ObjectType::ERROR || obj->type() == ObjectType::EXCEPTION_SIGNAL);
+}
+
 // Forward declarations for recursive parsing
 static ObjectPtr parseValue(const std::string& json, size_t& pos);
 
@@ -101,8 +107,9 @@ static ObjectPtr parseArray(const std::string& json, size_t& pos) {
     while (pos < json.size()) {
         skipWhitespace(json, pos);
         auto val = parseValue(json, pos);
-        if (val && val->type() == ObjectType::ERROR) return val;
+        if (isFailure(val)) return val;
         elements.push_back(val);
+        if (auto err = arraySizeError(elements.size())) return err;
         skipWhitespace(json, pos);
         if (pos < json.size() && json[pos] == ',') { pos++; continue; }
         if (pos < json.size() && json[pos] == ']') { pos++; break; }
@@ -119,14 +126,15 @@ static ObjectPtr parseObject(const std::string& json, size_t& pos) {
     while (pos < json.size()) {
         skipWhitespace(json, pos);
         auto key = parseString(json, pos);
-        if (key && key->type() == ObjectType::ERROR) return key;
+        if (isFailure(key)) return key;
         skipWhitespace(json, pos);
         if (pos >= json.size() || json[pos] != ':') return makeError("expected ':' in object");
         pos++; // skip ':'
         skipWhitespace(json, pos);
         auto val = parseValue(json, pos);
-        if (val && val->type() == ObjectType::ERROR) return val;
+        if (isFailure(val)) return val;
         result->pairs.push_back({key, val});
+        if (auto err = mapSizeError(result->pairs.size())) return err;
         skipWhitespace(json, pos);
         if (pos < json.size() && json[pos] == ',') { pos++; continue; }
         if (pos < json.size() && json[pos] == '}') { pos++; break; }
@@ -162,10 +170,11 @@ static std::string stringifyValue(ObjectPtr obj, int indent, int depth) {
         case ObjectType::BOOLEAN: return std::dynamic_pointer_cast<Boolean>(obj)->value ? "true" : "false";
         case ObjectType::INTEGER: return std::to_string(std::dynamic_pointer_cast<Integer>(obj)->value);
         case ObjectType::FLOAT: {
-            char buf[64];
-            std::snprintf(buf, sizeof(buf), "%g", std::dynamic_pointer_cast<Float>(obj)->value);
-            return buf;
+            double v = std::dynamic_pointer_cast<Float>(obj)->value;
+            if (std::isnan(v) || std::isinf(v)) return "null"; // not representable in JSON
+            return formatFloat(v);
         }
+        case ObjectType::DECIMAL: return obj->inspect(); // exact digits, as a JSON number
         case ObjectType::STRING: {
             std::string s = std::dynamic_pointer_cast<String>(obj)->value;
             std::string result = "\"";
@@ -227,7 +236,7 @@ void initJsonModule() {
         size_t pos = 0;
         auto result = parseValue(json, pos);
         skipWhitespace(json, pos);
-        if (pos < json.size() && result && result->type() != ObjectType::ERROR) {
+        if (pos < json.size() && !isFailure(result)) {
             return makeError("parse: unexpected trailing content at position " + std::to_string(pos));
         }
         return result;
@@ -254,7 +263,11 @@ void initJsonModule() {
         return newBoolean(result && result->type() != ObjectType::ERROR);
     };
 
-    Registry::instance().registerModule("json", funcs);
+    Registry::instance().registerModule("json", funcs, "JSON Serialization", {
+        {"parse", {"(str)", "Parse JSON string to objects"}},
+        {"stringify", {"(obj, indent?)", "Convert to JSON string"}},
+        {"is_valid", {"(str)", "Check if valid JSON"}},
+    });
 }
 
 } // namespace darix::native
@@ -454,7 +454,46 @@ void initLinkedListModule() {
         return newArray({});
     };
 
-    Registry::instance().registerModule("linkedlist", funcs);
+    Registry::instance().registerModule("linkedlist", funcs, "Linked List Operations", {
+        {"new", {"()", "Create empty list"}},
+        {"from_array", {"(arr)", "Create from array"}},
+        {"to_array", {"(ll)", "Convert to array"}},
+        {"is_empty", {"(ll)", "Check if empty"}},
+        {"head", {"(ll)", "First element"}},
+        {"tail", {"(ll)", "All but first"}},
+        {"last", {"(ll)", "Last element"}},
+        {"init", {"(ll)", "All but last"}},
+        {"cons", {"(ll, elem)", "Prepend element"}},
+        {"append", {"(ll, elem)", "Append element"}},
+        {"concat", {"(a, b)", "Concatenate lists"}},
+        {"length", {"(ll)", "Number of elements"}},
+        {"nth", {"(ll, index)", "Element at index"}},
+        {"insert_at", {"(ll, index, elem)", "Insert at position"}},
+        {"remove_at", {"(ll, index)", "Remove at position"}},
+        {"remove_first", {"(ll, elem)", "Remove first occurrence"}},
+        {"remove_all", {"(ll, elem)", "Remove all occurrences"}},
+        {"contains", {"(ll, elem)", "Check membership"}},
+        {"index_of", {"(ll, elem)", "Find index"}},
+        {"reverse", {"(ll)", "Reverse order"}},
+        {"sort", {"(ll)", "Sort elements"}},
+        {"unique", {"(ll)", "Remove duplicates"}},
+        {"take", {"(ll, n)", "First n elements"}},
+        {"drop", {"(ll, n)", "Skip first n elements"}},
+        {"slice", {"(ll, start, end?)", "Sub-list"}},
+        {"zip", {"(a, b)", "Pair elements"}},
+        {"flatten", {"(ll)", "Flatten one level"}},
+        {"enumerate", {"(ll)", "Array of [index, value]"}},
+        {"min", {"(ll)", "Minimum element"}},
+        {"max", {"(ll)", "Maximum element"}},
+        {"fold", {"(ll, fn, init)", "Reduce"}},
+        {"map_list", {"(ll, fn)", "Transform elements"}},
+        {"filter_list", {"(ll, fn)", "Filter elements"}},
+        {"partition", {"(ll, fn)", "Split by predicate"}},
+        {"group_by", {"(ll, fn)", "Group by key"}},
+        {"equals", {"(a, b)", "Structural equality"}},
+        {"to_string", {"(ll)", "String representation"}},
+        {"clear", {"(ll)", "Empty the list"}},
+    });
 }
 
 } // namespace darix::native
@@ -74,9 +74,11 @@ void initMapModule() {
         if (args.size() != 3) return makeError("put: expected 3 arguments");
         auto m = std::dynamic_pointer_cast<Map>(args[0]);
         if (!m) return makeError("put: first argument must be map");
+        if (auto err = frozenError(m, args[1])) return err;
         for (auto& [k, v] : m->pairs) {
             if (equals(k, args[1])) { v = args[2]; return m; }
         }
+        if (auto err = mapSizeError(m->pairs.size() + 1)) return err;
         m->pairs.push_back({args[1], args[2]});
         return m;
     };
@@ -86,6 +88,7 @@ void initMapModule() {
         if (args.size() != 2) return makeError("remove: expected 2 arguments");
         auto m = std::dynamic_pointer_cast<Map>(args[0]);
         if (!m) return makeError("remove: first argument must be map");
+        if (auto err = frozenError(m, args[1])) return err;
         for (auto it = m->pairs.begin(); it != m->pairs.end(); ++it) {
             if (equals(it->first, args[1])) { m->pairs.erase(it); return m; }
         }
@@ -106,7 +109,9 @@ void initMapModule() {
             for (auto& rk : result->pairs) {
                 if (equals(rk.first, k)) { rk.second = v; found = true; break; }
             }
-            if (!found) result->pairs.push_back({k, v});
+            if (found) continue;
+            if (auto err = mapSizeError(result->pairs.size() + 1)) return err;
+            result->pairs.push_back({k, v});
         }
         return result;
     };
@@ -132,6 +137,7 @@ void initMapModule() {
         if (args.size() != 1) return makeError("clear: expected 1 argument");
         auto m = std::dynamic_pointer_cast<Map>(args[0]);
         if (!m) return makeError("clear: argument must be map");
+        if (auto err = frozenError(m)) return err;
         m->pairs.clear();
         return m;
     };
@@ -264,7 +270,29 @@ void initMapModule() {
         return newArray(result);
     };
 
-    Registry::instance().registerModule("map", funcs);
+    Registry::instance().registerModule("map", funcs, "Map Operations", {
+        {"keys", {"(m)", "Array of keys"}},
+        {"values", {"(m)", "Array of values"}},
+        {"items", {"(m)", "Array of [key, value] pairs"}},
+        {"has_key", {"(m, key)", "Check if key exists"}},
+        {"has_value", {"(m, val)", "Check if value exists"}},
+        {"get", {"(m, key, default?)", "Get value with default"}},
+        {"put", {"(m, key, val)", "Add/update entry"}},
+        {"remove", {"(m, key)", "Remove entry"}},
+        {"merge", {"(a, b)", "Merge two maps"}},
+        {"size", {"(m)", "Number of entries"}},
+        {"is_empty", {"(m)", "Check if empty"}},
+        {"clear", {"(m)", "Remove all entries"}},
+        {"map_keys", {"(m, fn)", "Transform keys"}},
+        {"map_values", {"(m, fn)", "Transform values"}},
+        {"filter", {"(m, fn)", "Filter entries"}},
+        {"find_key", {"(m, fn)", "Find first matching key"}},
+        {"from_pairs", {"(arr)", "Create map from pairs array"}},
+        {"to_pairs", {"(m)", "Convert to pairs array"}},
+        {"invert", {"(m)", "Swap keys and values"}},
+        {"equals", {"(a, b)", "Structural equality"}},
+        {"keys_array", {"(m)", "Sorted array of keys"}},
+    });
 }
 
 } // namespace darix::native
@@ -1,6 +1,7 @@
 #define _USE_MATH_DEFINES
 #include "darix/native/native.hpp"
 #include <cmath>
+#include <complex>
 #include <random>
 
 namespace darix::native {
@@ -11,153 +12,132 @@ static double getFloat(ObjectPtr obj) {
     return 0;
 }
 
-static bool isNumber(ObjectPtr obj) {
-    return obj && (obj->type() == ObjectType::INTEGER || obj->type() == ObjectType::FLOAT);
+static std::complex<double> getComplex(ObjectPtr obj) {
+    if (auto c = std::dynamic_pointer_cast<Complex>(obj)) return {c->real, c->imag};
+    return getFloat(obj);
 }
 
 static ObjectPtr makeFloat(double val) { return newFloat(val); }
-static ObjectPtr makeError(const std::string& msg) { return newError("%s", msg.c_str()); }
 
 void initMathModule() {
     std::unordered_map<std::string, NativeFunc> funcs;
 
     funcs["sqrt"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_sqrt: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_sqrt: argument must be number");
+        if (auto err = requireArgs("math.sqrt", args, {Arg::Number})) return err;
         double val = getFloat(args[0]);
-        if (val < 0) return makeError("math_sqrt: square root of negative number");
+        if (val < 0) return valueError("math.sqrt", "square root of negative number");
         return makeFloat(std::sqrt(val));
     };
 
     funcs["pow"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 2) return makeError("math_pow: expected 2 arguments");
-        if (!isNumber(args[0]) || !isNumber(args[1])) return makeError("math_pow: arguments must be numbers");
+        if (auto err = requireArgs("math.pow", args, {Arg::Number, Arg::Number})) return err;
         return makeFloat(std::pow(getFloat(args[0]), getFloat(args[1])));
     };
 
     funcs["exp"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_exp: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_exp: argument must be number");
+        if (auto err = requireArgs("math.exp", args, {Arg::Number})) return err;
         return makeFloat(std::exp(getFloat(args[0])));
     };
 
     funcs["log"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_log: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_log: argument must be number");
+        if (auto err = requireArgs("math.log", args, {Arg::Number})) return err;
         double val = getFloat(args[0]);
-        if (val <= 0) return makeError("math_log: logarithm of non-positive number");
+        if (val <= 0) return valueError("math.log", "logarithm of non-positive number");
         return makeFloat(std::log(val));
     };
 
     funcs["log10"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_log10: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_log10: argument must be number");
+        if (auto err = requireArgs("math.log10", args, {Arg::Number})) return err;
         double val = getFloat(args[0]);
-        if (val <= 0) return makeError("math_log10: logarithm of non-positive number");
+        if (val <= 0) return valueError("math.log10", "logarithm of non-positive number");
         return makeFloat(std::log10(val));
     };
 
     funcs["log2"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_log2: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_log2: argument must be number");
+        if (auto err = requireArgs("math.log2", args, {Arg::Number})) return err;
         double val = getFloat(args[0]);
-        if (val <= 0) return makeError("math_log2: logarithm of non-positive number");
+        if (val <= 0) return valueError("math.log2", "logarithm of non-positive number");
         return makeFloat(std::log2(val));
     };
 
     funcs["sin"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_sin: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_sin: argument must be number");
+        if (auto err = requireArgs("math.sin", args, {Arg::Number})) return err;
         return makeFloat(std::sin(getFloat(args[0])));
     };
 
     funcs["cos"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_cos: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_cos: argument must be number");
+        if (auto err = requireArgs("math.cos", args, {Arg::Number})) return err;
         return makeFloat(std::cos(getFloat(args[0])));
     };
 
     funcs["tan"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_tan: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_tan: argument must be number");
+        if (auto err = requireArgs("math.tan", args, {Arg::Number})) return err;
         return makeFloat(std::tan(getFloat(args[0])));
     };
 
     funcs["asin"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_asin: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_asin: argument must be number");
+        if (auto err = requireArgs("math.asin", args, {Arg::Number})) return err;
         double val = getFloat(args[0]);
-        if (val < -1 || val > 1) return makeError("math_asin: argument out of range [-1, 1]");
+        if (val < -1 || val > 1) return valueError("math.asin", "argument out of range [-1, 1]");
         return makeFloat(std::asin(val));
     };
 
     funcs["acos"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_acos: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_acos: argument must be number");
+        if (auto err = requireArgs("math.acos", args, {Arg::Number})) return err;
         double val = getFloat(args[0]);
-        if (val < -1 || val > 1) return makeError("math_acos: argument out of range [-1, 1]");
+        if (val < -1 || val > 1) return valueError("math.acos", "argument out of range [-1, 1]");
         return makeFloat(std::acos(val));
     };
 
     funcs["atan"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_atan: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_atan: argument must be number");
+        if (auto err = requireArgs("math.atan", args, {Arg::Number})) return err;
         return makeFloat(std::atan(getFloat(args[0])));
     };
 
     funcs["atan2"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 2) return makeError("math_atan2: expected 2 arguments");
-        if (!isNumber(args[0]) || !isNumber(args[1])) return makeError("math_atan2: arguments must be numbers");
+        if (auto err = requireArgs("math.atan2", args, {Arg::Number, Arg::Number})) return err;
         return makeFloat(std::atan2(getFloat(args[0]), getFloat(args[1])));
     };
 
     funcs["sinh"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_sinh: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_sinh: argument must be number");
+        if (auto err = requireArgs("math.sinh", args, {Arg::Number})) return err;
         return makeFloat(std::sinh(getFloat(args[0])));
     };
 
     funcs["cosh"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_cosh: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_cosh: argument must be number");
+        if (auto err = requireArgs("math.cosh", args, {Arg::Number})) return err;
         return makeFloat(std::cosh(getFloat(args[0])));
     };
 
     funcs["tanh"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_tanh: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_tanh: argument must be number");
+        if (auto err = requireArgs("math.tanh", args, {Arg::Number})) return err;
         return makeFloat(std::tanh(getFloat(args[0])));
     };
 
     funcs["ceil"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_ceil: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_ceil: argument must be number");
+        if (auto err = requireArgs("math.ceil", args, {Arg::Number})) return err;
         return makeFloat(std::ceil(getFloat(args[0])));
     };
 
     funcs["floor"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_floor: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_floor: argument must be number");
+        if (auto err = requireArgs("math.floor", args, {Arg::Number})) return err;
         return makeFloat(std::floor(getFloat(args[0])));
     };
 
     funcs["round"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_round: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_round: argument must be number");
+        if (auto err = requireArgs("math.round", args, {Arg::Number})) return err;
         return makeFloat(std::round(getFloat(args[0])));
     };
 
     funcs["trunc"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_trunc: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_trunc: argument must be number");
+        if (auto err = requireArgs("math.trunc", args, {Arg::Number})) return err;
         return makeFloat(std::trunc(getFloat(args[0])));
     };
 
     funcs["max"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() < 2) return makeError("math_max: expected at least 2 arguments");
+        if (auto err = requireVarArgs("math.max", args, 2, Arg::Number)) return err;
         double max = getFloat(args[0]);
         for (size_t i = 1; i < args.size(); i++) {
-            if (!isNumber(args[i])) return makeError("math_max: all arguments must be numbers");
             double v = getFloat(args[i]);
             if (v > max) max = v;
         }
@@ -165,10 +145,9 @@ void initMathModule() {
     };
 
     funcs["min"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() < 2) return makeError("math_min: expected at least 2 arguments");
+        if (auto err = requireVarArgs("math.min", args, 2, Arg::Number)) return err;
         double min = getFloat(args[0]);
         for (size_t i = 1; i < args.size(); i++) {
-            if (!isNumber(args[i])) return makeError("math_min: all arguments must be numbers");
             double v = getFloat(args[i]);
             if (v < min) min = v;
         }
@@ -176,37 +155,102 @@ void initMathModule() {
     };
 
     funcs["pi"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 0) return makeError("math_pi: expected 0 arguments");
+        if (auto err = requireArgs("math.pi", args, {})) return err;
         return makeFloat(M_PI);
     };
 
     funcs["e"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 0) return makeError("math_e: expected 0 arguments");
+        if (auto err = requireArgs("math.e", args, {})) return err;
         return makeFloat(M_E);
     };
 
     funcs["abs"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 1) return makeError("math_abs: expected 1 argument");
-        if (!isNumber(args[0])) return makeError("math_abs: argument must be number");
-        return makeFloat(std::abs(getFloat(args[0])));
+        if (auto err = requireArgs("math.abs", args, {Arg::Complex})) return err;
+        return makeFloat(std::abs(getComplex(args[0])));
+    };
+
+    funcs["complex"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (auto err = requireArgs("math.complex", args, {Arg::Number, Arg::Number}, 1)) return err;
+        return newComplex(getFloat(args[0]), args.size() == 2 ? getFloat(args[1]) : 0.0);
+    };
+
+    // Polar form: the complex number with magnitude r and phase theta.
+    funcs["rect"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (auto err = requireArgs("math.rect", args, {Arg::Number, Arg::Number})) return err;
+        auto z = std::polar(getFloat(args[0]), getFloat(args[1]));
+        return newComplex(z.real(), z.imag());
+    };
+
+    funcs["real"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (auto err = requireArgs("math.real", args, {Arg::Complex})) return err;
+        return makeFloat(getComplex(args[0]).real());
+    };
+
+    funcs["imag"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (auto err = requireArgs("math.imag", args, {Arg::Complex})) return err;
+        return makeFloat(getComplex(args[0]).imag());
+    };
+
+    funcs["phase"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (auto err = requireArgs("math.phase", args, {Arg::Complex})) return err;
+        return makeFloat(std::arg(getComplex(args[0])));
+    };
+
+    funcs["conj"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (auto err = requireArgs("math.conj", args, {Arg::Complex})) return err;
+        auto z = getComplex(args[0]);
+        return newComplex(z.real(), -z.imag());
     };
 
     funcs["mod"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 2) return makeError("math_mod: expected 2 arguments");
-        if (!isNumber(args[0]) || !isNumber(args[1])) return makeError("math_mod: arguments must be numbers");
+        if (auto err = requireArgs("math.mod", args, {Arg::Number, Arg::Number})) return err;
         double y = getFloat(args[1]);
-        if (y == 0) return makeError("math_mod: division by zero");
+        if (y == 0) return valueError("math.mod", "division by zero");
         return makeFloat(std::fmod(getFloat(args[0]), y));
     };
 
-    static std::mt19937 rng(std::random_device{}());
     funcs["random"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        if (args.size() != 0) return makeError("math_random: expected 0 arguments");
+        if (auto err = requireArgs("math.random", args, {})) return err;
+        static std::mt19937 rng(static_cast<std::mt19937::result_type>(randomSeed()));
         static std::uniform_real_distribution<double> dist(0.0, 1.0);
         return makeFloat(dist(rng));
     };
 
-    Registry::instance().registerModule("math", funcs);
+    Registry::instance().registerModule("math", funcs, "Mathematical Functions", {
+        {"sqrt", {"(x)", "Square root"}},
+        {"pow", {"(base, exp)", "Power"}},
+        {"exp", {"(x)", "e^x"}},
+        {"log", {"(x)", "Natural logarithm"}},
+        {"log10", {"(x)", "Base-10 logarithm"}},
+        {"log2", {"(x)", "Base-2 logarithm"}},
+        {"sin", {"(x)", "Sine (radians)"}},
+        {"cos", {"(x)", "Cosine (radians)"}},
+        {"tan", {"(x)", "Tangent (radians)"}},
+        {"asin", {"(x)", "Arc sine"}},
+        {"acos", {"(x)", "Arc cosine"}},
+        {"atan", {"(x)", "Arc tangent"}},
+        {"atan2", {"(y, x)", "Two-argument arc tangent"}},
+        {"sinh", {"(x)", "Hyperbolic sine"}},
+        {"cosh", {"(x)", "Hyperbolic cosine"}},
+        {"tanh", {"(x)", "Hyperbolic tangent"}},
+        {"ceil", {"(x)", "Round up"}},
+        {"floor", {"(x)", "Round down"}},
+        {"round", {"(x)", "Round to nearest"}},
+        {"trunc", {"(x)", "Truncate to integer"}},
+        {"max", {"(a, b, ...)", "Maximum value"}},
+        {"min", {"(a, b, ...)", "Minimum value"}},
+        {"pi", {"()", "Pi constant"}},
+        {"e", {"()", "Euler's number"}},
+        {"abs", {"(x)", "Absolute value, or magnitude of a complex number"}},
+        {"complex", {"(re, im?)", "Complex number re + im*i"}},
+        {"rect", {"(r, theta)", "Complex number from magnitude and phase"}},
+        {"real", {"(z)", "Real part"}},
+        {"imag", {"(z)", "Imaginary part"}},
+        {"phase", {"(z)", "Angle of a complex number (radians)"}},
+        {"conj", {"(z)", "Complex conjugate"}},
+        {"mod", {"(x, y)", "Floating-point modulo"}},
+        {"random", {"()", "Random float [0, 1)"}},
+    });
 }
 
 } // namespace darix::native
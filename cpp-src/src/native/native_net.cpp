@@ -39,7 +39,7 @@ static void ensureWinsock() {
 void initNetModule() {
     std::unordered_map<std::string, NativeFunc> funcs;
 
-    // tcp_connect(host, port) -> socket_fd (as integer)
+    // tcp_connect(host, port) -> socket handle
     funcs["tcp_connect"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() != 2) return makeError("tcp_connect: expected 2 arguments");
         std::string host = getString(args[0]);
@@ -74,28 +74,29 @@ void initNetModule() {
             CLOSE_SOCKET(fd);
             return makeError("tcp_connect: connection failed");
         }
-        return newInteger(static_cast<int64_t>(fd));
+        return openHandle("socket", static_cast<int64_t>(fd), [fd] { CLOSE_SOCKET(fd); });
     };
 
-    // tcp_send(fd, data) -> bytes sent
+    // tcp_send(socket, data) -> bytes sent
     funcs["tcp_send"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() != 2) return makeError("tcp_send: expected 2 arguments");
-        auto fdObj = std::dynamic_pointer_cast<Integer>(args[0]);
-        if (!fdObj) return makeError("tcp_send: fd must be integer");
+        int64_t id = 0;
+        if (!handleId(args[0], "socket", &id)) return makeError("tcp_send: expected an open socket");
         std::string data = getString(args[1]);
-        sock_t fd = static_cast<sock_t>(fdObj->value);
+        sock_t fd = static_cast<sock_t>(id);
         auto sent = ::send(fd, data.c_str(), static_cast<int>(data.size()), 0);
         if (sent < 0) return makeError("tcp_send: send failed");
         return newInteger(static_cast<int64_t>(sent));
     };
 
-    // tcp_recv(fd, bufsize) -> string
+    // tcp_recv(socket, bufsize) -> string
     funcs["tcp_recv"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() != 2) return makeError("tcp_recv: expected 2 arguments");
-        auto fdObj = std::dynamic_pointer_cast<Integer>(args[0]);
+        int64_t id = 0;
+        if (!handleId(args[0], "socket", &id)) return makeError("tcp_recv: expected an open socket");
         auto szObj = std::dynamic_pointer_cast<Integer>(args[1]);
-        if (!fdObj || !szObj) return makeError("tcp_recv: arguments must be integers");
-        sock_t fd = static_cast<sock_t>(fdObj->value);
+        if (!szObj) return makeError("tcp_recv: bufsize must be integer");
+        sock_t fd = static_cast<sock_t>(id);
         int bufsize = static_cast<int>(szObj->value);
         if (bufsize <= 0 || bufsize > 65536) bufsize = 4096;
         std::vector<char> buf(bufsize);
@@ -104,12 +105,12 @@ void initNetModule() {
         return newString(std::string(buf.data(), received));
     };
 
-    // tcp_close(fd) -> bool
+    // tcp_close(socket) -> false if it was already closed
     funcs["tcp_close"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() != 1) return makeError("tcp_close: expected 1 argument");
-        auto fdObj = std::dynamic_pointer_cast<Integer>(args[0]);
-        if (!fdObj) return makeError("tcp_close: fd must be integer");
-        return newBoolean(CLOSE_SOCKET(static_cast<sock_t>(fdObj->value)) == 0);
+        if (!std::dynamic_pointer_cast<Handle>(args[0]) && !std::dynamic_pointer_cast<Integer>(args[0]))
+            return makeError("tcp_close: expected a socket");
+        return newBoolean(closeHandle(args[0], "socket"));
     };
 
     // udp_send(host, port, data) -> bytes sent
@@ -332,7 +333,16 @@ void initNetModule() {
         return newArray(ips);
     };
 
-    Registry::instance().registerModule("net", funcs);
+    Registry::instance().registerModule("net", funcs, "Networking", {
+        {"tcp_connect", {"(host, port)", "TCP connect -> socket handle"}},
+        {"tcp_send", {"(sock, data)", "Send data"}},
+        {"tcp_recv", {"(sock, bufsize)", "Receive data"}},
+        {"tcp_close", {"(sock)", "Close connection (same as sock.close())"}},
+        {"udp_send", {"(host, port, data)", "UDP send"}},
+        {"http_get", {"(url)", "HTTP GET -> {status, body}"}},
+        {"http_post", {"(url, body, type?)", "HTTP POST -> {status, body}"}},
+        {"resolve", {"(host)", "DNS resolve -> [ips]"}},
+    });
 }
 
 } // namespace darix::native
@@ -1,5 +1,7 @@
 #include "darix/native/native.hpp"
+#include <cerrno>
 #include <cstdlib>
+#include <cstring>
 #include <chrono>
 #include <thread>
 
@@ -16,6 +18,13 @@
 #include <sys/utsname.h>
 #endif
 
+#ifndef _WIN32
+#include <fcntl.h>
+#include <poll.h>
+#include <signal.h>
+#include <sys/wait.h>
+#endif
+
 namespace darix::native {
 
 static ObjectPtr makeError(const std::string& msg) { return newError("%s", msg.c_str()); }
@@ -25,6 +34,115 @@ static std::string getString(ObjectPtr obj) {
     return "";
 }
 
+#ifndef _WIN32
+// Runs argvs as a pipeline, each process's stdout feeding the next one's
+// stdin. input goes to the first process and the last one's stdout is
+// collected; stderr is shared with ours. codes gets each exit status, with
+// 128 + the signal for a killed process as shells report it.
+static bool runPipeline(const std::vector<std::vector<std::string>>& argvs, const std::string& input,
+                        std::string* output, std::vector<int>* codes, std::string* error) {
+    // Every pipe end is close-on-exec, so a process only keeps the two ends
+    // dup2'd onto its stdin and stdout and sees end-of-file when it should.
+    auto makePipe = [](int fds[2]) {
+        if (pipe(fds) != 0) return false;
+        fcntl(fds[0], F_SETFD, FD_CLOEXEC);
+        fcntl(fds[1], F_SETFD, FD_CLOEXEC);
+        return true;
+    };
+    int in[2];
+    if (!makePipe(in)) {
+        *error = std::string("cannot create pipes: ") + std::strerror(errno);
+        return false;
+    }
+    signal(SIGPIPE, SIG_IGN);
+    std::vector<pid_t> pids;
+    int readFd = in[0];
+    for (auto& argv : argvs) {
+        int out[2];
+        if (!makePipe(out)) {
+            *error = std::string("cannot create pipes: ") + std::strerror(errno);
+            break;
+        }
+        pid_t pid = fork();
+        if (pid < 0) {
+            *error = std::string("cannot start '") + argv[0] + "': " + std::strerror(errno);
+            close(out[0]);
+            close(out[1]);
+            break;
+        }
+        if (pid == 0) {
+            signal(SIGPIPE, SIG_DFL);
+            dup2(readFd, STDIN_FILENO);
+            dup2(out[1], STDOUT_FILENO);
+            std::vector<char*> args;
+            for (auto& a : argv) args.push_back(const_cast<char*>(a.c_str()));
+            args.push_back(nullptr);
+            execvp(args[0], args.data());
+            _exit(127);
+        }
+        pids.push_back(pid);
+        close(readFd);
+        close(out[1]);
+        readFd = out[0];
+    }
+    if (pids.size() < argvs.size()) {
+        close(in[1]);
+        close(readFd);
+        for (pid_t pid : pids) {
+            kill(pid, SIGKILL);
+            while (waitpid(pid, nullptr, 0) < 0 && errno == EINTR) {}
+        }
+        return false;
+    }
+
+    // Feed the first process and drain the last one together, so neither
+    // side can block the other.
+    int inFd = in[1], outFd = readFd;
+    size_t written = 0;
+    if (input.empty()) {
+        close(inFd);
+        inFd = -1;
+    }
+    while (outFd >= 0) {
+        std::vector<pollfd> fds;
+        if (inFd >= 0) fds.push_back({inFd, POLLOUT, 0});
+        fds.push_back({outFd, POLLIN, 0});
+        if (poll(fds.data(), fds.size(), -1) < 0) {
+            if (errno == EINTR) continue;
+            break;
+        }
+        for (auto& p : fds) {
+            if (!p.revents) continue;
+            if (p.fd == inFd) {
+                ssize_t n = write(inFd, input.data() + written, input.size() - written);
+                if (n > 0) written += static_cast<size_t>(n);
+                if (n <= 0 || written == input.size()) {
+                    close(inFd);
+                    inFd = -1;
+                }
+                continue;
+            }
+            char buf[4096];
+            ssize_t n = read(outFd, buf, sizeof(buf));
+            if (n > 0) {
+                output->append(buf, static_cast<size_t>(n));
+            } else if (n == 0 || errno != EINTR) {
+                close(outFd);
+                outFd = -1;
+            }
+        }
+    }
+    if (inFd >= 0) close(inFd);
+    if (outFd >= 0) close(outFd);
+    for (pid_t pid : pids) {
+        int status = 0;
+        while (waitpid(pid, &status, 0) < 0 && errno == EINTR) {}
+        codes->push_back(WIFEXITED(status) ? WEXITSTATUS(status) : 128 + WTERMSIG(status));
+    }
+    return true;
+}
+#endif
+
 void initOsModule() {
     std::unordered_map<std::string, NativeFunc> funcs;
 
@@ -102,14 +220,13 @@ void initOsModule() {
 #endif
     };
 
-    // exit(code) -> never returns
+    // exit(code) -> raises ScriptExit, as the exit builtin does
     funcs["exit"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
-        int code = 0;
+        int64_t code = 0;
         if (!args.empty()) {
-            if (auto i = std::dynamic_pointer_cast<Integer>(args[0])) code = static_cast<int>(i->value);
+            if (auto i = std::dynamic_pointer_cast<Integer>(args[0])) code = i->value;
         }
-        std::exit(code);
-        return getNull(); // unreachable
+        return newScriptExit(code);
     };
 
     // exec(command) -> map {exit_code, stdout}
@@ -147,6 +264,43 @@ void initOsModule() {
 #endif
     };
 
+    // run_pipeline(commands, stdin?) -> map {exit_code, exit_codes, stdout}
+    funcs["run_pipeline"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.empty() || args.size() > 2) return makeError("run_pipeline: expected 1-2 arguments");
+        auto commands = std::dynamic_pointer_cast<Array>(args[0]);
+        if (!commands || commands->elements.empty())
+            return makeError("run_pipeline: commands must be a non-empty array of argument arrays");
+        std::vector<std::vector<std::string>> argvs;
+        for (auto& c : commands->elements) {
+            auto argv = std::dynamic_pointer_cast<Array>(c);
+            if (!argv || argv->elements.empty())
+                return makeError("run_pipeline: each command must be a non-empty array of strings");
+            argvs.emplace_back();
+            for (auto& a : argv->elements) {
+                if (a->type() != ObjectType::STRING) return makeError("run_pipeline: command arguments must be strings");
+                argvs.back().push_back(getString(a));
+            }
+        }
+        if (args.size() == 2 && args[1]->type() != ObjectType::STRING)
+            return makeError("run_pipeline: stdin must be a string");
+        std::string input = args.size() == 2 ? getString(args[1]) : "";
+#ifdef _WIN32
+        (void)input;
+        return makeError("run_pipeline: not supported on Windows");
+#else
+        std::string output, error;
+        std::vector<int> codes;
+        if (!runPipeline(argvs, input, &output, &codes, &error)) return makeError("run_pipeline: " + error);
+        std::vector<ObjectPtr> exitCodes;
+        for (int code : codes) exitCodes.push_back(newInteger(code));
+        auto result = std::make_shared<Map>();
+        result->pairs.emplace_back(newString("exit_code"), newInteger(codes.back()));
+        result->pairs.emplace_back(newString("exit_codes"), newArray(exitCodes));
+        result->pairs.emplace_back(newString("stdout"), newString(output));
+        return result;
+#endif
+    };
+
     // sleep(seconds)
     funcs["sleep"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
         if (args.size() != 1) return makeError("sleep: expected 1 argument");
@@ -255,7 +409,25 @@ void initOsModule() {
 #endif
     };
 
-    Registry::instance().registerModule("os", funcs);
+    Registry::instance().registerModule("os", funcs, "Operating System", {
+        {"getenv", {"(name)", "Get environment variable"}},
+        {"setenv", {"(name, val)", "Set environment variable"}},
+        {"unsetenv", {"(name)", "Remove environment variable"}},
+        {"platform", {"()", "\"windows\"/\"linux\"/\"darwin\""}},
+        {"arch", {"()", "CPU architecture"}},
+        {"hostname", {"()", "Computer name"}},
+        {"user", {"()", "Current username"}},
+        {"home", {"()", "Home directory"}},
+        {"getpid", {"()", "Process ID"}},
+        {"cpu_count", {"()", "Number of CPU cores"}},
+        {"memory_info", {"()", "{total, free, used, usage_percent}"}},
+        {"uname", {"()", "System information"}},
+        {"clock", {"()", "High-res time (ms)"}},
+        {"exec", {"(cmd)", "Run command -> {exit_code, stdout}"}},
+        {"run_pipeline", {"(commands, stdin?)", "Pipe commands together -> {exit_code, exit_codes, stdout}"}},
+        {"exit", {"(code?)", "End the script with this status (raises ScriptExit)"}},
+        {"sleep", {"(seconds)", "Sleep"}},
+    });
 }
 
 } // namespace darix::native
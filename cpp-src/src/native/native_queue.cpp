@@ -266,7 +266,32 @@ void initQueueModule() {
         return newArray(std::vector<ObjectPtr>(arr->elements.begin() + start, arr->elements.begin() + end));
     };
 
-    Registry::instance().registerModule("queue", funcs);
+    Registry::instance().registerModule("queue", funcs, "FIFO Queue", {
+        {"new", {"()", "Create empty queue"}},
+        {"from_array", {"(arr)", "Create from array"}},
+        {"to_array", {"(q)", "Convert to array"}},
+        {"enqueue", {"(q, elem)", "Add to back"}},
+        {"dequeue", {"(q)", "Remove from front -> [front, rest]"}},
+        {"peek", {"(q)", "View front element"}},
+        {"peek_back", {"(q)", "View back element"}},
+        {"size", {"(q)", "Number of elements"}},
+        {"is_empty", {"(q)", "Check if empty"}},
+        {"contains", {"(q, elem)", "Check membership"}},
+        {"clear", {"(q)", "Empty the queue"}},
+        {"reverse", {"(q)", "Reverse order"}},
+        {"enqueue_front", {"(q, elem)", "Add to front"}},
+        {"dequeue_back", {"(q)", "Remove from back"}},
+        {"take", {"(q, n)", "First n elements"}},
+        {"drop", {"(q, n)", "Skip first n elements"}},
+        {"merge", {"(a, b)", "Concatenate queues"}},
+        {"filter", {"(q, fn)", "Filter elements"}},
+        {"map_queue", {"(q, fn)", "Transform elements"}},
+        {"rotate", {"(q, n)", "Rotate left by n"}},
+        {"flatten", {"(q)", "Flatten one level"}},
+        {"unique", {"(q)", "Remove duplicates"}},
+        {"index_of", {"(q, elem)", "Find index"}},
+        {"slice", {"(q, start, end?)", "Sub-queue"}},
+    });
 }
 
 } // namespace darix::native
@@ -1,7 +1,6 @@
 #include "darix/native/native.hpp"
 #include <random>
 #include <algorithm>
-#include <ctime>
 
 namespace darix::native {
 
@@ -14,7 +13,7 @@ static int64_t getInt(ObjectPtr obj) {
 }
 
 static std::mt19937_64& getRng() {
-    static std::mt19937_64 rng(static_cast<uint64_t>(std::time(nullptr)));
+    static std::mt19937_64 rng(randomSeed());
     return rng;
 }
 
@@ -211,7 +210,23 @@ void initRandomModule() {
         return newFloat(dist(getRng()));
     };
 
-    Registry::instance().registerModule("random", funcs);
+    Registry::instance().registerModule("random", funcs, "Random Number Generation", {
+        {"seed", {"(n)", "Set seed"}},
+        {"int", {"(max?)", "Random integer"}},
+        {"int_range", {"(min, max)", "Integer in [min, max)"}},
+        {"float", {"()", "Random float [0, 1)"}},
+        {"float_range", {"(min, max)", "Float in [min, max)"}},
+        {"choice", {"(arr)", "Random element"}},
+        {"choices", {"(arr, n)", "n random with replacement"}},
+        {"sample", {"(arr, n)", "n random without replacement"}},
+        {"shuffle", {"(arr)", "Shuffled copy"}},
+        {"coin", {"()", "Random boolean"}},
+        {"weighted_choice", {"(opts, weights)", "Weighted random"}},
+        {"booleans", {"(n, prob?)", "Array of random booleans"}},
+        {"ints", {"(n, min, max)", "Array of random integers"}},
+        {"normal", {"(mean, stddev)", "Normal distribution"}},
+        {"exponential", {"(lambda)", "Exponential distribution"}},
+    });
 }
 
 } // namespace darix::native
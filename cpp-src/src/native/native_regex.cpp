@@ -237,7 +237,21 @@ void initRegexModule() {
         }
     };
 
-    Registry::instance().registerModule("regex", funcs);
+    Registry::instance().registerModule("regex", funcs, "Regular Expressions", {
+        {"match", {"(pattern, str)", "First match or null"}},
+        {"matches", {"(pattern, str)", "All matches"}},
+        {"groups", {"(pattern, str)", "Capture groups"}},
+        {"named_groups", {"(pattern, str)", "Named groups"}},
+        {"test", {"(pattern, str)", "Check match"}},
+        {"replace", {"(pattern, str, rep)", "Replace first"}},
+        {"replace_all", {"(pattern, str, rep)", "Replace all"}},
+        {"replace_with_fn", {"(pattern, str, fn)", "Replace with function"}},
+        {"split", {"(pattern, str)", "Split by pattern"}},
+        {"find", {"(pattern, str)", "Find with positions"}},
+        {"count", {"(pattern, str)", "Count matches"}},
+        {"escape", {"(str)", "Escape regex metacharacters"}},
+        {"is_valid", {"(pattern)", "Check if valid regex"}},
+    });
 }
 
 } // namespace darix::native
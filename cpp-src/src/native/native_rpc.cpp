@@ -0,0 +1,218 @@
+#include "darix/native/native.hpp"
+#include <algorithm>
+#include <cerrno>
+#include <chrono>
+#include <cstring>
+
+#ifndef _WIN32
+#include <poll.h>
+#include <signal.h>
+#include <sys/wait.h>
+#include <unistd.h>
+#endif
+
+namespace darix::native {
+
+static ObjectPtr makeError(const std::string& msg) { return newError("%s", msg.c_str()); }
+
+RpcEndpoints& RpcEndpoints::instance() {
+    static RpcEndpoints endpoints;
+    return endpoints;
+}
+
+void RpcEndpoints::add(const std::string& name, Handler handler, int timeoutMs) {
+    endpoints_[name] = {std::move(handler), timeoutMs};
+}
+
+void RpcEndpoints::clear() { endpoints_.clear(); }
+
+std::vector<std::string> RpcEndpoints::names() const {
+    std::vector<std::string> out;
+    for (auto& [name, ep] : endpoints_) out.push_back(name);
+    return out;
+}
+
+bool RpcEndpoints::call(const std::string& name, const std::string& request, int timeoutMs, std::string* response,
+                        std::string* error) const {
+    auto it = endpoints_.find(name);
+    if (it == endpoints_.end()) {
+        *error = "unknown endpoint '" + name + "'";
+        auto hint = didYouMean(name, names());
+        if (!hint.empty()) *error += "; " + hint;
+        return false;
+    }
+    return it->second.handler(request, timeoutMs > 0 ? timeoutMs : it->second.timeoutMs, response, error);
+}
+
+#ifndef _WIN32
+// Runs command through the shell with request on stdin and returns its
+// stdout. The command is killed if it has not finished by the deadline.
+static bool runCommand(const std::string& command, const std::string& request, int timeoutMs, std::string* response,
+                       std::string* error) {
+    int in[2], out[2], err[2];
+    if (pipe(in) != 0 || pipe(out) != 0 || pipe(err) != 0) {
+        *error = std::string("cannot create pipes: ") + std::strerror(errno);
+        return false;
+    }
+    pid_t pid = fork();
+    if (pid < 0) {
+        *error = std::string("cannot start command: ") + std::strerror(errno);
+        return false;
+    }
+    if (pid == 0) {
+        dup2(in[0], STDIN_FILENO);
+        dup2(out[1], STDOUT_FILENO);
+        dup2(err[1], STDERR_FILENO);
+        for (int fd : {in[0], in[1], out[0], out[1], err[0], err[1]}) close(fd);
+        execl("/bin/sh", "sh", "-c", command.c_str(), static_cast<char*>(nullptr));
+        _exit(127);
+    }
+    close(in[0]);
+    close(out[1]);
+    close(err[1]);
+    signal(SIGPIPE, SIG_IGN);
+
+    // Feed stdin and collect stdout/stderr together, so a command that
+    // writes before reading everything cannot deadlock against us.
+    auto deadline = std::chrono::steady_clock::now() + std::chrono::milliseconds(timeoutMs);
+    int inFd = in[1], outFd = out[0], errFd = err[0];
+    size_t written = 0;
+    std::string stderrText;
+    if (request.empty()) {
+        close(inFd);
+        inFd = -1;
+    }
+    bool timedOut = false;
+    while (outFd >= 0 || errFd >= 0) {
+        std::vector<pollfd> fds;
+        if (inFd >= 0) fds.push_back({inFd, POLLOUT, 0});
+        if (outFd >= 0) fds.push_back({outFd, POLLIN, 0});
+        if (errFd >= 0) fds.push_back({errFd, POLLIN, 0});
+        auto left = std::chrono::duration_cast<std::chrono::milliseconds>(deadline - std::chrono::steady_clock::now()).count();
+        int ready = left > 0 ? poll(fds.data(), fds.size(), static_cast<int>(left)) : 0;
+        if (ready < 0 && errno == EINTR) continue;
+        if (ready <= 0) {
+            timedOut = true;
+            break;
+        }
+        for (auto& p : fds) {
+            if (!p.revents) continue;
+            if (p.fd == inFd) {
+                ssize_t n = write(inFd, request.data() + written, request.size() - written);
+                if (n > 0) written += static_cast<size_t>(n);
+                if (n <= 0 || written == request.size()) {
+                    close(inFd);
+                    inFd = -1;
+                }
+                continue;
+            }
+            char buf[4096];
+            ssize_t n = read(p.fd, buf, sizeof(buf));
+            std::string* text = p.fd == outFd ? response : &stderrText;
+            if (n > 0) {
+                text->append(buf, static_cast<size_t>(n));
+            } else {
+                close(p.fd);
+                (p.fd == outFd ? outFd : errFd) = -1;
+            }
+        }
+    }
+    for (int fd : {inFd, outFd, errFd})
+        if (fd >= 0) close(fd);
+    if (timedOut) kill(pid, SIGKILL);
+    int status = 0;
+    while (waitpid(pid, &status, 0) < 0 && errno == EINTR) {}
+
+    if (timedOut) {
+        *error = "timed out after " + std::to_string(timeoutMs) + " ms";
+        return false;
+    }
+    if (!WIFEXITED(status) || WEXITSTATUS(status) != 0) {
+        stderrText.erase(stderrText.find_last_not_of(" \t\r\n") + 1);
+        *error = WIFEXITED(status) ? "command exited with status " + std::to_string(WEXITSTATUS(status))
+                                   : "command killed by signal " + std::to_string(WTERMSIG(status));
+        if (!stderrText.empty()) *error += ": " + stderrText;
+        return false;
+    }
+    return true;
+}
+#endif
+
+bool RpcEndpoints::addCommand(const std::string& spec, std::string* error) {
+    auto eq = spec.find('=');
+    if (eq == std::string::npos || eq == 0 || eq + 1 == spec.size()) {
+        *error = "expected name=command, got '" + spec + "'";
+        return false;
+    }
+    std::string name = spec.substr(0, eq);
+    std::string command = spec.substr(eq + 1);
+    int timeoutMs = DefaultTimeoutMs;
+    if (auto at = name.find('@'); at != std::string::npos) {
+        std::string ms = name.substr(at + 1);
+        name = name.substr(0, at);
+        bool digits = !ms.empty() && ms.size() < 10 && std::all_of(ms.begin(), ms.end(), ::isdigit);
+        timeoutMs = digits ? std::stoi(ms) : 0;
+        if (timeoutMs <= 0) {
+            *error = "invalid timeout '" + ms + "' for endpoint " + name;
+            return false;
+        }
+    }
+#ifdef _WIN32
+    *error = "command endpoints are not supported on Windows";
+    return false;
+#else
+    add(name, [command](const std::string& request, int ms, std::string* response, std::string* err) {
+        return runCommand(command, request, ms, response, err);
+    }, timeoutMs);
+    return true;
+#endif
+}
+
+// Payloads cross as JSON through the json module, so they follow the same
+// rules as json.stringify and json.parse.
+static ObjectPtr jsonCall(const char* fn, ObjectPtr arg) {
+    return Registry::instance().get("json")->functions.at(fn)({arg});
+}
+
+void initRpcModule() {
+    std::unordered_map<std::string, NativeFunc> funcs;
+
+    // call(endpoint, payload?, timeout_ms?) -> the endpoint's JSON response, parsed
+    funcs["call"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.empty() || args.size() > 3) return makeError("call: expected 1-3 arguments");
+        auto name = std::dynamic_pointer_cast<String>(args[0]);
+        if (!name) return makeError("call: endpoint must be a string");
+        int timeoutMs = 0;
+        if (args.size() == 3) {
+            auto t = std::dynamic_pointer_cast<Integer>(args[2]);
+            if (!t || t->value <= 0 || t->value > INT32_MAX) return makeError("call: timeout_ms must be a positive integer");
+            timeoutMs = static_cast<int>(t->value);
+        }
+        auto request = jsonCall("stringify", args.size() >= 2 ? args[1] : getNull());
+        if (request->type() != ObjectType::STRING) return request;
+        std::string response, error;
+        if (!RpcEndpoints::instance().call(name->value, std::static_pointer_cast<String>(request)->value, timeoutMs,
+                                           &response, &error))
+            return makeError("call: " + name->value + ": " + error);
+        if (response.find_first_not_of(" \t\r\n") == std::string::npos) return getNull();
+        auto result = jsonCall("parse", newString(response));
+        if (result->type() == ObjectType::ERROR)
+            return makeError("call: " + name->value + ": invalid JSON response: " + result->inspect());
+        return result;
+    };
+
+    // endpoints() -> names of the registered endpoints
+    funcs["endpoints"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (!args.empty()) return makeError("endpoints: expected 0 arguments");
+        std::vector<ObjectPtr> names;
+        for (auto& n : RpcEndpoints::instance().names()) names.push_back(newString(n));
+        return newArray(std::move(names));
+    };
+
+    Registry::instance().registerModule("rpc", funcs, "Calls to host endpoints", {
+        {"call", {"(endpoint, payload?, timeout_ms?)", "Call a host endpoint with a JSON payload -> parsed response"}},
+        {"endpoints", {"()", "Names of the registered endpoints"}},
+    });
+}
+
+} // namespace darix::native
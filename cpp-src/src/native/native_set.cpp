@@ -292,7 +292,31 @@ void initSetModule() {
         return newArray(result);
     };
 
-    Registry::instance().registerModule("set", funcs);
+    Registry::instance().registerModule("set", funcs, "Set Operations", {
+        {"from_array", {"(arr)", "Create set from array"}},
+        {"to_array", {"(s)", "Convert to array"}},
+        {"size", {"(s)", "Number of elements"}},
+        {"is_empty", {"(s)", "Check if empty"}},
+        {"contains", {"(s, elem)", "Check membership"}},
+        {"add", {"(s, elem)", "Add element"}},
+        {"remove", {"(s, elem)", "Remove element"}},
+        {"union", {"(a, b)", "All elements from both"}},
+        {"intersection", {"(a, b)", "Common elements"}},
+        {"difference", {"(a, b)", "Elements in a not in b"}},
+        {"symmetric_difference", {"(a, b)", "Elements in either but not both"}},
+        {"is_subset", {"(a, b)", "Check subset"}},
+        {"is_superset", {"(a, b)", "Check superset"}},
+        {"is_disjoint", {"(a, b)", "Check no common elements"}},
+        {"power", {"(s)", "Power set"}},
+        {"cartesian", {"(a, b)", "Cartesian product"}},
+        {"fold", {"(s, fn, init)", "Reduce"}},
+        {"map_set", {"(s, fn)", "Transform elements"}},
+        {"filter_set", {"(s, fn)", "Filter elements"}},
+        {"min", {"(s)", "Minimum element"}},
+        {"max", {"(s)", "Maximum element"}},
+        {"sorted", {"(s)", "Sorted array"}},
+        {"equals", {"(a, b)", "Set equality"}},
+    });
 }
 
 } // namespace darix::native
@@ -257,7 +257,31 @@ void initStackModule() {
         return maxElem;
     };
 
-    Registry::instance().registerModule("stack", funcs);
+    Registry::instance().registerModule("stack", funcs, "LIFO Stack", {
+        {"new", {"()", "Create empty stack"}},
+        {"from_array", {"(arr)", "Create from array (last element on top)"}},
+        {"to_array", {"(s)", "Convert to array"}},
+        {"push", {"(s, elem)", "Push element"}},
+        {"pop", {"(s)", "Pop top -> [top, rest]"}},
+        {"peek", {"(s)", "View top element"}},
+        {"peek_bottom", {"(s)", "View bottom element"}},
+        {"size", {"(s)", "Number of elements"}},
+        {"is_empty", {"(s)", "Check if empty"}},
+        {"contains", {"(s, elem)", "Check membership"}},
+        {"push_many", {"(s, arr)", "Push all elements"}},
+        {"pop_n", {"(s, n)", "Pop n elements -> [popped, rest]"}},
+        {"peek_n", {"(s, n)", "View top n elements"}},
+        {"merge", {"(a, b)", "Combine stacks"}},
+        {"filter", {"(s, fn)", "Filter elements"}},
+        {"map_stack", {"(s, fn)", "Transform elements"}},
+        {"reverse", {"(s)", "Reverse order"}},
+        {"unique", {"(s)", "Remove duplicates"}},
+        {"flatten", {"(s)", "Flatten one level"}},
+        {"min", {"(s)", "Minimum element"}},
+        {"max", {"(s)", "Maximum element"}},
+        {"index_of", {"(s, elem)", "Find index"}},
+        {"clear", {"(s)", "Empty the stack"}},
+    });
 }
 
 } // namespace darix::native
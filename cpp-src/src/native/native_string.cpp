@@ -1,4 +1,5 @@
 #include "darix/native/native.hpp"
+#include "darix/native/unicode.hpp"
 #include <algorithm>
 #include <cctype>
 #include <sstream>
@@ -16,6 +17,67 @@ static bool isString(ObjectPtr obj) {
 
 static ObjectPtr makeError(const std::string& msg) { return newError("%s", msg.c_str()); }
 
+// Simple case folding for Latin, Greek and Cyrillic; other scripts have no case.
+static void appendFolded(std::string& out, uint32_t cp) {
+    if (cp == 0xDF) {
+        out += "ss";
+        return;
+    }
+    if ((cp >= 'A' && cp <= 'Z') || (cp >= 0xC0 && cp <= 0xDE && cp != 0xD7)) cp += 0x20;
+    else if ((cp >= 0x100 && cp <= 0x137) || (cp >= 0x14A && cp <= 0x177)) cp |= 1;
+    else if ((cp >= 0x139 && cp <= 0x148) || (cp >= 0x179 && cp <= 0x17E)) cp += cp & 1;
+    else if (cp == 0x178) cp = 0xFF;
+    else if (cp >= 0x391 && cp <= 0x3A9 && cp != 0x3A2) cp += 0x20;
+    else if (cp == 0x3C2) cp = 0x3C3;
+    else if (cp >= 0x400 && cp <= 0x40F) cp += 0x50;
+    else if (cp >= 0x410 && cp <= 0x42F) cp += 0x20;
+    appendCodepoint(out, cp);
+}
+
+static std::string casefold(const std::string& s) {
+    std::string out;
+    out.reserve(s.size());
+    for (size_t i = 0; i < s.size();) appendFolded(out, nextCodepoint(s, i));
+    return out;
+}
+
+// The Persian alphabet in dictionary order. Arabic forms of the same letter
+// share its place: kaf and yeh, alef and waw with hamza, teh marbuta.
+static const std::vector<std::vector<uint32_t>> PersianLetters = {
+    {0x621}, {0x622}, {0x627, 0x623, 0x625, 0x671}, {0x628}, {0x67E}, {0x62A}, {0x62B}, {0x62C}, {0x686},
+    {0x62D}, {0x62E}, {0x62F}, {0x630}, {0x631}, {0x632}, {0x698}, {0x633}, {0x634}, {0x635}, {0x636},
+    {0x637}, {0x638}, {0x639}, {0x63A}, {0x641}, {0x642}, {0x6A9, 0x643}, {0x6AF}, {0x644}, {0x645},
+    {0x646}, {0x648, 0x624}, {0x647, 0x629, 0x6C0}, {0x6CC, 0x64A, 0x649, 0x626},
+};
+
+// A string whose byte order is the collation order of s in locale: letters
+// compare case-insensitively first, then the original text breaks ties so
+// the order is total. "fa" also sorts Persian letters in dictionary order,
+// reads Persian and Arabic-Indic digits as digits and ignores diacritics
+// and the zero-width non-joiner.
+static bool sortKey(const std::string& s, const std::string& locale, std::string& key) {
+    if (!locale.empty() && locale != "en" && locale != "fa") return false;
+    static const std::unordered_map<uint32_t, uint32_t> persian = [] {
+        std::unordered_map<uint32_t, uint32_t> weights;
+        for (size_t i = 0; i < PersianLetters.size(); i++)
+            for (uint32_t cp : PersianLetters[i]) weights[cp] = 0xE000 + static_cast<uint32_t>(i);
+        return weights;
+    }();
+    for (size_t i = 0; i < s.size();) {
+        uint32_t cp = nextCodepoint(s, i);
+        if (locale == "fa") {
+            if (cp == 0x200C || (cp >= 0x64B && cp <= 0x652)) continue;
+            if (cp >= 0x6F0 && cp <= 0x6F9) cp = '0' + (cp - 0x6F0);
+            else if (cp >= 0x660 && cp <= 0x669) cp = '0' + (cp - 0x660);
+            else if (auto it = persian.find(cp); it != persian.end()) cp = it->second;
+        }
+        appendFolded(key, cp);
+    }
+    key += '\x01';
+    key += s;
+    return true;
+}
+
 void initStringModule() {
     std::unordered_map<std::string, NativeFunc> funcs;
 
@@ -93,6 +155,7 @@ void initStringModule() {
         for (size_t i = 0; i < arr->elements.size(); i++) {
             if (i > 0) result += sep;
             result += arr->elements[i]->inspect();
+            if (auto err = stringSizeError(result.size())) return err;
         }
         return newString(result);
     };
@@ -109,6 +172,7 @@ void initStringModule() {
         while ((pos = s.find(old, pos)) != std::string::npos) {
             s.replace(pos, old.size(), rep);
             pos += rep.size();
+            if (auto err = stringSizeError(s.size())) return err;
         }
         return newString(s);
     };
@@ -158,8 +222,10 @@ void initStringModule() {
         if (!count) return makeError("str_repeat: second argument must be integer");
         if (count->value < 0) return makeError("str_repeat: count cannot be negative");
         std::string s = getString(args[0]);
+        size_t size = s.empty() ? 0 : static_cast<uint64_t>(count->value) > SIZE_MAX / s.size() ? SIZE_MAX : s.size() * count->value;
+        if (auto err = stringSizeError(size)) return err;
         std::string result;
-        result.reserve(s.size() * count->value);
+        result.reserve(size);
         for (int64_t i = 0; i < count->value; i++) result += s;
         return newString(result);
     };
@@ -209,6 +275,7 @@ void initStringModule() {
         char pad = ' ';
         if (args.size() == 3 && isString(args[2])) pad = getString(args[2])[0];
         if (static_cast<int64_t>(s.size()) >= width->value) return newString(s);
+        if (auto err = stringSizeError(width->value)) return err;
         return newString(std::string(width->value - s.size(), pad) + s);
     };
 
@@ -222,6 +289,7 @@ void initStringModule() {
         char pad = ' ';
         if (args.size() == 3 && isString(args[2])) pad = getString(args[2])[0];
         if (static_cast<int64_t>(s.size()) >= width->value) return newString(s);
+        if (auto err = stringSizeError(width->value)) return err;
         return newString(s + std::string(width->value - s.size(), pad));
     };
 
@@ -347,6 +415,7 @@ void initStringModule() {
         if (args.size() == 3 && isString(args[2])) pad = getString(args[2])[0];
         int64_t totalPad = width->value - static_cast<int64_t>(s.size());
         if (totalPad <= 0) return newString(s);
+        if (auto err = stringSizeError(width->value)) return err;
         int64_t leftPad = totalPad / 2;
         int64_t rightPad = totalPad - leftPad;
         return newString(std::string(leftPad, pad) + s + std::string(rightPad, pad));
@@ -406,7 +475,129 @@ void initStringModule() {
         return newBoolean(end != s.c_str() && *end == '\0');
     };
 
-    Registry::instance().registerModule("string", funcs);
+    // casefold(str) -> str with case differences removed, for caseless matching
+    funcs["casefold"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("casefold: expected 1 argument");
+        if (!isString(args[0])) return makeError("casefold: argument must be string");
+        return newString(casefold(getString(args[0])));
+    };
+
+    // compare(a, b, ignore_case?) -> -1, 0 or 1 by code point
+    funcs["compare"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() < 2 || args.size() > 3) return makeError("compare: expected 2-3 arguments");
+        if (!isString(args[0]) || !isString(args[1])) return makeError("compare: arguments must be strings");
+        std::string a = getString(args[0]), b = getString(args[1]);
+        if (args.size() == 3 && isTruthy(args[2])) {
+            a = casefold(a);
+            b = casefold(b);
+        }
+        int c = a.compare(b);
+        return newInteger((c > 0) - (c < 0));
+    };
+
+    // sort_key(str, locale?) -> str that sorts in locale's collation order
+    funcs["sort_key"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() < 1 || args.size() > 2) return makeError("sort_key: expected 1-2 arguments");
+        if (!isString(args[0]) || (args.size() == 2 && !isString(args[1])))
+            return makeError("sort_key: arguments must be strings");
+        std::string locale = args.size() == 2 ? getString(args[1]) : "", key;
+        if (!sortKey(getString(args[0]), locale, key))
+            return makeError("sort_key: unsupported locale '" + locale + "' (supported: en, fa)");
+        return newString(key);
+    };
+
+    // sort(arr, locale?) -> new array of the strings in locale's collation order
+    funcs["sort"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() < 1 || args.size() > 2) return makeError("sort: expected 1-2 arguments");
+        auto arr = std::dynamic_pointer_cast<Array>(args[0]);
+        if (!arr) return makeError("sort: first argument must be an array");
+        if (args.size() == 2 && !isString(args[1])) return makeError("sort: locale must be a string");
+        std::string locale = args.size() == 2 ? getString(args[1]) : "";
+        std::vector<std::pair<std::string, ObjectPtr>> keyed;
+        for (auto& elem : arr->elements) {
+            if (!isString(elem)) return makeError("sort: array elements must be strings");
+            std::string key;
+            if (!sortKey(getString(elem), locale, key))
+                return makeError("sort: unsupported locale '" + locale + "' (supported: en, fa)");
+            keyed.push_back({std::move(key), elem});
+        }
+        std::stable_sort(keyed.begin(), keyed.end(), [](const auto& a, const auto& b) { return a.first < b.first; });
+        std::vector<ObjectPtr> out;
+        for (auto& [key, elem] : keyed) out.push_back(elem);
+        return newArray(out);
+    };
+
+    // normalize(str, form?) -> str in Unicode normal form "NFC" (default) or "NFD"
+    funcs["normalize"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() < 1 || args.size() > 2) return makeError("normalize: expected 1-2 arguments");
+        if (!isString(args[0]) || (args.size() == 2 && !isString(args[1])))
+            return makeError("normalize: arguments must be strings");
+        std::string form = args.size() == 2 ? getString(args[1]) : "NFC";
+        if (form != "NFC" && form != "NFD") return makeError("normalize: form must be \"NFC\" or \"NFD\"");
+        return newString(normalizeUnicode(getString(args[0]), form == "NFC"));
+    };
+
+    // grapheme_len(str) -> number of user-perceived characters
+    funcs["grapheme_len"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("grapheme_len: expected 1 argument");
+        if (!isString(args[0])) return makeError("grapheme_len: argument must be string");
+        return newInteger(static_cast<int64_t>(graphemes(getString(args[0])).size()));
+    };
+
+    // graphemes(str) -> array of user-perceived characters
+    funcs["graphemes"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("graphemes: expected 1 argument");
+        if (!isString(args[0])) return makeError("graphemes: argument must be string");
+        std::vector<ObjectPtr> out;
+        for (auto& g : graphemes(getString(args[0]))) out.push_back(newString(g));
+        return newArray(out);
+    };
+
+    Registry::instance().registerModule("string", funcs, "String Manipulation", {
+        {"upper", {"(s)", "Uppercase"}},
+        {"lower", {"(s)", "Lowercase"}},
+        {"trim", {"(s)", "Trim whitespace"}},
+        {"trim_left", {"(s, chars)", "Trim left characters"}},
+        {"trim_right", {"(s, chars)", "Trim right characters"}},
+        {"split", {"(s, sep)", "Split by separator"}},
+        {"join", {"(arr, sep)", "Join array with separator"}},
+        {"replace", {"(s, old, new)", "Replace all occurrences"}},
+        {"contains", {"(s, sub)", "Check if substring exists"}},
+        {"starts", {"(s, prefix)", "Check prefix"}},
+        {"ends", {"(s, suffix)", "Check suffix"}},
+        {"index", {"(s, sub)", "Find first index (-1 if not found)"}},
+        {"last_index", {"(s, sub)", "Find last index"}},
+        {"repeat", {"(s, n)", "Repeat string n times"}},
+        {"reverse", {"(s)", "Reverse string"}},
+        {"is_alpha", {"(s)", "Check if all characters are letters"}},
+        {"is_digit", {"(s)", "Check if all characters are digits"}},
+        {"is_space", {"(s)", "Check if all characters are whitespace"}},
+        {"pad_left", {"(s, width, char?)", "Left-pad to width"}},
+        {"pad_right", {"(s, width, char?)", "Right-pad to width"}},
+        {"slice", {"(s, start, end?)", "Substring"}},
+        {"count", {"(s, sub)", "Count occurrences"}},
+        {"char_at", {"(s, index)", "Character at index"}},
+        {"to_title", {"(s)", "Title Case"}},
+        {"chars", {"(s)", "Array of characters"}},
+        {"words", {"(s)", "Split by whitespace"}},
+        {"lines", {"(s)", "Split by newline"}},
+        {"truncate", {"(s, max, suffix?)", "Truncate with suffix"}},
+        {"center", {"(s, width, char?)", "Center-align"}},
+        {"replace_first", {"(s, old, new)", "Replace first occurrence"}},
+        {"is_empty", {"(s)", "Check if empty"}},
+        {"starts_with", {"(s, prefix)", "Alias for starts"}},
+        {"ends_with", {"(s, suffix)", "Alias for ends"}},
+        {"to_int", {"(s)", "Convert to integer"}},
+        {"to_float", {"(s)", "Convert to float"}},
+        {"is_number", {"(s)", "Check if numeric"}},
+        {"casefold", {"(s)", "Fold case for caseless matching"}},
+        {"compare", {"(a, b, ignore_case?)", "Compare: -1, 0 or 1"}},
+        {"sort_key", {"(s, locale?)", "Key that sorts in locale order (en, fa)"}},
+        {"sort", {"(arr, locale?)", "Sort strings in locale order (en, fa)"}},
+        {"normalize", {"(s, form?)", "Unicode normal form, NFC (default) or NFD"}},
+        {"grapheme_len", {"(s)", "Number of user-perceived characters"}},
+        {"graphemes", {"(s)", "Array of user-perceived characters"}},
+    });
 }
 
 } // namespace darix::native
@@ -0,0 +1,180 @@
+#include "darix/native/native.hpp"
+#include <chrono>
+#include <thread>
+
+namespace darix::native {
+
+using Clock = std::chrono::steady_clock;
+
+static ObjectPtr makeError(const std::string& msg) { return newError("%s", msg.c_str()); }
+
+static int64_t getInt(ObjectPtr obj) {
+    if (auto i = std::dynamic_pointer_cast<Integer>(obj)) return i->value;
+    if (auto f = std::dynamic_pointer_cast<Float>(obj)) return static_cast<int64_t>(f->value);
+    return 0;
+}
+
+static bool isCallable(ObjectPtr obj) {
+    if (!obj) return false;
+    auto t = obj->type();
+    return t == ObjectType::FUNCTION || t == ObjectType::BUILTIN || t == ObjectType::BOUND_METHOD;
+}
+
+static bool isFailure(ObjectPtr obj) {
+    return obj && (obj->type() == ObjectType::ERROR || obj->type() == ObjectType::EXCEPTION_SIGNAL);
+}
+
+// Timers are kept on the interpreter thread: callbacks only ever run from
+// run()/sleep() or when the interpreter drains the loop after the program.
+struct Timer {
+    int64_t id = 0;
+    ObjectPtr fn;
+    std::vector<ObjectPtr> args;
+    Clock::time_point due;
+    int64_t intervalMs = 0;
+    bool repeat = false;
+};
+
+static std::vector<Timer>& getTimers() {
+    static std::vector<Timer> timers;
+    return timers;
+}
+
+static int64_t nextTimerId() {
+    static int64_t next = 1;
+    return next++;
+}
+
+// Index of the timer that fires next (earliest due, then lowest id), or -1.
+static int nextDue() {
+    auto& timers = getTimers();
+    int best = -1;
+    for (size_t i = 0; i < timers.size(); i++) {
+        if (best == -1 || timers[i].due < timers[best].due ||
+            (timers[i].due == timers[best].due && timers[i].id < timers[best].id))
+            best = static_cast<int>(i);
+    }
+    return best;
+}
+
+// Fires every timer due at or before deadline, sleeping in between.
+// Returns the first error/exception raised by a callback, or nullptr.
+static ObjectPtr runUntil(Clock::time_point deadline, bool untilEmpty, int64_t* fired) {
+    for (;;) {
+        int idx = nextDue();
+        if (idx == -1) return nullptr;
+        auto& timers = getTimers();
+        if (!untilEmpty && timers[idx].due > deadline) return nullptr;
+
+        std::this_thread::sleep_until(timers[idx].due);
+
+        // Copy out before calling: the callback may add or cancel timers.
+        Timer t = timers[idx];
+        if (t.repeat) timers[idx].due += std::chrono::milliseconds(t.intervalMs);
+        else timers.erase(timers.begin() + idx);
+
+        auto result = callCallable(t.fn, t.args);
+        if (fired) (*fired)++;
+        if (isFailure(result)) return result;
+    }
+}
+
+static ObjectPtr schedule(const std::string& name, const std::vector<ObjectPtr>& args, bool repeat) {
+    if (args.size() < 2) return makeError(name + ": expected at least 2 arguments");
+    if (!isCallable(args[0])) return makeError(name + ": first argument must be a function");
+    int64_t ms = getInt(args[1]);
+    if (ms < 0) return makeError(name + ": delay must be non-negative");
+    if (repeat && ms == 0) return makeError(name + ": interval must be positive");
+
+    Timer t;
+    t.id = nextTimerId();
+    t.fn = args[0];
+    t.args.assign(args.begin() + 2, args.end());
+    t.due = Clock::now() + std::chrono::milliseconds(ms);
+    t.intervalMs = ms;
+    t.repeat = repeat;
+    getTimers().push_back(t);
+    return newInteger(t.id);
+}
+
+int64_t scheduleInterval(ObjectPtr fn, int64_t intervalMs) {
+    Timer t;
+    t.id = nextTimerId();
+    t.fn = std::move(fn);
+    t.due = Clock::now() + std::chrono::milliseconds(intervalMs);
+    t.intervalMs = intervalMs;
+    t.repeat = true;
+    getTimers().push_back(t);
+    return t.id;
+}
+
+bool cancelTimer(int64_t id) {
+    auto& timers = getTimers();
+    for (auto it = timers.begin(); it != timers.end(); ++it) {
+        if (it->id == id) {
+            timers.erase(it);
+            return true;
+        }
+    }
+    return false;
+}
+
+ObjectPtr runEventLoop() {
+    if (getTimers().empty()) return nullptr;
+    return runUntil(Clock::now(), true, nullptr);
+}
+
+void initTimerModule() {
+    std::unordered_map<std::string, NativeFunc> funcs;
+
+    // set_timeout(fn, ms, args...) -> timer id
+    funcs["set_timeout"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        return schedule("set_timeout", args, false);
+    };
+
+    // set_interval(fn, ms, args...) -> timer id
+    funcs["set_interval"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        return schedule("set_interval", args, true);
+    };
+
+    // cancel(id) -> true if a pending timer was removed
+    funcs["cancel"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("cancel: expected 1 argument");
+        return newBoolean(cancelTimer(getInt(args[0])));
+    };
+
+    // sleep(ms) -> null, firing any timers that come due meanwhile
+    funcs["sleep"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("sleep: expected 1 argument");
+        int64_t ms = getInt(args[0]);
+        if (ms < 0) return makeError("sleep: duration must be non-negative");
+        auto deadline = Clock::now() + std::chrono::milliseconds(ms);
+        if (auto err = runUntil(deadline, false, nullptr)) return err;
+        std::this_thread::sleep_until(deadline);
+        return getNull();
+    };
+
+    // run() -> number of callbacks fired; blocks until no timers remain
+    funcs["run"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (!args.empty()) return makeError("run: expected 0 arguments");
+        int64_t fired = 0;
+        if (auto err = runUntil(Clock::now(), true, &fired)) return err;
+        return newInteger(fired);
+    };
+
+    // pending() -> number of scheduled timers
+    funcs["pending"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        return newInteger(static_cast<int64_t>(getTimers().size()));
+    };
+
+    Registry::instance().registerModule("timer", funcs, "Timers and Event Loop", {
+        {"set_timeout", {"(fn, ms, args...)", "Call fn(args...) once after ms milliseconds; returns timer id"}},
+        {"set_interval", {"(fn, ms, args...)", "Call fn(args...) every ms milliseconds; returns timer id"}},
+        {"cancel", {"(id)", "Cancel a pending timer (true if it was pending)"}},
+        {"sleep", {"(ms)", "Sleep, firing timers that come due meanwhile"}},
+        {"run", {"()", "Run timers until none remain; returns number of callbacks fired"}},
+        {"pending", {"()", "Number of scheduled timers"}},
+    });
+}
+
+} // namespace darix::native
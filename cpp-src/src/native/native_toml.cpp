@@ -0,0 +1,562 @@
+#include "darix/native/native.hpp"
+#include <cctype>
+#include <cmath>
+#include <cstdio>
+#include <cstring>
+#include <fstream>
+#include <sstream>
+
+namespace darix::native {
+
+static ObjectPtr makeError(const std::string& msg) { return newError("%s", msg.c_str()); }
+
+static std::string getString(ObjectPtr obj) {
+    if (auto s = std::dynamic_pointer_cast<String>(obj)) return s->value;
+    return "";
+}
+
+// ============ Parsing ============
+//
+// Implements TOML 1.0 except that dates and times are returned as strings.
+
+struct TomlParseError {
+    std::string message;
+};
+
+// A table or array grew past the policy's size limits; error is the
+// ResourceError to raise.
+struct TomlTooLarge {
+    ObjectPtr error;
+};
+
+static void checkSize(ObjectPtr error) {
+    if (error) throw TomlTooLarge{error};
+}
+
+static ObjectPtr* findKey(const std::shared_ptr<Map>& m, const std::string& key) {
+    for (auto& [k, v] : m->pairs) {
+        if (getString(k) == key) return &v;
+    }
+    return nullptr;
+}
+
+static bool isBareKeyChar(char c) {
+    return std::isalnum(static_cast<unsigned char>(c)) || c == '_' || c == '-';
+}
+
+static void appendUtf8(std::string& out, uint32_t cp) {
+    if (cp < 0x80) out += static_cast<char>(cp);
+    else if (cp < 0x800) {
+        out += static_cast<char>(0xC0 | (cp >> 6));
+        out += static_cast<char>(0x80 | (cp & 0x3F));
+    } else if (cp < 0x10000) {
+        out += static_cast<char>(0xE0 | (cp >> 12));
+        out += static_cast<char>(0x80 | ((cp >> 6) & 0x3F));
+        out += static_cast<char>(0x80 | (cp & 0x3F));
+    } else {
+        out += static_cast<char>(0xF0 | (cp >> 18));
+        out += static_cast<char>(0x80 | ((cp >> 12) & 0x3F));
+        out += static_cast<char>(0x80 | ((cp >> 6) & 0x3F));
+        out += static_cast<char>(0x80 | (cp & 0x3F));
+    }
+}
+
+class TomlParser {
+public:
+    explicit TomlParser(const std::string& src) : src_(src) {}
+
+    ObjectPtr parse() {
+        auto root = std::dynamic_pointer_cast<Map>(newMap({}));
+        auto current = root;
+        for (;;) {
+            skipWhitespaceAndComments(true);
+            if (pos_ >= src_.size()) break;
+            if (src_[pos_] == '[') {
+                bool arrayTable = pos_ + 1 < src_.size() && src_[pos_ + 1] == '[';
+                pos_ += arrayTable ? 2 : 1;
+                auto path = parseKey();
+                skipSpaces();
+                if (!consume(']') || (arrayTable && !consume(']'))) fail("expected ']' after table name");
+                current = arrayTable ? openArrayTable(root, path) : openTable(root, path);
+            } else {
+                auto path = parseKey();
+                skipSpaces();
+                if (!consume('=')) fail("expected '=' after key");
+                skipSpaces();
+                auto value = parseValue();
+                assign(current, path, value);
+            }
+            skipSpaces();
+            if (pos_ < src_.size() && src_[pos_] == '#') skipComment();
+            if (pos_ < src_.size() && !consumeNewline()) fail("expected newline after value");
+        }
+        return root;
+    }
+
+private:
+    const std::string& src_;
+    size_t pos_ = 0;
+
+    [[noreturn]] void fail(const std::string& msg) {
+        int line = 1;
+        for (size_t i = 0; i < pos_ && i < src_.size(); i++) if (src_[i] == '\n') line++;
+        throw TomlParseError{msg + " on line " + std::to_string(line)};
+    }
+
+    bool consume(char c) {
+        if (pos_ < src_.size() && src_[pos_] == c) { pos_++; return true; }
+        return false;
+    }
+
+    bool startsWith(const char* s) const { return src_.compare(pos_, std::strlen(s), s) == 0; }
+
+    void skipSpaces() {
+        while (pos_ < src_.size() && (src_[pos_] == ' ' || src_[pos_] == '\t')) pos_++;
+    }
+
+    void skipComment() {
+        while (pos_ < src_.size() && src_[pos_] != '\n') pos_++;
+    }
+
+    bool consumeNewline() {
+        if (startsWith("\r\n")) { pos_ += 2; return true; }
+        return consume('\n');
+    }
+
+    void skipWhitespaceAndComments(bool newlines) {
+        for (;;) {
+            skipSpaces();
+            if (pos_ < src_.size() && src_[pos_] == '#') skipComment();
+            if (!newlines || !consumeNewline()) return;
+        }
+    }
+
+    // key, "quoted key", or dotted.key.path
+    std::vector<std::string> parseKey() {
+        std::vector<std::string> path;
+        for (;;) {
+            skipSpaces();
+            if (pos_ >= src_.size()) fail("expected a key");
+            char c = src_[pos_];
+            if (c == '"') path.push_back(parseBasicString());
+            else if (c == '\'') path.push_back(parseLiteralString());
+            else {
+                size_t start = pos_;
+                while (pos_ < src_.size() && isBareKeyChar(src_[pos_])) pos_++;
+                if (start == pos_) fail("invalid key");
+                path.push_back(src_.substr(start, pos_ - start));
+            }
+            skipSpaces();
+            if (!consume('.')) return path;
+        }
+    }
+
+    std::shared_ptr<Map> descend(std::shared_ptr<Map> table, const std::string& key) {
+        auto slot = findKey(table, key);
+        if (!slot) {
+            auto child = std::dynamic_pointer_cast<Map>(newMap({}));
+            table->pairs.push_back({newString(key), child});
+            checkSize(mapSizeError(table->pairs.size()));
+            return child;
+        }
+        if (auto m = std::dynamic_pointer_cast<Map>(*slot)) return m;
+        if (auto a = std::dynamic_pointer_cast<Array>(*slot); a && !a->elements.empty()) {
+            if (auto m = std::dynamic_pointer_cast<Map>(a->elements.back())) return m;
+        }
+        fail("key '" + key + "' is not a table");
+    }
+
+    std::shared_ptr<Map> openTable(std::shared_ptr<Map> root, const std::vector<std::string>& path) {
+        auto table = root;
+        for (auto& key : path) table = descend(table, key);
+        return table;
+    }
+
+    std::shared_ptr<Map> openArrayTable(std::shared_ptr<Map> root, const std::vector<std::string>& path) {
+        auto table = root;
+        for (size_t i = 0; i + 1 < path.size(); i++) table = descend(table, path[i]);
+        auto entry = std::dynamic_pointer_cast<Map>(newMap({}));
+        auto slot = findKey(table, path.back());
+        if (!slot) {
+            table->pairs.push_back({newString(path.back()), newArray({entry})});
+            checkSize(mapSizeError(table->pairs.size()));
+        } else if (auto a = std::dynamic_pointer_cast<Array>(*slot)) {
+            a->elements.push_back(entry);
+            checkSize(arraySizeError(a->elements.size()));
+        } else {
+            fail("key '" + path.back() + "' is not an array of tables");
+        }
+        return entry;
+    }
+
+    void assign(std::shared_ptr<Map> table, const std::vector<std::string>& path, ObjectPtr value) {
+        for (size_t i = 0; i + 1 < path.size(); i++) table = descend(table, path[i]);
+        if (findKey(table, path.back())) fail("duplicate key '" + path.back() + "'");
+        table->pairs.push_back({newString(path.back()), value});
+        checkSize(mapSizeError(table->pairs.size()));
+    }
+
+    ObjectPtr parseValue() {
+        if (pos_ >= src_.size()) fail("expected a value");
+        char c = src_[pos_];
+        if (startsWith("\"\"\"")) return newString(parseMultilineBasicString());
+        if (startsWith("'''")) return newString(parseMultilineLiteralString());
+        if (c == '"') return newString(parseBasicString());
+        if (c == '\'') return newString(parseLiteralString());
+        if (c == '[') return parseArray();
+        if (c == '{') return parseInlineTable();
+        if (startsWith("true")) { pos_ += 4; return getTrue(); }
+        if (startsWith("false")) { pos_ += 5; return getFalse(); }
+        return parseNumberOrDate();
+    }
+
+    uint32_t parseHex(int digits) {
+        uint32_t cp = 0;
+        for (int i = 0; i < digits; i++) {
+            if (pos_ >= src_.size() || !std::isxdigit(static_cast<unsigned char>(src_[pos_]))) fail("invalid unicode escape");
+            char h = src_[pos_++];
+            cp = cp * 16 + (std::isdigit(static_cast<unsigned char>(h)) ? h - '0' : std::tolower(h) - 'a' + 10);
+        }
+        return cp;
+    }
+
+    void parseEscape(std::string& out) {
+        if (pos_ >= src_.size()) fail("unterminated escape");
+        char e = src_[pos_++];
+        switch (e) {
+            case 'b': out += '\b'; break;
+            case 't': out += '\t'; break;
+            case 'n': out += '\n'; break;
+            case 'f': out += '\f'; break;
+            case 'r': out += '\r'; break;
+            case 'e': out += '\x1b'; break;
+            case '"': out += '"'; break;
+            case '\\': out += '\\'; break;
+            case 'u': appendUtf8(out, parseHex(4)); break;
+            case 'U': appendUtf8(out, parseHex(8)); break;
+            default: fail(std::string("invalid escape '\\") + e + "'");
+        }
+    }
+
+    std::string parseBasicString() {
+        pos_++; // opening quote
+        std::string out;
+        while (pos_ < src_.size() && src_[pos_] != '"') {
+            char c = src_[pos_];
+            if (c == '\n') fail("newline in string");
+            pos_++;
+            if (c == '\\') parseEscape(out);
+            else out += c;
+        }
+        if (!consume('"')) fail("unterminated string");
+        return out;
+    }
+
+    std::string parseLiteralString() {
+        pos_++;
+        size_t end = src_.find_first_of("'\n", pos_);
+        if (end == std::string::npos || src_[end] != '\'') fail("unterminated string");
+        std::string out = src_.substr(pos_, end - pos_);
+        pos_ = end + 1;
+        return out;
+    }
+
+    std::string parseMultilineBasicString() {
+        pos_ += 3;
+        consumeNewline(); // a newline right after the opening quotes is trimmed
+        std::string out;
+        for (;;) {
+            if (pos_ >= src_.size()) fail("unterminated string");
+            if (startsWith("\"\"\"")) {
+                pos_ += 3;
+                // Up to two quotes may sit directly before the closing delimiter
+                for (int i = 0; i < 2 && consume('"'); i++) out += '"';
+                return out;
+            }
+            char c = src_[pos_++];
+            if (c != '\\') { out += c; continue; }
+            // Line-ending backslash swallows the newline and following whitespace
+            size_t save = pos_;
+            skipSpaces();
+            if (pos_ < src_.size() && (src_[pos_] == '\n' || src_[pos_] == '\r')) {
+                while (pos_ < src_.size() && std::isspace(static_cast<unsigned char>(src_[pos_]))) pos_++;
+                continue;
+            }
+            pos_ = save;
+            parseEscape(out);
+        }
+    }
+
+    std::string parseMultilineLiteralString() {
+        pos_ += 3;
+        consumeNewline();
+        size_t end = src_.find("'''", pos_);
+        if (end == std::string::npos) fail("unterminated string");
+        while (end + 3 < src_.size() && src_[end + 3] == '\'') end++;
+        std::string out = src_.substr(pos_, end - pos_);
+        pos_ = end + 3;
+        return out;
+    }
+
+    ObjectPtr parseArray() {
+        pos_++;
+        std::vector<ObjectPtr> items;
+        for (;;) {
+            skipWhitespaceAndComments(true);
+            if (consume(']')) break;
+            items.push_back(parseValue());
+            checkSize(arraySizeError(items.size()));
+            skipWhitespaceAndComments(true);
+            if (consume(']')) break;
+            if (!consume(',')) fail("expected ',' or ']' in array");
+        }
+        return newArray(items);
+    }
+
+    ObjectPtr parseInlineTable() {
+        pos_++;
+        auto table = std::dynamic_pointer_cast<Map>(newMap({}));
+        skipSpaces();
+        if (consume('}')) return table;
+        for (;;) {
+            auto path = parseKey();
+            if (!consume('=')) fail("expected '=' in inline table");
+            skipSpaces();
+            assign(table, path, parseValue());
+            skipSpaces();
+            if (consume('}')) break;
+            if (!consume(',')) fail("expected ',' or '}' in inline table");
+        }
+        return table;
+    }
+
+    ObjectPtr parseNumberOrDate() {
+        size_t start = pos_;
+        while (pos_ < src_.size()) {
+            char c = src_[pos_];
+            if (std::isalnum(static_cast<unsigned char>(c)) || c == '+' || c == '-' || c == '_' || c == '.' || c == ':') {
+                pos_++;
+            } else if (c == ' ' && pos_ > start + 9 && src_[start + 4] == '-' && pos_ + 1 < src_.size() &&
+                       std::isdigit(static_cast<unsigned char>(src_[pos_ + 1]))) {
+                pos_++; // "1979-05-27 07:32:00" uses a space between date and time
+            } else {
+                break;
+            }
+        }
+        std::string tok = src_.substr(start, pos_ - start);
+        if (tok.empty()) fail("expected a value");
+
+        // Dates and times are kept as their literal text
+        bool isDate = tok.size() >= 10 && tok[4] == '-' && tok[7] == '-';
+        bool isTime = tok.size() >= 8 && tok[2] == ':';
+        if (isDate || isTime) return newString(tok);
+
+        std::string digits;
+        for (char c : tok) if (c != '_') digits += c;
+        std::string body = digits;
+        bool negative = false;
+        if (!body.empty() && (body[0] == '+' || body[0] == '-')) { negative = body[0] == '-'; body = body.substr(1); }
+        if (body == "inf") return newFloat(negative ? -INFINITY : INFINITY);
+        if (body == "nan") return newFloat(NAN);
+
+        try {
+            size_t used = 0;
+            int base = 0;
+            if (body.compare(0, 2, "0x") == 0) base = 16;
+            else if (body.compare(0, 2, "0o") == 0) base = 8;
+            else if (body.compare(0, 2, "0b") == 0) base = 2;
+            if (base != 0) {
+                int64_t v = std::stoll(body.substr(2), &used, base);
+                if (used == body.size() - 2) return newInteger(negative ? -v : v);
+            } else if (digits.find_first_of(".eE") != std::string::npos) {
+                double v = std::stod(digits, &used);
+                if (used == digits.size()) return newFloat(v);
+            } else {
+                int64_t v = std::stoll(digits, &used);
+                if (used == digits.size()) return newInteger(v);
+            }
+        } catch (...) {
+            // reported below
+        }
+        pos_ = start;
+        fail("invalid value '" + tok + "'");
+    }
+};
+
+// ============ Serialization ============
+
+static std::string quoteString(const std::string& s) {
+    std::string out = "\"";
+    for (char c : s) {
+        switch (c) {
+            case '"': out += "\\\""; break;
+            case '\\': out += "\\\\"; break;
+            case '\n': out += "\\n"; break;
+            case '\t': out += "\\t"; break;
+            case '\r': out += "\\r"; break;
+            case '\b': out += "\\b"; break;
+            case '\f': out += "\\f"; break;
+            default:
+                if (static_cast<unsigned char>(c) < 0x20) {
+                    char buf[8];
+                    std::snprintf(buf, sizeof(buf), "\\u%04x", c);
+                    out += buf;
+                } else {
+                    out += c;
+                }
+        }
+    }
+    return out + "\"";
+}
+
+static std::string formatKey(const std::string& key) {
+    if (key.empty()) return "\"\"";
+    for (char c : key) if (!isBareKeyChar(c)) return quoteString(key);
+    return key;
+}
+
+static bool isTable(const ObjectPtr& obj) { return obj->type() == ObjectType::MAP; }
+
+// Arrays whose elements are all maps are written as [[array.of.tables]]
+static bool isTableArray(const ObjectPtr& obj) {
+    auto a = std::dynamic_pointer_cast<Array>(obj);
+    if (!a || a->elements.empty()) return false;
+    for (auto& e : a->elements) if (!isTable(e)) return false;
+    return true;
+}
+
+static std::string inlineValue(const ObjectPtr& obj, int depth) {
+    if (depth > 100) throw TomlParseError{"value nested too deeply"};
+    switch (obj->type()) {
+        case ObjectType::STRING: return quoteString(getString(obj));
+        case ObjectType::BOOLEAN:
+        case ObjectType::INTEGER: return obj->inspect();
+        case ObjectType::FLOAT: {
+            double v = std::dynamic_pointer_cast<Float>(obj)->value;
+            if (std::isnan(v)) return "nan";
+            if (std::isinf(v)) return v > 0 ? "inf" : "-inf";
+            return formatFloat(v);
+        }
+        case ObjectType::ARRAY: {
+            auto a = std::dynamic_pointer_cast<Array>(obj);
+            std::string out = "[";
+            for (size_t i = 0; i < a->elements.size(); i++) {
+                if (i > 0) out += ", ";
+                out += inlineValue(a->elements[i], depth + 1);
+            }
+            return out + "]";
+        }
+        case ObjectType::MAP: {
+            auto m = std::dynamic_pointer_cast<Map>(obj);
+            std::string out = "{";
+            bool first = true;
+            for (auto& [k, v] : m->pairs) {
+                if (v->type() == ObjectType::NULL_OBJ) continue;
+                out += first ? " " : ", ";
+                first = false;
+                out += formatKey(k->inspect()) + " = " + inlineValue(v, depth + 1);
+            }
+            return out + (first ? "}" : " }");
+        }
+        case ObjectType::NULL_OBJ:
+            throw TomlParseError{"TOML has no null value"};
+        default:
+            return quoteString(obj->inspect());
+    }
+}
+
+static void emitTable(std::ostringstream& out, const std::shared_ptr<Map>& table, const std::string& prefix, int depth) {
+    if (depth > 100) throw TomlParseError{"value nested too deeply"};
+    // Plain key/values first: anything after a [header] belongs to that table.
+    for (auto& [k, v] : table->pairs) {
+        if (v->type() == ObjectType::NULL_OBJ || isTable(v) || isTableArray(v)) continue;
+        out << formatKey(k->inspect()) << " = " << inlineValue(v, depth) << "\n";
+    }
+    for (auto& [k, v] : table->pairs) {
+        std::string name = prefix.empty() ? formatKey(k->inspect()) : prefix + "." + formatKey(k->inspect());
+        if (auto m = std::dynamic_pointer_cast<Map>(v)) {
+            out << "\n[" << name << "]\n";
+            emitTable(out, m, name, depth + 1);
+        } else if (isTableArray(v)) {
+            for (auto& e : std::dynamic_pointer_cast<Array>(v)->elements) {
+                out << "\n[[" << name << "]]\n";
+                emitTable(out, std::dynamic_pointer_cast<Map>(e), name, depth + 1);
+            }
+        }
+    }
+}
+
+static ObjectPtr parseToml(const std::string& name, const std::string& src) {
+    try {
+        return TomlParser(src).parse();
+    } catch (const TomlParseError& e) {
+        return makeError(name + ": " + e.message);
+    } catch (const TomlTooLarge& e) {
+        return e.error;
+    }
+}
+
+static ObjectPtr stringifyToml(const std::string& name, const ObjectPtr& value, std::string& out) {
+    auto m = std::dynamic_pointer_cast<Map>(value);
+    if (!m) return makeError(name + ": top-level value must be a map");
+    try {
+        std::ostringstream ss;
+        emitTable(ss, m, "", 0);
+        out = ss.str();
+        if (!out.empty() && out[0] == '\n') out.erase(0, 1);
+        return nullptr;
+    } catch (const TomlParseError& e) {
+        return makeError(name + ": " + e.message);
+    }
+}
+
+void initTomlModule() {
+    std::unordered_map<std::string, NativeFunc> funcs;
+
+    // parse(text) -> map
+    funcs["parse"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("parse: expected 1 argument");
+        if (args[0]->type() != ObjectType::STRING) return makeError("parse: argument must be a string");
+        return parseToml("parse", getString(args[0]));
+    };
+
+    // stringify(map) -> TOML text; null values are omitted
+    funcs["stringify"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("stringify: expected 1 argument");
+        std::string out;
+        if (auto err = stringifyToml("stringify", args[0], out)) return err;
+        return newString(out);
+    };
+
+    // read(path) -> parsed file contents
+    funcs["read"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("read: expected 1 argument");
+        std::string path = getString(args[0]);
+        std::ifstream file(path);
+        if (!file.is_open()) return makeError("read: cannot open file '" + path + "'");
+        std::stringstream buffer;
+        buffer << file.rdbuf();
+        return parseToml("read", buffer.str());
+    };
+
+    // write(path, map) -> bool
+    funcs["write"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 2) return makeError("write: expected 2 arguments");
+        std::string out;
+        if (auto err = stringifyToml("write", args[1], out)) return err;
+        std::string path = getString(args[0]);
+        std::ofstream file(path);
+        if (!file.is_open()) return makeError("write: cannot open file '" + path + "'");
+        file << out;
+        return newBoolean(file.good());
+    };
+
+    Registry::instance().registerModule("toml", funcs, "TOML Config Files", {
+        {"parse", {"(text)", "Parse TOML text into a map"}},
+        {"stringify", {"(map)", "Format a map as TOML"}},
+        {"read", {"(path)", "Parse a TOML file"}},
+        {"write", {"(path, map)", "Write a map to a TOML file"}},
+    });
+}
+
+} // namespace darix::native
@@ -447,7 +447,39 @@ void initTreeModule() {
         return cloneNode(args[0]);
     };
 
-    Registry::instance().registerModule("tree", funcs);
+    Registry::instance().registerModule("tree", funcs, "Tree Operations", {
+        {"node", {"(value, children?)", "Create tree node"}},
+        {"leaf", {"(value)", "Create leaf node"}},
+        {"value", {"(node)", "Get node value"}},
+        {"children", {"(node)", "Get children array"}},
+        {"is_leaf", {"(node)", "Check if leaf"}},
+        {"is_root", {"(node)", "Always true: nodes do not link to parents"}},
+        {"set_value", {"(node, value)", "New node with updated value"}},
+        {"add_child", {"(node, child)", "Add child"}},
+        {"add_children", {"(node, arr)", "Add multiple children"}},
+        {"size", {"(node)", "Total nodes in subtree"}},
+        {"depth", {"(node)", "Maximum depth"}},
+        {"height", {"(node)", "Height (edges to deepest leaf)"}},
+        {"depth_of", {"(node, value)", "Depth of node with value"}},
+        {"find", {"(node, value)", "Find node with value"}},
+        {"find_all", {"(node, fn)", "Find all matching nodes"}},
+        {"preorder", {"(node)", "Preorder traversal values"}},
+        {"to_array_preorder", {"(node)", "Alias of preorder"}},
+        {"inorder", {"(node)", "Inorder traversal values"}},
+        {"postorder", {"(node)", "Postorder traversal values"}},
+        {"levelorder", {"(node)", "Level-order (by level)"}},
+        {"to_array_levelorder", {"(node)", "Level-order values, flattened"}},
+        {"map_tree", {"(node, fn)", "Transform all values"}},
+        {"filter_tree", {"(node, fn)", "Prune non-matching nodes"}},
+        {"clone", {"(node)", "Deep copy"}},
+        {"equals", {"(a, b)", "Structural equality"}},
+        {"to_string", {"(node)", "String representation"}},
+        {"parent", {"(node, value)", "Value of the parent of the node with value, or null"}},
+        {"sibling_values", {"(node, value)", "Values of the siblings of the node with value"}},
+        {"leaves", {"(node)", "Values of all leaves"}},
+        {"count_leaves", {"(node)", "Number of leaves"}},
+        {"count_internal", {"(node)", "Number of non-leaf nodes"}},
+    });
 }
 
 } // namespace darix::native
@@ -0,0 +1,395 @@
+#include "darix/native/native.hpp"
+#include <cctype>
+#include <cstdio>
+
+namespace darix::native {
+
+static ObjectPtr makeError(const std::string& msg) { return newError("%s", msg.c_str()); }
+
+static std::string getString(ObjectPtr obj) {
+    if (auto s = std::dynamic_pointer_cast<String>(obj)) return s->value;
+    return "";
+}
+
+static bool isUnreserved(unsigned char c) {
+    return std::isalnum(c) || c == '-' || c == '_' || c == '.' || c == '~';
+}
+
+// Percent-encodes everything except unreserved characters and those in keep.
+// With spaceAsPlus, spaces become '+' (form encoding used in query strings).
+static std::string escape(const std::string& s, const std::string& keep, bool spaceAsPlus) {
+    std::string out;
+    for (unsigned char c : s) {
+        if (isUnreserved(c) || keep.find(static_cast<char>(c)) != std::string::npos) out += static_cast<char>(c);
+        else if (c == ' ' && spaceAsPlus) out += '+';
+        else { char buf[4]; std::snprintf(buf, sizeof(buf), "%%%02X", c); out += buf; }
+    }
+    return out;
+}
+
+static int hexValue(char c) {
+    if (c >= '0' && c <= '9') return c - '0';
+    if (c >= 'a' && c <= 'f') return c - 'a' + 10;
+    if (c >= 'A' && c <= 'F') return c - 'A' + 10;
+    return -1;
+}
+
+// Decodes %XX sequences; malformed escapes are kept verbatim.
+static std::string unescape(const std::string& s, bool plusAsSpace) {
+    std::string out;
+    for (size_t i = 0; i < s.size(); i++) {
+        if (s[i] == '%' && i + 2 < s.size() && hexValue(s[i + 1]) >= 0 && hexValue(s[i + 2]) >= 0) {
+            out += static_cast<char>(hexValue(s[i + 1]) * 16 + hexValue(s[i + 2]));
+            i += 2;
+        } else if (s[i] == '+' && plusAsSpace) {
+            out += ' ';
+        } else {
+            out += s[i];
+        }
+    }
+    return out;
+}
+
+static ObjectPtr lookup(const std::shared_ptr<Map>& m, const std::string& key) {
+    for (auto& [k, v] : m->pairs) {
+        if (getString(k) == key) return v;
+    }
+    return nullptr;
+}
+
+// Text form of a query value: strings as-is, null as empty.
+static std::string valueText(const ObjectPtr& v) {
+    if (!v || v->type() == ObjectType::NULL_OBJ) return "";
+    return v->inspect();
+}
+
+// "a=1&b=2&b=3" -> {"a": "1", "b": ["2", "3"]}
+static ObjectPtr decodeQuery(const std::string& query) {
+    auto result = std::dynamic_pointer_cast<Map>(newMap({}));
+    size_t start = 0;
+    while (start <= query.size()) {
+        size_t end = query.find_first_of("&;", start);
+        if (end == std::string::npos) end = query.size();
+        std::string part = query.substr(start, end - start);
+        start = end + 1;
+        if (part.empty()) continue;
+
+        size_t eq = part.find('=');
+        std::string key = unescape(part.substr(0, eq), true);
+        ObjectPtr value = newString(eq == std::string::npos ? "" : unescape(part.substr(eq + 1), true));
+
+        bool found = false;
+        for (auto& [k, v] : result->pairs) {
+            if (getString(k) != key) continue;
+            if (auto arr = std::dynamic_pointer_cast<Array>(v)) arr->elements.push_back(value);
+            else v = newArray({v, value});
+            found = true;
+            break;
+        }
+        if (!found) result->pairs.push_back({newString(key), value});
+    }
+    return result;
+}
+
+// {"a": 1, "b": [2, 3]} -> "a=1&b=2&b=3"
+static std::string encodeQuery(const std::shared_ptr<Map>& params) {
+    std::string out;
+    auto add = [&](const std::string& key, const ObjectPtr& value) {
+        if (!out.empty()) out += '&';
+        out += escape(key, "", true) + "=" + escape(valueText(value), "", true);
+    };
+    for (auto& [k, v] : params->pairs) {
+        std::string key = valueText(k);
+        if (auto arr = std::dynamic_pointer_cast<Array>(v)) {
+            for (auto& e : arr->elements) add(key, e);
+        } else {
+            add(key, v);
+        }
+    }
+    return out;
+}
+
+struct UrlParts {
+    std::string scheme, username, password, host, path, query, fragment;
+    int64_t port = -1;
+    bool hasAuthority = false, hasUserinfo = false, hasPassword = false, hasQuery = false;
+};
+
+static bool parseUrl(const std::string& url, UrlParts& parts, std::string& error) {
+    std::string rest = url;
+
+    // scheme = ALPHA *( ALPHA / DIGIT / "+" / "-" / "." ) ":"
+    size_t colon = rest.find(':');
+    if (colon != std::string::npos && colon > 0 && std::isalpha(static_cast<unsigned char>(rest[0]))) {
+        bool valid = true;
+        for (size_t i = 0; i < colon; i++) {
+            char c = rest[i];
+            if (!std::isalnum(static_cast<unsigned char>(c)) && c != '+' && c != '-' && c != '.') { valid = false; break; }
+        }
+        if (valid) {
+            parts.scheme = rest.substr(0, colon);
+            for (auto& c : parts.scheme) c = static_cast<char>(std::tolower(static_cast<unsigned char>(c)));
+            rest = rest.substr(colon + 1);
+        }
+    }
+
+    if (size_t hash = rest.find('#'); hash != std::string::npos) {
+        parts.fragment = unescape(rest.substr(hash + 1), false);
+        rest = rest.substr(0, hash);
+    }
+    if (size_t q = rest.find('?'); q != std::string::npos) {
+        parts.query = rest.substr(q + 1);
+        parts.hasQuery = true;
+        rest = rest.substr(0, q);
+    }
+
+    if (rest.rfind("//", 0) == 0) {
+        parts.hasAuthority = true;
+        rest = rest.substr(2);
+        size_t slash = rest.find('/');
+        std::string authority = rest.substr(0, slash);
+        rest = slash == std::string::npos ? "" : rest.substr(slash);
+
+        if (size_t at = authority.rfind('@'); at != std::string::npos) {
+            std::string userinfo = authority.substr(0, at);
+            authority = authority.substr(at + 1);
+            parts.hasUserinfo = true;
+            size_t sep = userinfo.find(':');
+            parts.username = unescape(userinfo.substr(0, sep), false);
+            if (sep != std::string::npos) {
+                parts.password = unescape(userinfo.substr(sep + 1), false);
+                parts.hasPassword = true;
+            }
+        }
+
+        std::string portText;
+        if (!authority.empty() && authority[0] == '[') {
+            size_t close = authority.find(']');
+            if (close == std::string::npos) { error = "missing ']' in host"; return false; }
+            parts.host = authority.substr(0, close + 1);
+            if (close + 1 < authority.size()) {
+                if (authority[close + 1] != ':') { error = "unexpected text after host"; return false; }
+                portText = authority.substr(close + 2);
+            }
+        } else {
+            size_t sep = authority.rfind(':');
+            parts.host = authority.substr(0, sep);
+            if (sep != std::string::npos) portText = authority.substr(sep + 1);
+        }
+        for (auto& c : parts.host) c = static_cast<char>(std::tolower(static_cast<unsigned char>(c)));
+
+        if (!portText.empty()) {
+            if (portText.size() > 5) { error = "invalid port '" + portText + "'"; return false; }
+            for (char c : portText) {
+                if (!std::isdigit(static_cast<unsigned char>(c))) { error = "invalid port '" + portText + "'"; return false; }
+            }
+            parts.port = std::stoll(portText);
+            if (parts.port > 65535) { error = "invalid port '" + portText + "'"; return false; }
+        }
+    }
+    parts.path = rest;
+    return true;
+}
+
+static std::string buildUrl(const UrlParts& parts) {
+    std::string out;
+    if (!parts.scheme.empty()) out += parts.scheme + ":";
+    if (parts.hasAuthority || !parts.host.empty()) {
+        out += "//";
+        if (!parts.username.empty() || parts.hasPassword) {
+            out += escape(parts.username, "!$&'()*+,;=", false);
+            if (parts.hasPassword) out += ":" + escape(parts.password, "!$&'()*+,;=", false);
+            out += "@";
+        }
+        out += parts.host;
+        if (parts.port >= 0) out += ":" + std::to_string(parts.port);
+        if (!parts.path.empty() && parts.path[0] != '/') out += "/";
+    }
+    out += parts.path;
+    if (!parts.query.empty()) out += "?" + parts.query;
+    if (!parts.fragment.empty()) out += "#" + escape(parts.fragment, "!$&'()*+,;=:@/?", false);
+    return out;
+}
+
+// Joins path segments with single slashes and resolves "." and "..".
+static std::string joinPath(const std::vector<std::string>& pieces) {
+    std::string joined;
+    for (auto& p : pieces) {
+        if (p.empty()) continue;
+        if (!joined.empty() && joined.back() != '/') joined += '/';
+        joined += p;
+    }
+    bool absolute = !joined.empty() && joined[0] == '/';
+    bool trailing = !joined.empty() && joined.back() == '/';
+
+    std::vector<std::string> segments;
+    size_t start = 0;
+    while (start <= joined.size()) {
+        size_t end = joined.find('/', start);
+        if (end == std::string::npos) end = joined.size();
+        std::string seg = joined.substr(start, end - start);
+        start = end + 1;
+        if (seg.empty() || seg == ".") continue;
+        if (seg == "..") {
+            if (!segments.empty() && segments.back() != "..") segments.pop_back();
+            else if (!absolute) segments.push_back(seg);
+            continue;
+        }
+        segments.push_back(seg);
+    }
+
+    std::string out = absolute ? "/" : "";
+    for (size_t i = 0; i < segments.size(); i++) {
+        if (i > 0) out += '/';
+        out += segments[i];
+    }
+    if (trailing && !segments.empty()) out += '/';
+    if (out.empty()) out = absolute ? "/" : ".";
+    return out;
+}
+
+void initUrlModule() {
+    std::unordered_map<std::string, NativeFunc> funcs;
+
+    // parse(url) -> {scheme, username, password, host, port, path, query, fragment, params}
+    funcs["parse"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("parse: expected 1 argument");
+        if (args[0]->type() != ObjectType::STRING) return makeError("parse: argument must be a string");
+        UrlParts parts;
+        std::string error;
+        if (!parseUrl(getString(args[0]), parts, error)) return makeError("parse: " + error);
+        auto optional = [](bool present, const std::string& s) -> ObjectPtr { return present ? newString(s) : getNull(); };
+        return newMap({
+            {newString("scheme"), newString(parts.scheme)},
+            {newString("username"), optional(parts.hasUserinfo, parts.username)},
+            {newString("password"), optional(parts.hasPassword, parts.password)},
+            {newString("host"), newString(parts.host)},
+            {newString("port"), parts.port >= 0 ? newInteger(parts.port) : getNull()},
+            {newString("path"), newString(parts.path)},
+            {newString("query"), newString(parts.query)},
+            {newString("fragment"), newString(parts.fragment)},
+            {newString("params"), decodeQuery(parts.query)},
+        });
+    };
+
+    // build(parts) -> url string; accepts the map returned by parse().
+    // "params" (a map) takes precedence over "query" (a string).
+    funcs["build"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("build: expected 1 argument");
+        auto m = std::dynamic_pointer_cast<Map>(args[0]);
+        if (!m) return makeError("build: argument must be a map");
+        UrlParts parts;
+        auto text = [&](const char* key) { return valueText(lookup(m, key)); };
+        parts.scheme = text("scheme");
+        parts.host = text("host");
+        parts.username = text("username");
+        if (auto pw = lookup(m, "password"); pw && pw->type() != ObjectType::NULL_OBJ) {
+            parts.password = pw->inspect();
+            parts.hasPassword = true;
+        }
+        if (auto port = lookup(m, "port"); port && port->type() != ObjectType::NULL_OBJ) {
+            auto i = std::dynamic_pointer_cast<Integer>(port);
+            if (!i || i->value < 0 || i->value > 65535) return makeError("build: port must be an integer between 0 and 65535");
+            parts.port = i->value;
+        }
+        parts.path = text("path");
+        parts.query = text("query");
+        if (auto params = std::dynamic_pointer_cast<Map>(lookup(m, "params")); params && !params->pairs.empty())
+            parts.query = encodeQuery(params);
+        parts.fragment = text("fragment");
+        return newString(buildUrl(parts));
+    };
+
+    // query_encode(map) -> "k=v&..." (array values repeat the key)
+    funcs["query_encode"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("query_encode: expected 1 argument");
+        auto m = std::dynamic_pointer_cast<Map>(args[0]);
+        if (!m) return makeError("query_encode: argument must be a map");
+        return newString(encodeQuery(m));
+    };
+
+    // query_decode(string) -> map (repeated keys collect into an array)
+    funcs["query_decode"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("query_decode: expected 1 argument");
+        std::string query = getString(args[0]);
+        if (!query.empty() && query[0] == '?') query = query.substr(1);
+        return decodeQuery(query);
+    };
+
+    // escape(s) -> s with every reserved character percent-encoded
+    funcs["escape"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("escape: expected 1 argument");
+        return newString(escape(getString(args[0]), "", false));
+    };
+
+    // unescape(s) -> s with %XX sequences decoded ('+' is left alone)
+    funcs["unescape"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("unescape: expected 1 argument");
+        return newString(unescape(getString(args[0]), false));
+    };
+
+    // path_escape(path) -> path with each segment escaped, keeping '/'
+    funcs["path_escape"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("path_escape: expected 1 argument");
+        return newString(escape(getString(args[0]), "/!$&'()*+,;=:@", false));
+    };
+
+    // path_join(parts...) -> cleaned path ("a/", "/b", "../c" -> "c")
+    funcs["path_join"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.empty()) return makeError("path_join: expected at least 1 argument");
+        std::vector<std::string> pieces;
+        for (auto& a : args) {
+            if (a->type() != ObjectType::STRING) return makeError("path_join: arguments must be strings");
+            pieces.push_back(getString(a));
+        }
+        return newString(joinPath(pieces));
+    };
+
+    // resolve(base, ref) -> ref resolved against base (RFC 3986 section 5.2)
+    funcs["resolve"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 2) return makeError("resolve: expected 2 arguments");
+        UrlParts base, ref;
+        std::string error;
+        if (!parseUrl(getString(args[0]), base, error)) return makeError("resolve: " + error);
+        if (!parseUrl(getString(args[1]), ref, error)) return makeError("resolve: " + error);
+
+        if (!ref.scheme.empty()) {
+            ref.path = joinPath({ref.path});
+            return newString(buildUrl(ref));
+        }
+        UrlParts out = base;
+        out.fragment = ref.fragment;
+        if (ref.hasAuthority) {
+            out.host = ref.host; out.port = ref.port;
+            out.username = ref.username; out.password = ref.password; out.hasPassword = ref.hasPassword;
+            out.path = ref.path.empty() ? "" : joinPath({ref.path});
+            out.query = ref.query;
+        } else if (ref.path.empty()) {
+            if (ref.hasQuery) out.query = ref.query;
+        } else {
+            if (ref.path[0] == '/') {
+                out.path = joinPath({ref.path});
+            } else {
+                size_t slash = base.path.rfind('/');
+                std::string dir = slash == std::string::npos ? "/" : base.path.substr(0, slash + 1);
+                out.path = joinPath({dir, ref.path});
+            }
+            out.query = ref.query;
+        }
+        return newString(buildUrl(out));
+    };
+
+    Registry::instance().registerModule("url", funcs, "URLs and Query Strings", {
+        {"parse", {"(url)", "Split a URL into a map: scheme, username, password, host, port, path, query, fragment, params"}},
+        {"build", {"(parts)", "Assemble a URL from a parts map; params (a map) overrides query"}},
+        {"query_encode", {"(map)", "Encode a map as k=v&..."}},
+        {"query_decode", {"(string)", "Decode a query string into a map"}},
+        {"escape", {"(s)", "Percent-encode every reserved character"}},
+        {"unescape", {"(s)", "Decode %XX sequences"}},
+        {"path_escape", {"(path)", "Percent-encode a path, keeping /"}},
+        {"path_join", {"(parts...)", "Join path segments, resolving . and .."}},
+        {"resolve", {"(base, ref)", "Resolve a relative reference against a base URL"}},
+    });
+}
+
+} // namespace darix::native
@@ -0,0 +1,172 @@
+#include "darix/native/native.hpp"
+#include <cctype>
+#include <chrono>
+#include <cstdio>
+#include <random>
+
+namespace darix::native {
+
+static ObjectPtr makeError(const std::string& msg) { return newError("%s", msg.c_str()); }
+
+static std::string getString(ObjectPtr obj) {
+    if (auto s = std::dynamic_pointer_cast<String>(obj)) return s->value;
+    return "";
+}
+
+// Seeded once from the OS entropy source; identifiers must not repeat across
+// runs, except in reproducible ones.
+static std::mt19937_64& getRng() {
+    static std::mt19937_64 rng = [] {
+        if (deterministic()) return std::mt19937_64(randomSeed());
+        std::random_device rd;
+        std::seed_seq seq{rd(), rd(), rd(), rd(), rd(), rd(), rd(), rd()};
+        return std::mt19937_64(seq);
+    }();
+    return rng;
+}
+
+static std::string formatUuid(const uint8_t bytes[16]) {
+    char buf[37];
+    std::snprintf(buf, sizeof(buf),
+        "%02x%02x%02x%02x-%02x%02x-%02x%02x-%02x%02x-%02x%02x%02x%02x%02x%02x",
+        bytes[0], bytes[1], bytes[2], bytes[3], bytes[4], bytes[5], bytes[6], bytes[7],
+        bytes[8], bytes[9], bytes[10], bytes[11], bytes[12], bytes[13], bytes[14], bytes[15]);
+    return buf;
+}
+
+static void fillRandom(uint8_t* out, size_t n) {
+    auto& rng = getRng();
+    for (size_t i = 0; i < n; i += 8) {
+        uint64_t r = rng();
+        for (size_t j = 0; j < 8 && i + j < n; j++) out[i + j] = static_cast<uint8_t>(r >> (j * 8));
+    }
+}
+
+static void setVersion(uint8_t bytes[16], int version) {
+    bytes[6] = static_cast<uint8_t>((bytes[6] & 0x0F) | (version << 4));
+    bytes[8] = static_cast<uint8_t>((bytes[8] & 0x3F) | 0x80); // RFC 9562 variant
+}
+
+// UUIDv7: 48-bit Unix millisecond timestamp, then 12 bits used as a counter so
+// ids generated within the same millisecond still sort in creation order.
+static std::string uuid7() {
+    static int64_t lastMs = 0;
+    static uint16_t counter = 0;
+
+    int64_t ms = std::chrono::duration_cast<std::chrono::milliseconds>(
+        currentTime().time_since_epoch()).count();
+    uint8_t bytes[16];
+    fillRandom(bytes, sizeof(bytes));
+    if (ms <= lastMs) {
+        ms = lastMs;
+        if (++counter > 0x0FFF) { ms++; counter = 0; }
+    } else {
+        counter = static_cast<uint16_t>(((bytes[6] << 8) | bytes[7]) & 0x07FF); // leave headroom
+    }
+    lastMs = ms;
+
+    for (int i = 0; i < 6; i++) bytes[i] = static_cast<uint8_t>(ms >> (40 - 8 * i));
+    bytes[6] = static_cast<uint8_t>(counter >> 8);
+    bytes[7] = static_cast<uint8_t>(counter & 0xFF);
+    setVersion(bytes, 7);
+    return formatUuid(bytes);
+}
+
+static const std::string kNanoidAlphabet = "useandom-26T198340PX75pxJACKVERYMINDBUSHWOLF_GQZbfghjklqvwyzrict";
+
+// Picks size symbols from alphabet without modulo bias.
+static std::string randomString(const std::string& alphabet, int64_t size) {
+    uint64_t n = alphabet.size();
+    uint64_t limit = UINT64_MAX - (UINT64_MAX % n);
+    auto& rng = getRng();
+    std::string out;
+    out.reserve(static_cast<size_t>(size));
+    while (static_cast<int64_t>(out.size()) < size) {
+        uint64_t r = rng();
+        if (r >= limit) continue;
+        out += alphabet[r % n];
+    }
+    return out;
+}
+
+static bool isUuid(const std::string& s) {
+    if (s.size() != 36) return false;
+    for (size_t i = 0; i < s.size(); i++) {
+        if (i == 8 || i == 13 || i == 18 || i == 23) {
+            if (s[i] != '-') return false;
+        } else if (!std::isxdigit(static_cast<unsigned char>(s[i]))) {
+            return false;
+        }
+    }
+    return true;
+}
+
+void initUuidModule() {
+    std::unordered_map<std::string, NativeFunc> funcs;
+
+    // uuid4() -> random UUID string
+    funcs["uuid4"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (!args.empty()) return makeError("uuid4: expected 0 arguments");
+        uint8_t bytes[16];
+        fillRandom(bytes, sizeof(bytes));
+        setVersion(bytes, 4);
+        return newString(formatUuid(bytes));
+    };
+
+    // uuid7() -> time-ordered UUID string (sorts by creation time)
+    funcs["uuid7"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (!args.empty()) return makeError("uuid7: expected 0 arguments");
+        return newString(uuid7());
+    };
+
+    // nanoid(size?, alphabet?) -> URL-safe random id (default 21 characters)
+    funcs["nanoid"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() > 2) return makeError("nanoid: expected 0-2 arguments");
+        int64_t size = 21;
+        if (!args.empty()) {
+            auto n = std::dynamic_pointer_cast<Integer>(args[0]);
+            if (!n || n->value <= 0) return makeError("nanoid: size must be a positive integer");
+            size = n->value;
+        }
+        std::string alphabet = kNanoidAlphabet;
+        if (args.size() == 2) {
+            alphabet = getString(args[1]);
+            if (alphabet.size() < 2 || alphabet.size() > 256) return makeError("nanoid: alphabet must have 2-256 characters");
+        }
+        return newString(randomString(alphabet, size));
+    };
+
+    // random_hex(n) -> string of n random hex digits
+    funcs["random_hex"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("random_hex: expected 1 argument");
+        auto n = std::dynamic_pointer_cast<Integer>(args[0]);
+        if (!n || n->value <= 0) return makeError("random_hex: length must be positive");
+        return newString(randomString("0123456789abcdef", n->value));
+    };
+
+    // is_valid(s) -> true if s is a canonical 8-4-4-4-12 UUID string
+    funcs["is_valid"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("is_valid: expected 1 argument");
+        return newBoolean(isUuid(getString(args[0])));
+    };
+
+    // version(s) -> UUID version number, or null if s is not a UUID
+    funcs["version"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("version: expected 1 argument");
+        std::string s = getString(args[0]);
+        if (!isUuid(s)) return getNull();
+        char c = s[14];
+        return newInteger(std::isdigit(static_cast<unsigned char>(c)) ? c - '0' : std::tolower(c) - 'a' + 10);
+    };
+
+    Registry::instance().registerModule("uuid", funcs, "Unique Identifiers", {
+        {"uuid4", {"()", "Random UUID"}},
+        {"uuid7", {"()", "Time-ordered UUID; later ids sort after earlier ones"}},
+        {"nanoid", {"(size?, alphabet?)", "URL-safe random id (21 characters by default)"}},
+        {"random_hex", {"(n)", "String of n random hex digits"}},
+        {"is_valid", {"(s)", "Check for a canonical 8-4-4-4-12 UUID string"}},
+        {"version", {"(s)", "UUID version number, or null if s is not a UUID"}},
+    });
+}
+
+} // namespace darix::native
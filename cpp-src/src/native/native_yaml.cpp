@@ -0,0 +1,605 @@
+#include "darix/native/native.hpp"
+#include <cctype>
+#include <cmath>
+#include <cstdio>
+#include <fstream>
+#include <sstream>
+
+namespace darix::native {
+
+static ObjectPtr makeError(const std::string& msg) { return newError("%s", msg.c_str()); }
+
+static std::string getString(ObjectPtr obj) {
+    if (auto s = std::dynamic_pointer_cast<String>(obj)) return s->value;
+    return "";
+}
+
+static std::string trim(const std::string& s) {
+    size_t start = s.find_first_not_of(" \t\r");
+    if (start == std::string::npos) return "";
+    size_t end = s.find_last_not_of(" \t\r");
+    return s.substr(start, end - start + 1);
+}
+
+// ============ Parsing ============
+//
+// Supports the block subset used by config files: nested mappings and
+// sequences, plain/quoted scalars, flow collections, literal (|) and folded (>)
+// block scalars, and comments. Anchors, tags and multiple documents are not
+// supported.
+
+struct YamlParseError {
+    std::string message;
+};
+
+// A collection grew past the policy's size limits; error is the
+// ResourceError to raise.
+struct YamlTooLarge {
+    ObjectPtr error;
+};
+
+static void checkSize(ObjectPtr error) {
+    if (error) throw YamlTooLarge{error};
+}
+
+struct YamlLine {
+    int indent = 0;
+    std::string raw;
+    std::string text; // content without indentation or trailing comment
+};
+
+static std::string stripComment(const std::string& s) {
+    bool inSingle = false, inDouble = false;
+    for (size_t i = 0; i < s.size(); i++) {
+        char c = s[i];
+        if (c == '\\' && inDouble) { i++; continue; }
+        if (c == '\'' && !inDouble) inSingle = !inSingle;
+        else if (c == '"' && !inSingle) inDouble = !inDouble;
+        else if (c == '#' && !inSingle && !inDouble && (i == 0 || s[i - 1] == ' ' || s[i - 1] == '\t'))
+            return s.substr(0, i);
+    }
+    return s;
+}
+
+class YamlParser {
+public:
+    explicit YamlParser(const std::string& src) {
+        std::istringstream in(src);
+        std::string raw;
+        while (std::getline(in, raw)) {
+            if (!raw.empty() && raw.back() == '\r') raw.pop_back();
+            YamlLine line;
+            line.raw = raw;
+            size_t i = 0;
+            while (i < raw.size() && raw[i] == ' ') i++;
+            line.indent = static_cast<int>(i);
+            line.text = trim(stripComment(raw.substr(i)));
+            if (line.indent == 0 && (line.text == "---" || line.text.rfind("--- ", 0) == 0)) {
+                if (sawDocument_) break;
+                sawDocument_ = true;
+                line.text = trim(line.text.substr(3));
+                if (line.text.empty()) continue;
+            }
+            if (line.indent == 0 && line.text == "...") break;
+            lines_.push_back(line);
+        }
+    }
+
+    ObjectPtr parse() {
+        skipBlank();
+        if (pos_ >= lines_.size()) return getNull();
+        auto value = parseBlock(lines_[pos_].indent);
+        skipBlank();
+        if (pos_ < lines_.size()) fail("unexpected content", pos_);
+        return value;
+    }
+
+private:
+    std::vector<YamlLine> lines_;
+    size_t pos_ = 0;
+    bool sawDocument_ = false;
+
+    [[noreturn]] void fail(const std::string& msg, size_t line) {
+        throw YamlParseError{msg + " on line " + std::to_string(line + 1)};
+    }
+
+    void skipBlank() {
+        while (pos_ < lines_.size() && lines_[pos_].text.empty()) pos_++;
+    }
+
+    static bool isSequenceItem(const std::string& text) {
+        return text == "-" || text.rfind("- ", 0) == 0;
+    }
+
+    // Splits "key: value" into its parts. Returns false if the text is not a mapping entry.
+    bool splitKey(const std::string& text, std::string& key, std::string& rest) {
+        size_t i = 0;
+        if (!text.empty() && (text[0] == '"' || text[0] == '\'')) {
+            size_t end = 0;
+            auto k = parseQuoted(text, 0, end);
+            i = end;
+            while (i < text.size() && text[i] == ' ') i++;
+            if (i >= text.size() || text[i] != ':') return false;
+            key = getString(k);
+        } else {
+            if (!text.empty() && (text[0] == '[' || text[0] == '{')) return false;
+            for (i = 0; i < text.size(); i++) {
+                if (text[i] == ':' && (i + 1 == text.size() || text[i + 1] == ' ' || text[i + 1] == '\t')) break;
+            }
+            if (i >= text.size()) return false;
+            key = trim(text.substr(0, i));
+        }
+        rest = trim(text.substr(i + 1));
+        return true;
+    }
+
+    ObjectPtr parseBlock(int indent) {
+        const auto& text = lines_[pos_].text;
+        if (isSequenceItem(text)) return parseSequence(indent);
+        std::string key, rest;
+        if (splitKey(text, key, rest)) return parseMapping(indent);
+        // A lone scalar; plain scalars may continue on more-indented lines
+        std::string value = text;
+        size_t start = pos_++;
+        if (value[0] != '"' && value[0] != '\'' && value[0] != '[' && value[0] != '{') {
+            while (pos_ < lines_.size() && (lines_[pos_].text.empty() || lines_[pos_].indent > indent)) {
+                if (!lines_[pos_].text.empty()) value += " " + lines_[pos_].text;
+                pos_++;
+            }
+        }
+        return parseInline(value, start);
+    }
+
+    ObjectPtr parseSequence(int indent) {
+        std::vector<ObjectPtr> items;
+        for (;;) {
+            skipBlank();
+            if (pos_ >= lines_.size() || lines_[pos_].indent != indent || !isSequenceItem(lines_[pos_].text)) break;
+            auto& line = lines_[pos_];
+            std::string rest = trim(line.text.substr(1));
+            if (rest.empty()) {
+                pos_++;
+                skipBlank();
+                if (pos_ < lines_.size() && lines_[pos_].indent > indent) items.push_back(parseBlock(lines_[pos_].indent));
+                else items.push_back(getNull());
+                checkSize(arraySizeError(items.size()));
+                continue;
+            }
+            // Re-read the item's content as a block nested at its own column,
+            // so "- key: v" followed by "  other: w" forms one mapping.
+            size_t offset = line.text.find(rest);
+            line.indent += static_cast<int>(offset);
+            line.text = rest;
+            items.push_back(parseBlock(line.indent));
+            checkSize(arraySizeError(items.size()));
+        }
+        if (pos_ < lines_.size() && !lines_[pos_].text.empty() && lines_[pos_].indent > indent)
+            fail("bad indentation in sequence", pos_);
+        return newArray(items);
+    }
+
+    ObjectPtr parseMapping(int indent) {
+        std::vector<std::pair<ObjectPtr, ObjectPtr>> pairs;
+        for (;;) {
+            skipBlank();
+            if (pos_ >= lines_.size() || lines_[pos_].indent != indent) break;
+            size_t lineNo = pos_;
+            std::string key, rest;
+            if (isSequenceItem(lines_[pos_].text) || !splitKey(lines_[pos_].text, key, rest))
+                fail("expected a mapping key", pos_);
+            pos_++;
+
+            ObjectPtr value;
+            if (rest.empty()) {
+                skipBlank();
+                if (pos_ < lines_.size() && lines_[pos_].indent > indent) value = parseBlock(lines_[pos_].indent);
+                else if (pos_ < lines_.size() && lines_[pos_].indent == indent && isSequenceItem(lines_[pos_].text))
+                    value = parseSequence(indent);
+                else value = getNull();
+            } else if (rest[0] == '|' || rest[0] == '>') {
+                value = parseBlockScalar(rest, indent);
+            } else if ((rest[0] == '[' || rest[0] == '{') && !balanced(rest)) {
+                while (pos_ < lines_.size() && !balanced(rest)) rest += " " + lines_[pos_++].text;
+                value = parseInline(rest, lineNo);
+            } else {
+                if (rest[0] != '"' && rest[0] != '\'') {
+                    while (pos_ < lines_.size() && !lines_[pos_].text.empty() && lines_[pos_].indent > indent)
+                        rest += " " + lines_[pos_++].text;
+                }
+                value = parseInline(rest, lineNo);
+            }
+
+            bool replaced = false;
+            for (auto& p : pairs) {
+                if (getString(p.first) == key) { p.second = value; replaced = true; break; }
+            }
+            if (!replaced) pairs.push_back({newString(key), value});
+            checkSize(mapSizeError(pairs.size()));
+        }
+        if (pos_ < lines_.size() && !lines_[pos_].text.empty() && lines_[pos_].indent > indent)
+            fail("bad indentation in mapping", pos_);
+        return newMap(pairs);
+    }
+
+    // | keeps line breaks, > folds them into spaces; a trailing - strips the final newline.
+    ObjectPtr parseBlockScalar(const std::string& header, int parentIndent) {
+        bool folded = header[0] == '>';
+        bool strip = header.find('-') != std::string::npos;
+        bool keep = header.find('+') != std::string::npos;
+
+        std::vector<std::string> body;
+        int blockIndent = -1;
+        while (pos_ < lines_.size()) {
+            auto& line = lines_[pos_];
+            bool blank = trim(line.raw).empty();
+            if (!blank && line.indent <= parentIndent) break;
+            if (!blank && blockIndent < 0) blockIndent = line.indent;
+            if (blank) body.push_back("");
+            else body.push_back(line.raw.substr(std::min<size_t>(blockIndent, line.raw.size())));
+            pos_++;
+        }
+        size_t trailing = 0;
+        while (!body.empty() && body.back().empty()) { body.pop_back(); trailing++; }
+
+        std::string out;
+        for (size_t i = 0; i < body.size(); i++) {
+            if (i > 0) {
+                bool joinWithSpace = folded && !body[i].empty() && !body[i - 1].empty() && body[i][0] != ' ';
+                out += joinWithSpace ? " " : "\n";
+            }
+            out += body[i];
+        }
+        if (!strip && !body.empty()) out += "\n";
+        if (keep) out += std::string(trailing, '\n');
+        return newString(out);
+    }
+
+    static bool balanced(const std::string& s) {
+        int depth = 0;
+        bool inSingle = false, inDouble = false;
+        for (size_t i = 0; i < s.size(); i++) {
+            char c = s[i];
+            if (c == '\\' && inDouble) { i++; continue; }
+            if (c == '\'' && !inDouble) inSingle = !inSingle;
+            else if (c == '"' && !inSingle) inDouble = !inDouble;
+            else if (!inSingle && !inDouble) {
+                if (c == '[' || c == '{') depth++;
+                else if (c == ']' || c == '}') depth--;
+            }
+        }
+        return depth <= 0;
+    }
+
+    ObjectPtr parseInline(const std::string& text, size_t lineNo) {
+        size_t i = 0;
+        auto value = parseFlow(text, i, lineNo, false);
+        while (i < text.size() && text[i] == ' ') i++;
+        if (i < text.size()) fail("unexpected '" + text.substr(i) + "'", lineNo);
+        return value;
+    }
+
+    ObjectPtr parseQuoted(const std::string& s, size_t start, size_t& end) {
+        char q = s[start];
+        std::string out;
+        size_t i = start + 1;
+        for (; i < s.size(); i++) {
+            char c = s[i];
+            if (q == '\'' && c == '\'') {
+                if (i + 1 < s.size() && s[i + 1] == '\'') { out += '\''; i++; continue; }
+                break;
+            }
+            if (q == '"' && c == '"') break;
+            if (q == '"' && c == '\\' && i + 1 < s.size()) {
+                char e = s[++i];
+                switch (e) {
+                    case 'n': out += '\n'; break;
+                    case 't': out += '\t'; break;
+                    case 'r': out += '\r'; break;
+                    case '0': out += '\0'; break;
+                    case '"': out += '"'; break;
+                    case '\\': out += '\\'; break;
+                    case '/': out += '/'; break;
+                    case 'u': {
+                        uint32_t cp = 0;
+                        for (int k = 0; k < 4 && i + 1 < s.size(); k++) {
+                            char h = s[++i];
+                            if (!std::isxdigit(static_cast<unsigned char>(h))) throw YamlParseError{"invalid \\u escape"};
+                            cp = cp * 16 + (std::isdigit(static_cast<unsigned char>(h)) ? h - '0' : (std::tolower(h) - 'a' + 10));
+                        }
+                        if (cp < 0x80) out += static_cast<char>(cp);
+                        else if (cp < 0x800) {
+                            out += static_cast<char>(0xC0 | (cp >> 6));
+                            out += static_cast<char>(0x80 | (cp & 0x3F));
+                        } else {
+                            out += static_cast<char>(0xE0 | (cp >> 12));
+                            out += static_cast<char>(0x80 | ((cp >> 6) & 0x3F));
+                            out += static_cast<char>(0x80 | (cp & 0x3F));
+                        }
+                        break;
+                    }
+                    default: out += '\\'; out += e; break;
+                }
+                continue;
+            }
+            out += c;
+        }
+        if (i >= s.size()) throw YamlParseError{"unterminated quoted string"};
+        end = i + 1;
+        return newString(out);
+    }
+
+    // Parses one value starting at i. Inside flow collections plain scalars stop at , ] }.
+    ObjectPtr parseFlow(const std::string& s, size_t& i, size_t lineNo, bool inFlow) {
+        while (i < s.size() && s[i] == ' ') i++;
+        if (i >= s.size()) return getNull();
+        char c = s[i];
+        if (c == '"' || c == '\'') {
+            size_t end = 0;
+            auto v = parseQuoted(s, i, end);
+            i = end;
+            return v;
+        }
+        if (c == '[') {
+            i++;
+            std::vector<ObjectPtr> items;
+            for (;;) {
+                while (i < s.size() && s[i] == ' ') i++;
+                if (i >= s.size()) fail("unterminated '['", lineNo);
+                if (s[i] == ']') { i++; break; }
+                items.push_back(parseFlow(s, i, lineNo, true));
+                checkSize(arraySizeError(items.size()));
+                while (i < s.size() && s[i] == ' ') i++;
+                if (i < s.size() && s[i] == ',') i++;
+                else if (i < s.size() && s[i] != ']') fail("expected ',' or ']'", lineNo);
+            }
+            return newArray(items);
+        }
+        if (c == '{') {
+            i++;
+            std::vector<std::pair<ObjectPtr, ObjectPtr>> pairs;
+            for (;;) {
+                while (i < s.size() && s[i] == ' ') i++;
+                if (i >= s.size()) fail("unterminated '{'", lineNo);
+                if (s[i] == '}') { i++; break; }
+                ObjectPtr key;
+                if (s[i] == '"' || s[i] == '\'') {
+                    size_t end = 0;
+                    key = parseQuoted(s, i, end);
+                    i = end;
+                } else {
+                    size_t start = i;
+                    while (i < s.size() && s[i] != ':' && s[i] != ',' && s[i] != '}') i++;
+                    key = newString(trim(s.substr(start, i - start)));
+                }
+                while (i < s.size() && s[i] == ' ') i++;
+                ObjectPtr value = getNull();
+                if (i < s.size() && s[i] == ':') {
+                    i++;
+                    value = parseFlow(s, i, lineNo, true);
+                }
+                pairs.push_back({key, value});
+                checkSize(mapSizeError(pairs.size()));
+                while (i < s.size() && s[i] == ' ') i++;
+                if (i < s.size() && s[i] == ',') i++;
+                else if (i < s.size() && s[i] != '}') fail("expected ',' or '}'", lineNo);
+            }
+            return newMap(pairs);
+        }
+        size_t start = i;
+        if (inFlow) {
+            while (i < s.size() && s[i] != ',' && s[i] != ']' && s[i] != '}') i++;
+        } else {
+            i = s.size();
+        }
+        return plainScalar(trim(s.substr(start, i - start)));
+    }
+
+public:
+    static ObjectPtr plainScalar(const std::string& s) {
+        if (s.empty() || s == "~" || s == "null" || s == "Null" || s == "NULL") return getNull();
+        if (s == "true" || s == "True" || s == "TRUE") return getTrue();
+        if (s == "false" || s == "False" || s == "FALSE") return getFalse();
+        if (s == ".inf" || s == "+.inf" || s == ".Inf") return newFloat(INFINITY);
+        if (s == "-.inf" || s == "-.Inf") return newFloat(-INFINITY);
+        if (s == ".nan" || s == ".NaN") return newFloat(NAN);
+
+        size_t i = (s[0] == '-' || s[0] == '+') ? 1 : 0;
+        if (i < s.size() && std::isdigit(static_cast<unsigned char>(s[i]))) {
+            try {
+                size_t used = 0;
+                if (s.compare(i, 2, "0x") == 0) {
+                    int64_t v = std::stoll(s.substr(i + 2), &used, 16);
+                    if (used == s.size() - i - 2) return newInteger(s[0] == '-' ? -v : v);
+                } else if (s.compare(i, 2, "0o") == 0) {
+                    int64_t v = std::stoll(s.substr(i + 2), &used, 8);
+                    if (used == s.size() - i - 2) return newInteger(s[0] == '-' ? -v : v);
+                } else if (s.find_first_of(".eE") == std::string::npos) {
+                    int64_t v = std::stoll(s, &used);
+                    if (used == s.size()) return newInteger(v);
+                } else {
+                    double v = std::stod(s, &used);
+                    if (used == s.size()) return newFloat(v);
+                }
+            } catch (...) {
+                // not a number; fall through to string
+            }
+        }
+        return newString(s);
+    }
+};
+
+// ============ Serialization ============
+
+static bool needsQuoting(const std::string& s) {
+    if (s.empty()) return true;
+    if (s.front() == ' ' || s.back() == ' ') return true;
+    if (std::string("-?:,[]{}#&*!|>'\"%@`").find(s[0]) != std::string::npos) return true;
+    if (s.find(": ") != std::string::npos || s.find(" #") != std::string::npos || s.back() == ':') return true;
+    for (char c : s) if (c == '\n' || c == '\t' || c == '\r' || static_cast<unsigned char>(c) < 0x20) return true;
+    // Strings that would read back as another type
+    auto reparsed = YamlParser::plainScalar(s);
+    return !reparsed || reparsed->type() != ObjectType::STRING || getString(reparsed) != s;
+}
+
+static std::string quote(const std::string& s) {
+    std::string out = "\"";
+    for (char c : s) {
+        switch (c) {
+            case '"': out += "\\\""; break;
+            case '\\': out += "\\\\"; break;
+            case '\n': out += "\\n"; break;
+            case '\t': out += "\\t"; break;
+            case '\r': out += "\\r"; break;
+            default: out += c;
+        }
+    }
+    return out + "\"";
+}
+
+static std::string scalarToYaml(const ObjectPtr& obj) {
+    switch (obj->type()) {
+        case ObjectType::NULL_OBJ: return "null";
+        case ObjectType::BOOLEAN:
+        case ObjectType::INTEGER: return obj->inspect();
+        case ObjectType::FLOAT: {
+            double v = std::dynamic_pointer_cast<Float>(obj)->value;
+            if (std::isnan(v)) return ".nan";
+            if (std::isinf(v)) return v > 0 ? ".inf" : "-.inf";
+            return formatFloat(v);
+        }
+        case ObjectType::STRING: {
+            auto s = getString(obj);
+            return needsQuoting(s) ? quote(s) : s;
+        }
+        default: {
+            auto s = obj->inspect();
+            return needsQuoting(s) ? quote(s) : s;
+        }
+    }
+}
+
+static bool isEmptyCollection(const ObjectPtr& obj) {
+    if (auto a = std::dynamic_pointer_cast<Array>(obj)) return a->elements.empty();
+    if (auto m = std::dynamic_pointer_cast<Map>(obj)) return m->pairs.empty();
+    return false;
+}
+
+static bool isCollection(const ObjectPtr& obj) {
+    return obj->type() == ObjectType::ARRAY || obj->type() == ObjectType::MAP;
+}
+
+static void emitYaml(std::ostringstream& out, const ObjectPtr& obj, int indent, int depth);
+
+static void emitValueAfterKey(std::ostringstream& out, const ObjectPtr& value, int indent, int depth) {
+    if (isCollection(value) && !isEmptyCollection(value)) {
+        out << "\n";
+        emitYaml(out, value, indent, depth + 1);
+    } else if (value->type() == ObjectType::ARRAY) {
+        out << " []\n";
+    } else if (value->type() == ObjectType::MAP) {
+        out << " {}\n";
+    } else {
+        out << " " << scalarToYaml(value) << "\n";
+    }
+}
+
+static void emitYaml(std::ostringstream& out, const ObjectPtr& obj, int indent, int depth) {
+    if (depth > 100) throw YamlParseError{"value nested too deeply"};
+    std::string pad(indent, ' ');
+    if (auto m = std::dynamic_pointer_cast<Map>(obj)) {
+        for (auto& [k, v] : m->pairs) {
+            out << pad << scalarToYaml(k->type() == ObjectType::STRING ? k : newString(k->inspect())) << ":";
+            emitValueAfterKey(out, v, indent + 2, depth);
+        }
+    } else if (auto a = std::dynamic_pointer_cast<Array>(obj)) {
+        for (auto& e : a->elements) {
+            if (isCollection(e) && !isEmptyCollection(e)) {
+                // Nested collections start on the dash line: "- key: v" / "- - x"
+                std::ostringstream inner;
+                emitYaml(inner, e, indent + 2, depth + 1);
+                out << pad << "- " << inner.str().substr(indent + 2);
+            } else {
+                out << pad << "-";
+                emitValueAfterKey(out, e, indent + 2, depth);
+            }
+        }
+    } else {
+        out << pad << scalarToYaml(obj) << "\n";
+    }
+}
+
+static ObjectPtr parseYaml(const std::string& name, const std::string& src) {
+    try {
+        return YamlParser(src).parse();
+    } catch (const YamlParseError& e) {
+        return makeError(name + ": " + e.message);
+    } catch (const YamlTooLarge& e) {
+        return e.error;
+    }
+}
+
+static ObjectPtr stringifyYaml(const std::string& name, const ObjectPtr& value, std::string& out) {
+    try {
+        if (isEmptyCollection(value)) {
+            out = value->type() == ObjectType::ARRAY ? "[]\n" : "{}\n";
+            return nullptr;
+        }
+        std::ostringstream ss;
+        emitYaml(ss, value, 0, 0);
+        out = ss.str();
+        return nullptr;
+    } catch (const YamlParseError& e) {
+        return makeError(name + ": " + e.message);
+    }
+}
+
+void initYamlModule() {
+    std::unordered_map<std::string, NativeFunc> funcs;
+
+    // parse(text) -> map, array or scalar
+    funcs["parse"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("parse: expected 1 argument");
+        if (args[0]->type() != ObjectType::STRING) return makeError("parse: argument must be a string");
+        return parseYaml("parse", getString(args[0]));
+    };
+
+    // stringify(value) -> YAML text in block style
+    funcs["stringify"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("stringify: expected 1 argument");
+        std::string out;
+        if (auto err = stringifyYaml("stringify", args[0], out)) return err;
+        return newString(out);
+    };
+
+    // read(path) -> parsed file contents
+    funcs["read"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 1) return makeError("read: expected 1 argument");
+        std::string path = getString(args[0]);
+        std::ifstream file(path);
+        if (!file.is_open()) return makeError("read: cannot open file '" + path + "'");
+        std::stringstream buffer;
+        buffer << file.rdbuf();
+        return parseYaml("read", buffer.str());
+    };
+
+    // write(path, value) -> bool
+    funcs["write"] = [](const std::vector<ObjectPtr>& args) -> ObjectPtr {
+        if (args.size() != 2) return makeError("write: expected 2 arguments");
+        std::string out;
+        if (auto err = stringifyYaml("write", args[1], out)) return err;
+        std::string path = getString(args[0]);
+        std::ofstream file(path);
+        if (!file.is_open()) return makeError("write: cannot open file '" + path + "'");
+        file << out;
+        return newBoolean(file.good());
+    };
+
+    Registry::instance().registerModule("yaml", funcs, "YAML Config Files", {
+        {"parse", {"(text)", "Parse YAML text into maps, arrays and scalars"}},
+        {"stringify", {"(value)", "Format a value as block-style YAML"}},
+        {"read", {"(path)", "Parse a YAML file"}},
+        {"write", {"(path, value)", "Write a value to a YAML file"}},
+    });
+}
+
+} // namespace darix::native
@@ -1,9 +1,18 @@
 #include "darix/object.hpp"
+#include "darix/decimal.hpp"
 #include <algorithm>
+#include <atomic>
+#include <charconv>
+#include <cmath>
 #include <cstdarg>
 #include <cstdio>
 #include <functional>
+#include <mutex>
 #include <sstream>
+#include <unordered_set>
+#ifndef _WIN32
+#include <sys/resource.h>
+#endif
 
 namespace darix {
 
@@ -33,6 +42,13 @@ const char* ObjectTypeToString(ObjectType type) {
         case ObjectType::BREAK_SIGNAL:     return "BREAK_SIGNAL";
         case ObjectType::CONTINUE_SIGNAL:  return "CONTINUE_SIGNAL";
         case ObjectType::EXCEPTION_SIGNAL: return "EXCEPTION_SIGNAL";
+        case ObjectType::HANDLE:           return "HANDLE";
+        case ObjectType::INT_ARRAY:        return "INT_ARRAY";
+        case ObjectType::FLOAT_ARRAY:      return "FLOAT_ARRAY";
+        case ObjectType::DECIMAL:          return "DECIMAL";
+        case ObjectType::COMPLEX:          return "COMPLEX";
+        case ObjectType::BUILDER:          return "BUILDER";
+        case ObjectType::WEAK_REF:         return "WEAK_REF";
     }
     return "UNKNOWN";
 }
@@ -59,6 +75,24 @@ std::string StackFrame::str() const {
 
 // ============ Helper functions ============
 
+// Containers being formatted on this thread. One met again inside itself is
+// shown as [...] or {...} instead of being formatted forever.
+static thread_local std::vector<const Object*> formatting;
+
+namespace {
+struct FormatGuard {
+    const Object* object;
+    bool cycle;
+    explicit FormatGuard(const Object* o)
+        : object(o), cycle(std::find(formatting.begin(), formatting.end(), o) != formatting.end()) {
+        if (!cycle) formatting.push_back(o);
+    }
+    ~FormatGuard() {
+        if (!cycle) formatting.pop_back();
+    }
+};
+} // namespace
+
 static std::string formatSequence(const std::string& prefix, const std::string& suffix, const std::vector<ObjectPtr>& elements) {
     if (elements.empty()) return prefix + suffix;
     std::string out = prefix;
@@ -87,14 +121,42 @@ static std::string formatEntries(const std::string& prefix, const std::string& s
 // ============ Concrete type inspect methods ============
 
 std::string Integer::inspect() const { return std::to_string(value); }
-std::string Float::inspect() const {
-    char buf[64];
-    std::snprintf(buf, sizeof(buf), "%g", value);
-    return buf;
+std::string Float::inspect() const { return formatFloat(value); }
+std::string Decimal::inspect() const { return formatDecimal(units, scale); }
+std::string Complex::inspect() const {
+    std::string im = formatFloat(imag);
+    if (im[0] != '-') im = "+" + im;
+    return "(" + formatFloat(real) + im + "i)";
+}
+std::string WeakRef::inspect() const {
+    auto object = target.lock();
+    return object ? "<weakref to " + std::string(ObjectTypeToString(object->type())) + ">" : "<weakref (dead)>";
 }
+std::string StringBuilder::inspect() const { return "<builder " + std::to_string(value.size()) + " bytes>"; }
 std::string Boolean::inspect() const { return value ? "true" : "false"; }
 std::string String::inspect() const { return value; }
-std::string Array::inspect() const { return formatSequence("[", "]", elements); }
+std::string Array::inspect() const {
+    FormatGuard guard(this);
+    return guard.cycle ? "[...]" : formatSequence("[", "]", elements);
+}
+
+std::string IntArray::inspect() const {
+    std::string out = "int_array([";
+    for (size_t i = 0; i < values.size(); i++) {
+        if (i > 0) out += ", ";
+        out += std::to_string(values[i]);
+    }
+    return out + "])";
+}
+
+std::string FloatArray::inspect() const {
+    std::string out = "float_array([";
+    for (size_t i = 0; i < values.size(); i++) {
+        if (i > 0) out += ", ";
+        out += formatFloat(values[i]);
+    }
+    return out + "])";
+}
 
 std::string ReturnValue::inspect() const { return value ? value->inspect() : ""; }
 
@@ -108,13 +170,19 @@ std::string StackTrace::inspect() const {
 
 std::string Exception::inspect() const {
     std::string out = exceptionType + ": " + message;
-    if (stackTrace) out += "\n" + stackTrace->inspect();
+    if (data) out += " " + data->inspect();
+    if (!suggestion.empty()) out += "\nSuggestion: " + suggestion;
     if (cause) out += "\nCaused by: " + cause->inspect();
     return out;
 }
 
+// The trace shows only where an exception goes unhandled, so str(e) of a
+// caught one is just its type and message.
 std::string ExceptionSignal::inspect() const {
-    return exception ? exception->inspect() : "Unhandled exception";
+    if (!exception) return "Unhandled exception";
+    std::string out = exception->inspect();
+    if (exception->stackTrace) out += "\n" + exception->stackTrace->inspect();
+    return out;
 }
 
 std::string Error::inspect() const {
@@ -148,11 +216,26 @@ std::string Function::inspect() const {
 }
 
 std::string CompiledFunction::inspect() const {
+    if (!source.empty()) return source;
     if (!name.empty()) return "<compiled func " + name + " params=" + std::to_string(numParameters) + " locals=" + std::to_string(numLocals) + ">";
     return "<compiled func params=" + std::to_string(numParameters) + " locals=" + std::to_string(numLocals) + ">";
 }
 
+ObjectPtr arityError(const Builtin& b, size_t argc) {
+    auto n = static_cast<int>(argc);
+    if (b.signature.empty() || (n >= b.minArgs && (b.maxArgs < 0 || n <= b.maxArgs))) return nullptr;
+    std::string expected = b.maxArgs < 0              ? "at least " + std::to_string(b.minArgs)
+                           : b.minArgs == b.maxArgs ? std::to_string(b.minArgs)
+                                                    : std::to_string(b.minArgs) + "-" + std::to_string(b.maxArgs);
+    bool plural = b.minArgs != 1 || (b.maxArgs != 1 && b.maxArgs >= 0);
+    auto message = b.name + ": expected " + expected + " argument" + (plural ? "s" : "") + ", got " + std::to_string(n) +
+                   "; the signature is " + b.name + b.signature;
+    return newExceptionSignal(std::static_pointer_cast<Exception>(newException(TYPE_ERROR, message)));
+}
+
 std::string Map::inspect() const {
+    FormatGuard guard(this);
+    if (guard.cycle) return "{...}";
     std::vector<std::pair<std::string, std::string>> entries;
     for (const auto& [k, v] : pairs) {
         std::string keyStr = k->inspect();
@@ -162,6 +245,8 @@ std::string Map::inspect() const {
 }
 
 std::string Hash::inspect() const {
+    FormatGuard guard(this);
+    if (guard.cycle) return "{...}";
     std::vector<std::pair<std::string, std::string>> entries;
     for (const auto& [hk, pair] : pairs) {
         std::string keyStr = pair.key->inspect();
@@ -170,11 +255,59 @@ std::string Hash::inspect() const {
     return formatEntries("{", "}", entries);
 }
 
+void Class::setMember(const std::string& key, ObjectPtr value) {
+    if (auto fn = std::dynamic_pointer_cast<Function>(value)) methods[key] = fn;
+    else methods.erase(key);
+    members[key] = std::move(value);
+}
+
 std::string Class::inspect() const { return "<class " + name + ">"; }
+namespace {
+// Leaked so instances destroyed during static destruction can still queue.
+struct FinalizerQueue {
+    std::mutex mutex;
+    std::vector<Finalizer> pending;
+};
+FinalizerQueue& finalizerQueue() {
+    static auto* queue = new FinalizerQueue;
+    return *queue;
+}
+} // namespace
+
+namespace detail {
+std::atomic<bool> finalizersQueued{false};
+} // namespace detail
+
+Instance::~Instance() {
+    if (finalizers.empty()) return;
+    auto& queue = finalizerQueue();
+    std::lock_guard<std::mutex> lock(queue.mutex);
+    for (auto& finalizer : finalizers) queue.pending.push_back(std::move(finalizer));
+    detail::finalizersQueued.store(true, std::memory_order_relaxed);
+}
+
+std::vector<Finalizer> takeFinalizers() {
+    auto& queue = finalizerQueue();
+    std::lock_guard<std::mutex> lock(queue.mutex);
+    detail::finalizersQueued.store(false, std::memory_order_relaxed);
+    return std::move(queue.pending);
+}
+
 std::string Instance::inspect() const { return "<" + cls->name + " instance>"; }
 std::string BoundMethod::inspect() const { return "<bound method " + fn->name + " of " + self->cls->name + ">"; }
 std::string Module::inspect() const { return "<module " + path + ">"; }
 
+bool Handle::close() {
+    if (closed) return false;
+    closed = true;
+    if (release) release();
+    return true;
+}
+
+std::string Handle::inspect() const {
+    return std::string(closed ? "<closed " : "<") + kind + " handle " + std::to_string(id) + ">";
+}
+
 // ============ HashKey ============
 
 static uint64_t fnv64a(const std::string& data) {
@@ -187,7 +320,13 @@ static uint64_t fnv64a(const std::string& data) {
 }
 
 uint64_t Integer::hashKey() const { return static_cast<uint64_t>(value); }
-uint64_t String::hashKey() const { return fnv64a(value); }
+uint64_t String::hashKey() const {
+    if (!hashed_.load(std::memory_order_acquire)) {
+        hash_.store(fnv64a(value), std::memory_order_relaxed);
+        hashed_.store(true, std::memory_order_release);
+    }
+    return hash_.load(std::memory_order_relaxed);
+}
 
 // ============ Environment ============
 
@@ -311,6 +450,70 @@ static void initSmallInts() {
     }
 }
 
+// ============ Allocation statistics ============
+
+namespace {
+struct AtomicKindStats {
+    std::atomic<int64_t> allocated{0};
+    std::atomic<int64_t> live{0};
+    std::atomic<int64_t> peak{0};
+};
+AtomicKindStats kindStats[static_cast<int>(StatKind::Count)];
+} // namespace
+
+namespace detail {
+bool objectStatsOn = false;
+
+// Relaxed atomics: parallel_map workers allocate concurrently, and the counts
+// only need to be exact once the run is over.
+void countAlloc(StatKind kind) {
+    auto& k = kindStats[static_cast<int>(kind)];
+    k.allocated.fetch_add(1, std::memory_order_relaxed);
+    int64_t live = k.live.fetch_add(1, std::memory_order_relaxed) + 1;
+    int64_t peak = k.peak.load(std::memory_order_relaxed);
+    while (live > peak && !k.peak.compare_exchange_weak(peak, live, std::memory_order_relaxed)) {}
+}
+
+void countFree(StatKind kind) {
+    kindStats[static_cast<int>(kind)].live.fetch_sub(1, std::memory_order_relaxed);
+}
+} // namespace detail
+
+void enableObjectStats() { detail::objectStatsOn = true; }
+bool objectStatsEnabled() { return detail::objectStatsOn; }
+
+KindStats objectStats(StatKind kind) {
+    auto& k = kindStats[static_cast<int>(kind)];
+    return {k.allocated.load(), k.live.load(), k.peak.load()};
+}
+
+const char* statKindName(StatKind kind) {
+    switch (kind) {
+        case StatKind::Integer: return "integer";
+        case StatKind::Float: return "float";
+        case StatKind::String: return "string";
+        case StatKind::Array: return "array";
+        case StatKind::Map: return "map";
+        case StatKind::Instance: return "instance";
+        case StatKind::Count: break;
+    }
+    return "?";
+}
+
+int64_t peakResidentBytes() {
+#ifdef _WIN32
+    return 0;
+#else
+    struct rusage usage {};
+    if (getrusage(RUSAGE_SELF, &usage) != 0) return 0;
+#ifdef __APPLE__
+    return usage.ru_maxrss;  // bytes on macOS
+#else
+    return static_cast<int64_t>(usage.ru_maxrss) * 1024;  // kilobytes on Linux
+#endif
+#endif
+}
+
 // ============ Constructors ============
 
 ObjectPtr newInteger(int64_t value) {
@@ -339,6 +542,32 @@ ObjectPtr newArray(std::vector<ObjectPtr> elements) {
     return obj;
 }
 
+ObjectPtr newIntArray(std::vector<int64_t> values) {
+    auto obj = std::make_shared<IntArray>();
+    obj->values = std::move(values);
+    return obj;
+}
+
+ObjectPtr newComplex(double real, double imag) {
+    auto obj = std::make_shared<Complex>();
+    obj->real = real;
+    obj->imag = imag;
+    return obj;
+}
+
+ObjectPtr newDecimal(int64_t units, int scale) {
+    auto obj = std::make_shared<Decimal>();
+    obj->units = units;
+    obj->scale = scale;
+    return obj;
+}
+
+ObjectPtr newFloatArray(std::vector<double> values) {
+    auto obj = std::make_shared<FloatArray>();
+    obj->values = std::move(values);
+    return obj;
+}
+
 ObjectPtr newMap(std::vector<std::pair<ObjectPtr, ObjectPtr>> pairs) {
     auto obj = std::make_shared<Map>();
     obj->pairs = std::move(pairs);
@@ -370,12 +599,50 @@ ObjectPtr newException(const std::string& exType, const std::string& message) {
     return obj;
 }
 
+bool exceptionMatches(const std::string& exType, const std::string& name) {
+    if (exType == name) return true;
+    // A host stop and exit() are left to clauses that name them.
+    if (name == ANY_EXCEPTION) return exType != INTERRUPT_ERROR && exType != SCRIPT_EXIT;
+    if (name == ARITHMETIC_ERROR) return exType == ZERO_DIV_ERROR || exType == OVERFLOW_ERROR;
+    if (name == LOOKUP_ERROR) return exType == INDEX_ERROR || exType == KEY_ERROR;
+    return false;
+}
+
 ObjectPtr newExceptionSignal(std::shared_ptr<Exception> ex) {
     auto obj = std::make_shared<ExceptionSignal>();
     obj->exception = ex;
     return obj;
 }
 
+ObjectPtr newScriptExit(int64_t code) {
+    auto ex = std::make_shared<Exception>();
+    ex->exceptionType = SCRIPT_EXIT;
+    ex->message = std::to_string(code);
+    ex->data = newMap({{newString("code"), newInteger(code)}});
+    return newExceptionSignal(ex);
+}
+
+bool isScriptExit(const ObjectPtr& result, int* code) {
+    auto sig = std::dynamic_pointer_cast<ExceptionSignal>(result);
+    if (!sig || !sig->exception || sig->exception->exceptionType != SCRIPT_EXIT) return false;
+    if (code) {
+        auto data = std::dynamic_pointer_cast<Map>(sig->exception->data);
+        auto value = data && !data->pairs.empty() ? std::dynamic_pointer_cast<Integer>(data->pairs[0].second) : nullptr;
+        *code = value ? static_cast<int>(value->value) : 1;
+    }
+    return true;
+}
+
+ObjectPtr newInternalError(const std::string& what, std::shared_ptr<StackTrace> trace) {
+    auto ex = std::make_shared<Exception>();
+    ex->exceptionType = INTERNAL_ERROR;
+    ex->message = what;
+    ex->stackTrace = trace;
+    std::fprintf(stderr, "darix: internal error: %s (this is a bug in DariX; please report it with the script that triggered it)\n",
+                 what.c_str());
+    return newExceptionSignal(ex);
+}
+
 ObjectPtr newClass(const std::string& name) {
     auto obj = std::make_shared<Class>();
     obj->name = name;
@@ -397,7 +664,25 @@ ObjectPtr newBoundMethod(std::shared_ptr<Instance> self, std::shared_ptr<Functio
 
 // ============ Helpers ============
 
-bool equals(ObjectPtr a, ObjectPtr b) {
+// Container pairs being compared on this thread. A pair met again inside
+// itself is taken as equal: nothing found so far tells them apart, and
+// comparing on would never end.
+static thread_local std::vector<std::pair<const Object*, const Object*>> comparing;
+
+namespace {
+struct CompareGuard {
+    bool cycle;
+    CompareGuard(const Object* a, const Object* b)
+        : cycle(std::find(comparing.begin(), comparing.end(), std::make_pair(a, b)) != comparing.end()) {
+        if (!cycle) comparing.push_back({a, b});
+    }
+    ~CompareGuard() {
+        if (!cycle) comparing.pop_back();
+    }
+};
+} // namespace
+
+bool equals(const ObjectPtr& a, const ObjectPtr& b) {
     if (!a || !b) return false;
     if (a->type() != b->type()) return false;
     switch (a->type()) {
@@ -405,22 +690,47 @@ bool equals(ObjectPtr a, ObjectPtr b) {
             return std::dynamic_pointer_cast<Integer>(a)->value == std::dynamic_pointer_cast<Integer>(b)->value;
         case ObjectType::FLOAT:
             return std::dynamic_pointer_cast<Float>(a)->value == std::dynamic_pointer_cast<Float>(b)->value;
-        case ObjectType::STRING:
-            return std::dynamic_pointer_cast<String>(a)->value == std::dynamic_pointer_cast<String>(b)->value;
+        case ObjectType::DECIMAL:
+            return compareDecimals(a, b) == 0;
+        case ObjectType::COMPLEX: {
+            auto& ca = static_cast<const Complex&>(*a);
+            auto& cb = static_cast<const Complex&>(*b);
+            return ca.real == cb.real && ca.imag == cb.imag;
+        }
+        case ObjectType::STRING: {
+            // Map lookups compare many keys: interned literals match by
+            // pointer, and cached hashes reject most mismatches cheaply.
+            if (a == b) return true;
+            auto& sa = static_cast<const String&>(*a);
+            auto& sb = static_cast<const String&>(*b);
+            if (sa.value.size() != sb.value.size()) return false;
+            if (sa.hasHash() && sb.hasHash() && sa.hashKey() != sb.hashKey()) return false;
+            return sa.value == sb.value;
+        }
         case ObjectType::BOOLEAN:
             return std::dynamic_pointer_cast<Boolean>(a)->value == std::dynamic_pointer_cast<Boolean>(b)->value;
+        case ObjectType::NULL_OBJ:
+            return true;
         case ObjectType::ARRAY: {
             auto aa = std::dynamic_pointer_cast<Array>(a);
             auto bb = std::dynamic_pointer_cast<Array>(b);
             if (aa->elements.size() != bb->elements.size()) return false;
+            CompareGuard guard(a.get(), b.get());
+            if (guard.cycle) return true;
             for (size_t i = 0; i < aa->elements.size(); i++)
                 if (!equals(aa->elements[i], bb->elements[i])) return false;
             return true;
         }
+        case ObjectType::INT_ARRAY:
+            return std::static_pointer_cast<IntArray>(a)->values == std::static_pointer_cast<IntArray>(b)->values;
+        case ObjectType::FLOAT_ARRAY:
+            return std::static_pointer_cast<FloatArray>(a)->values == std::static_pointer_cast<FloatArray>(b)->values;
         case ObjectType::MAP: {
             auto ma = std::dynamic_pointer_cast<Map>(a);
             auto mb = std::dynamic_pointer_cast<Map>(b);
             if (ma->pairs.size() != mb->pairs.size()) return false;
+            CompareGuard guard(a.get(), b.get());
+            if (guard.cycle) return true;
             for (auto& [ka, va] : ma->pairs) {
                 bool found = false;
                 for (auto& [kb, vb] : mb->pairs) {
@@ -435,6 +745,26 @@ bool equals(ObjectPtr a, ObjectPtr b) {
     }
 }
 
+bool hasIdentity(const ObjectPtr& value) {
+    switch (value->type()) {
+        case ObjectType::INTEGER:
+        case ObjectType::FLOAT:
+        case ObjectType::DECIMAL:
+        case ObjectType::COMPLEX:
+        case ObjectType::BOOLEAN:
+        case ObjectType::NULL_OBJ:
+            return false;
+        default:
+            return true;
+    }
+}
+
+bool sameObject(const ObjectPtr& a, const ObjectPtr& b) {
+    if (a == b) return true;
+    if (!a || !b || hasIdentity(a)) return false;
+    return equals(a, b);
+}
+
 bool isTruthy(ObjectPtr obj) {
     if (!obj) return false;
     if (obj == getNull()) return false;
@@ -445,6 +775,10 @@ bool isTruthy(ObjectPtr obj) {
             return std::dynamic_pointer_cast<Integer>(obj)->value != 0;
         case ObjectType::FLOAT:
             return std::dynamic_pointer_cast<Float>(obj)->value != 0;
+        case ObjectType::DECIMAL:
+            return std::static_pointer_cast<Decimal>(obj)->units != 0;
+        case ObjectType::COMPLEX:
+            return std::static_pointer_cast<Complex>(obj)->real != 0 || std::static_pointer_cast<Complex>(obj)->imag != 0;
         case ObjectType::STRING:
             return !std::dynamic_pointer_cast<String>(obj)->value.empty();
         default:
@@ -452,11 +786,417 @@ bool isTruthy(ObjectPtr obj) {
     }
 }
 
+// A module's names starting with _ are its private helpers.
+static bool isExported(const std::string& name) { return name.empty() || name[0] != '_'; }
+
+std::shared_ptr<Array> forInSteps(const ObjectPtr& value, bool pairs) {
+    std::vector<ObjectPtr> items;
+    // key is null for sequences, whose pairs are numbered instead.
+    auto add = [&](size_t i, ObjectPtr key, ObjectPtr v) {
+        if (!pairs) items.push_back(key ? key : v);
+        else items.push_back(newArray({key ? key : newInteger(static_cast<int64_t>(i)), v}));
+    };
+    if (auto a = std::dynamic_pointer_cast<Array>(value)) {
+        items.reserve(a->elements.size());
+        for (size_t i = 0; i < a->elements.size(); i++) add(i, nullptr, a->elements[i]);
+    } else if (auto s = std::dynamic_pointer_cast<String>(value)) {
+        items.reserve(s->value.size());
+        for (size_t i = 0; i < s->value.size(); i++) add(i, nullptr, newString(std::string(1, s->value[i])));
+    } else if (auto m = std::dynamic_pointer_cast<Map>(value)) {
+        items.reserve(m->pairs.size());
+        for (auto& [k, v] : m->pairs) add(0, k, v);
+    } else if (auto ints = std::dynamic_pointer_cast<IntArray>(value)) {
+        for (size_t i = 0; i < ints->values.size(); i++) add(i, nullptr, newInteger(ints->values[i]));
+    } else if (auto floats = std::dynamic_pointer_cast<FloatArray>(value)) {
+        for (size_t i = 0; i < floats->values.size(); i++) add(i, nullptr, newFloat(floats->values[i]));
+    } else if (auto mod = std::dynamic_pointer_cast<Module>(value)) {
+        for (auto& [name, v] : mod->env->store)
+            if (isExported(name)) add(0, newString(name), v);
+    } else {
+        return nullptr;
+    }
+    return std::static_pointer_cast<Array>(newArray(std::move(items)));
+}
+
+int64_t lengthOf(const ObjectPtr& value) {
+    size_t n = 0;
+    if (auto s = std::dynamic_pointer_cast<String>(value)) n = s->value.size();
+    else if (auto a = std::dynamic_pointer_cast<Array>(value)) n = a->elements.size();
+    else if (auto m = std::dynamic_pointer_cast<Map>(value)) n = m->pairs.size();
+    else if (auto ints = std::dynamic_pointer_cast<IntArray>(value)) n = ints->values.size();
+    else if (auto floats = std::dynamic_pointer_cast<FloatArray>(value)) n = floats->values.size();
+    else if (auto b = std::dynamic_pointer_cast<StringBuilder>(value)) n = b->value.size();
+    else if (auto mod = std::dynamic_pointer_cast<Module>(value))
+        n = std::count_if(mod->env->store.begin(), mod->env->store.end(), [](auto& entry) { return isExported(entry.first); });
+    else return -1;
+    return static_cast<int64_t>(n);
+}
+
+bool sequenceIndex(int64_t index, size_t length, size_t& out) {
+    auto n = static_cast<int64_t>(length);
+    if (index < 0) index += n;
+    if (index < 0 || index >= n) return false;
+    out = static_cast<size_t>(index);
+    return true;
+}
+
+ObjectPtr indexError(const std::string& what, int64_t index, size_t length) {
+    auto message = what + " index " + std::to_string(index) + " out of range for length " + std::to_string(length);
+    return newExceptionSignal(std::static_pointer_cast<Exception>(newException(INDEX_ERROR, message)));
+}
+
+void freeze(const ObjectPtr& value, const std::string& name) {
+    if (auto arr = std::dynamic_pointer_cast<Array>(value)) {
+        // Frozen already: also stops cycles.
+        if (arr->frozen) return;
+        arr->frozen = std::make_shared<const std::string>(name);
+        for (size_t i = 0; i < arr->elements.size(); i++) freeze(arr->elements[i], name + "[" + std::to_string(i) + "]");
+    } else if (auto m = std::dynamic_pointer_cast<Map>(value)) {
+        if (m->frozen) return;
+        m->frozen = std::make_shared<const std::string>(name);
+        for (auto& [k, v] : m->pairs) freeze(v, name + "[" + repr(k) + "]");
+    }
+}
+
+ObjectPtr frozenError(const ObjectPtr& container, const ObjectPtr& key) {
+    std::shared_ptr<const std::string> path;
+    if (auto arr = std::dynamic_pointer_cast<Array>(container)) path = arr->frozen;
+    else if (auto m = std::dynamic_pointer_cast<Map>(container)) path = m->frozen;
+    if (!path) return nullptr;
+    auto message = *path + (key ? "[" + repr(key) + "]" : "") + " is read-only";
+    return newExceptionSignal(std::static_pointer_cast<Exception>(newException(TYPE_ERROR, message)));
+}
+
+std::string formatFloat(double value) {
+    if (std::isnan(value)) return "nan";
+    if (std::isinf(value)) return value > 0 ? "inf" : "-inf";
+    char buf[64];
+    auto res = std::to_chars(buf, buf + sizeof(buf), value);
+    std::string out(buf, res.ptr);
+    if (out.find_first_of(".e") == std::string::npos) out += ".0";
+    return out;
+}
+
+// Uses only the escapes the lexer understands, so the result parses back.
+static std::string quoteString(const std::string& s) {
+    std::string out = "\"";
+    for (char c : s) {
+        switch (c) {
+            case '"':  out += "\\\""; break;
+            case '\\': out += "\\\\"; break;
+            case '\n': out += "\\n"; break;
+            case '\t': out += "\\t"; break;
+            case '\r': out += "\\r"; break;
+            default:   out += c; break;
+        }
+    }
+    return out + "\"";
+}
+
+std::string repr(ObjectPtr obj) {
+    if (!obj) return "null";
+    if (auto s = std::dynamic_pointer_cast<String>(obj)) return quoteString(s->value);
+    if (auto d = std::dynamic_pointer_cast<Decimal>(obj)) return d->inspect() + "d";
+    FormatGuard guard(obj.get());
+    if (auto a = std::dynamic_pointer_cast<Array>(obj)) {
+        if (guard.cycle) return "[...]";
+        std::string out = "[";
+        for (size_t i = 0; i < a->elements.size(); i++) {
+            if (i > 0) out += ", ";
+            out += repr(a->elements[i]);
+        }
+        return out + "]";
+    }
+    if (auto m = std::dynamic_pointer_cast<Map>(obj)) {
+        if (guard.cycle) return "{...}";
+        std::vector<std::pair<std::string, std::string>> entries;
+        for (const auto& [k, v] : m->pairs) {
+            std::string keyStr = repr(k);
+            entries.push_back({keyStr, keyStr + ": " + repr(v)});
+        }
+        return formatEntries("{", "}", entries);
+    }
+    if (auto h = std::dynamic_pointer_cast<Hash>(obj)) {
+        if (guard.cycle) return "{...}";
+        std::vector<std::pair<std::string, std::string>> entries;
+        for (const auto& [hk, pair] : h->pairs) {
+            std::string keyStr = repr(pair.key);
+            entries.push_back({keyStr, keyStr + ": " + repr(pair.value)});
+        }
+        return formatEntries("{", "}", entries);
+    }
+    return obj->inspect();
+}
+
+// ============ Pretty printing ============
+
+// A container's entries as pretty() sees them: elements for arrays, sorted
+// "key: " prefixes with their values for maps.
+struct PrettyEntry {
+    std::string prefix;
+    ObjectPtr value;
+};
+
+static bool prettyEntries(const ObjectPtr& obj, std::string* open, std::string* close, std::vector<PrettyEntry>* entries) {
+    if (auto a = std::dynamic_pointer_cast<Array>(obj)) {
+        *open = "["; *close = "]";
+        for (const auto& e : a->elements) entries->push_back({"", e});
+        return true;
+    }
+    std::vector<std::pair<ObjectPtr, ObjectPtr>> pairs;
+    if (auto m = std::dynamic_pointer_cast<Map>(obj)) {
+        pairs = m->pairs;
+    } else if (auto h = std::dynamic_pointer_cast<Hash>(obj)) {
+        for (const auto& [hk, pair] : h->pairs) pairs.push_back({pair.key, pair.value});
+    } else {
+        return false;
+    }
+    *open = "{"; *close = "}";
+    for (const auto& [k, v] : pairs) entries->push_back({repr(k) + ": ", v});
+    std::sort(entries->begin(), entries->end(),
+              [](const PrettyEntry& a, const PrettyEntry& b) { return a.prefix < b.prefix; });
+    return true;
+}
+
+// Single-line form, honouring maxDepth.
+static std::string prettyFlat(const ObjectPtr& obj, const PrettyOptions& options, int depth) {
+    std::string open, close;
+    std::vector<PrettyEntry> entries;
+    if (!prettyEntries(obj, &open, &close, &entries)) return repr(obj);
+    if (entries.empty()) return open + close;
+    FormatGuard guard(obj.get());
+    if (guard.cycle || (options.maxDepth >= 0 && depth >= options.maxDepth)) return open + "..." + close;
+    std::string out = open;
+    for (size_t i = 0; i < entries.size(); i++) {
+        if (i > 0) out += ", ";
+        out += entries[i].prefix + prettyFlat(entries[i].value, options, depth + 1);
+    }
+    return out + close;
+}
+
+static void prettyInto(std::string& out, const ObjectPtr& obj, const PrettyOptions& options, int depth, size_t column) {
+    std::string flat = prettyFlat(obj, options, depth);
+    std::string open, close;
+    std::vector<PrettyEntry> entries;
+    if (column + flat.size() <= static_cast<size_t>(options.width) || !prettyEntries(obj, &open, &close, &entries) ||
+        entries.empty() || (options.maxDepth >= 0 && depth >= options.maxDepth)) {
+        out += flat;
+        return;
+    }
+    FormatGuard guard(obj.get());
+    std::string pad(static_cast<size_t>(options.indent) * (depth + 1), ' ');
+    out += open + "\n";
+    for (size_t i = 0; i < entries.size(); i++) {
+        out += pad + entries[i].prefix;
+        prettyInto(out, entries[i].value, options, depth + 1, pad.size() + entries[i].prefix.size());
+        out += i + 1 < entries.size() ? ",\n" : "\n";
+    }
+    out += std::string(static_cast<size_t>(options.indent) * depth, ' ') + close;
+}
+
+std::string pretty(const ObjectPtr& obj, const PrettyOptions& options) {
+    std::string out;
+    prettyInto(out, obj, options, 0, 0);
+    return out;
+}
+
+// What findCycles follows out of value, each with the path segment that
+// reaches it.
+static std::vector<std::pair<ObjectPtr, std::string>> cycleEdges(const ObjectPtr& value) {
+    std::vector<std::pair<ObjectPtr, std::string>> edges;
+    if (auto a = std::dynamic_pointer_cast<Array>(value)) {
+        for (size_t i = 0; i < a->elements.size(); i++) edges.push_back({a->elements[i], "[" + std::to_string(i) + "]"});
+    } else if (auto m = std::dynamic_pointer_cast<Map>(value)) {
+        for (auto& [k, v] : m->pairs) edges.push_back({v, "[" + repr(k) + "]"});
+    } else if (auto h = std::dynamic_pointer_cast<Hash>(value)) {
+        for (auto& [hk, pair] : h->pairs) edges.push_back({pair.value, "[" + repr(pair.key) + "]"});
+    } else if (auto inst = std::dynamic_pointer_cast<Instance>(value)) {
+        for (auto& [name, field] : inst->fields) edges.push_back({field, "." + name});
+        std::sort(edges.begin(), edges.end(), [](auto& x, auto& y) { return x.second < y.second; });
+    } else if (auto bm = std::dynamic_pointer_cast<BoundMethod>(value)) {
+        edges.push_back({bm->self, ".self"});
+    }
+    return edges;
+}
+
+// Depth-first, with an explicit stack so a long linked list cannot overflow
+// the native one. A reference to an object still on the stack closes a cycle.
+// Paths are only spelled out for the cycles found, since a long chain would
+// otherwise build one ever longer string per node.
+std::vector<std::string> findCycles(const ObjectPtr& root, const std::string& rootName) {
+    struct Step {
+        ObjectPtr value;
+        std::string segment;  // from the step below
+        std::vector<std::pair<ObjectPtr, std::string>> edges;
+        size_t next = 0;
+    };
+    std::vector<Step> stack;
+    std::unordered_map<const Object*, size_t> onStack;  // object -> its index in stack
+    std::unordered_set<const Object*> done;
+    std::vector<std::string> cycles;
+    auto pathTo = [&](size_t depth) {
+        std::string path = rootName;
+        for (size_t i = 1; i <= depth; i++) path += stack[i].segment;
+        return path;
+    };
+    auto enter = [&](const ObjectPtr& value, const std::string& segment) {
+        if (!value || !hasIdentity(value) || done.count(value.get())) return;
+        if (auto it = onStack.find(value.get()); it != onStack.end()) {
+            cycles.push_back(pathTo(stack.size() - 1) + segment + " -> " + pathTo(it->second));
+            return;
+        }
+        onStack[value.get()] = stack.size();
+        stack.push_back({value, segment, cycleEdges(value)});
+    };
+    enter(root, "");
+    while (!stack.empty()) {
+        auto& top = stack.back();
+        if (top.next < top.edges.size()) {
+            auto edge = top.edges[top.next++];
+            enter(edge.first, edge.second);
+            continue;
+        }
+        onStack.erase(top.value.get());
+        done.insert(top.value.get());
+        stack.pop_back();
+    }
+    return cycles;
+}
+
+bool wrappingAdd(int64_t a, int64_t b, int64_t& out) {
+    out = static_cast<int64_t>(static_cast<uint64_t>(a) + static_cast<uint64_t>(b));
+    return ((a ^ out) & (b ^ out)) < 0;
+}
+
+bool wrappingSub(int64_t a, int64_t b, int64_t& out) {
+    out = static_cast<int64_t>(static_cast<uint64_t>(a) - static_cast<uint64_t>(b));
+    return ((a ^ b) & (a ^ out)) < 0;
+}
+
+static bool checkedArithmeticOn = false;
+
+void enableCheckedArithmetic() { checkedArithmeticOn = true; }
+bool checkedArithmeticEnabled() { return checkedArithmeticOn; }
+
+ObjectPtr overflowError(const std::string& op) {
+    return newExceptionSignal(std::dynamic_pointer_cast<Exception>(
+        newException(OVERFLOW_ERROR, "integer overflow in '" + op + "'")));
+}
+
+static SizeLimits limits;
+
+void setSizeLimits(const SizeLimits& l) { limits = l; }
+const SizeLimits& sizeLimits() { return limits; }
+
+static ObjectPtr sizeError(const char* what, int64_t limit, size_t size) {
+    if (limit <= 0 || size <= static_cast<size_t>(limit)) return nullptr;
+    return newExceptionSignal(std::dynamic_pointer_cast<Exception>(newException(
+        RESOURCE_ERROR, std::string(what) + " of " + std::to_string(size) + " exceeds the limit of " + std::to_string(limit))));
+}
+
+ObjectPtr stringSizeError(size_t size) { return sizeError("string length", limits.maxStringLen, size); }
+ObjectPtr arraySizeError(size_t size) { return sizeError("array length", limits.maxArrayLen, size); }
+ObjectPtr mapSizeError(size_t size) { return sizeError("map size", limits.maxMapEntries, size); }
+
+ObjectPtr resultSizeError(const ObjectPtr& value) {
+    if (!value || (limits.maxStringLen <= 0 && limits.maxArrayLen <= 0 && limits.maxMapEntries <= 0)) return nullptr;
+    switch (value->type()) {
+        case ObjectType::STRING: return stringSizeError(static_cast<const String&>(*value).value.size());
+        case ObjectType::ARRAY: case ObjectType::INT_ARRAY: case ObjectType::FLOAT_ARRAY:
+            return arraySizeError(static_cast<size_t>(lengthOf(value)));
+        case ObjectType::MAP: return mapSizeError(static_cast<const Map&>(*value).pairs.size());
+        default: return nullptr;
+    }
+}
+
+bool wrappingMul(int64_t a, int64_t b, int64_t& out) {
+    out = static_cast<int64_t>(static_cast<uint64_t>(a) * static_cast<uint64_t>(b));
+    if (a == 0 || b == 0) return false;
+    if ((a == -1 && b == INT64_MIN) || (b == -1 && a == INT64_MIN)) return true;
+    return out / a != b;
+}
+
+bool wrappingNeg(int64_t a, int64_t& out) {
+    out = static_cast<int64_t>(0 - static_cast<uint64_t>(a));
+    return a == INT64_MIN;
+}
+
+bool wrappingDiv(int64_t a, int64_t b, int64_t& out) {
+    if (a == INT64_MIN && b == -1) {
+        out = INT64_MIN;
+        return true;
+    }
+    out = a / b;
+    return false;
+}
+
+int64_t integerRemainder(int64_t a, int64_t b) { return b == -1 ? 0 : a % b; }
+
+static size_t editDistance(const std::string& a, const std::string& b) {
+    std::vector<size_t> row(b.size() + 1);
+    for (size_t j = 0; j <= b.size(); j++) row[j] = j;
+    for (size_t i = 1; i <= a.size(); i++) {
+        size_t diag = row[0];
+        row[0] = i;
+        for (size_t j = 1; j <= b.size(); j++) {
+            size_t up = row[j];
+            row[j] = std::min({row[j] + 1, row[j - 1] + 1, diag + (a[i - 1] == b[j - 1] ? 0 : 1)});
+            diag = up;
+        }
+    }
+    return row[b.size()];
+}
+
+std::string didYouMean(const std::string& name, const std::vector<std::string>& candidates) {
+    // Qualified candidates ("math.sqrt") are compared by their last part.
+    size_t limit = std::max<size_t>(1, name.size() / 4);
+    std::vector<std::pair<size_t, std::string>> close;
+    for (const auto& c : candidates) {
+        auto dot = c.rfind('.');
+        size_t d = editDistance(name, dot == std::string::npos ? c : c.substr(dot + 1));
+        if (d <= limit && c != name) close.push_back({d, c});
+    }
+    if (close.empty()) return "";
+    std::sort(close.begin(), close.end());
+    close.erase(std::unique(close.begin(), close.end()), close.end());
+    if (close.size() > 3) close.resize(3);
+    std::string out = "did you mean ";
+    for (size_t i = 0; i < close.size(); i++) {
+        if (i > 0) out += i + 1 == close.size() ? " or " : ", ";
+        out += "'" + close[i].second + "'";
+    }
+    return out + "?";
+}
+
 // ============ Pooled constructors ============
 
 ObjectPtr newIntegerFromPool(int64_t value) { return newInteger(value); }
 ObjectPtr newFloatFromPool(double value) { return newFloat(value); }
 ObjectPtr newStringFromPool(const std::string& value) { return newString(value); }
+
+// Bounds on the intern table, so a long-running host evaluating many
+// scripts (serve, the REPL) does not keep every literal it has seen.
+static constexpr size_t kMaxInterned = 1 << 16;
+static constexpr size_t kMaxInternedLength = 256;
+
+ObjectPtr internString(const std::string& value) {
+    static std::unordered_map<std::string, ObjectPtr> interned;
+    static std::mutex lock;
+    if (value.size() <= kMaxInternedLength) {
+        std::lock_guard<std::mutex> guard(lock);
+        auto it = interned.find(value);
+        if (it != interned.end()) return it->second;
+        if (interned.size() < kMaxInterned) {
+            auto str = newString(value);
+            std::static_pointer_cast<String>(str)->hashKey();
+            interned.emplace(value, str);
+            return str;
+        }
+    }
+    auto str = newString(value);
+    std::static_pointer_cast<String>(str)->hashKey();
+    return str;
+}
 ObjectPtr newArrayFromPool(std::vector<ObjectPtr> elements) { return newArray(std::move(elements)); }
 
 // ============ Fast arithmetic ============
@@ -475,12 +1215,14 @@ ObjectPtr mulIntegers(std::shared_ptr<Integer> left, std::shared_ptr<Integer> ri
 
 ObjectPtr divIntegers(std::shared_ptr<Integer> left, std::shared_ptr<Integer> right) {
     if (right->value == 0) return newError("division by zero");
-    return newIntegerFromPool(left->value / right->value);
+    int64_t v;
+    wrappingDiv(left->value, right->value, v);
+    return newIntegerFromPool(v);
 }
 
 ObjectPtr modIntegers(std::shared_ptr<Integer> left, std::shared_ptr<Integer> right) {
     if (right->value == 0) return newError("modulo by zero");
-    return newIntegerFromPool(left->value % right->value);
+    return newIntegerFromPool(integerRemainder(left->value, right->value));
 }
 
 ObjectPtr addFloats(std::shared_ptr<Float> left, std::shared_ptr<Float> right) {
@@ -501,13 +1243,18 @@ ObjectPtr divFloats(std::shared_ptr<Float> left, std::shared_ptr<Float> right) {
 }
 
 ObjectPtr concatStrings(std::shared_ptr<String> left, std::shared_ptr<String> right) {
+    if (auto err = stringSizeError(left->value.size() + right->value.size())) return err;
     return newStringFromPool(left->value + right->value);
 }
 
 ObjectPtr concatMultipleStrings(const std::vector<std::shared_ptr<String>>& parts) {
     if (parts.empty()) return newStringFromPool("");
     if (parts.size() == 1) return parts[0];
+    size_t size = 0;
+    for (const auto& s : parts) size += s->value.size();
+    if (auto err = stringSizeError(size)) return err;
     std::string result;
+    result.reserve(size);
     for (const auto& s : parts) result += s->value;
     return newStringFromPool(result);
 }
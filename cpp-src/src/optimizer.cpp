@@ -0,0 +1,269 @@
+#include "darix/optimizer.hpp"
+#include "darix/ast_walk.hpp"
+#include "darix/compiler.hpp"
+
+namespace darix {
+
+// ============ Constant folding ============
+
+// Mirrors Interpreter::evalInfixExpression for literal operands. Returns null
+// for anything that is not folded, including operations that raise.
+static ObjectPtr foldInfix(const std::string& op, const ObjectPtr& left, const ObjectPtr& right) {
+    bool leftNull = left->type() == ObjectType::NULL_OBJ;
+    bool rightNull = right->type() == ObjectType::NULL_OBJ;
+    if (leftNull || rightNull) {
+        if (op == "==") return newBoolean(leftNull == rightNull);
+        if (op == "!=") return newBoolean(leftNull != rightNull);
+        return nullptr;
+    }
+
+    if (auto l = std::dynamic_pointer_cast<Integer>(left)) {
+        if (auto r = std::dynamic_pointer_cast<Integer>(right)) {
+            // Overflow is left to the evaluator too, which warns or raises.
+            int64_t v;
+            if (op == "+") return wrappingAdd(l->value, r->value, v) ? nullptr : newInteger(v);
+            if (op == "-") return wrappingSub(l->value, r->value, v) ? nullptr : newInteger(v);
+            if (op == "*") return wrappingMul(l->value, r->value, v) ? nullptr : newInteger(v);
+            // '/' is left to the evaluator, which warns that lang v2 changes it.
+            if (op == "%") return r->value != 0 ? newInteger(integerRemainder(l->value, r->value)) : nullptr;
+            if (op == "<") return newBoolean(l->value < r->value);
+            if (op == ">") return newBoolean(l->value > r->value);
+            if (op == "<=") return newBoolean(l->value <= r->value);
+            if (op == ">=") return newBoolean(l->value >= r->value);
+            if (op == "==") return newBoolean(l->value == r->value);
+            if (op == "!=") return newBoolean(l->value != r->value);
+            return nullptr;
+        }
+    }
+
+    bool leftNum = left->type() == ObjectType::INTEGER || left->type() == ObjectType::FLOAT;
+    bool rightNum = right->type() == ObjectType::INTEGER || right->type() == ObjectType::FLOAT;
+    if (leftNum && rightNum) {
+        auto num = [](const ObjectPtr& o) {
+            if (auto f = std::dynamic_pointer_cast<Float>(o)) return f->value;
+            return static_cast<double>(std::dynamic_pointer_cast<Integer>(o)->value);
+        };
+        double l = num(left), r = num(right);
+        if (op == "+") return newFloat(l + r);
+        if (op == "-") return newFloat(l - r);
+        if (op == "*") return newFloat(l * r);
+        if (op == "/") return r != 0 ? newFloat(l / r) : nullptr;
+        if (op == "<") return newBoolean(l < r);
+        if (op == ">") return newBoolean(l > r);
+        if (op == "<=") return newBoolean(l <= r);
+        if (op == ">=") return newBoolean(l >= r);
+        if (op == "==") return newBoolean(l == r);
+        if (op == "!=") return newBoolean(l != r);
+        return nullptr;
+    }
+
+    auto ls = std::dynamic_pointer_cast<String>(left);
+    auto rs = std::dynamic_pointer_cast<String>(right);
+    if (ls && rs) {
+        if (op == "+") return newString(ls->value + rs->value);
+        if (op == "==") return newBoolean(ls->value == rs->value);
+        if (op == "!=") return newBoolean(ls->value != rs->value);
+        if (op == "<") return newBoolean(ls->value < rs->value);
+        if (op == ">") return newBoolean(ls->value > rs->value);
+        if (op == "<=") return newBoolean(ls->value <= rs->value);
+        if (op == ">=") return newBoolean(ls->value >= rs->value);
+        return nullptr;
+    }
+
+    auto lb = std::dynamic_pointer_cast<Boolean>(left);
+    auto rb = std::dynamic_pointer_cast<Boolean>(right);
+    if (lb && rb) {
+        if (op == "==") return newBoolean(lb->value == rb->value);
+        if (op == "!=") return newBoolean(lb->value != rb->value);
+    }
+    return nullptr;
+}
+
+static bool isLogicalAnd(const std::string& op) { return op == "&&" || op == "and"; }
+static bool isLogicalOr(const std::string& op) { return op == "||" || op == "or"; }
+
+ObjectPtr foldConstExpr(Node* node, bool* ok) {
+    *ok = false;
+    ObjectPtr result;
+
+    if (auto intLit = dynamic_cast<IntegerLiteral*>(node)) result = newInteger(intLit->value);
+    else if (auto floatLit = dynamic_cast<FloatLiteral*>(node)) result = newFloat(floatLit->value);
+    else if (auto strLit = dynamic_cast<StringLiteral*>(node)) result = newString(strLit->value);
+    else if (auto boolLit = dynamic_cast<BooleanLiteral*>(node)) result = newBoolean(boolLit->value);
+    else if (dynamic_cast<NullLiteral*>(node)) result = getNull();
+    else if (auto prefix = dynamic_cast<PrefixExpression*>(node)) {
+        bool rightOk = false;
+        auto right = foldConstExpr(prefix->right.get(), &rightOk);
+        if (!rightOk) return nullptr;
+        if (prefix->op == "!") result = newBoolean(!isTruthy(right));
+        else if (prefix->op == "-") {
+            int64_t v;
+            if (auto i = std::dynamic_pointer_cast<Integer>(right)) result = wrappingNeg(i->value, v) ? nullptr : newInteger(v);
+            else if (auto f = std::dynamic_pointer_cast<Float>(right)) result = newFloat(-f->value);
+        }
+    } else if (auto infix = dynamic_cast<InfixExpression*>(node)) {
+        bool leftOk = false, rightOk = false;
+        auto left = foldConstExpr(infix->left.get(), &leftOk);
+        if (!leftOk) return nullptr;
+        // A constant left operand can decide && and || without the right one,
+        // which is never evaluated in that case.
+        if (isLogicalAnd(infix->op) && !isTruthy(left)) result = newBoolean(false);
+        else if (isLogicalOr(infix->op) && isTruthy(left)) result = newBoolean(true);
+        else {
+            auto right = foldConstExpr(infix->right.get(), &rightOk);
+            if (!rightOk) return nullptr;
+            if (isLogicalAnd(infix->op) || isLogicalOr(infix->op)) result = newBoolean(isTruthy(right));
+            else result = foldInfix(infix->op, left, right);
+        }
+    }
+
+    *ok = result != nullptr;
+    return result;
+}
+
+// ============ Optimizer pass ============
+
+static Token tokenAt(Node& node) {
+    auto info = tokenInfoFromNode(&node);
+    Token tok;
+    tok.file = info.file;
+    tok.line = info.line;
+    tok.column = info.column;
+    tok.offset = node.span.start;
+    tok.endOffset = node.span.end;
+    return tok;
+}
+
+static bool isLiteral(Node* node) {
+    return dynamic_cast<IntegerLiteral*>(node) || dynamic_cast<FloatLiteral*>(node) ||
+           dynamic_cast<StringLiteral*>(node) || dynamic_cast<BooleanLiteral*>(node) ||
+           dynamic_cast<NullLiteral*>(node);
+}
+
+// Builds the literal node for a folded value, keeping the position of the
+// expression it replaces for error messages and debug info.
+static ExpressionPtr makeLiteral(const ObjectPtr& value, Expression& at) {
+    Token tok = tokenAt(at);
+    tok.literal = value->inspect();
+    ExpressionPtr lit;
+    if (auto i = std::dynamic_pointer_cast<Integer>(value)) {
+        auto n = std::make_shared<IntegerLiteral>();
+        n->tag = NodeType::INTEGER_LITERAL;
+        tok.type = TokenType::INT; n->token = tok; n->value = i->value; lit = n;
+    } else if (auto f = std::dynamic_pointer_cast<Float>(value)) {
+        auto n = std::make_shared<FloatLiteral>();
+        n->tag = NodeType::FLOAT_LITERAL;
+        tok.type = TokenType::FLOAT; n->token = tok; n->value = f->value; lit = n;
+    } else if (auto s = std::dynamic_pointer_cast<String>(value)) {
+        auto n = std::make_shared<StringLiteral>();
+        n->tag = NodeType::STRING_LITERAL;
+        tok.type = TokenType::STRING; n->token = tok; n->value = s->value; lit = n;
+    } else if (auto b = std::dynamic_pointer_cast<Boolean>(value)) {
+        auto n = std::make_shared<BooleanLiteral>();
+        n->tag = NodeType::BOOLEAN_LITERAL;
+        tok.type = b->value ? TokenType::TRUE : TokenType::FALSE; n->token = tok; n->value = b->value; lit = n;
+    } else {
+        auto n = std::make_shared<NullLiteral>();
+        n->tag = NodeType::NULL_LITERAL;
+        tok.type = TokenType::NULL_TOKEN; tok.literal = "null"; n->token = tok; lit = n;
+    }
+    lit->span = at.span;
+    return lit;
+}
+
+// !!x -> x, for expressions whose value is only tested for truthiness
+static ExpressionPtr stripDoubleNegation(ExpressionPtr e) {
+    while (auto outer = std::dynamic_pointer_cast<PrefixExpression>(e)) {
+        auto inner = std::dynamic_pointer_cast<PrefixExpression>(outer->right);
+        if (outer->op != "!" || !inner || inner->op != "!") break;
+        e = inner->right;
+    }
+    return e;
+}
+
+static ExpressionPtr optimizeExpression(const ExpressionPtr& expr) {
+    if (auto infix = std::dynamic_pointer_cast<InfixExpression>(expr)) {
+        if (isLogicalAnd(infix->op) || isLogicalOr(infix->op)) {
+            infix->left = stripDoubleNegation(infix->left);
+            infix->right = stripDoubleNegation(infix->right);
+        }
+    } else if (auto ifExpr = std::dynamic_pointer_cast<IfExpression>(expr)) {
+        ifExpr->condition = stripDoubleNegation(ifExpr->condition);
+    } else if (auto whileExpr = std::dynamic_pointer_cast<WhileExpression>(expr)) {
+        whileExpr->condition = stripDoubleNegation(whileExpr->condition);
+    }
+
+    if (isLiteral(expr.get())) return expr;
+    bool ok = false;
+    auto value = foldConstExpr(expr.get(), &ok);
+    if (ok) return makeLiteral(value, *expr);
+    return expr;
+}
+
+static StatementPtr expressionStatement(const ExpressionPtr& expr, Statement& at) {
+    auto stmt = std::make_shared<ExpressionStatement>();
+    stmt->tag = NodeType::EXPRESSION_STATEMENT;
+    stmt->token = tokenAt(at);
+    stmt->expression = expr;
+    stmt->span = at.span;
+    return stmt;
+}
+
+// A statement-level if with a constant condition is replaced by the branch it
+// takes. The branch block still gets its own scope, as it would under the if.
+// Dead code becomes a null statement so a function's implicit result is kept.
+static StatementPtr optimizeStatement(const StatementPtr& stmt) {
+    if (auto es = std::dynamic_pointer_cast<ExpressionStatement>(stmt)) {
+        auto ifExpr = std::dynamic_pointer_cast<IfExpression>(es->expression);
+        if (!ifExpr || !isLiteral(ifExpr->condition.get())) return stmt;
+        bool ok = false;
+        auto cond = foldConstExpr(ifExpr->condition.get(), &ok);
+        ExpressionPtr taken = isTruthy(cond) ? ExpressionPtr(ifExpr->consequence) : ifExpr->alternative;
+        if (!taken) taken = makeLiteral(getNull(), *ifExpr);
+        return expressionStatement(taken, *stmt);
+    }
+    if (auto ws = std::dynamic_pointer_cast<WhileStatement>(stmt)) {
+        ws->condition = stripDoubleNegation(ws->condition);
+        bool ok = false;
+        auto cond = foldConstExpr(ws->condition.get(), &ok);
+        if (ok && !isTruthy(cond)) {
+            // The loop never runs, so neither does a break: only the else block is left.
+            if (ws->elseBlock) return expressionStatement(ExpressionPtr(ws->elseBlock), *stmt);
+            return expressionStatement(makeLiteral(getNull(), *ws->condition), *stmt);
+        }
+    } else if (auto fs = std::dynamic_pointer_cast<ForStatement>(stmt)) {
+        fs->condition = stripDoubleNegation(fs->condition);
+    } else if (auto as = std::dynamic_pointer_cast<AssertStatement>(stmt)) {
+        as->condition = stripDoubleNegation(as->condition);
+    }
+    return stmt;
+}
+
+// Drops literal expression statements, except the last one in a list whose
+// value may be the result of the block or program.
+static void removeDeadLiterals(std::vector<StatementPtr>& stmts) {
+    if (stmts.size() < 2) return;
+    std::vector<StatementPtr> kept;
+    kept.reserve(stmts.size());
+    for (size_t i = 0; i < stmts.size(); i++) {
+        auto es = dynamic_cast<ExpressionStatement*>(stmts[i].get());
+        if (i + 1 < stmts.size() && es && isLiteral(es->expression.get())) continue;
+        kept.push_back(stmts[i]);
+    }
+    stmts.swap(kept);
+}
+
+void optimizeProgram(Program* program) {
+    walk::Rewriter rewriter;
+    rewriter.expression = optimizeExpression;
+    rewriter.statement = optimizeStatement;
+    walk::rewrite(program, rewriter);
+
+    walk::inspect(program, [](Node* node) {
+        if (auto p = dynamic_cast<Program*>(node)) removeDeadLiterals(p->statements);
+        else if (auto b = dynamic_cast<BlockStatement*>(node)) removeDeadLiterals(b->statements);
+        return true;
+    });
+}
+
+} // namespace darix
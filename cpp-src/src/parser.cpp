@@ -1,4 +1,7 @@
 #include "darix/parser.hpp"
+#include "darix/ast_walk.hpp"
+#include "darix/decimal.hpp"
+#include <algorithm>
 #include <charconv>
 #include <sstream>
 
@@ -6,6 +9,7 @@ namespace darix {
 
 static std::unordered_map<TokenType, int> precedences = {
     {TokenType::ASSIGN,   ASSIGN},
+    {TokenType::PIPE_FORWARD, PIPELINE},
     {TokenType::OR,       OR},
     {TokenType::AND,      AND},
     {TokenType::OR_KW,    OR},
@@ -41,6 +45,7 @@ void Parser::registerParseFns() {
     prefixParseFns_[TokenType::IDENT]    = [this]() { return parseIdentifier(); };
     prefixParseFns_[TokenType::INT]      = [this]() { return parseIntegerLiteral(); };
     prefixParseFns_[TokenType::FLOAT]    = [this]() { return parseFloatLiteral(); };
+    prefixParseFns_[TokenType::DECIMAL]  = [this]() { return parseDecimalLiteral(); };
     prefixParseFns_[TokenType::STRING]   = [this]() { return parseStringLiteral(); };
     prefixParseFns_[TokenType::BANG]     = [this]() { return parsePrefixExpression(); };
     prefixParseFns_[TokenType::MINUS]    = [this]() { return parsePrefixExpression(); };
@@ -77,6 +82,7 @@ void Parser::registerParseFns() {
     infixParseFns_[TokenType::AND_KW]    = [this](auto l) { return parseInfixExpression(l); };
     infixParseFns_[TokenType::IN]        = [this](auto l) { return parseInExpression(l); };
     infixParseFns_[TokenType::IS]        = [this](auto l) { return parseIsExpression(l); };
+    infixParseFns_[TokenType::PIPE_FORWARD] = [this](auto l) { return parsePipelineExpression(l); };
     infixParseFns_[TokenType::LPAREN]    = [this](auto l) { return parseCallExpression(l); };
     infixParseFns_[TokenType::LBRACKET]  = [this](auto l) { return parseIndexExpression(l); };
     infixParseFns_[TokenType::DOT]       = [this](auto l) { return parseMemberExpression(l); };
@@ -92,16 +98,97 @@ const std::vector<std::string>& Parser::errors() const { return errors_; }
 std::shared_ptr<Program> Parser::parseProgram() {
     auto program = std::make_shared<Program>();
     program->tag = NodeType::PROGRAM;
+    program->span.start = curToken_.offset;
     while (curToken_.type != TokenType::EOF_TOKEN) {
-        if (auto stmt = parseStatement()) {
+        if (auto stmt = parseNextStatement()) {
             program->statements.push_back(stmt);
         }
-        nextToken();
     }
+    program->span.end = curToken_.endOffset;
     return program;
 }
 
+StatementPtr Parser::parseNextStatement() {
+    auto stmt = parseStatement();
+    nextToken();
+    return stmt;
+}
+
+ParseResult reparseProgram(const std::shared_ptr<Program>& previous, const std::string& previousSource,
+                           const std::string& source, const TextEdit& edit, const std::string& file) {
+    // Parsing a statement looks one token past its end, so a statement can be
+    // kept only when the statement after it also ends before the edit.
+    const auto& old = previous->statements;
+    size_t keep = 0;
+    while (keep + 1 < old.size() && old[keep + 1]->span.end < edit.start) keep++;
+
+    auto program = std::make_shared<Program>();
+    program->tag = NodeType::PROGRAM;
+    program->statements.assign(old.begin(), old.begin() + keep);
+
+    Lexer lexer(source, file);
+    if (keep > 0) lexer.seek(old[keep]->span.start);
+    Parser parser(lexer);
+    program->span.start = keep > 0 ? previous->span.start : parser.offset();
+
+    // A top-level statement parses the same wherever it is, so once parsing
+    // reaches the start of an old statement after the edit, it and everything
+    // after it would come out as before, only moved.
+    int delta = edit.newEnd - edit.oldEnd;
+    size_t next = keep;
+    while (!parser.atEnd()) {
+        int at = parser.offset();
+        while (next < old.size() && (old[next]->span.start < edit.oldEnd || old[next]->span.start + delta < at)) next++;
+        if (next < old.size() && old[next]->span.start + delta == at) break;
+        if (auto stmt = parser.parseNextStatement()) program->statements.push_back(stmt);
+    }
+
+    ParseResult result;
+    result.reusedStatements = keep;
+    if (!parser.atEnd()) {
+        // Lines move by the newlines the edit added or removed; columns only
+        // on the line the first reused statement starts on, when the edit
+        // ends on that line too.
+        auto newlines = [](const std::string& text, int from, int to) {
+            return static_cast<int>(std::count(text.begin() + from, text.begin() + to, '\n'));
+        };
+        auto column = [](const std::string& text, int offset) {
+            auto newline = offset > 0 ? text.rfind('\n', offset - 1) : std::string::npos;
+            return offset - (newline == std::string::npos ? 0 : static_cast<int>(newline) + 1);
+        };
+        int from = old[next]->span.start;
+        int lineDelta = newlines(source, edit.start, edit.newEnd) - newlines(previousSource, edit.start, edit.oldEnd);
+        int columnDelta = column(source, from + delta) - column(previousSource, from);
+        int firstLine = parser.line() - lineDelta;
+        for (size_t i = next; i < old.size(); i++) {
+            walk::inspect(old[i].get(), [&](Node* node) {
+                if (node->span.end > 0) node->span = {node->span.start + delta, node->span.end + delta};
+                walk::tokens(node, [&](Token& tok) {
+                    if (tok.line == firstLine) tok.column += columnDelta;
+                    tok.line += lineDelta;
+                    tok.offset += delta;
+                    tok.endOffset += delta;
+                });
+                return true;
+            });
+            program->statements.push_back(old[i]);
+        }
+        result.reusedStatements += old.size() - next;
+    }
+    program->span.end = static_cast<int>(source.size());
+    result.program = program;
+    result.errors = parser.errors();
+    return result;
+}
+
 StatementPtr Parser::parseStatement() {
+    int start = curToken_.offset;
+    auto stmt = parseStatementNode();
+    if (stmt) stmt->span = {start, curToken_.endOffset};
+    return stmt;
+}
+
+StatementPtr Parser::parseStatementNode() {
     if (curToken_.type == TokenType::ILLEGAL) {
         addError("illegal token: " + curToken_.literal);
         nextToken();
@@ -110,6 +197,7 @@ StatementPtr Parser::parseStatement() {
 
     switch (curToken_.type) {
         case TokenType::IMPORT:    return parseImportStatement();
+        case TokenType::FROM:      return parseFromImportStatement();
         case TokenType::CLASS:     return parseClassDeclaration();
         case TokenType::FUNCTION:  return parseFunctionDeclaration();
         case TokenType::VAR:       return parseLetStatement();
@@ -128,9 +216,11 @@ StatementPtr Parser::parseStatement() {
         case TokenType::NONLOCAL:  return parseNonlocalStatement();
         case TokenType::AT:        return parseDecoratedDefinition();
         case TokenType::WITH:      return parseWithStatement();
+        case TokenType::DEFER:     return parseDeferStatement();
         case TokenType::LBRACE:    return parseBlockStatementAsStatement();
         case TokenType::IDENT:
             if (isAssignment()) return parseAssignStatement();
+            if (atMatchStatement()) return parseMatchStatement();
             return parseExpressionStatement();
         case TokenType::RBRACE:
         case TokenType::SEMICOLON:
@@ -147,12 +237,15 @@ bool Parser::isAssignment() {
 ExpressionPtr Parser::parseExpression(int precedence) {
     auto it = prefixParseFns_.find(curToken_.type);
     if (it == prefixParseFns_.end()) {
-        addError("no prefix parse function for " + std::string(TokenTypeToString(curToken_.type)) + " found");
+        addErrorAt(curToken_, "no prefix parse function for " + std::string(TokenTypeToString(curToken_.type)) + " found",
+                   "expected an expression here");
         return nullptr;
     }
 
+    int start = curToken_.offset;
     auto leftExp = it->second();
     if (!leftExp) return nullptr;
+    leftExp->span = {start, curToken_.endOffset};
 
     while (peekPrecedence() > precedence) {
         auto it2 = infixParseFns_.find(peekToken_.type);
@@ -160,6 +253,7 @@ ExpressionPtr Parser::parseExpression(int precedence) {
         nextToken();
         leftExp = it2->second(leftExp);
         if (!leftExp) break;
+        leftExp->span = {start, curToken_.endOffset};
     }
 
     return leftExp;
@@ -187,6 +281,16 @@ ExpressionPtr Parser::parseIntegerLiteral() {
     return node;
 }
 
+ExpressionPtr Parser::parseDecimalLiteral() {
+    auto node = std::make_shared<DecimalLiteral>();
+    node->token = curToken_;
+    if (!parseDecimal(curToken_.literal, &node->units, &node->scale)) {
+        addError("decimal literal \"" + curToken_.literal + "d\" has more digits than fit");
+        return nullptr;
+    }
+    return node;
+}
+
 ExpressionPtr Parser::parseFloatLiteral() {
     auto node = std::make_shared<FloatLiteral>();
     node->token = curToken_;
@@ -302,18 +406,27 @@ ExpressionPtr Parser::parseMapLiteral() {
     nextToken();
     for (;;) {
         auto key = parseExpression(LOWEST);
-        if (!key || !expectPeek(TokenType::COLON)) return nullptr;
-        nextToken();
-        auto value = parseExpression(LOWEST);
-        if (!value) return nullptr;
+        ExpressionPtr value;
+        if (key && expectPeek(TokenType::COLON)) {
+            nextToken();
+            value = parseExpression(LOWEST);
+        }
+        if (!value) {
+            skipToListEnd(TokenType::RBRACE);
+            return lit;
+        }
         lit->pairs.push_back({key, value});
 
         if (!peekTokenIs(TokenType::COMMA)) break;
         nextToken(); // comma
+        if (peekTokenIs(TokenType::RBRACE)) {
+            nextToken(); // closing
+            return lit;
+        }
         nextToken(); // next key
     }
 
-    if (!expectPeek(TokenType::RBRACE)) return nullptr;
+    if (!expectListEnd(TokenType::RBRACE, "map entries")) skipToListEnd(TokenType::RBRACE);
     return lit;
 }
 
@@ -331,7 +444,9 @@ ExpressionPtr Parser::parseWhileExpression() {
 }
 
 ExpressionPtr Parser::parseForExpression() {
+    int start = curToken_.offset;
     auto stmt = parseForStatement();
+    if (stmt) stmt->span = {start, curToken_.endOffset};
     if (auto block = std::dynamic_pointer_cast<BlockStatement>(stmt)) {
         return block;
     }
@@ -341,6 +456,12 @@ ExpressionPtr Parser::parseForExpression() {
         block->statements.push_back(forStmt);
         return block;
     }
+    if (auto forIn = std::dynamic_pointer_cast<ForInStatement>(stmt)) {
+        auto block = std::make_shared<BlockStatement>();
+        block->token = forIn->token;
+        block->statements.push_back(forIn);
+        return block;
+    }
     if (stmt) {
         auto block = std::make_shared<BlockStatement>();
         block->token = curToken_;
@@ -438,7 +559,7 @@ ExpressionPtr Parser::parseMemberExpression(ExpressionPtr left) {
 
 ExpressionPtr Parser::parseAssignmentExpression(ExpressionPtr left) {
     if (!isValidAssignmentTarget(left)) {
-        addError("invalid assignment target");
+        addErrorAt(curToken_, "invalid assignment target", "only names, indexes and fields can be assigned; use == to compare");
         return nullptr;
     }
 
@@ -470,6 +591,27 @@ ExpressionPtr Parser::parseIsExpression(ExpressionPtr left) {
     return expr;
 }
 
+// x |> f is f(x), and x |> g(a, b) is g(x, a, b): the left side becomes the
+// first argument. Chains read left to right, x |> f |> g being g(f(x)), and
+// desugar here, so the backends only ever see calls.
+ExpressionPtr Parser::parsePipelineExpression(ExpressionPtr left) {
+    auto token = curToken_;
+    int prec = curPrecedence();
+    nextToken();
+    auto right = parseExpression(prec);
+    if (!right) return nullptr;
+    if (auto call = std::dynamic_pointer_cast<CallExpression>(right)) {
+        call->arguments.insert(call->arguments.begin(), left);
+        return call;
+    }
+    auto call = std::make_shared<CallExpression>();
+    call->tag = NodeType::CALL_EXPRESSION;
+    call->token = token;
+    call->function = right;
+    call->arguments.push_back(left);
+    return call;
+}
+
 // ============ Statement parse functions ============
 
 StatementPtr Parser::parseLetStatement() {
@@ -592,22 +734,37 @@ StatementPtr Parser::parseWhileStatement() {
     stmt->condition = parseExpression(LOWEST);
     if (!expectPeek(TokenType::RPAREN) || !expectPeek(TokenType::LBRACE)) return nullptr;
     stmt->body = parseBlockStatement();
+    if (!parseLoopElse(stmt->elseBlock)) return nullptr;
     return stmt;
 }
 
+// The optional `else { ... }` after a loop body; false on a syntax error.
+bool Parser::parseLoopElse(BlockStatementPtr& elseBlock) {
+    if (!peekTokenIs(TokenType::ELSE)) return true;
+    nextToken();
+    if (!expectPeek(TokenType::LBRACE)) return false;
+    elseBlock = parseBlockStatement();
+    return true;
+}
+
 StatementPtr Parser::parseForStatement() {
     auto stmt = std::make_shared<ForStatement>();
     stmt->token = curToken_;
     if (!expectPeek(TokenType::LPAREN)) return nullptr;
     nextToken();
+    if (curToken_.type == TokenType::IDENT && (peekToken_.type == TokenType::IN || peekToken_.type == TokenType::COMMA))
+        return parseForInStatement(stmt->token);
 
-    // init
+    // init and post are parsed without parseStatement, so they get their
+    // spans here; debug info and REPL sessions need them like any statement.
+    int start = curToken_.offset;
     if (curToken_.type != TokenType::SEMICOLON) {
         if (curToken_.type == TokenType::VAR) {
             stmt->init = parseLetStatement();
         } else {
             stmt->init = parseExpressionStatement();
         }
+        if (stmt->init) stmt->init->span = {start, curToken_.endOffset};
     }
     if (!expectCurrent(TokenType::SEMICOLON)) return nullptr;
     nextToken();
@@ -621,15 +778,38 @@ StatementPtr Parser::parseForStatement() {
 
     // post
     if (curToken_.type != TokenType::RPAREN) {
+        start = curToken_.offset;
         if (curToken_.type == TokenType::IDENT && peekToken_.type == TokenType::ASSIGN) {
             stmt->post = parseAssignStatement();
         } else {
             stmt->post = parseExpressionStatement();
         }
+        if (stmt->post) stmt->post->span = {start, curToken_.endOffset};
     }
 
     if (!expectPeek(TokenType::RPAREN) || !expectPeek(TokenType::LBRACE)) return nullptr;
     stmt->body = parseBlockStatement();
+    if (!parseLoopElse(stmt->elseBlock)) return nullptr;
+    return stmt;
+}
+
+// for (x in xs) / for (i, x in xs), with the current token on the first name.
+StatementPtr Parser::parseForInStatement(const Token& token) {
+    auto stmt = std::make_shared<ForInStatement>();
+    stmt->token = token;
+    stmt->value = std::static_pointer_cast<Identifier>(parseIdentifier());
+    if (peekToken_.type == TokenType::COMMA) {
+        nextToken();
+        if (!expectPeek(TokenType::IDENT)) return nullptr;
+        stmt->key = stmt->value;
+        stmt->value = std::static_pointer_cast<Identifier>(parseIdentifier());
+    }
+    if (!expectPeek(TokenType::IN)) return nullptr;
+    nextToken();
+    stmt->iterable = parseExpression(LOWEST);
+    if (!expectPeek(TokenType::RPAREN) || !expectPeek(TokenType::LBRACE)) return nullptr;
+    stmt->body = parseBlockStatement();
+    if (!parseLoopElse(stmt->elseBlock)) return nullptr;
     return stmt;
 }
 
@@ -687,15 +867,27 @@ std::shared_ptr<CatchClause> Parser::parseCatchClause() {
             firstIdent->token = curToken_;
             firstIdent->value = curToken_.literal;
 
-            if (peekTokenIs(TokenType::IDENT)) {
-                clause->exceptionType = firstIdent;
-                nextToken();
-                auto var = std::make_shared<Identifier>();
-                var->token = curToken_;
-                var->value = curToken_.literal;
-                clause->variable = var;
-            } else {
+            // A lone name is the variable; otherwise the names before it,
+            // separated by '|', are types.
+            if (!peekTokenIs(TokenType::PIPE) && !peekTokenIs(TokenType::IDENT)) {
                 clause->variable = firstIdent;
+            } else {
+                clause->exceptionTypes.push_back(firstIdent);
+                while (peekTokenIs(TokenType::PIPE)) {
+                    nextToken();
+                    if (!expectPeek(TokenType::IDENT)) return nullptr;
+                    auto type = std::make_shared<Identifier>();
+                    type->token = curToken_;
+                    type->value = curToken_.literal;
+                    clause->exceptionTypes.push_back(type);
+                }
+                if (peekTokenIs(TokenType::IDENT)) {
+                    nextToken();
+                    auto var = std::make_shared<Identifier>();
+                    var->token = curToken_;
+                    var->value = curToken_.literal;
+                    clause->variable = var;
+                }
             }
         }
         if (!expectPeek(TokenType::RPAREN)) return nullptr;
@@ -715,31 +907,60 @@ StatementPtr Parser::parseThrowStatement() {
     return stmt;
 }
 
+StatementPtr Parser::parseDeferStatement() {
+    auto stmt = std::make_shared<DeferStatement>();
+    stmt->token = curToken_;
+    nextToken();
+    stmt->expression = parseExpression(LOWEST);
+    if (!stmt->expression) return nullptr;
+    consumeOptionalSemicolon();
+    return stmt;
+}
+
 StatementPtr Parser::parseImportStatement() {
     auto stmt = std::make_shared<ImportStatement>();
     stmt->token = curToken_;
-
-    // Accept both: import "go:math" and import math
-    if (peekTokenIs(TokenType::STRING)) {
+    stmt->path = parseImportPath("import");
+    if (!stmt->path) return nullptr;
+    if (peekTokenIs(TokenType::AS)) {
         nextToken();
-        auto path = std::make_shared<StringLiteral>();
-        path->token = curToken_;
-        path->value = curToken_.literal;
-        stmt->path = path;
-    } else if (peekTokenIs(TokenType::IDENT)) {
+        if (!expectPeek(TokenType::IDENT)) return nullptr;
+        stmt->alias = std::static_pointer_cast<Identifier>(parseIdentifier());
+    }
+    consumeOptionalSemicolon();
+    return stmt;
+}
+
+// from "go:json" import json_parse, json_stringify
+StatementPtr Parser::parseFromImportStatement() {
+    auto stmt = std::make_shared<ImportStatement>();
+    stmt->token = curToken_;
+    stmt->path = parseImportPath("from");
+    if (!stmt->path) return nullptr;
+    if (!expectPeek(TokenType::IMPORT)) return nullptr;
+    while (true) {
+        if (!expectPeek(TokenType::IDENT)) return nullptr;
+        stmt->names.push_back(std::static_pointer_cast<Identifier>(parseIdentifier()));
+        if (!peekTokenIs(TokenType::COMMA)) break;
         nextToken();
-        auto path = std::make_shared<StringLiteral>();
-        path->token = curToken_;
-        path->value = curToken_.literal;
-        stmt->path = path;
-    } else {
-        addError("expected module name or string after import");
-        return nullptr;
     }
     consumeOptionalSemicolon();
     return stmt;
 }
 
+// Accept both: import "go:math" and import math
+std::shared_ptr<StringLiteral> Parser::parseImportPath(const std::string& keyword) {
+    if (!peekTokenIs(TokenType::STRING) && !peekTokenIs(TokenType::IDENT)) {
+        addError("expected module name or string after " + keyword);
+        return nullptr;
+    }
+    nextToken();
+    auto path = std::make_shared<StringLiteral>();
+    path->token = curToken_;
+    path->value = curToken_.literal;
+    return path;
+}
+
 StatementPtr Parser::parseFunctionDeclaration() {
     auto stmt = std::make_shared<FunctionDeclaration>();
     stmt->token = curToken_;
@@ -855,6 +1076,131 @@ StatementPtr Parser::parseWithStatement() {
     return stmt;
 }
 
+bool Parser::atMatchStatement() const {
+    if (curToken_.literal != "match" || !peekTokenIs(TokenType::LPAREN)) return false;
+    // Looks past the parenthesized subject on a copy of the lexer.
+    Lexer ahead = lexer_;
+    int depth = 1;
+    for (Token t = ahead.nextToken(); t.type != TokenType::EOF_TOKEN; t = ahead.nextToken()) {
+        if (t.type == TokenType::LPAREN) depth++;
+        else if (t.type == TokenType::RPAREN && --depth == 0) return ahead.nextToken().type == TokenType::LBRACE;
+    }
+    return false;
+}
+
+StatementPtr Parser::parseMatchStatement() {
+    auto stmt = std::make_shared<MatchStatement>();
+    stmt->token = curToken_;
+    if (!expectPeek(TokenType::LPAREN)) return nullptr;
+    nextToken();
+    stmt->subject = parseExpression(LOWEST);
+    if (!expectPeek(TokenType::RPAREN)) return nullptr;
+    if (!expectPeek(TokenType::LBRACE)) return nullptr;
+    nextToken();
+    while (!curTokenIs(TokenType::RBRACE)) {
+        if (!curTokenIs(TokenType::IDENT) || curToken_.literal != "case") {
+            addErrorAt(curToken_, "expected case or } in match statement, got " + std::string(TokenTypeToString(curToken_.type)),
+                       "each arm is written case pattern { ... }");
+            return nullptr;
+        }
+        auto arm = std::make_shared<MatchCase>();
+        arm->token = curToken_;
+        nextToken();
+        arm->pattern = parsePattern();
+        if (!arm->pattern) return nullptr;
+        if (peekTokenIs(TokenType::IF)) {
+            nextToken();
+            nextToken();
+            arm->guard = parseExpression(LOWEST);
+            if (!arm->guard) return nullptr;
+        }
+        if (!expectPeek(TokenType::LBRACE)) return nullptr;
+        arm->body = parseBlockStatement();
+        stmt->cases.push_back(arm);
+        nextToken();
+    }
+    return stmt;
+}
+
+// Parses the pattern starting at the current token, leaving its last token
+// current.
+std::shared_ptr<Pattern> Parser::parsePattern() {
+    auto pattern = std::make_shared<Pattern>();
+    pattern->token = curToken_;
+    auto name = [this] {
+        auto id = std::make_shared<Identifier>();
+        id->tag = NodeType::IDENTIFIER;
+        id->token = curToken_;
+        id->value = curToken_.literal;
+        return id;
+    };
+    switch (curToken_.type) {
+        case TokenType::IDENT:
+            pattern->kind = Pattern::Kind::Capture;
+            pattern->name = name();
+            return pattern;
+        case TokenType::LBRACKET:
+            pattern->kind = Pattern::Kind::Array;
+            while (!peekTokenIs(TokenType::RBRACKET)) {
+                nextToken();
+                if (curTokenIs(TokenType::ASTERISK)) {
+                    if (!expectPeek(TokenType::IDENT)) return nullptr;
+                    pattern->rest = name();
+                    if (!peekTokenIs(TokenType::RBRACKET)) {
+                        addErrorAt(peekToken_, "*" + pattern->rest->value + " must be the last element of an array pattern");
+                        return nullptr;
+                    }
+                    break;
+                }
+                auto element = parsePattern();
+                if (!element) return nullptr;
+                pattern->elements.push_back(element);
+                if (!peekTokenIs(TokenType::RBRACKET) && !expectPeek(TokenType::COMMA)) return nullptr;
+            }
+            nextToken();
+            return pattern;
+        case TokenType::LBRACE:
+            pattern->kind = Pattern::Kind::Map;
+            while (!peekTokenIs(TokenType::RBRACE)) {
+                nextToken();
+                auto key = parsePattern();
+                if (!key) return nullptr;
+                if (key->kind != Pattern::Kind::Literal) {
+                    addErrorAt(key->token, "map pattern keys must be literals");
+                    return nullptr;
+                }
+                if (!expectPeek(TokenType::COLON)) return nullptr;
+                nextToken();
+                auto value = parsePattern();
+                if (!value) return nullptr;
+                pattern->entries.push_back({key->value, value});
+                if (!peekTokenIs(TokenType::RBRACE) && !expectPeek(TokenType::COMMA)) return nullptr;
+            }
+            nextToken();
+            return pattern;
+        case TokenType::INT:
+        case TokenType::FLOAT:
+        case TokenType::DECIMAL:
+        case TokenType::STRING:
+        case TokenType::TRUE:
+        case TokenType::FALSE:
+        case TokenType::NULL_TOKEN:
+            pattern->value = prefixParseFns_[curToken_.type]();
+            return pattern->value ? pattern : nullptr;
+        case TokenType::MINUS:
+            if (peekTokenIs(TokenType::INT) || peekTokenIs(TokenType::FLOAT) || peekTokenIs(TokenType::DECIMAL)) {
+                pattern->value = parsePrefixExpression();
+                return pattern->value ? pattern : nullptr;
+            }
+            break;
+        default:
+            break;
+    }
+    addErrorAt(curToken_, "expected a pattern, got " + std::string(TokenTypeToString(curToken_.type)),
+               "a pattern is a literal, a name, _, [elements] or {\"key\": pattern}");
+    return nullptr;
+}
+
 StatementPtr Parser::parseDecoratedDefinition() {
     std::vector<ExpressionPtr> decorators;
 
@@ -863,6 +1209,7 @@ StatementPtr Parser::parseDecoratedDefinition() {
         auto decorator = parseExpression(LOWEST);
         if (decorator) decorators.push_back(decorator);
         consumeOptionalSemicolon();
+        nextToken(); // move past the decorator expression
     }
 
     StatementPtr def;
@@ -941,30 +1288,35 @@ std::vector<IdentifierPtr> Parser::parseIdentifierList(TokenType end) {
     return identifiers;
 }
 
+// Elements up to the closing end token, which may follow a trailing comma.
+// After an error the rest of the list is skipped, so the caller still gets
+// the elements parsed so far.
 std::vector<ExpressionPtr> Parser::parseExpressionList(TokenType end) {
     std::vector<ExpressionPtr> list;
 
     if (curTokenIs(end)) return list;
 
-    if (auto expr = parseExpression(LOWEST)) {
+    for (;;) {
+        auto expr = parseExpression(LOWEST);
+        if (!expr) {
+            skipToListEnd(end);
+            return list;
+        }
         list.push_back(expr);
-    }
-
-    while (peekTokenIs(TokenType::COMMA)) {
+        if (!peekTokenIs(TokenType::COMMA)) break;
         nextToken(); // comma
         if (peekTokenIs(end)) {
             nextToken(); // closing
             return list;
         }
         nextToken(); // next expr
-        if (auto expr = parseExpression(LOWEST)) {
-            list.push_back(expr);
-        }
     }
 
-    if (!expectPeek(end)) {
+    if (!expectListEnd(end, end == TokenType::RPAREN ? "arguments" : "array elements")) {
         if (isReplMode_ && peekTokenIs(TokenType::SEMICOLON)) {
             nextToken();
+        } else {
+            skipToListEnd(end);
         }
     }
 
@@ -985,10 +1337,46 @@ bool Parser::expectPeek(TokenType t) {
         addError("warning: expected " + std::string(TokenTypeToString(t)) + ", assuming complete expression");
         return true;
     }
-    addError("expected next token to be " + std::string(TokenTypeToString(t)) + ", got " + std::string(TokenTypeToString(peekToken_.type)));
+    addErrorAt(peekToken_, "expected next token to be " + std::string(TokenTypeToString(t)) + ", got " +
+                               std::string(TokenTypeToString(peekToken_.type)),
+               hintFor(t, peekToken_));
+    return false;
+}
+
+// Skips to the token closing a list, past any brackets nested in it, and
+// makes it current. A } that does not belong to the list most likely closes
+// the enclosing block, so skipping stops short of it, as it does at the end
+// of the input.
+void Parser::skipToListEnd(TokenType end) {
+    int depth = 0;
+    for (;;) {
+        auto t = peekToken_.type;
+        if (t == TokenType::EOF_TOKEN || (depth == 0 && t == TokenType::RBRACE && end != TokenType::RBRACE)) return;
+        nextToken();
+        if (depth == 0 && t == end) return;
+        if (t == TokenType::LPAREN || t == TokenType::LBRACKET || t == TokenType::LBRACE) depth++;
+        else if ((t == TokenType::RPAREN || t == TokenType::RBRACKET || t == TokenType::RBRACE) && depth > 0) depth--;
+    }
+}
+
+bool Parser::expectListEnd(TokenType end, const std::string& items) {
+    if (peekTokenIs(end) || (isReplMode_ && (peekTokenIs(TokenType::EOF_TOKEN) || peekTokenIs(TokenType::SEMICOLON))))
+        return expectPeek(end);
+    std::string hint;
+    if (prefixParseFns_.count(peekToken_.type)) hint = "missing ',' between " + items + "?";
+    else hint = hintFor(end, peekToken_);
+    addErrorAt(peekToken_, "expected , or " + std::string(TokenTypeToString(end)) + " between " + items + ", got " +
+                               std::string(TokenTypeToString(peekToken_.type)),
+               hint);
     return false;
 }
 
+std::string Parser::hintFor(TokenType expected, const Token& got) const {
+    if (got.type == TokenType::EOF_TOKEN) return "the input ended before this was closed";
+    if (expected == TokenType::COLON && got.type == TokenType::COMMA) return "map entries are written key: value";
+    return "";
+}
+
 bool Parser::expectCurrent(TokenType t) {
     if (curToken_.type == t) return true;
     addError("expected current token to be " + std::string(TokenTypeToString(t)) + ", got " + std::string(TokenTypeToString(curToken_.type)));
@@ -1015,6 +1403,33 @@ bool Parser::isValidAssignmentTarget(const ExpressionPtr& expr) const {
            std::dynamic_pointer_cast<MemberExpression>(expr);
 }
 
+void Parser::addErrorAt(const Token& tok, const std::string& msg, const std::string& hint) {
+    if (tok.line <= 0) {
+        addError(msg);
+        return;
+    }
+    std::string out = (tok.file.empty() ? "" : tok.file + ":") + std::to_string(tok.line) + ":" +
+                      std::to_string(tok.column) + ": " + msg;
+
+    const auto& src = lexer_.source();
+    size_t start = 0;
+    for (int line = 1; line < tok.line && start != std::string::npos; line++) {
+        start = src.find('\n', start);
+        if (start != std::string::npos) start++;
+    }
+    if (start != std::string::npos && start <= src.size()) {
+        size_t end = src.find('\n', start);
+        std::string text = src.substr(start, end == std::string::npos ? std::string::npos : end - start);
+        if (!text.empty() && text.back() == '\r') text.pop_back();
+        // Keep tabs so the caret lines up with the excerpt.
+        std::string caret;
+        for (int i = 0; i + 1 < tok.column && i < static_cast<int>(text.size()); i++) caret += text[i] == '\t' ? '\t' : ' ';
+        out += "\n    " + text + "\n    " + caret + "^";
+    }
+    if (!hint.empty()) out += "\n    hint: " + hint;
+    errors_.push_back(out);
+}
+
 void Parser::addError(const std::string& msg) {
     std::string formatted;
     auto file = curToken_.file;
@@ -0,0 +1,240 @@
+#include "darix/runner.hpp"
+#include "darix/compiler.hpp"
+#include "darix/interpreter.hpp"
+#include "darix/lang.hpp"
+#include "darix/lexer.hpp"
+#include "darix/native/native.hpp"
+#include "darix/optimizer.hpp"
+#include "darix/parser.hpp"
+#include "darix/vm.hpp"
+#include <fstream>
+#include <iostream>
+#include <regex>
+#include <sstream>
+
+namespace darix {
+
+Diagnostic parseDiagnostic(const std::string& error, const std::string& file) {
+    Diagnostic d{Diagnostic::Stage::Parse, error, file, 0, 0, SYNTAX_ERROR, "", ""};
+    // file:line:col: message, then an excerpt with a caret and a hint line
+    std::string first = error.substr(0, error.find('\n'));
+    static const std::regex located(R"(^(?:(.*):)?(\d+):(\d+): (.*)$)");
+    std::smatch m;
+    if (std::regex_match(first, m, located)) {
+        if (m[1].matched) d.file = m[1];
+        d.line = std::stoi(m[2]);
+        d.column = std::stoi(m[3]);
+        d.summary = m[4];
+    } else {
+        d.summary = first;
+    }
+    auto hint = error.find("\n    hint: ");
+    if (hint != std::string::npos) d.suggestion = error.substr(hint + 11);
+    return d;
+}
+
+Diagnostic runtimeDiagnostic(const ObjectPtr& failure, const std::string& file) {
+    Diagnostic d{Diagnostic::Stage::Runtime, failure->inspect(), file, 0, 0, "", "", ""};
+    const StackFrame* frame = nullptr;
+    if (auto err = std::dynamic_pointer_cast<Error>(failure)) {
+        d.code = err->errorType.empty() ? RUNTIME_ERROR : err->errorType;
+        d.summary = err->message;
+        d.suggestion = err->suggestion;
+        if (err->position.line > 0) {
+            if (!err->position.filename.empty()) d.file = err->position.filename;
+            d.line = err->position.line;
+            d.column = err->position.column;
+        } else if (!err->stackTrace.empty()) {
+            frame = &err->stackTrace.front();
+        }
+    } else if (auto sig = std::dynamic_pointer_cast<ExceptionSignal>(failure); sig && sig->exception) {
+        d.message = "Unhandled exception:\n" + d.message;
+        d.code = sig->exception->exceptionType;
+        d.summary = sig->exception->message;
+        d.suggestion = sig->exception->suggestion;
+        // The innermost frame comes first.
+        if (sig->exception->stackTrace && !sig->exception->stackTrace->frames.empty())
+            frame = &sig->exception->stackTrace->frames.front();
+    }
+    if (frame && frame->position.line > 0) {
+        if (!frame->position.filename.empty()) d.file = frame->position.filename;
+        d.line = frame->position.line;
+        d.column = frame->position.column;
+    }
+    return d;
+}
+
+std::string diagnosticJson(const Diagnostic& d) {
+    auto number = [](int n) { return n > 0 ? std::to_string(n) : std::string("null"); };
+    auto text = [](const std::string& s) { return s.empty() ? std::string("null") : native::jsonString(s); };
+    return "{\"file\":" + text(d.file) + ",\"line\":" + number(d.line) + ",\"col\":" + number(d.column) +
+           ",\"severity\":\"" + (d.stage == Diagnostic::Stage::Warning ? "warning" : "error") +
+           "\",\"code\":" + text(d.code) + ",\"message\":" + native::jsonString(d.summary.empty() ? d.message : d.summary) +
+           ",\"suggestion\":" + text(d.suggestion) + "}";
+}
+
+static bool readSource(const std::string& filename, std::string& out, RunResult& result) {
+    std::stringstream buf;
+    if (filename == "-") {
+        buf << std::cin.rdbuf();
+    } else {
+        std::ifstream file(filename, std::ios::binary);
+        if (!file.is_open()) {
+            result.diagnostics.push_back({Diagnostic::Stage::Load, "Error reading file: " + filename, filename});
+            result.exitCode = 1;
+            return false;
+        }
+        buf << file.rdbuf();
+    }
+    out = buf.str();
+    return true;
+}
+
+static bool checkParse(const std::vector<std::string>& errors, const std::string& filename, RunResult& result) {
+    if (errors.empty()) return true;
+    for (auto& e : errors) result.diagnostics.push_back(parseDiagnostic(e, filename));
+    result.exitCode = 1;
+    return false;
+}
+
+// Records value as the result, turning errors and uncaught exceptions into a
+// runtime diagnostic and a failing exit code, and exit(code) into code.
+static bool finish(ObjectPtr value, const std::string& filename, RunResult& result) {
+    result.value = value;
+    if (!value || (value->type() != ObjectType::ERROR && value->type() != ObjectType::EXCEPTION_SIGNAL)) return true;
+    // exit() stops the run without being an error.
+    if (isScriptExit(value, &result.exitCode)) return false;
+    result.diagnostics.push_back(runtimeDiagnostic(value, filename));
+    result.exitCode = 1;
+    return false;
+}
+
+// Bytecode for program, or null when the compiler cannot handle it or its
+// output fails verification.
+static std::shared_ptr<Bytecode> compileForVM(Interpreter& interp, Program* program) {
+    try {
+        Compiler compiler;
+        compiler.setBuiltins([&interp](const std::string& name, std::string* why) { return interp.bytecodeBuiltin(name, why); });
+        compiler.compile(program);
+        auto bc = compiler.bytecode();
+        std::string error;
+        return verifyBytecode(*bc, &error) ? bc : nullptr;
+    } catch (const std::exception&) {
+        return nullptr;
+    }
+}
+
+std::pair<std::shared_ptr<Program>, std::vector<std::string>> parseSource(const std::string& code, const std::string& filename) {
+    Lexer lexer(code, filename);
+    Parser parser(lexer);
+    auto program = parser.parseProgram();
+    if (parser.errors().empty()) {
+        program->strict = defaultStrictMode() || hasStrictPragma(program.get());
+        applyLanguageVersion(program.get(), sourceLanguageVersion(code));
+        optimizeProgram(program.get());
+    }
+    return {program, parser.errors()};
+}
+
+RunResult runSource(const std::string& source, const std::string& filename) {
+    RunResult result;
+    if (isBytecodeFile(source)) {
+        std::string error;
+        auto bc = loadBytecode(source, &error);
+        if (!bc) {
+            result.diagnostics.push_back({Diagnostic::Stage::Load, filename + ": " + error, filename});
+            result.exitCode = 1;
+            return result;
+        }
+        Interpreter interp;
+        if (!linkBuiltins(*bc, [&interp](const std::string& name, std::string* why) { return interp.bytecodeBuiltin(name, why); }, &error)) {
+            result.diagnostics.push_back({Diagnostic::Stage::Load, filename + ": " + error, filename});
+            result.exitCode = 1;
+            return result;
+        }
+        VM machine(bc);
+        machine.setInstructionBudget(defaultInstructionBudget());
+        finish(machine.run(), filename, result);
+        return result;
+    }
+
+    auto [program, errors] = parseSource(source, filename);
+    if (!checkParse(errors, filename, result)) return result;
+    Interpreter interp;
+    if (auto err = interp.check(program.get())) {
+        finish(err, filename, result);
+        return result;
+    }
+    // Tracing is done by the interpreter, so traced runs skip the VM. Only a
+    // program the compiler rejects falls back to the interpreter: once the VM
+    // has started, running again would repeat the side effects before an
+    // error.
+    auto bc = traceMode() == TraceMode::Off ? compileForVM(interp, program.get()) : nullptr;
+    ObjectPtr value;
+    if (bc) {
+        VM machine(bc);
+        machine.setInstructionBudget(defaultInstructionBudget());
+        value = machine.run();
+        // The program's value is its last expression, as the interpreter's.
+        if (value && value->type() == ObjectType::NULL_OBJ) value = machine.lastPopped();
+    } else {
+        value = interp.interpret(program.get());
+    }
+    finish(value, filename, result);
+    return result;
+}
+
+RunResult runScript(const std::string& filename) {
+    RunResult result;
+    std::string source;
+    if (!readSource(filename, source, result)) return result;
+    return runSource(source, filename);
+}
+
+RunResult runScripts(const std::vector<std::string>& preloads, const std::vector<std::string>& files) {
+    RunResult result;
+    std::vector<std::shared_ptr<Program>> programs;
+    std::vector<std::string> names;
+    for (auto* list : {&preloads, &files}) {
+        for (auto& filename : *list) {
+            std::string source;
+            if (!readSource(filename, source, result)) return result;
+            auto [program, errors] = parseSource(source, filename);
+            if (!checkParse(errors, filename, result)) return result;
+            programs.push_back(program);
+            names.push_back(filename);
+        }
+    }
+
+    Interpreter interp;
+    for (size_t i = 0; i < programs.size(); i++) {
+        if (!finish(interp.check(programs[i].get()), names[i], result)) return result;
+    }
+    for (size_t i = 0; i < programs.size(); i++) {
+        bool preload = i < preloads.size();
+        if (!finish(preload ? interp.interpret(programs[i].get()) : interp.interpretInScope(programs[i].get()), names[i], result))
+            break;
+    }
+    return result;
+}
+
+RunResult runScriptsIn(Interpreter& interp, const std::vector<std::string>& files) {
+    RunResult result;
+    std::vector<std::shared_ptr<Program>> programs;
+    for (auto& filename : files) {
+        std::string source;
+        if (!readSource(filename, source, result)) return result;
+        auto [program, errors] = parseSource(source, filename);
+        if (!checkParse(errors, filename, result)) return result;
+        programs.push_back(program);
+    }
+    for (size_t i = 0; i < programs.size(); i++) {
+        if (!finish(interp.check(programs[i].get()), files[i], result)) return result;
+    }
+    for (size_t i = 0; i < programs.size(); i++) {
+        if (!finish(interp.interpret(programs[i].get()), files[i], result)) break;
+    }
+    return result;
+}
+
+} // namespace darix
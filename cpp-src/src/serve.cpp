@@ -0,0 +1,501 @@
+#include "darix/serve.hpp"
+#include "darix/code.hpp"
+#include "darix/compiler.hpp"
+#include "darix/interpreter.hpp"
+#include "darix/native/native.hpp"
+#include "darix/runner.hpp"
+#include <algorithm>
+#include <cctype>
+#include <cerrno>
+#include <chrono>
+#include <cstdio>
+#include <cstring>
+#include <iostream>
+#include <sstream>
+
+#ifndef _WIN32
+#include <arpa/inet.h>
+#include <netinet/in.h>
+#include <poll.h>
+#include <signal.h>
+#include <sys/resource.h>
+#include <sys/socket.h>
+#include <sys/wait.h>
+#include <unistd.h>
+#endif
+
+namespace darix {
+
+// JSON-RPC 2.0 error codes.
+static constexpr int ParseError = -32700;
+static constexpr int InvalidRequest = -32600;
+static constexpr int MethodNotFound = -32601;
+static constexpr int InvalidParams = -32602;
+static constexpr int ServerError = -32000;
+
+static constexpr size_t MaxHeaderBytes = 64 * 1024;
+static constexpr size_t MaxBodyBytes = 8 * 1024 * 1024;
+
+bool parseListenAddress(const std::string& text, ServeOptions* options, std::string* error) {
+    auto colon = text.rfind(':');
+    std::string host = colon == std::string::npos ? options->host : text.substr(0, colon);
+    std::string port = colon == std::string::npos ? text : text.substr(colon + 1);
+    bool digits = !port.empty() && port.size() <= 5 && std::all_of(port.begin(), port.end(), ::isdigit);
+    int n = digits ? std::stoi(port) : 0;
+    if (n < 1 || n > 65535) {
+        *error = "invalid port in '" + text + "'";
+        return false;
+    }
+    options->host = host.empty() ? "0.0.0.0" : host;
+    options->port = n;
+    return true;
+}
+
+// ============ JSON ============
+
+// Requests and responses go through the json module, so the server reads
+// and writes JSON exactly as scripts do.
+static ObjectPtr jsonCall(const char* fn, ObjectPtr arg) {
+    auto& registry = native::Registry::instance();
+    registry.initAll();
+    return registry.get("json")->functions.at(fn)({arg});
+}
+
+static ObjectPtr parseJson(const std::string& text) { return jsonCall("parse", newString(text)); }
+
+static std::string toJson(ObjectPtr value) {
+    auto out = jsonCall("stringify", value);
+    return out->type() == ObjectType::STRING ? std::static_pointer_cast<String>(out)->value : "null";
+}
+
+static ObjectPtr object(std::vector<std::pair<std::string, ObjectPtr>> fields) {
+    std::vector<std::pair<ObjectPtr, ObjectPtr>> pairs;
+    for (auto& [k, v] : fields) pairs.push_back({newString(k), v ? v : getNull()});
+    return newMap(std::move(pairs));
+}
+
+static ObjectPtr field(const ObjectPtr& map, const std::string& key) {
+    auto m = std::dynamic_pointer_cast<Map>(map);
+    if (!m) return nullptr;
+    for (auto& [k, v] : m->pairs) {
+        auto s = std::dynamic_pointer_cast<String>(k);
+        if (s && s->value == key) return v;
+    }
+    return nullptr;
+}
+
+static ObjectPtr stringList(const std::vector<std::string>& items) {
+    std::vector<ObjectPtr> elems;
+    for (auto& s : items) elems.push_back(newString(s));
+    return newArray(std::move(elems));
+}
+
+// A failed method call; becomes the response's error member.
+struct RpcError {
+    int code;
+    std::string message;
+};
+
+static ObjectPtr errorResponse(ObjectPtr id, const RpcError& err) {
+    return object({{"jsonrpc", newString("2.0")},
+                   {"error", object({{"code", newInteger(err.code)}, {"message", newString(err.message)}})},
+                   {"id", id}});
+}
+
+// ============ Methods ============
+
+static bool stringParam(const ObjectPtr& params, const std::string& name, std::string* out, RpcError* err) {
+    auto v = std::dynamic_pointer_cast<String>(field(params, name));
+    if (!v) {
+        *err = {InvalidParams, "params." + name + " must be a string"};
+        return false;
+    }
+    *out = v->value;
+    return true;
+}
+
+// Reads an optional positive limit, which may only lower the server's.
+static bool limitParam(const ObjectPtr& params, const std::string& name, int* limit, RpcError* err) {
+    auto v = field(params, name);
+    if (!v || v->type() == ObjectType::NULL_OBJ) return true;
+    auto n = std::dynamic_pointer_cast<Integer>(v);
+    if (!n || n->value <= 0) {
+        *err = {InvalidParams, "params." + name + " must be a positive integer"};
+        return false;
+    }
+    if (n->value < *limit) *limit = static_cast<int>(n->value);
+    return true;
+}
+
+// The grants an evaluation runs under: the request's allow list, each of
+// which the server's grants must already allow, or else the server's own.
+// With no --allow the server grants nothing, so scripts get the core
+// language and no native module.
+static bool requestGrants(const ObjectPtr& params, const ServeOptions& options, std::string* grants, RpcError* err) {
+    *grants = options.allow;
+    auto v = field(params, "allow");
+    if (!v || v->type() == ObjectType::NULL_OBJ) return true;
+    std::vector<std::string> list;
+    if (auto s = std::dynamic_pointer_cast<String>(v)) {
+        std::stringstream in(s->value);
+        std::string item;
+        while (std::getline(in, item, ',')) list.push_back(item);
+    } else if (auto arr = std::dynamic_pointer_cast<Array>(v)) {
+        for (auto& e : arr->elements) {
+            auto s = std::dynamic_pointer_cast<String>(e);
+            if (!s) {
+                *err = {InvalidParams, "params.allow must be a string or an array of strings"};
+                return false;
+            }
+            list.push_back(s->value);
+        }
+    } else {
+        *err = {InvalidParams, "params.allow must be a string or an array of strings"};
+        return false;
+    }
+
+    // The policy is process-wide; the server only borrows it to compare
+    // grants, and each evaluation sets its own in the child process.
+    auto& policy = native::CapabilityPolicy::instance();
+    policy.reset();
+    std::string error;
+    policy.allow(options.allow, &error);
+    std::string joined;
+    for (auto& grant : list) {
+        auto dot = grant.find('.');
+        std::string mod = grant.substr(0, dot);
+        std::string fn = dot == std::string::npos ? "*" : grant.substr(dot + 1);
+        auto it = policy.grants().find(mod);
+        bool ok = fn == "*" ? it != policy.grants().end() && it->second.count("*") : policy.allows(mod, fn);
+        if (!ok) {
+            policy.reset();
+            *err = {InvalidParams, "grant '" + grant + "' is not allowed by the server"};
+            return false;
+        }
+        joined += (joined.empty() ? "" : ",") + grant;
+    }
+    policy.reset();
+    if (!policy.allow(joined, &error)) {
+        policy.reset();
+        *err = {InvalidParams, "params.allow: " + error};
+        return false;
+    }
+    policy.reset();
+    *grants = joined;
+    return true;
+}
+
+#ifndef _WIN32
+// Reads from the child's pipes until they close or the deadline passes, and
+// closes them. Output past limit bytes is dropped and flagged.
+static bool drain(int outFd, int errFd, int resultFd, std::chrono::steady_clock::time_point deadline, size_t limit,
+                  std::string* out, std::string* err, std::string* result, bool* truncated) {
+    struct Stream {
+        int fd;
+        std::string* text;
+        size_t limit;
+    } streams[] = {{outFd, out, limit}, {errFd, err, limit}, {resultFd, result, MaxBodyBytes}};
+    bool finished = true;
+    while (true) {
+        std::vector<pollfd> fds;
+        std::vector<Stream*> open;
+        for (auto& s : streams) {
+            if (s.fd < 0) continue;
+            fds.push_back({s.fd, POLLIN, 0});
+            open.push_back(&s);
+        }
+        if (fds.empty()) break;
+        auto left = std::chrono::duration_cast<std::chrono::milliseconds>(deadline - std::chrono::steady_clock::now()).count();
+        int ready = left > 0 ? poll(fds.data(), fds.size(), static_cast<int>(left)) : 0;
+        if (ready < 0 && errno == EINTR) continue;
+        if (ready <= 0) {
+            finished = false;
+            break;
+        }
+        for (size_t i = 0; i < fds.size(); i++) {
+            if (!(fds[i].revents & (POLLIN | POLLHUP | POLLERR))) continue;
+            char buf[4096];
+            ssize_t n = read(open[i]->fd, buf, sizeof(buf));
+            if (n <= 0) {
+                close(open[i]->fd);
+                open[i]->fd = -1;
+                continue;
+            }
+            size_t room = open[i]->limit - std::min(open[i]->limit, open[i]->text->size());
+            if (static_cast<size_t>(n) > room) *truncated = true;
+            open[i]->text->append(buf, std::min(room, static_cast<size_t>(n)));
+        }
+    }
+    for (auto& s : streams)
+        if (s.fd >= 0) close(s.fd);
+    return finished;
+}
+
+// Runs source in a child process under the request's grants and limits.
+// The child reports {ok, value, errors} as JSON on a pipe of its own, so
+// whatever the script prints cannot be mistaken for the result.
+static ObjectPtr evaluate(const std::string& source, const std::string& grants, int timeoutMs,
+                          int memoryMb, const ServeOptions& options, RpcError* err) {
+    int outPipe[2], errPipe[2], resultPipe[2];
+    if (pipe(outPipe) != 0 || pipe(errPipe) != 0 || pipe(resultPipe) != 0) {
+        *err = {ServerError, std::string("cannot create pipes: ") + std::strerror(errno)};
+        return nullptr;
+    }
+    std::fflush(stdout);
+    std::fflush(stderr);
+    pid_t pid = fork();
+    if (pid < 0) {
+        *err = {ServerError, std::string("cannot fork: ") + std::strerror(errno)};
+        return nullptr;
+    }
+    if (pid == 0) {
+        dup2(outPipe[1], STDOUT_FILENO);
+        dup2(errPipe[1], STDERR_FILENO);
+        close(outPipe[0]);
+        close(errPipe[0]);
+        close(resultPipe[0]);
+        rlimit mem{static_cast<rlim_t>(memoryMb) << 20, static_cast<rlim_t>(memoryMb) << 20};
+        setrlimit(RLIMIT_AS, &mem);
+        rlim_t cpu = static_cast<rlim_t>((timeoutMs + 999) / 1000);
+        rlimit cpuLimit{cpu, cpu + 1};
+        setrlimit(RLIMIT_CPU, &cpuLimit);
+
+        // Grants were validated by requestGrants; an empty list allows nothing.
+        native::CapabilityPolicy::instance().allow(grants, nullptr);
+        // Nobody is there to answer: stdin is the server's.
+        native::CapabilityPolicy::instance().denyInput();
+        auto result = runSource(source, "<request>");
+        std::vector<std::string> errors;
+        for (auto& d : result.diagnostics) errors.push_back(d.message);
+        ObjectPtr value = result.ok() && result.value && !isScriptExit(result.value) ? newString(repr(result.value)) : getNull();
+        auto record = toJson(object({{"ok", newBoolean(result.ok())}, {"value", value}, {"errors", stringList(errors)}}));
+        std::fflush(stdout);
+        std::fflush(stderr);
+        for (size_t done = 0; done < record.size();) {
+            ssize_t n = write(resultPipe[1], record.data() + done, record.size() - done);
+            if (n <= 0) break;
+            done += static_cast<size_t>(n);
+        }
+        _exit(0);
+    }
+
+    close(outPipe[1]);
+    close(errPipe[1]);
+    close(resultPipe[1]);
+    std::string out, errText, record;
+    bool truncated = false;
+    auto deadline = std::chrono::steady_clock::now() + std::chrono::milliseconds(timeoutMs);
+    bool finished = drain(outPipe[0], errPipe[0], resultPipe[0], deadline, options.maxOutput, &out, &errText, &record, &truncated);
+    if (!finished) kill(pid, SIGKILL);
+    int status = 0;
+    while (waitpid(pid, &status, 0) < 0 && errno == EINTR) {}
+
+    if (!finished) {
+        *err = {ServerError, "evaluation timed out after " + std::to_string(timeoutMs) + " ms"};
+        return nullptr;
+    }
+    auto parsed = parseJson(record);
+    if (record.empty() || parsed->type() != ObjectType::MAP) {
+        std::string why = WIFSIGNALED(status) ? "killed by signal " + std::to_string(WTERMSIG(status))
+                                              : "exited with status " + std::to_string(WEXITSTATUS(status));
+        if (WIFSIGNALED(status) && WTERMSIG(status) == SIGXCPU) why = "exceeded its CPU time limit";
+        *err = {ServerError, "evaluation " + why + " (memory limit " + std::to_string(memoryMb) + " MB)"};
+        return nullptr;
+    }
+    auto m = std::static_pointer_cast<Map>(parsed);
+    m->pairs.push_back({newString("output"), newString(out)});
+    m->pairs.push_back({newString("stderr"), newString(errText)});
+    m->pairs.push_back({newString("truncated"), newBoolean(truncated)});
+    return m;
+}
+#endif
+
+static ObjectPtr callMethod(const std::string& method, const ObjectPtr& params, const ServeOptions& options, RpcError* err) {
+    if (method != "evaluate" && method != "parse" && method != "disassemble") {
+        *err = {MethodNotFound, "unknown method '" + method + "' (expected evaluate, parse or disassemble)"};
+        return nullptr;
+    }
+    if (!params || params->type() != ObjectType::MAP) {
+        *err = {InvalidParams, "params must be an object"};
+        return nullptr;
+    }
+    std::string source;
+    if (!stringParam(params, "source", &source, err)) return nullptr;
+
+    if (method == "parse") {
+        auto [program, errors] = parseSource(source, "<request>");
+        return object({{"ok", newBoolean(errors.empty())},
+                       {"errors", stringList(errors)},
+                       {"ast", errors.empty() ? newString(program->inspect()) : getNull()}});
+    }
+    if (method == "disassemble") {
+        auto [program, errors] = parseSource(source, "<request>");
+        if (!errors.empty()) {
+            *err = {ServerError, errors[0]};
+            return nullptr;
+        }
+        try {
+            Interpreter interp;
+            Compiler compiler;
+            compiler.setBuiltins([&interp](const std::string& name, std::string* why) { return interp.bytecodeBuiltin(name, why); });
+            compiler.compile(program.get());
+            auto bc = compiler.bytecode();
+            return object({{"instructions", newString(Disassemble(bc->instructions, bc->debug.globals))}});
+        } catch (const std::exception& e) {
+            *err = {ServerError, std::string("cannot compile to bytecode: ") + e.what()};
+            return nullptr;
+        }
+    }
+
+    int timeoutMs = options.timeoutMs, memoryMb = options.memoryMb;
+    std::string grants;
+    if (!limitParam(params, "timeout_ms", &timeoutMs, err) || !limitParam(params, "memory_mb", &memoryMb, err) ||
+        !requestGrants(params, options, &grants, err))
+        return nullptr;
+#ifdef _WIN32
+    *err = {ServerError, "evaluate is not supported on Windows"};
+    return nullptr;
+#else
+    return evaluate(source, grants, timeoutMs, memoryMb, options, err);
+#endif
+}
+
+// Answers one request object, or returns nullptr for a notification.
+static ObjectPtr handleOne(const ObjectPtr& request, const ServeOptions& options) {
+    auto id = field(request, "id");
+    auto version = std::dynamic_pointer_cast<String>(field(request, "jsonrpc"));
+    auto method = std::dynamic_pointer_cast<String>(field(request, "method"));
+    if (!request || request->type() != ObjectType::MAP || !version || version->value != "2.0" || !method)
+        return errorResponse(id, {InvalidRequest, "expected a JSON-RPC 2.0 request object"});
+    RpcError err{0, ""};
+    auto result = callMethod(method->value, field(request, "params"), options, &err);
+    if (!id) return nullptr;
+    if (!result) return errorResponse(id, err);
+    return object({{"jsonrpc", newString("2.0")}, {"result", result}, {"id", id}});
+}
+
+std::string handleRpc(const std::string& body, const ServeOptions& options) {
+    auto request = parseJson(body);
+    if (request->type() == ObjectType::ERROR) return toJson(errorResponse(getNull(), {ParseError, request->inspect()}));
+    if (auto batch = std::dynamic_pointer_cast<Array>(request)) {
+        if (batch->elements.empty()) return toJson(errorResponse(getNull(), {InvalidRequest, "empty batch"}));
+        std::vector<ObjectPtr> responses;
+        for (auto& r : batch->elements)
+            if (auto response = handleOne(r, options)) responses.push_back(response);
+        return responses.empty() ? "" : toJson(newArray(std::move(responses)));
+    }
+    auto response = handleOne(request, options);
+    return response ? toJson(response) : "";
+}
+
+// ============ HTTP ============
+
+#ifndef _WIN32
+static void sendResponse(int fd, int status, const std::string& reason, const std::string& body) {
+    std::string head = "HTTP/1.1 " + std::to_string(status) + " " + reason + "\r\n";
+    if (!body.empty()) head += "Content-Type: application/json\r\n";
+    head += "Content-Length: " + std::to_string(body.size()) + "\r\nConnection: close\r\n\r\n";
+    std::string data = head + body;
+    for (size_t done = 0; done < data.size();) {
+        ssize_t n = send(fd, data.data() + done, data.size() - done, 0);
+        if (n <= 0) return;
+        done += static_cast<size_t>(n);
+    }
+}
+
+// The value of a header in the lowercased request head, without the
+// surrounding blanks.
+static bool headerValue(const std::string& head, const std::string& name, std::string* value) {
+    auto at = head.find("\r\n" + name + ":");
+    if (at == std::string::npos) return false;
+    size_t start = at + name.size() + 3;
+    size_t end = std::min(head.find("\r\n", start), head.size());
+    while (start < end && (head[start] == ' ' || head[start] == '\t')) start++;
+    while (end > start && (head[end - 1] == ' ' || head[end - 1] == '\t')) end--;
+    *value = head.substr(start, end - start);
+    return true;
+}
+
+// Reads one HTTP request and answers it; one request per connection.
+static void handleConnection(int fd, const ServeOptions& options) {
+    std::string data;
+    size_t headerEnd;
+    char buf[4096];
+    while ((headerEnd = data.find("\r\n\r\n")) == std::string::npos) {
+        if (data.size() > MaxHeaderBytes) return sendResponse(fd, 431, "Request Header Fields Too Large", "");
+        ssize_t n = recv(fd, buf, sizeof(buf), 0);
+        if (n <= 0) return;
+        data.append(buf, static_cast<size_t>(n));
+    }
+    std::string head = data.substr(0, headerEnd);
+    std::string body = data.substr(headerEnd + 4);
+    if (head.compare(0, 5, "POST ") != 0) return sendResponse(fd, 405, "Method Not Allowed", "");
+
+    std::string lower = head;
+    std::transform(lower.begin(), lower.end(), lower.begin(), ::tolower);
+    // Web pages can POST here too. Browsers add Origin to such requests and
+    // cannot send application/json cross-site without a preflight, which
+    // this server never answers; so a page the user opens cannot run code.
+    std::string origin, type, lengthText;
+    if (headerValue(lower, "origin", &origin)) return sendResponse(fd, 403, "Forbidden", "");
+    if (!headerValue(lower, "content-type", &type) || type.substr(0, type.find(';')) != "application/json")
+        return sendResponse(fd, 415, "Unsupported Media Type", "");
+    if (!headerValue(lower, "content-length", &lengthText)) return sendResponse(fd, 411, "Length Required", "");
+    size_t length = std::strtoull(lengthText.c_str(), nullptr, 10);
+    if (length > MaxBodyBytes) return sendResponse(fd, 413, "Payload Too Large", "");
+    while (body.size() < length) {
+        ssize_t n = recv(fd, buf, sizeof(buf), 0);
+        if (n <= 0) return;
+        body.append(buf, static_cast<size_t>(n));
+    }
+    body.resize(length);
+
+    auto response = handleRpc(body, options);
+    if (response.empty()) return sendResponse(fd, 204, "No Content", "");
+    sendResponse(fd, 200, "OK", response);
+}
+#endif
+
+int serve(const ServeOptions& options) {
+#ifdef _WIN32
+    std::cerr << "serve: not supported on Windows\n";
+    return 1;
+#else
+    signal(SIGPIPE, SIG_IGN);
+    int server = socket(AF_INET, SOCK_STREAM, 0);
+    if (server < 0) {
+        std::cerr << "serve: cannot create socket: " << std::strerror(errno) << "\n";
+        return 1;
+    }
+    int yes = 1;
+    setsockopt(server, SOL_SOCKET, SO_REUSEADDR, &yes, sizeof(yes));
+    sockaddr_in addr{};
+    addr.sin_family = AF_INET;
+    addr.sin_port = htons(static_cast<uint16_t>(options.port));
+    if (inet_pton(AF_INET, options.host == "localhost" ? "127.0.0.1" : options.host.c_str(), &addr.sin_addr) != 1) {
+        std::cerr << "serve: invalid address " << options.host << "\n";
+        close(server);
+        return 1;
+    }
+    if (bind(server, reinterpret_cast<sockaddr*>(&addr), sizeof(addr)) != 0 || listen(server, 16) != 0) {
+        std::cerr << "serve: cannot listen on " << options.host << ":" << options.port << ": " << std::strerror(errno) << "\n";
+        close(server);
+        return 1;
+    }
+    std::cerr << "darix serve: listening on " << options.host << ":" << options.port << "\n";
+    while (true) {
+        int client = accept(server, nullptr, nullptr);
+        if (client < 0) {
+            if (errno == EINTR) continue;
+            std::cerr << "serve: accept failed: " << std::strerror(errno) << "\n";
+            continue;
+        }
+        timeval timeout{10, 0};
+        setsockopt(client, SOL_SOCKET, SO_RCVTIMEO, &timeout, sizeof(timeout));
+        handleConnection(client, options);
+        close(client);
+    }
+#endif
+}
+
+} // namespace darix
@@ -0,0 +1,249 @@
+#include "darix/stdlib.hpp"
+#include <map>
+
+namespace darix {
+
+// The sources are compiled in, so `std:` imports work without any files
+// installed next to the binary.
+static const std::map<std::string, std::string> Sources = {
+    {"collections", R"dax(// Counting, windowing and map helpers.
+
+// A map from each distinct value in xs to how often it occurs.
+func counter(xs) {
+    var counts = {}
+    for (x in xs) {
+        if (x in counts) { counts[x] = counts[x] + 1 } else { counts[x] = 1 }
+    }
+    return counts
+}
+
+// The n most frequent values of xs as [value, count] pairs, most frequent
+// first; equal counts keep the order the values first appeared in.
+func most_common(xs, n) {
+    var pairs = []
+    for (value, count in counter(xs)) {
+        var pair = [value, count]
+        var i = len(pairs)
+        append(pairs, pair)
+        while ((i > 0) && (pairs[i - 1][1] < count)) {
+            pairs[i] = pairs[i - 1]
+            i = i - 1
+        }
+        pairs[i] = pair
+    }
+    var top = []
+    for (pair in pairs) {
+        if (len(top) == n) { break }
+        append(top, pair)
+    }
+    return top
+}
+
+// Every run of n consecutive elements of xs, in order.
+func window(xs, n) {
+    var out = []
+    for (var i = 0; i + n <= len(xs); i = i + 1) {
+        var w = []
+        for (var j = i; j < i + n; j = j + 1) { append(w, xs[j]) }
+        append(out, w)
+    }
+    return out
+}
+
+// m with keys and values swapped; of keys sharing a value, the last wins.
+func invert(m) {
+    var out = {}
+    for (k, v in m) { out[v] = k }
+    return out
+}
+
+// A new map with the entries of a, then those of b, which win on conflicts.
+func merge(a, b) {
+    var out = {}
+    for (k, v in a) { out[k] = v }
+    for (k, v in b) { out[k] = v }
+    return out
+}
+
+// The entries of m whose keys are in ks.
+func pick(m, ks) {
+    var out = {}
+    for (k in ks) {
+        if (k in m) { out[k] = m[k] }
+    }
+    return out
+}
+
+// The entries of m whose keys are not in ks.
+func omit(m, ks) {
+    var out = {}
+    for (k, v in m) {
+        if (!(k in ks)) { out[k] = v }
+    }
+    return out
+}
+
+// The value at path, an array of keys and indices, inside nested maps and
+// arrays, or fallback when any step is missing.
+func get_in(value, path, fallback) {
+    for (step in path) {
+        if (type(value) == "MAP") {
+            if (!(step in value)) { return fallback }
+        } elif (type(value) == "ARRAY") {
+            if ((type(step) != "INTEGER") || (step < 0) || (step >= len(value))) { return fallback }
+        } else {
+            return fallback
+        }
+        value = value[step]
+    }
+    return value
+}
+)dax"},
+    {"functional", R"dax(// Building functions out of other functions.
+
+func identity(x) { return x }
+
+// A function that ignores its argument and returns value.
+func constant(value) { return func(x) { return value } }
+
+// x => f(g(x)).
+func compose(f, g) { return func(x) { return f(g(x)) } }
+
+// A function passing its argument through each of fns in turn.
+func pipe(fns) {
+    return func(x) {
+        for (f in fns) { x = f(x) }
+        return x
+    }
+}
+
+// f with its first argument fixed: partial(f, a)(b) is f(a, b).
+func partial(f, a) { return func(b) { return f(a, b) } }
+
+// f with its two arguments swapped.
+func flip(f) { return func(a, b) { return f(b, a) } }
+
+// A predicate true where pred is false.
+func negate(pred) { return func(x) { return !pred(x) } }
+
+// f, remembering the result for each argument it has been called with.
+func memoize(f) {
+    var cache = {}
+    return func(x) {
+        if (!(x in cache)) { cache[x] = f(x) }
+        return cache[x]
+    }
+}
+
+// [f(0), f(1), ..., f(n - 1)].
+func times(n, f) {
+    var out = []
+    for (i in range(0, n)) { append(out, f(i)) }
+    return out
+}
+)dax"},
+    {"strings", R"dax(// Text helpers built on the native string module.
+import string
+
+// The words of text packed greedily into lines of at most width characters;
+// a word longer than width gets a line of its own.
+func wrap(text, width) {
+    var lines = []
+    var line = ""
+    for (word in string.words(text)) {
+        if (line == "") {
+            line = word
+        } elif (len(line) + 1 + len(word) <= width) {
+            line = line + " " + word
+        } else {
+            append(lines, line)
+            line = word
+        }
+    }
+    if (line != "") { append(lines, line) }
+    return lines
+}
+
+// text with prefix added before every non-blank line.
+func indent(text, prefix) {
+    var out = []
+    for (line in string.split(text, "\n")) {
+        if (string.trim(line) == "") { append(out, line) } else { append(out, prefix + line) }
+    }
+    return string.join(out, "\n")
+}
+
+// text with the leading whitespace common to all non-blank lines removed.
+func dedent(text) {
+    var lines = string.split(text, "\n")
+    var common = null
+    for (line in lines) {
+        if (string.trim(line) == "") { continue }
+        var n = 0
+        while ((n < len(line)) && ((line[n] == " ") || (line[n] == "\t"))) { n = n + 1 }
+        if ((common == null) || (n < common)) { common = n }
+    }
+    if ((common == null) || (common == 0)) { return text }
+    var out = []
+    for (line in lines) {
+        if (string.trim(line) == "") { append(out, string.trim(line)) } else { append(out, string.slice(line, common)) }
+    }
+    return string.join(out, "\n")
+}
+
+func _is_upper(c) { return (string.upper(c) == c) && (string.lower(c) != c) }
+
+func _is_lower(c) { return (string.lower(c) == c) && (string.upper(c) != c) }
+
+// The lower-case words of an identifier or phrase, split at spaces, `_` and
+// `-`, and where case changes: "parseHTTPRequest" gives parse, http, request.
+func split_words(s) {
+    var words = []
+    var word = ""
+    for (i, c in s) {
+        if ((c == " ") || (c == "_") || (c == "-")) {
+            if (word != "") { append(words, word) }
+            word = ""
+            continue
+        }
+        if (_is_upper(c) && (word != "")) {
+            var prev = s[i - 1]
+            var next = ""
+            if (i + 1 < len(s)) { next = s[i + 1] }
+            if (_is_lower(prev) || string.is_digit(prev) || (_is_upper(prev) && (next != "") && _is_lower(next))) {
+                append(words, word)
+                word = ""
+            }
+        }
+        word = word + string.lower(c)
+    }
+    if (word != "") { append(words, word) }
+    return words
+}
+
+func snake_case(s) { return string.join(split_words(s), "_") }
+
+func kebab_case(s) { return string.join(split_words(s), "-") }
+
+func camel_case(s) {
+    var out = ""
+    for (i, word in split_words(s)) {
+        if (i == 0) { out = word } else { out = out + string.upper(word[0]) + string.slice(word, 1) }
+    }
+    return out
+}
+)dax"},
+};
+
+const std::string* stdlibSource(const std::string& name) {
+    auto it = Sources.find(name);
+    return it == Sources.end() ? nullptr : &it->second;
+}
+
+std::vector<std::string> stdlibModules() {
+    std::vector<std::string> names;
+    for (auto& [name, _] : Sources) names.push_back(name);
+    return names;
+}
+
+} // namespace darix
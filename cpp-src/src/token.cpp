@@ -9,12 +9,15 @@ const char* TokenTypeToString(TokenType type) {
         case TokenType::IDENT: return "IDENT";
         case TokenType::INT: return "INT";
         case TokenType::FLOAT: return "FLOAT";
+        case TokenType::DECIMAL: return "DECIMAL";
         case TokenType::STRING: return "STRING";
         case TokenType::ASSIGN: return "=";
         case TokenType::PLUS: return "+";
         case TokenType::MINUS: return "-";
         case TokenType::BANG: return "!";
         case TokenType::OR: return "||";
+        case TokenType::PIPE: return "|";
+        case TokenType::PIPE_FORWARD: return "|>";
         case TokenType::AND: return "&&";
         case TokenType::ASTERISK: return "*";
         case TokenType::SLASH: return "/";
@@ -67,6 +70,7 @@ const char* TokenTypeToString(TokenType type) {
         case TokenType::IN: return "IN";
         case TokenType::IS: return "IS";
         case TokenType::WITH: return "WITH";
+        case TokenType::DEFER: return "DEFER";
         case TokenType::YIELD: return "YIELD";
         case TokenType::GLOBAL: return "GLOBAL";
         case TokenType::NONLOCAL: return "NONLOCAL";
@@ -112,6 +116,7 @@ static const KeywordEntry keywordEntries[] = {
     {"in",      TokenType::IN},
     {"is",      TokenType::IS},
     {"with",    TokenType::WITH},
+    {"defer",   TokenType::DEFER},
     {"yield",   TokenType::YIELD},
     {"global",  TokenType::GLOBAL},
     {"nonlocal",TokenType::NONLOCAL},
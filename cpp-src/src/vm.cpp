@@ -1,5 +1,9 @@
 #include "darix/vm.hpp"
+#include "darix/lang.hpp"
+#include "darix/native/native.hpp"
+#include "darix/warnings.hpp"
 #include <algorithm>
+#include <array>
 #include <cstring>
 #include <sstream>
 
@@ -24,6 +28,8 @@ static uint16_t readUint16(const uint8_t* ins) {
 static bool isError(ObjectPtr obj) { return obj && obj->type() == ObjectType::ERROR; }
 static bool isSignal(ObjectPtr obj) { return obj && obj->type() == ObjectType::EXCEPTION_SIGNAL; }
 static ObjectPtr nativeBoolToBooleanObject(bool b) { return b ? getTrue() : getFalse(); }
+static bool verifyProgram(const Instructions& ins, const std::vector<ObjectPtr>& constants, std::string* error,
+                          bool balanced = false);
 
 // ============ VM ============
 
@@ -34,14 +40,45 @@ VM::VM(std::shared_ptr<Bytecode> bc)
     , instructions_(bc->instructions)
     , bcMagic_(bc->magic)
     , bcVersion_(bc->version)
+    , bcFormat_(bc->formatVersion)
     , debug_(bc->debug)
 {
 }
 
 void VM::setInstructionBudget(int n) { instrBudget_ = n; }
+
+void VM::setInstructionHook(int every, std::function<void(uint64_t executed)> hook) {
+    hookEvery_ = hook && every > 0 ? every : 0;
+    hookCountdown_ = hookEvery_;
+    instructionHook_ = std::move(hook);
+}
+
+ObjectPtr VM::countInstruction() {
+    if (stopRequested_.exchange(false, std::memory_order_relaxed)) {
+        auto ex = std::dynamic_pointer_cast<Exception>(newException(INTERRUPT_ERROR, "execution was stopped by the host"));
+        ex->stackTrace = buildStackTrace();
+        return newExceptionSignal(ex);
+    }
+    if (hookEvery_ > 0 && --hookCountdown_ == 0) {
+        hookCountdown_ = hookEvery_;
+        hookExecuted_ += static_cast<uint64_t>(hookEvery_);
+        instructionHook_(hookExecuted_);
+    }
+    if (instrBudget_ > 0 && --instrBudget_ == 0) {
+        auto ex = std::dynamic_pointer_cast<Exception>(newException(RUNTIME_ERROR, "instruction budget exceeded"));
+        ex->stackTrace = buildStackTrace();
+        return newExceptionSignal(ex);
+    }
+    return nullptr;
+}
 void VM::enableJIT(bool) {}
 void VM::enableProfiling(bool enabled) { profiling_ = enabled; }
 
+void VM::setGlobals(std::vector<ObjectPtr> globals) {
+    if (globals.size() < InitialGlobs) globals.resize(InitialGlobs, nullptr);
+    globals_ = std::move(globals);
+}
+
 ObjectPtr VM::push(ObjectPtr obj) {
     if (sp_ >= StackSize) return errorWithLoc("stack overflow");
     stack_[sp_] = obj;
@@ -85,7 +122,7 @@ ObjectPtr VM::binaryOp(Opcode op) {
     auto [left, right, err] = popTwo();
     if (err) return err;
     auto res = execBinary(op, left, right);
-    if (isError(res)) return res;
+    if (isError(res) || isSignal(res)) return res;
     return pushChecked(res);
 }
 
@@ -98,181 +135,453 @@ ObjectPtr VM::compareOp(Opcode op) {
 }
 
 ObjectPtr VM::run() {
+    try {
+        return execute();
+    } catch (const std::exception& e) {
+        return newInternalError(e.what(), buildStackTrace());
+    } catch (...) {
+        return newInternalError("unknown exception", buildStackTrace());
+    }
+}
+
+ObjectPtr VM::call(std::shared_ptr<CompiledFunction> fn, const std::vector<ObjectPtr>& args) {
+    try {
+        return runCompiledFunction(fn, args);
+    } catch (const std::exception& e) {
+        return newInternalError(e.what(), buildStackTrace());
+    } catch (...) {
+        return newInternalError("unknown exception", buildStackTrace());
+    }
+}
+
+// An integer and a float as two floats, as the interpreter mixes them;
+// {null, null} for any other pair.
+static std::pair<ObjectPtr, ObjectPtr> promoteNumbers(const ObjectPtr& left, const ObjectPtr& right) {
+    if (!left || !right) return {nullptr, nullptr};
+    auto lt = left->type(), rt = right->type();
+    if (!((lt == ObjectType::INTEGER && rt == ObjectType::FLOAT) || (lt == ObjectType::FLOAT && rt == ObjectType::INTEGER)))
+        return {nullptr, nullptr};
+    auto toFloat = [](const ObjectPtr& o) {
+        if (auto i = std::dynamic_pointer_cast<Integer>(o)) return newFloatFromPool(static_cast<double>(i->value));
+        return o;
+    };
+    return {toFloat(left), toFloat(right)};
+}
+
+// ============ Dispatch ============
+
+// The top-level program or one compiled function call being executed. For
+// the top level, ip is the VM's ip_, which error locations are looked up by.
+struct VM::Frame {
+    const Instructions& ins;
+    int& ip;
+    std::vector<ObjectPtr>& locals;
+    bool topLevel;
+    bool returned = false;
+    ObjectPtr result;
+};
+
+// One handler per opcode. A handler reads its operands at f.ip + 1, leaves
+// f.ip on its last byte (or one before a jump target) and returns an error or
+// signal to stop, or null to go on.
+struct VM::Ops {
+    using Handler = ObjectPtr (*)(VM&, Frame&);
+    static const std::array<Handler, 256> table;
+
+    static int operand(const Frame& f, int offset) { return readUint16(f.ins.data() + f.ip + offset); }
+
+    static ObjectPtr nop(VM&, Frame&) { return nullptr; }
+    static ObjectPtr unknown(VM& vm, Frame&) { return vm.errorWithLoc("unknown opcode"); }
+
+    static ObjectPtr constant(VM& vm, Frame& f) {
+        int idx = operand(f, 1);
+        f.ip += 2;
+        return vm.push(vm.constants_[idx]);
+    }
+    static ObjectPtr binary(VM& vm, Frame& f) { return vm.binaryOp(static_cast<Opcode>(f.ins[f.ip])); }
+    static ObjectPtr compare(VM& vm, Frame& f) { return vm.compareOp(static_cast<Opcode>(f.ins[f.ip])); }
+    static ObjectPtr minus(VM& vm, Frame&) {
+        auto [operand, err] = vm.popChecked();
+        if (err) return err;
+        auto res = vm.execMinus(operand);
+        if (isError(res) || isSignal(res)) return res;
+        return vm.push(res);
+    }
+    static ObjectPtr bang(VM& vm, Frame&) {
+        auto [operand, err] = vm.popChecked();
+        if (err) return err;
+        return vm.push(nativeBoolToBooleanObject(!isTruthy(operand)));
+    }
+    static ObjectPtr pushTrue(VM& vm, Frame&) { return vm.push(getTrue()); }
+    static ObjectPtr pushFalse(VM& vm, Frame&) { return vm.push(getFalse()); }
+    static ObjectPtr pushNull(VM& vm, Frame&) { return vm.push(getNull()); }
+    static ObjectPtr pop(VM& vm, Frame& f) {
+        auto [val, err] = vm.popChecked();
+        if (err) return err;
+        if (f.topLevel) vm.lastPopped_ = val;
+        return nullptr;
+    }
+    static ObjectPtr setGlobal(VM& vm, Frame& f) {
+        int idx = operand(f, 1);
+        f.ip += 2;
+        auto [val, err] = vm.popChecked();
+        if (err) return err;
+        vm.setGlobal(idx, val);
+        return nullptr;
+    }
+    static ObjectPtr getGlobal(VM& vm, Frame& f) {
+        int idx = operand(f, 1);
+        f.ip += 2;
+        auto val = vm.getGlobal(idx);
+        if (!val) return vm.errorWithLoc("name '" + vm.globalName(idx) + "' is not defined");
+        return vm.push(val);
+    }
+    static ObjectPtr print(VM& vm, Frame& f) {
+        int argc = operand(f, 1);
+        f.ip += 2;
+        return vm.opPrint(argc);
+    }
+    static ObjectPtr jump(VM&, Frame& f) {
+        f.ip = operand(f, 1) - 1;
+        return nullptr;
+    }
+    static ObjectPtr jumpNotTruthy(VM& vm, Frame& f) {
+        int target = operand(f, 1);
+        f.ip += 2;
+        auto [cond, err] = vm.popChecked();
+        if (err) return err;
+        if (!isTruthy(cond)) f.ip = target - 1;
+        return nullptr;
+    }
+    static ObjectPtr array(VM& vm, Frame& f) {
+        int numElements = operand(f, 1);
+        f.ip += 2;
+        return vm.opArray(numElements);
+    }
+    static ObjectPtr stringConcat(VM& vm, Frame& f) {
+        int n = operand(f, 1);
+        f.ip += 2;
+        return vm.opStringConcat(n);
+    }
+    static ObjectPtr index(VM& vm, Frame&) {
+        auto [left, right, err] = vm.popTwo();
+        if (err) return err;
+        auto res = vm.execIndex(left, right);
+        if (isError(res) || isSignal(res)) return res;
+        return vm.push(res);
+    }
+    static ObjectPtr setIndex(VM& vm, Frame&) {
+        auto [target, index, value, err] = vm.popThree();
+        if (err) return err;
+        if (auto setErr = vm.execSetIndex(target, index, value)) return setErr;
+        return vm.push(getNull());
+    }
+    static ObjectPtr len(VM& vm, Frame&) {
+        auto [obj, err] = vm.popChecked();
+        if (err) return err;
+        auto res = vm.execLen(obj);
+        if (isError(res)) return res;
+        return vm.push(res);
+    }
+    static ObjectPtr type(VM& vm, Frame&) {
+        auto [obj, err] = vm.popChecked();
+        if (err) return err;
+        return vm.push(vm.execType(obj));
+    }
+    static ObjectPtr swap(VM& vm, Frame&) { return vm.opSwap(); }
+    static ObjectPtr iterable(VM& vm, Frame& f) {
+        int count = operand(f, 1);
+        f.ip += 2;
+        return vm.opIterable(count);
+    }
+    static ObjectPtr iterNext(VM& vm, Frame& f) {
+        int target = operand(f, 1);
+        int count = operand(f, 3);
+        f.ip += 4;
+        bool done = false;
+        if (auto err = vm.opIterNext(count, done)) return err;
+        if (done) f.ip = target - 1;
+        return nullptr;
+    }
+    static ObjectPtr call(VM& vm, Frame& f) {
+        int argc = operand(f, 1);
+        f.ip += 2;
+        if (vm.sp_ < argc + 1) return vm.errorWithLoc("call: stack underflow");
+        std::vector<ObjectPtr> args(argc);
+        for (int i = argc - 1; i >= 0; i--) {
+            auto [val, err] = vm.popChecked();
+            if (err) return err;
+            args[i] = val;
+        }
+        auto [callee, calleeErr] = vm.popChecked();
+        if (calleeErr) return calleeErr;
+
+        ObjectPtr res;
+        if (auto fn = std::dynamic_pointer_cast<CompiledFunction>(callee)) {
+            res = vm.runCompiledFunction(fn, args);
+        } else if (auto builtin = std::dynamic_pointer_cast<Builtin>(callee)) {
+            if (!builtin->fn) return vm.errorWithLoc("builtin '" + builtin->name + "' is not linked");
+            res = arityError(*builtin, args.size());
+            if (!res) res = builtin->fn(args);
+            if (auto err = resultSizeError(res)) res = err;
+            // Exceptions raised by builtins point at the call.
+            auto sig = std::dynamic_pointer_cast<ExceptionSignal>(res);
+            if (sig && sig->exception && !sig->exception->stackTrace) sig->exception->stackTrace = vm.buildStackTrace();
+        } else {
+            return vm.errorWithLoc("not a function");
+        }
+        if (isError(res) || isSignal(res)) return res;
+        return vm.push(res);
+    }
+    static ObjectPtr returnValue(VM& vm, Frame& f) {
+        if (f.topLevel) return vm.errorWithLoc("return outside a function");
+        auto [val, err] = vm.popChecked();
+        if (err) return err;
+        f.result = val;
+        f.returned = true;
+        return nullptr;
+    }
+    static ObjectPtr returnNull(VM& vm, Frame& f) {
+        if (f.topLevel) return vm.errorWithLoc("return outside a function");
+        f.result = getNull();
+        f.returned = true;
+        return nullptr;
+    }
+    static ObjectPtr getLocal(VM& vm, Frame& f) {
+        int idx = operand(f, 1);
+        f.ip += 2;
+        if (idx >= static_cast<int>(f.locals.size())) return vm.errorWithLoc("getlocal: index out of range");
+        if (!f.locals[idx]) return vm.errorWithLoc("local variable read before it is assigned");
+        return vm.push(f.locals[idx]);
+    }
+    static ObjectPtr setLocal(VM& vm, Frame& f) {
+        int idx = operand(f, 1);
+        f.ip += 2;
+        auto [val, err] = vm.popChecked();
+        if (err) return err;
+        if (idx >= static_cast<int>(f.locals.size())) return vm.errorWithLoc("setlocal: index out of range");
+        f.locals[idx] = val;
+        return nullptr;
+    }
+};
+
+const std::array<VM::Ops::Handler, 256> VM::Ops::table = [] {
+    std::array<Handler, 256> t;
+    t.fill(&Ops::unknown);
+    auto set = [&t](Opcode op, Handler h) { t[static_cast<uint8_t>(op)] = h; };
+    set(Opcode::OpNop, &Ops::nop);
+    set(Opcode::OpConstant, &Ops::constant);
+    for (auto op : {Opcode::OpAdd, Opcode::OpSub, Opcode::OpMul, Opcode::OpDiv, Opcode::OpMod}) set(op, &Ops::binary);
+    for (auto op : {Opcode::OpEqual, Opcode::OpNotEqual, Opcode::OpGreaterThan, Opcode::OpLessThan,
+                    Opcode::OpGreaterEqual, Opcode::OpLessEqual})
+        set(op, &Ops::compare);
+    set(Opcode::OpMinus, &Ops::minus);
+    set(Opcode::OpBang, &Ops::bang);
+    set(Opcode::OpTrue, &Ops::pushTrue);
+    set(Opcode::OpFalse, &Ops::pushFalse);
+    set(Opcode::OpNull, &Ops::pushNull);
+    set(Opcode::OpPop, &Ops::pop);
+    set(Opcode::OpSetGlobal, &Ops::setGlobal);
+    set(Opcode::OpGetGlobal, &Ops::getGlobal);
+    set(Opcode::OpPrint, &Ops::print);
+    set(Opcode::OpJump, &Ops::jump);
+    set(Opcode::OpJumpNotTruthy, &Ops::jumpNotTruthy);
+    set(Opcode::OpArray, &Ops::array);
+    set(Opcode::OpStringConcat, &Ops::stringConcat);
+    set(Opcode::OpIndex, &Ops::index);
+    set(Opcode::OpSetIndex, &Ops::setIndex);
+    set(Opcode::OpLen, &Ops::len);
+    set(Opcode::OpType, &Ops::type);
+    set(Opcode::OpSwap, &Ops::swap);
+    set(Opcode::OpIterable, &Ops::iterable);
+    set(Opcode::OpIterNext, &Ops::iterNext);
+    set(Opcode::OpCall, &Ops::call);
+    set(Opcode::OpReturnValue, &Ops::returnValue);
+    set(Opcode::OpReturn, &Ops::returnNull);
+    set(Opcode::OpGetLocal, &Ops::getLocal);
+    set(Opcode::OpSetLocal, &Ops::setLocal);
+    return t;
+}();
+
+ObjectPtr VM::dispatch(Frame& f) {
+    const int end = static_cast<int>(f.ins.size());
+    for (; f.ip < end; f.ip++) {
+        if (instrBudget_ > 0 || hookEvery_ > 0 || stopRequested_.load(std::memory_order_relaxed)) {
+            if (auto stop = countInstruction()) return stop;
+        }
+        uint8_t op = f.ins[f.ip];
+        if (profiling_) opCounts_[op]++;
+        if (auto err = Ops::table[op](*this, f)) return err;
+        if (f.returned) return f.result;
+    }
+    return getNull();
+}
+
+ObjectPtr VM::execute() {
     if (!bcMagic_.empty() && bcMagic_ != BytecodeMagic) {
         return newError("invalid bytecode: magic mismatch");
     }
+    if (bcFormat_ != BytecodeFormatVersion) {
+        return newError("invalid bytecode: format v%d produced by DariX %s, expected v%d",
+                        bcFormat_, bcVersion_.c_str(), BytecodeFormatVersion);
+    }
+    if (!verified_) {
+        std::string error;
+        if (!verifyProgram(instructions_, constants_, &error)) return newError("invalid bytecode: %s", error.c_str());
+        verified_ = true;
+    }
 
-    for (ip_ = 0; ip_ < static_cast<int>(instructions_.size()); ip_++) {
-        if (instrBudget_ > 0) {
-            instrBudget_--;
-            if (instrBudget_ == 0) {
-                auto ex = std::dynamic_pointer_cast<Exception>(newException(RUNTIME_ERROR, "instruction budget exceeded"));
-                ex->stackTrace = buildStackTrace();
-                return newExceptionSignal(ex);
-            }
-        }
+    std::vector<ObjectPtr> noLocals;
+    ip_ = 0;
+    Frame frame{instructions_, ip_, noLocals, true};
+    return dispatch(frame);
+}
 
-        auto op = static_cast<Opcode>(instructions_[ip_]);
-        if (profiling_) opCounts_[static_cast<int>(op)]++;
+// ============ Verification ============
+
+// Values an instruction pops and pushes; returns false for instructions that
+// do not fall through to the next one.
+static bool stackEffect(const Instruction& in, int& pops, int& pushes) {
+    pops = 0;
+    pushes = 0;
+    switch (in.op) {
+        case Opcode::OpConstant: case Opcode::OpTrue: case Opcode::OpFalse: case Opcode::OpNull:
+        case Opcode::OpGetGlobal: case Opcode::OpGetLocal:
+            pushes = 1;
+            break;
+        case Opcode::OpAdd: case Opcode::OpSub: case Opcode::OpMul: case Opcode::OpDiv: case Opcode::OpMod:
+        case Opcode::OpEqual: case Opcode::OpNotEqual: case Opcode::OpGreaterThan: case Opcode::OpLessThan:
+        case Opcode::OpGreaterEqual: case Opcode::OpLessEqual: case Opcode::OpIndex:
+            pops = 2; pushes = 1;
+            break;
+        case Opcode::OpMinus: case Opcode::OpBang: case Opcode::OpLen: case Opcode::OpType:
+            pops = 1; pushes = 1;
+            break;
+        case Opcode::OpPop: case Opcode::OpJumpNotTruthy: case Opcode::OpSetGlobal: case Opcode::OpSetLocal:
+            pops = 1;
+            break;
+        case Opcode::OpSetIndex: pops = 3; pushes = 1; break;
+        case Opcode::OpSwap: pops = 2; pushes = 2; break;
+        case Opcode::OpIterable: pops = 1; pushes = 2; break;
+        // Falls through with the step's values; the jump pops the loop state.
+        case Opcode::OpIterNext: pops = 2; pushes = 2 + in.operands[1]; break;
+        case Opcode::OpPrint: pops = in.operands[0]; break;
+        case Opcode::OpArray: case Opcode::OpStringConcat: pops = in.operands[0]; pushes = 1; break;
+        case Opcode::OpCall: pops = in.operands[0] + 1; pushes = 1; break;
+        case Opcode::OpReturnValue: pops = 1; return false;
+        case Opcode::OpReturn: case Opcode::OpJump: return false;
+        case Opcode::OpNop: break;
+    }
+    return true;
+}
 
-        switch (op) {
-            case Opcode::OpNop: break;
-            case Opcode::OpConstant: {
-                int operand = readUint16(instructions_.data() + ip_ + 1);
-                ip_ += 2;
-                if (auto err = pushChecked(constants_[operand])) return err;
-                break;
-            }
-            case Opcode::OpAdd: case Opcode::OpSub: case Opcode::OpMul:
-            case Opcode::OpDiv: case Opcode::OpMod:
-                if (auto err = binaryOp(op)) return err;
-                break;
-            case Opcode::OpEqual: case Opcode::OpNotEqual:
-            case Opcode::OpGreaterThan: case Opcode::OpLessThan:
-            case Opcode::OpGreaterEqual: case Opcode::OpLessEqual:
-                if (auto err = compareOp(op)) return err;
-                break;
-            case Opcode::OpMinus: {
-                auto [operand, err] = popChecked();
-                if (err) return err;
-                auto res = execMinus(operand);
-                if (isError(res)) return res;
-                if (auto e = pushChecked(res)) return e;
-                break;
-            }
-            case Opcode::OpBang: {
-                auto [operand, err] = popChecked();
-                if (err) return err;
-                if (auto e = pushChecked(nativeBoolToBooleanObject(!isTruthy(operand)))) return e;
-                break;
-            }
-            case Opcode::OpTrue:
-                if (auto e = pushChecked(getTrue())) return e;
-                break;
-            case Opcode::OpFalse:
-                if (auto e = pushChecked(getFalse())) return e;
-                break;
-            case Opcode::OpNull:
-                if (auto e = pushChecked(getNull())) return e;
-                break;
-            case Opcode::OpPop: {
-                auto [_, err] = popChecked();
-                if (err) return err;
-                break;
-            }
-            case Opcode::OpSetGlobal: {
-                int idx = readUint16(instructions_.data() + ip_ + 1);
-                ip_ += 2;
-                auto [val, err] = popChecked();
-                if (err) return err;
-                setGlobal(idx, val);
-                break;
-            }
-            case Opcode::OpGetGlobal: {
-                int idx = readUint16(instructions_.data() + ip_ + 1);
-                ip_ += 2;
-                if (auto e = pushChecked(getGlobal(idx))) return e;
-                break;
-            }
-            case Opcode::OpPrint: {
-                int argc = readUint16(instructions_.data() + ip_ + 1);
-                ip_ += 2;
-                if (auto err = opPrint(argc)) return err;
-                break;
-            }
-            case Opcode::OpJump: {
-                int pos = readUint16(instructions_.data() + ip_ + 1);
-                ip_ = pos - 1;
-                break;
-            }
-            case Opcode::OpJumpNotTruthy: {
-                int pos = readUint16(instructions_.data() + ip_ + 1);
-                ip_ += 2;
-                auto [cond, err] = popChecked();
-                if (err) return err;
-                if (!isTruthy(cond)) ip_ = pos - 1;
-                break;
-            }
-            case Opcode::OpArray: {
-                int numElements = readUint16(instructions_.data() + ip_ + 1);
-                ip_ += 2;
-                if (auto err = opArray(numElements)) return err;
-                break;
-            }
-            case Opcode::OpStringConcat: {
-                int n = readUint16(instructions_.data() + ip_ + 1);
-                ip_ += 2;
-                if (auto err = opStringConcat(n)) return err;
-                break;
-            }
-            case Opcode::OpIndex: {
-                auto [left, right, err] = popTwo();
-                if (err) return err;
-                auto res = execIndex(left, right);
-                if (isError(res)) return res;
-                if (auto e = pushChecked(res)) return e;
-                break;
-            }
-            case Opcode::OpSetIndex: {
-                auto [target, index, value, err] = popThree();
-                if (err) return err;
-                auto setErr = execSetIndex(target, index, value);
-                if (setErr) return setErr;
-                if (auto e = pushChecked(getNull())) return e;
-                break;
-            }
-            case Opcode::OpLen: {
-                auto [obj, err] = popChecked();
-                if (err) return err;
-                auto res = execLen(obj);
-                if (isError(res)) return res;
-                if (auto e = pushChecked(res)) return e;
-                break;
-            }
-            case Opcode::OpType: {
-                auto [obj, err] = popChecked();
-                if (err) return err;
-                auto res = execType(obj);
-                if (auto e = pushChecked(res)) return e;
-                break;
-            }
-            case Opcode::OpSwap:
-                if (auto err = opSwap()) return err;
-                break;
-            case Opcode::OpCall: {
-                int argc = readUint16(instructions_.data() + ip_ + 1);
-                ip_ += 2;
-                if (sp_ < argc + 1) return errorWithLoc("call: stack underflow");
-                std::vector<ObjectPtr> args(argc);
-                for (int i = argc - 1; i >= 0; i--) {
-                    auto [val, err] = popChecked();
-                    if (err) return err;
-                    args[i] = val;
-                }
-                auto [callee, calleeErr] = popChecked();
-                if (calleeErr) return calleeErr;
+// numLocals is -1 for top-level code, which has no locals. balanced requires
+// the stack to be empty wherever the code ends.
+static bool verifyInstructions(const Instructions& ins, size_t numConstants, int numLocals, std::string* error,
+                               bool balanced = false) {
+    auto fail = [&](int pc, const std::string& msg) {
+        *error = "pc " + std::to_string(pc) + ": " + msg;
+        return false;
+    };
 
-                if (auto fn = std::dynamic_pointer_cast<CompiledFunction>(callee)) {
-                    if (static_cast<int>(args.size()) != fn->numParameters) {
-                        return errorWithLoc("wrong number of arguments");
-                    }
-                    auto res = runCompiledFunction(fn, args);
-                    if (isError(res) || isSignal(res)) return res;
-                    if (auto err = push(res)) return err;
-                } else if (auto builtin = std::dynamic_pointer_cast<Builtin>(callee)) {
-                    auto res = builtin->fn(args);
-                    if (isError(res) || isSignal(res)) return res;
-                    if (auto err = push(res)) return err;
-                } else {
-                    return errorWithLoc("not a function");
-                }
+    std::vector<Instruction> decoded;
+    std::vector<int> index(ins.size() + 1, -1);
+    for (const auto& in : Decode(ins)) {
+        if (!in.def) return fail(in.pc, "unknown opcode " + std::to_string(static_cast<int>(in.op)));
+        if (in.pc + in.width > static_cast<int>(ins.size())) return fail(in.pc, "truncated " + in.def->name);
+        index[in.pc] = static_cast<int>(decoded.size());
+        decoded.push_back(in);
+    }
+    index[ins.size()] = static_cast<int>(decoded.size());
+
+    for (const auto& in : decoded) {
+        switch (in.op) {
+            case Opcode::OpConstant:
+                if (static_cast<size_t>(in.operands[0]) >= numConstants)
+                    return fail(in.pc, "constant " + std::to_string(in.operands[0]) + " out of range (" +
+                                       std::to_string(numConstants) + " constants)");
+                break;
+            case Opcode::OpGetLocal: case Opcode::OpSetLocal:
+                if (numLocals < 0) return fail(in.pc, in.def->name + " outside a function");
+                if (in.operands[0] >= numLocals)
+                    return fail(in.pc, "local " + std::to_string(in.operands[0]) + " out of range (" +
+                                       std::to_string(numLocals) + " locals)");
+                break;
+            case Opcode::OpIterable: case Opcode::OpIterNext: {
+                int count = in.operands[in.op == Opcode::OpIterable ? 0 : 1];
+                if (count != 1 && count != 2) return fail(in.pc, in.def->name + " takes 1 or 2 loop variables, not " + std::to_string(count));
+                if (in.op == Opcode::OpIterable) break;
+                [[fallthrough]];
+            }
+            case Opcode::OpJump: case Opcode::OpJumpNotTruthy:
+                if (in.operands[0] > static_cast<int>(ins.size()) || index[in.operands[0]] < 0)
+                    return fail(in.pc, "jump target " + std::to_string(in.operands[0]) + " is not an instruction boundary");
                 break;
-            }
             default:
-                return errorWithLoc("unknown opcode");
+                break;
         }
     }
-    return getNull();
+
+    // Simulate stack depths along every path; the end of the code is a valid
+    // successor with any depth unless balanced is set.
+    std::vector<int> depth(decoded.size(), -1);
+    std::vector<int> work;
+    auto reach = [&](int target, int d, int from) {
+        int i = index[target];
+        if (i == static_cast<int>(decoded.size())) {
+            if (balanced && d != 0) return fail(from, "stack depth " + std::to_string(d) + " at the end of the program");
+            return true;
+        }
+        if (depth[i] < 0) {
+            depth[i] = d;
+            work.push_back(i);
+        } else if (depth[i] != d) {
+            return fail(from, "stack depth " + std::to_string(d) + " at jump to " + std::to_string(target) +
+                              " differs from " + std::to_string(depth[i]));
+        }
+        return true;
+    };
+    if (!decoded.empty() && !reach(0, 0, 0)) return false;
+    while (!work.empty()) {
+        const auto& in = decoded[work.back()];
+        int d = depth[work.back()];
+        work.pop_back();
+
+        int pops, pushes;
+        bool fallsThrough = stackEffect(in, pops, pushes);
+        if (d < pops)
+            return fail(in.pc, "stack underflow in " + in.def->name + " (needs " + std::to_string(pops) +
+                               ", has " + std::to_string(d) + ")");
+        d += pushes - pops;
+        if (d > StackSize) return fail(in.pc, "stack overflow");
+        if (fallsThrough && !reach(in.pc + in.width, d, in.pc)) return false;
+        if ((in.op == Opcode::OpJump || in.op == Opcode::OpJumpNotTruthy) && !reach(in.operands[0], d, in.pc)) return false;
+        if (in.op == Opcode::OpIterNext && !reach(in.operands[0], d - 2 - in.operands[1], in.pc)) return false;
+    }
+    return true;
+}
+
+static bool verifyProgram(const Instructions& ins, const std::vector<ObjectPtr>& constants, std::string* error,
+                          bool balanced) {
+    if (!verifyInstructions(ins, constants.size(), -1, error, balanced)) return false;
+    for (const auto& c : constants) {
+        auto fn = std::dynamic_pointer_cast<CompiledFunction>(c);
+        if (!fn) continue;
+        if (fn->numParameters > fn->numLocals) {
+            *error = "function " + fn->name + ": " + std::to_string(fn->numParameters) + " parameters but " +
+                     std::to_string(fn->numLocals) + " locals";
+            return false;
+        }
+        if (!verifyInstructions(fn->instructions, constants.size(), fn->numLocals, error)) {
+            *error = "function " + fn->name + ": " + *error;
+            return false;
+        }
+    }
+    return true;
+}
+
+bool verifyBytecode(const Bytecode& bc, std::string* error, bool balanced) {
+    return verifyProgram(bc.instructions, bc.constants, error, balanced);
 }
 
 // ============ VM operations ============
@@ -281,10 +590,25 @@ ObjectPtr VM::execBinary(Opcode op, ObjectPtr left, ObjectPtr right) {
     if (auto l = std::dynamic_pointer_cast<Integer>(left)) {
         if (auto r = std::dynamic_pointer_cast<Integer>(right)) {
             switch (op) {
-                case Opcode::OpAdd: return addIntegers(l, r);
-                case Opcode::OpSub: return subIntegers(l, r);
-                case Opcode::OpMul: return mulIntegers(l, r);
-                case Opcode::OpDiv: return divIntegers(l, r);
+                case Opcode::OpAdd: case Opcode::OpSub: case Opcode::OpMul: {
+                    int64_t v;
+                    bool overflowed = op == Opcode::OpAdd   ? wrappingAdd(l->value, r->value, v)
+                                      : op == Opcode::OpSub ? wrappingSub(l->value, r->value, v)
+                                                            : wrappingMul(l->value, r->value, v);
+                    return wrappedInteger(overflowed, v, op == Opcode::OpAdd ? "+" : op == Opcode::OpSub ? "-" : "*");
+                }
+                case Opcode::OpDiv: {
+                    if (r->value != 0) {
+                        std::string file, fn;
+                        int line = 0, col = 0;
+                        lookupDebug(ip_, file, line, col, fn);
+                        if (auto err = Warnings::instance().warn("lang", IntegerDivisionWarning, file, line, col)) return err;
+                    }
+                    if (r->value == 0) return divIntegers(l, r);
+                    int64_t v;
+                    bool overflowed = wrappingDiv(l->value, r->value, v);
+                    return wrappedInteger(overflowed, v, "/");
+                }
                 case Opcode::OpMod: return modIntegers(l, r);
                 default: break;
             }
@@ -301,10 +625,12 @@ ObjectPtr VM::execBinary(Opcode op, ObjectPtr left, ObjectPtr right) {
             }
         }
     }
+    if (auto mixed = promoteNumbers(left, right); mixed.first) return execBinary(op, mixed.first, mixed.second);
     if (op == Opcode::OpAdd) {
         if (auto l = std::dynamic_pointer_cast<String>(left)) {
             if (auto r = std::dynamic_pointer_cast<String>(right)) {
-                return concatStrings(l, r);
+                auto result = concatStrings(l, r);
+                return isSignal(result) ? traced(result) : result;
             }
         }
     }
@@ -312,6 +638,9 @@ ObjectPtr VM::execBinary(Opcode op, ObjectPtr left, ObjectPtr right) {
 }
 
 ObjectPtr VM::execCompare(Opcode op, ObjectPtr left, ObjectPtr right) {
+    bool equality = op == Opcode::OpEqual || op == Opcode::OpNotEqual;
+    bool leftNull = !left || left->type() == ObjectType::NULL_OBJ, rightNull = !right || right->type() == ObjectType::NULL_OBJ;
+    if (equality && (leftNull || rightNull)) return nativeBoolToBooleanObject((leftNull && rightNull) == (op == Opcode::OpEqual));
     if (auto l = std::dynamic_pointer_cast<Integer>(left)) {
         if (auto r = std::dynamic_pointer_cast<Integer>(right)) {
             switch (op) {
@@ -345,6 +674,8 @@ ObjectPtr VM::execCompare(Opcode op, ObjectPtr left, ObjectPtr right) {
                 case Opcode::OpNotEqual: return nativeBoolToBooleanObject(l->value != r->value);
                 case Opcode::OpGreaterThan: return nativeBoolToBooleanObject(l->value > r->value);
                 case Opcode::OpLessThan: return nativeBoolToBooleanObject(l->value < r->value);
+                case Opcode::OpGreaterEqual: return nativeBoolToBooleanObject(l->value >= r->value);
+                case Opcode::OpLessEqual: return nativeBoolToBooleanObject(l->value <= r->value);
                 default: break;
             }
         }
@@ -355,22 +686,52 @@ ObjectPtr VM::execCompare(Opcode op, ObjectPtr left, ObjectPtr right) {
             if (op == Opcode::OpNotEqual) return nativeBoolToBooleanObject(l->value != r->value);
         }
     }
+    if (auto mixed = promoteNumbers(left, right); mixed.first) return execCompare(op, mixed.first, mixed.second);
+    auto t = left ? left->type() : ObjectType::NULL_OBJ;
+    if (equality && right && t == right->type() &&
+        (t == ObjectType::MAP || t == ObjectType::ARRAY || t == ObjectType::INT_ARRAY || t == ObjectType::FLOAT_ARRAY))
+        return nativeBoolToBooleanObject(equals(left, right) == (op == Opcode::OpEqual));
     return errorWithLoc("unsupported operands for compare");
 }
 
+// Result of integer arithmetic that may have wrapped around; overflow raises
+// OverflowError under checked arithmetic and otherwise warns.
+ObjectPtr VM::wrappedInteger(bool overflowed, int64_t value, const char* op) {
+    if (overflowed) {
+        if (checkedArithmeticEnabled()) return traced(overflowError(op));
+        std::string file, fn;
+        int line = 0, col = 0;
+        lookupDebug(ip_, file, line, col, fn);
+        if (auto err = Warnings::instance().warn("overflow", std::string("integer overflow in '") + op +
+                                                 "'; the result wrapped around", file, line, col))
+            return err;
+    }
+    return newIntegerFromPool(value);
+}
+
 ObjectPtr VM::execMinus(ObjectPtr operand) {
-    if (auto o = std::dynamic_pointer_cast<Integer>(operand)) return newIntegerFromPool(-o->value);
+    if (auto o = std::dynamic_pointer_cast<Integer>(operand)) {
+        int64_t v;
+        bool overflowed = wrappingNeg(o->value, v);
+        return wrappedInteger(overflowed, v, "-");
+    }
     if (auto o = std::dynamic_pointer_cast<Float>(operand)) return newFloatFromPool(-o->value);
     return errorWithLoc("unsupported operand for prefix -");
 }
 
+// Calls an instance's name method (__getitem__, __setitem__) with args; the
+// VM cannot run class code, so the call goes through the interpreter. nullptr
+// when value is not an instance whose class defines name.
+static ObjectPtr callIndexMethod(const ObjectPtr& value, const std::string& name, const std::vector<ObjectPtr>& args) {
+    auto inst = std::dynamic_pointer_cast<Instance>(value);
+    if (!inst) return nullptr;
+    auto fn = inst->cls->method(name);
+    if (!fn) return nullptr;
+    auto result = native::callCallable(newBoundMethod(inst, fn), args);
+    return result ? result : getNull();
+}
+
 ObjectPtr VM::execIndex(ObjectPtr left, ObjectPtr index) {
-    if (left->type() == ObjectType::ARRAY && index->type() == ObjectType::INTEGER) {
-        auto arr = std::dynamic_pointer_cast<Array>(left);
-        auto idx = std::dynamic_pointer_cast<Integer>(index)->value;
-        if (idx < 0 || idx >= static_cast<int64_t>(arr->elements.size())) return getNull();
-        return arr->elements[idx];
-    }
     if (left->type() == ObjectType::MAP) {
         auto m = std::dynamic_pointer_cast<Map>(left);
         for (const auto& [k, v] : m->pairs) {
@@ -378,25 +739,52 @@ ObjectPtr VM::execIndex(ObjectPtr left, ObjectPtr index) {
         }
         return getNull();
     }
-    if (left->type() == ObjectType::STRING && index->type() == ObjectType::INTEGER) {
-        auto s = std::dynamic_pointer_cast<String>(left);
-        auto idx = std::dynamic_pointer_cast<Integer>(index)->value;
-        if (idx < 0 || idx >= static_cast<int64_t>(s->value.size())) return getNull();
-        return newStringFromPool(std::string(1, s->value[idx]));
+    if (auto result = callIndexMethod(left, "__getitem__", {index})) return result;
+    if (index->type() != ObjectType::INTEGER) return errorWithLoc("index operator not supported");
+    auto idx = std::static_pointer_cast<Integer>(index)->value;
+    size_t pos = 0;
+    if (auto arr = std::dynamic_pointer_cast<Array>(left)) {
+        if (!sequenceIndex(idx, arr->elements.size(), pos)) return indexSignal("array", idx, arr->elements.size());
+        return arr->elements[pos];
+    }
+    if (auto s = std::dynamic_pointer_cast<String>(left)) {
+        if (!sequenceIndex(idx, s->value.size(), pos)) return indexSignal("string", idx, s->value.size());
+        return newStringFromPool(std::string(1, s->value[pos]));
+    }
+    if (auto ints = std::dynamic_pointer_cast<IntArray>(left)) {
+        if (!sequenceIndex(idx, ints->values.size(), pos)) return indexSignal("int_array", idx, ints->values.size());
+        return newIntegerFromPool(ints->values[pos]);
+    }
+    if (auto floats = std::dynamic_pointer_cast<FloatArray>(left)) {
+        if (!sequenceIndex(idx, floats->values.size(), pos)) return indexSignal("float_array", idx, floats->values.size());
+        return newFloat(floats->values[pos]);
     }
     return errorWithLoc("index operator not supported");
 }
 
+// indexError with the VM's stack trace attached.
+ObjectPtr VM::indexSignal(const std::string& what, int64_t index, size_t length) {
+    auto signal = std::static_pointer_cast<ExceptionSignal>(indexError(what, index, length));
+    signal->exception->stackTrace = buildStackTrace();
+    return signal;
+}
+
+ObjectPtr VM::traced(ObjectPtr signal) {
+    std::static_pointer_cast<ExceptionSignal>(signal)->exception->stackTrace = buildStackTrace();
+    return signal;
+}
+
 ObjectPtr VM::execSetIndex(ObjectPtr target, ObjectPtr index, ObjectPtr value) {
+    if (auto err = frozenError(target, index)) {
+        std::static_pointer_cast<ExceptionSignal>(err)->exception->stackTrace = buildStackTrace();
+        return err;
+    }
     if (auto arr = std::dynamic_pointer_cast<Array>(target)) {
         auto idx = std::dynamic_pointer_cast<Integer>(index);
         if (!idx) return errorWithLoc("array index must be integer");
-        if (idx->value < 0 || idx->value >= static_cast<int64_t>(arr->elements.size())) {
-            auto ex = std::dynamic_pointer_cast<Exception>(newException(INDEX_ERROR, "array index out of range: " + std::to_string(idx->value)));
-            ex->stackTrace = buildStackTrace();
-            return newExceptionSignal(ex);
-        }
-        arr->elements[idx->value] = value;
+        size_t pos = 0;
+        if (!sequenceIndex(idx->value, arr->elements.size(), pos)) return indexSignal("array", idx->value, arr->elements.size());
+        arr->elements[pos] = value;
         return nullptr;
     }
     if (auto m = std::dynamic_pointer_cast<Map>(target)) {
@@ -407,23 +795,45 @@ ObjectPtr VM::execSetIndex(ObjectPtr target, ObjectPtr index, ObjectPtr value) {
                 return nullptr;
             }
         }
+        if (auto err = mapSizeError(m->pairs.size() + 1)) return traced(err);
         m->pairs.push_back({index, value});
         return nullptr;
     }
+    if (target->type() == ObjectType::INT_ARRAY || target->type() == ObjectType::FLOAT_ARRAY) {
+        auto idx = std::dynamic_pointer_cast<Integer>(index);
+        if (!idx) return errorWithLoc("array index must be integer");
+        size_t pos = 0;
+        if (auto ints = std::dynamic_pointer_cast<IntArray>(target)) {
+            auto v = std::dynamic_pointer_cast<Integer>(value);
+            if (!v) return errorWithLoc("int_array elements must be integers");
+            if (!sequenceIndex(idx->value, ints->values.size(), pos)) return indexSignal("int_array", idx->value, ints->values.size());
+            ints->values[pos] = v->value;
+            return nullptr;
+        }
+        auto floats = std::static_pointer_cast<FloatArray>(target);
+        if (value->type() != ObjectType::INTEGER && value->type() != ObjectType::FLOAT)
+            return errorWithLoc("float_array elements must be numbers");
+        if (!sequenceIndex(idx->value, floats->values.size(), pos)) return indexSignal("float_array", idx->value, floats->values.size());
+        auto i = std::dynamic_pointer_cast<Integer>(value);
+        floats->values[pos] = i ? static_cast<double>(i->value) : std::static_pointer_cast<Float>(value)->value;
+        return nullptr;
+    }
+    if (auto result = callIndexMethod(target, "__setitem__", {index, value})) {
+        if (isError(result) || isSignal(result)) return result;
+        return nullptr;
+    }
     return errorWithLoc("index assignment not supported");
 }
 
 ObjectPtr VM::execLen(ObjectPtr obj) {
-    if (auto arr = std::dynamic_pointer_cast<Array>(obj))
-        return newIntegerFromPool(static_cast<int64_t>(arr->elements.size()));
-    if (auto s = std::dynamic_pointer_cast<String>(obj))
-        return newIntegerFromPool(static_cast<int64_t>(s->value.size()));
-    if (auto m = std::dynamic_pointer_cast<Map>(obj))
-        return newIntegerFromPool(static_cast<int64_t>(m->pairs.size()));
-    return errorWithLoc("argument to len not supported");
+    auto n = lengthOf(obj);
+    if (n < 0) return errorWithLoc("argument to len not supported");
+    return newIntegerFromPool(n);
 }
 
 ObjectPtr VM::execType(ObjectPtr obj) {
+    // Compiled functions are the same kind of value to scripts.
+    if (obj->type() == ObjectType::COMPILED_FUNCTION) return newStringFromPool(ObjectTypeToString(ObjectType::FUNCTION));
     return newStringFromPool(ObjectTypeToString(obj->type()));
 }
 
@@ -439,7 +849,7 @@ ObjectPtr VM::opPrint(int argc) {
         if (i > 0) out += " ";
         out += args[i]->inspect();
     }
-    std::printf("%s\n", out.c_str());
+    if (auto err = native::writeOutput("print", out + "\n")) return err;
     return nullptr;
 }
 
@@ -450,7 +860,7 @@ ObjectPtr VM::opArray(int numElements) {
         if (err) return err;
         elements[i] = val;
     }
-    return newArrayFromPool(std::move(elements));
+    return push(newArrayFromPool(std::move(elements)));
 }
 
 ObjectPtr VM::opStringConcat(int n) {
@@ -460,7 +870,9 @@ ObjectPtr VM::opStringConcat(int n) {
         if (err) return err;
         parts[i] = std::dynamic_pointer_cast<String>(val);
     }
-    return concatMultipleStrings(parts);
+    auto result = concatMultipleStrings(parts);
+    if (isSignal(result)) return traced(result);
+    return push(result);
 }
 
 ObjectPtr VM::opSwap() {
@@ -469,180 +881,54 @@ ObjectPtr VM::opSwap() {
     return nullptr;
 }
 
+// Replaces the iterable on top of the stack with the loop state OpIterNext
+// walks: the loop's steps, as forInSteps gives them, and the next position.
+ObjectPtr VM::opIterable(int count) {
+    auto [iterable, err] = popChecked();
+    if (err) return err;
+    auto steps = forInSteps(iterable, count == 2);
+    if (!steps) return errorWithLoc(std::string("cannot iterate over ") + ObjectTypeToString(iterable->type()));
+    if (auto e = push(steps)) return e;
+    return push(newIntegerFromPool(0));
+}
+
+// Pushes the next step's count values and advances the position, or pops the
+// loop state and sets done once every step has been taken.
+ObjectPtr VM::opIterNext(int count, bool& done) {
+    auto steps = sp_ >= 2 ? std::dynamic_pointer_cast<Array>(stack_[sp_ - 2]) : nullptr;
+    auto pos = sp_ >= 2 ? std::dynamic_pointer_cast<Integer>(stack_[sp_ - 1]) : nullptr;
+    if (!steps || !pos) return errorWithLoc("OpIterNext: no loop state on the stack");
+    done = pos->value >= static_cast<int64_t>(steps->elements.size());
+    if (done) {
+        stack_[--sp_] = nullptr;
+        stack_[--sp_] = nullptr;
+        return nullptr;
+    }
+    auto step = steps->elements[pos->value];
+    stack_[sp_ - 1] = newIntegerFromPool(pos->value + 1);
+    if (count == 1) return push(step);
+    auto& pair = std::static_pointer_cast<Array>(step)->elements;
+    if (auto e = push(pair[0])) return e;
+    return push(pair[1]);
+}
+
+// Calls fn as the interpreter calls a script function: missing arguments are
+// null and extra ones are ignored.
 ObjectPtr VM::runCompiledFunction(std::shared_ptr<CompiledFunction> fn, const std::vector<ObjectPtr>& args) {
+    if (callDepth_ >= MaxCallDepth) return errorWithLoc("maximum call depth exceeded");
     std::vector<ObjectPtr> locals(fn->numLocals, nullptr);
-    for (int i = 0; i < fn->numParameters && i < static_cast<int>(args.size()); i++) {
-        locals[i] = args[i];
+    for (int i = 0; i < fn->numParameters && i < fn->numLocals; i++) {
+        locals[i] = i < static_cast<int>(args.size()) ? args[i] : getNull();
     }
-
     int ip = 0;
-    const auto& ins = fn->instructions;
-
-    auto read16 = [&](int offset) -> int {
-        return static_cast<int>(static_cast<uint16_t>(ins[offset]) << 8 | static_cast<uint16_t>(ins[offset + 1]));
-    };
-
-    while (ip < static_cast<int>(ins.size())) {
-        if (instrBudget_ > 0) {
-            instrBudget_--;
-            if (instrBudget_ == 0) {
-                auto ex = std::dynamic_pointer_cast<Exception>(newException(RUNTIME_ERROR, "instruction budget exceeded"));
-                ex->stackTrace = buildStackTrace();
-                return newExceptionSignal(ex);
-            }
-        }
-
-        auto op = static_cast<Opcode>(ins[ip]);
-        switch (op) {
-            case Opcode::OpNop: break;
-            case Opcode::OpConstant: {
-                int idx = read16(ip + 1); ip += 2;
-                if (auto err = push(constants_[idx])) return err;
-                break;
-            }
-            case Opcode::OpAdd: case Opcode::OpSub: case Opcode::OpMul:
-            case Opcode::OpDiv: case Opcode::OpMod:
-                if (auto err = binaryOp(op)) return err;
-                break;
-            case Opcode::OpEqual: case Opcode::OpNotEqual:
-            case Opcode::OpGreaterThan: case Opcode::OpLessThan:
-            case Opcode::OpGreaterEqual: case Opcode::OpLessEqual:
-                if (auto err = compareOp(op)) return err;
-                break;
-            case Opcode::OpMinus: {
-                auto [operand, err] = popChecked();
-                if (err) return err;
-                auto res = execMinus(operand);
-                if (isError(res)) return res;
-                if (auto e = push(res)) return e;
-                break;
-            }
-            case Opcode::OpBang: {
-                auto [operand, err] = popChecked();
-                if (err) return err;
-                if (auto e = push(nativeBoolToBooleanObject(!isTruthy(operand)))) return e;
-                break;
-            }
-            case Opcode::OpTrue: if (auto e = push(getTrue())) return e; break;
-            case Opcode::OpFalse: if (auto e = push(getFalse())) return e; break;
-            case Opcode::OpNull: if (auto e = push(getNull())) return e; break;
-            case Opcode::OpPop: { auto [_, err] = popChecked(); if (err) return err; break; }
-            case Opcode::OpSetGlobal: {
-                int idx = read16(ip + 1); ip += 2;
-                auto [val, err] = popChecked(); if (err) return err;
-                setGlobal(idx, val);
-                break;
-            }
-            case Opcode::OpGetGlobal: {
-                int idx = read16(ip + 1); ip += 2;
-                if (auto err = push(getGlobal(idx))) return err;
-                break;
-            }
-            case Opcode::OpPrint: {
-                int argc = read16(ip + 1); ip += 2;
-                if (auto err = opPrint(argc)) return err;
-                break;
-            }
-            case Opcode::OpJump: {
-                int target = read16(ip + 1);
-                ip = target - 1;
-                break;
-            }
-            case Opcode::OpJumpNotTruthy: {
-                int target = read16(ip + 1);
-                ip += 2;
-                auto [cond, err] = popChecked(); if (err) return err;
-                if (!isTruthy(cond)) ip = target - 1;
-                break;
-            }
-            case Opcode::OpArray: {
-                int num = read16(ip + 1); ip += 2;
-                if (auto err = opArray(num)) return err;
-                break;
-            }
-            case Opcode::OpStringConcat: {
-                int n = read16(ip + 1); ip += 2;
-                if (auto err = opStringConcat(n)) return err;
-                break;
-            }
-            case Opcode::OpIndex: {
-                auto [left, right, err] = popTwo(); if (err) return err;
-                auto res = execIndex(left, right);
-                if (isError(res)) return res;
-                if (auto e = push(res)) return e;
-                break;
-            }
-            case Opcode::OpSetIndex: {
-                auto [t, i, v, err] = popThree(); if (err) return err;
-                if (auto setErr = execSetIndex(t, i, v)) return setErr;
-                if (auto e = push(getNull())) return e;
-                break;
-            }
-            case Opcode::OpLen: {
-                auto [o, err] = popChecked(); if (err) return err;
-                auto res = execLen(o);
-                if (isError(res)) return res;
-                if (auto e = push(res)) return e;
-                break;
-            }
-            case Opcode::OpType: {
-                auto [o, err] = popChecked(); if (err) return err;
-                if (auto e = push(execType(o))) return e;
-                break;
-            }
-            case Opcode::OpSwap:
-                if (auto err = opSwap()) return err;
-                break;
-            case Opcode::OpReturnValue: {
-                auto [val, err] = popChecked(); if (err) return err;
-                return val;
-            }
-            case Opcode::OpReturn:
-                return getNull();
-            case Opcode::OpCall: {
-                int argc = read16(ip + 1); ip += 2;
-                std::vector<ObjectPtr> argv(argc);
-                for (int i = argc - 1; i >= 0; i--) {
-                    auto [val, err] = popChecked(); if (err) return err;
-                    argv[i] = val;
-                }
-                auto [callee, calleeErr] = popChecked(); if (calleeErr) return calleeErr;
-
-                if (auto fn2 = std::dynamic_pointer_cast<CompiledFunction>(callee)) {
-                    if (static_cast<int>(argv.size()) != fn2->numParameters) {
-                        return errorWithLoc("wrong number of arguments");
-                    }
-                    auto res = runCompiledFunction(fn2, argv);
-                    if (isError(res) || isSignal(res)) return res;
-                    if (auto err = push(res)) return err;
-                } else if (auto builtin = std::dynamic_pointer_cast<Builtin>(callee)) {
-                    auto res = builtin->fn(argv);
-                    if (isError(res) || isSignal(res)) return res;
-                    if (auto err = push(res)) return err;
-                } else {
-                    return errorWithLoc("not a function");
-                }
-                break;
-            }
-            case Opcode::OpGetLocal: {
-                int idx = read16(ip + 1); ip += 2;
-                if (idx < 0 || idx >= static_cast<int>(locals.size())) return errorWithLoc("getlocal: index out of range");
-                if (auto err = push(locals[idx])) return err;
-                break;
-            }
-            case Opcode::OpSetLocal: {
-                int idx = read16(ip + 1); ip += 2;
-                auto [val, err] = popChecked(); if (err) return err;
-                if (idx < 0 || idx >= static_cast<int>(locals.size())) return errorWithLoc("setlocal: index out of range");
-                locals[idx] = val;
-                break;
-            }
-            default:
-                return errorWithLoc("unknown opcode");
-        }
-        ip++;
-    }
-    return getNull();
+    int base = sp_;
+    Frame frame{fn->instructions, ip, locals, false};
+    callDepth_++;
+    auto result = dispatch(frame);
+    callDepth_--;
+    // A return from inside a for-in loop leaves the loop state behind.
+    while (sp_ > base) stack_[--sp_] = nullptr;
+    return result;
 }
 
 void VM::setGlobal(int idx, ObjectPtr val) {
@@ -653,10 +939,15 @@ void VM::setGlobal(int idx, ObjectPtr val) {
 }
 
 ObjectPtr VM::getGlobal(int idx) {
-    if (idx >= static_cast<int>(globals_.size()) || !globals_[idx]) return getNull();
+    if (idx >= static_cast<int>(globals_.size())) return nullptr;
     return globals_[idx];
 }
 
+std::string VM::globalName(int idx) const {
+    if (idx < static_cast<int>(debug_.globals.size()) && !debug_.globals[idx].empty()) return debug_.globals[idx];
+    return "global #" + std::to_string(idx);
+}
+
 ObjectPtr VM::errorWithLoc(const std::string& msg) {
     std::string file;
     int line = 0, col = 0;
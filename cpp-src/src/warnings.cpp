@@ -0,0 +1,356 @@
+#include "darix/warnings.hpp"
+#include "darix/ast_walk.hpp"
+#include "darix/runner.hpp"
+#include <algorithm>
+#include <iostream>
+#include <unordered_map>
+#include <unordered_set>
+#include <vector>
+
+namespace darix {
+
+Warnings& Warnings::instance() {
+    static Warnings warnings;
+    return warnings;
+}
+
+bool Warnings::setAction(const std::string& name, std::string* error) {
+    if (name == "default") action_ = WarningAction::Default;
+    else if (name == "once") action_ = WarningAction::Once;
+    else if (name == "ignore") action_ = WarningAction::Ignore;
+    else if (name == "error") action_ = WarningAction::Error;
+    else {
+        *error = "unknown warning action '" + name + "' (expected default, once, ignore or error)";
+        return false;
+    }
+    return true;
+}
+
+void Warnings::reset() {
+    std::lock_guard<std::mutex> guard(lock_);
+    action_ = WarningAction::Default;
+    json_ = false;
+    seen_.clear();
+    reported_ = 0;
+}
+
+ObjectPtr Warnings::warn(const std::string& category, const std::string& message, const std::string& file, int line, int column) {
+    std::string where = (file.empty() ? "" : file + ":") + std::to_string(line) + ":" + std::to_string(column);
+    std::lock_guard<std::mutex> guard(lock_);
+    switch (action_) {
+        case WarningAction::Ignore:
+            return nullptr;
+        case WarningAction::Error: {
+            reported_++;
+            auto ex = std::dynamic_pointer_cast<Exception>(newException("Warning", message + " [" + category + "] at " + where));
+            return newExceptionSignal(ex);
+        }
+        case WarningAction::Once:
+            if (!seen_.insert(category + "\n" + message).second) return nullptr;
+            break;
+        case WarningAction::Default:
+            if (!seen_.insert(where + "\n" + category + "\n" + message).second) return nullptr;
+            break;
+    }
+    reported_++;
+    if (json_) {
+        Diagnostic d{Diagnostic::Stage::Warning, message, file, line, column, category, message, ""};
+        std::cerr << diagnosticJson(d) << "\n";
+    } else {
+        std::cerr << where << ": warning: " << message << " [" << category << "]\n";
+    }
+    return nullptr;
+}
+
+std::string duplicateKeyWarning(const ObjectPtr& key) {
+    return "duplicate key " + repr(key) + " in map literal; the later value replaces the earlier one";
+}
+
+namespace {
+
+// The value of a constant map key and its token, or nullptr.
+static ObjectPtr literalKey(Expression* key, const Token** token) {
+    if (auto s = dynamic_cast<StringLiteral*>(key)) return *token = &s->token, newString(s->value);
+    if (auto i = dynamic_cast<IntegerLiteral*>(key)) return *token = &i->token, newInteger(i->value);
+    if (auto b = dynamic_cast<BooleanLiteral*>(key)) return *token = &b->token, newBoolean(b->value);
+    return nullptr;
+}
+
+// Tracks, per enclosing function, the variables it declares and every name
+// referenced inside it (nested functions included, so closures count). Block
+// scopes follow the interpreter's: a function body shares its parameters'
+// scope, as for-in, catch, with and class bodies share theirs, and other
+// blocks open a new one.
+class Linter : public walk::Visitor {
+public:
+    explicit Linter(const std::function<bool(const std::string&)>& isBuiltin) : isBuiltin_(isBuiltin) {
+        blocks_.emplace_back();
+    }
+
+    bool enter(Node* node) override {
+        if (failed()) return false;
+        if (auto ls = dynamic_cast<LetStatement*>(node)) {
+            declare(ls->name.get(), true);
+        } else if (auto fd = dynamic_cast<FunctionDeclaration*>(node)) {
+            declare(fd->name.get(), false);
+            openFunction(fd->parameters, fd->body.get());
+        } else if (auto fl = dynamic_cast<FunctionLiteral*>(node)) {
+            openFunction(fl->parameters, fl->body.get());
+        } else if (auto le = dynamic_cast<LambdaExpression*>(node)) {
+            openFunction(le->parameters, nullptr);
+        } else if (dynamic_cast<ForStatement*>(node)) {
+            blocks_.emplace_back();
+        } else if (auto fi = dynamic_cast<ForInStatement*>(node)) {
+            blocks_.emplace_back();
+            shared_.insert(fi->body.get());
+            declare(fi->key.get(), false);
+            declare(fi->value.get(), false);
+        } else if (auto cd = dynamic_cast<ClassDeclaration*>(node)) {
+            declare(cd->name.get(), false);
+            blocks_.emplace_back();
+            shared_.insert(cd->body.get());
+        } else if (auto ws = dynamic_cast<WithStatement*>(node)) {
+            blocks_.emplace_back();
+            shared_.insert(ws->body.get());
+            declare(ws->variable.get(), false);
+        } else if (auto ts = dynamic_cast<TryStatement*>(node)) {
+            for (auto& clause : ts->catchClauses)
+                if (clause && clause->variable) bindings_[clause->catchBlock.get()] = {clause->variable.get()};
+        } else if (auto ms = dynamic_cast<MatchStatement*>(node)) {
+            for (auto& arm : ms->cases) {
+                auto& captures = bindings_[arm->body.get()];
+                arm->pattern->captures(captures);
+                names_.insert(captures.begin(), captures.end());
+            }
+        } else if (auto sb = dynamic_cast<StandaloneBlockStatement*>(node)) {
+            shared_.insert(sb->block.get());
+        } else if (auto bs = dynamic_cast<BlockStatement*>(node)) {
+            if (!shared_.count(bs)) {
+                blocks_.emplace_back();
+                auto it = bindings_.find(bs);
+                if (it != bindings_.end())
+                    for (auto* id : it->second) declare(id, false);
+            }
+        } else if (auto ml = dynamic_cast<MapLiteral*>(node)) {
+            checkKeys(ml);
+        } else if (auto id = dynamic_cast<Identifier*>(node)) {
+            if (!names_.count(id) && !scopes_.empty()) scopes_.back().used.insert(id->value);
+        }
+        return true;
+    }
+
+    void leave(Node* node) override {
+        if (dynamic_cast<ForStatement*>(node) || dynamic_cast<ForInStatement*>(node) ||
+            dynamic_cast<ClassDeclaration*>(node) || dynamic_cast<WithStatement*>(node) ||
+            (dynamic_cast<BlockStatement*>(node) && !shared_.count(node))) {
+            blocks_.pop_back();
+            return;
+        }
+        if (!dynamic_cast<FunctionDeclaration*>(node) && !dynamic_cast<FunctionLiteral*>(node) &&
+            !dynamic_cast<LambdaExpression*>(node))
+            return;
+        blocks_.pop_back();
+        auto scope = std::move(scopes_.back());
+        scopes_.pop_back();
+        for (auto* id : scope.declared) {
+            if (scope.used.count(id->value)) continue;
+            report(id, "unused", "variable '" + id->value + "' is declared but never used");
+        }
+        if (!scopes_.empty()) scopes_.back().used.insert(scope.used.begin(), scope.used.end());
+    }
+
+    ObjectPtr error() const { return error_; }
+
+private:
+    struct Scope {
+        std::vector<Identifier*> declared;
+        std::unordered_set<std::string> used;
+    };
+
+    // The names one block declares; function marks a function's own scope,
+    // the one holding its parameters.
+    struct Block {
+        std::unordered_map<std::string, Identifier*> names;
+        std::unordered_set<std::string> parameters;
+        bool function = false;
+    };
+
+    bool failed() const { return error_ != nullptr; }
+
+    void openFunction(const std::vector<IdentifierPtr>& parameters, BlockStatement* body) {
+        scopes_.emplace_back();
+        blocks_.emplace_back();
+        blocks_.back().function = true;
+        if (body) shared_.insert(body);
+        for (auto& p : parameters) {
+            declare(p.get(), false);
+            if (p) blocks_.back().parameters.insert(p->value);
+        }
+    }
+
+    // Records a declaration; variables are checked for use at function exit.
+    // Warns when it repeats a name declared in the same block, or reuses a
+    // parameter of the function it is in.
+    void declare(Identifier* id, bool variable) {
+        if (!id) return;
+        names_.insert(id);
+        if (isBuiltin_(id->value)) report(id, "shadow", "'" + id->value + "' shadows the builtin of the same name");
+        for (auto block = blocks_.rbegin(); block != blocks_.rend(); ++block) {
+            if (block->parameters.count(id->value)) {
+                report(id, "shadow", "'" + id->value + "' shadows the parameter of the same name");
+                break;
+            }
+            if (block->function) break;
+        }
+        auto& names = blocks_.back().names;
+        auto previous = names.find(id->value);
+        if (previous != names.end() && !blocks_.back().parameters.count(id->value))
+            report(id, "redeclare", "'" + id->value + "' is already declared in this scope, at line " +
+                                        std::to_string(previous->second->token.line));
+        names[id->value] = id;
+        if (variable && !scopes_.empty() && id->value[0] != '_') scopes_.back().declared.push_back(id);
+    }
+
+    void checkKeys(MapLiteral* map) {
+        std::vector<ObjectPtr> seen;
+        for (auto& [k, v] : map->pairs) {
+            const Token* t = nullptr;
+            auto key = literalKey(k.get(), &t);
+            if (!key) continue;
+            if (std::none_of(seen.begin(), seen.end(), [&](auto& other) { return equals(other, key); })) {
+                seen.push_back(key);
+                continue;
+            }
+            if (failed()) return;
+            error_ = Warnings::instance().warn("duplicate-key", duplicateKeyWarning(key), t->file, t->line, t->column);
+        }
+    }
+
+    void report(Identifier* id, const std::string& category, const std::string& message) {
+        if (failed()) return;
+        error_ = Warnings::instance().warn(category, message, id->token.file, id->token.line, id->token.column);
+    }
+
+    const std::function<bool(const std::string&)>& isBuiltin_;
+    std::vector<Scope> scopes_;
+    std::vector<Block> blocks_;
+    std::unordered_set<Node*> shared_; // blocks that run in the scope around them
+    std::unordered_map<Node*, std::vector<Identifier*>> bindings_; // a catch variable or a case's captures
+    std::unordered_set<Node*> names_; // declaration names, not references
+    ObjectPtr error_;
+};
+
+// Collects, per function, the names it declares and the plain names it
+// assigns. When a function ends, the assignments it does not declare pass to
+// the function around it; those left at the top level are undeclared.
+class UndeclaredAssignments : public walk::Visitor {
+public:
+    UndeclaredAssignments() { scopes_.emplace_back(); }
+
+    bool enter(Node* node) override {
+        if (auto ls = dynamic_cast<LetStatement*>(node)) {
+            declare(ls->name.get());
+        } else if (auto as = dynamic_cast<AssignStatement*>(node)) {
+            assign(as->target.get());
+        } else if (auto ae = dynamic_cast<AssignExpression*>(node)) {
+            assign(ae->name.get());
+        } else if (auto fd = dynamic_cast<FunctionDeclaration*>(node)) {
+            declare(fd->name.get());
+            open(fd->parameters);
+        } else if (auto fl = dynamic_cast<FunctionLiteral*>(node)) {
+            open(fl->parameters);
+        } else if (auto le = dynamic_cast<LambdaExpression*>(node)) {
+            open(le->parameters);
+        } else if (auto fi = dynamic_cast<ForInStatement*>(node)) {
+            declare(fi->key.get());
+            declare(fi->value.get());
+        } else if (auto cd = dynamic_cast<ClassDeclaration*>(node)) {
+            declare(cd->name.get());
+        } else if (auto ts = dynamic_cast<TryStatement*>(node)) {
+            for (auto& clause : ts->catchClauses)
+                if (clause) declare(clause->variable.get());
+        } else if (auto ws = dynamic_cast<WithStatement*>(node)) {
+            declare(ws->variable.get());
+        } else if (auto ms = dynamic_cast<MatchStatement*>(node)) {
+            std::vector<Identifier*> captures;
+            for (auto& arm : ms->cases) arm->pattern->captures(captures);
+            for (auto* id : captures) declare(id);
+        } else if (auto is = dynamic_cast<ImportStatement*>(node)) {
+            auto& declared = scopes_.back().declared;
+            if (!is->names.empty()) {
+                for (auto& name : is->names) declared.insert(name->value);
+            } else if (is->alias) {
+                declared.insert(is->alias->value);
+            } else if (is->path) {
+                declared.insert(is->path->value.substr(is->path->value.find(':') + 1));
+            }
+        }
+        return true;
+    }
+
+    void leave(Node* node) override {
+        if (!dynamic_cast<FunctionDeclaration*>(node) && !dynamic_cast<FunctionLiteral*>(node) &&
+            !dynamic_cast<LambdaExpression*>(node))
+            return;
+        auto scope = std::move(scopes_.back());
+        scopes_.pop_back();
+        for (auto* id : scope.assigned)
+            if (!scope.declared.count(id->value)) scopes_.back().assigned.push_back(id);
+    }
+
+    ObjectPtr report() {
+        auto& top = scopes_.front();
+        std::vector<Identifier*> undeclared;
+        for (auto* id : top.assigned)
+            if (!top.declared.count(id->value)) undeclared.push_back(id);
+        std::stable_sort(undeclared.begin(), undeclared.end(), [](Identifier* a, Identifier* b) {
+            return a->token.line != b->token.line ? a->token.line < b->token.line : a->token.column < b->token.column;
+        });
+        for (auto* id : undeclared) {
+            auto& t = id->token;
+            if (auto err = Warnings::instance().warn("strict", "assignment to undeclared name '" + id->value + "'; declare it with var",
+                                                     t.file, t.line, t.column))
+                return err;
+        }
+        return nullptr;
+    }
+
+private:
+    struct Scope {
+        std::unordered_set<std::string> declared;
+        std::vector<Identifier*> assigned;
+    };
+
+    void declare(Identifier* id) {
+        if (id) scopes_.back().declared.insert(id->value);
+    }
+
+    void assign(Node* target) {
+        if (auto id = dynamic_cast<Identifier*>(target)) scopes_.back().assigned.push_back(id);
+    }
+
+    void open(const std::vector<IdentifierPtr>& parameters) {
+        scopes_.emplace_back();
+        for (auto& p : parameters) declare(p.get());
+    }
+
+    std::vector<Scope> scopes_;
+};
+
+} // namespace
+
+ObjectPtr lintProgram(Program* program, const std::function<bool(const std::string&)>& isBuiltin) {
+    if (Warnings::instance().action() == WarningAction::Ignore) return nullptr;
+    Linter linter(isBuiltin);
+    walk::walk(linter, program);
+    return linter.error();
+}
+
+ObjectPtr lintUndeclaredAssignments(Program* program) {
+    if (Warnings::instance().action() == WarningAction::Ignore) return nullptr;
+    UndeclaredAssignments lint;
+    walk::walk(lint, program);
+    return lint.report();
+}
+
+} // namespace darix
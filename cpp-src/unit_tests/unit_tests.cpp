@@ -0,0 +1,185 @@
+// Checks internals the language tests cannot reach from a script. Built by
+// the unit_tests CMake target and run in CI; prints a FAIL line for each
+// broken check and exits with 1 if there was any.
+#include "darix/ast_walk.hpp"
+#include "darix/code.hpp"
+#include "darix/compiler.hpp"
+#include "darix/object.hpp"
+#include "darix/parser.hpp"
+#include "darix/vm.hpp"
+
+#include <iostream>
+#include <stdexcept>
+#include <string>
+#include <vector>
+
+using namespace darix;
+
+static int failures = 0;
+
+static void check(const std::string& name, bool ok, const std::string& detail = "") {
+    if (ok) return;
+    std::cout << "FAIL: " << name << (detail.empty() ? "" : ": " + detail) << "\n";
+    failures++;
+}
+
+// ============ Incremental parsing ============
+
+static std::shared_ptr<Program> parse(const std::string& source) {
+    Lexer lexer(source);
+    Parser parser(lexer);
+    return parser.parseProgram();
+}
+
+// Every node's span in pre-order, for comparing two parses.
+static std::vector<std::pair<int, int>> spans(Node* root) {
+    std::vector<std::pair<int, int>> out;
+    walk::inspect(root, [&](Node* node) {
+        out.push_back({node->span.start, node->span.end});
+        return true;
+    });
+    return out;
+}
+
+// The line, column and offset of every token in pre-order.
+static std::vector<std::vector<int>> positions(Node* root) {
+    std::vector<std::vector<int>> out;
+    walk::inspect(root, [&](Node* node) {
+        walk::tokens(node, [&](Token& tok) { out.push_back({tok.line, tok.column, tok.offset, tok.endOffset}); });
+        return true;
+    });
+    return out;
+}
+
+// Replaces text at [start, start + length) of before with replacement and
+// checks that reparsing gives what parsing the new text from scratch gives,
+// reusing at least minReused statements.
+static void checkReparse(const std::string& name, const std::string& before, int start, int length,
+                         const std::string& replacement, size_t minReused) {
+    std::string after = before.substr(0, start) + replacement + before.substr(start + length);
+    auto result = reparseProgram(parse(before), before, after,
+                                 {start, start + length, start + static_cast<int>(replacement.size())});
+    Lexer lexer(after);
+    Parser parser(lexer);
+    auto full = parser.parseProgram();
+    check(name + ": same errors", result.errors == parser.errors(), result.errors.empty() ? "" : result.errors[0]);
+    check(name + ": same tree", result.program->inspect() == full->inspect(), result.program->inspect());
+    check(name + ": same spans", spans(result.program.get()) == spans(full.get()));
+    check(name + ": same token positions", positions(result.program.get()) == positions(full.get()));
+    check(name + ": statements reused", result.reusedStatements >= minReused,
+          std::to_string(result.reusedStatements) + " reused");
+}
+
+static void testReparse() {
+    std::string source = "var a = 1\nvar b = 2\nfunc f(x) {\n    return x * 2\n}\nvar c = f(b)\nvar d = [a, b]\n";
+    int inBody = static_cast<int>(source.find("x * 2"));
+    checkReparse("edit inside a function", source, inBody + 4, 1, "30", 3);
+    checkReparse("edit in the first statement", source, 8, 1, "100", 4);
+    checkReparse("edit in the last statement", source, static_cast<int>(source.find("[a")) + 1, 0, "a, ", 3);
+    checkReparse("adding a line", source, 10, 0, "var e = 5\n", 4);
+    checkReparse("removing a statement", source, 10, 10, "", 3);
+    checkReparse("adding lines to a function", source, inBody, 0, "print(x)\n\n    ", 2);
+    checkReparse("edit on the line of the next statement", "var a = 1; var b = 2\nvar c = 3\n", 8, 1, "10", 2);
+    checkReparse("joining statements", "var a = 1\n-2\nvar b = 3\n", 9, 0, " +", 1);
+    checkReparse("a string swallowing statements", source, 8, 0, "\"", 0);
+
+    // Every kind of token moves with a reused statement.
+    std::string kinds = "var a = 1\nx = x + 1\nfor (k, v in m) { print(k) }\n"
+                        "match (a) { case [1, *r] if r { pass } case {\"k\": v} { print(v) } case _ { } }\n"
+                        "try { f() } catch (TypeError | ValueError e) { throw e } finally { g() }\n"
+                        "@dec\nfunc h(p) { defer close(); return p |> str }\n"
+                        "class C { func m() { return this } }\nvar l = lambda x: x * 2\n";
+    checkReparse("moving every kind of statement", kinds, 4, 1, "first = 0\nvar b", 7);
+
+    // Statements after the edit keep their nodes, moved by the change in length.
+    auto previous = parse(source);
+    auto last = previous->statements.back();
+    auto result = reparseProgram(previous, source, source.substr(0, 8) + "123" + source.substr(9), {8, 9, 11});
+    check("reused statements are the same nodes", result.program->statements.back() == last);
+    check("reused statements are shifted", last->span.start == static_cast<int>(source.find("var d")) + 2);
+}
+
+// ============ Assembler and verifier ============
+
+// The verifier's complaint about the assembled text, or "" if it passes.
+static std::string verifyError(const std::string& text, size_t numConstants = 0, bool balanced = false) {
+    Bytecode bc;
+    bc.instructions = Assemble(text);
+    for (size_t i = 0; i < numConstants; i++) bc.constants.push_back(newInteger(static_cast<int64_t>(i)));
+    std::string error;
+    return verifyBytecode(bc, &error, balanced) ? "" : error;
+}
+
+// The message Assemble throws for text, or "" if it assembles.
+static std::string assembleError(const std::string& text) {
+    try {
+        Assemble(text);
+        return "";
+    } catch (const std::runtime_error& e) {
+        return e.what();
+    }
+}
+
+static void testAssembler() {
+    // Disassembling compiled code and assembling it again gives the same bytes.
+    auto program = parse("var a = 1\nvar b = a + 2\nif (b > 2) { print(b) } else { print(a) }\n"
+                         "for (x in [a, b]) { print(x) }\nfunc f(n) { return n * 2 }\nprint(f(b))\n");
+    Compiler compiler;
+    check("test program compiles", compiler.compile(program.get()));
+    auto bc = compiler.bytecode();
+    check("assembling the disassembly round-trips", Assemble(Disassemble(bc->instructions, {"a", "b"})) == bc->instructions);
+
+    int pc = 0;
+    for (const auto& in : Decode(bc->instructions)) {
+        check("decoded instructions are contiguous", in.pc == pc, std::to_string(in.pc));
+        pc += in.width;
+    }
+    check("decoding covers every byte", pc == static_cast<int>(bc->instructions.size()));
+
+    check("assembling rejects unknown opcodes", assembleError("OpTrue\nOpFly") == "line 2: unknown opcode OpFly");
+    check("assembling rejects missing operands",
+          assembleError("OpConstant") == "line 1: OpConstant takes 1 operand(s), got 0");
+    check("assembling rejects wide operands", assembleError("OpJump 70000") == "line 1: bad operand 70000 for OpJump");
+    check("assembling skips offsets and comments", Assemble("0000 OpTrue  # cond\n\n0001 OpPop\n") ==
+                                                      Assemble("OpTrue\nOpPop"));
+
+    // The verifier's checks, one broken program each.
+    check("a valid program verifies", verifyError("OpConstant 0\nOpPop", 1) == "");
+    check("constant out of range", verifyError("OpConstant 1\nOpPop", 1) == "pc 0: constant 1 out of range (1 constants)",
+          verifyError("OpConstant 1\nOpPop", 1));
+    check("locals outside a function", verifyError("OpGetLocal 0\nOpPop") == "pc 0: OpGetLocal outside a function");
+    check("jump into an instruction", verifyError("OpJump 1\nOpNull\nOpPop") ==
+                                          "pc 0: jump target 1 is not an instruction boundary");
+    check("jump past the end", verifyError("OpJump 9") == "pc 0: jump target 9 is not an instruction boundary");
+    check("stack underflow", verifyError("OpTrue\nOpAdd\nOpPop") == "pc 1: stack underflow in OpAdd (needs 2, has 1)",
+          verifyError("OpTrue\nOpAdd\nOpPop"));
+    check("loop variable count", verifyError("OpNull\nOpIterable 3") == "pc 1: OpIterable takes 1 or 2 loop variables, not 3");
+    // Only the then branch pushes, so the depths differ where they meet.
+    std::string uneven = "OpTrue\nOpJumpNotTruthy 8\nOpTrue\nOpJump 8\nOpNull\nOpPop";
+    check("branches leave different depths", verifyError(uneven).find("at jump to 8 differs from") != std::string::npos,
+          verifyError(uneven));
+    check("a leftover value is allowed unbalanced", verifyError("OpTrue") == "");
+    check("a leftover value fails balanced", verifyError("OpTrue", 0, true) == "pc 0: stack depth 1 at the end of the program",
+          verifyError("OpTrue", 0, true));
+}
+
+// ============ String interning ============
+
+static void testIntern() {
+    check("equal literals are one string", internString("key") == internString("key"));
+    std::string longText(300, 'x');
+    check("long strings are not interned", internString(longText) != internString(longText));
+    check("uninterned strings still compare equal", equals(internString(longText), internString(longText)));
+}
+
+int main() {
+    testReparse();
+    testAssembler();
+    testIntern();
+    if (failures) {
+        std::cout << failures << " check(s) failed\n";
+        return 1;
+    }
+    std::cout << "all unit checks passed\n";
+    return 0;
+}